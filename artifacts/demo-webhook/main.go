@@ -1,35 +1,235 @@
+// Command demo-webhook is a webhook receiver for debugging the
+// notifications of the Alertmanager. It verifies their HMAC signatures,
+// keeps the most recent payloads of each group key, serves them by a web UI
+// and a JSON API, and can delay or fail requests to exercise the retries.
 package main
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var port = "5001"
+// maxBodySize limits the size of the notifications read.
+const maxBodySize = 10 << 20
 
-func init() {
-	flag.StringVar(&port, "p", "5001", "port")
-	flag.Parse()
+type options struct {
+	port string
+
+	secret          string
+	signatureHeader string
+	timestampHeader string
+	maxSkew         time.Duration
+
+	maxGroups   int
+	maxPerGroup int
+	verbose     bool
+
+	latency     time.Duration
+	errorRate   float64
+	errorStatus int
 }
 
 func main() {
+	var o options
+	flag.StringVar(&o.port, "p", "5001", "port")
+	flag.StringVar(&o.secret, "secret", "", "secret of the HMAC signatures of the webhook signing config, unverified if empty")
+	flag.StringVar(&o.signatureHeader, "signature-header", "X-Alertmanager-Signature", "header of the HMAC signature")
+	flag.StringVar(&o.timestampHeader, "timestamp-header", "X-Alertmanager-Timestamp", "header of the signed timestamp")
+	flag.DurationVar(&o.maxSkew, "max-skew", 5*time.Minute, "maximum age of the signed timestamp, 0 to accept any")
+	flag.IntVar(&o.maxGroups, "max-groups", 100, "number of group keys kept, the least recently notified are dropped")
+	flag.IntVar(&o.maxPerGroup, "max-per-group", 20, "number of notifications kept per group key")
+	flag.BoolVar(&o.verbose, "v", false, "log the payloads")
+	flag.DurationVar(&o.latency, "latency", 0, "delay of the responses")
+	flag.Float64Var(&o.errorRate, "error-rate", 0, "fraction of the notifications failed, between 0 and 1")
+	flag.IntVar(&o.errorStatus, "error-status", http.StatusInternalServerError, "status code of the failed notifications")
+	flag.Parse()
+
+	if o.errorRate < 0 || o.errorRate > 1 {
+		log.Fatal("-error-rate must be between 0 and 1")
+	}
+	if o.maxGroups <= 0 || o.maxPerGroup <= 0 {
+		log.Fatal("-max-groups and -max-per-group must be positive")
+	}
+
 	log.Println("starting....")
+	log.Fatal(http.ListenAndServe(":"+o.port, newWebhook(o, rand.New(rand.NewSource(time.Now().UnixNano())).Float64)))
+}
 
-	log.Fatal(http.ListenAndServe(":"+port, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		b, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			panic(err)
+type webhook struct {
+	options
+	store *store
+	// random returns a pseudo-random number in [0,1) deciding which
+	// notifications fail.
+	random func() float64
+	mux    *http.ServeMux
+}
+
+func newWebhook(o options, random func() float64) *webhook {
+	wh := &webhook{options: o, store: newStore(o.maxGroups, o.maxPerGroup), random: random, mux: http.NewServeMux()}
+	wh.mux.HandleFunc("/api/groups", wh.listGroups)
+	wh.mux.HandleFunc("/api/notifications", wh.notifications)
+	wh.mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+	return wh
+}
+
+// ServeHTTP receives the notifications posted to any path but the API, and
+// serves the UI otherwise.
+func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && !strings.HasPrefix(r.URL.Path, "/api/"):
+		wh.receive(w, r)
+	case r.URL.Path == "/":
+		wh.ui(w, r)
+	default:
+		wh.mux.ServeHTTP(w, r)
+	}
+}
+
+func (wh *webhook) receive(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if wh.latency > 0 {
+		select {
+		case <-time.After(wh.latency):
+		case <-r.Context().Done():
+			log.Printf("request canceled after %s: %v", wh.latency, r.Context().Err())
+			return
 		}
-		defer r.Body.Close()
+	}
+
+	n := &notification{
+		ReceivedAt:  time.Now(),
+		GroupKey:    payloadGroupKey(body),
+		Path:        r.URL.Path,
+		ContentType: r.Header.Get("Content-Type"),
+		Status:      http.StatusOK,
+		Payload:     body,
+	}
+	if !json.Valid(body) {
+		n.Payload, _ = json.Marshal(string(body))
+	}
+	if wh.secret != "" {
+		if err := wh.verify(r.Header, body, n.ReceivedAt); err != nil {
+			log.Printf("rejected notification of group %q: %v", n.GroupKey, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		n.Verified = true
+	}
+	if wh.errorRate > 0 && wh.random() < wh.errorRate {
+		n.Status = wh.errorStatus
+	}
+	wh.store.add(n)
+
+	log.Printf("received notification of group %q, responding %d", n.GroupKey, n.Status)
+	if wh.verbose {
 		var buf bytes.Buffer
-		if err := json.Indent(&buf, b, " >", "  "); err != nil {
-			panic(err)
+		if err := json.Indent(&buf, body, " >", "  "); err == nil {
+			log.Println(buf.String())
+		}
+	}
+	if n.Status != http.StatusOK {
+		http.Error(w, "injected error", n.Status)
+	}
+}
+
+// verify checks the HMAC-SHA256 signature of the timestamp header value, a
+// dot and the body, sent hex encoded as "sha256=<signature>".
+func (wh *webhook) verify(h http.Header, body []byte, now time.Time) error {
+	ts := h.Get(wh.timestampHeader)
+	if ts == "" {
+		return fmt.Errorf("missing %s header", wh.timestampHeader)
+	}
+	if wh.maxSkew > 0 {
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s header: %v", wh.timestampHeader, err)
+		}
+		if d := now.Sub(time.Unix(sec, 0)); d > wh.maxSkew || d < -wh.maxSkew {
+			return fmt.Errorf("timestamp %s is off by %s", ts, d)
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(wh.secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(h.Get(wh.signatureHeader))) {
+		return fmt.Errorf("invalid %s header", wh.signatureHeader)
+	}
+	return nil
+}
+
+// payloadGroupKey returns the group key of the webhook payload, the subject
+// of CloudEvents, or "unknown".
+func payloadGroupKey(body []byte) string {
+	var p struct {
+		GroupKey string `json:"groupKey"`
+		Subject  string `json:"subject"`
+	}
+	_ = json.Unmarshal(body, &p)
+	switch {
+	case p.GroupKey != "":
+		return p.GroupKey
+	case p.Subject != "":
+		return p.Subject
+	}
+	return "unknown"
+}
+
+func (wh *webhook) listGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, wh.store.summaries())
+}
+
+// notifications lists the notifications, of the groupKey parameter if set,
+// at most limit of them. Delete drops all notifications.
+func (wh *webhook) notifications(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
 		}
-		log.Println(buf.String())
-	})))
+		writeJSON(w, wh.store.notifications(r.URL.Query().Get("groupKey"), limit))
+	case http.MethodDelete:
+		wh.store.reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error writing response: %v", err)
+	}
 }
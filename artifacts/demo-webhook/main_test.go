@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testOptions() options {
+	return options{
+		signatureHeader: "X-Alertmanager-Signature",
+		timestampHeader: "X-Alertmanager-Timestamp",
+		maxSkew:         time.Minute,
+		maxGroups:       2,
+		maxPerGroup:     2,
+		errorStatus:     http.StatusServiceUnavailable,
+	}
+}
+
+func post(wh *webhook, body string, header http.Header) int {
+	req := httptest.NewRequest(http.MethodPost, "/alerts", strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	wh.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestReceive(t *testing.T) {
+	wh := newWebhook(testOptions(), func() float64 { return 0 })
+	for i, key := range []string{"a", "a", "a", "b", "c"} {
+		if code := post(wh, `{"groupKey":"`+key+`","n":`+strconv.Itoa(i)+`}`, nil); code != http.StatusOK {
+			t.Fatalf("unexpected status %d", code)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code := post(wh, `{"subject":"d"}`, nil); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+
+	groups := wh.store.summaries()
+	if len(groups) != 2 || groups[0].GroupKey != "d" || groups[1].GroupKey != "c" {
+		t.Fatalf("expected the least recently notified groups to be dropped, got %v", groups)
+	}
+	wh.store.add(&notification{GroupKey: "c", ReceivedAt: time.Now(), Status: 200})
+	wh.store.add(&notification{GroupKey: "c", ReceivedAt: time.Now(), Status: 200})
+	if ns := wh.store.notifications("c", 0); len(ns) != 2 {
+		t.Fatalf("expected 2 notifications kept, got %d", len(ns))
+	}
+	if ns := wh.store.notifications("", 1); len(ns) != 1 || ns[0].GroupKey != "c" {
+		t.Fatalf("expected the most recent notification, got %v", ns)
+	}
+
+	rec := httptest.NewRecorder()
+	wh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?groupKey=d", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `&#34;subject&#34;: &#34;d&#34;`) {
+		t.Fatalf("expected the UI to show the notification, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestReceiveSigned(t *testing.T) {
+	o := testOptions()
+	o.secret = "s3cr3t"
+	wh := newWebhook(o, func() float64 { return 0 })
+
+	body := `{"groupKey":"a"}`
+	sign := func(ts string) http.Header {
+		mac := hmac.New(sha256.New, []byte(o.secret))
+		mac.Write([]byte(ts + "." + body))
+		return http.Header{
+			"X-Alertmanager-Timestamp": {ts},
+			"X-Alertmanager-Signature": {"sha256=" + hex.EncodeToString(mac.Sum(nil))},
+		}
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if code := post(wh, body, sign(now)); code != http.StatusOK {
+		t.Fatalf("expected the signed notification to be accepted, got %d", code)
+	}
+	if ns := wh.store.notifications("a", 0); len(ns) != 1 || !ns[0].Verified {
+		t.Fatalf("expected a verified notification, got %v", ns)
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	for name, h := range map[string]http.Header{
+		"unsigned":  nil,
+		"stale":     sign(old),
+		"tampered":  {"X-Alertmanager-Timestamp": {now}, "X-Alertmanager-Signature": sign(old)["X-Alertmanager-Signature"]},
+		"malformed": {"X-Alertmanager-Timestamp": {"now"}},
+	} {
+		if code := post(wh, body, h); code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected the notification to be rejected, got %d", name, code)
+		}
+	}
+}
+
+func TestReceiveInjectedErrors(t *testing.T) {
+	o := testOptions()
+	o.errorRate = 0.5
+	rnd := []float64{0.1, 0.9}
+	wh := newWebhook(o, func() float64 {
+		r := rnd[0]
+		rnd = rnd[1:]
+		return r
+	})
+	if code := post(wh, `{"groupKey":"a"}`, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected an injected error, got %d", code)
+	}
+	if code := post(wh, `{"groupKey":"a"}`, nil); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if g := wh.store.summaries()[0]; g.Received != 2 || g.Failed != 1 {
+		t.Fatalf("expected 2 notifications with a failure, got %+v", g)
+	}
+}
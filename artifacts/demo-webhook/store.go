@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// notification is a request received by the webhook.
+type notification struct {
+	ReceivedAt  time.Time `json:"receivedAt"`
+	GroupKey    string    `json:"groupKey"`
+	Path        string    `json:"path"`
+	ContentType string    `json:"contentType"`
+	// Verified is true if the HMAC signature of the request was verified.
+	Verified bool `json:"verified"`
+	// Status is the status code the webhook responded with, an injected
+	// error or 200.
+	Status  int             `json:"status"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// groupSummary summarizes the notifications received for a group key.
+type groupSummary struct {
+	GroupKey       string    `json:"groupKey"`
+	Received       int       `json:"received"`
+	Failed         int       `json:"failed"`
+	LastReceivedAt time.Time `json:"lastReceivedAt"`
+}
+
+type group struct {
+	groupSummary
+	// notifications are the most recent notifications, oldest first.
+	notifications []*notification
+}
+
+// store keeps the most recent notifications of each group key in memory.
+// The least recently notified group is dropped once there are too many.
+type store struct {
+	maxGroups   int
+	maxPerGroup int
+
+	mtx    sync.RWMutex
+	groups map[string]*group
+}
+
+func newStore(maxGroups, maxPerGroup int) *store {
+	return &store{maxGroups: maxGroups, maxPerGroup: maxPerGroup, groups: map[string]*group{}}
+}
+
+func (s *store) add(n *notification) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	g, ok := s.groups[n.GroupKey]
+	if !ok {
+		if len(s.groups) >= s.maxGroups {
+			s.evict()
+		}
+		g = &group{groupSummary: groupSummary{GroupKey: n.GroupKey}}
+		s.groups[n.GroupKey] = g
+	}
+	g.Received++
+	if n.Status != 200 {
+		g.Failed++
+	}
+	g.LastReceivedAt = n.ReceivedAt
+	g.notifications = append(g.notifications, n)
+	if len(g.notifications) > s.maxPerGroup {
+		g.notifications = g.notifications[len(g.notifications)-s.maxPerGroup:]
+	}
+}
+
+// evict drops the least recently notified group.
+func (s *store) evict() {
+	var oldest *group
+	for _, g := range s.groups {
+		if oldest == nil || g.LastReceivedAt.Before(oldest.LastReceivedAt) {
+			oldest = g
+		}
+	}
+	if oldest != nil {
+		delete(s.groups, oldest.GroupKey)
+	}
+}
+
+// summaries returns the groups, the most recently notified first.
+func (s *store) summaries() []groupSummary {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	res := make([]groupSummary, 0, len(s.groups))
+	for _, g := range s.groups {
+		res = append(res, g.groupSummary)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LastReceivedAt.After(res[j].LastReceivedAt) })
+	return res
+}
+
+// notifications returns at most limit notifications of the group key, or
+// of all groups if it is empty, the most recent first.
+func (s *store) notifications(groupKey string, limit int) []*notification {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	res := []*notification{}
+	for key, g := range s.groups {
+		if groupKey == "" || key == groupKey {
+			res = append(res, g.notifications...)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ReceivedAt.After(res[j].ReceivedAt) })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+func (s *store) reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.groups = map[string]*group{}
+}
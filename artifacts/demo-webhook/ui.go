@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"indent": func(p json.RawMessage) string {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, p, "", "  "); err != nil {
+			return string(p)
+		}
+		return buf.String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>Alertmanager webhook</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+pre { background: #f4f4f4; padding: 0.6em; overflow-x: auto; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Groups</h1>
+<table>
+<tr><th>Group key</th><th>Received</th><th>Failed</th><th>Last received</th></tr>
+{{range .Groups}}<tr>
+<td><a href="?groupKey={{.GroupKey}}">{{.GroupKey}}</a></td><td>{{.Received}}</td><td>{{.Failed}}</td><td>{{.LastReceivedAt.Format "2006-01-02 15:04:05"}}</td>
+</tr>{{else}}<tr><td colspan="4">No notifications received.</td></tr>{{end}}
+</table>
+<h1>Notifications{{if .GroupKey}} of {{.GroupKey}} (<a href="/">all</a>){{end}}</h1>
+{{range .Notifications}}<h3{{if ne .Status 200}} class="failed"{{end}}>{{.ReceivedAt.Format "2006-01-02 15:04:05.000"}} {{.GroupKey}} &rarr; {{.Status}}{{if .Verified}}, signature verified{{end}}</h3>
+<pre>{{indent .Payload}}</pre>
+{{end}}
+</body>
+</html>
+`))
+
+// uiNotifications is the number of notifications shown by the UI.
+const uiNotifications = 50
+
+// ui lists the groups and the most recent notifications, of the groupKey
+// parameter if set.
+func (wh *webhook) ui(w http.ResponseWriter, r *http.Request) {
+	groupKey := r.URL.Query().Get("groupKey")
+	data := struct {
+		GroupKey      string
+		Groups        []groupSummary
+		Notifications []*notification
+	}{
+		GroupKey:      groupKey,
+		Groups:        wh.store.summaries(),
+		Notifications: wh.store.notifications(groupKey, uiNotifications),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiTemplate.Execute(w, data); err != nil {
+		log.Printf("error rendering the UI: %v", err)
+	}
+}
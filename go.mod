@@ -4,26 +4,34 @@ go 1.12
 
 require (
 	github.com/appscode/go v0.0.0-20191119085241-0887d8ec2ecc
+	github.com/cenkalti/backoff v2.1.1+incompatible
+	github.com/cespare/xxhash v1.1.0
 	github.com/coreos/bbolt v1.3.3 // indirect
 	github.com/coreos/go-systemd v0.0.0-20191104093116-d3cd4ed1dbcf // indirect
 	github.com/coreos/pkg v0.0.0-20180928190104-399ea9e2e55f // indirect
 	github.com/cortexproject/cortex v0.0.0-20190525232146-bec610fe59c0
 	github.com/go-kit/kit v0.8.0
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
+	github.com/golang/protobuf v1.3.1
 	github.com/gorilla/mux v1.7.2
 	github.com/gorilla/websocket v1.4.1 // indirect
 	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1
+	github.com/opentracing/opentracing-go v1.0.2
 	github.com/pkg/errors v0.8.1
 	github.com/prometheus/alertmanager v0.17.0
 	github.com/prometheus/client_golang v0.9.3-0.20190127221311-3c4408c8b829
 	github.com/prometheus/common v0.3.0
+	github.com/prometheus/prometheus v0.0.0-20190417125241-3cc5f9d88062
 	github.com/spf13/cobra v0.0.4
 	github.com/spf13/pflag v1.0.3
 	github.com/tmc/grpc-websocket-proxy v0.0.0-20190109142713-0ad062ec5ee5 // indirect
+	github.com/uber/jaeger-client-go v2.14.0+incompatible
 	github.com/weaveworks/common v0.0.0-20190515112636-283749cfd16f
 	github.com/xiang90/probing v0.0.0-20190116061207-43a291ad63a2 // indirect
 	go.etcd.io/etcd v3.3.13+incompatible
 	go.uber.org/zap v1.13.0 // indirect
+	google.golang.org/grpc v1.20.1
 	gopkg.in/yaml.v2 v2.2.4
 )
 
@@ -0,0 +1,126 @@
+package alertmanager
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// AccessLogConfig configures the logging of the requests to the config API
+// and to the APIs of the Alertmanagers of the users.
+type AccessLogConfig struct {
+	Enabled bool
+	// SampleRatio is the ratio of the requests logged. The failed and the
+	// slow requests are always logged.
+	SampleRatio float64
+	// SlowThreshold is the duration above which a request is slow. Disabled
+	// if 0.
+	SlowThreshold time.Duration
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet.
+func (c *AccessLogConfig) AddFlags(f *pflag.FlagSet) {
+	f.BoolVar(&c.Enabled, "server.access-log.enabled", true, "Log the requests to the API.")
+	f.Float64Var(&c.SampleRatio, "server.access-log.sample-ratio", 1, "Ratio of the requests logged. Requests failing with a 5xx status or slower than --server.access-log.slow-threshold are always logged.")
+	f.DurationVar(&c.SlowThreshold, "server.access-log.slow-threshold", 5*time.Second, "Duration above which requests are always logged. Disabled if 0.")
+}
+
+func (c *AccessLogConfig) Validate() error {
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.New("server.access-log.sample-ratio must be between 0 and 1")
+	}
+	if c.SlowThreshold < 0 {
+		return errors.New("server.access-log.slow-threshold must not be negative")
+	}
+	return nil
+}
+
+// accessLogWriter records the status and the size of a response. It keeps
+// the response flushable, which the event streams need.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// isProbe returns true for the requests of the health and readiness probes,
+// which are only logged if they fail.
+func isProbe(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/-/")
+}
+
+// LogRequests logs the requests handled by next, with the route of r they
+// match and the tenant they are made for.
+func LogRequests(c *AccessLogConfig, r *mux.Router, next http.Handler) http.Handler {
+	if !c.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		lw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, req)
+		elapsed := time.Since(start)
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+
+		failed := lw.status >= http.StatusInternalServerError
+		slow := c.SlowThreshold > 0 && elapsed > c.SlowThreshold
+		if !failed && !slow && (isProbe(req) || rand.Float64() >= c.SampleRatio) {
+			return
+		}
+
+		route := ""
+		var m mux.RouteMatch
+		if r.Match(req, &m) && m.Route != nil {
+			route, _ = m.Route.GetPathTemplate()
+		}
+		tenant, _ := ExtractUserIDFromHTTPRequest(req)
+		l := level.Info(logger2.Logger)
+		if failed {
+			l = level.Warn(logger2.Logger)
+		}
+		Must(l.Log(
+			"msg", "http request",
+			"method", req.Method,
+			"path", req.URL.Path,
+			"route", route,
+			"tenant", tenant,
+			"status", lw.status,
+			"duration", elapsed,
+			"request_bytes", req.ContentLength,
+			"response_bytes", lw.size,
+			"slow", slow,
+		))
+	})
+}
@@ -0,0 +1,561 @@
+package alertmanager
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+)
+
+const (
+	JobValidateConfigs = "validate_configs"
+	JobUpdateTemplates = "update_templates"
+	JobCreateSilences  = "create_silences"
+	// JobDeactivateConfigs, JobRestoreConfigs, JobSetRetention and
+	// JobSetFeatures change the configs of the selected users in bulk, for
+	// offboarding, plan changes and feature rollouts.
+	JobDeactivateConfigs = "deactivate_configs"
+	JobRestoreConfigs    = "restore_configs"
+	JobSetRetention      = "set_retention"
+	JobSetFeatures       = "set_features"
+)
+
+const (
+	// AdminAuthNone leaves the admin API unauthenticated, it must not be
+	// reachable by users.
+	AdminAuthNone = "none"
+	// AdminAuthToken requires a bearer token on admin API requests.
+	AdminAuthToken = "token"
+)
+
+// AdminAPI implements the operator facing api, which works across users.
+type AdminAPI struct {
+	client AlertmanagerClient
+	am     *MultitenantAlertmanager
+	jobs   *jobManager
+}
+
+// NewAdminAPI creates a new AdminAPI
+func NewAdminAPI(c AlertmanagerClient, am *MultitenantAlertmanager) *AdminAPI {
+	a := &AdminAPI{
+		client: c,
+		am:     am,
+	}
+	a.jobs = newJobManager(c, a.jobFunc, am.IsLeader, log.With(logger2.Logger, "component", "jobs"))
+	return a
+}
+
+// RunJobs runs the stored jobs while this replica is the leader, until the
+// MultitenantAlertmanager is stopped.
+func (a *AdminAPI) RunJobs() {
+	a.jobs.run(a.am.stop)
+}
+
+// RegisterRoutes registers the admin API HTTP routes with the provided Router.
+func (a *AdminAPI) RegisterRoutes(r *mux.Router) {
+	for _, route := range []struct {
+		name, method, path string
+		handler            http.HandlerFunc
+	}{
+		{"list_jobs", "GET", "/api/v1/admin/jobs", a.listJobs},
+		{"create_job", "POST", "/api/v1/admin/jobs", a.createJob},
+		{"get_job", "GET", "/api/v1/admin/jobs/{id}", a.getJob},
+		{"cancel_job", "DELETE", "/api/v1/admin/jobs/{id}", a.cancelJob},
+		{"list_tenants", "GET", "/api/v1/admin/tenants", a.listTenants},
+		{"get_tenant_status", "GET", "/api/v1/admin/tenants/{id}/status", a.getTenantStatus},
+		{"set_tenant_retention", "PUT", "/api/v1/admin/tenants/{id}/retention", a.setTenantRetention},
+		{"set_tenant_labels", "PUT", "/api/v1/admin/tenants/{id}/labels", a.setTenantLabels},
+		{"set_tenant_features", "PUT", "/api/v1/admin/tenants/{id}/features", a.setTenantFeatures},
+		{"get_inhibit_rules", "GET", "/api/v1/admin/inhibit-rules", a.getInhibitRules},
+		{"set_inhibit_rules", "PUT", "/api/v1/admin/inhibit-rules", a.setInhibitRules},
+		{"list_storms", "GET", "/api/v1/admin/storms", a.listStorms},
+		{"get_log_level", "GET", "/api/v1/admin/log-level", a.getLogLevel},
+		{"set_log_level", "PUT", "/api/v1/admin/log-level", a.setLogLevel},
+		{"resync", "POST", "/api/v1/admin/resync", a.resync},
+		{"list_library_templates", "GET", "/api/v1/admin/templates", a.listLibraryTemplates},
+		{"get_library_template", "GET", "/api/v1/admin/templates/{name}", a.getLibraryTemplate},
+		{"set_library_template", "PUT", "/api/v1/admin/templates/{name}", a.setLibraryTemplate},
+		{"delete_library_template", "DELETE", "/api/v1/admin/templates/{name}", a.deleteLibraryTemplate},
+		{"list_library_template_versions", "GET", "/api/v1/admin/templates/{name}/versions", a.listLibraryTemplateVersions},
+		{"get_library_template_version", "GET", "/api/v1/admin/templates/{name}/versions/{version}", a.getLibraryTemplateVersion},
+	} {
+		r.Handle(route.path, a.authenticate(route.handler)).Methods(route.method).Name(route.name)
+	}
+}
+
+// authenticate checks admin API requests according to the admin auth mode.
+func (a *AdminAPI) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	if a.am.cfg.AdminAuthMode != AdminAuthToken {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.hasAdminToken(r) {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hasAdminToken returns true if the request carries the admin token.
+func (a *AdminAPI) hasAdminToken(r *http.Request) bool {
+	want := []byte("Bearer " + a.am.cfg.adminToken)
+	got := []byte(r.Header.Get("Authorization"))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// JobRequest describes the job to start.
+type JobRequest struct {
+	Type string `json:"type"`
+	// Users the job is applied to. If empty, all active users, or all
+	// deactivated users for restore_configs, whose IDs start with
+	// UserIDPrefix and whose labels match Selector, like plan=free.
+	Users        []string `json:"users,omitempty"`
+	UserIDPrefix string   `json:"userIDPrefix,omitempty"`
+	Selector     string   `json:"selector,omitempty"`
+	// DryRun returns the users the job would be applied to, without
+	// starting it.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// TemplateFiles are merged into the template files of every user by
+	// update_templates jobs.
+	TemplateFiles map[string]string `json:"templateFiles,omitempty"`
+	// Silence is created for every user by create_silences jobs.
+	Silence *JobSilence `json:"silence,omitempty"`
+	// Retention replaces the retention overrides of every user in
+	// set_retention jobs, moving them to the retention of a plan. Empty
+	// overrides reset the users to the retention of the replicas.
+	Retention *RetentionOverrides `json:"retention,omitempty"`
+	// Features are merged into the feature overrides of every user by
+	// set_features jobs.
+	Features map[string]bool `json:"features,omitempty"`
+}
+
+// JobPlan lists the users a job would be applied to, returned for dry runs.
+type JobPlan struct {
+	Type  string   `json:"type"`
+	Total int      `json:"total"`
+	Users []string `json:"users"`
+}
+
+type JobSilence struct {
+	Matchers  []JobSilenceMatcher `json:"matchers"`
+	StartsAt  time.Time           `json:"startsAt"`
+	EndsAt    time.Time           `json:"endsAt"`
+	CreatedBy string              `json:"createdBy"`
+	Comment   string              `json:"comment"`
+}
+
+type JobSilenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+}
+
+func (a *AdminAPI) createJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fn, err := a.jobFunc(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DryRun {
+		users, err := fn.items(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, JobPlan{Type: req.Type, Total: len(users), Users: append([]string{}, users...)})
+		return
+	}
+	job, err := a.jobs.submit(r.Context(), &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "job created", "job", job.ID, "type", job.Type))
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (a *AdminAPI) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := a.jobs.list(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (a *AdminAPI) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.jobs.get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (a *AdminAPI) cancelJob(w http.ResponseWriter, r *http.Request) {
+	ok, err := a.jobs.cancel(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *AdminAPI) jobFunc(req *JobRequest) (jobFunc, error) {
+	selector, err := ParseTenantSelector(req.Selector)
+	if err != nil {
+		return jobFunc{}, err
+	}
+	items := func(ctx context.Context) ([]string, error) {
+		if len(req.Users) > 0 {
+			return req.Users, nil
+		}
+		return a.selectUsers(ctx, req.UserIDPrefix, selector, req.Type == JobRestoreConfigs)
+	}
+
+	switch req.Type {
+	case JobValidateConfigs:
+		return jobFunc{items: items, apply: a.validateConfig}, nil
+	case JobUpdateTemplates:
+		if len(req.TemplateFiles) == 0 {
+			return jobFunc{}, errors.New("templateFiles must be non empty")
+		}
+		if err := validateTemplateFiles(req.TemplateFiles); err != nil {
+			return jobFunc{}, errors.Wrap(err, "invalid templates")
+		}
+		return jobFunc{items: items, apply: func(ctx context.Context, userID string) error {
+			return a.updateTemplates(ctx, userID, req.TemplateFiles)
+		}}, nil
+	case JobCreateSilences:
+		sil, err := req.Silence.toProto()
+		if err != nil {
+			return jobFunc{}, err
+		}
+		return jobFunc{items: items, apply: func(ctx context.Context, userID string) error {
+			s := *sil
+			_, err := a.am.CreateSilence(userID, &s)
+			return err
+		}}, nil
+	case JobDeactivateConfigs, JobRestoreConfigs, JobSetRetention, JobSetFeatures:
+		if req.Type == JobSetRetention {
+			if req.Retention == nil {
+				return jobFunc{}, errors.New("retention must be set")
+			}
+			if err := req.Retention.validate(); err != nil {
+				return jobFunc{}, err
+			}
+		}
+		if req.Type == JobSetFeatures {
+			if len(req.Features) == 0 {
+				return jobFunc{}, errors.New("features must be non empty")
+			}
+			if err := validateFeatures(featureNames(req.Features)); err != nil {
+				return jobFunc{}, err
+			}
+		}
+		update := bulkUpdate(req)
+		return jobFunc{items: items, apply: func(ctx context.Context, userID string) error {
+			return a.client.UpdateConfig(ctx, userID, update)
+		}}, nil
+	}
+	return jobFunc{}, errors.Errorf("unknown job type %q", req.Type)
+}
+
+// selectUsers returns the users with a config whose IDs start with prefix
+// and whose labels match selector, the active ones, or the deactivated ones
+// if deactivated is set.
+func (a *AdminAPI) selectUsers(ctx context.Context, prefix string, selector TenantSelector, deactivated bool) ([]string, error) {
+	var users []string
+	opts := ListConfigsOptions{Limit: jobUsersPageSize, UserIDPrefix: prefix}
+	for {
+		cfgs, next, err := a.client.ListConfigs(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range cfgs {
+			if cfg.DeletedAtInUnix > 0 || (cfg.DeactivatedAtInUnix > 0) != deactivated || !selector.Matches(cfg.Labels) {
+				continue
+			}
+			users = append(users, cfg.UserID)
+		}
+		if next == "" {
+			return users, nil
+		}
+		opts.Continue = next
+	}
+}
+
+// bulkUpdate returns the change of the config of a user made by a
+// deactivate_configs, restore_configs, set_retention or set_features job.
+// Users whose configs are already as requested are skipped.
+func bulkUpdate(req *JobRequest) func(cfg *AlertmanagerConfig) error {
+	return func(cfg *AlertmanagerConfig) error {
+		if cfg.UserID == "" || cfg.DeletedAtInUnix > 0 {
+			return errConfigNotFound
+		}
+		now := time.Now().Unix()
+		switch req.Type {
+		case JobDeactivateConfigs:
+			if cfg.DeactivatedAtInUnix > 0 {
+				return errSkipItem
+			}
+			cfg.DeactivatedAtInUnix = now
+		case JobRestoreConfigs:
+			if cfg.DeactivatedAtInUnix == 0 {
+				return errSkipItem
+			}
+			cfg.DeactivatedAtInUnix = 0
+		case JobSetRetention:
+			var o *RetentionOverrides
+			if !req.Retention.empty() {
+				r := *req.Retention
+				o = &r
+			}
+			if reflect.DeepEqual(cfg.Retention, o) {
+				return errSkipItem
+			}
+			cfg.Retention = o
+		case JobSetFeatures:
+			changed := false
+			for f, enabled := range req.Features {
+				if e, ok := cfg.Features[f]; ok && e == enabled {
+					continue
+				}
+				if cfg.Features == nil {
+					cfg.Features = map[string]bool{}
+				}
+				cfg.Features[f] = enabled
+				changed = true
+			}
+			if !changed {
+				return errSkipItem
+			}
+		}
+		cfg.UpdatedAtInUnix = now
+		return nil
+	}
+}
+
+func (a *AdminAPI) validateConfig(ctx context.Context, userID string) error {
+	cfg, err := a.client.GetConfig(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := validateAlertmanagerConfig(cfg.Config); err != nil {
+		return errors.Wrap(err, "invalid Alertmanager config")
+	}
+	if err := a.am.CheckRoutingPolicies(cfg.Config); err != nil {
+		return err
+	}
+	if err := validateTemplateFiles(cfg.TemplateFiles); err != nil {
+		return errors.Wrap(err, "invalid templates")
+	}
+	return nil
+}
+
+// updateTemplates merges files into the template files of a user. The
+// config is updated atomically, so that concurrent changes of the user are
+// not overwritten.
+func (a *AdminAPI) updateTemplates(ctx context.Context, userID string, files map[string]string) error {
+	return a.client.UpdateConfig(ctx, userID, func(cfg *AlertmanagerConfig) error {
+		if cfg.UserID == "" {
+			return errors.New("config not found")
+		}
+
+		changed := false
+		if cfg.TemplateFiles == nil {
+			cfg.TemplateFiles = map[string]string{}
+		}
+		for fn, content := range files {
+			if cfg.TemplateFiles[fn] != content {
+				cfg.TemplateFiles[fn] = content
+				changed = true
+			}
+		}
+		if !changed {
+			return errSkipItem
+		}
+		cfg.UpdatedAtInUnix = time.Now().Unix()
+		return nil
+	})
+}
+
+func (s *JobSilence) toProto() (*silencepb.Silence, error) {
+	if s == nil {
+		return nil, errors.New("silence must be provided")
+	}
+	if len(s.Matchers) == 0 {
+		return nil, errors.New("silence must have at least one matcher")
+	}
+	if s.EndsAt.IsZero() || (!s.StartsAt.IsZero() && !s.EndsAt.After(s.StartsAt)) {
+		return nil, errors.New("silence endsAt must be after startsAt")
+	}
+
+	sil := &silencepb.Silence{
+		StartsAt:  s.StartsAt,
+		EndsAt:    s.EndsAt,
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+	}
+	if sil.StartsAt.IsZero() {
+		sil.StartsAt = time.Now()
+	}
+	for _, m := range s.Matchers {
+		typ := silencepb.Matcher_EQUAL
+		if m.IsRegex {
+			typ = silencepb.Matcher_REGEXP
+		}
+		sil.Matchers = append(sil.Matchers, &silencepb.Matcher{
+			Type:    typ,
+			Name:    m.Name,
+			Pattern: m.Value,
+		})
+	}
+	return sil, nil
+}
+
+// CreateSilence creates a silence in the alertmanager of the user. The
+// silence of a parked Alertmanager is added to its stored state, rather
+// than rebuilding it.
+func (am *MultitenantAlertmanager) CreateSilence(userID string, sil *silencepb.Silence) (string, error) {
+	mtx := am.userLock(userID)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	parked := am.parked[userID]
+	am.alertmanagersMtx.Unlock()
+	if ok {
+		return userAM.silences.Set(sil)
+	}
+	if !parked {
+		return "", errors.Wrapf(errNoAlertmanager, "user %s", userID)
+	}
+	id, err := am.setParkedSilence(userID, sil)
+	if err != nil {
+		return "", errors.Wrapf(err, "user %s", userID)
+	}
+	return id, nil
+}
+
+// setParkedSilence adds a silence to the snapshot of a parked Alertmanager,
+// which is loaded when it is rebuilt, and to the snapshot in object storage.
+// Must be called with the lock of the user held.
+func (am *MultitenantAlertmanager) setParkedSilence(userID string, sil *silencepb.Silence) (string, error) {
+	fn := silencesSnapshotFile(am.cfg.DataDir, userID)
+	opts := silence.Options{Retention: am.userRetention(userID).Silences}
+	f, err := os.Open(fn)
+	if err == nil {
+		defer f.Close()
+		opts.SnapshotReader = f
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "failed to open silences snapshot")
+	}
+	silences, err := silence.New(opts)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to load silences snapshot")
+	}
+	id, err := silences.Set(sil)
+	if err != nil {
+		return "", err
+	}
+
+	tmp := fn + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to write silences snapshot")
+	}
+	defer os.Remove(tmp)
+	if _, err := silences.Snapshot(out); err != nil {
+		_ = out.Close()
+		return "", errors.Wrap(err, "failed to write silences snapshot")
+	}
+	if err := out.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to write silences snapshot")
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return "", errors.Wrap(err, "failed to write silences snapshot")
+	}
+
+	if am.stateBucket != nil {
+		p := &statePersister{bucket: am.stateBucket, userID: userID}
+		if err := p.upload(silencesStateKey, silences.Snapshot); err != nil {
+			return "", errors.Wrap(err, "failed to persist silences")
+		}
+	}
+	return id, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error encoding response", "err", err))
+	}
+}
+
+// LogLevel is the least severe level logged by a replica.
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// getLogLevel returns the log level of this replica.
+func (a *AdminAPI) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LogLevel{Level: logger2.Level()})
+}
+
+// setLogLevel changes the log level of this replica until it is restarted.
+// The other replicas are not changed.
+func (a *AdminAPI) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var l LogLevel
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prev := logger2.Level()
+	if err := logger2.SetLevel(l.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "log level changed", "from", prev, "to", l.Level))
+	writeJSON(w, http.StatusOK, l)
+}
+
+// resync loads and applies all configs again on this replica, see
+// MultitenantAlertmanager.Resync. The response is sent once done.
+func (a *AdminAPI) resync(w http.ResponseWriter, r *http.Request) {
+	if err := a.am.Resync(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
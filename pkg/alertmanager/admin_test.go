@@ -0,0 +1,108 @@
+package alertmanager
+
+import (
+	"reflect"
+	"testing"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+func TestBulkUpdate(t *testing.T) {
+	plan := &RetentionOverrides{Silences: "2160h"}
+	for _, tc := range []struct {
+		name string
+		req  *JobRequest
+		cfg  AlertmanagerConfig
+		err  error
+		want AlertmanagerConfig
+	}{
+		{
+			name: "deactivate",
+			req:  &JobRequest{Type: JobDeactivateConfigs},
+			cfg:  AlertmanagerConfig{UserID: "user"},
+			want: AlertmanagerConfig{UserID: "user", DeactivatedAtInUnix: 1},
+		},
+		{
+			name: "deactivate deactivated",
+			req:  &JobRequest{Type: JobDeactivateConfigs},
+			cfg:  AlertmanagerConfig{UserID: "user", DeactivatedAtInUnix: 1},
+			err:  errSkipItem,
+		},
+		{
+			name: "restore",
+			req:  &JobRequest{Type: JobRestoreConfigs},
+			cfg:  AlertmanagerConfig{UserID: "user", DeactivatedAtInUnix: 1},
+			want: AlertmanagerConfig{UserID: "user"},
+		},
+		{
+			name: "restore active",
+			req:  &JobRequest{Type: JobRestoreConfigs},
+			cfg:  AlertmanagerConfig{UserID: "user"},
+			err:  errSkipItem,
+		},
+		{
+			name: "set retention",
+			req:  &JobRequest{Type: JobSetRetention, Retention: plan},
+			cfg:  AlertmanagerConfig{UserID: "user"},
+			want: AlertmanagerConfig{UserID: "user", Retention: plan},
+		},
+		{
+			name: "set same retention",
+			req:  &JobRequest{Type: JobSetRetention, Retention: plan},
+			cfg:  AlertmanagerConfig{UserID: "user", Retention: &RetentionOverrides{Silences: "2160h"}},
+			err:  errSkipItem,
+		},
+		{
+			name: "reset retention",
+			req:  &JobRequest{Type: JobSetRetention, Retention: &RetentionOverrides{}},
+			cfg:  AlertmanagerConfig{UserID: "user", Retention: plan},
+			want: AlertmanagerConfig{UserID: "user"},
+		},
+		{
+			name: "set features",
+			req:  &JobRequest{Type: JobSetFeatures, Features: map[string]bool{notify.FeatureEscalations: true}},
+			cfg:  AlertmanagerConfig{UserID: "user", Features: map[string]bool{notify.FeatureSlackBlockKit: false}},
+			want: AlertmanagerConfig{UserID: "user", Features: map[string]bool{notify.FeatureSlackBlockKit: false, notify.FeatureEscalations: true}},
+		},
+		{
+			name: "set same features",
+			req:  &JobRequest{Type: JobSetFeatures, Features: map[string]bool{notify.FeatureEscalations: false}},
+			cfg:  AlertmanagerConfig{UserID: "user", Features: map[string]bool{notify.FeatureEscalations: false}},
+			err:  errSkipItem,
+		},
+		{
+			name: "missing config",
+			req:  &JobRequest{Type: JobDeactivateConfigs},
+			err:  errConfigNotFound,
+		},
+		{
+			name: "deleted config",
+			req:  &JobRequest{Type: JobRestoreConfigs},
+			cfg:  AlertmanagerConfig{UserID: "user", DeactivatedAtInUnix: 1, DeletedAtInUnix: 1},
+			err:  errConfigNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			err := bulkUpdate(tc.req)(&cfg)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.UpdatedAtInUnix == 0 {
+				t.Fatal("updated at was not set")
+			}
+			if (cfg.DeactivatedAtInUnix > 0) != (tc.want.DeactivatedAtInUnix > 0) {
+				t.Fatalf("expected deactivated at %d, got %d", tc.want.DeactivatedAtInUnix, cfg.DeactivatedAtInUnix)
+			}
+			if (cfg.Retention == nil) != (tc.want.Retention == nil) || cfg.Retention != nil && *cfg.Retention != *tc.want.Retention {
+				t.Fatalf("expected retention %+v, got %+v", tc.want.Retention, cfg.Retention)
+			}
+			if !reflect.DeepEqual(cfg.Features, tc.want.Features) {
+				t.Fatalf("expected features %v, got %v", tc.want.Features, cfg.Features)
+			}
+		})
+	}
+}
@@ -11,18 +11,19 @@ import (
 	"sync"
 	"time"
 
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	apiv1 "github.com/prometheus/alertmanager/api/v1"
 	apiv2 "github.com/prometheus/alertmanager/api/v2"
 	"github.com/prometheus/alertmanager/cluster"
 	"github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/alertmanager/dispatch"
-	"github.com/prometheus/alertmanager/inhibit"
 	"github.com/prometheus/alertmanager/nflog"
-	"github.com/prometheus/alertmanager/notify"
 	"github.com/prometheus/alertmanager/provider/mem"
 	"github.com/prometheus/alertmanager/silence"
-	"github.com/prometheus/alertmanager/template"
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/alertmanager/ui"
 	"github.com/prometheus/client_golang/prometheus"
@@ -42,24 +43,98 @@ type Config struct {
 	ExternalURL *url.URL
 	Peer        *cluster.Peer
 	PeerTimeout time.Duration
+	// PeerWait returns how long to wait for the notifications of the peers
+	// before sending them, if Peer is set. Defaults to a PeerTimeout for
+	// each peer before this one.
+	PeerWait func() time.Duration
+	// PeerStates gossips the state of the Alertmanager, if Peer is set.
+	PeerStates *peerStates
+
+	// Used to persist notification logs and silences in object storage.
+	// Persistence is disabled if nil.
+	StateBucket          objstore.Bucket
+	StatePersistInterval time.Duration
+
+	// NotificationLogRetention overrides the Retention of the notification
+	// log if not 0.
+	NotificationLogRetention time.Duration
+	// AlertGCInterval is how often resolved alerts are removed, every 30m
+	// if 0.
+	AlertGCInterval time.Duration
+
+	// GlobalInhibitRules returns the inhibition rules applied in addition
+	// to the rules of the user's config. Can be nil.
+	GlobalInhibitRules func() []*config.InhibitRule
+	// LibraryDir returns the directory holding the templates shared by all
+	// users, which are loaded before the user's templates. Can be nil.
+	LibraryDir func() string
+	// IsLeader returns true if the Alertmanager sends notifications. They
+	// are always sent if nil.
+	IsLeader func() bool
+	// Archive is called with the resolved alert groups once notified. Can
+	// be nil.
+	Archive func(*ArchivedGroup)
+	// SyntheticProbes routes the synthetic probe alerts to a loopback
+	// receiver, see Alertmanager.probe.
+	SyntheticProbes bool
+
+	// Limits bound the alerts held in memory.
+	Limits DispatchLimits
+	// Features tells whether a feature flag is enabled for the user. All
+	// are if nil.
+	Features func(feature string) bool
+}
+
+func (c *Config) notificationLogRetention() time.Duration {
+	if c.NotificationLogRetention > 0 {
+		return c.NotificationLogRetention
+	}
+	return c.Retention
+}
+
+// retention returns the retention the Alertmanager was created with.
+func (c *Config) retention() Retention {
+	r := Retention{
+		Silences:        c.Retention,
+		NotificationLog: c.notificationLogRetention(),
+		AlertGCInterval: c.AlertGCInterval,
+	}
+	if r.AlertGCInterval == 0 {
+		r.AlertGCInterval = 30 * time.Minute
+	}
+	return r
 }
 
 // An Alertmanager manages the alerts for one user.
 type Alertmanager struct {
+	// lastActive is the time in unix nanoseconds the Alertmanager was last
+	// used. It is accessed atomically and comes first for alignment.
+	lastActive int64
+	// inflight is the number of notifications being sent, accessed
+	// atomically.
+	inflight int64
+
 	cfg        *Config
 	apiV1      *apiv1.API
 	apiV2      *apiv2.API
 	logger     log.Logger
 	nflog      *nflog.Log
 	silences   *silence.Silences
-	silencer   *silence.Silencer
 	marker     types.Marker
 	alerts     *mem.Alerts
-	dispatcher *dispatch.Dispatcher
-	inhibitor  *inhibit.Inhibitor
+	events     *notificationEvents
+	heartbeats *heartbeatMonitor
+	recurring  *recurringSilencer
+	probes     *probeDeliveries
 	stop       chan struct{}
 	wg         sync.WaitGroup
 	mux        *http.ServeMux
+
+	// The pipeline of the applied config, nil until a config is applied.
+	pipelineMtx sync.RWMutex
+	pipeline    *pipeline
+	// canary runs a candidate config in shadow, see runCanary.
+	canary *canary
 }
 
 // New creates a new Alertmanager.
@@ -67,14 +142,34 @@ func NewAlertmanager(cfg *Config) (*Alertmanager, error) {
 	am := &Alertmanager{
 		cfg:    cfg,
 		logger: log.With(cfg.Logger, "user", cfg.UserID),
+		events: newNotificationEvents(),
+		probes: newProbeDeliveries(),
 		stop:   make(chan struct{}),
 	}
 
+	nflogFile := nflogSnapshotFile(cfg.DataDir, cfg.UserID)
+	silencesFile := silencesSnapshotFile(cfg.DataDir, cfg.UserID)
+	// The state which can not be restored now is restored in the
+	// background, rather than failing the creation of the Alertmanager while
+	// object storage is unavailable.
+	pendingState := map[string]bool{}
+	if cfg.StateBucket != nil {
+		for key, file := range map[string]string{
+			nflogStateKey:    nflogFile,
+			silencesStateKey: silencesFile,
+		} {
+			if err := restoreState(cfg.StateBucket, cfg.UserID, key, file); err != nil {
+				stateRestoreFailures.WithLabelValues(key).Inc()
+				Must(level.Warn(am.logger).Log("msg", "failed to restore state, starting with empty state", "state", key, "err", err))
+				pendingState[key] = true
+			}
+		}
+	}
+
 	am.wg.Add(1)
-	nflogID := fmt.Sprintf("nflog:%s", cfg.UserID)
 	nflogOpts := []nflog.Option{
-		nflog.WithRetention(cfg.Retention),
-		nflog.WithSnapshot(filepath.Join(cfg.DataDir, nflogID)),
+		nflog.WithRetention(cfg.notificationLogRetention()),
+		nflog.WithSnapshot(nflogFile),
 		nflog.WithMaintenance(notificationLogMaintenancePeriod, am.stop, am.wg.Done),
 		// TODO: Build a registry that can merge metrics from multiple users.
 		// For now, these metrics are ignored, as we can't register the same
@@ -87,9 +182,8 @@ func NewAlertmanager(cfg *Config) (*Alertmanager, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create notification log: %v", err)
 	}
-	if am.cfg.Peer != nil {
-		c := am.cfg.Peer.AddState(fmt.Sprintf("nfl_%s", am.cfg.UserID), am.nflog, prometheus.DefaultRegisterer)
-		am.nflog.SetBroadcast(c.Broadcast)
+	if am.cfg.PeerStates != nil {
+		am.nflog.SetBroadcast(am.cfg.PeerStates.add(nflogChannelKey(am.cfg.UserID), am.nflog))
 	}
 
 	// TODO: Build a registry that can merge metrics from multiple users.
@@ -97,9 +191,8 @@ func NewAlertmanager(cfg *Config) (*Alertmanager, error) {
 	// metric twice with a single registry.
 	am.marker = types.NewMarker(prometheus.NewRegistry())
 
-	silencesID := fmt.Sprintf("silences:%s", cfg.UserID)
 	silencesOpts := silence.Options{
-		SnapshotFile: filepath.Join(cfg.DataDir, silencesID),
+		SnapshotFile: silencesFile,
 		Retention:    cfg.Retention,
 		Logger:       log.With(am.logger, "component", "silences"),
 		// TODO: Build a registry that can merge metrics from multiple users.
@@ -112,24 +205,59 @@ func NewAlertmanager(cfg *Config) (*Alertmanager, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create silences: %v", err)
 	}
-	if am.cfg.Peer != nil {
-		c := am.cfg.Peer.AddState(fmt.Sprintf("sil_%s", am.cfg.UserID), am.silences, prometheus.DefaultRegisterer)
-		am.silences.SetBroadcast(c.Broadcast)
+	if am.cfg.PeerStates != nil {
+		am.silences.SetBroadcast(am.cfg.PeerStates.add(silencesChannelKey(am.cfg.UserID), am.silences))
 	}
 
 	am.wg.Add(1)
 	go func() {
-		am.silences.Maintenance(15*time.Minute, filepath.Join(cfg.DataDir, silencesID), am.stop)
+		am.silences.Maintenance(15*time.Minute, silencesFile, am.stop)
+		am.wg.Done()
+	}()
+
+	if cfg.StateBucket != nil {
+		persister := &statePersister{
+			bucket:   cfg.StateBucket,
+			userID:   cfg.UserID,
+			silences: am.silences,
+			nflog:    am.nflog,
+			logger:   log.With(am.logger, "component", "state"),
+			pending:  pendingState,
+		}
+		am.wg.Add(1)
+		go func() {
+			persister.Run(cfg.StatePersistInterval, am.stop)
+			am.wg.Done()
+		}()
+	}
+
+	am.heartbeats = newHeartbeatMonitor(am)
+	am.wg.Add(1)
+	go func() {
+		am.heartbeats.run(am.stop)
+		am.wg.Done()
+	}()
+
+	am.recurring = newRecurringSilencer(am)
+	am.wg.Add(1)
+	go func() {
+		am.recurring.run(am.stop)
 		am.wg.Done()
 	}()
 
-	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, 30*time.Minute, am.logger)
+	gcInterval := cfg.AlertGCInterval
+	if gcInterval == 0 {
+		gcInterval = 30 * time.Minute
+	}
+	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, gcInterval, am.logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create alerts: %v", err)
 	}
 
+	// The APIs put the alerts through the alert preprocessing of the user.
+	apiAlerts := &preprocessedAlerts{Alerts: am.alerts, am: am}
 	am.apiV1 = apiv1.New(
-		am.alerts,
+		apiAlerts,
 		am.silences,
 		am.marker.Status,
 		// TODO: look at this
@@ -142,11 +270,15 @@ func NewAlertmanager(cfg *Config) (*Alertmanager, error) {
 	)
 
 	groupFn := func(routeFilter func(*dispatch.Route) bool, alertFilter func(*types.Alert, time.Time) bool) (dispatch.AlertGroups, map[model.Fingerprint][]string) {
-		return am.dispatcher.Groups(routeFilter, alertFilter)
+		p := am.getPipeline()
+		if p == nil {
+			return dispatch.AlertGroups{}, map[model.Fingerprint][]string{}
+		}
+		return p.dispatcher.Groups(routeFilter, alertFilter)
 	}
 
 	am.apiV2, err = apiv2.NewAPI(
-		am.alerts,
+		apiAlerts,
 		groupFn,
 		am.marker.Status,
 		am.silences,
@@ -185,81 +317,100 @@ func NewAlertmanager(cfg *Config) (*Alertmanager, error) {
 		}
 	}()
 
+	am.touch()
 	return am, nil
 }
 
-// ApplyConfig applies a new configuration to an Alertmanager.
-func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config) error {
-	var (
-		tmpl     *template.Template
-		pipeline notify.Stage
-	)
+// nflogChannelKey returns the key of the gossip channel replicating the
+// notification log of a user. It must be the same on all replicas.
+func nflogChannelKey(userID string) string {
+	return fmt.Sprintf("nfl_%s", userID)
+}
+
+// silencesChannelKey returns the key of the gossip channel replicating the
+// silences of a user. It must be the same on all replicas.
+func silencesChannelKey(userID string) string {
+	return fmt.Sprintf("sil_%s", userID)
+}
+
+// channelRegisterer registers the metrics of gossip channels, which are
+// registered again when a process runs more than one peer.
+type channelRegisterer struct {
+	prometheus.Registerer
+}
 
-	templateFiles := make([]string, len(conf.Templates))
-	for i, t := range conf.Templates {
-		templateFiles[i] = filepath.Join(am.cfg.DataDir, "templates", userID, t)
+func (r channelRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				panic(err)
+			}
+		}
 	}
+}
 
-	tmpl, err := template.FromGlobs(templateFiles...)
+// ApplyConfig applies a new configuration to an Alertmanager. The links of
+// notifications point to externalURL, or to the URL the Alertmanager is
+// served at if it is nil.
+// The config is not applied if ctx is done before the running pipeline is
+// replaced. If applying fails, the running pipeline is kept.
+func (am *Alertmanager) ApplyConfig(ctx context.Context, userID string, conf *notify.Config, externalURL *url.URL) error {
+	p, err := newPipeline(am, userID, conf, externalURL, nil)
 	if err != nil {
 		return err
 	}
-	tmpl.ExternalURL = am.cfg.ExternalURL
-
-	am.inhibitor.Stop()
-	am.dispatcher.Stop()
-
-	am.inhibitor = inhibit.NewInhibitor(am.alerts, conf.InhibitRules, am.marker, log.With(am.logger, "component", "inhibitor"))
-	am.silencer = silence.NewSilencer(am.silences, am.marker, log.With(am.logger, "component", "silencer"))
-
-	waitFunc := func() time.Duration { return 0 }
-	if am.cfg.Peer != nil {
-		waitFunc = clusterWait(am.cfg.Peer, am.cfg.PeerTimeout)
-	}
-	timeoutFunc := func(d time.Duration) time.Duration {
-		if d < notify.MinTimeout {
-			d = notify.MinTimeout
-		}
-		return d + waitFunc()
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	pipeline = notify.BuildPipeline(
-		conf.Receivers,
-		tmpl,
-		waitFunc,
-		am.inhibitor,
-		am.silencer,
-		am.nflog,
-		am.cfg.Peer,
-		log.With(am.logger, "component", "pipeline"),
-	)
+	am.pipelineMtx.Lock()
+	defer am.pipelineMtx.Unlock()
+	am.pipeline.stop()
 
 	// Update configuration
-	am.apiV1.Update(conf)
-	am.apiV2.Update(conf, func(labels model.LabelSet) {
-		am.inhibitor.Mutes(labels)
-		am.silencer.Mutes(labels)
+	am.apiV1.Update(conf.Config)
+	am.apiV2.Update(conf.Config, func(labels model.LabelSet) {
+		p.inhibitor.Mutes(labels)
+		p.silencer.Mutes(labels)
 	})
 
-	am.dispatcher = dispatch.NewDispatcher(
-		am.alerts,
-		dispatch.NewRoute(conf.Route, nil),
-		pipeline,
-		am.marker,
-		timeoutFunc,
-		log.With(am.logger, "component", "dispatcher"),
-	)
+	am.pipeline = p
+	p.start()
+	return nil
+}
 
-	go am.dispatcher.Run()
-	go am.inhibitor.Run()
+// reloadPipeline rebuilds the pipeline of the applied config, so that it
+// picks up changed global inhibition rules and library templates.
+func (am *Alertmanager) reloadPipeline(ctx context.Context, userID string) error {
+	p := am.getPipeline()
+	if p == nil {
+		return nil
+	}
+	return am.ApplyConfig(ctx, userID, p.conf, p.externalURL)
+}
 
-	return nil
+// getPipeline returns the pipeline of the applied config, or nil.
+func (am *Alertmanager) getPipeline() *pipeline {
+	am.pipelineMtx.RLock()
+	defer am.pipelineMtx.RUnlock()
+	return am.pipeline
+}
+
+// defaultTemplatesFile returns the path of the file holding the default
+// templates of the extended integrations.
+func defaultTemplatesFile(dataDir string) string {
+	return filepath.Join(dataDir, "templates", "default.tmpl")
 }
 
 // Stop stops the Alertmanager.
 func (am *Alertmanager) Stop() {
-	am.dispatcher.Stop()
-	am.inhibitor.Stop()
+	am.pipelineMtx.Lock()
+	am.pipeline.stop()
+	am.pipeline = nil
+	am.canary.stop()
+	am.canary = nil
+	am.pipelineMtx.Unlock()
+
 	am.alerts.Close()
 	close(am.stop)
 	am.wg.Wait()
@@ -4,25 +4,53 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
 
+	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/gorilla/mux"
-	amconfig "github.com/prometheus/alertmanager/config"
+	"github.com/pkg/errors"
 )
 
+// TemplateQuota checks whether the template files of a user fit in the data
+// directory limit of the user.
+type TemplateQuota interface {
+	CheckTemplateQuota(userID string, templateFiles map[string]string) error
+}
+
 // API implements the configs api.
 type API struct {
-	client AlertmanagerClient
+	client       AlertmanagerClient
+	timingBounds *TimingBounds
+	redaction    *RedactionConfig
+	quota        TemplateQuota
+	retention    RetentionLimits
+	policies     RoutingPolicyChecker
+	// readOnly rejects config changes, on standby deployments which get
+	// their configs replicated from the primary.
+	readOnly bool
+	// requireRevision rejects replacing a stored config without its
+	// revision.
+	requireRevision bool
 	http.Handler
 }
 
 // New creates a new API
-func NewAPI(c AlertmanagerClient) *API {
-	a := &API{client: c}
+func NewAPI(c AlertmanagerClient, timingBounds *TimingBounds, redaction *RedactionConfig, quota TemplateQuota, retention RetentionLimits, policies RoutingPolicyChecker, readOnly, requireRevision bool) *API {
+	a := &API{client: c, timingBounds: timingBounds, redaction: redaction, quota: quota, retention: retention, policies: policies, readOnly: readOnly, requireRevision: requireRevision}
 	r := mux.NewRouter()
 	a.RegisterRoutes(r)
 	a.Handler = r
@@ -36,75 +64,277 @@ func (a *API) RegisterRoutes(r *mux.Router) {
 		handler            http.HandlerFunc
 	}{
 		{"get_config", "GET", "/api/v1/config", a.getConfig},
-		{"set_config", "POST", "/api/v1/config", a.setConfig},
-		{"deactivate_config", "DELETE", "/api/v1/config/deactivate", a.deactivateConfig},
-		{"restore_config", "POST", "/api/v1/config/restore", a.restoreConfig},
+		{"set_config", "POST", "/api/v1/config", a.write(a.setConfig)},
+		{"put_config", "PUT", "/api/v1/config", a.write(a.setConfig)},
+		{"get_canary", "GET", "/api/v1/config/canary", a.getCanary},
+		{"set_canary", "PUT", "/api/v1/config/canary", a.write(a.setCanary)},
+		{"delete_canary", "DELETE", "/api/v1/config/canary", a.write(a.deleteCanary)},
+		{"deactivate_config", "DELETE", "/api/v1/config/deactivate", a.write(a.deactivateConfig)},
+		{"restore_config", "POST", "/api/v1/config/restore", a.write(a.restoreConfig)},
+		{"route_test", "POST", "/api/v1/config/route-test", a.routeTest},
+		{"lint_config", "GET", "/api/v1/config/lint", a.lintConfig},
+		{"diff_config", "POST", "/api/v1/config/diff", a.diffConfig},
+		{"export_config", "GET", "/api/v1/config/export", a.exportConfig},
+		{"get_config_status", "GET", "/api/v1/config/status", a.getConfigStatus},
+		{"set_timing", "PATCH", "/api/v1/config/timing", a.write(a.setTiming)},
+		{"get_retention", "GET", "/api/v1/config/retention", a.getRetention},
+		{"set_retention", "PUT", "/api/v1/config/retention", a.write(a.setRetention)},
+		{"list_maintenance_windows", "GET", "/api/v1/maintenance-windows", a.listMaintenanceWindows},
+		{"set_maintenance_window", "POST", "/api/v1/maintenance-windows", a.write(a.setMaintenanceWindow)},
+		{"delete_maintenance_window", "DELETE", "/api/v1/maintenance-windows/{name}", a.write(a.deleteMaintenanceWindow)},
+		{"list_recurring_silences", "GET", "/api/v1/recurring-silences", a.listRecurringSilences},
+		{"set_recurring_silence", "POST", "/api/v1/recurring-silences", a.write(a.setRecurringSilence)},
+		{"delete_recurring_silence", "DELETE", "/api/v1/recurring-silences/{name}", a.write(a.deleteRecurringSilence)},
+		{"get_openapi_spec", "GET", "/api/v1/openapi.json", a.getOpenAPISpec},
 	} {
 		r.Handle(route.path, route.handler).Methods(route.method).Name(route.name)
 	}
 }
 
-// getConfig returns the request configuration.
+// write rejects config changes if the API is read-only.
+func (a *API) write(next http.HandlerFunc) http.HandlerFunc {
+	if !a.readOnly {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusForbidden, "configs are read-only on the standby deployment")
+	}
+}
+
+// getConfig returns the request configuration. Its secrets are redacted
+// unless they are requested with ?reveal=true.
 func (a *API) getConfig(w http.ResponseWriter, r *http.Request) {
 	userID, err := ExtractUserIDFromHTTPRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 	logger := logger2.WithUserID(userID, logger2.Logger)
 
-	cfg, err := a.client.GetConfig(userID)
+	reveal := r.URL.Query().Get("reveal") == "true"
+	if reveal && a.redaction.Enabled && !hasScope(r, a.redaction.RevealScope) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("revealing secrets requires the %s scope", a.redaction.RevealScope))
+		return
+	}
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
 	if err != nil {
 		// XXX: Untested
 		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storageError(w, err)
 		return
 	}
+	// The ETag is the one of the stored config, whether its secrets are
+	// redacted or not.
+	if etag := configETag(&cfg); etag != "" {
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if a.redaction.Enabled && !reveal && cfg.Config != "" {
+		cfg.Config, err = redactConfig(cfg.Config)
+		if err != nil {
+			Must(level.Error(logger).Log("msg", "error redacting config", "err", err))
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	// The canary is returned by its own endpoint.
+	cfg.Canary = nil
+
+	if acceptsYAML(r) {
+		// Only the Alertmanager config is returned as YAML, a config with
+		// templates is returned with JSON only so that they are not missed.
+		if len(cfg.TemplateFiles) > 0 {
+			writeError(w, http.StatusNotAcceptable, "the config has template files, which are only returned with JSON")
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		if _, err := io.WriteString(w, cfg.Config); err != nil {
+			Must(level.Error(logger).Log("msg", "error writing config", "err", err))
+		}
+		return
+	}
+
+	applyStatus, err := a.client.GetApplyStatus(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting apply status", "err", err))
+		storageError(w, err)
+		return
+	}
+	resp := struct {
+		AlertmanagerConfig
+		ApplyStatus map[string]ApplyStatus `json:"applyStatus,omitempty"`
+	}{cfg, applyStatus}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(cfg); err != nil {
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		// XXX: Untested
 		Must(level.Error(logger).Log("msg", "error encoding config", "err", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
 
-func (a *API) setConfig(w http.ResponseWriter, r *http.Request) {
+// ConfigStatus tells whether the stored config of a user has been applied
+// by the replicas.
+type ConfigStatus struct {
+	UpdatedAtInUnix int64 `json:"updatedAtInUnix,omitempty"`
+	// Applied is true if all replicas which reported a status applied the
+	// stored config without error.
+	Applied  bool                   `json:"applied"`
+	Replicas map[string]ApplyStatus `json:"replicas"`
+}
+
+// getConfigStatus returns the outcome of applying the user's config on each
+// replica.
+func (a *API) getConfigStatus(w http.ResponseWriter, r *http.Request) {
 	userID, err := ExtractUserIDFromHTTPRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-
-	// logger with userID
 	logger := logger2.WithUserID(userID, logger2.Logger)
 
-	var cfg AlertmanagerConfig
-	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
-		// XXX: Untested
-		Must(level.Error(logger).Log("msg", "error decoding json body", "err", err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
 		return
 	}
+	if cfg.UserID == "" {
+		writeError(w, http.StatusNotFound, "config not found")
+		return
+	}
+	replicas, err := a.client.GetApplyStatus(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting apply status", "err", err))
+		storageError(w, err)
+		return
+	}
+
+	st := ConfigStatus{
+		UpdatedAtInUnix: cfg.UpdatedAtInUnix,
+		Applied:         len(replicas) > 0,
+		Replicas:        replicas,
+	}
+	if st.Replicas == nil {
+		st.Replicas = map[string]ApplyStatus{}
+	}
+	for _, rs := range replicas {
+		if rs.LastError != "" || rs.ConfigUpdatedAtInUnix != cfg.UpdatedAtInUnix {
+			st.Applied = false
+		}
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// checkConfig validates the config and the templates of cfg, and checks
+// them against the routing policies and the template quota. It writes the
+// error and returns false if they are rejected.
+func (a *API) checkConfig(w http.ResponseWriter, logger log.Logger, userID string, cfg *AlertmanagerConfig) bool {
 	if err := validateAlertmanagerConfig(cfg.Config); err != nil {
 		Must(level.Error(logger).Log("msg", "invalid Alertmanager config", "err", err))
-		http.Error(w, fmt.Sprintf("Invalid Alertmanager config: %v", err), http.StatusBadRequest)
-		return
+		configError(w, cfg.Config, err)
+		return false
+	}
+	if err := a.policies.CheckRoutingPolicies(cfg.Config); err != nil {
+		Must(level.Error(logger).Log("msg", "config violates routing policies", "err", err))
+		routingPolicyError(w, err)
+		return false
 	}
 
 	if err := validateTemplateFiles(cfg.TemplateFiles); err != nil {
 		Must(level.Error(logger).Log("msg", "invalid templates", "err", err))
-		http.Error(w, fmt.Sprintf("Invalid templates: %v", err), http.StatusBadRequest)
+		templateError(w, err)
+		return false
+	}
+	if err := a.quota.CheckTemplateQuota(userID, cfg.TemplateFiles); err != nil {
+		Must(level.Error(logger).Log("msg", "templates exceed data directory limit", "err", err))
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return false
+	}
+	return true
+}
+
+func (a *API) setConfig(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// logger with userID
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, configOnly, err := decodeAlertmanagerConfig(w, r)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The revision of YAML and form bodies is set as a parameter.
+	if s := r.URL.Query().Get("revision"); s != "" {
+		if cfg.Revision, err = strconv.ParseInt(s, 10, 64); err != nil || cfg.Revision < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid revision %q", s))
+			return
+		}
+	}
+	if !a.checkConfig(w, logger, userID, cfg) {
+		return
+	}
+	if err := validateExternalURL(cfg.ExternalURL); err != nil {
+		Must(level.Error(logger).Log("msg", "invalid external URL", "err", err))
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid external URL: %v", err))
 		return
 	}
 
 	cfg.UserID = userID
 	cfg.UpdatedAtInUnix = time.Now().Unix()
-	if err := a.client.SetConfig(&cfg); err != nil {
+	err = a.client.UpdateConfig(r.Context(), userID, func(stored *AlertmanagerConfig) error {
+		if err := checkConfigPreconditions(r, stored); err != nil {
+			return err
+		}
+		if err := checkConfigRevision(cfg.Revision, stored, a.requireRevision); err != nil {
+			return err
+		}
+		// A raw YAML config replaces the Alertmanager config only, the
+		// stored templates and external URL are kept.
+		if configOnly {
+			cfg.TemplateFiles, cfg.ExternalURL = stored.TemplateFiles, stored.ExternalURL
+		}
+		// The retention, the labels and the features are set by operators.
+		cfg.Retention, cfg.Labels, cfg.Features = stored.Retention, stored.Labels, stored.Features
+		// The canary keeps running next to the new config.
+		cfg.Canary = stored.Canary
+		// Setting the active config again changes nothing, so that
+		// repeated requests are idempotent.
+		if stored.UserID != "" && stored.DeactivatedAtInUnix == 0 && stored.DeletedAtInUnix == 0 && configChecksum(stored) == configChecksum(cfg) {
+			return errConfigUnchanged
+		}
+		*stored = *cfg
+		return nil
+	})
+	switch {
+	case errors.Cause(err) == errPreconditionFailed:
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	case errors.Cause(err) == errRevisionConflict:
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Cause(err) == errConfigUnchanged:
+	case err != nil:
 		// XXX: Untested
 		Must(level.Error(logger).Log("msg", "error storing config", "err", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storageError(w, err)
+		return
+	}
+	w.Header().Set("ETag", configETag(cfg))
+	// The config is stored regardless of its lint warnings.
+	if warnings := lintConfigString(cfg.Config); len(warnings) > 0 {
+		writeJSON(w, http.StatusOK, LintResult{Warnings: warnings})
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -113,15 +343,15 @@ func (a *API) setConfig(w http.ResponseWriter, r *http.Request) {
 func (a *API) deactivateConfig(w http.ResponseWriter, r *http.Request) {
 	userID, err := ExtractUserIDFromHTTPRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 	// logger with userID
 	logger := logger2.WithUserID(userID, logger2.Logger)
 
-	if err := a.client.DeactivateConfig(userID); err != nil {
+	if err := a.client.DeactivateConfig(r.Context(), userID); err != nil {
 		Must(level.Error(logger).Log("msg", "error deactivating config", "err", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storageError(w, err)
 		return
 	}
 	Must(level.Info(logger).Log("msg", "config deactivated", "userID", userID))
@@ -131,31 +361,152 @@ func (a *API) deactivateConfig(w http.ResponseWriter, r *http.Request) {
 func (a *API) restoreConfig(w http.ResponseWriter, r *http.Request) {
 	userID, err := ExtractUserIDFromHTTPRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	// logger with userID
 	logger := logger2.WithUserID(userID, logger2.Logger)
 
-	if err := a.client.RestoreConfig(userID); err != nil {
+	if err := a.client.RestoreConfig(r.Context(), userID); err != nil {
 		Must(level.Error(logger).Log("msg", "error restoring config", "err", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storageError(w, err)
 		return
 	}
 	Must(level.Info(logger).Log("msg", "config restored", "userID", userID))
 	w.WriteHeader(http.StatusOK)
 }
 
+// configFormPart is the multipart form part holding the Alertmanager config,
+// and externalURLFormPart the one holding the external URL. All other parts
+// are template files, stored by their file name.
+const (
+	configFormPart      = "config"
+	externalURLFormPart = "externalURL"
+
+	// maxConfigRequestSize bounds the body of the requests setting a
+	// config, with its templates.
+	maxConfigRequestSize = 10 << 20
+)
+
+func isYAMLMediaType(mt string) bool {
+	switch mt {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// acceptsYAML returns true if the request prefers a YAML response.
+func acceptsYAML(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if isYAMLMediaType(mt) {
+			return true
+		}
+		if mt == "application/json" {
+			return false
+		}
+	}
+	return false
+}
+
+// decodeAlertmanagerConfig decodes the body of a setConfig request, which is
+// either a JSON AlertmanagerConfig, a raw YAML Alertmanager config, or a
+// multipart form with the YAML config and template files. configOnly is true
+// for a raw YAML config, which has no templates and external URL. The body
+// is read up to maxConfigRequestSize.
+func decodeAlertmanagerConfig(w http.ResponseWriter, r *http.Request) (*AlertmanagerConfig, bool, error) {
+	var (
+		cfg        = &AlertmanagerConfig{}
+		configOnly bool
+	)
+	r.Body = http.MaxBytesReader(w, r.Body, maxConfigRequestSize)
+
+	mt, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mt = "application/json"
+	}
+	switch {
+	case isYAMLMediaType(mt):
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		cfg.Config = string(data)
+		configOnly = true
+	case mt == "multipart/form-data":
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			data, err := ioutil.ReadAll(p)
+			if err != nil {
+				return nil, false, err
+			}
+			switch name := p.FormName(); {
+			case name == configFormPart:
+				cfg.Config = string(data)
+			case name == externalURLFormPart:
+				cfg.ExternalURL = strings.TrimSpace(string(data))
+			case p.FileName() != "":
+				if cfg.TemplateFiles == nil {
+					cfg.TemplateFiles = map[string]string{}
+				}
+				cfg.TemplateFiles[path.Base(p.FileName())] = string(data)
+			default:
+				return nil, false, errors.Errorf("unexpected form part %q", name)
+			}
+		}
+		if cfg.Config == "" {
+			return nil, false, errors.Errorf("missing form part %q", configFormPart)
+		}
+	default:
+		if err := json.NewDecoder(r.Body).Decode(cfg); err != nil {
+			return nil, false, err
+		}
+	}
+	return cfg, configOnly, nil
+}
+
 func validateAlertmanagerConfig(cfg string) error {
 	// TODO: should check for templates files
-	_, err := amconfig.Load(cfg)
+	if hasRedactedSecrets(cfg) {
+		return errors.Errorf("config holds redacted secrets %s, they must be set", redactedSecret)
+	}
+	_, err := notify.LoadConfig(secrets.Mask(cfg))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// validateExternalURL checks that u is empty or an absolute http(s) URL.
+func validateExternalURL(u string) error {
+	if u == "" {
+		return nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errors.Errorf("unsupported scheme %q, must be http or https", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return errors.Errorf("missing host in %q", u)
+	}
+	return nil
+}
+
 func validateTemplateFiles(tplFiles map[string]string) error {
 	for fn, content := range tplFiles {
 		if _, err := template.New(fn).Parse(content); err != nil {
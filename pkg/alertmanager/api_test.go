@@ -0,0 +1,45 @@
+package alertmanager
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAlertmanagerConfigSize(t *testing.T) {
+	large := strings.Repeat("#", maxConfigRequestSize+1)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/alerts", strings.NewReader(large))
+	req.Header.Set("Content-Type", "application/yaml")
+	if _, _, err := decodeAlertmanagerConfig(httptest.NewRecorder(), req); err == nil {
+		t.Fatal("expected an error for a YAML body over the limit")
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("template", "large.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte(large)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/alerts", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if _, _, err := decodeAlertmanagerConfig(httptest.NewRecorder(), req); err == nil {
+		t.Fatal("expected an error for a form over the limit")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/alerts", strings.NewReader("route:\n  receiver: team\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	cfg, configOnly, err := decodeAlertmanagerConfig(httptest.NewRecorder(), req)
+	if err != nil || !configOnly || !strings.Contains(cfg.Config, "receiver: team") {
+		t.Fatalf("unexpected config %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,292 @@
+package alertmanager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Layout of backup archives. The configs of users are stored with their
+// template files, and their state snapshots next to them.
+const (
+	backupVersion                = 1
+	backupManifestFile           = "manifest.json"
+	backupInhibitRulesFile       = "global/inhibit_rules.yaml"
+	backupLibraryDir             = "global/templates/"
+	backupUsersDir               = "users/"
+	backupConfigFile             = "config.yaml"
+	backupStateDir               = "state/"
+	backupFileMode               = 0644
+	backupMaxEntrySize     int64 = 64 << 20
+)
+
+// BackupManifest describes the content of a backup archive.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Users     []string  `json:"users"`
+	// State is true if the archive holds the state snapshots of the users.
+	State bool `json:"state"`
+}
+
+// RestoreResult is the outcome of restoring a backup archive.
+type RestoreResult struct {
+	Manifest *BackupManifest `json:"manifest"`
+	Restored []string        `json:"restored"`
+	// Skipped are the users whose stored config was kept.
+	Skipped []string `json:"skipped"`
+	// States is the number of state snapshots restored.
+	States int `json:"states"`
+}
+
+// CreateBackup writes all configs, with their template files, the global
+// inhibition rules and the library templates to w as a gzipped tar archive. The state snapshots of the
+// users are included if bucket is not nil.
+func CreateBackup(ctx context.Context, c AlertmanagerClient, bucket objstore.Bucket, w io.Writer) (*BackupManifest, error) {
+	cfgs, err := c.GetAllConfigs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get configs")
+	}
+	inhibitRules, err := c.GetGlobalInhibitRules(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get global inhibit rules")
+	}
+	library, err := c.ListLibraryTemplates(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get library templates")
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    backupFileMode,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+
+	// The manifest comes first, so that restores can check the version
+	// before changing anything.
+	m := &BackupManifest{
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		Users:     []string{},
+		State:     bucket != nil,
+	}
+	for _, cfg := range cfgs {
+		if strings.Contains(cfg.UserID, "/") || cfg.UserID == "" {
+			return nil, errors.Errorf("invalid user id %q", cfg.UserID)
+		}
+		m.Users = append(m.Users, cfg.UserID)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := add(backupManifestFile, data); err != nil {
+		return nil, err
+	}
+
+	if inhibitRules != "" {
+		if err := add(backupInhibitRulesFile, []byte(inhibitRules)); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range library {
+		if err := add(backupLibraryDir+t.Name, []byte(t.Content)); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range cfgs {
+		data, err := yaml.Marshal(&cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal config of user %s", cfg.UserID)
+		}
+		dir := backupUsersDir + cfg.UserID + "/"
+		if err := add(dir+backupConfigFile, data); err != nil {
+			return nil, err
+		}
+		if bucket == nil {
+			continue
+		}
+		for _, key := range []string{silencesStateKey, nflogStateKey} {
+			data, err := getState(ctx, bucket, cfg.UserID, key)
+			if err == objstore.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get %s of user %s", key, cfg.UserID)
+			}
+			if err := add(dir+backupStateDir+key, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return m, gw.Close()
+}
+
+func getState(ctx context.Context, bucket objstore.Bucket, userID, key string) ([]byte, error) {
+	r, err := bucket.Get(ctx, path.Join(userID, key))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// RestoreBackup stores the configs, the global inhibition rules and the
+// library templates of the backup archive read from r. The library templates
+// are stored as new versions. Stored configs are only replaced if overwrite
+// is set. The state snapshots are uploaded to bucket if it is not nil, they
+// are only picked up by Alertmanagers which have no local state yet.
+func RestoreBackup(ctx context.Context, c AlertmanagerClient, bucket objstore.Bucket, r io.Reader, overwrite bool) (*RestoreResult, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid backup archive")
+	}
+	defer gr.Close()
+
+	res := &RestoreResult{Restored: []string{}, Skipped: []string{}}
+	skipped := map[string]bool{}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid backup archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Size > backupMaxEntrySize {
+			return nil, errors.Errorf("%s exceeds the maximum size", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", hdr.Name)
+		}
+
+		name := path.Clean(hdr.Name)
+		if res.Manifest == nil && name != backupManifestFile {
+			return nil, errors.New("backup archive does not start with a manifest")
+		}
+		switch {
+		case name == backupManifestFile:
+			var m BackupManifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, errors.Wrap(err, "invalid manifest")
+			}
+			if m.Version != backupVersion {
+				return nil, errors.Errorf("unsupported backup version %d", m.Version)
+			}
+			res.Manifest = &m
+		case name == backupInhibitRulesFile:
+			if _, err := loadInhibitRules(string(data)); err != nil {
+				return nil, errors.Wrap(err, "invalid global inhibit rules")
+			}
+			if err := c.SetGlobalInhibitRules(ctx, string(data)); err != nil {
+				return nil, errors.Wrap(err, "failed to store global inhibit rules")
+			}
+		case strings.HasPrefix(name, backupLibraryDir):
+			fn := strings.TrimPrefix(name, backupLibraryDir)
+			if err := validateLibraryTemplateName(fn); err != nil {
+				return nil, err
+			}
+			if err := validateTemplateFiles(map[string]string{fn: string(data)}); err != nil {
+				return nil, errors.Wrapf(err, "invalid library template %s", fn)
+			}
+			if _, err := c.SetLibraryTemplate(ctx, fn, string(data)); err != nil {
+				return nil, errors.Wrapf(err, "failed to store library template %s", fn)
+			}
+		case strings.HasPrefix(name, backupUsersDir):
+			parts := strings.SplitN(strings.TrimPrefix(name, backupUsersDir), "/", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("unexpected file %s", name)
+			}
+			userID, file := parts[0], parts[1]
+			switch {
+			case file == backupConfigFile:
+				restored, err := restoreConfig(ctx, c, userID, data, overwrite)
+				if err != nil {
+					return nil, err
+				}
+				if restored {
+					res.Restored = append(res.Restored, userID)
+				} else {
+					skipped[userID] = true
+					res.Skipped = append(res.Skipped, userID)
+				}
+			case strings.HasPrefix(file, backupStateDir):
+				// The configs precede the state in the archive. The stored
+				// state of skipped users is kept.
+				key := strings.TrimPrefix(file, backupStateDir)
+				if key != silencesStateKey && key != nflogStateKey {
+					return nil, errors.Errorf("unexpected state file %s", name)
+				}
+				if bucket == nil || skipped[userID] {
+					continue
+				}
+				if err := bucket.Upload(ctx, path.Join(userID, key), bytes.NewReader(data)); err != nil {
+					return nil, errors.Wrapf(err, "failed to upload %s of user %s", key, userID)
+				}
+				res.States++
+			default:
+				return nil, errors.Errorf("unexpected file %s", name)
+			}
+		default:
+			return nil, errors.Errorf("unexpected file %s", name)
+		}
+	}
+	if res.Manifest == nil {
+		return nil, errors.New("backup archive is empty")
+	}
+	return res, nil
+}
+
+func restoreConfig(ctx context.Context, c AlertmanagerClient, userID string, data []byte, overwrite bool) (bool, error) {
+	var cfg AlertmanagerConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return false, errors.Wrapf(err, "invalid config of user %s", userID)
+	}
+	if cfg.UserID != userID {
+		return false, errors.Errorf("config of user %s belongs to user %q", userID, cfg.UserID)
+	}
+	if !overwrite {
+		existing, err := c.GetConfig(ctx, userID)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get config of user %s", userID)
+		}
+		if existing.UserID != "" {
+			return false, nil
+		}
+	}
+	if err := c.SetConfig(ctx, &cfg); err != nil {
+		return false, errors.Wrapf(err, "failed to store config of user %s", userID)
+	}
+	return true, nil
+}
@@ -0,0 +1,383 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	benchIDLabel model.LabelName = "bench_id"
+
+	// benchTick is how often the injection catches up with the rate.
+	benchTick = 10 * time.Millisecond
+	// benchSampleInterval is how often the memory usage and the
+	// notifications in flight are sampled.
+	benchSampleInterval = 250 * time.Millisecond
+)
+
+// BenchOptions configures a load test of the notification pipeline, see
+// Bench.
+type BenchOptions struct {
+	// Tenants is the number of synthetic users.
+	Tenants int
+	// AlertsPerSecond is the rate of the injected alerts, spread evenly
+	// over the users.
+	AlertsPerSecond int
+	// Duration is how long alerts are injected.
+	Duration time.Duration
+	// Groups is the number of aggregation groups of each user.
+	Groups int
+	// GroupInterval is the group_interval of the route of the users. It
+	// delays the notification of the alerts joining notified groups.
+	GroupInterval time.Duration
+	// SinkLatency delays the responses of the sink receiver.
+	SinkLatency time.Duration
+	// DrainTimeout is how long the notifications of the injected alerts
+	// are waited for once the injection stops.
+	DrainTimeout time.Duration
+	Logger       log.Logger
+}
+
+// Validate validates the options.
+func (o *BenchOptions) Validate() error {
+	switch {
+	case o.Tenants <= 0:
+		return errors.New("the number of tenants must be positive")
+	case o.AlertsPerSecond <= 0:
+		return errors.New("the alert rate must be positive")
+	case o.Duration <= 0:
+		return errors.New("the duration must be positive")
+	case o.Groups <= 0:
+		return errors.New("the number of groups must be positive")
+	case o.GroupInterval < time.Second:
+		return errors.New("the group interval must be at least 1s")
+	}
+	return nil
+}
+
+// BenchReport is the outcome of a load test.
+type BenchReport struct {
+	Tenants  int
+	Duration time.Duration
+
+	// AlertsInjected is the number of alerts put into the providers of the
+	// users, at InjectionRate alerts per second.
+	AlertsInjected int
+	TargetRate     float64
+	InjectionRate  float64
+	// PutLatency is the time taken by the providers to accept an alert.
+	PutLatency LatencySummary
+
+	// AlertsDelivered is the number of injected alerts which reached the
+	// sink receiver, DispatchLatency after being injected.
+	AlertsDelivered int
+	DispatchLatency LatencySummary
+
+	// Notifications is the number of requests received by the sink.
+	Notifications          int
+	NotificationsPerSecond float64
+	// MaxInflight is the largest number of notifications being sent at
+	// once, over all users.
+	MaxInflight int64
+
+	MaxHeapAlloc  uint64
+	Sys           uint64
+	MaxGoroutines int
+
+	// Backpressure names the stages which did not keep up, if any.
+	Backpressure []string
+}
+
+// LatencySummary summarizes the distribution of latencies.
+type LatencySummary struct {
+	P50, P90, P99, Max time.Duration
+}
+
+func summarizeLatencies(ds []time.Duration) LatencySummary {
+	if len(ds) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	q := func(p float64) time.Duration {
+		return ds[int(p*float64(len(ds)-1))]
+	}
+	return LatencySummary{P50: q(.5), P90: q(.9), P99: q(.99), Max: ds[len(ds)-1]}
+}
+
+// benchSink is the webhook receiver of the users, recording when the
+// injected alerts are first notified.
+type benchSink struct {
+	latency time.Duration
+
+	notifications int64
+
+	mtx       sync.Mutex
+	injected  map[string]time.Time
+	latencies []time.Duration
+}
+
+func (s *benchSink) inject(id string, at time.Time) {
+	s.mtx.Lock()
+	s.injected[id] = at
+	s.mtx.Unlock()
+}
+
+func (s *benchSink) delivered() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.latencies)
+}
+
+func (s *benchSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	atomic.AddInt64(&s.notifications, 1)
+	var msg struct {
+		Alerts []struct {
+			Labels model.LabelSet `json:"labels"`
+		} `json:"alerts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mtx.Lock()
+	for _, a := range msg.Alerts {
+		id := string(a.Labels[benchIDLabel])
+		if at, ok := s.injected[id]; ok {
+			s.latencies = append(s.latencies, now.Sub(at))
+			delete(s.injected, id)
+		}
+	}
+	s.mtx.Unlock()
+
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+}
+
+// benchConfig returns the config of a synthetic user, grouping its alerts
+// by alertname and sending them to the sink.
+func benchConfig(sinkURL string, groupInterval time.Duration) (*notify.Config, error) {
+	return notify.LoadConfig(fmt.Sprintf(`
+route:
+  receiver: sink
+  group_by: [alertname]
+  group_wait: 0s
+  group_interval: %s
+  repeat_interval: 1h
+receivers:
+- name: sink
+  webhook_configs:
+  - url: %s
+    send_resolved: false
+`, model.Duration(groupInterval), sinkURL))
+}
+
+// Bench load tests the notification pipeline. It creates Alertmanagers for
+// synthetic users, sending their notifications to a sink receiver, and
+// injects alerts directly into their providers at the configured rate.
+// The alerts skip the alert preprocessing and the limits of the users,
+// like the synthetic probe alerts.
+func Bench(ctx context.Context, o BenchOptions) (*BenchReport, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	logger := o.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	dir, err := ioutil.TempDir("", "alertmanager-bench")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &benchSink{latency: o.SinkLatency, injected: map[string]time.Time{}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: sink}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	externalURL, err := url.Parse("http://" + l.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	ams := make([]*Alertmanager, 0, o.Tenants)
+	defer func() {
+		for _, am := range ams {
+			am.Stop()
+		}
+	}()
+	for i := 0; i < o.Tenants; i++ {
+		userID := fmt.Sprintf("bench-%d", i)
+		if err := os.MkdirAll(filepath.Join(dir, "templates", userID), 0755); err != nil {
+			return nil, err
+		}
+		am, err := NewAlertmanager(&Config{
+			UserID:      userID,
+			DataDir:     dir,
+			Logger:      logger,
+			Retention:   time.Hour,
+			ExternalURL: externalURL,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create the Alertmanager of %s", userID)
+		}
+		ams = append(ams, am)
+		conf, err := benchConfig(externalURL.String()+"/"+userID, o.GroupInterval)
+		if err != nil {
+			return nil, err
+		}
+		if err := am.ApplyConfig(ctx, userID, conf, externalURL); err != nil {
+			return nil, errors.Wrapf(err, "failed to apply the config of %s", userID)
+		}
+	}
+
+	r := &BenchReport{Tenants: o.Tenants, TargetRate: float64(o.AlertsPerSecond)}
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		r.sample(ams, stopSampling)
+	}()
+
+	// The injection catches up with the rate every tick. Falling behind
+	// means the providers do not keep up.
+	var puts []time.Duration
+	start := time.Now()
+	t := time.NewTicker(benchTick)
+inject:
+	for seq := 0; ; {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			break inject
+		}
+		elapsed := time.Since(start)
+		if elapsed >= o.Duration {
+			break inject
+		}
+		for due := int(elapsed.Seconds() * r.TargetRate); seq < due; seq++ {
+			now := time.Now()
+			id := strconv.Itoa(seq)
+			a := &types.Alert{
+				Alert: model.Alert{
+					Labels: model.LabelSet{
+						model.AlertNameLabel: model.LabelValue(fmt.Sprintf("Bench%d", (seq/o.Tenants)%o.Groups)),
+						benchIDLabel:         model.LabelValue(id),
+					},
+					StartsAt: now,
+					EndsAt:   now.Add(time.Hour),
+				},
+				UpdatedAt: now,
+			}
+			sink.inject(id, now)
+			if err := ams[seq%o.Tenants].alerts.Put(a); err != nil {
+				t.Stop()
+				close(stopSampling)
+				<-sampled
+				return nil, err
+			}
+			puts = append(puts, time.Since(now))
+		}
+	}
+	t.Stop()
+	injection := time.Since(start)
+	r.AlertsInjected = len(puts)
+	r.InjectionRate = float64(r.AlertsInjected) / injection.Seconds()
+	r.PutLatency = summarizeLatencies(puts)
+
+	for deadline := time.Now().Add(o.DrainTimeout); sink.delivered() < r.AlertsInjected && time.Now().Before(deadline); {
+		time.Sleep(benchTick)
+	}
+	r.Duration = time.Since(start)
+	close(stopSampling)
+	<-sampled
+
+	sink.mtx.Lock()
+	r.AlertsDelivered = len(sink.latencies)
+	r.DispatchLatency = summarizeLatencies(sink.latencies)
+	sink.mtx.Unlock()
+	r.Notifications = int(atomic.LoadInt64(&sink.notifications))
+	r.NotificationsPerSecond = float64(r.Notifications) / r.Duration.Seconds()
+	r.Backpressure = r.backpressure(o)
+	return r, ctx.Err()
+}
+
+// sample records the peak memory usage, goroutines and notifications in
+// flight until stopc is closed.
+func (r *BenchReport) sample(ams []*Alertmanager, stopc <-chan struct{}) {
+	t := time.NewTicker(benchSampleInterval)
+	defer t.Stop()
+	var ms runtime.MemStats
+	for {
+		runtime.ReadMemStats(&ms)
+		if ms.HeapAlloc > r.MaxHeapAlloc {
+			r.MaxHeapAlloc = ms.HeapAlloc
+		}
+		r.Sys = ms.Sys
+		if n := runtime.NumGoroutine(); n > r.MaxGoroutines {
+			r.MaxGoroutines = n
+		}
+		var inflight int64
+		for _, am := range ams {
+			inflight += atomic.LoadInt64(&am.inflight)
+		}
+		if inflight > r.MaxInflight {
+			r.MaxInflight = inflight
+		}
+
+		select {
+		case <-t.C:
+		case <-stopc:
+			return
+		}
+	}
+}
+
+// backpressure names the stages which did not keep up: the providers if
+// the alerts could not be injected at the target rate, the integrations if
+// at least half of the aggregation groups were sending at once, and the
+// dispatcher if alerts were notified more than half a group interval late,
+// or not at all.
+func (r *BenchReport) backpressure(o BenchOptions) []string {
+	var res []string
+	if r.InjectionRate < 0.95*r.TargetRate {
+		res = append(res, fmt.Sprintf("provider: %.0f alerts/s injected of %.0f/s targeted, the p99 put latency is %s", r.InjectionRate, r.TargetRate, r.PutLatency.P99))
+	}
+	if groups := int64(o.Tenants * o.Groups); 2*r.MaxInflight >= groups {
+		res = append(res, fmt.Sprintf("notifier: up to %d of the %d aggregation groups sending at once", r.MaxInflight, groups))
+	}
+	if budget := o.GroupInterval*3/2 + o.SinkLatency; r.DispatchLatency.P99 > budget {
+		res = append(res, fmt.Sprintf("dispatcher: the p99 dispatch latency %s exceeds %s", r.DispatchLatency.P99, budget))
+	}
+	if missing := r.AlertsInjected - r.AlertsDelivered; missing > 0 {
+		res = append(res, fmt.Sprintf("dispatcher: %d alerts not notified within the drain timeout", missing))
+	}
+	return res
+}
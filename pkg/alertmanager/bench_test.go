@@ -0,0 +1,45 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBench(t *testing.T) {
+	r, err := Bench(context.Background(), BenchOptions{
+		Tenants:         2,
+		AlertsPerSecond: 200,
+		Duration:        500 * time.Millisecond,
+		Groups:          3,
+		GroupInterval:   time.Second,
+		DrainTimeout:    10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.AlertsInjected == 0 || r.AlertsDelivered != r.AlertsInjected {
+		t.Fatalf("expected all injected alerts to be delivered, got %d of %d", r.AlertsDelivered, r.AlertsInjected)
+	}
+	// Each group is notified at least once.
+	if r.Notifications < 2*3 {
+		t.Fatalf("expected at least 6 notifications, got %d", r.Notifications)
+	}
+	if r.DispatchLatency.Max == 0 || r.DispatchLatency.P50 > r.DispatchLatency.Max {
+		t.Fatalf("unexpected dispatch latency %+v", r.DispatchLatency)
+	}
+	if r.MaxHeapAlloc == 0 {
+		t.Fatal("expected the memory usage to be sampled")
+	}
+}
+
+func TestBenchValidate(t *testing.T) {
+	o := BenchOptions{Tenants: 1, AlertsPerSecond: 1, Duration: time.Second, Groups: 1, GroupInterval: time.Second}
+	if err := o.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	o.GroupInterval = time.Millisecond
+	if err := o.Validate(); err == nil {
+		t.Fatal("expected an error for a group interval below 1s")
+	}
+}
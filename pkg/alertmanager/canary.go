@@ -0,0 +1,509 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	CanaryRunning    = "running"
+	CanaryPromoted   = "promoted"
+	CanaryRolledBack = "rolled_back"
+
+	defaultCanaryDuration = 10 * time.Minute
+	maxCanaryDuration     = 24 * time.Hour
+	// canaryCheckInterval is how often the leader checks whether the
+	// running canaries are promoted or rolled back.
+	canaryCheckInterval = 10 * time.Second
+)
+
+var canaryOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "config_canaries_total",
+	Help:      "The total number of canary configs promoted or rolled back.",
+}, []string{"outcome"})
+
+func init() {
+	prometheus.MustRegister(canaryOutcomes)
+}
+
+// CanaryStats are the notifications of a canary config rendered by the
+// leader.
+type CanaryStats struct {
+	Rendered  int    `json:"rendered" yaml:"rendered"`
+	Errors    int    `json:"errors" yaml:"errors"`
+	LastError string `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+}
+
+// CanaryConfig is a candidate config run in shadow next to the config of
+// the user: its notifications are rendered but not sent, except those of
+// Receiver if set. The candidate is promoted to the config of the user
+// once it ran for Duration, unless more than MaxErrors notifications failed
+// to render, in which case it is rolled back. The external URL of the user
+// is kept.
+type CanaryConfig struct {
+	Config        string            `json:"config,omitempty" yaml:"config,omitempty"`
+	TemplateFiles map[string]string `json:"templateFiles,omitempty" yaml:"templateFiles,omitempty"`
+	Duration      string            `json:"duration" yaml:"duration"`
+	MaxErrors     int               `json:"maxErrors" yaml:"maxErrors"`
+	Receiver      string            `json:"receiver,omitempty" yaml:"receiver,omitempty"`
+
+	Status           string `json:"status" yaml:"status"`
+	StartedAtInUnix  int64  `json:"startedAtInUnix" yaml:"startedAtInUnix"`
+	FinishedAtInUnix int64  `json:"finishedAtInUnix,omitempty" yaml:"finishedAtInUnix,omitempty"`
+	// The stats of a finished canary, those of a running canary are
+	// returned with the status of the user's Alertmanager.
+	CanaryStats `yaml:",inline"`
+}
+
+// validate checks the settings of the canary, the config is validated like
+// the config of the user.
+func (c *CanaryConfig) validate() error {
+	d, err := model.ParseDuration(c.Duration)
+	if err != nil {
+		return errors.Wrap(err, "invalid duration")
+	}
+	if d <= 0 || time.Duration(d) > maxCanaryDuration {
+		return errors.Errorf("duration must be positive and at most %s", model.Duration(maxCanaryDuration))
+	}
+	if c.MaxErrors < 0 {
+		return errors.New("maxErrors must not be negative")
+	}
+	if c.Receiver == "" {
+		return nil
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(c.Config))
+	if err != nil {
+		return err
+	}
+	for _, rc := range conf.Receivers {
+		if rc.Name == c.Receiver {
+			return nil
+		}
+	}
+	return errors.Errorf("undefined canary receiver %q", c.Receiver)
+}
+
+// checksum identifies the candidate config of the canary.
+func (c *CanaryConfig) checksum() string {
+	return configChecksum(&AlertmanagerConfig{Config: c.Config, TemplateFiles: c.TemplateFiles})
+}
+
+// canaryTemplatesDir returns the directory holding the templates of the
+// canary of a user, apart from those of its config.
+func canaryTemplatesDir(dataDir, userID string) string {
+	return filepath.Join(dataDir, "canary-templates", userID)
+}
+
+// A canary runs the pipeline of a candidate config in shadow next to the
+// pipeline of the applied config, and counts the notifications it renders.
+type canary struct {
+	startedAt    int64
+	checksum     string
+	duration     time.Duration
+	maxErrors    int
+	receiver     string
+	templatesDir string
+	// nflog deduplicates the notifications of the canary receiver, apart
+	// from the notification log of the applied config.
+	nflog    *nflog.Log
+	pipeline *pipeline
+
+	mtx   sync.Mutex
+	stats CanaryStats
+	// failed is set if the candidate config could not be loaded, the
+	// canary is then rolled back regardless of MaxErrors.
+	failed bool
+}
+
+func newCanary(c *CanaryConfig, templatesDir string) *canary {
+	return &canary{
+		startedAt:    c.StartedAtInUnix,
+		checksum:     c.checksum(),
+		duration:     duration(c.Duration, defaultCanaryDuration),
+		maxErrors:    c.MaxErrors,
+		receiver:     c.Receiver,
+		templatesDir: templatesDir,
+	}
+}
+
+// report counts a rendered notification, see notify.RenderReport.
+func (c *canary) report(receiver, integration string, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.stats.Rendered++
+	if err != nil {
+		c.stats.Errors++
+		c.stats.LastError = fmt.Sprintf("receiver %q, integration %s: %v", receiver, integration, err)
+	}
+}
+
+// fail records that the candidate config could not be run.
+func (c *canary) fail(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.failed = true
+	c.stats.Errors++
+	c.stats.LastError = err.Error()
+}
+
+func (c *canary) getStats() CanaryStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.stats
+}
+
+// verdict returns whether the canary is done at now, and if so whether it
+// is promoted. It is rolled back once its errors exceed the threshold, and
+// promoted once it ran for its duration.
+func (c *canary) verdict(now time.Time) (done, promote bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.failed || c.stats.Errors > c.maxErrors {
+		return true, false
+	}
+	return !now.Before(time.Unix(c.startedAt, 0).Add(c.duration)), true
+}
+
+func (c *canary) stop() {
+	if c == nil {
+		return
+	}
+	c.pipeline.stop()
+}
+
+// runCanary runs conf in shadow for c, replacing the running canary. A nil
+// c stops the running canary. A conf which can not be run fails c.
+func (am *Alertmanager) runCanary(c *canary, conf *notify.Config, externalURL *url.URL) {
+	if c != nil && conf != nil {
+		p, err := newPipeline(am, am.cfg.UserID, conf, externalURL, c)
+		if err != nil {
+			c.fail(err)
+		} else {
+			c.pipeline = p
+		}
+	}
+
+	am.pipelineMtx.Lock()
+	old := am.canary
+	am.canary = c
+	if c != nil && c.pipeline != nil {
+		c.pipeline.start()
+	}
+	am.pipelineMtx.Unlock()
+	old.stop()
+}
+
+// getCanary returns the running canary, or nil.
+func (am *Alertmanager) getCanary() *canary {
+	am.pipelineMtx.RLock()
+	defer am.pipelineMtx.RUnlock()
+	return am.canary
+}
+
+// syncCanary runs the canary of the config of the user in shadow, or stops
+// the running canary if the config has none running.
+func (am *MultitenantAlertmanager) syncCanary(ctx context.Context, userAM *Alertmanager, cfg *AlertmanagerConfig) {
+	cc := cfg.Canary
+	running := userAM.getCanary()
+	if cc == nil || cc.Status != CanaryRunning {
+		if running != nil {
+			userAM.runCanary(nil, nil, nil)
+		}
+		return
+	}
+	if running != nil && running.startedAt == cc.StartedAtInUnix && running.checksum == cc.checksum() {
+		return
+	}
+
+	c := newCanary(cc, canaryTemplatesDir(am.cfg.DataDir, cfg.UserID))
+	conf, err := am.loadCanary(ctx, cfg, c)
+	if err != nil {
+		c.fail(err)
+	}
+	externalURL, _ := tenantExternalURL(cfg)
+	userAM.runCanary(c, conf, externalURL)
+	Must(level.Info(logger2.Logger).Log("msg", "canary config started", "user", cfg.UserID, "duration", c.duration, "receiver", c.receiver))
+}
+
+// loadCanary writes the templates of the canary of the user and loads its
+// config.
+func (am *MultitenantAlertmanager) loadCanary(ctx context.Context, cfg *AlertmanagerConfig, c *canary) (*notify.Config, error) {
+	if err := os.RemoveAll(c.templatesDir); err != nil {
+		return nil, err
+	}
+	for fn, content := range cfg.Canary.TemplateFiles {
+		file := filepath.Join(c.templatesDir, fn)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	resolved, err := am.secretResolver.Resolve(ctx, cfg.UserID, cfg.Canary.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve the secrets of the canary config")
+	}
+	conf, err := notify.LoadConfig(resolved)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the canary config")
+	}
+	c.nflog, err = nflog.New(nflog.WithRetention(am.Retention(cfg.Retention).NotificationLog))
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// finishCanary promotes the running canary started at startedAt to the
+// config of the user, or rolls it back, and records its stats. Configs
+// whose canary was replaced or finished meanwhile are skipped.
+func finishCanary(cfg *AlertmanagerConfig, startedAt int64, stats CanaryStats, promote bool, now time.Time) error {
+	c := cfg.Canary
+	if cfg.UserID == "" || c == nil || c.Status != CanaryRunning || c.StartedAtInUnix != startedAt {
+		return errSkipItem
+	}
+	finished := *c
+	finished.Config, finished.TemplateFiles = "", nil
+	finished.CanaryStats = stats
+	finished.FinishedAtInUnix = now.Unix()
+	finished.Status = CanaryRolledBack
+	if promote {
+		finished.Status = CanaryPromoted
+		cfg.Config, cfg.TemplateFiles = c.Config, c.TemplateFiles
+	}
+	cfg.Canary = &finished
+	cfg.UpdatedAtInUnix = now.Unix()
+	return nil
+}
+
+// CanaryController promotes or rolls back the canaries run by the leader.
+type CanaryController struct {
+	client AlertmanagerClient
+	am     *MultitenantAlertmanager
+	logger log.Logger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewCanaryController creates a new CanaryController.
+func NewCanaryController(c AlertmanagerClient, am *MultitenantAlertmanager) *CanaryController {
+	return &CanaryController{
+		client: c,
+		am:     am,
+		logger: log.With(logger2.Logger, "component", "canaries"),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run checks the canaries until the CanaryController is stopped.
+func (c *CanaryController) Run() {
+	defer close(c.done)
+	t := time.NewTicker(canaryCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if c.am.IsLeader() {
+				c.check(time.Now())
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the CanaryController.
+func (c *CanaryController) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+// check finishes the canaries which are done at now. The updated configs
+// stop the canaries once applied.
+func (c *CanaryController) check(now time.Time) {
+	canaries := map[string]*canary{}
+	c.am.alertmanagersMtx.Lock()
+	for userID, userAM := range c.am.alertmanagers {
+		if cn := userAM.getCanary(); cn != nil {
+			canaries[userID] = cn
+		}
+	}
+	c.am.alertmanagersMtx.Unlock()
+
+	for userID, cn := range canaries {
+		done, promote := cn.verdict(now)
+		if !done {
+			continue
+		}
+		stats := cn.getStats()
+		ctx, cancel := context.WithTimeout(context.Background(), c.am.cfg.ClientTimeout)
+		err := c.client.UpdateConfig(ctx, userID, func(cfg *AlertmanagerConfig) error {
+			return finishCanary(cfg, cn.startedAt, stats, promote, now)
+		})
+		cancel()
+		switch {
+		case err == errSkipItem:
+		case err != nil:
+			Must(level.Warn(c.logger).Log("msg", "error finishing canary config", "user", userID, "err", err))
+		case promote:
+			canaryOutcomes.WithLabelValues(CanaryPromoted).Inc()
+			Must(level.Info(c.logger).Log("msg", "canary config promoted", "user", userID, "rendered", stats.Rendered, "errors", stats.Errors))
+		default:
+			canaryOutcomes.WithLabelValues(CanaryRolledBack).Inc()
+			Must(level.Info(c.logger).Log("msg", "canary config rolled back", "user", userID, "rendered", stats.Rendered, "errors", stats.Errors, "last_error", stats.LastError))
+		}
+	}
+}
+
+// getCanary returns the canary of the user, running or finished. Its
+// secrets are redacted if redaction is enabled.
+func (a *API) getCanary(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	if cfg.Canary == nil {
+		writeError(w, http.StatusNotFound, "no canary config")
+		return
+	}
+	c := *cfg.Canary
+	if a.redaction.Enabled && c.Config != "" {
+		c.Config, err = redactConfig(c.Config)
+		if err != nil {
+			Must(level.Error(logger).Log("msg", "error redacting config", "err", err))
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// setCanary starts running a candidate config in shadow, replacing the
+// canary of the user. The body is that of setConfig, the canary settings
+// are the `duration`, `maxErrors` and `receiver` query parameters.
+func (a *API) setCanary(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, configOnly, err := decodeAlertmanagerConfig(w, r)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := r.URL.Query()
+	c := &CanaryConfig{
+		Config:        cfg.Config,
+		TemplateFiles: cfg.TemplateFiles,
+		Duration:      q.Get("duration"),
+		Receiver:      q.Get("receiver"),
+		Status:        CanaryRunning,
+	}
+	if c.Duration == "" {
+		c.Duration = model.Duration(defaultCanaryDuration).String()
+	}
+	if s := q.Get("maxErrors"); s != "" {
+		if c.MaxErrors, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid maxErrors %q", s))
+			return
+		}
+	}
+	if !a.checkConfig(w, logger, userID, cfg) {
+		return
+	}
+	if err := c.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid canary: %v", err))
+		return
+	}
+
+	err = a.client.UpdateConfig(r.Context(), userID, func(stored *AlertmanagerConfig) error {
+		if stored.UserID == "" || stored.DeactivatedAtInUnix > 0 || stored.DeletedAtInUnix > 0 {
+			return errConfigNotFound
+		}
+		// A raw YAML config replaces the Alertmanager config only, the
+		// stored templates are kept.
+		if configOnly {
+			c.TemplateFiles = stored.TemplateFiles
+		}
+		c.StartedAtInUnix = time.Now().Unix()
+		stored.Canary = c
+		stored.UpdatedAtInUnix = c.StartedAtInUnix
+		return nil
+	})
+	if err == errConfigNotFound {
+		writeError(w, http.StatusNotFound, "the canary of a config requires an active config")
+		return
+	}
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error storing canary config", "err", err))
+		storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deleteCanary stops the running canary of the user without promoting it,
+// or removes the outcome of the finished canary.
+func (a *API) deleteCanary(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	err = a.client.UpdateConfig(r.Context(), userID, func(stored *AlertmanagerConfig) error {
+		if stored.Canary == nil {
+			return errConfigNotFound
+		}
+		stored.Canary = nil
+		stored.UpdatedAtInUnix = time.Now().Unix()
+		return nil
+	})
+	if err == errConfigNotFound {
+		writeError(w, http.StatusNotFound, "no canary config")
+		return
+	}
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error storing config", "err", err))
+		storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
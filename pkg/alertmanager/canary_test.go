@@ -0,0 +1,105 @@
+package alertmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const canaryTestConfig = `
+route:
+  receiver: team
+receivers:
+- name: team
+`
+
+func TestCanaryConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		canary CanaryConfig
+		valid  bool
+	}{
+		{name: "valid", canary: CanaryConfig{Config: canaryTestConfig, Duration: "10m", MaxErrors: 1}, valid: true},
+		{name: "receiver", canary: CanaryConfig{Config: canaryTestConfig, Duration: "1h", Receiver: "team"}, valid: true},
+		{name: "undefined receiver", canary: CanaryConfig{Config: canaryTestConfig, Duration: "1h", Receiver: "ops"}},
+		{name: "too long", canary: CanaryConfig{Config: canaryTestConfig, Duration: "2d"}},
+		{name: "invalid duration", canary: CanaryConfig{Config: canaryTestConfig, Duration: "soon"}},
+		{name: "negative max errors", canary: CanaryConfig{Config: canaryTestConfig, Duration: "10m", MaxErrors: -1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.canary.validate()
+			if tc.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestCanaryVerdict(t *testing.T) {
+	start := time.Now()
+	c := newCanary(&CanaryConfig{Config: canaryTestConfig, Duration: "10m", MaxErrors: 1, StartedAtInUnix: start.Unix()}, "")
+
+	if done, _ := c.verdict(start.Add(5 * time.Minute)); done {
+		t.Fatal("canary done before its duration")
+	}
+	c.report("team", "webhook[0]", nil)
+	c.report("team", "webhook[1]", errors.New("template error"))
+	if done, promote := c.verdict(start.Add(10 * time.Minute)); !done || !promote {
+		t.Fatalf("expected canary within the threshold to be promoted, got done %t promote %t", done, promote)
+	}
+	c.report("team", "webhook[1]", errors.New("template error"))
+	if done, promote := c.verdict(start.Add(time.Minute)); !done || promote {
+		t.Fatalf("expected canary over the threshold to be rolled back, got done %t promote %t", done, promote)
+	}
+	if st := c.getStats(); st.Rendered != 3 || st.Errors != 2 || st.LastError == "" {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestFinishCanary(t *testing.T) {
+	now := time.Now()
+	stats := CanaryStats{Rendered: 4}
+	newConfig := func() *AlertmanagerConfig {
+		return &AlertmanagerConfig{
+			UserID: "user",
+			Config: "old",
+			Canary: &CanaryConfig{
+				Config:          "new",
+				TemplateFiles:   map[string]string{"a.tmpl": "a"},
+				Duration:        "10m",
+				Status:          CanaryRunning,
+				StartedAtInUnix: 100,
+			},
+		}
+	}
+
+	cfg := newConfig()
+	if err := finishCanary(cfg, 100, stats, true, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Config != "new" || cfg.TemplateFiles["a.tmpl"] != "a" {
+		t.Fatalf("promoted canary not applied: %+v", cfg)
+	}
+	if cfg.Canary.Status != CanaryPromoted || cfg.Canary.Config != "" || cfg.Canary.Rendered != 4 || cfg.Canary.FinishedAtInUnix != now.Unix() {
+		t.Fatalf("unexpected finished canary %+v", cfg.Canary)
+	}
+
+	cfg = newConfig()
+	if err := finishCanary(cfg, 100, stats, false, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Config != "old" || cfg.Canary.Status != CanaryRolledBack {
+		t.Fatalf("rolled back canary applied: %+v", cfg)
+	}
+
+	// Replaced and finished canaries are left alone.
+	if err := finishCanary(newConfig(), 200, stats, true, now); err != errSkipItem {
+		t.Fatalf("expected replaced canary to be skipped, got %v", err)
+	}
+	if err := finishCanary(cfg, 100, stats, true, now); err != errSkipItem {
+		t.Fatalf("expected finished canary to be skipped, got %v", err)
+	}
+}
@@ -1,27 +1,176 @@
 package alertmanager
 
 import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/pkg/errors"
 	"github.com/prometheus/alertmanager/cluster"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
 	"github.com/spf13/pflag"
 )
 
 // MultitenantAlertmanagerConfig is the configuration for a multitenant Alertmanager.
 type MultitenantAlertmanagerConfig struct {
-	APIPort       string
-	DataDir       string
-	Retention     time.Duration
-	PathPrefix    string
-	ConfigsAPIURL string
-	PollInterval  time.Duration
-	ClientTimeout time.Duration
+	APIPort        string
+	ReplicaName    string
+	DataDir        string
+	Retention      time.Duration
+	PathPrefix     string
+	ConfigsAPIURL  string
+	PollInterval   time.Duration
+	ResyncInterval time.Duration
+	ApplyDebounce  time.Duration
+	ClientTimeout  time.Duration
+	ApplyTimeout   time.Duration
+	// ApplyMaxDelay bounds how long config updates wait for the debounce,
+	// from the first pending update.
+	ApplyMaxDelay time.Duration
+	// SecretRefreshInterval is how often the secret references of unchanged
+	// configs are resolved again. Disabled if 0.
+	SecretRefreshInterval time.Duration
+	// ApplyConcurrency is the number of configs applied concurrently.
+	ApplyConcurrency int
+	// ConfigsPageSize is the number of configs loaded at once when all
+	// configs are applied.
+	ConfigsPageSize int64
+	// IdleTimeout after which Alertmanagers without alerts and traffic are
+	// parked. Disabled if 0.
+	IdleTimeout time.Duration
+	// SyntheticProbeInterval is how often a synthetic alert is sent through
+	// the pipelines of the SyntheticProbeUsers, all if empty, to a loopback
+	// receiver. Disabled if 0.
+	SyntheticProbeInterval time.Duration
+	SyntheticProbeTimeout  time.Duration
+	SyntheticProbeUsers    []string
+
+	StatePersistInterval time.Duration
+	// DrainTimeout bounds flushing the pending aggregation groups and
+	// waiting for in-flight notifications on shutdown.
+	DrainTimeout time.Duration
+	// ServerShutdownTimeout bounds waiting for in-flight API requests on
+	// shutdown, after draining.
+	ServerShutdownTimeout time.Duration
+
+	// AlertGCInterval is how often resolved alerts are removed.
+	AlertGCInterval time.Duration
+	// The bounds of the retention overrides users can set. A zero maximum
+	// is unbounded.
+	MinRetention       time.Duration
+	MaxRetention       time.Duration
+	MinAlertGCInterval time.Duration
+	MaxAlertGCInterval time.Duration
+
+	// UserDiskLimit is the number of bytes the templates and state snapshots
+	// of a user may use in the data directory. Disabled if 0.
+	UserDiskLimit     int64
+	DiskUsageInterval time.Duration
+
+	// The dispatch limits of every user, see DispatchLimits.
+	MaxAlertsPerUser int
+	MaxGroupsPerUser int
+	// LimitOverridesFile holds the limits of the users selected by their
+	// labels, see LimitOverride.
+	LimitOverridesFile string
+	limitOverrides     []*LimitOverride
+
+	// TenantSelector selects the users this replica runs by their labels,
+	// so that users can be pinned to dedicated replicas.
+	TenantSelector string
+	tenantSelector TenantSelector
+
+	// DefaultFeatures are the feature flags enabled for the users without
+	// overrides, see notify.Features.
+	DefaultFeatures []string
+	defaultFeatures map[string]bool
+
+	// LeaderElection makes only the elected leader send notifications, the
+	// other replicas proxy the requests of users to the LeaderAdvertiseURL
+	// of the leader.
+	LeaderElection     bool
+	LeaderLeaseTTL     time.Duration
+	LeaderAdvertiseURL string
+
+	EgressAllowedCIDRs []string
+	EgressAllowedHosts []string
+	EgressDenyPrivate  bool
+	// The caps of the outbound requests of the notifiers in flight, see
+	// notify.SetEgressLimits.
+	EgressMaxConcurrent        int
+	EgressMaxConcurrentPerHost int
+	// ExecAllowedCommands are the commands the exec integrations may run,
+	// see notify.SetExecAllowedCommands.
+	ExecAllowedCommands []string
+	// ExecMaxTimeout caps the timeout of the exec integrations.
+	ExecMaxTimeout time.Duration
+	// The credentials of the Alertmanager the AWS integrations without keys
+	// may use, see notify.SetAWSCredentialsPolicy.
+	AWSAllowAmbientCredentials bool
+	AWSAllowedRoleARNs         []string
+
+	// The defaults of the HTTP clients of the notifiers, which receivers
+	// can override, see notify.HTTPClientSettings.
+	HTTPClientTimeout             time.Duration
+	HTTPClientDialTimeout         time.Duration
+	HTTPClientTLSHandshakeTimeout time.Duration
+	HTTPClientIdleConnTimeout     time.Duration
+	HTTPClientMaxIdleConns        int
+	HTTPClientMaxIdleConnsPerHost int
+	HTTPClientTLSMinVersion       string
+	HTTPClientProxyURL            string
+
+	// UIPathPrefix is the path the UI of the authenticated user is served
+	// at, with the user taken from UIUserHeader. Disabled if empty.
+	UIPathPrefix string
+	UIUserHeader string
+
+	AdminAuthMode  string
+	AdminTokenFile string
+	adminToken     string
+	// AdminAllowUnauthenticated acknowledges the none admin auth mode, as
+	// the admin API is served alongside the API of the users. The none mode
+	// is deprecated without it, and will then be rejected in a later release.
+	AdminAllowUnauthenticated bool
+
+	// GlobalInhibitRulesFile holds inhibition rules applied to all users,
+	// in addition to the rules stored through the admin API.
+	GlobalInhibitRulesFile string
+	globalInhibitRules     []*config.InhibitRule
+	// RoutingPoliciesFile holds the routing policies the configs of all
+	// users must comply with when they are set, see RoutingPolicy.
+	RoutingPoliciesFile string
+	routingPolicies     []*RoutingPolicy
+
+	// HistoryEnabled archives the resolved alert groups, which are served
+	// by the alert history API.
+	HistoryEnabled bool
 
 	ClusterBindAddr      string
 	ClusterAdvertiseAddr string
 
-	Peers                []string
-	PeerTimeout          time.Duration
+	Peers []string
+	// PeerDiscovery finds peers in addition to Peers when the cluster is
+	// created, see discoverPeers.
+	PeerDiscovery          string
+	PeerDiscoveryDNSName   string
+	PeerDiscoveryEndpoints string
+	PeerDiscoveryPortName  string
+	PeerDiscoveryTimeout   time.Duration
+
+	PeerTimeout time.Duration
+	// PeerWait is how the replicas are ordered to send notifications, one
+	// of PeerWaitPosition or PeerWaitZone.
+	PeerWait        string
+	Zone            string
+	ZonePeerTimeout time.Duration
+
 	GossipInterval       time.Duration
 	PushPullInterval     time.Duration
 	TcpTimeout           time.Duration
@@ -35,19 +184,91 @@ type MultitenantAlertmanagerConfig struct {
 // AddFlags adds the flags required to config this to the given FlagSet.
 func (cfg *MultitenantAlertmanagerConfig) AddFlags(f *pflag.FlagSet) {
 	f.StringVar(&cfg.APIPort, "alertmanager.api-port", "8443", "API port for alertmanager.")
+	f.StringVar(&cfg.ReplicaName, "alertmanager.replica-name", "", "Name of this replica, under which the outcome of config applies is stored. Defaults to the hostname.")
 	f.StringVar(&cfg.DataDir, "alertmanager.storage.path", "data/", "Base path for data storage.")
 	f.DurationVar(&cfg.Retention, "alertmanager.storage.retention", 5*24*time.Hour, "How long to keep data for.")
+	f.DurationVar(&cfg.MinRetention, "alertmanager.storage.retention.min", time.Hour, "Minimum retention of silences and notification logs users can set.")
+	f.DurationVar(&cfg.MaxRetention, "alertmanager.storage.retention.max", 30*24*time.Hour, "Maximum retention of silences and notification logs users can set. Unbounded if 0.")
+	f.DurationVar(&cfg.AlertGCInterval, "alertmanager.alerts.gc-interval", 30*time.Minute, "How frequently to remove resolved alerts.")
+	f.DurationVar(&cfg.MinAlertGCInterval, "alertmanager.alerts.gc-interval.min", time.Minute, "Minimum interval of the removal of resolved alerts users can set.")
+	f.DurationVar(&cfg.MaxAlertGCInterval, "alertmanager.alerts.gc-interval.max", 2*time.Hour, "Maximum interval of the removal of resolved alerts users can set. Unbounded if 0.")
+	f.Int64Var(&cfg.UserDiskLimit, "alertmanager.storage.user-limit-bytes", 0, "Bytes the templates and state snapshots of a user may use. Template uploads exceeding it are rejected, and the notification log and expired silences of users exceeding it are truncated to half the retention. Disabled if 0.")
+	f.DurationVar(&cfg.DiskUsageInterval, "alertmanager.storage.usage-interval", time.Minute, "How frequently to measure the data directory usage of the users.")
+	f.IntVar(&cfg.MaxAlertsPerUser, "alertmanager.limits.max-alerts", 0, "Firing alerts a user may hold in memory. New alerts above it are rejected with 429, updates and resolutions of existing alerts are accepted. Unbounded if 0.")
+	f.IntVar(&cfg.MaxGroupsPerUser, "alertmanager.limits.max-groups", 0, "Aggregation groups of the firing alerts a user may hold in memory. New alerts creating groups above it are rejected with 429. Unbounded if 0.")
 
 	f.StringVar(&cfg.PathPrefix, "alertmanager.path-prefix", "/api/prom/alertmanager", "This path will be used to prefix all HTTP endpoints served by Alertmanager.")
 
 	// f.Var(&cfg.ConfigsAPIURL, "alertmanager.configs.url", "URL of configs API server.")
 	f.DurationVar(&cfg.PollInterval, "alertmanager.configs.poll-interval", 15*time.Second, "How frequently to poll users alertmanager configs")
+	Must(f.MarkDeprecated("alertmanager.configs.poll-interval", "configs are watched, use alertmanager.configs.resync-interval instead"))
+	f.DurationVar(&cfg.ResyncInterval, "alertmanager.configs.resync-interval", 5*time.Minute, "How frequently to load all users alertmanager configs, in addition to watching them for updates.")
+	f.DurationVar(&cfg.ApplyDebounce, "alertmanager.configs.apply-debounce", 250*time.Millisecond, "How long to wait for further config updates before applying them.")
+	f.DurationVar(&cfg.ApplyMaxDelay, "alertmanager.configs.apply-max-delay", 5*time.Second, "How long config updates are delayed at most, from the first pending update, while further updates keep arriving within the debounce.")
 	f.DurationVar(&cfg.ClientTimeout, "alertmanager.configs.client-timeout", 5*time.Second, "Timeout for requests to users alertmanager configs service.")
+	f.DurationVar(&cfg.ApplyTimeout, "alertmanager.configs.apply-timeout", 30*time.Second, "Timeout for applying the alertmanager config of a single user.")
+	f.DurationVar(&cfg.SecretRefreshInterval, "alertmanager.configs.secret-refresh-interval", 15*time.Minute, "How frequently the secret references of unchanged configs are resolved again on resync, so that rotated secrets are applied. Disabled if 0.")
+	f.DurationVar(&cfg.SyntheticProbeInterval, "alertmanager.synthetic-probe.interval", 0, "How often a synthetic alert is sent through the dispatcher of every user to a loopback receiver, exporting the delivery latency and success. Disabled if 0.")
+	f.DurationVar(&cfg.SyntheticProbeTimeout, "alertmanager.synthetic-probe.timeout", 30*time.Second, "How long a synthetic alert may take to reach the loopback receiver before the probe fails.")
+	f.StringSliceVar(&cfg.SyntheticProbeUsers, "alertmanager.synthetic-probe.users", nil, "If set, only the alertmanagers of these users are probed, e.g. a canary user.")
+	f.DurationVar(&cfg.IdleTimeout, "alertmanager.idle-timeout", 0, "Stop the alertmanager of a user without alerts and API traffic for this long, and rebuild it on first use. Disabled if 0.")
+	f.IntVar(&cfg.ApplyConcurrency, "alertmanager.configs.apply-concurrency", 8, "How many users alertmanager configs are applied concurrently.")
+	f.Int64Var(&cfg.ConfigsPageSize, "alertmanager.configs.page-size", 500, "How many users alertmanager configs are loaded at once at startup and on resync.")
+
+	f.DurationVar(&cfg.StatePersistInterval, "alertmanager.state.persist-interval", 15*time.Minute, "How frequently to upload silences and notification logs to object storage.")
+	f.DurationVar(&cfg.DrainTimeout, "alertmanager.shutdown.drain-timeout", 20*time.Second, "How long to wait for the notifications of the alert groups still waiting for group_wait, and for in-flight notifications, on shutdown after new alerts are rejected. The state is snapshotted afterwards.")
+	f.DurationVar(&cfg.ServerShutdownTimeout, "alertmanager.shutdown.server-timeout", 5*time.Second, "How long to wait for in-flight API requests on shutdown, after draining.")
+
+	f.BoolVar(&cfg.LeaderElection, "alertmanager.leader-election.enabled", false, "Elect a leader through Etcd which alone sends notifications, while the other replicas proxy the requests of users to it. An alternative to deduplicating notifications through the gossip cluster.")
+	f.DurationVar(&cfg.LeaderLeaseTTL, "alertmanager.leader-election.lease-ttl", 15*time.Second, "TTL of the lease of the leader, after which another replica takes over if the leader is gone.")
+	f.StringVar(&cfg.LeaderAdvertiseURL, "alertmanager.leader-election.advertise-url", "", "URL the other replicas proxy requests to while this replica is the leader.")
+
+	f.StringSliceVar(&cfg.EgressAllowedCIDRs, "alertmanager.egress.allowed-cidrs", nil, "If set, notifications are only sent to addresses in these CIDRs or to the allowed hosts. Link-local and cloud metadata addresses are blocked unless listed here.")
+	f.StringSliceVar(&cfg.EgressAllowedHosts, "alertmanager.egress.allowed-hosts", nil, "If set, notifications are only sent to these hosts or to the allowed CIDRs. A leading \"*.\" allows all subdomains.")
+	f.BoolVar(&cfg.EgressDenyPrivate, "alertmanager.egress.deny-private", true, "Block notifications to loopback and private network addresses. Addresses in alertmanager.egress.allowed-cidrs are reachable regardless.")
+	f.IntVar(&cfg.EgressMaxConcurrent, "alertmanager.egress.max-concurrent", 0, "Outbound requests of the notifiers in flight. Excess requests wait until their notification times out. Unbounded if 0.")
+	f.IntVar(&cfg.EgressMaxConcurrentPerHost, "alertmanager.egress.max-concurrent-per-host", 0, "Outbound requests of the notifiers in flight to a single destination host, so that a slow service does not hold all connections. Unbounded if 0.")
+	f.StringSliceVar(&cfg.ExecAllowedCommands, "alertmanager.exec.allowed-commands", nil, "Commands exec receivers may run on this host, each an absolute path followed by the space separated arguments it is run with. Receivers may only append arguments to the commands ending with a * argument. Exec receivers are rejected if empty.")
+	f.DurationVar(&cfg.ExecMaxTimeout, "alertmanager.exec.max-timeout", time.Minute, "Maximum timeout of the exec receivers. 0 leaves it uncapped.")
+	f.BoolVar(&cfg.AWSAllowAmbientCredentials, "alertmanager.aws.allow-ambient-credentials", false, "Let the SNS and SQS receivers without access_key use the AWS credentials of the Alertmanager (environment, IRSA, ECS task role, EC2 instance role) as is.")
+	f.StringSliceVar(&cfg.AWSAllowedRoleARNs, "alertmanager.aws.allowed-role-arns", nil, "Roles the SNS and SQS receivers without access_key may assume with the AWS credentials of the Alertmanager.")
+
+	f.DurationVar(&cfg.HTTPClientTimeout, "alertmanager.http-client.timeout", 0, "Timeout of the requests of the notifiers, including reading the response. Bounded by the notification timeout only if 0.")
+	f.DurationVar(&cfg.HTTPClientDialTimeout, "alertmanager.http-client.dial-timeout", 30*time.Second, "Timeout of the notifiers for establishing connections.")
+	f.DurationVar(&cfg.HTTPClientTLSHandshakeTimeout, "alertmanager.http-client.tls-handshake-timeout", 10*time.Second, "Timeout of the notifiers for TLS handshakes.")
+	f.DurationVar(&cfg.HTTPClientIdleConnTimeout, "alertmanager.http-client.idle-conn-timeout", 5*time.Minute, "How long the notifiers keep idle connections open.")
+	f.IntVar(&cfg.HTTPClientMaxIdleConns, "alertmanager.http-client.max-idle-conns", 0, "Idle connections a notifier keeps open. Unbounded if 0.")
+	f.IntVar(&cfg.HTTPClientMaxIdleConnsPerHost, "alertmanager.http-client.max-idle-conns-per-host", 0, "Idle connections a notifier keeps open per host. Go's default of 2 if 0.")
+	f.StringVar(&cfg.HTTPClientTLSMinVersion, "alertmanager.http-client.tls-min-version", "", "Minimum TLS version of the notifiers. One of: TLS10|TLS11|TLS12|TLS13. Go's default if empty.")
+	f.StringVar(&cfg.HTTPClientProxyURL, "alertmanager.http-client.proxy-url", "", "Proxy of the notifiers without a proxy in their http_config.")
+
+	f.StringVar(&cfg.UIPathPrefix, "alertmanager.ui.path-prefix", "", "Path to serve the Alertmanager UI of the user authenticated by a proxy at. The UI is not served if empty.")
+	f.StringVar(&cfg.UIUserHeader, "alertmanager.ui.user-header", "X-Forwarded-User", "Header holding the user ID set by the proxy authenticating UI requests.")
+
+	f.StringVar(&cfg.AdminAuthMode, "alertmanager.admin.auth-mode", AdminAuthNone, "Authentication of the admin API, which is not scoped to a user. One of: none|token")
+	f.BoolVar(&cfg.AdminAllowUnauthenticated, "alertmanager.admin.insecure-allow-unauthenticated", false, "Acknowledge the none admin auth mode. The admin API is served on the API port, so it must then be made unreachable for users by other means. The none mode is deprecated without this flag.")
+	f.StringVar(&cfg.AdminTokenFile, "alertmanager.admin.token-file", "", "File holding the bearer token of the admin API, if the token auth mode is used.")
+
+	f.StringVar(&cfg.GlobalInhibitRulesFile, "alertmanager.inhibit.global-rules-file", "", "File holding inhibition rules applied to all users, in addition to their own rules and to the rules set through the admin API.")
+	f.StringVar(&cfg.RoutingPoliciesFile, "alertmanager.routing-policies-file", "", "File holding the routing policies the configs of all users must comply with, e.g. requiring critical alerts to reach a paging integration. Checked when configs are set.")
+	f.StringVar(&cfg.LimitOverridesFile, "alertmanager.limits.overrides-file", "", "File holding the dispatch and data directory limits of the users selected by their labels, e.g. raising the limits of the premium plan. The first matching override applies.")
+	f.StringSliceVar(&cfg.DefaultFeatures, "alertmanager.features.default", notify.Features, "Feature flags enabled for the users without feature overrides, set through the admin API. Features are rolled out to a subset of users first by leaving them out here and enabling them for those users. Known features: "+strings.Join(notify.Features, ", ")+".")
+	f.StringVar(&cfg.TenantSelector, "alertmanager.tenant-selector", "", "Labels of the users this replica runs, like plan=premium or plan!=premium, to pin users to dedicated replicas. The requests of users must be routed to their replicas. All users if empty.")
+
+	f.BoolVar(&cfg.HistoryEnabled, "alertmanager.history.enabled", false, "Archive the resolved alert groups in Etcd once notified, to serve them through /api/v1/alerts/history. They are kept for --etcd.history-retention.")
 
 	f.StringVar(&cfg.ClusterBindAddr, "cluster.listen-address", "0.0.0.0:9094", "Listen address for cluster.")
 	f.StringVar(&cfg.ClusterAdvertiseAddr, "cluster.advertise-address", "", "Explicit address to advertise in cluster.")
 	f.StringArrayVar(&cfg.Peers, "cluster.peer", []string{}, "Initial peers (may be repeated).")
-	f.DurationVar(&cfg.PeerTimeout, "cluster.peer-timeout", 15*time.Second, "Time to wait between peers to send notifications.")
+	f.StringVar(&cfg.PeerDiscovery, "cluster.peer-discovery", PeerDiscoveryStatic, "How to find the peers in addition to cluster.peer. One of: static|dns|kubernetes")
+	f.StringVar(&cfg.PeerDiscoveryDNSName, "cluster.peer-discovery.dns-name", "", "SRV record listing the peers, with the dns peer discovery.")
+	f.StringVar(&cfg.PeerDiscoveryEndpoints, "cluster.peer-discovery.endpoints", "", "Kubernetes Endpoints object, as [namespace/]name, listing the peers with the kubernetes peer discovery. The namespace defaults to the POD_NAMESPACE env.")
+	f.StringVar(&cfg.PeerDiscoveryPortName, "cluster.peer-discovery.port-name", "", "Name of the cluster port in the Endpoints object. The port of cluster.listen-address is used if empty or not found.")
+	f.DurationVar(&cfg.PeerDiscoveryTimeout, "cluster.peer-discovery.timeout", 30*time.Second, "How long to retry peer discovery at startup until another peer is found.")
+	f.DurationVar(&cfg.PeerTimeout, "cluster.peer-timeout", 15*time.Second, "Time to wait between peers to send notifications. With the zone peer wait, the time to wait between zones.")
+	f.StringVar(&cfg.PeerWait, "cluster.peer-wait", PeerWaitPosition, "How the replicas are ordered to send notifications. One of: position|zone. With zone, the replicas of the zone of a failed replica take over first.")
+	f.StringVar(&cfg.Zone, "cluster.zone", "", "Zone of this replica, with the zone peer wait.")
+	f.DurationVar(&cfg.ZonePeerTimeout, "cluster.zone-peer-timeout", 5*time.Second, "Time to wait between peers of the same zone to send notifications, with the zone peer wait.")
 	f.DurationVar(&cfg.GossipInterval, "cluster.gossip-interval", cluster.DefaultGossipInterval, "Interval between sending gossip messages. By lowering this value (more frequent) gossip messages are propagated across the cluster more quickly at the expense of increased bandwidth.")
 	f.DurationVar(&cfg.PushPullInterval, "cluster.pushpull-interval", cluster.DefaultPushPullInterval, "Interval for gossip state syncs. Setting this interval lower (more frequent) will increase convergence speeds across larger clusters at the expense of increased bandwidth usage.")
 	f.DurationVar(&cfg.TcpTimeout, "cluster.tcp-timeout", cluster.DefaultTcpTimeout, "Timeout for establishing a stream connection with a remote node for a full state sync, and for stream read and write operations.")
@@ -59,5 +280,207 @@ func (cfg *MultitenantAlertmanagerConfig) AddFlags(f *pflag.FlagSet) {
 }
 
 func (c *MultitenantAlertmanagerConfig) Validate() error {
+	if _, err := notify.ParseCIDRs(c.EgressAllowedCIDRs); err != nil {
+		return errors.Wrap(err, "invalid alertmanager.egress.allowed-cidrs")
+	}
+	if c.EgressMaxConcurrent < 0 || c.EgressMaxConcurrentPerHost < 0 {
+		return errors.New("alertmanager.egress.max-concurrent and alertmanager.egress.max-concurrent-per-host must not be negative")
+	}
+	if _, err := c.httpClientDefaults(); err != nil {
+		return err
+	}
+	if c.ApplyConcurrency <= 0 {
+		return errors.New("alertmanager.configs.apply-concurrency must be positive")
+	}
+	if c.AlertGCInterval <= 0 {
+		return errors.New("alertmanager.alerts.gc-interval must be positive")
+	}
+	for _, b := range []struct {
+		name     string
+		min, max time.Duration
+	}{
+		{"alertmanager.storage.retention", c.MinRetention, c.MaxRetention},
+		{"alertmanager.alerts.gc-interval", c.MinAlertGCInterval, c.MaxAlertGCInterval},
+	} {
+		if b.min < 0 || b.max < 0 {
+			return errors.Errorf("%s bounds must not be negative", b.name)
+		}
+		if b.max > 0 && b.min > b.max {
+			return errors.Errorf("%s.min must not exceed %s.max", b.name, b.name)
+		}
+	}
+	if c.UserDiskLimit < 0 {
+		return errors.New("alertmanager.storage.user-limit-bytes must not be negative")
+	}
+	if c.MaxAlertsPerUser < 0 || c.MaxGroupsPerUser < 0 {
+		return errors.New("alertmanager.limits.max-alerts and alertmanager.limits.max-groups must not be negative")
+	}
+	for _, cmd := range c.ExecAllowedCommands {
+		if fields := strings.Fields(cmd); len(fields) == 0 || !filepath.IsAbs(fields[0]) {
+			return errors.Errorf("alertmanager.exec.allowed-commands: %q is not an absolute path", cmd)
+		}
+	}
+	if c.ExecMaxTimeout < 0 {
+		return errors.New("alertmanager.exec.max-timeout must not be negative")
+	}
+	if c.SyntheticProbeInterval < 0 {
+		return errors.New("alertmanager.synthetic-probe.interval must not be negative")
+	}
+	if c.SyntheticProbeInterval > 0 && c.SyntheticProbeTimeout <= 0 {
+		return errors.New("alertmanager.synthetic-probe.timeout must be positive")
+	}
+	if c.DiskUsageInterval <= 0 {
+		return errors.New("alertmanager.storage.usage-interval must be positive")
+	}
+	if c.ConfigsPageSize <= 0 {
+		return errors.New("alertmanager.configs.page-size must be positive")
+	}
+	if c.ResyncInterval <= 0 {
+		return errors.New("alertmanager.configs.resync-interval must be positive")
+	}
+	if c.LeaderElection {
+		u, err := url.Parse(c.LeaderAdvertiseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("alertmanager.leader-election.advertise-url must be an http(s) URL with leader election enabled")
+		}
+		if c.LeaderLeaseTTL < time.Second {
+			return errors.New("alertmanager.leader-election.lease-ttl must be at least 1s")
+		}
+	}
+	switch c.PeerDiscovery {
+	case PeerDiscoveryStatic:
+	case PeerDiscoveryDNS:
+		if c.PeerDiscoveryDNSName == "" {
+			return errors.New("cluster.peer-discovery.dns-name must be set with the dns peer discovery")
+		}
+	case PeerDiscoveryKubernetes:
+		if c.PeerDiscoveryEndpoints == "" {
+			return errors.New("cluster.peer-discovery.endpoints must be set with the kubernetes peer discovery")
+		}
+	default:
+		return errors.Errorf("unknown cluster.peer-discovery %q", c.PeerDiscovery)
+	}
+	switch c.PeerWait {
+	case PeerWaitPosition:
+	case PeerWaitZone:
+		if c.Zone == "" {
+			return errors.New("cluster.zone must be set with the zone peer wait")
+		}
+	default:
+		return errors.Errorf("unknown cluster.peer-wait %q", c.PeerWait)
+	}
+	if c.ReplicaName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "failed to get hostname, alertmanager.replica-name must be set")
+		}
+		c.ReplicaName = hostname
+	}
+	if c.UIPathPrefix != "" {
+		if c.UIUserHeader == "" {
+			return errors.New("alertmanager.ui.user-header must be set to serve the UI")
+		}
+		uiPath := "/" + strings.Trim(c.UIPathPrefix, "/")
+		amPath := "/" + strings.Trim(c.PathPrefix, "/")
+		if uiPath == "/" || strings.HasPrefix(uiPath+"/", amPath+"/") || strings.HasPrefix(amPath+"/", uiPath+"/") {
+			return errors.New("alertmanager.ui.path-prefix must not overlap with alertmanager.path-prefix")
+		}
+	}
+	switch c.AdminAuthMode {
+	case AdminAuthNone:
+	case AdminAuthToken:
+		if c.AdminTokenFile == "" {
+			return errors.New("alertmanager.admin.token-file must be set with the token auth mode")
+		}
+		data, err := ioutil.ReadFile(c.AdminTokenFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read alertmanager.admin.token-file")
+		}
+		c.adminToken = strings.TrimSpace(string(data))
+		if c.adminToken == "" {
+			return errors.New("alertmanager.admin.token-file is empty")
+		}
+	default:
+		return errors.Errorf("unknown alertmanager.admin.auth-mode %q", c.AdminAuthMode)
+	}
+	if c.GlobalInhibitRulesFile != "" {
+		data, err := ioutil.ReadFile(c.GlobalInhibitRulesFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read alertmanager.inhibit.global-rules-file")
+		}
+		c.globalInhibitRules, err = loadInhibitRules(string(data))
+		if err != nil {
+			return errors.Wrap(err, "invalid alertmanager.inhibit.global-rules-file")
+		}
+	}
+	if c.LimitOverridesFile != "" {
+		data, err := ioutil.ReadFile(c.LimitOverridesFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read alertmanager.limits.overrides-file")
+		}
+		c.limitOverrides, err = loadLimitOverrides(string(data))
+		if err != nil {
+			return errors.Wrap(err, "invalid alertmanager.limits.overrides-file")
+		}
+	}
+	var err error
+	if c.tenantSelector, err = ParseTenantSelector(c.TenantSelector); err != nil {
+		return errors.Wrap(err, "invalid alertmanager.tenant-selector")
+	}
+	if err := validateFeatures(c.DefaultFeatures); err != nil {
+		return errors.Wrap(err, "invalid alertmanager.features.default")
+	}
+	c.defaultFeatures = map[string]bool{}
+	for _, f := range c.DefaultFeatures {
+		c.defaultFeatures[f] = true
+	}
+	if c.RoutingPoliciesFile != "" {
+		data, err := ioutil.ReadFile(c.RoutingPoliciesFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read alertmanager.routing-policies-file")
+		}
+		c.routingPolicies, err = loadRoutingPolicies(string(data))
+		if err != nil {
+			return errors.Wrap(err, "invalid alertmanager.routing-policies-file")
+		}
+	}
 	return nil
 }
+
+// egressPolicy returns the egress policy of the notifications.
+func (c *MultitenantAlertmanagerConfig) egressPolicy() (*notify.EgressPolicy, error) {
+	cidrs, err := notify.ParseCIDRs(c.EgressAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	return &notify.EgressPolicy{
+		AllowedCIDRs: cidrs,
+		AllowedHosts: c.EgressAllowedHosts,
+		DenyPrivate:  c.EgressDenyPrivate,
+	}, nil
+}
+
+// httpClientDefaults returns the defaults of the HTTP clients of the
+// notifiers.
+func (c *MultitenantAlertmanagerConfig) httpClientDefaults() (notify.HTTPClientSettings, error) {
+	s := notify.HTTPClientSettings{
+		Timeout:             model.Duration(c.HTTPClientTimeout),
+		DialTimeout:         model.Duration(c.HTTPClientDialTimeout),
+		TLSHandshakeTimeout: model.Duration(c.HTTPClientTLSHandshakeTimeout),
+		IdleConnTimeout:     model.Duration(c.HTTPClientIdleConnTimeout),
+		MaxIdleConns:        c.HTTPClientMaxIdleConns,
+		MaxIdleConnsPerHost: c.HTTPClientMaxIdleConnsPerHost,
+		TLSMinVersion:       c.HTTPClientTLSMinVersion,
+	}
+	if c.HTTPClientProxyURL != "" {
+		u, err := url.Parse(c.HTTPClientProxyURL)
+		if err != nil || u.Host == "" {
+			return s, errors.New("invalid alertmanager.http-client.proxy-url")
+		}
+		s.ProxyURL = &config.URL{URL: u}
+	}
+	if err := s.Validate(); err != nil {
+		return s, errors.Wrap(err, "invalid alertmanager.http-client flags")
+	}
+	return s, nil
+}
@@ -0,0 +1,248 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// cortexConfigPath is the path of the Alertmanager config API of Cortex and
+// Mimir.
+const cortexConfigPath = "/api/v1/alerts"
+
+// cortexMaxResponseSize limits the configs read from Cortex.
+const cortexMaxResponseSize = 16 << 20
+
+var (
+	// cortexTopLevelKeys are the top level config fields Cortex supports.
+	cortexTopLevelKeys = map[string]bool{
+		"global":              true,
+		"route":               true,
+		"inhibit_rules":       true,
+		"receivers":           true,
+		"templates":           true,
+		"mute_time_intervals": true,
+		"time_intervals":      true,
+	}
+	// cortexReceiverKeys are the receiver fields Cortex supports.
+	cortexReceiverKeys = map[string]bool{
+		"name":              true,
+		"discord_configs":   true,
+		"email_configs":     true,
+		"msteams_configs":   true,
+		"opsgenie_configs":  true,
+		"pagerduty_configs": true,
+		"pushover_configs":  true,
+		"slack_configs":     true,
+		"sns_configs":       true,
+		"telegram_configs":  true,
+		"victorops_configs": true,
+		"webex_configs":     true,
+		"webhook_configs":   true,
+		"wechat_configs":    true,
+	}
+)
+
+// CortexUserConfig is the config of a tenant in the Alertmanager config API
+// of Cortex and Mimir.
+type CortexUserConfig struct {
+	TemplateFiles      map[string]string `yaml:"template_files"`
+	AlertmanagerConfig string            `yaml:"alertmanager_config"`
+}
+
+// CortexClient reads and writes the configs of a tenant with the
+// Alertmanager config API of Cortex or Mimir.
+type CortexClient struct {
+	Address  *url.URL
+	TenantID string
+	// Username and Password are sent with basic authentication if the
+	// username is set.
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// GetConfig returns the config of the tenant, or nil if it has none.
+func (c *CortexClient) GetConfig(ctx context.Context) (*CortexUserConfig, error) {
+	resp, err := c.do(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, cortexMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status code %d from Cortex: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var cfg CortexUserConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "invalid config from Cortex")
+	}
+	return &cfg, nil
+}
+
+// SetConfig replaces the config of the tenant.
+func (c *CortexClient) SetConfig(ctx context.Context, cfg *CortexUserConfig) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, cortexMaxResponseSize))
+		return errors.Errorf("unexpected status code %d from Cortex: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (c *CortexClient) do(ctx context.Context, method string, body []byte) (*http.Response, error) {
+	u := *c.Address
+	u.Path = strings.TrimSuffix(u.Path, "/") + cortexConfigPath
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Scope-OrgID", c.TenantID)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	hc := c.Client
+	if hc == nil {
+		hc = &http.Client{Timeout: time.Minute}
+	}
+	return hc.Do(req)
+}
+
+// ImportCortex stores the config of the Cortex tenant as the config of the
+// user. An existing config of the user is only replaced if overwrite is set.
+func ImportCortex(ctx context.Context, c AlertmanagerClient, cortex *CortexClient, userID string, overwrite bool) (*AlertmanagerConfig, error) {
+	if userID == "" || strings.Contains(userID, "/") {
+		return nil, errors.Errorf("invalid user id %q", userID)
+	}
+	cc, err := cortex.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cc == nil || cc.AlertmanagerConfig == "" {
+		return nil, errors.Errorf("Cortex tenant %s has no config", cortex.TenantID)
+	}
+	if err := validateAlertmanagerConfig(cc.AlertmanagerConfig); err != nil {
+		return nil, errors.Wrap(err, "invalid Alertmanager config")
+	}
+	if err := validateTemplateFiles(cc.TemplateFiles); err != nil {
+		return nil, errors.Wrap(err, "invalid templates")
+	}
+	if !overwrite {
+		existing, err := c.GetConfig(ctx, userID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get config of user %s", userID)
+		}
+		if existing.UserID != "" {
+			return nil, errors.Errorf("user %s already has a config", userID)
+		}
+	}
+
+	cfg := &AlertmanagerConfig{
+		UserID:          userID,
+		Config:          cc.AlertmanagerConfig,
+		TemplateFiles:   cc.TemplateFiles,
+		UpdatedAtInUnix: time.Now().Unix(),
+	}
+	if err := c.SetConfig(ctx, cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to store config of user %s", userID)
+	}
+	return cfg, nil
+}
+
+// ExportCortex stores the config of the user as the config of the Cortex
+// tenant. Configs using extensions which Cortex does not support, or
+// references to secrets, are rejected.
+func ExportCortex(ctx context.Context, c AlertmanagerClient, cortex *CortexClient, userID string) (*CortexUserConfig, error) {
+	cfg, err := c.GetConfig(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get config of user %s", userID)
+	}
+	if cfg.Config == "" {
+		return nil, errors.Errorf("user %s has no config", userID)
+	}
+	if err := checkCortexCompatible(cfg.Config); err != nil {
+		return nil, err
+	}
+	cc := &CortexUserConfig{
+		TemplateFiles:      cfg.TemplateFiles,
+		AlertmanagerConfig: cfg.Config,
+	}
+	if err := cortex.SetConfig(ctx, cc); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// checkCortexCompatible returns an error listing the fields of cfg which
+// Cortex does not support. The fields of the integrations are checked by
+// Cortex when the config is stored.
+func checkCortexCompatible(cfg string) error {
+	if secrets.Mask(cfg) != cfg {
+		return errors.New("the config references secrets, which Cortex can not resolve")
+	}
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg), &raw); err != nil {
+		return err
+	}
+	var unsupported []string
+	for _, item := range raw {
+		key := fmt.Sprint(item.Key)
+		if !cortexTopLevelKeys[key] {
+			unsupported = append(unsupported, key)
+			continue
+		}
+		if key != "receivers" {
+			continue
+		}
+		receivers, _ := item.Value.([]interface{})
+		for _, r := range receivers {
+			rcv, _ := r.(yaml.MapSlice)
+			var name string
+			var fields []string
+			for _, f := range rcv {
+				k := fmt.Sprint(f.Key)
+				if k == "name" {
+					name = fmt.Sprint(f.Value)
+				} else if !cortexReceiverKeys[k] {
+					fields = append(fields, k)
+				}
+			}
+			for _, k := range fields {
+				unsupported = append(unsupported, fmt.Sprintf("receivers[%s].%s", name, k))
+			}
+		}
+	}
+	if len(unsupported) > 0 {
+		return errors.Errorf("the config uses fields Cortex does not support: %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package alertmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCortexClient(t *testing.T) {
+	stored := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prometheus/api/v1/alerts" {
+			http.NotFound(w, r)
+			return
+		}
+		tenant := r.Header.Get("X-Scope-OrgID")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := stored[tenant]
+			if !ok {
+				http.Error(w, "alertmanager config not found", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		case http.MethodPost:
+			data, _ := ioutil.ReadAll(r.Body)
+			stored[tenant] = data
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/prometheus")
+	c := &CortexClient{Address: u, TenantID: "team1"}
+	ctx := context.Background()
+
+	cfg, err := c.GetConfig(ctx)
+	if err != nil || cfg != nil {
+		t.Fatalf("got config %v and error %v, want none", cfg, err)
+	}
+	want := &CortexUserConfig{
+		TemplateFiles:      map[string]string{"a.tmpl": `{{ define "a" }}a{{ end }}`},
+		AlertmanagerConfig: "route:\n  receiver: team\nreceivers:\n- name: team\n",
+	}
+	if err := c.SetConfig(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = c.GetConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got config %+v, want %+v", cfg, want)
+	}
+}
+
+func TestCheckCortexCompatible(t *testing.T) {
+	for _, tc := range []struct {
+		cfg string
+		err string
+	}{
+		{
+			cfg: `
+route:
+  receiver: team
+receivers:
+- name: team
+  slack_configs:
+  - api_url: https://hooks.slack.com/services/x
+`,
+		},
+		{
+			cfg: `
+route:
+  receiver: team
+receivers:
+- name: team
+  slack_configs:
+  - api_url: vault:kv/team#slack_url
+`,
+			err: "references secrets",
+		},
+		{
+			cfg: `
+heartbeats: []
+route:
+  receiver: team
+receivers:
+- name: team
+  kafka_configs: []
+  escalations: []
+`,
+			err: "heartbeats, receivers[team].kafka_configs, receivers[team].escalations",
+		},
+	} {
+		err := checkCortexCompatible(tc.cfg)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("got error %v, want %q", err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package alertmanager
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/dispatch"
+	"gopkg.in/yaml.v2"
+)
+
+// Kinds of the changes in a config diff.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// ConfigDiff is the semantic difference between the stored config of a user
+// and a proposed one. Routes are identified by their route key, receivers
+// and template files by their name.
+type ConfigDiff struct {
+	Routes              []RouteDiff    `json:"routes"`
+	Receivers           []ReceiverDiff `json:"receivers"`
+	Global              []FieldChange  `json:"global"`
+	InhibitRulesChanged bool           `json:"inhibitRulesChanged"`
+	Templates           []TemplateDiff `json:"templates"`
+}
+
+// RouteDiff is a route added, removed or changed. The receiver is the one of
+// the proposed config, unless the route is removed.
+type RouteDiff struct {
+	RouteKey string        `json:"routeKey"`
+	Receiver string        `json:"receiver"`
+	Change   string        `json:"change"`
+	Fields   []FieldChange `json:"fields,omitempty"`
+}
+
+// ReceiverDiff is a receiver added, removed or changed.
+type ReceiverDiff struct {
+	Name           string        `json:"name"`
+	Change         string        `json:"change"`
+	Fields         []FieldChange `json:"fields,omitempty"`
+	SecretsChanged bool          `json:"secretsChanged,omitempty"`
+}
+
+// FieldChange is a changed field, like slack_configs[0].channel. The values
+// of secrets are never returned.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// TemplateDiff is a template file added, removed or changed.
+type TemplateDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// diffFields holds the flattened fields of a config section, and which of
+// them are secrets.
+type diffFields struct {
+	values  map[string]string
+	secrets map[string]bool
+}
+
+// configSections holds the parts of a config which are diffed.
+type configSections struct {
+	routeKeys      []string
+	routes         map[string]diffFields
+	receivers      []string
+	receiverFields map[string]diffFields
+	global         diffFields
+	inhibitRules   string
+}
+
+// diffConfigs returns the diff of the valid configs old and new. old is
+// empty if no config is stored.
+func diffConfigs(old, new *AlertmanagerConfig) (*ConfigDiff, error) {
+	o, err := loadConfigSections(old.Config)
+	if err != nil {
+		return nil, err
+	}
+	n, err := loadConfigSections(new.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ConfigDiff{
+		Routes:              []RouteDiff{},
+		Receivers:           []ReceiverDiff{},
+		Global:              changedFields(o.global, n.global),
+		InhibitRulesChanged: o.inhibitRules != n.inhibitRules,
+		Templates:           []TemplateDiff{},
+	}
+
+	for _, key := range n.routeKeys {
+		nr := n.routes[key]
+		or, ok := o.routes[key]
+		switch {
+		case !ok:
+			d.Routes = append(d.Routes, RouteDiff{RouteKey: key, Receiver: nr.values["receiver"], Change: DiffAdded})
+		default:
+			if fields := changedFields(or, nr); len(fields) > 0 {
+				d.Routes = append(d.Routes, RouteDiff{RouteKey: key, Receiver: nr.values["receiver"], Change: DiffChanged, Fields: fields})
+			}
+		}
+	}
+	for _, key := range o.routeKeys {
+		if _, ok := n.routes[key]; !ok {
+			d.Routes = append(d.Routes, RouteDiff{RouteKey: key, Receiver: o.routes[key].values["receiver"], Change: DiffRemoved})
+		}
+	}
+
+	for _, name := range n.receivers {
+		or, ok := o.receiverFields[name]
+		if !ok {
+			d.Receivers = append(d.Receivers, ReceiverDiff{Name: name, Change: DiffAdded})
+			continue
+		}
+		fields := changedFields(or, n.receiverFields[name])
+		if len(fields) == 0 {
+			continue
+		}
+		rd := ReceiverDiff{Name: name, Change: DiffChanged, Fields: fields}
+		for _, f := range fields {
+			rd.SecretsChanged = rd.SecretsChanged || f.Secret
+		}
+		d.Receivers = append(d.Receivers, rd)
+	}
+	for _, name := range o.receivers {
+		if _, ok := n.receiverFields[name]; !ok {
+			d.Receivers = append(d.Receivers, ReceiverDiff{Name: name, Change: DiffRemoved})
+		}
+	}
+
+	var templates []string
+	for name := range new.TemplateFiles {
+		templates = append(templates, name)
+	}
+	for name := range old.TemplateFiles {
+		if _, ok := new.TemplateFiles[name]; !ok {
+			templates = append(templates, name)
+		}
+	}
+	sort.Strings(templates)
+	for _, name := range templates {
+		oc, inOld := old.TemplateFiles[name]
+		nc, inNew := new.TemplateFiles[name]
+		switch {
+		case !inOld:
+			d.Templates = append(d.Templates, TemplateDiff{Name: name, Change: DiffAdded})
+		case !inNew:
+			d.Templates = append(d.Templates, TemplateDiff{Name: name, Change: DiffRemoved})
+		case oc != nc:
+			d.Templates = append(d.Templates, TemplateDiff{Name: name, Change: DiffChanged})
+		}
+	}
+	return d, nil
+}
+
+// loadConfigSections flattens the routes, receivers and global section of
+// cfg. The secrets are found by redacting cfg.
+func loadConfigSections(cfg string) (*configSections, error) {
+	s := &configSections{
+		routes:         map[string]diffFields{},
+		receiverFields: map[string]diffFields{},
+		global:         diffFields{values: map[string]string{}, secrets: map[string]bool{}},
+	}
+	if cfg == "" {
+		return s, nil
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	// Sibling routes with the same matchers have the same key, the later
+	// ones are numbered.
+	seen := map[string]int{}
+	var walk func(cr *config.Route, dr *dispatch.Route) error
+	walk = func(cr *config.Route, dr *dispatch.Route) error {
+		key := dr.Key()
+		if seen[key]++; seen[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, seen[key])
+		}
+		own := *cr
+		own.Routes = nil
+		data, err := yaml.Marshal(&own)
+		if err != nil {
+			return err
+		}
+		var raw yaml.MapSlice
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		f := diffFields{values: map[string]string{}, secrets: map[string]bool{}}
+		flattenYAML("", raw, f.values)
+		s.routeKeys = append(s.routeKeys, key)
+		s.routes[key] = f
+		for i := range cr.Routes {
+			if err := walk(cr.Routes[i], dr.Routes[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(conf.Route, dispatch.NewRoute(conf.Route, nil)); err != nil {
+		return nil, err
+	}
+
+	inhibitRules, err := yaml.Marshal(conf.InhibitRules)
+	if err != nil {
+		return nil, err
+	}
+	s.inhibitRules = string(inhibitRules)
+
+	redacted, err := redactConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := configItems(cfg)
+	if err != nil {
+		return nil, err
+	}
+	masked, err := configItems(redacted)
+	if err != nil {
+		return nil, err
+	}
+
+	s.global = sectionFields(raw["global"], masked["global"])
+	receivers, _ := raw["receivers"].([]interface{})
+	maskedReceivers, _ := masked["receivers"].([]interface{})
+	for i, r := range receivers {
+		item, ok := r.(yaml.MapSlice)
+		if !ok || i >= len(maskedReceivers) {
+			continue
+		}
+		var name string
+		for _, kv := range item {
+			if kv.Key == "name" {
+				name = fmt.Sprint(kv.Value)
+			}
+		}
+		s.receivers = append(s.receivers, name)
+		s.receiverFields[name] = sectionFields(item, maskedReceivers[i])
+	}
+	return s, nil
+}
+
+// configItems returns the top-level items of the YAML config cfg.
+func configItems(cfg string) (map[string]interface{}, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg), &raw); err != nil {
+		return nil, err
+	}
+	items := make(map[string]interface{}, len(raw))
+	for _, item := range raw {
+		items[fmt.Sprint(item.Key)] = item.Value
+	}
+	return items, nil
+}
+
+// sectionFields flattens the YAML value v. masked is v with its secrets
+// redacted.
+func sectionFields(v, masked interface{}) diffFields {
+	f := diffFields{values: map[string]string{}, secrets: map[string]bool{}}
+	flattenYAML("", v, f.values)
+	m := map[string]string{}
+	flattenYAML("", masked, m)
+	for field, value := range m {
+		if value == redactedSecret && f.values[field] != redactedSecret {
+			f.secrets[field] = true
+		}
+	}
+	delete(f.values, "name")
+	return f
+}
+
+// flattenYAML adds the scalar values of the YAML value v to out, by their
+// path like slack_configs[0].channel.
+func flattenYAML(path string, v interface{}, out map[string]string) {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			key := fmt.Sprint(item.Key)
+			if path != "" {
+				key = path + "." + key
+			}
+			flattenYAML(key, item.Value, out)
+		}
+	case []interface{}:
+		for i, e := range v {
+			flattenYAML(fmt.Sprintf("%s[%d]", path, i), e, out)
+		}
+	case nil:
+	default:
+		out[path] = fmt.Sprint(v)
+	}
+}
+
+// changedFields returns the fields changed from old to new, sorted by path.
+func changedFields(old, new diffFields) []FieldChange {
+	var paths []string
+	for path := range new.values {
+		paths = append(paths, path)
+	}
+	for path := range old.values {
+		if _, ok := new.values[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []FieldChange{}
+	for _, path := range paths {
+		ov, nv := old.values[path], new.values[path]
+		_, inOld := old.values[path]
+		_, inNew := new.values[path]
+		if inOld == inNew && ov == nv {
+			continue
+		}
+		c := FieldChange{Field: path, Old: ov, New: nv}
+		if old.secrets[path] || new.secrets[path] {
+			c = FieldChange{Field: path, Secret: true}
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// diffConfig returns the diff between the stored config of the user and the
+// config of the request, which is validated but not stored.
+func (a *API) diffConfig(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, configOnly, err := decodeAlertmanagerConfig(w, r)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateAlertmanagerConfig(cfg.Config); err != nil {
+		configError(w, cfg.Config, err)
+		return
+	}
+
+	stored, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	// A raw YAML config keeps the stored templates, as in setConfig.
+	if configOnly {
+		cfg.TemplateFiles = stored.TemplateFiles
+	}
+
+	d, err := diffConfigs(&stored, cfg)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error diffing configs", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
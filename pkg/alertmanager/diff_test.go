@@ -0,0 +1,96 @@
+package alertmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old := &AlertmanagerConfig{
+		Config: `
+global:
+  slack_api_url: https://hooks.slack.com/services/old
+route:
+  receiver: team
+  group_by: [alertname]
+  routes:
+  - receiver: pager
+    match:
+      severity: critical
+  - receiver: old
+    match:
+      team: old
+receivers:
+- name: team
+  slack_configs:
+  - channel: '#alerts'
+- name: pager
+  pagerduty_configs:
+  - service_key: secret1
+- name: old
+  webhook_configs:
+  - url: http://example.com/old
+`,
+		TemplateFiles: map[string]string{"a.tmpl": "a", "b.tmpl": "b"},
+	}
+	new := &AlertmanagerConfig{
+		Config: `
+global:
+  slack_api_url: https://hooks.slack.com/services/new
+route:
+  receiver: team
+  group_by: [alertname]
+  routes:
+  - receiver: pager
+    repeat_interval: 2h
+    match:
+      severity: critical
+  - receiver: team
+    match:
+      team: new
+receivers:
+- name: team
+  slack_configs:
+  - channel: '#ops'
+- name: pager
+  pagerduty_configs:
+  - service_key: secret2
+`,
+		TemplateFiles: map[string]string{"a.tmpl": "a2", "c.tmpl": "c"},
+	}
+
+	d, err := diffConfigs(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ConfigDiff{
+		Routes: []RouteDiff{
+			{RouteKey: `{}/{severity="critical"}`, Receiver: "pager", Change: DiffChanged, Fields: []FieldChange{{Field: "repeat_interval", New: "2h"}}},
+			{RouteKey: `{}/{team="new"}`, Receiver: "team", Change: DiffAdded},
+			{RouteKey: `{}/{team="old"}`, Receiver: "old", Change: DiffRemoved},
+		},
+		Receivers: []ReceiverDiff{
+			{Name: "team", Change: DiffChanged, Fields: []FieldChange{{Field: "slack_configs[0].channel", Old: "#alerts", New: "#ops"}}},
+			{Name: "pager", Change: DiffChanged, Fields: []FieldChange{{Field: "pagerduty_configs[0].service_key", Secret: true}}, SecretsChanged: true},
+			{Name: "old", Change: DiffRemoved},
+		},
+		Global: []FieldChange{{Field: "slack_api_url", Secret: true}},
+		Templates: []TemplateDiff{
+			{Name: "a.tmpl", Change: DiffChanged},
+			{Name: "b.tmpl", Change: DiffRemoved},
+			{Name: "c.tmpl", Change: DiffAdded},
+		},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got diff %+v, want %+v", d, want)
+	}
+
+	// Without a stored config, everything is added.
+	d, err = diffConfigs(&AlertmanagerConfig{}, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Routes) != 3 || len(d.Receivers) != 2 || d.Routes[0].Change != DiffAdded {
+		t.Errorf("got diff %+v, want all routes and receivers added", d)
+	}
+}
@@ -1,11 +1,19 @@
 package alertmanager
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 )
 
@@ -14,6 +22,19 @@ const (
 	PodNamespaceEnv = "POD_NAMESPACE"
 )
 
+const (
+	// PeerDiscoveryStatic uses the peers given with cluster.peer only.
+	PeerDiscoveryStatic = "static"
+	// PeerDiscoveryDNS resolves the peers from a DNS SRV record.
+	PeerDiscoveryDNS = "dns"
+	// PeerDiscoveryKubernetes resolves the peers from the addresses of a
+	// Kubernetes Endpoints object.
+	PeerDiscoveryKubernetes = "kubernetes"
+
+	// Delay between discovery attempts while no other peer was found.
+	peerDiscoveryRetryDelay = 2 * time.Second
+)
+
 func getAdvertiseAddr(cfg *MultitenantAlertmanagerConfig) (string, error) {
 	if cfg.ClusterAdvertiseAddr != "" {
 		return cfg.ClusterAdvertiseAddr, nil
@@ -42,3 +63,157 @@ func getPort(addr string) (int, error) {
 	}
 	return bindPort, nil
 }
+
+// discoverPeers returns the static peers and the peers found by the
+// configured discovery, except for advertiseAddr. It retries until another
+// peer is found or the discovery timeout passed, so that replicas started
+// at the same time find each other instead of forming separate clusters.
+// Peers found by DNS are returned by host name, which the cluster resolves
+// again periodically; replicas started later join by themselves, and the
+// membership is then spread by gossip.
+func discoverPeers(cfg *MultitenantAlertmanagerConfig, advertiseAddr string) ([]string, error) {
+	var discover func(ctx context.Context) ([]string, error)
+	switch cfg.PeerDiscovery {
+	case PeerDiscoveryStatic:
+		return cfg.Peers, nil
+	case PeerDiscoveryDNS:
+		discover = func(ctx context.Context) ([]string, error) {
+			return discoverDNSPeers(ctx, cfg.PeerDiscoveryDNSName, advertiseAddr)
+		}
+	case PeerDiscoveryKubernetes:
+		k, err := newKubernetesDiscovery(cfg)
+		if err != nil {
+			return nil, err
+		}
+		discover = k.discover
+	default:
+		return nil, errors.Errorf("unknown cluster.peer-discovery %q", cfg.PeerDiscovery)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.PeerDiscoveryTimeout)
+	defer cancel()
+	for {
+		found, err := discover(ctx)
+		var peers []string
+		for _, p := range found {
+			if p != advertiseAddr {
+				peers = append(peers, p)
+			}
+		}
+		if err == nil && len(peers) > 0 {
+			Must(level.Info(logger.Logger).Log("msg", "discovered cluster peers", "mode", cfg.PeerDiscovery, "peers", strings.Join(peers, ",")))
+			return append(append([]string{}, cfg.Peers...), peers...), nil
+		}
+		if err != nil {
+			Must(level.Warn(logger.Logger).Log("msg", "failed to discover cluster peers", "mode", cfg.PeerDiscovery, "err", err))
+		}
+		select {
+		case <-ctx.Done():
+			Must(level.Warn(logger.Logger).Log("msg", "no cluster peers discovered, starting alone", "mode", cfg.PeerDiscovery))
+			return cfg.Peers, nil
+		case <-time.After(peerDiscoveryRetryDelay):
+		}
+	}
+}
+
+// discoverDNSPeers returns the targets of the SRV record name, except for
+// the target resolving to self.
+func discoverDNSPeers(ctx context.Context, name, self string) ([]string, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up SRV record %s", name)
+	}
+	peers := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		port := strconv.Itoa(int(srv.Port))
+		if isSelf(ctx, host, port, self) {
+			continue
+		}
+		peers = append(peers, net.JoinHostPort(host, port))
+	}
+	return peers, nil
+}
+
+func isSelf(ctx context.Context, host, port, self string) bool {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if net.JoinHostPort(addr, port) == self {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetesDiscovery finds the peers in a Kubernetes Endpoints object.
+type kubernetesDiscovery struct {
+	client   *secrets.KubernetesClient
+	path     string
+	portName string
+	// port is used if the Endpoints have no port named portName.
+	port int
+}
+
+func newKubernetesDiscovery(cfg *MultitenantAlertmanagerConfig) (*kubernetesDiscovery, error) {
+	client, err := secrets.NewKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	ns, name := os.Getenv(PodNamespaceEnv), cfg.PeerDiscoveryEndpoints
+	if i := strings.Index(name, "/"); i >= 0 {
+		ns, name = name[:i], name[i+1:]
+	}
+	if ns == "" {
+		return nil, errors.New("namespace of cluster.peer-discovery.endpoints or POD_NAMESPACE env is not set")
+	}
+	bindPort, err := getPort(cfg.ClusterBindAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid listen address")
+	}
+	return &kubernetesDiscovery{
+		client:   client,
+		path:     fmt.Sprintf("/api/v1/namespaces/%s/endpoints/%s", url.PathEscape(ns), url.PathEscape(name)),
+		portName: cfg.PeerDiscoveryPortName,
+		port:     bindPort,
+	}, nil
+}
+
+// discover returns the ready and not yet ready addresses of the Endpoints,
+// as starting replicas must find each other too.
+func (k *kubernetesDiscovery) discover(ctx context.Context) ([]string, error) {
+	type address struct {
+		IP string `json:"ip"`
+	}
+	var endpoints struct {
+		Subsets []struct {
+			Addresses         []address `json:"addresses"`
+			NotReadyAddresses []address `json:"notReadyAddresses"`
+			Ports             []struct {
+				Name string `json:"name"`
+				Port int    `json:"port"`
+			} `json:"ports"`
+		} `json:"subsets"`
+	}
+	if err := k.client.Get(ctx, k.path, &endpoints); err != nil {
+		return nil, errors.Wrap(err, "failed to get endpoints")
+	}
+
+	var peers []string
+	for _, ss := range endpoints.Subsets {
+		port := k.port
+		for _, p := range ss.Ports {
+			if k.portName != "" && p.Name == k.portName {
+				port = p.Port
+			}
+		}
+		for _, addrs := range [][]address{ss.Addresses, ss.NotReadyAddresses} {
+			for _, a := range addrs {
+				peers = append(peers, net.JoinHostPort(a.IP, strconv.Itoa(port)))
+			}
+		}
+	}
+	return peers, nil
+}
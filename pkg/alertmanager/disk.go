@@ -0,0 +1,379 @@
+package alertmanager
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/golang/protobuf/proto"
+	"github.com/matttproud/golang_protobuf_extensions/pbutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of the data kept for a user in the data directory.
+const (
+	diskUsageTemplates = "templates"
+	diskUsageNflog     = "nflog"
+	diskUsageSilences  = "silences"
+)
+
+// ErrDiskLimitExceeded is returned when the data of a user would exceed the
+// per-user data directory limit.
+var ErrDiskLimitExceeded = errors.New("data directory limit of the user exceeded")
+
+var (
+	diskUsageBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_disk_usage_bytes",
+		Help:      "Bytes used by the templates and state snapshots of a user in the data directory.",
+	}, []string{"user", "kind"})
+	diskLimitTruncations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_disk_limit_truncations_total",
+		Help:      "The total number of times the state of a user was truncated for exceeding the data directory limit.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(diskUsageBytes, diskLimitTruncations)
+}
+
+func nflogSnapshotFile(dataDir, userID string) string {
+	return filepath.Join(dataDir, fmt.Sprintf("nflog:%s", userID))
+}
+
+func silencesSnapshotFile(dataDir, userID string) string {
+	return filepath.Join(dataDir, fmt.Sprintf("silences:%s", userID))
+}
+
+func templatesDir(dataDir, userID string) string {
+	return filepath.Join(dataDir, "templates", userID)
+}
+
+// diskUsage is the bytes used by a user in the data directory by kind.
+type diskUsage map[string]int64
+
+func (u diskUsage) total() int64 {
+	var n int64
+	for _, b := range u {
+		n += b
+	}
+	return n
+}
+
+// diskUsage returns the bytes used by the templates and state snapshots of a
+// user.
+func (am *MultitenantAlertmanager) diskUsage(userID string) diskUsage {
+	u := diskUsage{
+		diskUsageNflog:    fileSize(nflogSnapshotFile(am.cfg.DataDir, userID)),
+		diskUsageSilences: fileSize(silencesSnapshotFile(am.cfg.DataDir, userID)),
+	}
+	_ = filepath.Walk(templatesDir(am.cfg.DataDir, userID), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			u[diskUsageTemplates] += info.Size()
+		}
+		return nil
+	})
+	return u
+}
+
+func fileSize(fn string) int64 {
+	info, err := os.Stat(fn)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// CheckTemplateQuota returns ErrDiskLimitExceeded if the template files of
+// a user with the state snapshots of the user exceed the data directory
+// limit.
+func (am *MultitenantAlertmanager) CheckTemplateQuota(userID string, templateFiles map[string]string) error {
+	limit := am.userDiskLimit(userID)
+	if limit <= 0 {
+		return nil
+	}
+	u := am.diskUsage(userID)
+	n := u[diskUsageNflog] + u[diskUsageSilences]
+	for _, content := range templateFiles {
+		n += int64(len(content))
+	}
+	if n > limit {
+		return errors.Wrapf(ErrDiskLimitExceeded, "%d bytes used of %d", n, limit)
+	}
+	return nil
+}
+
+// checkDiskUsage updates the disk usage metrics of the users, and truncates
+// the state of users exceeding the data directory limit.
+func (am *MultitenantAlertmanager) checkDiskUsage() {
+	am.alertmanagersMtx.Lock()
+	users := make([]string, 0, len(am.alertmanagers)+len(am.parked))
+	for userID := range am.alertmanagers {
+		users = append(users, userID)
+	}
+	for userID := range am.parked {
+		users = append(users, userID)
+	}
+	am.alertmanagersMtx.Unlock()
+
+	now := time.Now()
+	for _, userID := range users {
+		u := am.diskUsage(userID)
+		for _, kind := range []string{diskUsageTemplates, diskUsageNflog, diskUsageSilences} {
+			diskUsageBytes.WithLabelValues(userID, kind).Set(float64(u[kind]))
+		}
+		limit := am.userDiskLimit(userID)
+		if limit <= 0 || u.total() <= limit {
+			am.diskBackoff.reset(userID)
+			continue
+		}
+		if !am.diskBackoff.allow(userID, now) {
+			continue
+		}
+		am.diskBackoff.failed(userID, now, am.cfg.DiskUsageInterval)
+
+		// Truncating restarts the Alertmanager of the user, which is only
+		// done if it brings the usage below the limit.
+		cutoff := now.Add(-am.cfg.Retention / 2)
+		kept, err := truncatedStateSize(am.cfg.DataDir, userID, cutoff)
+		if err != nil {
+			Must(level.Error(logger.Logger).Log("msg", "MultitenantAlertmanager: error measuring state", "user", userID, "err", err))
+			continue
+		}
+		if u[diskUsageTemplates]+kept > limit {
+			Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: data directory limit exceeded, truncating state would not help", "user", userID, "bytes", u.total(), "limit", limit))
+			continue
+		}
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: data directory limit exceeded, truncating state", "user", userID, "bytes", u.total(), "limit", limit))
+		if err := am.truncateState(userID, cutoff); err != nil {
+			Must(level.Error(logger.Logger).Log("msg", "MultitenantAlertmanager: error truncating state", "user", userID, "err", err))
+		}
+	}
+}
+
+// maxDiskBackoff bounds the time between attempts to bring a user below the
+// data directory limit.
+const maxDiskBackoff = time.Hour
+
+// diskBackoff delays the next attempt to bring a user below the data
+// directory limit, doubling the delay while the user stays above it.
+type diskBackoff struct {
+	mtx   sync.Mutex
+	next  map[string]time.Time
+	delay map[string]time.Duration
+}
+
+func newDiskBackoff() *diskBackoff {
+	return &diskBackoff{next: map[string]time.Time{}, delay: map[string]time.Duration{}}
+}
+
+func (b *diskBackoff) allow(userID string, now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return !now.Before(b.next[userID])
+}
+
+func (b *diskBackoff) failed(userID string, now time.Time, min time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	d := b.delay[userID] * 2
+	if d < min {
+		d = min
+	}
+	if d > maxDiskBackoff {
+		d = maxDiskBackoff
+	}
+	b.delay[userID] = d
+	b.next[userID] = now.Add(d)
+}
+
+func (b *diskBackoff) reset(userID string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.next, userID)
+	delete(b.delay, userID)
+}
+
+// deleteDiskUsageMetrics removes the disk usage metrics of a removed user.
+func deleteDiskUsageMetrics(userID string) {
+	for _, kind := range []string{diskUsageTemplates, diskUsageNflog, diskUsageSilences} {
+		diskUsageBytes.DeleteLabelValues(userID, kind)
+	}
+}
+
+// nflogKept reads a notification log entry, which is kept if it is newer
+// than cutoff.
+func nflogKept(cutoff time.Time) func(r io.Reader) (proto.Message, bool, error) {
+	return func(r io.Reader) (proto.Message, bool, error) {
+		var e nflogpb.MeshEntry
+		if _, err := pbutil.ReadDelimited(r, &e); err != nil {
+			return nil, false, err
+		}
+		return &e, e.Entry != nil && e.Entry.Timestamp.After(cutoff), nil
+	}
+}
+
+// silencesKept reads a silence, which is kept if it ends after cutoff.
+func silencesKept(cutoff time.Time) func(r io.Reader) (proto.Message, bool, error) {
+	return func(r io.Reader) (proto.Message, bool, error) {
+		var s silencepb.MeshSilence
+		if _, err := pbutil.ReadDelimited(r, &s); err != nil {
+			return nil, false, err
+		}
+		return &s, s.Silence != nil && s.Silence.EndsAt.After(cutoff), nil
+	}
+}
+
+// truncatedStateSize returns the bytes the state snapshots of a user would
+// use once truncated at cutoff.
+func truncatedStateSize(dataDir, userID string, cutoff time.Time) (int64, error) {
+	nflogSize, err := keptSize(nflogSnapshotFile(dataDir, userID), nflogKept(cutoff))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read notification log")
+	}
+	silencesSize, err := keptSize(silencesSnapshotFile(dataDir, userID), silencesKept(cutoff))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read silences")
+	}
+	return nflogSize + silencesSize, nil
+}
+
+// truncateState drops the notification log entries and expired silences of
+// a user older than cutoff. The Alertmanager of the user is stopped, so that
+// its snapshots are complete, and rebuilt from the truncated snapshots. Its
+// alerts are lost until they are sent again.
+func (am *MultitenantAlertmanager) truncateState(userID string, cutoff time.Time) error {
+	mtx := am.userLock(userID)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	delete(am.alertmanagers, userID)
+	am.alertmanagersMtx.Unlock()
+	if ok {
+		userAM.Stop()
+	}
+
+	err := truncateSnapshot(nflogSnapshotFile(am.cfg.DataDir, userID), nflogKept(cutoff))
+	if err != nil {
+		err = errors.Wrap(err, "failed to truncate notification log")
+	} else {
+		err = truncateSnapshot(silencesSnapshotFile(am.cfg.DataDir, userID), silencesKept(cutoff))
+		err = errors.Wrap(err, "failed to truncate silences")
+	}
+	diskLimitTruncations.Inc()
+
+	if !ok {
+		return err
+	}
+	// The Alertmanager is rebuilt even if truncating failed.
+	am.cfgMutex.RLock()
+	cfg := am.cfgs[userID]
+	am.cfgMutex.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ApplyTimeout)
+	defer cancel()
+	amConfig, lerr := am.loadConfig(ctx, &cfg)
+	if lerr == nil {
+		userAM, lerr = am.newAlertmanager(ctx, &cfg, amConfig)
+	}
+	am.alertmanagersMtx.Lock()
+	if lerr != nil {
+		// It is rebuilt again on first use.
+		am.parked[userID] = true
+	} else {
+		am.alertmanagers[userID] = userAM
+	}
+	am.alertmanagersMtx.Unlock()
+	if lerr != nil {
+		return errors.Errorf("failed to rebuild Alertmanager for user %v: %v", userID, lerr)
+	}
+	return err
+}
+
+// keptSize returns the bytes of the messages of a snapshot file read by next
+// which are kept.
+func keptSize(fn string, next func(r io.Reader) (proto.Message, bool, error)) (int64, error) {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var n int64
+	r := bufio.NewReader(f)
+	for {
+		msg, keep, err := next(r)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if keep {
+			size := proto.Size(msg)
+			n += int64(proto.SizeVarint(uint64(size)) + size)
+		}
+	}
+}
+
+// truncateSnapshot rewrites a snapshot file of delimited protobuf messages
+// with the messages read by next which are kept.
+func truncateSnapshot(fn string, next func(r io.Reader) (proto.Message, bool, error)) error {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tmp := fn + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	r := bufio.NewReader(f)
+	w := bufio.NewWriter(out)
+	for {
+		msg, keep, err := next(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = out.Close()
+			return err
+		}
+		if !keep {
+			continue
+		}
+		if _, err := pbutil.WriteDelimited(w, msg); err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
@@ -0,0 +1,198 @@
+package alertmanager
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Codes of the errors returned by the config API.
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeNotAcceptable      = "not_acceptable"
+	ErrCodeInvalidConfig      = "invalid_config"
+	ErrCodeInvalidTemplate    = "invalid_template"
+	ErrCodeRoutingPolicy      = "routing_policy_violation"
+	ErrCodeConflict           = "conflict"
+	ErrCodePreconditionFailed = "precondition_failed"
+	ErrCodeQuotaExceeded      = "quota_exceeded"
+	ErrCodeLimitExceeded      = "limit_exceeded"
+	ErrCodeStorageUnavailable = "storage_unavailable"
+	ErrCodeInternal           = "internal"
+)
+
+// APIError is the body of the error responses of the config API.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details locate the validation errors of configs and templates.
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail is a validation error of a config or template file. Line and
+// Field are only set if they are known.
+type ErrorDetail struct {
+	// File is the template file, empty for the config.
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	for _, d := range e.Details {
+		loc := d.File
+		if d.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", loc, d.Line)
+		}
+		if d.Field != "" {
+			loc = strings.TrimPrefix(loc+" "+d.Field, " ")
+		}
+		if loc != "" {
+			msg += fmt.Sprintf("\n  %s: %s", loc, d.Message)
+		} else {
+			msg += "\n  " + d.Message
+		}
+	}
+	return msg
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            ErrCodeBadRequest,
+	http.StatusUnauthorized:          ErrCodeUnauthorized,
+	http.StatusForbidden:             ErrCodeForbidden,
+	http.StatusNotFound:              ErrCodeNotFound,
+	http.StatusNotAcceptable:         ErrCodeNotAcceptable,
+	http.StatusConflict:              ErrCodeConflict,
+	http.StatusPreconditionFailed:    ErrCodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: ErrCodeQuotaExceeded,
+	http.StatusTooManyRequests:       ErrCodeLimitExceeded,
+	http.StatusServiceUnavailable:    ErrCodeStorageUnavailable,
+}
+
+// writeError writes an error response with the code of the status.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = ErrCodeInternal
+	}
+	writeJSON(w, status, APIError{Code: code, Message: msg})
+}
+
+// storageError writes the error of a failed storage request. Requests failing
+// because the storage is degraded get a 503, telling when to retry them.
+func storageError(w http.ResponseWriter, err error) {
+	if e, ok := errors.Cause(err).(*StorageUnavailableError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// configError writes the validation error of a config, locating it in cfg if
+// possible.
+func configError(w http.ResponseWriter, cfg string, err error) {
+	writeJSON(w, http.StatusBadRequest, APIError{
+		Code:    ErrCodeInvalidConfig,
+		Message: fmt.Sprintf("Invalid Alertmanager config: %v", err),
+		Details: configErrorDetails(cfg, err),
+	})
+}
+
+// templateError writes the validation error of a template file.
+func templateError(w http.ResponseWriter, err error) {
+	d := ErrorDetail{Message: err.Error()}
+	if m := templateErrorRe.FindStringSubmatch(err.Error()); m != nil {
+		d.File = m[1]
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Message = m[3]
+	}
+	writeJSON(w, http.StatusBadRequest, APIError{
+		Code:    ErrCodeInvalidTemplate,
+		Message: fmt.Sprintf("Invalid templates: %v", err),
+		Details: []ErrorDetail{d},
+	})
+}
+
+// routingPolicyError writes the violations of the routing policies by a
+// config, one detail per violation.
+func routingPolicyError(w http.ResponseWriter, err error) {
+	e, ok := err.(*RoutingPolicyError)
+	if !ok {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	details := make([]ErrorDetail, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		details = append(details, ErrorDetail{Field: "route", Message: fmt.Sprintf("routing policy %q: %s", v.Policy, v.Message)})
+	}
+	writeJSON(w, http.StatusBadRequest, APIError{
+		Code:    ErrCodeRoutingPolicy,
+		Message: "The config violates the routing policies of the operator",
+		Details: details,
+	})
+}
+
+var (
+	// yamlLineRe matches the line of YAML syntax and type errors.
+	yamlLineRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// yamlFieldRe matches the unknown fields reported by strict parsing.
+	yamlFieldRe = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+	// templateErrorRe matches the file and line of template parse errors.
+	templateErrorRe = regexp.MustCompile(`^template: ([^:]+):(\d+): (.*)$`)
+)
+
+// configErrorDetails locates the error of loading cfg. The configs are split
+// and re-encoded before they are parsed, so that only the lines of syntax
+// errors refer to cfg. Unknown fields are located by their name.
+func configErrorDetails(cfg string, err error) []ErrorDetail {
+	cause := errors.Cause(err)
+	var msgs []string
+	syntax := false
+	switch e := cause.(type) {
+	case *yaml.TypeError:
+		msgs = e.Errors
+	default:
+		msgs = []string{cause.Error()}
+		syntax = strings.HasPrefix(cause.Error(), "yaml: ")
+	}
+
+	var details []ErrorDetail
+	for _, msg := range msgs {
+		d := ErrorDetail{Message: msg}
+		if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+			d.Message = m[2]
+			if syntax {
+				d.Line, _ = strconv.Atoi(m[1])
+			}
+		}
+		if m := yamlFieldRe.FindStringSubmatch(d.Message); m != nil {
+			d.Field = m[1]
+			d.Line = fieldLine(cfg, m[1])
+		}
+		details = append(details, d)
+	}
+	return details
+}
+
+// fieldLine returns the first line of cfg setting the field, or 0.
+func fieldLine(cfg, field string) int {
+	re := regexp.MustCompile(`^\s*(?:-\s+)?` + regexp.QuoteMeta(field) + `\s*:`)
+	for i, line := range strings.Split(cfg, "\n") {
+		if re.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
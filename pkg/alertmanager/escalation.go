@@ -0,0 +1,78 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+var errNotEscalated = fmt.Errorf("the receiver has no escalations")
+
+// AcknowledgeRequest acknowledges an alert group, which stops its
+// escalation until it resolves.
+type AcknowledgeRequest struct {
+	// Receiver is the receiver of the route of the group, which escalates.
+	Receiver string `json:"receiver"`
+	// GroupKey is the key of the group, as sent in the notifications.
+	GroupKey string `json:"groupKey"`
+}
+
+// Acknowledge acknowledges an alert group of a receiver with escalations.
+// The acknowledgement is replicated with the notification log.
+func (am *Alertmanager) Acknowledge(receiver, groupKey string) error {
+	p := am.getPipeline()
+	if p == nil {
+		return fmt.Errorf("no configuration applied")
+	}
+	for _, rc := range p.conf.Receivers {
+		if rc.Name != receiver {
+			continue
+		}
+		if len(rc.Escalations) == 0 {
+			return errNotEscalated
+		}
+		return notify.AcknowledgeAlertGroup(am.nflog, receiver, groupKey)
+	}
+	return errReceiverNotFound
+}
+
+// AcknowledgeAlertGroup serves the acknowledgement of an alert group.
+func (am *MultitenantAlertmanager) AcknowledgeAlertGroup(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	var ack AcknowledgeRequest
+	if err := json.NewDecoder(req.Body).Decode(&ack); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ack.Receiver == "" || ack.GroupKey == "" {
+		writeError(w, http.StatusBadRequest, "receiver and groupKey must be set")
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch err := userAM.Acknowledge(ack.Receiver, ack.GroupKey); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errReceiverNotFound, errNotEscalated:
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package alertmanager
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// errPreconditionFailed is returned when the If-Match or If-None-Match
+	// header of a config change does not hold.
+	errPreconditionFailed = errors.New("precondition failed")
+	// errRevisionConflict is returned when the revision set with a config
+	// is not the one of the stored config.
+	errRevisionConflict = errors.New("revision conflict")
+	// errConfigUnchanged aborts storing a config equal to the stored one.
+	errConfigUnchanged = errors.New("config unchanged")
+)
+
+// configETag returns the entity tag of the stored config, which changes
+// with its content only, or "" if no config is stored.
+func configETag(cfg *AlertmanagerConfig) string {
+	if cfg.UserID == "" {
+		return ""
+	}
+	return `"` + configChecksum(cfg) + `"`
+}
+
+// etagMatches returns true if the If-Match or If-None-Match header lists
+// etag, or is "*" and etag is set. Weak tags only match with weak
+// comparison, as used by If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfigPreconditions returns errPreconditionFailed if the If-Match or
+// If-None-Match header of a request changing the config does not hold for
+// the stored config. If-None-Match: * only creates a config.
+func checkConfigPreconditions(r *http.Request, stored *AlertmanagerConfig) error {
+	etag := configETag(stored)
+	if h := r.Header.Get("If-Match"); h != "" && !etagMatches(h, etag, false) {
+		return errors.Wrap(errPreconditionFailed, "the stored config does not match If-Match")
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" && etagMatches(h, etag, true) {
+		return errors.Wrap(errPreconditionFailed, "the stored config matches If-None-Match")
+	}
+	return nil
+}
+
+// checkConfigRevision returns errRevisionConflict if rev, the revision set
+// with a config, is not the revision of the stored config. A revision of 0
+// skips the check, unless required is set and a config is stored.
+func checkConfigRevision(rev int64, stored *AlertmanagerConfig, required bool) error {
+	exists := stored.UserID != "" && stored.DeletedAtInUnix == 0
+	switch {
+	case rev == 0 && required && exists:
+		return errors.Wrap(errRevisionConflict, "the revision of the stored config must be set")
+	case rev == 0 || rev == stored.Revision:
+		return nil
+	case stored.UserID == "":
+		return errors.Wrapf(errRevisionConflict, "no config is stored, the revision must be 0, not %d", rev)
+	default:
+		return errors.Wrapf(errRevisionConflict, "the stored config has revision %d, not %d", stored.Revision, rev)
+	}
+}
@@ -0,0 +1,103 @@
+package alertmanager
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestETagMatches(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		etag   string
+		weak   bool
+		match  bool
+	}{
+		{header: "", etag: `"a"`, match: false},
+		{header: `"a"`, etag: `"a"`, match: true},
+		{header: `"b", "a"`, etag: `"a"`, match: true},
+		{header: `"b"`, etag: `"a"`, match: false},
+		{header: "*", etag: `"a"`, match: true},
+		{header: "*", etag: "", match: false},
+		{header: `W/"a"`, etag: `"a"`, match: false},
+		{header: `W/"a"`, etag: `"a"`, weak: true, match: true},
+	} {
+		if match := etagMatches(tc.header, tc.etag, tc.weak); match != tc.match {
+			t.Errorf("etagMatches(%q, %q, %v) = %v, want %v", tc.header, tc.etag, tc.weak, match, tc.match)
+		}
+	}
+}
+
+func TestCheckConfigPreconditions(t *testing.T) {
+	stored := &AlertmanagerConfig{UserID: "user", Config: "route: {receiver: a}"}
+	etag := configETag(stored)
+	changed := &AlertmanagerConfig{UserID: "user", Config: "route: {receiver: b}"}
+	if configETag(changed) == etag {
+		t.Fatal("configs with a different content have the same ETag")
+	}
+	if configETag(&AlertmanagerConfig{}) != "" {
+		t.Fatal("a missing config has an ETag")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		header  string
+		value   string
+		stored  *AlertmanagerConfig
+		success bool
+	}{
+		{name: "no preconditions", stored: stored, success: true},
+		{name: "if-match", header: "If-Match", value: etag, stored: stored, success: true},
+		{name: "if-match changed", header: "If-Match", value: etag, stored: changed},
+		{name: "if-match missing", header: "If-Match", value: "*", stored: &AlertmanagerConfig{}},
+		{name: "if-none-match create", header: "If-None-Match", value: "*", stored: &AlertmanagerConfig{}, success: true},
+		{name: "if-none-match exists", header: "If-None-Match", value: "*", stored: stored},
+		{name: "if-none-match changed", header: "If-None-Match", value: etag, stored: changed, success: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/api/v1/config", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			err := checkConfigPreconditions(r, tc.stored)
+			if tc.success && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.success && errors.Cause(err) != errPreconditionFailed {
+				t.Fatalf("expected precondition failure, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckConfigRevision(t *testing.T) {
+	stored := &AlertmanagerConfig{UserID: "user", Revision: 5}
+	deleted := &AlertmanagerConfig{UserID: "user", Revision: 5, DeletedAtInUnix: 1}
+	for _, tc := range []struct {
+		name     string
+		rev      int64
+		stored   *AlertmanagerConfig
+		required bool
+		success  bool
+	}{
+		{name: "not set", stored: stored, success: true},
+		{name: "matches", rev: 5, stored: stored, success: true},
+		{name: "changed", rev: 4, stored: stored},
+		{name: "missing config", rev: 5, stored: &AlertmanagerConfig{}},
+		{name: "required", stored: stored, required: true},
+		{name: "required matches", rev: 5, stored: stored, required: true, success: true},
+		{name: "required create", stored: &AlertmanagerConfig{}, required: true, success: true},
+		{name: "required deleted", stored: deleted, required: true, success: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkConfigRevision(tc.rev, tc.stored, tc.required)
+			if tc.success && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.success && errors.Cause(err) != errRevisionConflict {
+				t.Fatalf("expected revision conflict, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/go-kit/kit/log"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	NotificationDelivered = "delivered"
+	NotificationFailed    = "failed"
+	// NotificationExhausted is the status of notifications which failed
+	// after exhausting the retries of the receiver's retry policy.
+	NotificationExhausted = "exhausted"
+	// NotificationSuppressed is the status of notifications suppressed by a
+	// maintenance window.
+	NotificationSuppressed = "suppressed"
+
+	// Number of events buffered per subscriber. Events are dropped for
+	// subscribers which can not keep up.
+	eventBufferSize = 256
+
+	// Notification stats are kept per minute for statsWindow.
+	statsWindow  = time.Hour
+	statsBuckets = int(statsWindow / time.Minute)
+)
+
+// NotificationEvent describes an attempt of a single integration of a
+// receiver to deliver a notification, with the payload it rendered.
+type NotificationEvent struct {
+	Time        time.Time                `json:"time"`
+	Receiver    string                   `json:"receiver"`
+	Integration string                   `json:"integration"`
+	GroupKey    string                   `json:"groupKey"`
+	Status      string                   `json:"status"`
+	Error       string                   `json:"error,omitempty"`
+	Attempts    int                      `json:"attempts,omitempty"`
+	Window      string                   `json:"window,omitempty"`
+	Payload     interface{}              `json:"payload,omitempty"`
+	Alerts      []NotificationEventAlert `json:"alerts"`
+}
+
+type NotificationEventAlert struct {
+	Status      string         `json:"status"`
+	Labels      model.LabelSet `json:"labels"`
+	Annotations model.LabelSet `json:"annotations,omitempty"`
+	StartsAt    time.Time      `json:"startsAt"`
+	EndsAt      time.Time      `json:"endsAt,omitempty"`
+}
+
+func newNotificationEventAlert(a *types.Alert) NotificationEventAlert {
+	return NotificationEventAlert{
+		Status:      string(a.Status()),
+		Labels:      a.Labels,
+		Annotations: a.Annotations,
+		StartsAt:    a.StartsAt,
+		EndsAt:      a.EndsAt,
+	}
+}
+
+// NotificationStats counts the notifications of a user over the stats window.
+type NotificationStats struct {
+	Window     model.Duration `json:"window"`
+	Delivered  int            `json:"delivered"`
+	Failed     int            `json:"failed"`
+	Suppressed int            `json:"suppressed"`
+	// ErrorRate is the ratio of failed to attempted deliveries.
+	ErrorRate float64 `json:"errorRate"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s NotificationStats) MarshalJSON() ([]byte, error) {
+	type plain NotificationStats
+	return json.Marshal(struct {
+		plain
+		Window string `json:"window"`
+	}{plain: plain(s), Window: s.Window.String()})
+}
+
+type statsBucket struct {
+	minute                        int64
+	delivered, failed, suppressed int
+}
+
+// notificationStats counts the published events in per minute buckets.
+type notificationStats struct {
+	mtx     sync.Mutex
+	buckets [statsBuckets]statsBucket
+}
+
+func (s *notificationStats) record(ev NotificationEvent) {
+	minute := ev.Time.Unix() / 60
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	b := &s.buckets[minute%int64(statsBuckets)]
+	if b.minute != minute {
+		*b = statsBucket{minute: minute}
+	}
+	switch ev.Status {
+	case NotificationDelivered:
+		b.delivered++
+	case NotificationFailed:
+		// The attempts of exhausted notifications are already counted.
+		b.failed++
+	case NotificationSuppressed:
+		b.suppressed++
+	}
+}
+
+func (s *notificationStats) snapshot(now time.Time) NotificationStats {
+	st := NotificationStats{Window: model.Duration(statsWindow)}
+	oldest := now.Unix()/60 - int64(statsBuckets) + 1
+	s.mtx.Lock()
+	for _, b := range s.buckets {
+		if b.minute < oldest {
+			continue
+		}
+		st.Delivered += b.delivered
+		st.Failed += b.failed
+		st.Suppressed += b.suppressed
+	}
+	s.mtx.Unlock()
+	if n := st.Delivered + st.Failed; n > 0 {
+		st.ErrorRate = float64(st.Failed) / float64(n)
+	}
+	return st
+}
+
+// notificationEvents fans out notification events to its subscribers and
+// keeps stats of them.
+type notificationEvents struct {
+	mtx   sync.RWMutex
+	subs  map[chan NotificationEvent]struct{}
+	stats notificationStats
+}
+
+func newNotificationEvents() *notificationEvents {
+	return &notificationEvents{
+		subs: map[chan NotificationEvent]struct{}{},
+	}
+}
+
+func (e *notificationEvents) subscribe() chan NotificationEvent {
+	ch := make(chan NotificationEvent, eventBufferSize)
+	e.mtx.Lock()
+	e.subs[ch] = struct{}{}
+	e.mtx.Unlock()
+	return ch
+}
+
+func (e *notificationEvents) unsubscribe(ch chan NotificationEvent) {
+	e.mtx.Lock()
+	delete(e.subs, ch)
+	e.mtx.Unlock()
+}
+
+// subscribed returns true if there are subscribers.
+func (e *notificationEvents) subscribed() bool {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	return len(e.subs) > 0
+}
+
+func (e *notificationEvents) publish(ev NotificationEvent) {
+	e.stats.record(ev)
+
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// observeNotifications adds the events as the NotificationObserver of the
+// pipeline of every receiver, so that every delivery attempt and every
+// notification suppressed by a maintenance window is published as a
+// NotificationEvent.
+func observeNotifications(rs amnotify.RoutingStage, events *notificationEvents) {
+	for name, s := range rs {
+		rs[name] = &observerStage{Stage: s, events: events}
+	}
+}
+
+// observerStage executes the wrapped stage with the events as the
+// NotificationObserver.
+type observerStage struct {
+	amnotify.Stage
+	events *notificationEvents
+}
+
+func (s *observerStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	return s.Stage.Exec(notify.WithNotificationObserver(ctx, s.events), l, alerts...)
+}
+
+// Notified implements the notify.NotificationObserver interface. The
+// payload of the attempt is rendered only if there are subscribers.
+func (e *notificationEvents) Notified(ctx context.Context, n notify.NotificationAttempt) {
+	ev := NotificationEvent{
+		Time:        time.Now(),
+		Integration: fmt.Sprintf("%s[%d]", n.Integration.Name(), n.Integration.Index()),
+		Status:      NotificationDelivered,
+		Attempts:    n.Attempt,
+	}
+	ev.Receiver, _ = amnotify.ReceiverName(ctx)
+	ev.GroupKey, _ = amnotify.GroupKey(ctx)
+	switch {
+	case n.Exhausted:
+		ev.Status = NotificationExhausted
+	case n.Err != nil:
+		ev.Status = NotificationFailed
+	}
+	if n.Err != nil {
+		ev.Error = n.Err.Error()
+	}
+	if !n.Exhausted && e.subscribed() {
+		if payload, ok, err := n.Integration.Render(ctx, n.Alerts...); ok && err == nil {
+			ev.Payload = payload
+		}
+	}
+	for _, a := range n.Alerts {
+		ev.Alerts = append(ev.Alerts, newNotificationEventAlert(a))
+	}
+	e.publish(ev)
+}
+
+// Suppressed implements the notify.NotificationObserver interface.
+func (e *notificationEvents) Suppressed(ctx context.Context, window string, alerts []*types.Alert) {
+	ev := NotificationEvent{
+		Time:   time.Now(),
+		Status: NotificationSuppressed,
+		Window: window,
+	}
+	ev.Receiver, _ = amnotify.ReceiverName(ctx)
+	ev.GroupKey, _ = amnotify.GroupKey(ctx)
+	for _, a := range alerts {
+		ev.Alerts = append(ev.Alerts, newNotificationEventAlert(a))
+	}
+	e.publish(ev)
+}
+
+// NotificationStream streams the notification events of the user as
+// server-sent events. Events can be filtered by receiver using the
+// `receiver` query parameter.
+func (am *MultitenantAlertmanager) NotificationStream(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	// The stream ends on shutdown, also when it is proxied to the leader.
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-am.streamsStop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req = req.WithContext(ctx)
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	receiver := req.URL.Query().Get("receiver")
+
+	ch := userAM.events.subscribe()
+	defer userAM.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case ev := <-ch:
+			if receiver != "" && ev.Receiver != receiver {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: notification\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-userAM.stop:
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// validateFeatures checks that the feature flags are known, see
+// notify.Features.
+func validateFeatures(names []string) error {
+	for _, name := range names {
+		if !notify.IsFeature(name) {
+			return errors.Errorf("unknown feature %q", name)
+		}
+	}
+	return nil
+}
+
+// featureNames returns the names of the feature flags of overrides.
+func featureNames(overrides map[string]bool) []string {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	return names
+}
+
+// featureEnabled returns true if the feature is enabled for a user with
+// the feature overrides, which take precedence over the default features.
+func (c *MultitenantAlertmanagerConfig) featureEnabled(overrides map[string]bool, feature string) bool {
+	if enabled, ok := overrides[feature]; ok {
+		return enabled
+	}
+	return c.defaultFeatures[feature]
+}
+
+// enabledFeatures returns the sorted features enabled for a user with the
+// feature overrides.
+func (c *MultitenantAlertmanagerConfig) enabledFeatures(overrides map[string]bool) []string {
+	enabled := []string{}
+	for _, f := range notify.Features {
+		if c.featureEnabled(overrides, f) {
+			enabled = append(enabled, f)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// setFeatures caches the feature overrides of the user, which are looked up
+// on every notification.
+func (am *MultitenantAlertmanager) setFeatures(userID string, overrides map[string]bool) {
+	am.featuresMtx.Lock()
+	defer am.featuresMtx.Unlock()
+	if len(overrides) == 0 {
+		delete(am.features, userID)
+		return
+	}
+	am.features[userID] = overrides
+}
+
+// featureFunc returns the function telling whether a feature is enabled for
+// the user, according to the cached overrides.
+func (am *MultitenantAlertmanager) featureFunc(userID string) func(string) bool {
+	return func(feature string) bool {
+		am.featuresMtx.RLock()
+		overrides := am.features[userID]
+		am.featuresMtx.RUnlock()
+		return am.cfg.featureEnabled(overrides, feature)
+	}
+}
+
+// setTenantFeatures replaces the feature overrides of a tenant. The
+// features not overridden are those of the replicas.
+func (a *AdminAPI) setTenantFeatures(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	var overrides map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateFeatures(featureNames(overrides)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(overrides) == 0 {
+		overrides = nil
+	}
+	err := a.client.UpdateConfig(r.Context(), userID, func(cfg *AlertmanagerConfig) error {
+		if cfg.UserID == "" {
+			return errConfigNotFound
+		}
+		if reflect.DeepEqual(cfg.Features, overrides) {
+			return errSkipItem
+		}
+		cfg.Features = overrides
+		cfg.UpdatedAtInUnix = time.Now().Unix()
+		return nil
+	})
+	if err == errConfigNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil && err != errSkipItem {
+		Must(level.Error(logger2.Logger).Log("msg", "error storing tenant features", "user", userID, "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "tenant features updated", "user", userID, "features", strings.Join(a.am.cfg.enabledFeatures(overrides), ",")))
+	writeJSON(w, http.StatusOK, a.am.cfg.enabledFeatures(overrides))
+}
@@ -0,0 +1,30 @@
+package alertmanager
+
+import (
+	"reflect"
+	"testing"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+func TestFeatureEnabled(t *testing.T) {
+	cfg := &MultitenantAlertmanagerConfig{defaultFeatures: map[string]bool{notify.FeatureWebhookSigning: true}}
+	overrides := map[string]bool{notify.FeatureEscalations: true, notify.FeatureWebhookSigning: false}
+
+	if want := []string{notify.FeatureWebhookSigning}; !reflect.DeepEqual(cfg.enabledFeatures(nil), want) {
+		t.Fatalf("expected default features %v, got %v", want, cfg.enabledFeatures(nil))
+	}
+	if want := []string{notify.FeatureEscalations}; !reflect.DeepEqual(cfg.enabledFeatures(overrides), want) {
+		t.Fatalf("expected features %v, got %v", want, cfg.enabledFeatures(overrides))
+	}
+	if cfg.featureEnabled(overrides, notify.FeatureSlackBlockKit) {
+		t.Fatal("feature neither enabled by default nor overridden is enabled")
+	}
+
+	if err := validateFeatures(notify.Features); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := validateFeatures([]string{"slack_blocks"}); err == nil {
+		t.Fatal("expected an error for an unknown feature")
+	}
+}
@@ -0,0 +1,155 @@
+package alertmanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/cluster"
+	"github.com/prometheus/alertmanager/cluster/clusterpb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The key of the peer state multiplexing the states of all users.
+const peerStatesKey = "users"
+
+// peerStates multiplexes the gossiped states of all users over a single
+// state of the peer. The peer keeps its states in a map which the memberlist
+// delegate reads without locking, so the single state is added before the
+// peer joins the cluster, and the states of the users, which are added
+// while gossiping, are kept by peerStates under its own lock.
+type peerStates struct {
+	mtx     sync.RWMutex
+	states  map[string]cluster.State
+	channel *cluster.Channel
+
+	// stats are the gossip statistics by state key.
+	statsMtx sync.Mutex
+	stats    map[string]*GossipStateStatus
+}
+
+// GossipStateStatus is the replication health of a gossiped state of a user
+// on this replica.
+type GossipStateStatus struct {
+	// Broadcasts is the number of updates of the state broadcast by this
+	// replica.
+	Broadcasts    uint64     `json:"broadcasts"`
+	LastBroadcast *time.Time `json:"lastBroadcast,omitempty"`
+	// Merges is the number of updates and full states received from other
+	// replicas and merged into the state.
+	Merges         uint64     `json:"merges"`
+	LastMerge      *time.Time `json:"lastMerge,omitempty"`
+	MergeFailures  uint64     `json:"mergeFailures"`
+	LastMergeError string     `json:"lastMergeError,omitempty"`
+	// Ignored is the number of received updates of the state which were
+	// ignored, as the user had no Alertmanager on this replica.
+	Ignored uint64 `json:"ignored"`
+}
+
+// newPeerStates adds a peerStates to the peer. It must be called before the
+// peer joins the cluster.
+func newPeerStates(peer *cluster.Peer, reg prometheus.Registerer) *peerStates {
+	s := &peerStates{
+		states: map[string]cluster.State{},
+		stats:  map[string]*GossipStateStatus{},
+	}
+	s.channel = peer.AddState(peerStatesKey, s, channelRegisterer{reg})
+	return s
+}
+
+// add adds the state st to be replicated across the cluster under key,
+// replacing the state of a previous Alertmanager of the user. It returns
+// the function broadcasting the updates of st.
+func (s *peerStates) add(key string, st cluster.State) func([]byte) {
+	s.mtx.Lock()
+	s.states[key] = st
+	s.mtx.Unlock()
+
+	return func(b []byte) {
+		fs := clusterpb.FullState{Parts: []clusterpb.Part{{Key: key, Data: b}}}
+		data, err := fs.Marshal()
+		if err != nil {
+			return
+		}
+		s.channel.Broadcast(data)
+		s.record(key, func(st *GossipStateStatus, now time.Time) {
+			st.Broadcasts++
+			st.LastBroadcast = &now
+		})
+	}
+}
+
+// record updates the statistics of the state under key.
+func (s *peerStates) record(key string, update func(st *GossipStateStatus, now time.Time)) {
+	now := time.Now().UTC()
+	s.statsMtx.Lock()
+	defer s.statsMtx.Unlock()
+	st, ok := s.stats[key]
+	if !ok {
+		st = &GossipStateStatus{}
+		s.stats[key] = st
+	}
+	update(st, now)
+}
+
+// status returns the statistics of the state under key, nil if it was never
+// gossiped.
+func (s *peerStates) status(key string) *GossipStateStatus {
+	s.statsMtx.Lock()
+	defer s.statsMtx.Unlock()
+	st, ok := s.stats[key]
+	if !ok {
+		return nil
+	}
+	cp := *st
+	return &cp
+}
+
+// MarshalBinary implements the cluster.State interface.
+func (s *peerStates) MarshalBinary() ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	fs := clusterpb.FullState{Parts: make([]clusterpb.Part, 0, len(s.states))}
+	for key, st := range s.states {
+		b, err := st.MarshalBinary()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal state %s", key)
+		}
+		fs.Parts = append(fs.Parts, clusterpb.Part{Key: key, Data: b})
+	}
+	return fs.Marshal()
+}
+
+// Merge implements the cluster.State interface. The states of users without
+// Alertmanager on this replica are ignored.
+func (s *peerStates) Merge(b []byte) error {
+	var fs clusterpb.FullState
+	if err := fs.Unmarshal(b); err != nil {
+		return errors.Wrap(err, "failed to decode states")
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, p := range fs.Parts {
+		st, ok := s.states[p.Key]
+		if !ok {
+			s.record(p.Key, func(st *GossipStateStatus, _ time.Time) {
+				st.Ignored++
+			})
+			continue
+		}
+		if err := st.Merge(p.Data); err != nil {
+			s.record(p.Key, func(st *GossipStateStatus, _ time.Time) {
+				st.MergeFailures++
+				st.LastMergeError = err.Error()
+			})
+			return errors.Wrapf(err, "failed to merge state %s", p.Key)
+		}
+		s.record(p.Key, func(st *GossipStateStatus, now time.Time) {
+			st.Merges++
+			st.LastMerge = &now
+		})
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package alertmanager
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/cluster"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestPeer creates a gossip peer with its peerStates on a free local
+// port, joined to the known peers.
+func newTestPeer(t *testing.T, known ...string) (*cluster.Peer, *peerStates) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := cluster.Create(
+		log.NewNopLogger(),
+		prometheus.NewRegistry(),
+		addr,
+		addr,
+		known,
+		false,
+		100*time.Millisecond,
+		10*time.Millisecond,
+		time.Second,
+		100*time.Millisecond,
+		200*time.Millisecond,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := newPeerStates(peer, prometheus.NewRegistry())
+	if err := peer.Join(0, 0); err != nil && len(known) > 0 {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = peer.Leave(time.Second)
+	})
+	return peer, states
+}
+
+// newTestSilences creates silences gossiped by states under the silences key
+// of userID.
+func newTestSilences(t *testing.T, states *peerStates, userID string) *silence.Silences {
+	t.Helper()
+	s, err := silence.New(silence.Options{Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetBroadcast(states.add(silencesChannelKey(userID), s))
+	return s
+}
+
+func setTestSilence(t *testing.T, s *silence.Silences) string {
+	t.Helper()
+	now := time.Now()
+	id, err := s.Set(&silencepb.Silence{
+		Matchers: []*silencepb.Matcher{{Name: "alertname", Pattern: "test"}},
+		StartsAt: now,
+		EndsAt:   now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// waitSilence waits until the silence with id is known to s.
+func waitSilence(t *testing.T, s *silence.Silences, id string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := s.QueryOne(silence.QIDs(id)); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("silence %s was not gossiped", id)
+}
+
+func TestPeerStatesBroadcast(t *testing.T) {
+	p1, s1 := newTestPeer(t)
+	_, s2 := newTestPeer(t, p1.Self().Address())
+
+	// The states of users are added concurrently while gossiping, as their
+	// Alertmanagers are created.
+	const users = 20
+	silences1 := make([]*silence.Silences, users)
+	silences2 := make([]*silence.Silences, users)
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user-%d", i)
+			silences1[i] = newTestSilences(t, s1, userID)
+			silences2[i] = newTestSilences(t, s2, userID)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < users; i++ {
+		id := setTestSilence(t, silences1[i])
+		waitSilence(t, silences2[i], id)
+	}
+	// The silences are merged into the state of their user only.
+	for i := 0; i < users; i++ {
+		sils, _, err := silences2[i].Query()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sils) != 1 {
+			t.Fatalf("user-%d has %d silences, want 1", i, len(sils))
+		}
+	}
+}
+
+func TestPeerStatesPushPull(t *testing.T) {
+	p1, s1 := newTestPeer(t)
+	_, s2 := newTestPeer(t, p1.Self().Address())
+
+	// The broadcast is ignored by the second peer, which does not have the
+	// user yet, the silence is received with the full state instead.
+	silences1 := newTestSilences(t, s1, "user")
+	id := setTestSilence(t, silences1)
+	time.Sleep(100 * time.Millisecond)
+	silences2 := newTestSilences(t, s2, "user")
+	waitSilence(t, silences2, id)
+}
+
+func TestPeerStatesStatus(t *testing.T) {
+	p1, s1 := newTestPeer(t)
+	_, s2 := newTestPeer(t, p1.Self().Address())
+
+	silences1 := newTestSilences(t, s1, "user")
+	silences2 := newTestSilences(t, s2, "user")
+	key := silencesChannelKey("user")
+	if st := s1.status(key); st != nil {
+		t.Fatalf("got status %+v of a state never gossiped, want none", st)
+	}
+
+	id := setTestSilence(t, silences1)
+	waitSilence(t, silences2, id)
+
+	st := s1.status(key)
+	if st == nil || st.Broadcasts == 0 || st.LastBroadcast == nil {
+		t.Fatalf("got status %+v of the sender, want broadcasts", st)
+	}
+	st = s2.status(key)
+	if st == nil || st.Merges == 0 || st.LastMerge == nil || st.MergeFailures != 0 {
+		t.Fatalf("got status %+v of the receiver, want merges", st)
+	}
+}
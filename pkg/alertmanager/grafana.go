@@ -0,0 +1,397 @@
+package alertmanager
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"gopkg.in/yaml.v2"
+)
+
+// ExportFormatGrafana exports configs as Grafana alerting provisioning
+// files, with contact points and notification policies.
+const ExportFormatGrafana = "grafana"
+
+// grafanaIntegration describes how an integration is exported as a Grafana
+// contact point integration.
+type grafanaIntegration struct {
+	typ string
+	// settings maps the fields of the integration to the settings of
+	// Grafana. The fields of nested objects are written as object.field.
+	settings map[string]string
+	// globals maps the settings of Grafana to the fields of the global
+	// section they default to.
+	globals map[string]string
+	// sendResolved is the default of send_resolved.
+	sendResolved bool
+}
+
+// grafanaIntegrations are the integrations Grafana supports, by receiver
+// field. The other integrations are not exported.
+var grafanaIntegrations = map[string]grafanaIntegration{
+	"webhook_configs": {
+		typ: "webhook",
+		settings: map[string]string{
+			"url":                 "url",
+			"max_alerts":          "maxAlerts",
+			"basic_auth.username": "username",
+			"basic_auth.password": "password",
+			"bearer_token":        "authorization_credentials",
+		},
+		sendResolved: true,
+	},
+	"slack_configs": {
+		typ: "slack",
+		settings: map[string]string{
+			"api_url":    "url",
+			"bot_token":  "token",
+			"channel":    "recipient",
+			"username":   "username",
+			"title":      "title",
+			"text":       "text",
+			"icon_emoji": "icon_emoji",
+			"icon_url":   "icon_url",
+		},
+		globals: map[string]string{"url": "slack_api_url"},
+	},
+	"email_configs": {
+		typ:      "email",
+		settings: map[string]string{"to": "addresses", "text": "message"},
+	},
+	"pagerduty_configs": {
+		typ: "pagerduty",
+		settings: map[string]string{
+			"routing_key": "integrationKey",
+			"service_key": "integrationKey",
+			"description": "summary",
+			"severity":    "severity",
+			"class":       "class",
+			"component":   "component",
+			"group":       "group",
+			"client":      "client",
+			"client_url":  "client_url",
+			"details":     "details",
+		},
+		sendResolved: true,
+	},
+	"msteams_configs": {
+		typ:          "teams",
+		settings:     map[string]string{"webhook_url": "url", "title": "title", "text": "message"},
+		sendResolved: true,
+	},
+	"webex_configs": {
+		typ:          "webex",
+		settings:     map[string]string{"api_url": "api_url", "bot_token": "bot_token", "room_id": "room_id", "message": "message"},
+		sendResolved: true,
+	},
+	"googlechat_configs": {
+		typ:          "googlechat",
+		settings:     map[string]string{"webhook_url": "url", "title": "title", "text": "message"},
+		sendResolved: true,
+	},
+	"discord_configs": {
+		typ:          "discord",
+		settings:     map[string]string{"webhook_url": "url", "title": "title", "message": "message", "avatar_url": "avatar_url"},
+		sendResolved: true,
+	},
+	"opsgenie_configs": {
+		typ:          "opsgenie",
+		settings:     map[string]string{"api_key": "apiKey", "api_url": "apiUrl", "message": "message", "description": "description"},
+		globals:      map[string]string{"apiKey": "opsgenie_api_key", "apiUrl": "opsgenie_api_url"},
+		sendResolved: true,
+	},
+	"pushover_configs": {
+		typ:          "pushover",
+		settings:     map[string]string{"user_key": "userKey", "token": "apiToken", "title": "title", "message": "message", "priority": "priority", "sound": "sound"},
+		sendResolved: true,
+	},
+}
+
+// GrafanaProvisioning is a Grafana alerting provisioning file.
+type GrafanaProvisioning struct {
+	APIVersion    int                   `yaml:"apiVersion"`
+	ContactPoints []GrafanaContactPoint `yaml:"contactPoints"`
+	Policies      []*GrafanaPolicy      `yaml:"policies"`
+}
+
+// GrafanaContactPoint is the contact point of a receiver.
+type GrafanaContactPoint struct {
+	OrgID     int                  `yaml:"orgId"`
+	Name      string               `yaml:"name"`
+	Receivers []GrafanaIntegration `yaml:"receivers"`
+}
+
+// GrafanaIntegration is an integration of a contact point.
+type GrafanaIntegration struct {
+	UID                   string        `yaml:"uid"`
+	Type                  string        `yaml:"type"`
+	Settings              yaml.MapSlice `yaml:"settings"`
+	DisableResolveMessage bool          `yaml:"disableResolveMessage"`
+}
+
+// GrafanaPolicy is the notification policy of a route.
+type GrafanaPolicy struct {
+	OrgID          int              `yaml:"orgId,omitempty"`
+	Receiver       string           `yaml:"receiver,omitempty"`
+	GroupBy        []string         `yaml:"group_by,omitempty"`
+	ObjectMatchers [][]string       `yaml:"object_matchers,omitempty"`
+	Continue       bool             `yaml:"continue,omitempty"`
+	GroupWait      string           `yaml:"group_wait,omitempty"`
+	GroupInterval  string           `yaml:"group_interval,omitempty"`
+	RepeatInterval string           `yaml:"repeat_interval,omitempty"`
+	Routes         []*GrafanaPolicy `yaml:"routes,omitempty"`
+}
+
+// exportGrafana converts the receivers and the routes of cfg to a Grafana
+// provisioning file of the organization orgID. The secrets are exported as
+// they are in cfg, which may be redacted. The warnings list what could not
+// be exported.
+func exportGrafana(cfg string, orgID int) (*GrafanaProvisioning, []string, error) {
+	items, err := configItems(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The route is parsed alone, as the receivers may hold redacted
+	// secrets which are not valid.
+	data, err := yaml.Marshal(items["route"])
+	if err != nil {
+		return nil, nil, err
+	}
+	var route config.Route
+	if err := yaml.Unmarshal(data, &route); err != nil {
+		return nil, nil, err
+	}
+	globals := map[string]interface{}{}
+	if g, ok := items["global"].(yaml.MapSlice); ok {
+		for _, item := range g {
+			globals[fmt.Sprint(item.Key)] = item.Value
+		}
+	}
+
+	p := &GrafanaProvisioning{APIVersion: 1, ContactPoints: []GrafanaContactPoint{}}
+	var warnings []string
+	if secrets.Mask(cfg) != cfg {
+		warnings = append(warnings, "the config references secrets, which Grafana can not resolve, replace them before provisioning")
+	}
+	receivers, _ := items["receivers"].([]interface{})
+	for _, r := range receivers {
+		rcv, ok := r.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		var name string
+		for _, f := range rcv {
+			if f.Key == "name" {
+				name = fmt.Sprint(f.Value)
+			}
+		}
+		cp := GrafanaContactPoint{OrgID: orgID, Name: name, Receivers: []GrafanaIntegration{}}
+		for _, f := range rcv {
+			key := fmt.Sprint(f.Key)
+			if key == "name" {
+				continue
+			}
+			gi, ok := grafanaIntegrations[key]
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("receiver %q: %s are not supported by Grafana", name, key))
+				continue
+			}
+			configs, _ := f.Value.([]interface{})
+			for i, c := range configs {
+				fields, _ := c.(yaml.MapSlice)
+				integration, dropped := gi.export(fields, globals)
+				integration.UID = grafanaUID(name, key, i)
+				cp.Receivers = append(cp.Receivers, integration)
+				for _, d := range dropped {
+					warnings = append(warnings, fmt.Sprintf("receiver %q: %s[%d].%s is not supported by Grafana", name, key, i, d))
+				}
+			}
+		}
+		if len(cp.Receivers) == 0 {
+			warnings = append(warnings, fmt.Sprintf("receiver %q has no integration supported by Grafana, its contact point is not exported", name))
+			continue
+		}
+		p.ContactPoints = append(p.ContactPoints, cp)
+	}
+
+	root := grafanaPolicy(&route)
+	root.OrgID = orgID
+	p.Policies = []*GrafanaPolicy{root}
+	return p, warnings, nil
+}
+
+// export returns the Grafana integration of the fields of an integration,
+// and the fields which are dropped.
+func (gi grafanaIntegration) export(fields yaml.MapSlice, globals map[string]interface{}) (GrafanaIntegration, []string) {
+	res := GrafanaIntegration{Type: gi.typ, Settings: yaml.MapSlice{}}
+	sendResolved := gi.sendResolved
+	set := map[string]bool{}
+	var dropped []string
+	for _, f := range fields {
+		key := fmt.Sprint(f.Key)
+		if key == "send_resolved" {
+			sendResolved, _ = f.Value.(bool)
+			continue
+		}
+		if target, ok := gi.settings[key]; ok {
+			res.Settings = append(res.Settings, yaml.MapItem{Key: target, Value: f.Value})
+			set[target] = true
+			continue
+		}
+		nested, ok := f.Value.(yaml.MapSlice)
+		if !ok {
+			dropped = append(dropped, key)
+			continue
+		}
+		for _, nf := range nested {
+			nkey := key + "." + fmt.Sprint(nf.Key)
+			if target, ok := gi.settings[nkey]; ok {
+				res.Settings = append(res.Settings, yaml.MapItem{Key: target, Value: nf.Value})
+				set[target] = true
+			} else {
+				dropped = append(dropped, nkey)
+			}
+		}
+	}
+
+	var defaults []string
+	for target := range gi.globals {
+		defaults = append(defaults, target)
+	}
+	sort.Strings(defaults)
+	for _, target := range defaults {
+		if v, ok := globals[gi.globals[target]]; ok && !set[target] {
+			res.Settings = append(res.Settings, yaml.MapItem{Key: target, Value: v})
+		}
+	}
+	res.DisableResolveMessage = !sendResolved
+	return res, dropped
+}
+
+// grafanaUID returns a stable uid of the i-th integration of a receiver,
+// which is valid in Grafana.
+func grafanaUID(receiver, key string, i int) string {
+	h := sha1.Sum([]byte(receiver + "/" + key + "/" + strconv.Itoa(i)))
+	return "am-" + hex.EncodeToString(h[:])[:16]
+}
+
+// grafanaPolicy returns the notification policy of a route and its
+// children.
+func grafanaPolicy(r *config.Route) *GrafanaPolicy {
+	p := &GrafanaPolicy{
+		Receiver: r.Receiver,
+		GroupBy:  r.GroupByStr,
+		Continue: r.Continue,
+	}
+	var names []string
+	for name := range r.Match {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.ObjectMatchers = append(p.ObjectMatchers, []string{name, "=", r.Match[name]})
+	}
+	names = names[:0]
+	for name := range r.MatchRE {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		re, _ := r.MatchRE[name].MarshalYAML()
+		p.ObjectMatchers = append(p.ObjectMatchers, []string{name, "=~", fmt.Sprint(re)})
+	}
+	if r.GroupWait != nil {
+		p.GroupWait = r.GroupWait.String()
+	}
+	if r.GroupInterval != nil {
+		p.GroupInterval = r.GroupInterval.String()
+	}
+	if r.RepeatInterval != nil {
+		p.RepeatInterval = r.RepeatInterval.String()
+	}
+	for _, child := range r.Routes {
+		p.Routes = append(p.Routes, grafanaPolicy(child))
+	}
+	return p
+}
+
+// exportConfig returns the config of the user converted to another format,
+// ?format=grafana is the only one supported. Its secrets are redacted as by
+// getConfig.
+func (a *API) exportConfig(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	query := r.URL.Query()
+	if format := query.Get("format"); format != ExportFormatGrafana {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported export format %q, the supported format is %s", format, ExportFormatGrafana))
+		return
+	}
+	orgID := 1
+	if s := query.Get("orgId"); s != "" {
+		if orgID, err = strconv.Atoi(s); err != nil || orgID < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid orgId %q", s))
+			return
+		}
+	}
+	reveal := query.Get("reveal") == "true"
+	if reveal && a.redaction.Enabled && !hasScope(r, a.redaction.RevealScope) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("revealing secrets requires the %s scope", a.redaction.RevealScope))
+		return
+	}
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	if cfg.Config == "" {
+		writeError(w, http.StatusNotFound, "no config stored")
+		return
+	}
+	exported := cfg.Config
+	if a.redaction.Enabled && !reveal {
+		if exported, err = redactConfig(cfg.Config); err != nil {
+			Must(level.Error(logger).Log("msg", "error redacting config", "err", err))
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	p, warnings, err := exportGrafana(exported, orgID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error exporting config", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The warnings are written as comments, so that the file can be
+	// provisioned as is.
+	var buf bytes.Buffer
+	for _, warning := range warnings {
+		fmt.Fprintf(&buf, "# %s\n", warning)
+	}
+	buf.Write(data)
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		Must(level.Error(logger).Log("msg", "error writing exported config", "err", err))
+	}
+}
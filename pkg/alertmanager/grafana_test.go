@@ -0,0 +1,89 @@
+package alertmanager
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestExportGrafana(t *testing.T) {
+	cfg := `
+global:
+  slack_api_url: https://hooks.slack.com/services/x
+route:
+  receiver: team
+  group_by: [alertname]
+  repeat_interval: 2h
+  routes:
+  - receiver: pager
+    match:
+      severity: critical
+    match_re:
+      service: api|web
+    continue: true
+receivers:
+- name: team
+  slack_configs:
+  - channel: '#alerts'
+    send_resolved: true
+    actions: []
+- name: pager
+  webhook_configs:
+  - url: http://example.com/
+    basic_auth:
+      username: am
+      password: secret
+  retry_policy:
+    max_attempts: 3
+`
+	p, warnings, err := exportGrafana(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantWarnings := []string{
+		`receiver "team": slack_configs[0].actions is not supported by Grafana`,
+		`receiver "pager": retry_policy are not supported by Grafana`,
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", warnings, wantWarnings)
+	}
+
+	want := &GrafanaProvisioning{
+		APIVersion: 1,
+		ContactPoints: []GrafanaContactPoint{
+			{OrgID: 2, Name: "team", Receivers: []GrafanaIntegration{{
+				UID:  grafanaUID("team", "slack_configs", 0),
+				Type: "slack",
+				Settings: yaml.MapSlice{
+					{Key: "recipient", Value: "#alerts"},
+					{Key: "url", Value: "https://hooks.slack.com/services/x"},
+				},
+			}}},
+			{OrgID: 2, Name: "pager", Receivers: []GrafanaIntegration{{
+				UID:  grafanaUID("pager", "webhook_configs", 0),
+				Type: "webhook",
+				Settings: yaml.MapSlice{
+					{Key: "url", Value: "http://example.com/"},
+					{Key: "username", Value: "am"},
+					{Key: "password", Value: "secret"},
+				},
+			}}},
+		},
+		Policies: []*GrafanaPolicy{{
+			OrgID:          2,
+			Receiver:       "team",
+			GroupBy:        []string{"alertname"},
+			RepeatInterval: "2h",
+			Routes: []*GrafanaPolicy{{
+				Receiver:       "pager",
+				ObjectMatchers: [][]string{{"severity", "=", "critical"}, {"service", "=~", "api|web"}},
+				Continue:       true,
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
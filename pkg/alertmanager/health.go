@@ -0,0 +1,87 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// Names of the readiness checks.
+const (
+	ReadyCheckConfigs  = "configs"
+	ReadyCheckStorage  = "storage"
+	ReadyCheckCluster  = "cluster"
+	ReadyCheckShutdown = "shutdown"
+)
+
+// Readiness is the outcome of the readiness checks of a replica.
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is the outcome of checking a single dependency.
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	Ready   bool   `json:"ready"`
+	Message string `json:"message,omitempty"`
+}
+
+// readiness checks that the initial configs were applied, that the storage
+// is reachable, that the gossip cluster settled and that the replica is not
+// shutting down.
+func (am *MultitenantAlertmanager) readiness(ctx context.Context) Readiness {
+	rd := Readiness{Ready: true}
+	check := func(name string, err string) {
+		rd.Checks = append(rd.Checks, ReadinessCheck{Name: name, Ready: err == "", Message: err})
+		if err != "" {
+			rd.Ready = false
+		}
+	}
+
+	if atomic.LoadInt32(&am.synced) == 0 {
+		check(ReadyCheckConfigs, "initial configs not applied yet")
+	} else {
+		check(ReadyCheckConfigs, "")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, am.cfg.ClientTimeout)
+	defer cancel()
+	if _, err := am.configsClient.Revision(ctx); err != nil {
+		check(ReadyCheckStorage, err.Error())
+	} else {
+		check(ReadyCheckStorage, "")
+	}
+
+	if am.peer != nil && !am.peer.Ready() {
+		check(ReadyCheckCluster, "gossip cluster not settled yet")
+	} else {
+		check(ReadyCheckCluster, "")
+	}
+
+	if atomic.LoadInt32(&am.draining) != 0 {
+		check(ReadyCheckShutdown, "shutting down")
+	} else {
+		check(ReadyCheckShutdown, "")
+	}
+	return rd
+}
+
+// Healthy answers as long as the replica serves requests, for liveness
+// probes.
+func (am *MultitenantAlertmanager) Healthy(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("OK\n"))
+}
+
+// Ready returns the status of the dependencies of the replica. The
+// response code is 503 unless they are all ready, so that it can be used as
+// a readiness probe.
+func (am *MultitenantAlertmanager) Ready(w http.ResponseWriter, req *http.Request) {
+	rd := am.readiness(req.Context())
+	code := http.StatusOK
+	if !rd.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, rd)
+}
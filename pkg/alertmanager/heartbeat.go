@@ -0,0 +1,216 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+const (
+	// heartbeatCheckInterval is how often the heartbeats are checked.
+	heartbeatCheckInterval = 15 * time.Second
+	// heartbeatNotifyTimeout bounds the notification of a missing
+	// heartbeat.
+	heartbeatNotifyTimeout = time.Minute
+	// heartbeatPingInterval is how often OpsGenie heartbeats are pinged at
+	// most.
+	heartbeatPingInterval = time.Minute
+
+	heartbeatMissingAlertname = "HeartbeatMissing"
+)
+
+var missingHeartbeats = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "appscode",
+	Name:      "alertmanager_heartbeats_missing",
+	Help:      "The number of heartbeats of a user not received within their interval.",
+}, []string{"user"})
+
+func init() {
+	prometheus.MustRegister(missingHeartbeats)
+}
+
+// heartbeatMonitor tracks the heartbeat alerts received by an Alertmanager,
+// and notifies the receivers of the heartbeats missing. The notifications
+// go through the pipeline of the receiver, so they are silenced, inhibited,
+// deduplicated and only sent by the leader like the other notifications.
+type heartbeatMonitor struct {
+	am     *Alertmanager
+	logger log.Logger
+
+	mtx sync.Mutex
+	// seen is the time each heartbeat was last received, or the monitor
+	// started watching it.
+	seen map[string]time.Time
+	// pinged is the time each OpsGenie heartbeat was last pinged.
+	pinged map[string]time.Time
+	// missing are the alerts of the missing heartbeats.
+	missing map[string]*types.Alert
+}
+
+func newHeartbeatMonitor(am *Alertmanager) *heartbeatMonitor {
+	return &heartbeatMonitor{
+		am:      am,
+		logger:  log.With(am.logger, "component", "heartbeat"),
+		seen:    map[string]time.Time{},
+		pinged:  map[string]time.Time{},
+		missing: map[string]*types.Alert{},
+	}
+}
+
+// observe records the firing heartbeat alerts among the alerts received.
+func (m *heartbeatMonitor) observe(heartbeats []*notify.Heartbeat, alerts []*types.Alert) {
+	if len(heartbeats) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, a := range alerts {
+		if a.ResolvedAt(now) {
+			continue
+		}
+		for _, h := range heartbeats {
+			if !h.Matches(a.Labels) {
+				continue
+			}
+			m.mtx.Lock()
+			m.seen[h.Name] = now
+			ping := h.OpsGenie != nil && now.Sub(m.pinged[h.Name]) >= heartbeatPingInterval
+			if ping {
+				m.pinged[h.Name] = now
+			}
+			m.mtx.Unlock()
+			if ping {
+				go m.ping(h)
+			}
+		}
+	}
+}
+
+func (m *heartbeatMonitor) ping(h *notify.Heartbeat) {
+	ctx, cancel := context.WithTimeout(notify.WithTenantID(context.Background(), m.am.cfg.UserID), heartbeatNotifyTimeout)
+	defer cancel()
+	if err := notify.PingOpsGenieHeartbeat(ctx, h.OpsGenie); err != nil {
+		Must(level.Warn(m.logger).Log("msg", "Failed to ping OpsGenie heartbeat", "heartbeat", h.Name, "err", err))
+	}
+}
+
+// run checks the heartbeats until stopc is closed.
+func (m *heartbeatMonitor) run(stopc <-chan struct{}) {
+	t := time.NewTicker(heartbeatCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.check(time.Now())
+		case <-stopc:
+			missingHeartbeats.DeleteLabelValues(m.am.cfg.UserID)
+			return
+		}
+	}
+}
+
+// check notifies the heartbeats missing at now, and the resolution of
+// those received again.
+func (m *heartbeatMonitor) check(now time.Time) {
+	p := m.am.getPipeline()
+	if p == nil {
+		return
+	}
+
+	type notification struct {
+		h     *notify.Heartbeat
+		alert *types.Alert
+	}
+	var notifications []notification
+	m.mtx.Lock()
+	configured := map[string]bool{}
+	for _, h := range p.conf.Heartbeats {
+		configured[h.Name] = true
+		seen, ok := m.seen[h.Name]
+		if !ok {
+			// The heartbeat is given an interval to arrive once it is
+			// configured or the Alertmanager started.
+			m.seen[h.Name] = now
+			continue
+		}
+		a := m.missing[h.Name]
+		switch {
+		case now.Sub(seen) > time.Duration(h.Interval):
+			if a == nil {
+				a = heartbeatMissingAlert(h, seen.Add(time.Duration(h.Interval)))
+				m.missing[h.Name] = a
+			}
+		case a != nil:
+			a.EndsAt = seen
+			delete(m.missing, h.Name)
+		default:
+			continue
+		}
+		notifications = append(notifications, notification{h: h, alert: a})
+	}
+	for name := range m.seen {
+		if !configured[name] {
+			delete(m.seen, name)
+			delete(m.pinged, name)
+			delete(m.missing, name)
+		}
+	}
+	missingHeartbeats.WithLabelValues(m.am.cfg.UserID).Set(float64(len(m.missing)))
+	m.mtx.Unlock()
+
+	for _, n := range notifications {
+		m.notify(p, n.h, n.alert, now)
+	}
+}
+
+// heartbeatMissingAlert returns the alert of a heartbeat missing since.
+func heartbeatMissingAlert(h *notify.Heartbeat, since time.Time) *types.Alert {
+	return &types.Alert{
+		Alert: model.Alert{
+			Labels: model.LabelSet{
+				model.AlertNameLabel: heartbeatMissingAlertname,
+				"heartbeat":          model.LabelValue(h.Name),
+				"severity":           "critical",
+			},
+			Annotations: model.LabelSet{
+				"summary":     model.LabelValue(fmt.Sprintf("Heartbeat %s is missing", h.Name)),
+				"description": model.LabelValue(fmt.Sprintf("The heartbeat %s was not received for %s, alerts may not be delivered to the Alertmanager.", h.Name, h.Interval)),
+			},
+			StartsAt: since,
+		},
+		UpdatedAt: since,
+	}
+}
+
+// notify sends the alert of a heartbeat through the pipeline of its
+// receiver, repeated like the alerts of the root route.
+func (m *heartbeatMonitor) notify(p *pipeline, h *notify.Heartbeat, a *types.Alert, now time.Time) {
+	stage, ok := p.stage[h.Receiver]
+	if !ok {
+		return
+	}
+	groupLabels := model.LabelSet{
+		model.AlertNameLabel: heartbeatMissingAlertname,
+		"heartbeat":          model.LabelValue(h.Name),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), heartbeatNotifyTimeout)
+	defer cancel()
+	ctx = amnotify.WithGroupKey(ctx, fmt.Sprintf("{}/heartbeat:%s", groupLabels))
+	ctx = amnotify.WithGroupLabels(ctx, groupLabels)
+	ctx = amnotify.WithReceiverName(ctx, h.Receiver)
+	ctx = amnotify.WithRepeatInterval(ctx, p.route.RouteOpts.RepeatInterval)
+	ctx = amnotify.WithNow(ctx, now)
+
+	if _, _, err := stage.Exec(ctx, m.logger, a); err != nil {
+		Must(level.Error(m.logger).Log("msg", "Failed to notify missing heartbeat", "heartbeat", h.Name, "err", err))
+	}
+}
@@ -0,0 +1,86 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestHeartbeatMonitor(t *testing.T) {
+	statuses := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct {
+			Status      string         `json:"status"`
+			GroupLabels model.LabelSet `json:"groupLabels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.GroupLabels["heartbeat"] != "watchdog" {
+			t.Errorf("unexpected notification: %+v, %v", msg, err)
+		}
+		statuses <- msg.Status
+	}))
+	defer srv.Close()
+
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+  webhook_configs:
+  - url: ` + srv.URL + `
+heartbeats:
+- name: watchdog
+  match:
+    alertname: Watchdog
+  interval: 1m
+  receiver: team
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-statuses:
+			if got != want {
+				t.Fatalf("got %s notification, want %s", got, want)
+			}
+		default:
+			if want != "" {
+				t.Fatalf("no %s notification", want)
+			}
+		}
+	}
+
+	start := time.Now().Add(-10 * time.Minute)
+	m := am.heartbeats
+	m.check(start)
+	m.check(start.Add(30 * time.Second))
+	expect("")
+
+	m.check(start.Add(2 * time.Minute))
+	expect("firing")
+
+	watchdog := &types.Alert{Alert: model.Alert{
+		Labels:   model.LabelSet{"alertname": "Watchdog"},
+		StartsAt: start,
+		EndsAt:   time.Now().Add(time.Hour),
+	}}
+	m.observe(conf.Heartbeats, []*types.Alert{watchdog})
+	m.check(time.Now())
+	expect("resolved")
+	m.check(time.Now())
+	expect("")
+}
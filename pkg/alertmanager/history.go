@@ -0,0 +1,294 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/pkg/parse"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+const (
+	// archiveQueueSize is the number of resolved alert groups waiting to be
+	// archived, the groups resolved once it is full are dropped.
+	archiveQueueSize = 1024
+	// archiveTimeout bounds archiving a single alert group.
+	archiveTimeout = 10 * time.Second
+
+	// The default and the maximum number of alert groups returned by the
+	// history API.
+	historyDefaultLimit = 100
+	historyMaxLimit     = 1000
+	// historyDefaultRange is how far back the history API looks if since
+	// is not set.
+	historyDefaultRange = 24 * time.Hour
+)
+
+var (
+	archivedGroups = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alert_history_archived_total",
+		Help:      "The total number of resolved alert groups archived.",
+	})
+	archiveFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alert_history_failures_total",
+		Help:      "The total number of resolved alert groups which could not be archived.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(archivedGroups)
+	prometheus.MustRegister(archiveFailures)
+}
+
+// An ArchivedGroup is a resolved alert group, as notified to a receiver.
+type ArchivedGroup struct {
+	GroupKey    string          `json:"groupKey"`
+	Receiver    string          `json:"receiver"`
+	GroupLabels model.LabelSet  `json:"groupLabels"`
+	Alerts      []ArchivedAlert `json:"alerts"`
+	// FiringAt is when the first alert of the group started firing, and
+	// ResolvedAt when the last one resolved.
+	FiringAt   time.Time `json:"firingAt"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// An ArchivedAlert is a resolved alert of an archived group.
+type ArchivedAlert struct {
+	Fingerprint  string         `json:"fingerprint"`
+	Labels       model.LabelSet `json:"labels"`
+	Annotations  model.LabelSet `json:"annotations,omitempty"`
+	StartsAt     time.Time      `json:"startsAt"`
+	EndsAt       time.Time      `json:"endsAt"`
+	GeneratorURL string         `json:"generatorURL,omitempty"`
+}
+
+// HistoryQuery selects archived alert groups.
+type HistoryQuery struct {
+	// Since and Until bound the resolution time of the groups.
+	Since, Until time.Time
+	// Matchers select the alerts of the groups. The groups without
+	// matching alerts are left out.
+	Matchers []*labels.Matcher
+	// Limit is the maximum number of groups returned.
+	Limit int
+}
+
+// Filter returns g with the alerts selected by the matchers of q only, and
+// false if there are none.
+func (q *HistoryQuery) Filter(g ArchivedGroup) (ArchivedGroup, bool) {
+	if len(q.Matchers) == 0 {
+		return g, true
+	}
+	alerts := make([]ArchivedAlert, 0, len(g.Alerts))
+	for _, a := range g.Alerts {
+		matches := true
+		for _, m := range q.Matchers {
+			if !m.Matches(string(a.Labels[model.LabelName(m.Name)])) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			alerts = append(alerts, a)
+		}
+	}
+	g.Alerts = alerts
+	return g, len(alerts) > 0
+}
+
+// AlertArchive stores the resolved alert groups of the users, so that they
+// can be looked up once the alerts were removed from memory.
+type AlertArchive interface {
+	// ArchiveAlertGroup stores a resolved alert group of a user.
+	ArchiveAlertGroup(ctx context.Context, userID string, g *ArchivedGroup) error
+	// ListArchivedAlertGroups returns the archived alert groups of a user
+	// selected by q, the last resolved first.
+	ListArchivedAlertGroups(ctx context.Context, userID string, q HistoryQuery) ([]ArchivedGroup, error)
+}
+
+// archiveStage hands the resolved alert groups to archive once notified.
+type archiveStage struct {
+	amnotify.Stage
+	receiver string
+	archive  func(*ArchivedGroup)
+}
+
+func (s *archiveStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	ctx, out, err := s.Stage.Exec(ctx, l, alerts...)
+	if err != nil || len(alerts) == 0 {
+		return ctx, out, err
+	}
+	for _, a := range alerts {
+		if !a.Resolved() {
+			return ctx, out, err
+		}
+	}
+
+	g := &ArchivedGroup{Receiver: s.receiver, Alerts: make([]ArchivedAlert, 0, len(alerts))}
+	g.GroupKey, _ = amnotify.GroupKey(ctx)
+	g.GroupLabels, _ = amnotify.GroupLabels(ctx)
+	for _, a := range alerts {
+		g.Alerts = append(g.Alerts, ArchivedAlert{
+			Fingerprint:  a.Fingerprint().String(),
+			Labels:       a.Labels,
+			Annotations:  a.Annotations,
+			StartsAt:     a.StartsAt,
+			EndsAt:       a.EndsAt,
+			GeneratorURL: a.GeneratorURL,
+		})
+		if g.FiringAt.IsZero() || a.StartsAt.Before(g.FiringAt) {
+			g.FiringAt = a.StartsAt
+		}
+		if a.EndsAt.After(g.ResolvedAt) {
+			g.ResolvedAt = a.EndsAt
+		}
+	}
+	s.archive(g)
+	return ctx, out, err
+}
+
+// archiveResolved makes the routing stage hand the resolved alert groups of
+// each receiver to archive once notified.
+func archiveResolved(rs amnotify.RoutingStage, archive func(*ArchivedGroup)) {
+	for name, s := range rs {
+		rs[name] = &archiveStage{Stage: s, receiver: name, archive: archive}
+	}
+}
+
+type archiveRequest struct {
+	userID string
+	group  *ArchivedGroup
+}
+
+// archiveFunc returns the function recording the resolved alert groups of
+// a user in the report metrics, and queuing them to be archived if the
+// history is enabled.
+func (am *MultitenantAlertmanager) archiveFunc(userID string) func(*ArchivedGroup) {
+	return func(g *ArchivedGroup) {
+		observeResolvedGroup(userID, g)
+		if am.archive == nil {
+			return
+		}
+		select {
+		case am.archiveCh <- archiveRequest{userID: userID, group: g}:
+		default:
+			archiveFailures.WithLabelValues("queue_full").Inc()
+		}
+	}
+}
+
+// runArchiver archives the queued alert groups until the
+// MultitenantAlertmanager is stopped. The groups still queued then are
+// archived before it returns.
+func (am *MultitenantAlertmanager) runArchiver() {
+	defer close(am.archiveDone)
+	for {
+		select {
+		case r := <-am.archiveCh:
+			am.archiveGroup(r)
+		case <-am.stop:
+			for {
+				select {
+				case r := <-am.archiveCh:
+					am.archiveGroup(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (am *MultitenantAlertmanager) archiveGroup(r archiveRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+	if err := am.archive.ArchiveAlertGroup(ctx, r.userID, r.group); err != nil {
+		archiveFailures.WithLabelValues("storage").Inc()
+		Must(level.Warn(logger2.Logger).Log("msg", "MultitenantAlertmanager: failed to archive resolved alert group", "user", r.userID, "group", r.group.GroupKey, "err", err))
+		return
+	}
+	archivedGroups.Inc()
+}
+
+// parseHistoryTime parses a RFC3339 time, or a duration like 24h before now.
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if d, err := model.ParseDuration(s); err == nil {
+		return now.Add(-time.Duration(d)), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// AlertHistory returns the archived alert groups of the user resolved
+// between since and until, which default to the last day, with the alerts
+// selected by the matcher parameters, like alertname="HighLatency".
+func (am *MultitenantAlertmanager) AlertHistory(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if am.archive == nil {
+		writeError(w, http.StatusNotFound, "the alert history is disabled")
+		return
+	}
+
+	now := time.Now()
+	params := req.URL.Query()
+	q := HistoryQuery{Since: now.Add(-historyDefaultRange), Until: now, Limit: historyDefaultLimit}
+	if s := params.Get("since"); s != "" {
+		if q.Since, err = parseHistoryTime(s, now); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+			return
+		}
+	}
+	if s := params.Get("until"); s != "" {
+		if q.Until, err = parseHistoryTime(s, now); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+			return
+		}
+	}
+	if !q.Since.Before(q.Until) {
+		writeError(w, http.StatusBadRequest, "since must be before until")
+		return
+	}
+	if s := params.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if q.Limit > historyMaxLimit {
+			q.Limit = historyMaxLimit
+		}
+	}
+	for _, s := range params["matcher"] {
+		m, err := parse.Matcher(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid matcher: "+err.Error())
+			return
+		}
+		q.Matchers = append(q.Matchers, m)
+	}
+
+	groups, err := am.archive.ListArchivedAlertGroups(req.Context(), userID, q)
+	if err != nil {
+		Must(level.Error(logger2.WithUserID(userID, logger2.Logger)).Log("msg", "error listing alert history", "err", err))
+		storageError(w, err)
+		return
+	}
+	if groups == nil {
+		groups = []ArchivedGroup{}
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
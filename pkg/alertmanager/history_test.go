@@ -0,0 +1,104 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/pkg/parse"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+func TestArchiveStage(t *testing.T) {
+	now := time.Now()
+	alert := func(name string, startsAt, endsAt time.Time) *types.Alert {
+		return &types.Alert{Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": model.LabelValue(name)},
+			StartsAt: startsAt,
+			EndsAt:   endsAt,
+		}}
+	}
+	resolvedA := alert("a", now.Add(-time.Hour), now.Add(-time.Minute))
+	resolvedB := alert("b", now.Add(-2*time.Hour), now.Add(-2*time.Minute))
+	firing := alert("c", now.Add(-time.Hour), now.Add(time.Hour))
+
+	for _, tc := range []struct {
+		name     string
+		alerts   []*types.Alert
+		err      error
+		archived bool
+	}{
+		{name: "resolved", alerts: []*types.Alert{resolvedA, resolvedB}, archived: true},
+		{name: "firing", alerts: []*types.Alert{resolvedA, firing}},
+		{name: "failed", alerts: []*types.Alert{resolvedA}, err: context.DeadlineExceeded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *ArchivedGroup
+			rs := amnotify.RoutingStage{"team": amnotify.StageFunc(func(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+				return ctx, alerts, tc.err
+			})}
+			archiveResolved(rs, func(g *ArchivedGroup) { got = g })
+
+			ctx := amnotify.WithReceiverName(context.Background(), "team")
+			ctx = amnotify.WithGroupKey(ctx, "{}:{alertname}")
+			ctx = amnotify.WithGroupLabels(ctx, model.LabelSet{"alertname": "a"})
+			_, _, _ = rs.Exec(ctx, log.NewNopLogger(), tc.alerts...)
+
+			if !tc.archived {
+				if got != nil {
+					t.Fatalf("group archived: %+v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("group not archived")
+			}
+			if got.Receiver != "team" || got.GroupKey != "{}:{alertname}" || len(got.Alerts) != 2 {
+				t.Fatalf("unexpected group: %+v", got)
+			}
+			if !got.FiringAt.Equal(resolvedB.StartsAt) || !got.ResolvedAt.Equal(resolvedA.EndsAt) {
+				t.Fatalf("group fired at %v and resolved at %v", got.FiringAt, got.ResolvedAt)
+			}
+		})
+	}
+}
+
+func TestHistoryQueryFilter(t *testing.T) {
+	g := ArchivedGroup{Alerts: []ArchivedAlert{
+		{Labels: model.LabelSet{"alertname": "HighLatency", "severity": "critical"}},
+		{Labels: model.LabelSet{"alertname": "HighLatency", "severity": "warning"}},
+		{Labels: model.LabelSet{"alertname": "DiskFull", "severity": "critical"}},
+	}}
+	matchers := func(ss ...string) []*labels.Matcher {
+		var ms []*labels.Matcher
+		for _, s := range ss {
+			m, err := parse.Matcher(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms = append(ms, m)
+		}
+		return ms
+	}
+
+	for _, tc := range []struct {
+		matchers []*labels.Matcher
+		alerts   int
+	}{
+		{matchers: nil, alerts: 3},
+		{matchers: matchers(`alertname="HighLatency"`), alerts: 2},
+		{matchers: matchers(`alertname="HighLatency"`, `severity!="warning"`), alerts: 1},
+		{matchers: matchers(`severity=~"crit.*"`), alerts: 2},
+		{matchers: matchers(`team="db"`), alerts: 0},
+	} {
+		q := HistoryQuery{Matchers: tc.matchers}
+		got, ok := q.Filter(g)
+		if ok != (tc.alerts > 0) || len(got.Alerts) != tc.alerts {
+			t.Errorf("matchers %v: got %d alerts, %v, want %d", tc.matchers, len(got.Alerts), ok, tc.alerts)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package alertmanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	instanceStateActive = "active"
+	instanceStateParked = "parked"
+)
+
+var (
+	errNoAlertmanager = errors.New("no Alertmanager for this user ID")
+
+	totalInstances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_instances",
+		Help:      "How many user Alertmanagers are active, or parked for being idle.",
+	}, []string{"state"})
+	parkedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_parked_total",
+		Help:      "The total number of user Alertmanagers parked for being idle.",
+	})
+	unparkedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_unparked_total",
+		Help:      "The total number of parked user Alertmanagers rebuilt on use.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(totalInstances, parkedTotal, unparkedTotal)
+}
+
+// touch marks the Alertmanager as used.
+func (am *Alertmanager) touch() {
+	atomic.StoreInt64(&am.lastActive, time.Now().UnixNano())
+}
+
+// idleSince returns the time the Alertmanager was last used, or the zero
+// time if it holds any alerts other than synthetic probes, its
+// notifications are streamed, or it watches heartbeats, which must be
+// notified when they stop arriving.
+func (am *Alertmanager) idleSince() time.Time {
+	if am.events.subscribed() {
+		return time.Time{}
+	}
+	if p := am.getPipeline(); p != nil && len(p.conf.Heartbeats) > 0 {
+		return time.Time{}
+	}
+	it := am.alerts.GetPending()
+	defer it.Close()
+	for a := range it.Next() {
+		if !isProbeAlert(a) {
+			return time.Time{}
+		}
+	}
+	return time.Unix(0, atomic.LoadInt64(&am.lastActive))
+}
+
+// userLock returns the lock serializing changes to the Alertmanager of a
+// user: applying configs, parking and unparking.
+func (am *MultitenantAlertmanager) userLock(userID string) *sync.Mutex {
+	mtx, _ := am.userLocks.LoadOrStore(userID, &sync.Mutex{})
+	return mtx.(*sync.Mutex)
+}
+
+// getAlertmanager returns the Alertmanager of a user, rebuilding it if it
+// was parked.
+func (am *MultitenantAlertmanager) getAlertmanager(userID string) (*Alertmanager, error) {
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	parked := am.parked[userID]
+	am.alertmanagersMtx.Unlock()
+	if ok {
+		userAM.touch()
+		return userAM, nil
+	}
+	if !parked {
+		return nil, errNoAlertmanager
+	}
+	return am.unpark(userID)
+}
+
+func (am *MultitenantAlertmanager) unpark(userID string) (*Alertmanager, error) {
+	mtx := am.userLock(userID)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// The Alertmanager may have been rebuilt or removed meanwhile.
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	parked := am.parked[userID]
+	am.alertmanagersMtx.Unlock()
+	if ok {
+		userAM.touch()
+		return userAM, nil
+	}
+	if !parked {
+		return nil, errNoAlertmanager
+	}
+
+	am.cfgMutex.RLock()
+	cfg := am.cfgs[userID]
+	am.cfgMutex.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ApplyTimeout)
+	defer cancel()
+	amConfig, err := am.loadConfig(ctx, &cfg)
+	if err != nil {
+		return nil, errors.Errorf("failed load alertmanager config for user %v: %v", userID, err)
+	}
+	userAM, err = am.newAlertmanager(ctx, &cfg, amConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	am.alertmanagersMtx.Lock()
+	am.alertmanagers[userID] = userAM
+	delete(am.parked, userID)
+	am.alertmanagersMtx.Unlock()
+	unparkedTotal.Inc()
+	am.updateInstanceMetrics()
+	Must(level.Debug(logger.Logger).Log("msg", "MultitenantAlertmanager: unparked alertmanager", "user", userID))
+	return userAM, nil
+}
+
+// parkIdle stops the Alertmanagers without alerts which were not used for
+// the idle timeout. Their state is kept on disk, and they are rebuilt on
+// first use.
+func (am *MultitenantAlertmanager) parkIdle() {
+	deadline := time.Now().Add(-am.cfg.IdleTimeout)
+
+	am.alertmanagersMtx.Lock()
+	var idle []string
+	for userID, userAM := range am.alertmanagers {
+		if t := userAM.idleSince(); !t.IsZero() && t.Before(deadline) {
+			idle = append(idle, userID)
+		}
+	}
+	am.alertmanagersMtx.Unlock()
+
+	for _, userID := range idle {
+		am.park(userID, deadline)
+	}
+	am.updateInstanceMetrics()
+}
+
+func (am *MultitenantAlertmanager) park(userID string, deadline time.Time) {
+	mtx := am.userLock(userID)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// The Alertmanager may have been used or removed meanwhile.
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	if !ok {
+		am.alertmanagersMtx.Unlock()
+		return
+	}
+	if t := userAM.idleSince(); t.IsZero() || !t.Before(deadline) {
+		am.alertmanagersMtx.Unlock()
+		return
+	}
+	delete(am.alertmanagers, userID)
+	am.parked[userID] = true
+	am.alertmanagersMtx.Unlock()
+
+	userAM.Stop()
+	parkedTotal.Inc()
+	Must(level.Debug(logger.Logger).Log("msg", "MultitenantAlertmanager: parked idle alertmanager", "user", userID))
+}
+
+func (am *MultitenantAlertmanager) updateInstanceMetrics() {
+	am.alertmanagersMtx.Lock()
+	active, parked := len(am.alertmanagers), len(am.parked)
+	am.alertmanagersMtx.Unlock()
+	totalInstances.WithLabelValues(instanceStateActive).Set(float64(active))
+	totalInstances.WithLabelValues(instanceStateParked).Set(float64(parked))
+}
@@ -0,0 +1,63 @@
+package alertmanager
+
+import (
+	"net/http"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var impersonatedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "admin_impersonated_requests_total",
+	Help:      "The total number of requests made by admins on behalf of a tenant.",
+}, []string{"tenant"})
+
+func init() {
+	prometheus.MustRegister(impersonatedRequests)
+}
+
+// Impersonate lets admins view the UI and the API of a tenant read-only,
+// to debug missing notifications without the credentials of the tenant.
+// Requests with the ImpersonateHeaderName header must carry the admin token
+// and are limited to GET and HEAD. They are served by next as requests of
+// the tenant, with the scopes granted to the request dropped, and are
+// written to the audit log.
+func (a *AdminAPI) Impersonate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get(ImpersonateHeaderName)
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.am.cfg.AdminAuthMode == AdminAuthToken && !a.hasAdminToken(r) {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "impersonated requests are read-only", http.StatusForbidden)
+			return
+		}
+
+		Must(level.Info(logger2.Logger).Log(
+			"msg", "admin impersonating tenant",
+			"audit", true,
+			"tenant", tenant,
+			"operator", r.Header.Get(OperatorHeaderName),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+		))
+		impersonatedRequests.WithLabelValues(tenant).Inc()
+
+		r.Header.Del(ImpersonateHeaderName)
+		r.Header.Del(ScopesHeaderName)
+		r.Header.Set(UserIDHeaderName, tenant)
+		if a.am.cfg.UIUserHeader != "" {
+			r.Header.Set(a.am.cfg.UIUserHeader, tenant)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,62 @@
+package alertmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImpersonate(t *testing.T) {
+	a := &AdminAPI{am: &MultitenantAlertmanager{cfg: &MultitenantAlertmanagerConfig{
+		AdminAuthMode: AdminAuthToken,
+		adminToken:    "secret",
+		UIUserHeader:  "X-Forwarded-User",
+	}}}
+	var served *http.Request
+	h := a.Impersonate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r
+	}))
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		tenant string
+		token  string
+		code   int
+		user   string
+	}{
+		{name: "not impersonated", method: "POST", code: http.StatusOK, user: "self"},
+		{name: "impersonated", method: "GET", tenant: "customer", token: "secret", code: http.StatusOK, user: "customer"},
+		{name: "invalid token", method: "GET", tenant: "customer", token: "guess", code: http.StatusUnauthorized},
+		{name: "write", method: "POST", tenant: "customer", token: "secret", code: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			served = nil
+			req := httptest.NewRequest(tc.method, "/api/prom/alertmanager/api/v2/alerts", nil)
+			req.Header.Set(UserIDHeaderName, "self")
+			req.Header.Set(ScopesHeaderName, "config:write")
+			if tc.tenant != "" {
+				req.Header.Set(ImpersonateHeaderName, tc.tenant)
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tc.code {
+				t.Fatalf("got status %d, want %d", w.Code, tc.code)
+			}
+			if tc.code != http.StatusOK {
+				if served != nil {
+					t.Fatal("rejected request served")
+				}
+				return
+			}
+			if got := served.Header.Get(UserIDHeaderName); got != tc.user {
+				t.Errorf("served for %q, want %q", got, tc.user)
+			}
+			if tc.tenant != "" && (served.Header.Get("X-Forwarded-User") != tc.tenant || served.Header.Get(ScopesHeaderName) != "") {
+				t.Errorf("unexpected headers of impersonated request: %v", served.Header)
+			}
+		})
+	}
+}
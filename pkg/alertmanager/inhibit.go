@@ -0,0 +1,176 @@
+package alertmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+var globalInhibitRulesCount = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "appscode",
+	Name:      "global_inhibit_rules",
+	Help:      "How many inhibition rules are applied to all users.",
+})
+
+func init() {
+	prometheus.MustRegister(globalInhibitRulesCount)
+}
+
+// inhibitRulesDocument is the format of the global inhibition rules, in the
+// rules file and in the admin API. It matches the inhibit_rules of configs.
+type inhibitRulesDocument struct {
+	InhibitRules []*config.InhibitRule `yaml:"inhibit_rules" json:"inhibit_rules"`
+}
+
+// loadInhibitRules parses and validates global inhibition rules.
+func loadInhibitRules(s string) ([]*config.InhibitRule, error) {
+	var doc inhibitRulesDocument
+	if err := yaml.UnmarshalStrict([]byte(s), &doc); err != nil {
+		return nil, err
+	}
+	return doc.InhibitRules, nil
+}
+
+// GlobalInhibitRules are the inhibition rules applied to all users.
+type GlobalInhibitRules struct {
+	// FileRules are loaded from the global rules file of the replica.
+	FileRules []*config.InhibitRule `json:"fileRules"`
+	// Rules are stored and set through the admin API.
+	Rules []*config.InhibitRule `json:"rules"`
+}
+
+// globalInhibitRules returns the inhibition rules applied in addition to
+// the rules of every user's config.
+func (am *MultitenantAlertmanager) globalInhibitRules() []*config.InhibitRule {
+	am.inhibitRulesMtx.RLock()
+	defer am.inhibitRulesMtx.RUnlock()
+	rules := make([]*config.InhibitRule, 0, len(am.cfg.globalInhibitRules)+len(am.storedInhibitRules))
+	rules = append(rules, am.cfg.globalInhibitRules...)
+	return append(rules, am.storedInhibitRules...)
+}
+
+// syncGlobalInhibitRules loads the stored global inhibition rules, and
+// rebuilds the pipelines of all running Alertmanagers if they changed.
+func (am *MultitenantAlertmanager) syncGlobalInhibitRules() error {
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ClientTimeout)
+	defer cancel()
+	raw, err := am.configsClient.GetGlobalInhibitRules(ctx)
+	if err != nil {
+		return err
+	}
+	return am.setGlobalInhibitRules(raw)
+}
+
+// setGlobalInhibitRules replaces the stored global inhibition rules with
+// raw, and rebuilds the pipelines of all running Alertmanagers if they
+// changed. Parked Alertmanagers pick them up when they are rebuilt.
+func (am *MultitenantAlertmanager) setGlobalInhibitRules(raw string) error {
+	am.inhibitRulesMtx.Lock()
+	if raw == am.storedInhibitRulesRaw {
+		am.inhibitRulesMtx.Unlock()
+		return nil
+	}
+	rules, err := loadInhibitRules(raw)
+	if err != nil {
+		am.inhibitRulesMtx.Unlock()
+		return err
+	}
+	am.storedInhibitRules = rules
+	am.storedInhibitRulesRaw = raw
+	am.inhibitRulesMtx.Unlock()
+	globalInhibitRulesCount.Set(float64(len(am.cfg.globalInhibitRules) + len(rules)))
+
+	am.reloadPipelines("global inhibit rules")
+	return nil
+}
+
+// reloadPipelines rebuilds the pipelines of all running Alertmanagers, so
+// that they pick up the changed global settings named by what.
+func (am *MultitenantAlertmanager) reloadPipelines(what string) {
+	am.alertmanagersMtx.Lock()
+	userIDs := make([]string, 0, len(am.alertmanagers))
+	for userID := range am.alertmanagers {
+		userIDs = append(userIDs, userID)
+	}
+	am.alertmanagersMtx.Unlock()
+
+	for _, userID := range userIDs {
+		if err := am.reloadPipeline(userID); err != nil {
+			Must(level.Warn(logger2.Logger).Log("msg", "MultitenantAlertmanager: error applying "+what, "user", userID, "err", err))
+		}
+	}
+}
+
+func (am *MultitenantAlertmanager) reloadPipeline(userID string) error {
+	mtx := am.userLock(userID)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	am.alertmanagersMtx.Unlock()
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ApplyTimeout)
+	defer cancel()
+	return userAM.reloadPipeline(ctx, userID)
+}
+
+// getInhibitRules returns the global inhibition rules.
+func (a *AdminAPI) getInhibitRules(w http.ResponseWriter, r *http.Request) {
+	a.am.inhibitRulesMtx.RLock()
+	rules := GlobalInhibitRules{
+		FileRules: a.am.cfg.globalInhibitRules,
+		Rules:     a.am.storedInhibitRules,
+	}
+	a.am.inhibitRulesMtx.RUnlock()
+	if rules.FileRules == nil {
+		rules.FileRules = []*config.InhibitRule{}
+	}
+	if rules.Rules == nil {
+		rules.Rules = []*config.InhibitRule{}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// setInhibitRules replaces the stored global inhibition rules. They are
+// applied on this replica right away, and on the others when they resync.
+func (a *AdminAPI) setInhibitRules(w http.ResponseWriter, r *http.Request) {
+	// The rules are decoded like the config, JSON being a subset of YAML.
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rules, err := loadInhibitRules(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := yaml.Marshal(&inhibitRulesDocument{InhibitRules: rules})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.client.SetGlobalInhibitRules(r.Context(), string(data)); err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error storing global inhibit rules", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.am.setGlobalInhibitRules(string(data)); err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error applying global inhibit rules", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "global inhibit rules updated", "rules", len(rules)))
+	w.WriteHeader(http.StatusNoContent)
+}
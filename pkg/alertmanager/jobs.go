@@ -0,0 +1,379 @@
+package alertmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+
+	ItemSucceeded = "succeeded"
+	ItemFailed    = "failed"
+	ItemSkipped   = "skipped"
+
+	// How long finished jobs are kept around for polling.
+	jobRetention = time.Hour
+	// Timeout of the requests storing the progress of a job.
+	jobStoreTimeout = 10 * time.Second
+	// Number of configs listed per request to select the users of a job.
+	jobUsersPageSize = 500
+	// How often the leader looks for the stored jobs to run.
+	jobPollInterval = 5 * time.Second
+)
+
+// JobItemResult is the outcome of a job for a single item, usually a user.
+type JobItemResult struct {
+	Item   string `json:"item"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Job is a long running admin operation which is applied item by item. Jobs
+// are stored, so that they can be created, polled and cancelled on any
+// replica, and they are run by the leader.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Total      int             `json:"total"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Results    []JobItemResult `json:"results"`
+	// Request is the request the job was created with, from which the
+	// leader running the job builds it.
+	Request *JobRequest `json:"request,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// JobStore stores the jobs shared by all replicas.
+type JobStore interface {
+	// SetJob stores a job. It is removed after ttl, unless ttl is 0.
+	SetJob(ctx context.Context, job *Job, ttl time.Duration) error
+	// GetJob returns a job, or nil if it does not exist.
+	GetJob(ctx context.Context, id string) (*Job, error)
+	ListJobs(ctx context.Context) ([]Job, error)
+	// CancelJob requests the cancellation of a job, which is seen by the
+	// replica running the job with JobCancelled. The request is removed
+	// after ttl.
+	CancelJob(ctx context.Context, id string, ttl time.Duration) error
+	JobCancelled(ctx context.Context, id string) (bool, error)
+}
+
+// jobFunc lists the items of a job and the function applying the job to
+// a single item.
+type jobFunc struct {
+	items func(ctx context.Context) ([]string, error)
+	apply func(ctx context.Context, item string) error
+}
+
+// jobManager stores the jobs, and runs the stored jobs while this replica
+// is the leader, so that the jobs act on the Alertmanagers of the leader.
+type jobManager struct {
+	store    JobStore
+	build    func(req *JobRequest) (jobFunc, error)
+	isLeader func() bool
+	// kick makes run look for the stored jobs without waiting.
+	kick chan struct{}
+
+	// mtx guards the jobs running on this replica.
+	mtx    sync.Mutex
+	jobs   map[string]*Job
+	logger log.Logger
+}
+
+func newJobManager(store JobStore, build func(*JobRequest) (jobFunc, error), isLeader func() bool, l log.Logger) *jobManager {
+	return &jobManager{
+		store:    store,
+		build:    build,
+		isLeader: isLeader,
+		kick:     make(chan struct{}, 1),
+		jobs:     map[string]*Job{},
+		logger:   l,
+	}
+}
+
+// submit stores a pending job for the request, which is started by the
+// leader.
+func (m *jobManager) submit(ctx context.Context, req *JobRequest) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:        id,
+		Type:      req.Type,
+		Status:    JobPending,
+		CreatedAt: time.Now(),
+		Results:   []JobItemResult{},
+		Request:   req,
+	}
+	if err := m.store.SetJob(ctx, job, 0); err != nil {
+		return Job{}, errors.Wrap(err, "failed to store job")
+	}
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+	return job.copy(), nil
+}
+
+// run starts the stored jobs which are pending, or whose replica stopped
+// running them, while this replica is the leader. It returns once stop is
+// closed, leaving the jobs it runs to be resumed by the next leader.
+func (m *jobManager) run(stop <-chan struct{}) {
+	t := time.NewTicker(jobPollInterval)
+	defer t.Stop()
+	for {
+		if m.isLeader() {
+			m.startStored()
+		}
+		select {
+		case <-t.C:
+		case <-m.kick:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (m *jobManager) startStored() {
+	ctx, cancel := context.WithTimeout(context.Background(), jobStoreTimeout)
+	defer cancel()
+	jobs, err := m.store.ListJobs(ctx)
+	if err != nil {
+		Must(level.Warn(m.logger).Log("msg", "failed to list jobs", "err", err))
+		return
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	for _, listed := range jobs {
+		if listed.FinishedAt != nil || listed.Request == nil {
+			continue
+		}
+		m.mtx.Lock()
+		_, running := m.jobs[listed.ID]
+		m.mtx.Unlock()
+		if running {
+			continue
+		}
+		// The listed job may have finished on this replica since, which
+		// stores a finished job before it stops running it.
+		job, err := m.store.GetJob(ctx, listed.ID)
+		if err != nil {
+			Must(level.Warn(m.logger).Log("msg", "failed to get job", "job", listed.ID, "err", err))
+			continue
+		}
+		if job == nil || job.FinishedAt != nil {
+			continue
+		}
+		var runCtx context.Context
+		runCtx, job.cancel = context.WithCancel(context.Background())
+		m.mtx.Lock()
+		m.jobs[job.ID] = job
+		m.mtx.Unlock()
+		go (&jobRun{m: m, job: job}).run(runCtx)
+	}
+}
+
+// jobRun is a stored job run by this replica.
+type jobRun struct {
+	m   *jobManager
+	job *Job
+}
+
+// run applies the job to the items which have no result yet, so that a
+// job interrupted by a change of leader is resumed by the new leader. The
+// job is handed over once this replica is no longer the leader.
+func (r *jobRun) run(ctx context.Context) {
+	m, job := r.m, r.job
+	logger := log.With(m.logger, "job", job.ID, "type", job.Type)
+	if m.cancelled(ctx, job.ID) {
+		r.finish(JobCancelled, nil)
+		Must(level.Info(logger).Log("msg", "job cancelled"))
+		return
+	}
+	fn, err := m.build(job.Request)
+	if err != nil {
+		r.finish(JobFailed, err)
+		Must(level.Error(logger).Log("msg", "job failed", "err", err))
+		return
+	}
+	r.update(func() { job.Status = JobRunning })
+
+	items, err := fn.items(ctx)
+	if err != nil {
+		r.finish(JobFailed, errors.Wrap(err, "failed to list items"))
+		Must(level.Error(logger).Log("msg", "job failed", "err", err))
+		return
+	}
+	r.update(func() { job.Total = len(items) })
+
+	done := map[string]bool{}
+	failed := 0
+	for _, res := range job.Results {
+		done[res.Item] = true
+		if res.Status == ItemFailed {
+			failed++
+		}
+	}
+	for _, item := range items {
+		if done[item] {
+			continue
+		}
+		if m.cancelled(ctx, job.ID) {
+			r.finish(JobCancelled, nil)
+			Must(level.Info(logger).Log("msg", "job cancelled"))
+			return
+		}
+		if !m.isLeader() {
+			r.handOver()
+			Must(level.Info(logger).Log("msg", "not the leader, job handed over"))
+			return
+		}
+
+		res := JobItemResult{Item: item, Status: ItemSucceeded}
+		if err := fn.apply(ctx, item); err == errSkipItem {
+			res.Status = ItemSkipped
+		} else if err != nil {
+			failed++
+			res.Status = ItemFailed
+			res.Error = err.Error()
+		}
+		r.update(func() { job.Results = append(job.Results, res) })
+	}
+
+	if failed > 0 {
+		r.finish(JobFailed, errors.Errorf("%d of %d items failed", failed, len(items)))
+	} else {
+		r.finish(JobSucceeded, nil)
+	}
+	Must(level.Info(logger).Log("msg", "job finished", "items", len(items), "failed", failed))
+}
+
+// cancelled returns true if the job was cancelled on this replica or
+// through the store.
+func (m *jobManager) cancelled(ctx context.Context, id string) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, jobStoreTimeout)
+	defer cancel()
+	cancelled, err := m.store.JobCancelled(reqCtx, id)
+	if err != nil {
+		Must(level.Warn(m.logger).Log("msg", "failed to check job cancellation", "job", id, "err", err))
+	}
+	return cancelled
+}
+
+// errSkipItem can be returned by jobFunc.apply when an item does not need
+// any change.
+var errSkipItem = errors.New("skipped")
+
+// update changes the job with fn and stores it. Stored finished jobs are
+// kept for jobRetention.
+func (r *jobRun) update(fn func()) {
+	r.m.mtx.Lock()
+	fn()
+	snapshot := r.job.copy()
+	r.m.mtx.Unlock()
+
+	var ttl time.Duration
+	if snapshot.FinishedAt != nil {
+		ttl = jobRetention
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jobStoreTimeout)
+	defer cancel()
+	if err := r.m.store.SetJob(ctx, &snapshot, ttl); err != nil {
+		Must(level.Warn(r.m.logger).Log("msg", "failed to store job", "job", snapshot.ID, "err", err))
+	}
+}
+
+func (r *jobRun) finish(status string, err error) {
+	r.update(func() {
+		now := time.Now()
+		r.job.Status = status
+		r.job.FinishedAt = &now
+		if err != nil {
+			r.job.Error = err.Error()
+		}
+	})
+	r.stop()
+}
+
+// handOver stores the job as pending, for the leader to resume it.
+func (r *jobRun) handOver() {
+	r.update(func() { r.job.Status = JobPending })
+	r.stop()
+}
+
+func (r *jobRun) stop() {
+	r.job.cancel()
+	r.m.mtx.Lock()
+	delete(r.m.jobs, r.job.ID)
+	r.m.mtx.Unlock()
+}
+
+// get returns the stored job, or nil if it does not exist.
+func (m *jobManager) get(ctx context.Context, id string) (*Job, error) {
+	return m.store.GetJob(ctx, id)
+}
+
+func (m *jobManager) list(ctx context.Context) ([]Job, error) {
+	jobs, err := m.store.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// cancel requests the cancellation of a job, which may be running on
+// another replica. The job stops before processing its next item. It
+// returns false if the job does not exist.
+func (m *jobManager) cancel(ctx context.Context, id string) (bool, error) {
+	m.mtx.Lock()
+	job, ok := m.jobs[id]
+	m.mtx.Unlock()
+	if ok {
+		job.cancel()
+		return true, nil
+	}
+
+	stored, err := m.store.GetJob(ctx, id)
+	if err != nil || stored == nil {
+		return false, err
+	}
+	if stored.FinishedAt != nil {
+		return true, nil
+	}
+	return true, m.store.CancelJob(ctx, id, jobRetention)
+}
+
+func (j *Job) copy() Job {
+	c := *j
+	c.Results = append([]JobItemResult{}, j.Results...)
+	return c
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate job id")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,143 @@
+package alertmanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// memJobStore is a JobStore keeping the jobs in memory.
+type memJobStore struct {
+	mtx     sync.Mutex
+	jobs    map[string]Job
+	cancels map[string]bool
+}
+
+func newMemJobStore() *memJobStore {
+	return &memJobStore{jobs: map[string]Job{}, cancels: map[string]bool{}}
+}
+
+func (s *memJobStore) SetJob(ctx context.Context, job *Job, ttl time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.jobs[job.ID] = job.copy()
+	return nil
+}
+
+func (s *memJobStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	job = job.copy()
+	return &job, nil
+}
+
+func (s *memJobStore) ListJobs(ctx context.Context) ([]Job, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.copy())
+	}
+	return jobs, nil
+}
+
+func (s *memJobStore) CancelJob(ctx context.Context, id string, ttl time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.cancels[id] = true
+	return nil
+}
+
+func (s *memJobStore) JobCancelled(ctx context.Context, id string) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.cancels[id], nil
+}
+
+// waitJob waits for the stored job to have the status.
+func waitJob(t *testing.T, s *memJobStore, id, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, _ := s.GetJob(context.Background(), id)
+		if job != nil && job.Status == status {
+			return *job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not become %s, got %+v", status, job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobsRunOnLeader(t *testing.T) {
+	store := newMemJobStore()
+	var (
+		mtx     sync.Mutex
+		applied []string
+		// leader tells which replica is the leader.
+		leader int32 = 1
+		// block holds the item b until it is closed.
+		block = make(chan struct{})
+	)
+	build := func(req *JobRequest) (jobFunc, error) {
+		return jobFunc{
+			items: func(ctx context.Context) ([]string, error) {
+				return []string{"a", "b", "c"}, nil
+			},
+			apply: func(ctx context.Context, item string) error {
+				if item == "b" {
+					<-block
+				}
+				mtx.Lock()
+				applied = append(applied, item)
+				mtx.Unlock()
+				return nil
+			},
+		}, nil
+	}
+	replica := func(n int32) *jobManager {
+		return newJobManager(store, build, func() bool { return atomic.LoadInt32(&leader) == n }, log.NewNopLogger())
+	}
+	follower, first := replica(2), replica(1)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go follower.run(stop)
+	go first.run(stop)
+
+	// The job created on the follower is run by the leader.
+	job, err := follower.submit(context.Background(), &JobRequest{Type: JobValidateConfigs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, store, job.ID, JobRunning)
+
+	// The leader hands the job over before its next item once the
+	// follower is elected, which resumes it.
+	atomic.StoreInt32(&leader, 2)
+	close(block)
+	waitJob(t, store, job.ID, JobPending)
+	select {
+	case follower.kick <- struct{}{}:
+	default:
+	}
+	done := waitJob(t, store, job.ID, JobSucceeded)
+
+	if len(done.Results) != 3 {
+		t.Fatalf("got results %+v, want a result for every item", done.Results)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(applied) != 3 {
+		t.Fatalf("got items %v applied, want every item applied once", applied)
+	}
+}
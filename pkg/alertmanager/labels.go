@@ -0,0 +1,228 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// maxTenantLabelValueLength bounds the values of tenant labels.
+const maxTenantLabelValueLength = 256
+
+// tenantLabelRequirement requires the tenant label Name to be Value, or not
+// to be Value if Negate is set. A missing label has the empty value.
+type tenantLabelRequirement struct {
+	Name   string
+	Value  string
+	Negate bool
+}
+
+// TenantSelector selects tenants by their labels, like
+// plan=premium,region!=eu. The empty selector selects all tenants.
+type TenantSelector []tenantLabelRequirement
+
+// ParseTenantSelector parses comma separated requirements of the form
+// name=value or name!=value.
+func ParseTenantSelector(s string) (TenantSelector, error) {
+	var sel TenantSelector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		var r tenantLabelRequirement
+		i := strings.Index(part, "=")
+		if i < 0 {
+			return nil, errors.Errorf("invalid tenant selector requirement %q, expected name=value or name!=value", part)
+		}
+		r.Name, r.Value = part[:i], strings.TrimSpace(part[i+1:])
+		if strings.HasSuffix(r.Name, "!") {
+			r.Name, r.Negate = strings.TrimSuffix(r.Name, "!"), true
+		}
+		r.Name = strings.TrimSpace(r.Name)
+		if !model.LabelName(r.Name).IsValid() {
+			return nil, errors.Errorf("invalid label name %q in tenant selector", r.Name)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches returns true if labels meet all requirements of the selector.
+func (s TenantSelector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if (labels[r.Name] == r.Value) == r.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (s TenantSelector) String() string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		op := "="
+		if r.Negate {
+			op = "!="
+		}
+		parts = append(parts, r.Name+op+r.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// validateTenantLabels checks that the label names are valid Prometheus
+// label names, and that the values are set and bounded.
+func validateTenantLabels(labels map[string]string) error {
+	for name, value := range labels {
+		if !model.LabelName(name).IsValid() {
+			return errors.Errorf("invalid label name %q", name)
+		}
+		if value == "" {
+			return errors.Errorf("label %q has an empty value", name)
+		}
+		if len(value) > maxTenantLabelValueLength {
+			return errors.Errorf("value of label %q exceeds %d bytes", name, maxTenantLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// LimitOverride replaces the dispatch and data directory limits of the
+// tenants matching Selector. Unset limits are those of the flags.
+type LimitOverride struct {
+	Selector       string `yaml:"selector"`
+	MaxAlerts      *int   `yaml:"max_alerts,omitempty"`
+	MaxGroups      *int   `yaml:"max_groups,omitempty"`
+	UserLimitBytes *int64 `yaml:"user_limit_bytes,omitempty"`
+
+	selector TenantSelector
+}
+
+// limitOverridesDocument is the format of the limit overrides file.
+type limitOverridesDocument struct {
+	LimitOverrides []*LimitOverride `yaml:"limit_overrides"`
+}
+
+// loadLimitOverrides parses and validates limit overrides.
+func loadLimitOverrides(s string) ([]*LimitOverride, error) {
+	var doc limitOverridesDocument
+	if err := yaml.UnmarshalStrict([]byte(s), &doc); err != nil {
+		return nil, err
+	}
+	for i, o := range doc.LimitOverrides {
+		sel, err := ParseTenantSelector(o.Selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "limit override %d", i)
+		}
+		if len(sel) == 0 {
+			return nil, errors.Errorf("limit override %d: selector must not be empty", i)
+		}
+		o.selector = sel
+		if o.MaxAlerts != nil && *o.MaxAlerts < 0 || o.MaxGroups != nil && *o.MaxGroups < 0 || o.UserLimitBytes != nil && *o.UserLimitBytes < 0 {
+			return nil, errors.Errorf("limit override %d: limits must not be negative", i)
+		}
+	}
+	return doc.LimitOverrides, nil
+}
+
+// limitOverride returns the first limit override matching labels, or nil.
+func (c *MultitenantAlertmanagerConfig) limitOverride(labels map[string]string) *LimitOverride {
+	for _, o := range c.limitOverrides {
+		if o.selector.Matches(labels) {
+			return o
+		}
+	}
+	return nil
+}
+
+// dispatchLimits returns the dispatch limits of a tenant with labels.
+func (c *MultitenantAlertmanagerConfig) dispatchLimits(labels map[string]string) DispatchLimits {
+	l := DispatchLimits{MaxAlerts: c.MaxAlertsPerUser, MaxGroups: c.MaxGroupsPerUser}
+	if o := c.limitOverride(labels); o != nil {
+		if o.MaxAlerts != nil {
+			l.MaxAlerts = *o.MaxAlerts
+		}
+		if o.MaxGroups != nil {
+			l.MaxGroups = *o.MaxGroups
+		}
+	}
+	return l
+}
+
+// userDiskLimit returns the data directory limit of a user, according to
+// the labels of its applied config. The data directory is that of this
+// replica, so the limits of users it does not run are those of the flags.
+func (am *MultitenantAlertmanager) userDiskLimit(userID string) int64 {
+	am.cfgMutex.RLock()
+	labels := am.cfgs[userID].Labels
+	am.cfgMutex.RUnlock()
+	if o := am.cfg.limitOverride(labels); o != nil && o.UserLimitBytes != nil {
+		return *o.UserLimitBytes
+	}
+	return am.cfg.UserDiskLimit
+}
+
+// selects returns true if this replica runs the tenant with labels,
+// according to its tenant selector.
+func (c *MultitenantAlertmanagerConfig) selects(labels map[string]string) bool {
+	return c.tenantSelector.Matches(labels)
+}
+
+// labelsString formats labels sorted by name, for logs.
+func labelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+labels[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+// setTenantLabels replaces the labels of a tenant.
+func (a *AdminAPI) setTenantLabels(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	var labels map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateTenantLabels(labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := a.client.UpdateConfig(r.Context(), userID, func(cfg *AlertmanagerConfig) error {
+		if cfg.UserID == "" {
+			return errConfigNotFound
+		}
+		cfg.Labels = nil
+		if len(labels) > 0 {
+			cfg.Labels = labels
+		}
+		cfg.UpdatedAtInUnix = time.Now().Unix()
+		return nil
+	})
+	if err == errConfigNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error storing tenant labels", "user", userID, "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "tenant labels updated", "user", userID, "labels", labelsString(labels)))
+	w.WriteHeader(http.StatusNoContent)
+}
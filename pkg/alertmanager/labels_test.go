@@ -0,0 +1,92 @@
+package alertmanager
+
+import (
+	"testing"
+)
+
+func TestTenantSelector(t *testing.T) {
+	for _, tc := range []struct {
+		selector string
+		labels   map[string]string
+		match    bool
+	}{
+		{selector: "", labels: nil, match: true},
+		{selector: "plan=premium", labels: map[string]string{"plan": "premium"}, match: true},
+		{selector: "plan=premium", labels: map[string]string{"plan": "free"}, match: false},
+		{selector: "plan=premium", labels: nil, match: false},
+		{selector: "plan!=premium", labels: nil, match: true},
+		{selector: "plan=", labels: nil, match: true},
+		{selector: "plan!=", labels: nil, match: false},
+		{selector: "plan=premium, region!=eu", labels: map[string]string{"plan": "premium", "region": "us"}, match: true},
+		{selector: "plan=premium, region!=eu", labels: map[string]string{"plan": "premium", "region": "eu"}, match: false},
+	} {
+		sel, err := ParseTenantSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("ParseTenantSelector(%q): %v", tc.selector, err)
+		}
+		if match := sel.Matches(tc.labels); match != tc.match {
+			t.Errorf("%q.Matches(%v) = %v, want %v", tc.selector, tc.labels, match, tc.match)
+		}
+	}
+
+	sel, err := ParseTenantSelector(" plan = premium ,region!=eu")
+	if err != nil || sel.String() != "plan=premium,region!=eu" {
+		t.Fatalf("unexpected selector %q, %v", sel.String(), err)
+	}
+	for _, s := range []string{"plan", "plan=a,", "1plan=a", "pl-an!=a"} {
+		if _, err := ParseTenantSelector(s); err == nil {
+			t.Errorf("expected an error for selector %q", s)
+		}
+	}
+}
+
+func TestValidateTenantLabels(t *testing.T) {
+	if err := validateTenantLabels(map[string]string{"plan": "premium", "region": "eu"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, labels := range []map[string]string{
+		{"plan-name": "premium"},
+		{"plan": ""},
+		{"plan": string(make([]byte, maxTenantLabelValueLength+1))},
+	} {
+		if err := validateTenantLabels(labels); err == nil {
+			t.Errorf("expected an error for labels %v", labels)
+		}
+	}
+}
+
+func TestLimitOverrides(t *testing.T) {
+	overrides, err := loadLimitOverrides(`
+limit_overrides:
+- selector: plan=premium
+  max_alerts: 10000
+  user_limit_bytes: 1073741824
+- selector: plan!=premium
+  max_groups: 10
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &MultitenantAlertmanagerConfig{MaxAlertsPerUser: 1000, MaxGroupsPerUser: 100, limitOverrides: overrides}
+
+	if l := cfg.dispatchLimits(map[string]string{"plan": "premium"}); l != (DispatchLimits{MaxAlerts: 10000, MaxGroups: 100}) {
+		t.Errorf("unexpected premium limits %+v", l)
+	}
+	if l := cfg.dispatchLimits(nil); l != (DispatchLimits{MaxAlerts: 1000, MaxGroups: 10}) {
+		t.Errorf("unexpected default limits %+v", l)
+	}
+	if o := cfg.limitOverride(map[string]string{"plan": "premium"}); o == nil || o.UserLimitBytes == nil || *o.UserLimitBytes != 1<<30 {
+		t.Errorf("unexpected premium override %+v", o)
+	}
+
+	for _, s := range []string{
+		"limit_overrides: [{max_alerts: 10}]",
+		"limit_overrides: [{selector: plan, max_alerts: 10}]",
+		"limit_overrides: [{selector: plan=free, max_alerts: -1}]",
+		"limit_overrides: [{selector: plan=free, max_silences: 10}]",
+	} {
+		if _, err := loadLimitOverrides(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
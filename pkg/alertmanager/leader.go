@@ -0,0 +1,213 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/tracing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// proxiedHeaderName marks requests proxied to the leader, so that they
+	// are not proxied again while the leadership changes.
+	proxiedHeaderName = "X-Alertmanager-Proxied"
+
+	// Delay before campaigning again after a failed campaign.
+	campaignRetryDelay = time.Second
+)
+
+var isLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "appscode",
+	Name:      "leader",
+	Help:      "Whether this replica is the leader sending the notifications, always 1 without leader election.",
+})
+
+func init() {
+	prometheus.MustRegister(isLeader)
+}
+
+// LeaderElector elects a single leader among the replicas.
+type LeaderElector interface {
+	// Campaign blocks until this replica is the leader advertising value,
+	// or ctx is done. The returned channel is closed once the leadership is
+	// lost.
+	Campaign(ctx context.Context, value string) (<-chan struct{}, error)
+	// Resign gives up the leadership, if this replica holds it.
+	Resign(ctx context.Context) error
+	// Leader returns the value advertised by the leader, or "" if there is
+	// none.
+	Leader(ctx context.Context) (string, error)
+}
+
+// leaderState is the leadership of this replica and the URL of the leader
+// the followers proxy to.
+type leaderState struct {
+	// leader is 1 while this replica is the leader, accessed atomically.
+	leader int32
+
+	mtx   sync.RWMutex
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+
+	// done is closed once the leadership was given up on stop.
+	done chan struct{}
+}
+
+// IsLeader returns true if this replica sends the notifications, that is if
+// leader election is disabled or this replica is the leader.
+func (am *MultitenantAlertmanager) IsLeader() bool {
+	return am.elector == nil || atomic.LoadInt32(&am.leader.leader) == 1
+}
+
+// runLeaderElection campaigns for leadership until the
+// MultitenantAlertmanager is stopped, and campaigns again whenever the
+// leadership is lost.
+func (am *MultitenantAlertmanager) runLeaderElection() {
+	defer close(am.leader.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-am.stop
+		cancel()
+	}()
+
+	go am.observeLeader(ctx)
+	for ctx.Err() == nil {
+		lost, err := am.elector.Campaign(ctx, am.cfg.LeaderAdvertiseURL)
+		if err != nil {
+			if ctx.Err() == nil {
+				Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: leader campaign failed", "err", err))
+				time.Sleep(campaignRetryDelay)
+			}
+			continue
+		}
+		am.setLeader(true)
+		Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: elected leader"))
+		select {
+		case <-lost:
+			Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: leadership lost"))
+		case <-ctx.Done():
+		}
+		am.setLeader(false)
+	}
+
+	resignCtx, resignCancel := context.WithTimeout(context.Background(), am.cfg.ClientTimeout)
+	defer resignCancel()
+	if err := am.elector.Resign(resignCtx); err != nil {
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: failed to resign leadership", "err", err))
+	}
+}
+
+func (am *MultitenantAlertmanager) setLeader(leader bool) {
+	if leader {
+		atomic.StoreInt32(&am.leader.leader, 1)
+		isLeader.Set(1)
+	} else {
+		atomic.StoreInt32(&am.leader.leader, 0)
+		isLeader.Set(0)
+	}
+}
+
+// observeLeader keeps the URL of the leader up to date until ctx is done.
+func (am *MultitenantAlertmanager) observeLeader(ctx context.Context) {
+	t := time.NewTicker(am.cfg.LeaderLeaseTTL / 3)
+	defer t.Stop()
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, am.cfg.ClientTimeout)
+		leader, err := am.elector.Leader(reqCtx)
+		cancel()
+		if err != nil {
+			Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: failed to get leader", "err", err))
+		} else {
+			am.setLeaderURL(leader)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (am *MultitenantAlertmanager) setLeaderURL(leader string) {
+	am.leader.mtx.Lock()
+	defer am.leader.mtx.Unlock()
+	if leader == "" {
+		am.leader.url, am.leader.proxy = nil, nil
+		return
+	}
+	if am.leader.url != nil && am.leader.url.String() == leader {
+		return
+	}
+	u, err := url.Parse(leader)
+	if err != nil {
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: invalid leader url", "url", leader, "err", err))
+		am.leader.url, am.leader.proxy = nil, nil
+		return
+	}
+	am.leader.url = u
+	am.leader.proxy = httputil.NewSingleHostReverseProxy(u)
+	// Notification streams are flushed as they are received.
+	am.leader.proxy.FlushInterval = -1
+}
+
+// proxyToLeader proxies the requests received by a follower to the leader,
+// so that all alerts and silences are handled by the leader, and the
+// notifications, traces and status are those of the leader. It returns true
+// if the request was handled.
+func (am *MultitenantAlertmanager) proxyToLeader(w http.ResponseWriter, req *http.Request) bool {
+	if am.IsLeader() {
+		return false
+	}
+	if req.Header.Get(proxiedHeaderName) != "" {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "leadership is changing", http.StatusServiceUnavailable)
+		return true
+	}
+	am.leader.mtx.RLock()
+	proxy := am.leader.proxy
+	am.leader.mtx.RUnlock()
+	if proxy == nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "no leader elected", http.StatusServiceUnavailable)
+		return true
+	}
+	req.Header.Set(proxiedHeaderName, am.cfg.LeaderAdvertiseURL)
+	tracing.Inject(req.Context(), req.Header)
+	proxy.ServeHTTP(w, req)
+	return true
+}
+
+// leaderStage drops the notifications of a follower, which may still hold
+// alerts received while it was the leader.
+type leaderStage struct {
+	amnotify.Stage
+	isLeader func() bool
+}
+
+func (s *leaderStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	if !s.isLeader() {
+		Must(level.Debug(l).Log("msg", "not the leader, dropping notification", "alerts", len(alerts)))
+		return ctx, nil, nil
+	}
+	return s.Stage.Exec(ctx, l, alerts...)
+}
+
+// notifyIfLeader makes the routing stage send notifications only while
+// isLeader returns true.
+func notifyIfLeader(rs amnotify.RoutingStage, isLeader func() bool) {
+	for name, s := range rs {
+		rs[name] = &leaderStage{Stage: s, isLeader: isLeader}
+	}
+}
@@ -0,0 +1,269 @@
+package alertmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LibraryTemplateVersionsKept is the number of versions of a library
+// template kept by the storage, including the current one.
+const LibraryTemplateVersionsKept = 20
+
+var libraryTemplatesCount = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "appscode",
+	Name:      "library_templates",
+	Help:      "How many shared templates are included in the templates of all users.",
+})
+
+func init() {
+	prometheus.MustRegister(libraryTemplatesCount)
+}
+
+var libraryTemplateNameRE = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// A LibraryTemplate is a template file shared by all users, managed by the
+// operators. Every change stores a new version.
+type LibraryTemplate struct {
+	Name            string `json:"name"`
+	Content         string `json:"content"`
+	Version         int64  `json:"version"`
+	UpdatedAtInUnix int64  `json:"updatedAtInUnix"`
+}
+
+// TemplateLibrary stores the versioned templates shared by all users.
+type TemplateLibrary interface {
+	// ListLibraryTemplates returns the current version of all library
+	// templates.
+	ListLibraryTemplates(ctx context.Context) ([]LibraryTemplate, error)
+	// GetLibraryTemplate returns a version of a library template, the
+	// current one if version is 0, or nil if it does not exist.
+	GetLibraryTemplate(ctx context.Context, name string, version int64) (*LibraryTemplate, error)
+	// ListLibraryTemplateVersions returns the kept versions of a library
+	// template, oldest first.
+	ListLibraryTemplateVersions(ctx context.Context, name string) ([]LibraryTemplate, error)
+	// SetLibraryTemplate stores content as the next version of a library
+	// template, and returns it.
+	SetLibraryTemplate(ctx context.Context, name, content string) (*LibraryTemplate, error)
+	// DeleteLibraryTemplate removes a library template with all its
+	// versions. It returns false if it did not exist.
+	DeleteLibraryTemplate(ctx context.Context, name string) (bool, error)
+}
+
+func validateLibraryTemplateName(name string) error {
+	if !libraryTemplateNameRE.MatchString(name) {
+		return errors.Errorf("invalid template name %q, must match %s", name, libraryTemplateNameRE)
+	}
+	return nil
+}
+
+// libraryDir returns the directory holding the library templates, which is
+// empty until they were loaded.
+func (am *MultitenantAlertmanager) libraryDir() string {
+	am.libraryMtx.RLock()
+	defer am.libraryMtx.RUnlock()
+	return am.libraryTemplatesDir
+}
+
+// syncTemplateLibrary loads the library templates, and rebuilds the
+// pipelines of all running Alertmanagers if they changed.
+func (am *MultitenantAlertmanager) syncTemplateLibrary() error {
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ClientTimeout)
+	defer cancel()
+	templates, err := am.configsClient.ListLibraryTemplates(ctx)
+	if err != nil {
+		return err
+	}
+	return am.setTemplateLibrary(templates)
+}
+
+// setTemplateLibrary writes the library templates to a new directory of the
+// data directory, and rebuilds the pipelines of all running Alertmanagers if
+// they changed. The directories of previous templates are removed once the
+// pipelines were rebuilt. Parked Alertmanagers pick them up when they are
+// rebuilt.
+func (am *MultitenantAlertmanager) setTemplateLibrary(templates []LibraryTemplate) error {
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	h := sha256.New()
+	for _, t := range templates {
+		h.Write([]byte(t.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(t.Content))
+		h.Write([]byte{0})
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	am.librarySyncMtx.Lock()
+	defer am.librarySyncMtx.Unlock()
+	if sum == am.libraryTemplatesSum {
+		return nil
+	}
+
+	files := make(map[string]string, len(templates))
+	for _, t := range templates {
+		if err := validateLibraryTemplateName(t.Name); err != nil {
+			return err
+		}
+		files[t.Name] = t.Content
+	}
+	if err := validateTemplateFiles(files); err != nil {
+		return errors.Wrap(err, "invalid library templates")
+	}
+	root := filepath.Join(am.cfg.DataDir, "library")
+	dir := filepath.Join(root, sum[:16])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create library templates directory")
+	}
+	for fn, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), []byte(content), 0644); err != nil {
+			return errors.Wrap(err, "failed to write library template")
+		}
+	}
+
+	am.libraryMtx.Lock()
+	am.libraryTemplatesDir = dir
+	am.libraryMtx.Unlock()
+	am.libraryTemplatesSum = sum
+	libraryTemplatesCount.Set(float64(len(templates)))
+	am.reloadPipelines("library templates")
+
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return errors.Wrap(err, "failed to list library templates directories")
+	}
+	for _, e := range entries {
+		if e.Name() != filepath.Base(dir) {
+			if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+				Must(level.Warn(logger2.Logger).Log("msg", "MultitenantAlertmanager: failed to remove library templates", "dir", e.Name(), "err", err))
+			}
+		}
+	}
+	return nil
+}
+
+// listLibraryTemplates returns the current version of all library
+// templates.
+func (a *AdminAPI) listLibraryTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := a.client.ListLibraryTemplates(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if templates == nil {
+		templates = []LibraryTemplate{}
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
+
+// getLibraryTemplate returns the current version of a library template.
+func (a *AdminAPI) getLibraryTemplate(w http.ResponseWriter, r *http.Request) {
+	a.writeLibraryTemplate(w, r, 0)
+}
+
+// getLibraryTemplateVersion returns a kept version of a library template.
+func (a *AdminAPI) getLibraryTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.ParseInt(mux.Vars(r)["version"], 10, 64)
+	if err != nil || version <= 0 {
+		http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	a.writeLibraryTemplate(w, r, version)
+}
+
+func (a *AdminAPI) writeLibraryTemplate(w http.ResponseWriter, r *http.Request, version int64) {
+	t, err := a.client.GetLibraryTemplate(r.Context(), mux.Vars(r)["name"], version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if t == nil {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// listLibraryTemplateVersions returns the kept versions of a library
+// template, oldest first.
+func (a *AdminAPI) listLibraryTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := a.client.ListLibraryTemplateVersions(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// setLibraryTemplate stores the request body as the next version of a
+// library template. It is applied on this replica right away, and on the
+// others when they resync.
+func (a *AdminAPI) setLibraryTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := validateLibraryTemplateName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateTemplateFiles(map[string]string{name: string(body)}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.client.SetLibraryTemplate(r.Context(), name, string(body))
+	if err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error storing library template", "template", name, "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.am.syncTemplateLibrary(); err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error applying library templates", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "library template updated", "template", name, "version", t.Version))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// deleteLibraryTemplate removes a library template with all its versions.
+func (a *AdminAPI) deleteLibraryTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	ok, err := a.client.DeleteLibraryTemplate(r.Context(), name)
+	if err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error deleting library template", "template", name, "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return
+	}
+	if err := a.am.syncTemplateLibrary(); err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error applying library templates", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "library template deleted", "template", name))
+	w.WriteHeader(http.StatusNoContent)
+}
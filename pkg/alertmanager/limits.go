@@ -0,0 +1,180 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Reasons alerts are rejected for by the dispatch limits.
+const (
+	limitReasonAlerts = "max_alerts"
+	limitReasonGroups = "max_groups"
+)
+
+var rejectedAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "alerts_rejected_total",
+	Help:      "The total number of alerts rejected as the tenant would exceed a dispatch limit.",
+}, []string{"tenant", "reason"})
+
+func init() {
+	prometheus.MustRegister(rejectedAlerts)
+}
+
+// DispatchLimits bound the alerts a user holds in memory, so that a single
+// user can not exhaust the memory of the process. A limit of 0 is
+// unbounded.
+type DispatchLimits struct {
+	// MaxAlerts is the number of firing alerts.
+	MaxAlerts int
+	// MaxGroups is the number of aggregation groups of the firing alerts.
+	MaxGroups int
+}
+
+func (l DispatchLimits) enabled() bool {
+	return l.MaxAlerts > 0 || l.MaxGroups > 0
+}
+
+// limitError is returned if alerts would exceed a dispatch limit.
+type limitError struct {
+	reason string
+	limit  int
+}
+
+func (e *limitError) Error() string {
+	switch e.reason {
+	case limitReasonAlerts:
+		return fmt.Sprintf("too many firing alerts, the limit is %d", e.limit)
+	default:
+		return fmt.Sprintf("too many alert groups, the limit is %d", e.limit)
+	}
+}
+
+// groupKeys returns the keys of the aggregation groups the dispatcher puts
+// an alert with lset in, see dispatch.Dispatcher.
+func groupKeys(route *dispatch.Route, lset model.LabelSet) []string {
+	routes := route.Match(lset)
+	keys := make([]string, 0, len(routes))
+	for _, r := range routes {
+		groupLabels := model.LabelSet{}
+		for ln, lv := range lset {
+			if _, ok := r.RouteOpts.GroupBy[ln]; ok || r.RouteOpts.GroupByAll {
+				groupLabels[ln] = lv
+			}
+		}
+		keys = append(keys, r.Key()+":"+groupLabels.String())
+	}
+	return keys
+}
+
+// checkLimits returns a *limitError if putting alerts would exceed the
+// dispatch limits. Alerts already firing and resolved alerts are always
+// accepted, so that a user above the limits can still resolve alerts.
+func (am *Alertmanager) checkLimits(alerts []*types.Alert, now time.Time) error {
+	l := am.cfg.Limits
+	if !l.enabled() {
+		return nil
+	}
+	var route *dispatch.Route
+	if p := am.getPipeline(); p != nil && l.MaxGroups > 0 {
+		route = p.route
+	}
+
+	firing := map[model.Fingerprint]bool{}
+	groups := map[string]bool{}
+	it := am.alerts.GetPending()
+	for a := range it.Next() {
+		if a.ResolvedAt(now) {
+			continue
+		}
+		firing[a.Fingerprint()] = true
+		if route != nil {
+			for _, k := range groupKeys(route, a.Labels) {
+				groups[k] = true
+			}
+		}
+	}
+	it.Close()
+
+	newAlerts, newGroups := 0, 0
+	for _, a := range alerts {
+		fp := a.Fingerprint()
+		if a.ResolvedAt(now) || firing[fp] {
+			continue
+		}
+		firing[fp] = true
+		newAlerts++
+		if route != nil {
+			for _, k := range groupKeys(route, a.Labels) {
+				if !groups[k] {
+					groups[k] = true
+					newGroups++
+				}
+			}
+		}
+	}
+	if l.MaxAlerts > 0 && newAlerts > 0 && len(firing) > l.MaxAlerts {
+		return &limitError{reason: limitReasonAlerts, limit: l.MaxAlerts}
+	}
+	if l.MaxGroups > 0 && newGroups > 0 && len(groups) > l.MaxGroups {
+		return &limitError{reason: limitReasonGroups, limit: l.MaxGroups}
+	}
+	return nil
+}
+
+// isPostAlerts returns true for the requests posting alerts to the v1 or v2
+// API of an Alertmanager.
+func isPostAlerts(req *http.Request) bool {
+	return req.Method == http.MethodPost &&
+		(strings.HasSuffix(req.URL.Path, "/api/v1/alerts") || strings.HasSuffix(req.URL.Path, "/api/v2/alerts"))
+}
+
+// rejectOverLimits rejects the alerts posted to the Alertmanager of a user
+// with 429 if they would exceed its dispatch limits, and returns true if
+// so. The body is left for the API to read otherwise.
+func rejectOverLimits(w http.ResponseWriter, req *http.Request, userID string, userAM *Alertmanager) bool {
+	if !userAM.cfg.Limits.enabled() || !isPostAlerts(req) {
+		return false
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return true
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// The v1 and v2 APIs both take a list of alerts with these fields.
+	// Malformed requests are left for the API to reject.
+	var posted []struct {
+		Labels   model.LabelSet `json:"labels"`
+		StartsAt time.Time      `json:"startsAt"`
+		EndsAt   time.Time      `json:"endsAt"`
+	}
+	if err := json.Unmarshal(body, &posted); err != nil {
+		return false
+	}
+	alerts := make([]*types.Alert, 0, len(posted))
+	for _, p := range posted {
+		alerts = append(alerts, &types.Alert{Alert: model.Alert{Labels: p.Labels, StartsAt: p.StartsAt, EndsAt: p.EndsAt}})
+	}
+
+	// The limits apply to the alerts as they are stored.
+	alerts = userAM.preprocess(alerts)
+	err = userAM.checkLimits(alerts, time.Now())
+	if err == nil {
+		return false
+	}
+	rejectedAlerts.WithLabelValues(userID, err.(*limitError).reason).Add(float64(len(alerts)))
+	writeError(w, http.StatusTooManyRequests, err.Error())
+	return true
+}
@@ -0,0 +1,71 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestCheckLimits(t *testing.T) {
+	am := newTestAlertmanager(t)
+	am.cfg.Limits = DispatchLimits{MaxAlerts: 4, MaxGroups: 2}
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+  group_by: [alertname]
+receivers:
+- name: team
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	alert := func(name, instance string, resolved bool) *types.Alert {
+		a := &types.Alert{Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": model.LabelValue(name), "instance": model.LabelValue(instance)},
+			StartsAt: now.Add(-time.Hour),
+			EndsAt:   now.Add(time.Hour),
+		}}
+		if resolved {
+			a.EndsAt = now.Add(-time.Minute)
+		}
+		return a
+	}
+	if err := am.alerts.Put(alert("A", "1", false), alert("A", "2", false), alert("B", "1", true)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		alerts []*types.Alert
+		reason string
+	}{
+		{name: "existing", alerts: []*types.Alert{alert("A", "1", false)}},
+		{name: "resolved", alerts: []*types.Alert{alert("C", "1", true), alert("D", "1", true)}},
+		{name: "new alert in a new group", alerts: []*types.Alert{alert("B", "2", false)}},
+		{name: "too many alerts", alerts: []*types.Alert{alert("A", "3", false), alert("A", "4", false), alert("A", "5", false)}, reason: limitReasonAlerts},
+		{name: "too many groups", alerts: []*types.Alert{alert("B", "2", false), alert("C", "1", false)}, reason: limitReasonGroups},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := am.checkLimits(tc.alerts, now)
+			if tc.reason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if lerr, ok := err.(*limitError); !ok || lerr.reason != tc.reason {
+				t.Fatalf("got %v, want a %s limit error", err, tc.reason)
+			}
+		})
+	}
+}
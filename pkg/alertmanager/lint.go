@@ -0,0 +1,151 @@
+package alertmanager
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+)
+
+// lintMinRepeatInterval is the repeat_interval below which notifications
+// are considered too frequent.
+const lintMinRepeatInterval = time.Hour
+
+// Codes of the lint warnings.
+const (
+	LintMissingGroupBy     = "missing_group_by"
+	LintLowRepeatInterval  = "low_repeat_interval"
+	LintUnusedReceiver     = "unused_receiver"
+	LintMissingCatchAll    = "missing_catch_all"
+	LintReceiverNoNotifier = "receiver_without_integrations"
+)
+
+// LintWarning is a best practice a config does not follow. Unlike
+// validation errors, warnings do not prevent setting the config.
+type LintWarning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// LintResult lists the lint warnings of a config.
+type LintResult struct {
+	Warnings []LintWarning `json:"warnings"`
+}
+
+// lintConfig returns the lint warnings of a valid config.
+func lintConfig(conf *notify.Config) []LintWarning {
+	warnings := []LintWarning{}
+	root := conf.Route
+
+	if root.GroupBy == nil && !root.GroupByAll {
+		warnings = append(warnings, LintWarning{
+			Code:    LintMissingGroupBy,
+			Field:   "route.group_by",
+			Message: "the root route has no group_by, all alerts of a route are notified in a single group",
+		})
+	}
+
+	used := map[string]bool{}
+	var walk func(r *config.Route, path string)
+	walk = func(r *config.Route, path string) {
+		used[r.Receiver] = true
+		if r.RepeatInterval != nil && time.Duration(*r.RepeatInterval) < lintMinRepeatInterval {
+			warnings = append(warnings, LintWarning{
+				Code:    LintLowRepeatInterval,
+				Field:   path + ".repeat_interval",
+				Message: fmt.Sprintf("repeat_interval %s is below %s, firing alerts are notified again very often", r.RepeatInterval, model.Duration(lintMinRepeatInterval)),
+			})
+		}
+		for i, child := range r.Routes {
+			walk(child, fmt.Sprintf("%s.routes[%d]", path, i))
+		}
+	}
+	walk(root, "route")
+
+	integrations := map[string]int{}
+	for _, rc := range conf.Receivers {
+		integrations[rc.Name] = len(notify.IntegrationNames(rc))
+		for _, s := range rc.ReceiverExtension.Escalations {
+			used[s.Receiver] = true
+		}
+	}
+	for _, h := range conf.Heartbeats {
+		used[h.Receiver] = true
+	}
+
+	if len(root.Routes) > 0 && integrations[root.Receiver] == 0 {
+		warnings = append(warnings, LintWarning{
+			Code:    LintMissingCatchAll,
+			Field:   "route.receiver",
+			Message: fmt.Sprintf("alerts matching no child route go to the root receiver %q, which has no integrations, so they are dropped silently", root.Receiver),
+		})
+	}
+
+	var unused []string
+	for _, rc := range conf.Receivers {
+		if !used[rc.Name] {
+			unused = append(unused, rc.Name)
+		} else if integrations[rc.Name] == 0 && rc.Name != root.Receiver {
+			warnings = append(warnings, LintWarning{
+				Code:    LintReceiverNoNotifier,
+				Field:   "receivers",
+				Message: fmt.Sprintf("receiver %q has no integrations, the alerts routed to it are dropped silently", rc.Name),
+			})
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		warnings = append(warnings, LintWarning{
+			Code:    LintUnusedReceiver,
+			Field:   "receivers",
+			Message: fmt.Sprintf("receiver %q is not used by any route", name),
+		})
+	}
+	return warnings
+}
+
+// lintConfigString returns the lint warnings of a config, nil if it can
+// not be loaded.
+func lintConfigString(cfg string) []LintWarning {
+	conf, err := notify.LoadConfig(secrets.Mask(cfg))
+	if err != nil {
+		return nil
+	}
+	return lintConfig(conf)
+}
+
+// lintConfig returns the lint warnings of the stored config of the user.
+func (a *API) lintConfig(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	if cfg.Config == "" {
+		writeError(w, http.StatusNotFound, "no config stored")
+		return
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(cfg.Config))
+	if err != nil {
+		configError(w, cfg.Config, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, LintResult{Warnings: lintConfig(conf)})
+}
@@ -0,0 +1,70 @@
+package alertmanager
+
+import (
+	"testing"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+func TestLintConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		conf string
+		want []string
+	}{
+		{
+			name: "clean",
+			conf: `
+route:
+  receiver: team
+  group_by: [alertname]
+  routes:
+  - receiver: pager
+    match:
+      severity: critical
+receivers:
+- name: team
+  webhook_configs:
+  - url: http://example.com/
+- name: pager
+  webhook_configs:
+  - url: http://example.com/pager
+`,
+		},
+		{
+			name: "warnings",
+			conf: `
+route:
+  receiver: blackhole
+  routes:
+  - receiver: team
+    repeat_interval: 5m
+    match:
+      severity: critical
+receivers:
+- name: blackhole
+- name: team
+  webhook_configs:
+  - url: http://example.com/
+- name: old
+  webhook_configs:
+  - url: http://example.com/old
+`,
+			want: []string{LintMissingGroupBy, LintLowRepeatInterval, LintMissingCatchAll, LintUnusedReceiver},
+		},
+	} {
+		conf, err := notify.LoadConfig(tc.conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warnings := lintConfig(conf)
+		if len(warnings) != len(tc.want) {
+			t.Fatalf("%s: got warnings %+v, want %v", tc.name, warnings, tc.want)
+		}
+		for i, w := range warnings {
+			if w.Code != tc.want[i] {
+				t.Errorf("%s: got warning %+v, want %s", tc.name, w, tc.want[i])
+			}
+		}
+	}
+}
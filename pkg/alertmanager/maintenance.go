@@ -0,0 +1,207 @@
+package alertmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const maintenanceWindowsKey = "maintenance_windows"
+
+var errMaintenanceWindowNotFound = errors.New("maintenance window not found")
+
+// listMaintenanceWindows returns the maintenance windows of the user's
+// config.
+func (a *API) listMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(cfg.Config))
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error loading config", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	windows := conf.MaintenanceWindows
+	if windows == nil {
+		windows = []*notify.MaintenanceWindow{}
+	}
+	writeJSON(w, http.StatusOK, windows)
+}
+
+// setMaintenanceWindow adds a maintenance window to the user's config, or
+// replaces the window of the same name.
+func (a *API) setMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	// The window is decoded like the config, JSON being a subset of YAML,
+	// so that durations are accepted in the same format.
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var window notify.MaintenanceWindow
+	if err := yaml.UnmarshalStrict(body, &window); err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.updateConfigList(w, r, userID, maintenanceWindowsKey, "maintenance window", func(windows []interface{}) ([]interface{}, error) {
+		data, err := yaml.Marshal(&window)
+		if err != nil {
+			return nil, err
+		}
+		var item yaml.MapSlice
+		if err := yaml.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		return setConfigListItem(windows, window.Name, item), nil
+	})
+}
+
+// deleteMaintenanceWindow removes a maintenance window from the user's
+// config.
+func (a *API) deleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	a.updateConfigList(w, r, userID, maintenanceWindowsKey, "maintenance window", func(windows []interface{}) ([]interface{}, error) {
+		return deleteConfigListItem(windows, name, errMaintenanceWindowNotFound)
+	})
+}
+
+// updateConfigList rewrites the list of named items under the top level key
+// of the user's config, like the maintenance windows, with update,
+// validates and stores the config. The rest of the config is kept as is.
+// kind names the items in errors.
+func (a *API) updateConfigList(w http.ResponseWriter, r *http.Request, userID, key, kind string, update func([]interface{}) ([]interface{}, error)) {
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg.Config), &raw); err != nil {
+		Must(level.Error(logger).Log("msg", "error parsing config", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	idx := -1
+	var items []interface{}
+	for i, item := range raw {
+		if item.Key == key {
+			idx = i
+			items, _ = item.Value.([]interface{})
+		}
+	}
+	items, err = update(items)
+	if err == errMaintenanceWindowNotFound || err == errRecurringSilenceNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case idx < 0:
+		raw = append(raw, yaml.MapItem{Key: key, Value: items})
+	case len(items) == 0:
+		raw = append(raw[:idx], raw[idx+1:]...)
+	default:
+		raw[idx].Value = items
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := validateAlertmanagerConfig(string(data)); err != nil {
+		Must(level.Error(logger).Log("msg", "invalid "+kind, "err", err))
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s: %v", kind, err))
+		return
+	}
+
+	cfg.Config = string(data)
+	cfg.UserID = userID
+	cfg.UpdatedAtInUnix = time.Now().Unix()
+	if err := a.client.SetConfig(r.Context(), &cfg); err != nil {
+		Must(level.Error(logger).Log("msg", "error storing config", "err", err))
+		storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setConfigListItem replaces the item of the list with the name, or
+// appends it.
+func setConfigListItem(items []interface{}, name string, item yaml.MapSlice) []interface{} {
+	for i, it := range items {
+		if configListItemName(it) == name {
+			items[i] = item
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+// deleteConfigListItem removes the item of the list with the name, or
+// returns notFound.
+func deleteConfigListItem(items []interface{}, name string, notFound error) ([]interface{}, error) {
+	for i, it := range items {
+		if configListItemName(it) == name {
+			return append(items[:i], items[i+1:]...), nil
+		}
+	}
+	return nil, notFound
+}
+
+func configListItemName(item interface{}) string {
+	ms, ok := item.(yaml.MapSlice)
+	if !ok {
+		return ""
+	}
+	for _, f := range ms {
+		if f.Key == "name" {
+			return fmt.Sprint(f.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/silence"
+	"gopkg.in/yaml.v2"
+)
+
+// UpstreamImport describes a single-tenant deployment of upstream
+// Alertmanager imported as a user.
+type UpstreamImport struct {
+	UserID string
+	// ConfigFile is the alertmanager.yml of the deployment. The template
+	// files it references are imported with it.
+	ConfigFile string
+	// SilencesFile is the silences snapshot of the deployment, optional.
+	SilencesFile string
+	// DataDir is the data directory the silences snapshot is written to.
+	DataDir string
+	// Overwrite replaces the stored config and the silences of the user.
+	Overwrite bool
+}
+
+// UpstreamImportResult is the outcome of importing an upstream deployment.
+type UpstreamImportResult struct {
+	UserID    string   `json:"userID"`
+	Templates []string `json:"templates"`
+	// Silences is the number of silences imported.
+	Silences int `json:"silences"`
+}
+
+// ImportUpstream stores the config and the templates of an upstream
+// Alertmanager as the config of a user, after writing its silences snapshot
+// to the data directory and to bucket, if it is not nil. The snapshot is
+// only loaded by an Alertmanager of the user created later, so the user
+// must not have a running Alertmanager yet.
+func ImportUpstream(ctx context.Context, c AlertmanagerClient, bucket objstore.Bucket, in *UpstreamImport) (*UpstreamImportResult, error) {
+	if in.UserID == "" || strings.Contains(in.UserID, "/") {
+		return nil, errors.Errorf("invalid user id %q", in.UserID)
+	}
+	cfg, err := loadUpstreamConfig(in.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	res := &UpstreamImportResult{UserID: in.UserID, Templates: []string{}}
+	for fn := range cfg.TemplateFiles {
+		res.Templates = append(res.Templates, fn)
+	}
+	sort.Strings(res.Templates)
+
+	var snapshot []byte
+	if in.SilencesFile != "" {
+		snapshot, res.Silences, err = loadUpstreamSilences(in.SilencesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !in.Overwrite {
+		existing, err := c.GetConfig(ctx, in.UserID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get config of user %s", in.UserID)
+		}
+		if existing.UserID != "" {
+			return nil, errors.Errorf("user %s already has a config", in.UserID)
+		}
+	}
+
+	// The snapshot is written first, so that the Alertmanager created for
+	// the stored config loads it.
+	if snapshot != nil {
+		fn := silencesSnapshotFile(in.DataDir, in.UserID)
+		if _, err := os.Stat(fn); err == nil && !in.Overwrite {
+			return nil, errors.Errorf("user %s already has a silences snapshot %s", in.UserID, fn)
+		}
+		if err := writeFileAtomic(fn, snapshot); err != nil {
+			return nil, errors.Wrap(err, "failed to write silences snapshot")
+		}
+		if bucket != nil {
+			if err := bucket.Upload(ctx, path.Join(in.UserID, silencesStateKey), bytes.NewReader(snapshot)); err != nil {
+				return nil, errors.Wrapf(err, "failed to upload silences of user %s", in.UserID)
+			}
+		}
+	}
+
+	cfg.UserID = in.UserID
+	cfg.UpdatedAtInUnix = time.Now().Unix()
+	if err := c.SetConfig(ctx, cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to store config of user %s", in.UserID)
+	}
+	return res, nil
+}
+
+// loadUpstreamConfig reads the config file of an upstream Alertmanager and
+// the template files it references. Upstream templates are globs relative
+// to the config file, they are replaced by the base names of the files
+// they match, under which the files are stored.
+func loadUpstreamConfig(configFile string) (*AlertmanagerConfig, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "invalid Alertmanager config")
+	}
+
+	cfg := &AlertmanagerConfig{Config: string(data)}
+	for i, item := range raw {
+		if item.Key != "templates" {
+			continue
+		}
+		patterns, ok := item.Value.([]interface{})
+		if !ok {
+			return nil, errors.New("invalid Alertmanager config: templates must be a list")
+		}
+		cfg.TemplateFiles = map[string]string{}
+		sources := map[string]string{}
+		for _, p := range patterns {
+			pattern, ok := p.(string)
+			if !ok {
+				return nil, errors.Errorf("invalid template pattern %v", p)
+			}
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(configFile), pattern)
+			}
+			files, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid template pattern %q", pattern)
+			}
+			for _, file := range files {
+				fn := filepath.Base(file)
+				if src, ok := sources[fn]; ok && src != file {
+					return nil, errors.Errorf("template files %s and %s have the same name", src, file)
+				}
+				content, err := ioutil.ReadFile(file)
+				if err != nil {
+					return nil, err
+				}
+				sources[fn] = file
+				cfg.TemplateFiles[fn] = string(content)
+			}
+		}
+		names := make([]string, 0, len(cfg.TemplateFiles))
+		for fn := range cfg.TemplateFiles {
+			names = append(names, fn)
+		}
+		sort.Strings(names)
+		raw[i].Value = names
+
+		data, err := yaml.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Config = string(data)
+	}
+
+	if err := validateAlertmanagerConfig(cfg.Config); err != nil {
+		return nil, errors.Wrap(err, "invalid Alertmanager config")
+	}
+	if err := validateTemplateFiles(cfg.TemplateFiles); err != nil {
+		return nil, errors.Wrap(err, "invalid templates")
+	}
+	return cfg, nil
+}
+
+// loadUpstreamSilences reads the silences snapshot of an upstream
+// Alertmanager, and returns it encoded again with the number of silences.
+func loadUpstreamSilences(file string) ([]byte, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	silences, err := silence.New(silence.Options{SnapshotReader: f})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid silences snapshot")
+	}
+	sils, _, err := silences.Query()
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	if _, err := silences.Snapshot(&buf); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), len(sils), nil
+}
+
+// writeFileAtomic writes data to a temporary file renamed to fn, creating
+// the directory of fn.
+func writeFileAtomic(fn string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0777); err != nil {
+		return err
+	}
+	tmp := fn + ".tmp"
+	defer os.Remove(tmp)
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
@@ -0,0 +1,97 @@
+package alertmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/silence"
+)
+
+func TestLoadUpstreamConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"alertmanager.yml": `
+templates:
+- 'templates/*.tmpl'
+route:
+  receiver: team
+receivers:
+- name: team
+  webhook_configs:
+  - url: http://example.com/
+`,
+		"templates/slack.tmpl": `{{ define "slack.title" }}{{ .Status }}{{ end }}`,
+		"templates/mail.tmpl":  `{{ define "mail.subject" }}{{ .Status }}{{ end }}`,
+		"templates/README":     "not a template",
+	}
+	for fn, content := range files {
+		path := filepath.Join(dir, fn)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := loadUpstreamConfig(filepath.Join(dir, "alertmanager.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"mail.tmpl":  files["templates/mail.tmpl"],
+		"slack.tmpl": files["templates/slack.tmpl"],
+	}
+	if !reflect.DeepEqual(cfg.TemplateFiles, want) {
+		t.Errorf("got template files %v, want %v", cfg.TemplateFiles, want)
+	}
+	conf, err := notify.LoadConfig(cfg.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.Templates, []string{"mail.tmpl", "slack.tmpl"}) {
+		t.Errorf("got templates %v, want the names of the template files", conf.Templates)
+	}
+}
+
+func TestLoadUpstreamSilences(t *testing.T) {
+	f, err := ioutil.TempFile("", "silences")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	s, err := silence.New(silence.Options{Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTestSilence(t, s)
+	setTestSilence(t, s)
+	if _, err := s.Snapshot(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, count, err := loadUpstreamSilences(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d silences, want 2", count)
+	}
+	if len(snapshot) == 0 {
+		t.Error("got empty snapshot")
+	}
+}
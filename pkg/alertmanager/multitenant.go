@@ -2,25 +2,34 @@ package alertmanager
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+	"go.searchlight.dev/alertmanager/pkg/tracing"
 
 	utilerrors "github.com/appscode/go/util/errors"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/alertmanager/cluster"
-	amconfig "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaveworks/common/instrument"
 )
@@ -43,6 +52,22 @@ var (
 		Help:      "Time spent requesting configs.",
 		Buckets:   prometheus.DefBuckets,
 	}, []string{"operation", "status_code"}))
+	configApplyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "appscode",
+		Name:      "config_apply_duration_seconds",
+		Help:      "Time spent applying the config of a user.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+	configApplies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "config_applies_total",
+		Help:      "The total number of config applies, performed or skipped as the config was unchanged.",
+	}, []string{"result"})
+	initialSyncDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "configs_initial_sync_duration_seconds",
+		Help:      "Time spent loading and applying all configs at startup.",
+	})
 	//totalPeers = prometheus.NewGauge(prometheus.GaugeOpts{
 	//	Namespace: "appscode",
 	//	Name:      "mesh_peers",
@@ -53,6 +78,9 @@ var (
 func init() {
 	configsRequestDuration.Register()
 	prometheus.MustRegister(totalConfigs)
+	prometheus.MustRegister(configApplyDuration)
+	prometheus.MustRegister(configApplies)
+	prometheus.MustRegister(initialSyncDuration)
 	// prometheus.MustRegister(totalPeers)
 }
 
@@ -62,36 +90,156 @@ type MultitenantAlertmanager struct {
 	cfg *MultitenantAlertmanagerConfig
 
 	peer *cluster.Peer
+	// peerStates gossips the states of the Alertmanagers of all users.
+	peerStates *peerStates
+	// peerWait returns how long to wait for the notifications of the peers.
+	peerWait func() time.Duration
 
 	configsClient AlertmanagerGetter
 
+	// stateBucket is used to persist the state of alertmanagers. Can be nil.
+	stateBucket objstore.Bucket
+	// secretResolver resolves the secret references of configs when they
+	// are applied.
+	secretResolver SecretResolver
+	// elector elects the replica sending the notifications. Leader election
+	// is disabled if nil.
+	elector LeaderElector
+	leader  leaderState
+
 	// All the organization configurations that we have. Only used for instrumentation.
-	cfgs     map[string]AlertmanagerConfig
-	cfgMutex sync.RWMutex
+	cfgs map[string]AlertmanagerConfig
+	// The checksums of the applied configs, see configChecksum.
+	checksums map[string]string
+	// The resolved secrets of the applied configs holding references, which
+	// are resolved again once older than the secret refresh interval.
+	resolvedSecrets map[string]resolvedSecrets
+	cfgMutex        sync.RWMutex
+
+	// The feature overrides of the users, see featureFunc.
+	features    map[string]map[string]bool
+	featuresMtx sync.RWMutex
 
 	alertmanagersMtx sync.Mutex
 	alertmanagers    map[string]*Alertmanager
+	// Users whose idle Alertmanager was stopped, it is rebuilt on use.
+	parked map[string]bool
+	// Locks of every user, see userLock.
+	userLocks sync.Map
+
+	// The outcome of the last config apply of every user. Changed statuses
+	// are marked dirty until they are stored.
+	applyStatusMtx   sync.RWMutex
+	applyStatus      map[string]ApplyStatus
+	applyStatusDirty map[string]bool
+	applyStatusCh    chan struct{}
+
+	// The global inhibition rules stored through the admin API, and the
+	// document they were loaded from.
+	inhibitRulesMtx       sync.RWMutex
+	storedInhibitRules    []*config.InhibitRule
+	storedInhibitRulesRaw string
+
+	// The directory the library templates were written to, and their
+	// checksum. librarySyncMtx serializes their updates.
+	libraryMtx          sync.RWMutex
+	libraryTemplatesDir string
+	librarySyncMtx      sync.Mutex
+	libraryTemplatesSum string
+
+	// diskBackoff delays truncating the state of users above the data
+	// directory limit.
+	diskBackoff *diskBackoff
+
+	// synced is set once the initial configs were applied, see Ready.
+	synced int32
+	// draining is set once shutdown started, see Drain.
+	draining int32
+	// streamsStop is closed to end the notification and event streams, see
+	// CloseStreams.
+	streamsStop     chan struct{}
+	streamsStopOnce sync.Once
+	// configEvents are sent to the event streams of the users.
+	configEvents *configEvents
+
+	// archive stores the resolved alert groups for the history API. The
+	// history is disabled if nil.
+	archive     AlertArchive
+	archiveCh   chan archiveRequest
+	archiveDone chan struct{}
+
+	// resyncCh receives the forced resyncs requested by Resync, which are
+	// made by Run.
+	resyncCh chan chan error
 
 	settleCtxCancel context.CancelFunc
 	stop            chan struct{}
 	done            chan struct{}
 }
 
+// SecretResolver resolves the references to secrets kept in external stores
+// in the config of a user.
+type SecretResolver interface {
+	Resolve(ctx context.Context, userID, cfg string) (string, error)
+}
+
 // NewMultitenantAlertmanager creates a new MultitenantAlertmanager.
-func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, configClient AlertmanagerGetter) (*MultitenantAlertmanager, error) {
+func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, configClient AlertmanagerGetter, stateBucket objstore.Bucket, secretResolver SecretResolver, elector LeaderElector, archive AlertArchive) (*MultitenantAlertmanager, error) {
 	err := os.MkdirAll(cfg.DataDir, 0777)
 	if err != nil {
 		return nil, errors.Errorf("unable to create Alertmanager data directory %q: %s", cfg.DataDir, err)
 	}
+	if err := notify.WriteDefaultTemplates(defaultTemplatesFile(cfg.DataDir)); err != nil {
+		return nil, errors.Errorf("unable to create default templates: %s", err)
+	}
+	egress, err := cfg.egressPolicy()
+	if err != nil {
+		return nil, err
+	}
+	notify.SetEgressPolicy(egress)
+	notify.SetEgressLimits(cfg.EgressMaxConcurrent, cfg.EgressMaxConcurrentPerHost)
+	notify.SetExecAllowedCommands(cfg.ExecAllowedCommands)
+	notify.SetExecMaxTimeout(cfg.ExecMaxTimeout)
+	notify.SetAWSCredentialsPolicy(cfg.AWSAllowAmbientCredentials, cfg.AWSAllowedRoleARNs)
+	httpClient, err := cfg.httpClientDefaults()
+	if err != nil {
+		return nil, err
+	}
+	notify.SetHTTPClientDefaults(httpClient)
 
 	am := &MultitenantAlertmanager{
-		cfg:           cfg,
-		configsClient: configClient,
-		cfgs:          map[string]AlertmanagerConfig{},
-		alertmanagers: map[string]*Alertmanager{},
-		stop:          make(chan struct{}),
-		done:          make(chan struct{}),
-		peer:          nil,
+		cfg:              cfg,
+		configsClient:    configClient,
+		stateBucket:      stateBucket,
+		secretResolver:   secretResolver,
+		elector:          elector,
+		leader:           leaderState{done: make(chan struct{})},
+		cfgs:             map[string]AlertmanagerConfig{},
+		checksums:        map[string]string{},
+		resolvedSecrets:  map[string]resolvedSecrets{},
+		features:         map[string]map[string]bool{},
+		alertmanagers:    map[string]*Alertmanager{},
+		parked:           map[string]bool{},
+		applyStatus:      map[string]ApplyStatus{},
+		applyStatusDirty: map[string]bool{},
+		applyStatusCh:    make(chan struct{}, 1),
+		diskBackoff:      newDiskBackoff(),
+		streamsStop:      make(chan struct{}),
+		configEvents:     newConfigEvents(),
+		resyncCh:         make(chan chan error),
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+		peer:             nil,
+		archive:          archive,
+		archiveCh:        make(chan archiveRequest, archiveQueueSize),
+		archiveDone:      make(chan struct{}),
+	}
+	globalInhibitRulesCount.Set(float64(len(cfg.globalInhibitRules)))
+	if cfg.AdminAuthMode == AdminAuthNone && !cfg.AdminAllowUnauthenticated {
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: the admin API is unauthenticated, this is deprecated without alertmanager.admin.insecure-allow-unauthenticated; set alertmanager.admin.auth-mode=token and alertmanager.admin.token-file to secure it"))
+	}
+	if elector == nil {
+		isLeader.Set(1)
 	}
 
 	if cfg.ClusterBindAddr != "" {
@@ -100,13 +248,17 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, configClient
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to get advertise address")
 		}
+		peers, err := discoverPeers(cfg, advertiseAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to discover peers")
+		}
 		am.peer, err = cluster.Create(
 			log.With(logger.Logger, "component", "cluster"),
 			// TODO: promethues registry
 			prometheus.DefaultRegisterer,
 			cfg.ClusterBindAddr,
 			advertiseAddr,
-			cfg.Peers,
+			peers,
 			true,
 			cfg.PushPullInterval,
 			cfg.GossipInterval,
@@ -117,6 +269,13 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, configClient
 		if err != nil {
 			return nil, errors.Errorf("failed to create gossipe cluster: %v", err)
 		}
+		// The states are added before joining, as the peer reads them
+		// without locking once gossiping.
+		am.peerStates = newPeerStates(am.peer, prometheus.DefaultRegisterer)
+		am.peerWait = clusterWait(am.peer, cfg.PeerTimeout)
+		if cfg.PeerWait == PeerWaitZone {
+			am.peerWait = newPeerZones(am.peer, am.peerStates, cfg.Zone).wait(cfg.ZonePeerTimeout, cfg.PeerTimeout)
+		}
 
 		// TODO: Add retry?
 		err = am.peer.Join(
@@ -138,30 +297,135 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, configClient
 func (am *MultitenantAlertmanager) Run() {
 	defer close(am.done)
 
-	// Load initial set of all configurations before polling for new ones.
-	am.addNewConfigs(am.loadAllConfigs())
-	ticker := time.NewTicker(am.cfg.PollInterval)
+	go am.storeApplyStatus()
+	if am.archive != nil {
+		go am.runArchiver()
+	}
+	if am.elector != nil {
+		go am.runLeaderElection()
+	}
+	if am.cfg.SyntheticProbeInterval > 0 {
+		go am.runProber()
+	}
+
+	// The global inhibition rules and the library templates are loaded
+	// first so that the initial pipelines include them.
+	if err := am.syncGlobalInhibitRules(); err != nil {
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error loading global inhibit rules", "err", err))
+	}
+	if err := am.syncTemplateLibrary(); err != nil {
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error loading library templates", "err", err))
+	}
+
+	// Load initial set of all configurations before watching for new ones.
+	start := time.Now()
+	am.loadAllConfigs()
+	initialSyncDuration.Set(time.Since(start).Seconds())
+	atomic.StoreInt32(&am.synced, 1)
+	Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: initial configs applied", "duration", time.Since(start)))
+
+	// Updates are applied once no further update arrived for the debounce
+	// period, see applyDebounce. All configs are loaded periodically in case
+	// updates were lost.
+	ticker := time.NewTicker(am.cfg.ResyncInterval)
+	defer ticker.Stop()
+	diskUsage := time.NewTicker(am.cfg.DiskUsageInterval)
+	defer diskUsage.Stop()
+	debounce := time.NewTimer(0)
+	<-debounce.C
+	pending := &applyDebounce{period: am.cfg.ApplyDebounce, maxDelay: am.cfg.ApplyMaxDelay}
+	var idle <-chan time.Time
+	if am.cfg.IdleTimeout > 0 {
+		interval := am.cfg.IdleTimeout / 2
+		if interval > time.Minute {
+			interval = time.Minute
+		}
+		idleTicker := time.NewTicker(interval)
+		defer idleTicker.Stop()
+		idle = idleTicker.C
+	}
 	for {
 		select {
-		case <-ticker.C:
+		case <-idle:
+			am.parkIdle()
+		case <-diskUsage.C:
+			am.checkDiskUsage()
+		case <-am.configsClient.Updated():
+			debounce.Reset(pending.update(time.Now()))
+		case <-debounce.C:
+			pending.applied()
 			err := am.updateConfigs()
+			if err == ErrResyncRequired {
+				err = am.resyncConfigs()
+			}
 			if err != nil {
 				Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error updating configs", "err", err))
 			}
+		case <-ticker.C:
+			if err := am.syncGlobalInhibitRules(); err != nil {
+				Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error loading global inhibit rules", "err", err))
+			}
+			if err := am.syncTemplateLibrary(); err != nil {
+				Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error loading library templates", "err", err))
+			}
+			if err := am.resyncConfigs(); err != nil {
+				Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error resyncing configs", "err", err))
+			}
+		case done := <-am.resyncCh:
+			done <- am.forceResync()
 		case <-am.stop:
-			ticker.Stop()
+			debounce.Stop()
 			return
 		}
 	}
 }
 
+// applyDebounce delays applying config updates until no further update
+// arrived for the period. A steady stream of updates is still applied once
+// the max delay elapsed since the first pending update, if set.
+type applyDebounce struct {
+	period   time.Duration
+	maxDelay time.Duration
+	// pendingSince is the time of the first update not applied yet.
+	pendingSince time.Time
+}
+
+// update returns how long to wait before applying the updates, as one more
+// arrived at now.
+func (d *applyDebounce) update(now time.Time) time.Duration {
+	if d.pendingSince.IsZero() {
+		d.pendingSince = now
+	}
+	wait := d.period
+	if d.maxDelay > 0 {
+		if left := d.pendingSince.Add(d.maxDelay).Sub(now); left < wait {
+			wait = left
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// applied marks the pending updates applied.
+func (d *applyDebounce) applied() {
+	d.pendingSince = time.Time{}
+}
+
 // Stop stops the MultitenantAlertmanager.
 func (am *MultitenantAlertmanager) Stop() {
 	close(am.stop)
 	<-am.done
+	if am.elector != nil {
+		<-am.leader.done
+	}
 	for _, am := range am.alertmanagers {
 		am.Stop()
 	}
+	if am.archive != nil {
+		<-am.archiveDone
+	}
 
 	if am.settleCtxCancel != nil {
 		am.settleCtxCancel()
@@ -174,23 +438,105 @@ func (am *MultitenantAlertmanager) Stop() {
 	Must(level.Debug(logger.Logger).Log("msg", "MultitenantAlertmanager stopped"))
 }
 
-// Load the full set of configurations from the server, retrying with backoff
-// until we can get them.
-func (am *MultitenantAlertmanager) loadAllConfigs() []AlertmanagerConfig {
+// Load and apply the full set of configurations from the server, retrying
+// with backoff until we can get them.
+func (am *MultitenantAlertmanager) loadAllConfigs() {
 	backoff := util.NewBackoff(context.Background(), backoffConfig)
 	for {
-		cfgs, err := am.poll(true)
+		err := am.resyncConfigs()
 		if err == nil {
-			Must(level.Debug(logger.Logger).Log("msg", "MultitenantAlertmanager: initial configuration load", "num_configs", len(cfgs)))
-			return cfgs
+			return
 		}
 		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error fetching all configurations, backing off", "err", err))
 		backoff.Wait()
 	}
 }
 
+// resyncConfigs loads and applies all configs page by page, so that only a
+// page of configs is held in memory, and stops the Alertmanagers of users
+// whose configs were removed.
+func (am *MultitenantAlertmanager) resyncConfigs() error {
+	present := map[string]bool{}
+	opts := ListConfigsOptions{Limit: am.cfg.ConfigsPageSize}
+	for {
+		cfgs, next, err := am.listConfigs(opts)
+		if err != nil {
+			return err
+		}
+		for _, cfg := range cfgs {
+			present[cfg.UserID] = true
+		}
+		am.addNewConfigs(cfgs)
+		if next == "" {
+			break
+		}
+		opts.Continue = next
+	}
+	Must(level.Debug(logger.Logger).Log("msg", "MultitenantAlertmanager: all configs loaded", "num_configs", len(present)))
+
+	var deleted []AlertmanagerConfig
+	am.cfgMutex.RLock()
+	for userID := range am.cfgs {
+		if !present[userID] {
+			deleted = append(deleted, AlertmanagerConfig{UserID: userID, DeletedAtInUnix: time.Now().Unix()})
+		}
+	}
+	am.cfgMutex.RUnlock()
+	if len(deleted) > 0 {
+		am.addNewConfigs(deleted)
+	}
+	return nil
+}
+
+// Resync loads the global inhibition rules, the library templates and all
+// configs again, and applies the configs even if they are unchanged, which
+// writes their template files again. It is used after the storage was
+// restored from a backup, or to repair the state of a user on this replica.
+func (am *MultitenantAlertmanager) Resync(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case am.resyncCh <- done:
+	case <-am.stop:
+		return errors.New("the multitenant alertmanager is stopping")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forceResync makes a resync requested by Resync. The checksums of the
+// applied configs are forgotten, so that no config is skipped.
+func (am *MultitenantAlertmanager) forceResync() error {
+	start := time.Now()
+	Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: forced resync started"))
+	if err := am.syncGlobalInhibitRules(); err != nil {
+		return errors.Wrap(err, "failed to load global inhibit rules")
+	}
+	if err := am.syncTemplateLibrary(); err != nil {
+		return errors.Wrap(err, "failed to load library templates")
+	}
+	am.cfgMutex.Lock()
+	am.checksums = map[string]string{}
+	am.resolvedSecrets = map[string]resolvedSecrets{}
+	am.cfgMutex.Unlock()
+	if err := am.resyncConfigs(); err != nil {
+		return errors.Wrap(err, "failed to resync configs")
+	}
+	Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: forced resync done", "duration", time.Since(start)))
+	return nil
+}
+
 func (am *MultitenantAlertmanager) updateConfigs() error {
-	cfgs, err := am.poll(false)
+	var cfgs []AlertmanagerConfig
+	err := am.requestConfigs(func(ctx context.Context) (err error) {
+		cfgs, err = am.configsClient.GetAllUpdatedConfigs(ctx)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -198,42 +544,86 @@ func (am *MultitenantAlertmanager) updateConfigs() error {
 	return nil
 }
 
-// poll the configuration server. Not re-entrant.
-// if `all` is, then it will fetch all the configs. Otherwise only the updates
-func (am *MultitenantAlertmanager) poll(all bool) ([]AlertmanagerConfig, error) {
-	var cfgs []AlertmanagerConfig
-	err := instrument.CollectedRequest(context.Background(), "Configs.GetAlertmanagerConfigs", configsRequestDuration, instrument.ErrorCode, func(_ context.Context) error {
-		var err error
-		if all {
-			cfgs, err = am.configsClient.GetAllConfigs()
-		} else {
-			cfgs, err = am.configsClient.GetAllUpdatedConfigs()
-		}
+// listConfigs gets a page of configs from the configuration server.
+func (am *MultitenantAlertmanager) listConfigs(opts ListConfigsOptions) ([]AlertmanagerConfig, string, error) {
+	var (
+		cfgs []AlertmanagerConfig
+		next string
+	)
+	err := am.requestConfigs(func(ctx context.Context) (err error) {
+		cfgs, next, err = am.configsClient.ListConfigs(ctx, opts)
 		return err
 	})
+	return cfgs, next, err
+}
+
+// requestConfigs makes an instrumented request to the configuration server.
+func (am *MultitenantAlertmanager) requestConfigs(f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ClientTimeout)
+	defer cancel()
+	err := instrument.CollectedRequest(ctx, "Configs.GetAlertmanagerConfigs", configsRequestDuration, instrument.ErrorCode, f)
 	if err != nil {
 		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: configs server poll failed", "err", err))
-		return nil, err
 	}
-	return cfgs, nil
+	return err
 }
 
 func (am *MultitenantAlertmanager) addNewConfigs(cfgs []AlertmanagerConfig) {
 	// TODO: instrument how many configs we have, both valid & invalid.
 	Must(level.Debug(logger.Logger).Log("msg", "adding configurations", "num_configs", len(cfgs)))
-	for _, config := range cfgs {
 
-		err := am.setConfig(config.UserID, &config)
-		if err != nil {
-			Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error applying config", "err", err))
-			continue
-		}
+	// The configs are partitioned by user across the workers, so that the
+	// configs of a user are applied in order.
+	workers := am.cfg.ApplyConcurrency
+	if workers > len(cfgs) {
+		workers = len(cfgs)
 	}
+	parts := make([][]*AlertmanagerConfig, workers)
+	for i := range cfgs {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(cfgs[i].UserID))
+		w := h.Sum32() % uint32(workers)
+		parts[w] = append(parts[w], &cfgs[i])
+	}
+
+	var wg sync.WaitGroup
+	for _, part := range parts {
+		wg.Add(1)
+		go func(part []*AlertmanagerConfig) {
+			defer wg.Done()
+			for _, config := range part {
+				am.applyConfig(config)
+			}
+		}(part)
+	}
+	wg.Wait()
+
+	am.cfgMutex.RLock()
 	totalConfigs.Set(float64(len(am.cfgs)))
+	am.cfgMutex.RUnlock()
+	am.updateInstanceMetrics()
+}
+
+func (am *MultitenantAlertmanager) applyConfig(config *AlertmanagerConfig) {
+	start := time.Now()
+	sp, ctx := opentracing.StartSpanFromContext(context.Background(), "ApplyConfig")
+	sp.SetTag("tenant", config.UserID)
+	defer sp.Finish()
+	ctx, cancel := context.WithTimeout(ctx, am.cfg.ApplyTimeout)
+	err := am.setConfig(ctx, config.UserID, config)
+	cancel()
+	status := "success"
+	if err != nil {
+		tracing.SetError(sp, err)
+		status = "failure"
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error applying config", "err", err))
+		am.recordApply(config, err)
+	}
+	configApplyDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
 }
 
 func (am *MultitenantAlertmanager) createTemplatesFile(userID, fn, content string) (bool, error) {
-	dir := filepath.Join(am.cfg.DataDir, "templates", userID, filepath.Dir(fn))
+	dir := filepath.Join(templatesDir(am.cfg.DataDir, userID), filepath.Dir(fn))
 	err := os.MkdirAll(dir, 0755)
 	if err != nil {
 		return false, errors.Errorf("unable to create Alertmanager templates directory %q: %s", dir, err)
@@ -254,92 +644,249 @@ func (am *MultitenantAlertmanager) createTemplatesFile(userID, fn, content strin
 
 // setConfig applies the given configuration to the alertmanager for `userID`,
 // creating an alertmanager if it doesn't already exist.
-func (am *MultitenantAlertmanager) setConfig(userID string, config *AlertmanagerConfig) error {
+func (am *MultitenantAlertmanager) setConfig(ctx context.Context, userID string, config *AlertmanagerConfig) error {
 	if config == nil {
 		return errors.Errorf("alertmanager config is nil for user %v", userID)
 	}
 
-	am.cfgMutex.Lock()
-	defer am.cfgMutex.Unlock()
-	// if deleted, then stop the alertmanager and delete config
-	if config.DeactivatedAtInUnix > 0 || config.DeletedAtInUnix > 0 {
+	mtx := am.userLock(userID)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// if deleted, then stop the alertmanager and delete config. The users
+	// not selected by this replica are run by others.
+	if config.DeactivatedAtInUnix > 0 || config.DeletedAtInUnix > 0 || !am.cfg.selects(config.Labels) {
 		am.alertmanagersMtx.Lock()
-		if a, ok := am.alertmanagers[userID]; ok {
+		a, ok := am.alertmanagers[userID]
+		delete(am.alertmanagers, userID)
+		delete(am.parked, userID)
+		am.alertmanagersMtx.Unlock()
+		if ok {
 			a.Stop()
-			delete(am.alertmanagers, userID)
 		}
-		am.alertmanagersMtx.Unlock()
 
+		am.cfgMutex.Lock()
 		delete(am.cfgs, userID)
+		delete(am.checksums, userID)
+		delete(am.resolvedSecrets, userID)
+		am.cfgMutex.Unlock()
+		am.setFeatures(userID, nil)
+		am.deleteApplyStatus(userID)
+		deleteDiskUsageMetrics(userID)
+		am.diskBackoff.reset(userID)
 		return nil
 	}
 
 	am.alertmanagersMtx.Lock()
-	_, hasExisting := am.alertmanagers[userID]
+	existing, hasExisting := am.alertmanagers[userID]
+	parked := am.parked[userID]
 	am.alertmanagersMtx.Unlock()
+	checksum := configChecksum(config)
+	am.cfgMutex.RLock()
+	unchanged := am.checksums[userID] == checksum
+	prevSecrets, hasSecrets := am.resolvedSecrets[userID]
+	am.cfgMutex.RUnlock()
+	// Configs holding secret references are resolved again periodically,
+	// so that rotated secrets are applied.
+	refresh := unchanged && hasSecrets && am.cfg.SecretRefreshInterval > 0 && time.Since(prevSecrets.resolvedAt) >= am.cfg.SecretRefreshInterval
 
-	var amConfig *amconfig.Config
-	var err error
-	var hasTemplateChanges bool
+	// The feature overrides are not part of the checksum, they apply to the
+	// running pipeline.
+	am.setFeatures(userID, config.Features)
 
-	for fn, content := range config.TemplateFiles {
-		hasChanged, err := am.createTemplatesFile(userID, fn, content)
-		if err != nil {
-			return err
+	// Unchanged configs are skipped without touching the template files.
+	// Their canary is not part of the checksum.
+	if (hasExisting || parked) && unchanged && !refresh {
+		if hasExisting {
+			am.syncCanary(ctx, existing, config)
 		}
+		configApplies.WithLabelValues("skipped").Inc()
+		return nil
+	}
 
-		if hasChanged {
-			hasTemplateChanges = true
+	for fn, content := range config.TemplateFiles {
+		if _, err := am.createTemplatesFile(userID, fn, content); err != nil {
+			return err
 		}
 	}
 
-	amConfig, err = amconfig.Load(config.Config)
+	resolved, err := am.secretResolver.Resolve(ctx, userID, config.Config)
+	if err != nil {
+		return errors.Errorf("failed load alertmanager config for user %v: %v", userID, err)
+	}
+	resolvedSum := ""
+	if resolved != config.Config {
+		h := sha256.Sum256([]byte(resolved))
+		resolvedSum = hex.EncodeToString(h[:])
+	}
+	if refresh && resolvedSum == prevSecrets.checksum {
+		am.cfgMutex.Lock()
+		am.resolvedSecrets[userID] = resolvedSecrets{checksum: resolvedSum, resolvedAt: time.Now()}
+		am.cfgMutex.Unlock()
+		configApplies.WithLabelValues("skipped").Inc()
+		return nil
+	}
+	amConfig, err := notify.LoadConfig(resolved)
 	if err != nil {
 		return errors.Errorf("failed load alertmanager config for user %v: %v", userID, err)
 	}
+	if err := ctx.Err(); err != nil {
+		return errors.Errorf("aborted applying config for user %v: %v", userID, err)
+	}
 
-	am.alertmanagersMtx.Lock()
-	defer am.alertmanagersMtx.Unlock()
-	// If no Alertmanager instance exists for this user yet, start one.
-	if !hasExisting {
-		newAM, err := am.newAlertmanager(userID, amConfig)
+	switch {
+	case parked:
+		// The new config is used once the Alertmanager is rebuilt.
+	case !hasExisting:
+		// If no Alertmanager instance exists for this user yet, start one.
+		newAM, err := am.newAlertmanager(ctx, config, amConfig)
 		if err != nil {
 			return err
 		}
+		am.alertmanagersMtx.Lock()
 		am.alertmanagers[userID] = newAM
-		am.cfgs[userID] = *config
-	} else if am.cfgs[userID].Config != config.Config || hasTemplateChanges {
+		am.alertmanagersMtx.Unlock()
+	case existing.cfg.retention() != am.Retention(config.Retention) || existing.cfg.Limits != am.cfg.dispatchLimits(config.Labels):
+		// The retention and the limits are set when the Alertmanager is
+		// created.
+		if _, err := am.rebuildAlertmanager(ctx, existing, config, amConfig); err != nil {
+			return err
+		}
+	default:
 		// If the config changed, apply the new one.
-		err := am.alertmanagers[userID].ApplyConfig(userID, amConfig)
+		externalURL, err := tenantExternalURL(config)
+		if err != nil {
+			return err
+		}
+		err = existing.ApplyConfig(ctx, userID, amConfig, externalURL)
 		if err != nil {
 			return errors.Errorf("unable to apply Alertmanager config for user %v: %v", userID, err)
 		}
-		am.cfgs[userID] = *config
+		am.syncCanary(ctx, existing, config)
+	}
+	am.cfgMutex.Lock()
+	am.cfgs[userID] = *config
+	am.checksums[userID] = checksum
+	if resolvedSum != "" {
+		am.resolvedSecrets[userID] = resolvedSecrets{checksum: resolvedSum, resolvedAt: time.Now()}
+	} else {
+		delete(am.resolvedSecrets, userID)
 	}
+	am.cfgMutex.Unlock()
+	configApplies.WithLabelValues("performed").Inc()
+	am.recordApply(config, nil)
 	return nil
 }
 
-func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amconfig.Config) (*Alertmanager, error) {
+// configChecksum returns a hash of the content of cfg, that is of the config,
+// the template files, the external URL and the retention overrides.
+func configChecksum(cfg *AlertmanagerConfig) string {
+	h := sha256.New()
+	write := func(s string) {
+		// The length prefix keeps adjacent fields apart.
+		_, _ = fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	write(cfg.Config)
+	write(cfg.ExternalURL)
+	names := make([]string, 0, len(cfg.TemplateFiles))
+	for fn := range cfg.TemplateFiles {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+	for _, fn := range names {
+		write(fn)
+		write(cfg.TemplateFiles[fn])
+	}
+	// The checksum of configs without overrides is kept as it was.
+	if !cfg.Retention.empty() {
+		for _, f := range cfg.Retention.fields() {
+			write(f.value)
+		}
+	}
+	// The labels select the limits, and the checksum of configs without
+	// labels is kept as it was too.
+	if len(cfg.Labels) > 0 {
+		write("labels")
+		write(labelsString(cfg.Labels))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// resolvedSecrets is the checksum of a config with its secret references
+// resolved, and the time they were resolved.
+type resolvedSecrets struct {
+	checksum   string
+	resolvedAt time.Time
+}
+
+// loadConfig loads the config of a user with its secret references resolved.
+// The resolved config is never stored.
+func (am *MultitenantAlertmanager) loadConfig(ctx context.Context, cfg *AlertmanagerConfig) (*notify.Config, error) {
+	resolved, err := am.secretResolver.Resolve(ctx, cfg.UserID, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return notify.LoadConfig(resolved)
+}
+
+// tenantExternalURL returns the external URL of the user of cfg, or nil if
+// the user has none.
+func tenantExternalURL(cfg *AlertmanagerConfig) (*url.URL, error) {
+	if cfg.ExternalURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(cfg.ExternalURL)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse external url of user %v: %v", cfg.UserID, err)
+	}
+	return u, nil
+}
+
+func (am *MultitenantAlertmanager) newAlertmanager(ctx context.Context, cfg *AlertmanagerConfig, amConfig *notify.Config) (*Alertmanager, error) {
+	userID := cfg.UserID
 	u, err := url.Parse(am.cfg.PathPrefix)
 	if err != nil {
 		return nil, errors.Errorf("failed to parse external url: %v", err)
 	}
+	externalURL, err := tenantExternalURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	retention := am.Retention(cfg.Retention)
 	newAM, err := NewAlertmanager(&Config{
 		UserID:      userID,
 		DataDir:     am.cfg.DataDir,
 		Logger:      logger.Logger,
-		Retention:   am.cfg.Retention,
+		Retention:   retention.Silences,
 		ExternalURL: u,
 		Peer:        am.peer,
+		PeerStates:  am.peerStates,
 		PeerTimeout: am.cfg.PeerTimeout,
+		PeerWait:    am.peerWait,
+
+		StateBucket:          am.stateBucket,
+		StatePersistInterval: am.cfg.StatePersistInterval,
+
+		NotificationLogRetention: retention.NotificationLog,
+		AlertGCInterval:          retention.AlertGCInterval,
+
+		GlobalInhibitRules: am.globalInhibitRules,
+		LibraryDir:         am.libraryDir,
+		IsLeader:           am.IsLeader,
+		Archive:            am.archiveFunc(userID),
+		SyntheticProbes:    am.cfg.SyntheticProbeInterval > 0,
+		Limits:             am.cfg.dispatchLimits(cfg.Labels),
+		Features:           am.featureFunc(userID),
 	})
 	if err != nil {
 		return nil, errors.Errorf("unable to start Alertmanager for user %v: %v", userID, err)
 	}
 
-	if err := newAM.ApplyConfig(userID, amConfig); err != nil {
+	if err := newAM.ApplyConfig(ctx, userID, amConfig, externalURL); err != nil {
+		newAM.Stop()
 		return nil, errors.Errorf("unable to apply initial config for user %v: %v", userID, err)
 	}
+	am.syncCanary(ctx, newAM, cfg)
 	return newAM, nil
 }
 
@@ -350,11 +897,22 @@ func (am *MultitenantAlertmanager) ServeHTTP(w http.ResponseWriter, req *http.Re
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-	am.alertmanagersMtx.Lock()
-	userAM, ok := am.alertmanagers[userID]
-	am.alertmanagersMtx.Unlock()
-	if !ok {
-		http.Error(w, fmt.Sprintf("no Alertmanager for this user ID"), http.StatusNotFound)
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	if am.rejectDraining(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rejectOverLimits(w, req, userID, userAM) {
 		return
 	}
 	userAM.mux.ServeHTTP(w, req)
@@ -397,3 +955,98 @@ func (am *MultitenantAlertmanager) ClusterStatus(w http.ResponseWriter, req *htt
 		Must(utilerrors.NewAggregate([]error{err, e2}))
 	}
 }
+
+// queuedMessagesMetric is the gauge of the gossip messages waiting to be
+// sent, which the peer does not expose otherwise.
+const queuedMessagesMetric = "alertmanager_cluster_messages_queued"
+
+// PeerInfo is a member of the gossip cluster.
+type PeerInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// TenantGossipStatus is the replication health of the gossiped states of a
+// user on this replica.
+type TenantGossipStatus struct {
+	UserID string `json:"userID"`
+	// Running is true if the Alertmanager of the user runs on this replica,
+	// the states of the other users are not merged.
+	Running  bool               `json:"running"`
+	Silences *GossipStateStatus `json:"silences,omitempty"`
+	Nflog    *GossipStateStatus `json:"nflog,omitempty"`
+}
+
+// ClusterStatusV2 is the status of the gossip cluster seen by this replica,
+// with the replication health of the states of the users.
+type ClusterStatusV2 struct {
+	Status string     `json:"status"`
+	Self   *PeerInfo  `json:"self,omitempty"`
+	Peers  []PeerInfo `json:"peers"`
+	// QueuedMessages is the number of gossip messages of all users waiting
+	// to be sent.
+	QueuedMessages int                  `json:"queuedMessages"`
+	Tenants        []TenantGossipStatus `json:"tenants"`
+}
+
+// ClusterStatusV2 returns the status of the gossip cluster with the gossip
+// statistics of the states of each user running on this replica, or only of
+// the user given with the `user` query parameter.
+func (am *MultitenantAlertmanager) ClusterStatusV2(w http.ResponseWriter, req *http.Request) {
+	status := ClusterStatusV2{Status: "disabled", Peers: []PeerInfo{}, Tenants: []TenantGossipStatus{}}
+	if am.peer == nil {
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+	status.Status = am.peer.Status()
+	self := am.peer.Self()
+	status.Self = &PeerInfo{Name: self.Name, Address: fmt.Sprintf("%s:%d", self.Addr.String(), self.Port)}
+	for _, nd := range am.peer.Peers() {
+		status.Peers = append(status.Peers, PeerInfo{Name: nd.Name, Address: fmt.Sprintf("%s:%d", nd.Addr.String(), nd.Port)})
+	}
+	status.QueuedMessages = int(gaugeValue(prometheus.DefaultGatherer, queuedMessagesMetric))
+
+	am.alertmanagersMtx.Lock()
+	running := make(map[string]bool, len(am.alertmanagers))
+	for userID := range am.alertmanagers {
+		running[userID] = true
+	}
+	am.alertmanagersMtx.Unlock()
+
+	var userIDs []string
+	if userID := req.URL.Query().Get("user"); userID != "" {
+		userIDs = []string{userID}
+	} else {
+		for userID := range running {
+			userIDs = append(userIDs, userID)
+		}
+		sort.Strings(userIDs)
+	}
+	for _, userID := range userIDs {
+		status.Tenants = append(status.Tenants, TenantGossipStatus{
+			UserID:   userID,
+			Running:  running[userID],
+			Silences: am.peerStates.status(silencesChannelKey(userID)),
+			Nflog:    am.peerStates.status(nflogChannelKey(userID)),
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// gaugeValue returns the value of the gauge without labels named name, 0 if
+// it is not registered.
+func gaugeValue(g prometheus.Gatherer, name string) float64 {
+	mfs, err := g.Gather()
+	if err != nil {
+		Must(level.Warn(logger.Logger).Log("msg", "failed to gather metrics", "err", err))
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			return m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
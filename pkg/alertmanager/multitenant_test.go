@@ -0,0 +1,33 @@
+package alertmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyDebounce(t *testing.T) {
+	d := &applyDebounce{period: 250 * time.Millisecond, maxDelay: time.Second}
+	start := time.Now()
+
+	// Updates arriving within the period postpone the apply, until the max
+	// delay from the first one.
+	for i, want := range []time.Duration{250, 250, 250, 250, 200, 0} {
+		now := start.Add(time.Duration(i) * 200 * time.Millisecond)
+		if got := d.update(now); got != want*time.Millisecond {
+			t.Fatalf("update %d: expected to wait %dms, got %s", i, want, got)
+		}
+	}
+
+	// The next update waits for the full period again.
+	d.applied()
+	if got := d.update(start.Add(2 * time.Second)); got != 250*time.Millisecond {
+		t.Fatalf("expected to wait the period after applying, got %s", got)
+	}
+
+	// Without a max delay, updates only wait for the period.
+	d = &applyDebounce{period: 250 * time.Millisecond}
+	d.update(start)
+	if got := d.update(start.Add(time.Hour)); got != 250*time.Millisecond {
+		t.Fatalf("expected to wait the period, got %s", got)
+	}
+}
@@ -0,0 +1,191 @@
+package alertmanager
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/pkg/parse"
+	"github.com/prometheus/alertmanager/store"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// NotificationLookup is the aggregation groups of an alert, with the last
+// notifications of each group recorded in the notification log.
+type NotificationLookup struct {
+	Fingerprint string               `json:"fingerprint"`
+	Labels      model.LabelSet       `json:"labels"`
+	Groups      []GroupNotifications `json:"groups"`
+}
+
+// GroupNotifications is an aggregation group of an alert and the last
+// notification of the group by each integration of its receiver.
+type GroupNotifications struct {
+	Receiver     string                    `json:"receiver"`
+	RouteKey     string                    `json:"routeKey"`
+	GroupKey     string                    `json:"groupKey"`
+	GroupLabels  model.LabelSet            `json:"groupLabels"`
+	Integrations []IntegrationNotification `json:"integrations"`
+}
+
+// IntegrationNotification is the last notification of a group by an
+// integration. LastNotifiedAt is nil if the group was never notified, or
+// the entry expired from the notification log.
+type IntegrationNotification struct {
+	Name           string     `json:"name"`
+	LastNotifiedAt *time.Time `json:"lastNotifiedAt,omitempty"`
+	FiringAlerts   int        `json:"firingAlerts"`
+	ResolvedAlerts int        `json:"resolvedAlerts"`
+	// AlertFiring and AlertResolved tell whether the alert was among the
+	// firing or the resolved alerts of the last notification.
+	AlertFiring   bool `json:"alertFiring"`
+	AlertResolved bool `json:"alertResolved"`
+}
+
+// LookupNotifications returns the aggregation groups an alert with the
+// label set is routed to, and their last notifications. The alert needs
+// not be known to the Alertmanager.
+func (am *Alertmanager) LookupNotifications(lset model.LabelSet) (*NotificationLookup, error) {
+	p := am.getPipeline()
+	if p == nil {
+		return nil, fmt.Errorf("no configuration applied")
+	}
+
+	receivers := map[string]*notify.Receiver{}
+	for _, rc := range p.conf.Receivers {
+		receivers[rc.Name] = rc
+	}
+
+	alert := &types.Alert{Alert: model.Alert{Labels: lset}}
+	hash := notify.HashAlert(alert)
+	l := &NotificationLookup{
+		Fingerprint: lset.Fingerprint().String(),
+		Labels:      lset,
+		Groups:      []GroupNotifications{},
+	}
+	for _, r := range dispatch.NewRoute(p.conf.Route, nil).Match(lset) {
+		groupLabels := groupLabels(r, lset)
+		g := GroupNotifications{
+			Receiver:     r.RouteOpts.Receiver,
+			RouteKey:     r.Key(),
+			GroupKey:     fmt.Sprintf("%s:%s", r.Key(), groupLabels),
+			GroupLabels:  groupLabels,
+			Integrations: []IntegrationNotification{},
+		}
+		rc, ok := receivers[g.Receiver]
+		if !ok {
+			l.Groups = append(l.Groups, g)
+			continue
+		}
+		for _, i := range notify.BuildReceiverIntegrations(rc, p.tmpl, am.logger) {
+			n := IntegrationNotification{Name: fmt.Sprintf("%s[%d]", i.Name(), i.Index())}
+			entries, err := am.nflog.Query(
+				nflog.QGroupKey(g.GroupKey),
+				nflog.QReceiver(&nflogpb.Receiver{GroupName: rc.Name, Integration: i.Name(), Idx: uint32(i.Index())}),
+			)
+			if err != nil && err != nflog.ErrNotFound {
+				return nil, err
+			}
+			if len(entries) > 0 {
+				e := entries[0]
+				n.LastNotifiedAt = &e.Timestamp
+				n.FiringAlerts = len(e.FiringAlerts)
+				n.ResolvedAlerts = len(e.ResolvedAlerts)
+				n.AlertFiring = containsHash(e.FiringAlerts, hash)
+				n.AlertResolved = containsHash(e.ResolvedAlerts, hash)
+			}
+			g.Integrations = append(g.Integrations, n)
+		}
+		l.Groups = append(l.Groups, g)
+	}
+	return l, nil
+}
+
+func containsHash(hashes []uint64, hash uint64) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupNotifications returns the aggregation groups and the last
+// notifications of an alert of the user, selected by its fingerprint or by
+// label parameters like alertname="HighLatency" forming its label set.
+func (am *MultitenantAlertmanager) LookupNotifications(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params := req.URL.Query()
+	var fp model.Fingerprint
+	lset := model.LabelSet{}
+	for _, s := range params["label"] {
+		m, err := parse.Matcher(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid label: "+err.Error())
+			return
+		}
+		if m.Type != labels.MatchEqual {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid label %s: labels must be set with =", s))
+			return
+		}
+		lset[model.LabelName(m.Name)] = model.LabelValue(m.Value)
+	}
+	switch s := params.Get("fingerprint"); {
+	case s != "" && len(lset) > 0:
+		writeError(w, http.StatusBadRequest, "at most one of fingerprint & label must be set")
+		return
+	case s != "":
+		if fp, err = model.ParseFingerprint(s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid fingerprint: %v", err))
+			return
+		}
+	case len(lset) == 0:
+		writeError(w, http.StatusBadRequest, "missing fingerprint or label")
+		return
+	}
+
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(lset) == 0 {
+		alert, err := userAM.alerts.Get(fp)
+		if err == store.ErrNotFound {
+			writeError(w, http.StatusNotFound, "alert not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		lset = alert.Labels
+	}
+
+	l, err := userAM.LookupNotifications(lset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
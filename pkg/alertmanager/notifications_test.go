@@ -0,0 +1,68 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestLookupNotifications(t *testing.T) {
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+  group_by: [alertname]
+  routes:
+  - match:
+      team: db
+    receiver: db
+    group_by: [cluster]
+    continue: true
+  - receiver: team
+receivers:
+- name: team
+- name: db
+  webhook_configs:
+  - url: http://localhost/db
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lset := model.LabelSet{"alertname": "Slow", "team": "db", "cluster": "b"}
+	l, err := am.LookupNotifications(lset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Groups) != 2 || l.Groups[0].Receiver != "db" || l.Groups[1].Receiver != "team" {
+		t.Fatalf("expected the alert to be routed to db and team, got %+v", l.Groups)
+	}
+	db := l.Groups[0]
+	if db.GroupLabels["cluster"] != "b" || len(db.GroupLabels) != 1 {
+		t.Fatalf("unexpected group labels %v", db.GroupLabels)
+	}
+	if len(db.Integrations) != 1 || db.Integrations[0].Name != "webhook[0]" || db.Integrations[0].LastNotifiedAt != nil {
+		t.Fatalf("expected a webhook never notified, got %+v", db.Integrations)
+	}
+
+	hash := notify.HashAlert(&types.Alert{Alert: model.Alert{Labels: lset}})
+	recv := &nflogpb.Receiver{GroupName: "db", Integration: "webhook", Idx: 0}
+	if err := am.nflog.Log(recv, db.GroupKey, []uint64{hash, 1}, []uint64{2}); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = am.LookupNotifications(lset); err != nil {
+		t.Fatal(err)
+	}
+	n := l.Groups[0].Integrations[0]
+	if n.LastNotifiedAt == nil || n.FiringAlerts != 2 || n.ResolvedAlerts != 1 || !n.AlertFiring || n.AlertResolved {
+		t.Fatalf("expected the last notification with the firing alert, got %+v", n)
+	}
+}
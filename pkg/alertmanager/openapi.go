@@ -0,0 +1,1001 @@
+package alertmanager
+
+import (
+	"io"
+	"net/http"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// getOpenAPISpec serves the OpenAPI specification of the config API.
+func (a *API) getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.WriteString(w, openAPISpec); err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error writing openapi spec", "err", err))
+	}
+}
+
+// openAPISpec is the OpenAPI v3 specification of the config API, and of the
+// silence and status endpoints of the Alertmanagers of the users. The client
+// in pkg/client follows it, both must be changed together.
+const openAPISpec = `{
+  "openapi": "3.0.0",
+  "info": {
+    "title": "Multitenant Alertmanager",
+    "description": "Config API of the multitenant Alertmanager. All requests are made on behalf of the user in the X-AppsCode-UserID header, which is set by the authenticating proxy. The silences of a user are served by upstream Alertmanager below the path prefix, /api/prom/alertmanager by default.",
+    "version": "v1"
+  },
+  "paths": {
+    "/api/v1/config": {
+      "get": {
+        "operationId": "getConfig",
+        "summary": "Get the config of the user with its apply status. Secrets are redacted unless reveal is set. A config with template files is not returned as YAML.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "reveal", "in": "query", "description": "Return the secrets, requires the reveal scope.", "schema": {"type": "boolean"}},
+          {"$ref": "#/components/parameters/IfNoneMatch"}
+        ],
+        "responses": {
+          "200": {"description": "The config.", "headers": {"ETag": {"$ref": "#/components/headers/ETag"}}, "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/ConfigWithStatus"}},
+            "application/yaml": {"schema": {"type": "string"}}
+          }},
+          "304": {"description": "The config matches If-None-Match.", "headers": {"ETag": {"$ref": "#/components/headers/ETag"}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "setConfig",
+        "summary": "Replace the config of the user. A YAML config replaces the Alertmanager config only, keeping the stored template files and external URL. Storing the active config again changes nothing.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"$ref": "#/components/parameters/IfMatch"},
+          {"$ref": "#/components/parameters/IfNoneMatch"},
+          {"name": "revision", "in": "query", "description": "Revision of the stored config, for YAML and form bodies.", "schema": {"type": "integer", "format": "int64"}}
+        ],
+        "requestBody": {"required": true, "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/Config"}},
+          "application/yaml": {"schema": {"type": "string"}},
+          "multipart/form-data": {"schema": {"type": "object", "properties": {
+            "config": {"type": "string"},
+            "externalURL": {"type": "string"}
+          }, "additionalProperties": {"type": "string", "format": "binary"}}}
+        }},
+        "responses": {
+          "200": {"description": "The config was stored, it has lint warnings.", "headers": {"ETag": {"$ref": "#/components/headers/ETag"}}, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LintResult"}}}},
+          "204": {"description": "The config was stored.", "headers": {"ETag": {"$ref": "#/components/headers/ETag"}}},
+          "409": {"description": "The revision is not the one of the stored config.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "412": {"description": "The stored config does not match If-Match, or matches If-None-Match.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "operationId": "putConfig",
+        "summary": "Replace the config of the user like setConfig. With If-Match the stored config is only replaced if it was not changed since it was read, with If-None-Match: * a config is only created.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"$ref": "#/components/parameters/IfMatch"},
+          {"$ref": "#/components/parameters/IfNoneMatch"},
+          {"name": "revision", "in": "query", "description": "Revision of the stored config, for YAML and form bodies.", "schema": {"type": "integer", "format": "int64"}}
+        ],
+        "requestBody": {"required": true, "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/Config"}},
+          "application/yaml": {"schema": {"type": "string"}},
+          "multipart/form-data": {"schema": {"type": "object", "properties": {
+            "config": {"type": "string"},
+            "externalURL": {"type": "string"}
+          }, "additionalProperties": {"type": "string", "format": "binary"}}}
+        }},
+        "responses": {
+          "200": {"description": "The config was stored, it has lint warnings.", "headers": {"ETag": {"$ref": "#/components/headers/ETag"}}, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LintResult"}}}},
+          "204": {"description": "The config was stored.", "headers": {"ETag": {"$ref": "#/components/headers/ETag"}}},
+          "409": {"description": "The revision is not the one of the stored config.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "412": {"description": "The stored config does not match If-Match, or matches If-None-Match.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/deactivate": {
+      "delete": {
+        "operationId": "deactivateConfig",
+        "summary": "Deactivate the config of the user, stopping its Alertmanager.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The config was deactivated."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/restore": {
+      "post": {
+        "operationId": "restoreConfig",
+        "summary": "Restore the deactivated config of the user.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The config was restored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/status": {
+      "get": {
+        "operationId": "getConfigStatus",
+        "summary": "Get whether the stored config was applied by the replicas.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The apply status.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigStatus"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/route-test": {
+      "post": {
+        "operationId": "routeTest",
+        "summary": "Get the routes the label sets are matched by.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RouteTestRequest"}}}},
+        "responses": {
+          "200": {"description": "The routes of each label set.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/RouteTestResult"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/lint": {
+      "get": {
+        "operationId": "lintConfig",
+        "summary": "Get the best practices the stored config of the user does not follow, like routes without group_by or unused receivers.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The lint warnings.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LintResult"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/diff": {
+      "post": {
+        "operationId": "diffConfig",
+        "summary": "Get the changes of the routes, receivers, global section, inhibition rules and templates between the stored config of the user and the given config, which is not stored. Changed secrets are flagged without their values.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/Config"}},
+          "application/yaml": {"schema": {"type": "string"}}
+        }},
+        "responses": {
+          "200": {"description": "The diff.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigDiff"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/export": {
+      "get": {
+        "operationId": "exportConfig",
+        "summary": "Export the receivers and routes of the config of the user as Grafana alerting contact points and notification policies. What can not be exported is listed in comments. Secrets are redacted as in getConfig.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "format", "in": "query", "required": true, "schema": {"type": "string", "enum": ["grafana"]}},
+          {"name": "orgId", "in": "query", "schema": {"type": "integer", "default": 1}},
+          {"name": "reveal", "in": "query", "description": "Return the secrets, requires the reveal scope.", "schema": {"type": "boolean"}}
+        ],
+        "responses": {
+          "200": {"description": "The Grafana provisioning file.", "content": {"application/yaml": {"schema": {"type": "string"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/timing": {
+      "patch": {
+        "operationId": "setTiming",
+        "summary": "Override the notification timings of the routes of receivers.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TimingRequest"}}}},
+        "responses": {
+          "204": {"description": "The config was stored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/retention": {
+      "get": {
+        "operationId": "getRetention",
+        "summary": "Get the retention overrides of the user, and the retention applied.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The retention.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RetentionStatus"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "operationId": "setRetention",
+        "summary": "Replace the retention overrides of the user, within the bounds set by the operators. Unset durations default to those of the replicas. The overrides are kept when the config is set.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RetentionOverrides"}}}},
+        "responses": {
+          "204": {"description": "The config was stored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/config/canary": {
+      "get": {
+        "operationId": "getCanary",
+        "summary": "Get the canary config of the user, running or finished.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The canary config.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CanaryConfig"}}}},
+          "404": {"description": "The user has no canary config.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "operationId": "setCanary",
+        "summary": "Run a candidate config in shadow next to the config of the user, replacing the canary config. Its notifications are rendered but not sent, except those of the canary receiver. It is promoted to the config of the user once it ran for the duration, or rolled back once more notifications than maxErrors failed to render. The stats of a running canary are returned with the status of the user.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "duration", "in": "query", "description": "How long the canary runs before it is promoted, 10m by default and at most 24h.", "schema": {"$ref": "#/components/schemas/Duration"}},
+          {"name": "maxErrors", "in": "query", "description": "Notifications which may fail to render without rolling the canary back.", "schema": {"type": "integer", "minimum": 0, "default": 0}},
+          {"name": "receiver", "in": "query", "description": "Receiver of the candidate config whose notifications are sent.", "schema": {"type": "string"}}
+        ],
+        "requestBody": {"required": true, "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/Config"}},
+          "application/yaml": {"schema": {"type": "string"}},
+          "multipart/form-data": {"schema": {"type": "object", "properties": {
+            "config": {"type": "string"}
+          }, "additionalProperties": {"type": "string", "format": "binary"}}}
+        }},
+        "responses": {
+          "202": {"description": "The canary config was stored, it is run once applied."},
+          "404": {"description": "The user has no active config.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "operationId": "deleteCanary",
+        "summary": "Stop the running canary config without promoting it, or remove the outcome of the finished one.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "204": {"description": "The canary config was removed."},
+          "404": {"description": "The user has no canary config.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/maintenance-windows": {
+      "get": {
+        "operationId": "listMaintenanceWindows",
+        "summary": "List the maintenance windows of the user.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The maintenance windows.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/MaintenanceWindow"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "setMaintenanceWindow",
+        "summary": "Add a maintenance window, or replace the window of the same name.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MaintenanceWindow"}}}},
+        "responses": {
+          "204": {"description": "The config was stored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/maintenance-windows/{name}": {
+      "delete": {
+        "operationId": "deleteMaintenanceWindow",
+        "summary": "Remove a maintenance window.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "204": {"description": "The config was stored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/recurring-silences": {
+      "get": {
+        "operationId": "listRecurringSilences",
+        "summary": "List the recurring silences of the user.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The recurring silences.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/RecurringSilence"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "setRecurringSilence",
+        "summary": "Add a recurring silence, or replace the recurring silence of the same name. The occurrences running or starting within the hour are created as silences authored by recurring-silence:<name>.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RecurringSilence"}}}},
+        "responses": {
+          "204": {"description": "The config was stored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/recurring-silences/{name}": {
+      "delete": {
+        "operationId": "deleteRecurringSilence",
+        "summary": "Remove a recurring silence. The silences of its unexpired occurrences are expired.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "204": {"description": "The config was stored."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/receivers/{name}/test": {
+      "post": {
+        "operationId": "testReceiver",
+        "summary": "Send a canned test alert with each integration of the receiver, rendered with the templates of the applied config. The routing tree, silences and notification log are bypassed.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "The outcome of each integration.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReceiverTest"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/status": {
+      "get": {
+        "operationId": "getStatus",
+        "summary": "Get the health of the Alertmanager of the user on the serving replica.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "responses": {
+          "200": {"description": "The Alertmanager is up.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Status"}}}},
+          "503": {"description": "The Alertmanager is down.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Status"}}}}
+        }
+      }
+    },
+    "/api/v1/stream": {
+      "get": {
+        "operationId": "stream",
+        "summary": "Stream the events of the user as server-sent events: alerts starting to fire or resolved, silences created, updated or changing state, and configs applied by the replicas. The stream starts with the firing alerts and the silences.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "types", "in": "query", "description": "Comma separated event types streamed, all by default.", "schema": {"type": "array", "items": {"type": "string", "enum": ["alert", "silence", "config"]}}, "style": "form", "explode": false}
+        ],
+        "responses": {
+          "200": {"description": "Events named alert, silence and config, with data AlertEvent, SilenceEvent and ConfigEvent.", "content": {"text/event-stream": {"schema": {"type": "string"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/alerts/history": {
+      "get": {
+        "operationId": "getAlertHistory",
+        "summary": "List the archived resolved alert groups of the user, the last resolved first. Served if the alert history is enabled.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "since", "in": "query", "description": "Resolution time from which groups are listed, as RFC3339 or as a duration before now like 6h. Defaults to 24h.", "schema": {"type": "string"}},
+          {"name": "until", "in": "query", "description": "Resolution time until which groups are listed, as RFC3339 or as a duration before now. Defaults to now.", "schema": {"type": "string"}},
+          {"name": "matcher", "in": "query", "description": "Matchers the alerts must match, like alertname=\"HighLatency\". The groups without matching alerts are left out.", "schema": {"type": "array", "items": {"type": "string"}}},
+          {"name": "limit", "in": "query", "description": "Maximum number of groups, at most 1000.", "schema": {"type": "integer", "default": 100}}
+        ],
+        "responses": {
+          "200": {"description": "The archived alert groups.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ArchivedGroup"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/alerts/notifications": {
+      "get": {
+        "operationId": "lookupNotifications",
+        "summary": "List the aggregation groups of an alert, with the group keys, the receivers and the last notification of each group by every integration, from the notification log.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "fingerprint", "in": "query", "description": "Fingerprint of the alert, as listed by the alerts API.", "schema": {"type": "string"}},
+          {"name": "label", "in": "query", "description": "Labels of the alert, like alertname=\"HighLatency\", instead of its fingerprint. The alert needs not be firing.", "schema": {"type": "array", "items": {"type": "string"}}}
+        ],
+        "responses": {
+          "200": {"description": "The aggregation groups of the alert.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/NotificationLookup"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/alerts/{fingerprint}/why": {
+      "get": {
+        "operationId": "explainAlert",
+        "summary": "Tell whether the notifications of an alert are suppressed, and by which silences, inhibiting alerts and maintenance windows.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "fingerprint", "in": "path", "required": true, "description": "Fingerprint of the alert, as listed by the alerts API.", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "The explanation.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AlertExplanation"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/reports/summary": {
+      "get": {
+        "operationId": "getReportSummary",
+        "summary": "Summarize the archived resolved alerts of the user over a period, to review noisy alerts. Served if the alert history is enabled.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "since", "in": "query", "description": "Resolution time from which alerts are summarized, as RFC3339 or as a duration before now like 7d. Defaults to 7d.", "schema": {"type": "string"}},
+          {"name": "until", "in": "query", "description": "Resolution time until which alerts are summarized, as RFC3339 or as a duration before now. Defaults to now.", "schema": {"type": "string"}},
+          {"name": "top", "in": "query", "description": "Number of alertnames ranked, at most 100.", "schema": {"type": "integer", "default": 10}}
+        ],
+        "responses": {
+          "200": {"description": "The summary.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReportSummary"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/escalations/ack": {
+      "post": {
+        "operationId": "acknowledgeAlertGroup",
+        "summary": "Acknowledge an alert group of a receiver with escalations, which stops its escalation until it resolves.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AcknowledgeRequest"}}}},
+        "responses": {
+          "204": {"description": "The group is acknowledged."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/silences/export": {
+      "get": {
+        "operationId": "exportSilences",
+        "summary": "Export the active and pending silences of the user, to import them on another cluster.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "expired", "in": "query", "description": "Include the expired silences.", "schema": {"type": "boolean", "default": false}}
+        ],
+        "responses": {
+          "200": {"description": "The silences.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SilenceExport"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/silences/import": {
+      "post": {
+        "operationId": "importSilences",
+        "summary": "Import exported silences with new IDs. Expired silences and silences equal to an unexpired silence are skipped. Nothing is imported if a silence is invalid.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SilenceExport"}}}},
+        "responses": {
+          "200": {"description": "The outcome of the import.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SilenceImportResult"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/slack/interactions/{user}": {
+      "post": {
+        "operationId": "slackInteraction",
+        "summary": "Handle the callbacks of Slack for the silence and ack buttons of Slack messages. The user is named in the path, and the callbacks are verified with the signing secret of the slack_interactions of the config of the user.",
+        "parameters": [
+          {"name": "user", "in": "path", "required": true, "schema": {"type": "string"}},
+          {"name": "X-Slack-Signature", "in": "header", "required": true, "schema": {"type": "string"}},
+          {"name": "X-Slack-Request-Timestamp", "in": "header", "required": true, "schema": {"type": "string"}}
+        ],
+        "requestBody": {"required": true, "content": {"application/x-www-form-urlencoded": {"schema": {"type": "object", "properties": {"payload": {"type": "string", "description": "The JSON interaction payload of Slack."}}}}}},
+        "responses": {
+          "200": {"description": "The actions were handled. Their outcome is posted to the response URL of the interaction."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/integrations/pagerduty/webhook": {
+      "post": {
+        "operationId": "pagerdutyWebhook",
+        "summary": "Handle the v3 webhooks of PagerDuty incidents, verified with the signing secret of the pagerduty_webhook of the config of the user. Acknowledged incidents acknowledge the alert group which triggered them, resolved incidents silence it for the resolve_silence. Other events are ignored.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "X-PagerDuty-Signature", "in": "header", "required": true, "schema": {"type": "string"}}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "description": "The PagerDuty webhook event."}}}},
+        "responses": {
+          "204": {"description": "The event was handled."},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/prom/alertmanager/api/v2/silences": {
+      "get": {
+        "operationId": "listSilences",
+        "summary": "List the silences of the user.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "filter", "in": "query", "description": "Matchers the silences must match, like name=value.", "schema": {"type": "array", "items": {"type": "string"}}}
+        ],
+        "responses": {
+          "200": {"description": "The silences.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Silence"}}}}}
+        }
+      },
+      "post": {
+        "operationId": "createSilence",
+        "summary": "Create a silence, or update the silence with the given id.",
+        "parameters": [{"$ref": "#/components/parameters/UserID"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Silence"}}}},
+        "responses": {
+          "200": {"description": "The id of the silence.", "content": {"application/json": {"schema": {"type": "object", "properties": {"silenceID": {"type": "string"}}}}}}
+        }
+      }
+    },
+    "/api/prom/alertmanager/api/v2/silence/{silenceID}": {
+      "delete": {
+        "operationId": "expireSilence",
+        "summary": "Expire a silence.",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserID"},
+          {"name": "silenceID", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "The silence was expired."}
+        }
+      }
+    },
+    "/api/v1/openapi.json": {
+      "get": {
+        "operationId": "getOpenAPISpec",
+        "summary": "Get this specification.",
+        "responses": {"200": {"description": "The specification.", "content": {"application/json": {}}}}
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "UserID": {"name": "X-AppsCode-UserID", "in": "header", "required": true, "schema": {"type": "string"}},
+      "IfMatch": {"name": "If-Match", "in": "header", "description": "ETags of the stored config the change applies to, or *.", "schema": {"type": "string"}},
+      "IfNoneMatch": {"name": "If-None-Match", "in": "header", "description": "ETags of the stored config, or * for any stored config.", "schema": {"type": "string"}}
+    },
+    "headers": {
+      "ETag": {"description": "Entity tag of the stored config, changing with its content only.", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Error": {"description": "The request failed.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Config": {
+        "type": "object",
+        "properties": {
+          "userID": {"type": "string"},
+          "config": {"type": "string", "description": "The Alertmanager config in YAML."},
+          "templateFiles": {"type": "object", "additionalProperties": {"type": "string"}},
+          "externalURL": {"type": "string"},
+          "updatedAtInUnix": {"type": "integer", "format": "int64"},
+          "deactivatedAtInUnix": {"type": "integer", "format": "int64"},
+          "revision": {"type": "integer", "format": "int64", "description": "Revision of the stored config. Set with a config, it must be the revision of the stored config, the config was changed concurrently otherwise. Not checked if 0, unless revisions are required."},
+          "labels": {"type": "object", "additionalProperties": {"type": "string"}, "readOnly": true, "description": "Labels of the tenant set by operators, like its plan."},
+          "features": {"type": "object", "additionalProperties": {"type": "boolean"}, "readOnly": true, "description": "Feature flags enabled or disabled for the tenant by operators, overriding those enabled by default: slack_block_kit, webhook_signing and escalations."},
+          "retention": {"allOf": [{"$ref": "#/components/schemas/RetentionOverrides"}], "readOnly": true}
+        }
+      },
+      "RetentionOverrides": {
+        "type": "object",
+        "properties": {
+          "silences": {"$ref": "#/components/schemas/Duration"},
+          "notificationLog": {"$ref": "#/components/schemas/Duration"},
+          "alertGCInterval": {"$ref": "#/components/schemas/Duration"}
+        }
+      },
+      "CanaryStats": {
+        "type": "object",
+        "properties": {
+          "rendered": {"type": "integer"},
+          "errors": {"type": "integer"},
+          "lastError": {"type": "string"}
+        }
+      },
+      "CanaryConfig": {
+        "allOf": [
+          {"$ref": "#/components/schemas/CanaryStats"},
+          {"type": "object", "properties": {
+            "config": {"type": "string", "description": "The candidate config, removed once the canary finished."},
+            "templateFiles": {"type": "object", "additionalProperties": {"type": "string"}},
+            "duration": {"$ref": "#/components/schemas/Duration"},
+            "maxErrors": {"type": "integer"},
+            "receiver": {"type": "string"},
+            "status": {"type": "string", "enum": ["running", "promoted", "rolled_back"]},
+            "startedAtInUnix": {"type": "integer", "format": "int64"},
+            "finishedAtInUnix": {"type": "integer", "format": "int64"}
+          }}
+        ]
+      },
+      "RetentionStatus": {
+        "type": "object",
+        "properties": {
+          "overrides": {"$ref": "#/components/schemas/RetentionOverrides"},
+          "effective": {"$ref": "#/components/schemas/RetentionOverrides"}
+        }
+      },
+      "ConfigWithStatus": {
+        "allOf": [
+          {"$ref": "#/components/schemas/Config"},
+          {"type": "object", "properties": {"applyStatus": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/ApplyStatus"}}}}
+        ]
+      },
+      "ApplyStatus": {
+        "type": "object",
+        "properties": {
+          "configUpdatedAtInUnix": {"type": "integer", "format": "int64"},
+          "lastAppliedAt": {"type": "string", "format": "date-time"},
+          "lastError": {"type": "string"},
+          "lastErrorAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ConfigStatus": {
+        "type": "object",
+        "properties": {
+          "updatedAtInUnix": {"type": "integer", "format": "int64"},
+          "applied": {"type": "boolean"},
+          "replicas": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/ApplyStatus"}}
+        }
+      },
+      "LintResult": {
+        "type": "object",
+        "properties": {
+          "warnings": {"type": "array", "items": {"$ref": "#/components/schemas/LintWarning"}}
+        }
+      },
+      "LintWarning": {
+        "type": "object",
+        "required": ["code", "message"],
+        "properties": {
+          "code": {"type": "string", "enum": ["missing_group_by", "low_repeat_interval", "unused_receiver", "missing_catch_all", "receiver_without_integrations"]},
+          "field": {"type": "string"},
+          "message": {"type": "string"}
+        }
+      },
+      "ConfigDiff": {
+        "type": "object",
+        "properties": {
+          "routes": {"type": "array", "items": {"$ref": "#/components/schemas/RouteDiff"}},
+          "receivers": {"type": "array", "items": {"$ref": "#/components/schemas/ReceiverDiff"}},
+          "global": {"type": "array", "items": {"$ref": "#/components/schemas/FieldChange"}},
+          "inhibitRulesChanged": {"type": "boolean"},
+          "templates": {"type": "array", "items": {"$ref": "#/components/schemas/TemplateDiff"}}
+        }
+      },
+      "RouteDiff": {
+        "type": "object",
+        "properties": {
+          "routeKey": {"type": "string"},
+          "receiver": {"type": "string"},
+          "change": {"type": "string", "enum": ["added", "removed", "changed"]},
+          "fields": {"type": "array", "items": {"$ref": "#/components/schemas/FieldChange"}}
+        }
+      },
+      "ReceiverDiff": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "change": {"type": "string", "enum": ["added", "removed", "changed"]},
+          "fields": {"type": "array", "items": {"$ref": "#/components/schemas/FieldChange"}},
+          "secretsChanged": {"type": "boolean"}
+        }
+      },
+      "FieldChange": {
+        "type": "object",
+        "properties": {
+          "field": {"type": "string"},
+          "old": {"type": "string"},
+          "new": {"type": "string"},
+          "secret": {"type": "boolean", "description": "The field is a secret, its values are not returned."}
+        }
+      },
+      "TemplateDiff": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "change": {"type": "string", "enum": ["added", "removed", "changed"]}
+        }
+      },
+      "RouteTestRequest": {
+        "type": "object",
+        "required": ["alerts"],
+        "properties": {
+          "config": {"type": "string", "description": "Config to test instead of the stored config."},
+          "alerts": {"type": "array", "items": {"$ref": "#/components/schemas/LabelSet"}}
+        }
+      },
+      "RouteTestResult": {
+        "type": "object",
+        "properties": {
+          "labels": {"$ref": "#/components/schemas/LabelSet"},
+          "routes": {"type": "array", "items": {"$ref": "#/components/schemas/RouteMatch"}}
+        }
+      },
+      "RouteMatch": {
+        "type": "object",
+        "properties": {
+          "receiver": {"type": "string"},
+          "routeKey": {"type": "string"},
+          "matchers": {"type": "array", "items": {"type": "string"}},
+          "continue": {"type": "boolean"},
+          "groupBy": {"type": "array", "items": {"type": "string"}},
+          "groupByAll": {"type": "boolean"},
+          "groupLabels": {"$ref": "#/components/schemas/LabelSet"},
+          "groupWait": {"$ref": "#/components/schemas/Duration"},
+          "groupInterval": {"$ref": "#/components/schemas/Duration"},
+          "repeatInterval": {"$ref": "#/components/schemas/Duration"}
+        }
+      },
+      "TimingRequest": {
+        "type": "object",
+        "required": ["receivers"],
+        "properties": {
+          "receivers": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/TimingOverride"}}
+        }
+      },
+      "TimingOverride": {
+        "type": "object",
+        "properties": {
+          "group_wait": {"$ref": "#/components/schemas/Duration"},
+          "group_interval": {"$ref": "#/components/schemas/Duration"},
+          "repeat_interval": {"$ref": "#/components/schemas/Duration"}
+        }
+      },
+      "MaintenanceWindow": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string"},
+          "schedule": {"type": "string", "description": "Cron expression of the start of the window."},
+          "rrule": {"type": "string", "description": "RFC 5545 recurrence rule of the start of the window."},
+          "duration": {"$ref": "#/components/schemas/Duration"},
+          "time_zone": {"type": "string"},
+          "start": {"type": "string", "format": "date-time"},
+          "end": {"type": "string", "format": "date-time"},
+          "matchers": {"$ref": "#/components/schemas/LabelSet"},
+          "receivers": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "RecurringSilence": {
+        "type": "object",
+        "required": ["name", "duration"],
+        "properties": {
+          "name": {"type": "string"},
+          "schedule": {"type": "string", "description": "Cron expression of the start of the occurrences.", "example": "0 2 * * sun"},
+          "rrule": {"type": "string", "description": "RFC 5545 recurrence rule of the start of the occurrences."},
+          "duration": {"$ref": "#/components/schemas/Duration"},
+          "time_zone": {"type": "string"},
+          "match": {"$ref": "#/components/schemas/LabelSet"},
+          "match_re": {"type": "object", "description": "Regular expressions the label values must match.", "additionalProperties": {"type": "string"}},
+          "comment": {"type": "string"}
+        }
+      },
+      "ArchivedGroup": {
+        "type": "object",
+        "properties": {
+          "groupKey": {"type": "string"},
+          "receiver": {"type": "string"},
+          "groupLabels": {"$ref": "#/components/schemas/LabelSet"},
+          "alerts": {"type": "array", "items": {"$ref": "#/components/schemas/ArchivedAlert"}},
+          "firingAt": {"type": "string", "format": "date-time"},
+          "resolvedAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ArchivedAlert": {
+        "type": "object",
+        "properties": {
+          "fingerprint": {"type": "string"},
+          "labels": {"$ref": "#/components/schemas/LabelSet"},
+          "annotations": {"$ref": "#/components/schemas/LabelSet"},
+          "startsAt": {"type": "string", "format": "date-time"},
+          "endsAt": {"type": "string", "format": "date-time"},
+          "generatorURL": {"type": "string"}
+        }
+      },
+      "ReportSummary": {
+        "type": "object",
+        "properties": {
+          "since": {"type": "string", "format": "date-time"},
+          "until": {"type": "string", "format": "date-time"},
+          "truncated": {"type": "boolean", "description": "The period had more archived alert groups than were summarized."},
+          "groups": {"type": "integer"},
+          "alerts": {"type": "integer"},
+          "meanTimeFiringSeconds": {"type": "number", "description": "Mean time the alerts fired before they resolved."},
+          "alertsPerDay": {"type": "array", "items": {"type": "object", "properties": {"date": {"type": "string", "format": "date"}, "alerts": {"type": "integer"}}}},
+          "topAlertnames": {"type": "array", "items": {"type": "object", "properties": {"alertname": {"type": "string"}, "alerts": {"type": "integer"}, "meanTimeFiringSeconds": {"type": "number"}}}},
+          "notifications": {"$ref": "#/components/schemas/NotificationStats"}
+        }
+      },
+      "Status": {
+        "type": "object",
+        "properties": {
+          "userID": {"type": "string"},
+          "health": {"type": "string", "enum": ["healthy", "degraded", "down"]},
+          "running": {"type": "boolean"},
+          "parked": {"type": "boolean"},
+          "configUpdatedAt": {"type": "string", "format": "date-time"},
+          "configUpdatedAtInUnix": {"type": "integer", "format": "int64"},
+          "lastAppliedAt": {"type": "string", "format": "date-time"},
+          "lastError": {"type": "string"},
+          "lastErrorAt": {"type": "string", "format": "date-time"},
+          "notifications": {"$ref": "#/components/schemas/NotificationStats"},
+          "canary": {"$ref": "#/components/schemas/CanaryStats"}
+        }
+      },
+      "NotificationStats": {
+        "type": "object",
+        "properties": {
+          "window": {"$ref": "#/components/schemas/Duration"},
+          "delivered": {"type": "integer"},
+          "failed": {"type": "integer"},
+          "suppressed": {"type": "integer"},
+          "errorRate": {"type": "number"}
+        }
+      },
+      "AlertExplanation": {
+        "type": "object",
+        "properties": {
+          "fingerprint": {"type": "string"},
+          "labels": {"$ref": "#/components/schemas/LabelSet"},
+          "resolved": {"type": "boolean"},
+          "state": {"type": "string", "enum": ["active", "suppressed", "unprocessed"]},
+          "suppressed": {"type": "boolean", "description": "The alert is silenced or inhibited, or a maintenance window suppresses its notifications to every receiver."},
+          "silences": {"type": "array", "items": {"type": "object", "properties": {
+            "id": {"type": "string"},
+            "createdBy": {"type": "string"},
+            "comment": {"type": "string"},
+            "endsAt": {"type": "string", "format": "date-time"}
+          }}},
+          "inhibitions": {"type": "array", "items": {"type": "object", "properties": {
+            "fingerprint": {"type": "string", "description": "Fingerprint of the inhibiting alert."},
+            "labels": {"$ref": "#/components/schemas/LabelSet"},
+            "rules": {"type": "array", "description": "The inhibition rules matching the alerts. Global rules apply to all users.", "items": {"type": "object", "additionalProperties": true, "properties": {"global": {"type": "boolean"}}}}
+          }}},
+          "receivers": {"type": "array", "items": {"type": "object", "properties": {
+            "receiver": {"type": "string"},
+            "groupKey": {"type": "string"},
+            "maintenanceWindow": {"type": "string", "description": "The active maintenance window suppressing the notifications to the receiver."}
+          }}}
+        }
+      },
+      "NotificationLookup": {
+        "type": "object",
+        "properties": {
+          "fingerprint": {"type": "string"},
+          "labels": {"$ref": "#/components/schemas/LabelSet"},
+          "groups": {"type": "array", "items": {"type": "object", "properties": {
+            "receiver": {"type": "string"},
+            "routeKey": {"type": "string"},
+            "groupKey": {"type": "string"},
+            "groupLabels": {"$ref": "#/components/schemas/LabelSet"},
+            "integrations": {"type": "array", "items": {"type": "object", "properties": {
+              "name": {"type": "string"},
+              "lastNotifiedAt": {"type": "string", "format": "date-time", "description": "Time of the last notification of the group, unset if there is none in the notification log."},
+              "firingAlerts": {"type": "integer"},
+              "resolvedAlerts": {"type": "integer"},
+              "alertFiring": {"type": "boolean", "description": "The alert was among the firing alerts of the last notification."},
+              "alertResolved": {"type": "boolean", "description": "The alert was among the resolved alerts of the last notification."}
+            }}}
+          }}}
+        }
+      },
+      "AcknowledgeRequest": {
+        "type": "object",
+        "required": ["receiver", "groupKey"],
+        "properties": {
+          "receiver": {"type": "string", "description": "Receiver of the route of the group, which has escalations."},
+          "groupKey": {"type": "string", "description": "Key of the group, as sent in the notifications."}
+        }
+      },
+      "SilenceExport": {
+        "type": "object",
+        "required": ["silences"],
+        "properties": {
+          "userID": {"type": "string"},
+          "exportedAt": {"type": "string", "format": "date-time"},
+          "silences": {"type": "array", "maxItems": 10000, "items": {"$ref": "#/components/schemas/Silence"}, "description": "The silences with their IDs in the exporting Alertmanager. The status is ignored on import."}
+        }
+      },
+      "SilenceImportResult": {
+        "type": "object",
+        "properties": {
+          "imported": {"type": "object", "description": "New IDs of the imported silences by their exported IDs.", "additionalProperties": {"type": "string"}},
+          "skipped": {"type": "array", "items": {"type": "object", "properties": {"id": {"type": "string"}, "reason": {"type": "string", "enum": ["expired", "duplicate"]}}}}
+        }
+      },
+      "ReceiverTest": {
+        "type": "object",
+        "properties": {
+          "receiver": {"type": "string"},
+          "integrations": {"type": "array", "items": {"$ref": "#/components/schemas/IntegrationTestResult"}}
+        }
+      },
+      "IntegrationTestResult": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string", "example": "slack[0]"},
+          "delivered": {"type": "boolean"},
+          "retryable": {"type": "boolean"},
+          "error": {"type": "string"},
+          "responses": {"type": "array", "description": "The responses of the downstream service, if known.", "items": {"type": "object", "properties": {
+            "url": {"type": "string"},
+            "statusCode": {"type": "integer"},
+            "body": {"type": "string", "description": "The beginning of the response body."}
+          }}}
+        }
+      },
+      "Silence": {
+        "type": "object",
+        "required": ["matchers", "startsAt", "endsAt", "createdBy", "comment"],
+        "properties": {
+          "id": {"type": "string"},
+          "matchers": {"type": "array", "items": {"$ref": "#/components/schemas/Matcher"}},
+          "startsAt": {"type": "string", "format": "date-time"},
+          "endsAt": {"type": "string", "format": "date-time"},
+          "createdBy": {"type": "string"},
+          "comment": {"type": "string"},
+          "status": {"type": "object", "readOnly": true, "properties": {"state": {"type": "string", "enum": ["active", "pending", "expired"]}}}
+        }
+      },
+      "AlertEvent": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time"},
+          "fingerprint": {"type": "string"},
+          "status": {"type": "string", "enum": ["firing", "resolved"]},
+          "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+          "annotations": {"type": "object", "additionalProperties": {"type": "string"}},
+          "startsAt": {"type": "string", "format": "date-time"},
+          "endsAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "SilenceEvent": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time"},
+          "id": {"type": "string"},
+          "matchers": {"type": "array", "items": {"$ref": "#/components/schemas/Matcher"}},
+          "startsAt": {"type": "string", "format": "date-time"},
+          "endsAt": {"type": "string", "format": "date-time"},
+          "createdBy": {"type": "string"},
+          "comment": {"type": "string"},
+          "state": {"type": "string", "enum": ["active", "pending", "expired"]}
+        }
+      },
+      "ConfigEvent": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time"},
+          "status": {"type": "string", "enum": ["applied", "failed"]},
+          "updatedAtInUnix": {"type": "integer", "format": "int64"},
+          "error": {"type": "string"}
+        }
+      },
+      "Matcher": {
+        "type": "object",
+        "required": ["name", "value", "isRegex"],
+        "properties": {
+          "name": {"type": "string"},
+          "value": {"type": "string"},
+          "isRegex": {"type": "boolean"}
+        }
+      },
+      "LabelSet": {"type": "object", "additionalProperties": {"type": "string"}},
+      "Duration": {"type": "string", "description": "Duration like 30s, 5m or 1h.", "example": "5m"},
+      "Error": {
+        "type": "object",
+        "properties": {
+          "code": {"type": "string", "enum": ["bad_request", "unauthorized", "forbidden", "not_found", "not_acceptable", "invalid_config", "invalid_template", "routing_policy_violation", "conflict", "precondition_failed", "quota_exceeded", "limit_exceeded", "storage_unavailable", "internal"]},
+          "message": {"type": "string"},
+          "details": {"type": "array", "items": {"$ref": "#/components/schemas/ErrorDetail"}}
+        }
+      },
+      "ErrorDetail": {
+        "type": "object",
+        "properties": {
+          "file": {"type": "string"},
+          "line": {"type": "integer"},
+          "field": {"type": "string"},
+          "message": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,96 @@
+package alertmanager
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+// maxPagerdutyWebhookSize is the size of the webhooks of PagerDuty which is
+// read.
+const maxPagerdutyWebhookSize = 1 << 20
+
+// PagerdutyWebhook handles the webhooks of PagerDuty incidents, reflecting
+// the acknowledgement and resolution of the incidents triggered by the user
+// on their alert groups. The webhooks are verified with the signing secret
+// of the pagerduty_webhook of the config of the user. Events which can not
+// be reflected, like those of incidents not triggered by the replicas, are
+// ignored without error, as PagerDuty disables failing webhooks.
+func (am *MultitenantAlertmanager) PagerdutyWebhook(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxPagerdutyWebhookSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	p := userAM.getPipeline()
+	if p == nil || p.conf.PagerdutyWebhook == nil {
+		writeError(w, http.StatusNotFound, "pagerduty webhook is not configured")
+		return
+	}
+	conf := p.conf.PagerdutyWebhook
+	if err := notify.VerifyPagerdutyWebhook(string(conf.SigningSecret), req.Header, body); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	e, err := notify.ParsePagerdutyWebhook(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := am.reflectPagerdutyEvent(userID, userAM, conf, e); err != nil {
+		Must(level.Warn(userAM.logger).Log("msg", "Failed to reflect pagerduty event", "event", e.Type, "incident", e.IncidentKey, "err", err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reflectPagerdutyEvent acknowledges the alert group of an acknowledged
+// incident, and silences the alert group of a resolved one.
+func (am *MultitenantAlertmanager) reflectPagerdutyEvent(userID string, userAM *Alertmanager, conf *notify.PagerdutyWebhook, e *notify.PagerdutyWebhookEvent) error {
+	if e.Type != notify.PagerdutyIncidentAcknowledged && e.Type != notify.PagerdutyIncidentResolved {
+		return nil
+	}
+	inc, ok := notify.LookupPagerdutyIncident(userID, e.IncidentKey)
+	if !ok {
+		Must(level.Debug(userAM.logger).Log("msg", "Ignoring pagerduty event of unknown incident", "event", e.Type, "incident", e.IncidentKey))
+		return nil
+	}
+
+	switch e.Type {
+	case notify.PagerdutyIncidentAcknowledged:
+		err := userAM.Acknowledge(inc.Receiver, inc.GroupKey)
+		if err == errNotEscalated {
+			return nil
+		}
+		return err
+	case notify.PagerdutyIncidentResolved:
+		sil, err := groupSilence(inc.GroupLabels, time.Duration(conf.ResolveSilence), "pagerduty:"+e.Agent, "Incident resolved in PagerDuty")
+		if err != nil {
+			return err
+		}
+		_, err = am.CreateSilence(userID, sil)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/inhibit"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/provider"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A pipeline processes the alerts of a user with one applied config: it
+// inhibits, silences, routes and notifies them. A pipeline is built, started
+// and stopped once; applying a new config replaces it.
+type pipeline struct {
+	conf        *notify.Config
+	externalURL *url.URL
+	tmpl        *template.Template
+	inhibitor   *inhibit.Inhibitor
+	// inhibitRules are the inhibition rules of conf followed by the global
+	// ones.
+	inhibitRules []*config.InhibitRule
+	silencer     *silence.Silencer
+	dispatcher   *dispatch.Dispatcher
+	route        *dispatch.Route
+	stage        amnotify.RoutingStage
+	storm        *notify.StormStage
+
+	// dispatcherAlerts and inhibitorAlerts signal once the Run of the
+	// dispatcher and of the inhibitor set up their state, see startedAlerts.
+	dispatcherAlerts *startedAlerts
+	inhibitorAlerts  *startedAlerts
+	started          bool
+	wg               sync.WaitGroup
+}
+
+// startedAlerts are the alerts of the dispatcher or the inhibitor of a
+// pipeline. Both subscribe to their alerts once their Run set up the state
+// their Stop cancels, so that started is closed once they can be stopped.
+type startedAlerts struct {
+	provider.Alerts
+	started chan struct{}
+}
+
+func newStartedAlerts(alerts provider.Alerts) *startedAlerts {
+	return &startedAlerts{Alerts: alerts, started: make(chan struct{})}
+}
+
+// Subscribe implements provider.Alerts. It is called once by each Run.
+func (a *startedAlerts) Subscribe() provider.AlertIterator {
+	defer close(a.started)
+	return a.Alerts.Subscribe()
+}
+
+// newPipeline builds the pipeline of conf. It does not start processing
+// alerts, and only fails if the templates of conf can not be loaded. The
+// pipeline of a canary runs conf in shadow, with its own templates and
+// alert markers, see canary.
+func newPipeline(am *Alertmanager, userID string, conf *notify.Config, externalURL *url.URL, shadow *canary) (*pipeline, error) {
+	userTemplatesDir := templatesDir(am.cfg.DataDir, userID)
+	marker := am.marker
+	if shadow != nil {
+		userTemplatesDir = shadow.templatesDir
+		// The inhibitions and silences of the canary are not those of the
+		// alerts.
+		marker = types.NewMarker(prometheus.NewRegistry())
+	}
+	templateFiles := []string{defaultTemplatesFile(am.cfg.DataDir)}
+	if am.cfg.LibraryDir != nil {
+		if dir := am.cfg.LibraryDir(); dir != "" {
+			templateFiles = append(templateFiles, filepath.Join(dir, "*"))
+		}
+	}
+	for _, t := range conf.Templates {
+		templateFiles = append(templateFiles, filepath.Join(userTemplatesDir, t))
+	}
+	tmpl, err := template.FromGlobs(templateFiles...)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.ExternalURL = am.cfg.ExternalURL
+	if externalURL != nil {
+		tmpl.ExternalURL = externalURL
+	}
+
+	inhibitRules := conf.InhibitRules
+	if am.cfg.GlobalInhibitRules != nil {
+		global := am.cfg.GlobalInhibitRules()
+		inhibitRules = make([]*config.InhibitRule, 0, len(conf.InhibitRules)+len(global))
+		inhibitRules = append(inhibitRules, conf.InhibitRules...)
+		inhibitRules = append(inhibitRules, global...)
+	}
+
+	inhibitorAlerts := newStartedAlerts(am.alerts)
+	p := &pipeline{
+		conf:         conf,
+		externalURL:  externalURL,
+		tmpl:         tmpl,
+		inhibitor:    inhibit.NewInhibitor(inhibitorAlerts, inhibitRules, marker, log.With(am.logger, "component", "inhibitor")),
+		inhibitRules: inhibitRules,
+		silencer:     silence.NewSilencer(am.silences, marker, log.With(am.logger, "component", "silencer")),
+		storm:        notify.NewStormStage(conf.FloodProtection),
+
+		dispatcherAlerts: newStartedAlerts(am.alerts),
+		inhibitorAlerts:  inhibitorAlerts,
+	}
+
+	waitFunc := func() time.Duration { return 0 }
+	if am.cfg.PeerWait != nil {
+		waitFunc = am.cfg.PeerWait
+	} else if am.cfg.Peer != nil {
+		waitFunc = clusterWait(am.cfg.Peer, am.cfg.PeerTimeout)
+	}
+	timeoutFunc := func(d time.Duration) time.Duration {
+		if d < amnotify.MinTimeout {
+			d = amnotify.MinTimeout
+		}
+		return d + waitFunc()
+	}
+
+	var rs amnotify.RoutingStage
+	if shadow != nil {
+		rs = notify.BuildShadowPipeline(
+			userID,
+			am.cfg.Features,
+			conf.Receivers,
+			conf.MaintenanceWindows,
+			shadow.receiver,
+			tmpl,
+			waitFunc,
+			p.inhibitor,
+			p.silencer,
+			shadow.nflog,
+			shadow.report,
+			log.With(am.logger, "component", "canary"),
+		)
+	} else {
+		rs = notify.BuildPipeline(
+			userID,
+			am.cfg.Features,
+			conf.Receivers,
+			conf.MaintenanceWindows,
+			p.storm,
+			conf.EnrichmentWebhook,
+			tmpl,
+			waitFunc,
+			p.inhibitor,
+			p.silencer,
+			am.nflog,
+			am.cfg.Peer,
+			log.With(am.logger, "component", "pipeline"),
+		)
+		observeNotifications(rs, am.events)
+		countInflight(rs, &am.inflight)
+		traceStages(rs, userID)
+		if am.cfg.Archive != nil {
+			archiveResolved(rs, am.cfg.Archive)
+		}
+	}
+	if am.cfg.IsLeader != nil {
+		notifyIfLeader(rs, am.cfg.IsLeader)
+	}
+
+	route := conf.Route
+	if am.cfg.SyntheticProbes && shadow == nil {
+		route = probeRoute(conf.Route)
+		rs[probeReceiver] = am.probes
+	}
+
+	p.stage = rs
+	p.route = dispatch.NewRoute(route, nil)
+	p.dispatcher = dispatch.NewDispatcher(
+		p.dispatcherAlerts,
+		p.route,
+		rs,
+		marker,
+		timeoutFunc,
+		log.With(am.logger, "component", "dispatcher"),
+	)
+	return p, nil
+}
+
+// start starts processing alerts.
+func (p *pipeline) start() {
+	p.started = true
+	p.wg.Add(2)
+	go func() {
+		p.dispatcher.Run()
+		p.wg.Done()
+	}()
+	go func() {
+		p.inhibitor.Run()
+		p.wg.Done()
+	}()
+}
+
+// stop stops processing alerts and waits until the pipeline is stopped. The
+// dispatcher and the inhibitor are stopped once their Run set up their
+// state, as their Stop does nothing before.
+func (p *pipeline) stop() {
+	if p == nil || !p.started {
+		return
+	}
+	<-p.dispatcherAlerts.started
+	<-p.inhibitorAlerts.started
+	p.dispatcher.Stop()
+	p.inhibitor.Stop()
+	p.wg.Wait()
+}
+
+// flush notifies the alerts of all aggregation groups now, like their
+// groups would once their group_wait or group_interval elapsed. The groups
+// without new or resolved alerts are deduplicated by the notification log.
+// It returns once the notifications were sent or ctx is done.
+func (p *pipeline) flush(ctx context.Context, l log.Logger) {
+	if p == nil {
+		return
+	}
+	all := func(*types.Alert, time.Time) bool { return true }
+	var routes []*dispatch.Route
+	p.dispatcher.Groups(func(r *dispatch.Route) bool {
+		routes = append(routes, r)
+		return false
+	}, all)
+
+	for _, r := range routes {
+		groups, _ := p.dispatcher.Groups(func(route *dispatch.Route) bool { return route == r }, all)
+		for _, g := range groups {
+			now := time.Now()
+			alerts := make(types.AlertSlice, 0, len(g.Alerts))
+			for _, alert := range g.Alerts {
+				a := *alert
+				// Alerts do not resolve as time moves forward.
+				if !a.ResolvedAt(now) {
+					a.EndsAt = time.Time{}
+				}
+				alerts = append(alerts, &a)
+			}
+			sort.Stable(alerts)
+
+			gctx := amnotify.WithNow(ctx, now)
+			gctx = amnotify.WithGroupKey(gctx, fmt.Sprintf("%s:%s", r.Key(), g.Labels))
+			gctx = amnotify.WithGroupLabels(gctx, g.Labels)
+			gctx = amnotify.WithReceiverName(gctx, r.RouteOpts.Receiver)
+			gctx = amnotify.WithRepeatInterval(gctx, r.RouteOpts.RepeatInterval)
+			if _, _, err := p.stage.Exec(gctx, l, alerts...); err != nil {
+				Must(level.Warn(l).Log("msg", "failed to flush alert group", "receiver", r.RouteOpts.Receiver, "group", g.Labels, "err", err))
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
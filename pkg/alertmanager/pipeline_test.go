@@ -0,0 +1,436 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const testUserID = "user"
+
+func newTestAlertmanager(t *testing.T) *Alertmanager {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "alertmanager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	if err := os.MkdirAll(filepath.Join(dir, "templates", testUserID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	externalURL, err := url.Parse("http://localhost/api/prom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, err := NewAlertmanager(&Config{
+		UserID:      testUserID,
+		DataDir:     dir,
+		Logger:      log.NewNopLogger(),
+		Retention:   time.Hour,
+		ExternalURL: externalURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(am.Stop)
+	return am
+}
+
+// testConfig is a config routing to receiver, using the template file
+// holding tmpl if it is not empty.
+func testConfig(t *testing.T, am *Alertmanager, receiver, tmpl string) *notify.Config {
+	t.Helper()
+	s := `
+route:
+  receiver: ` + receiver + `
+receivers:
+- name: ` + receiver + `
+`
+	if tmpl != "" {
+		fn := receiver + ".tmpl"
+		if err := ioutil.WriteFile(filepath.Join(am.cfg.DataDir, "templates", testUserID, fn), []byte(tmpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s += "templates:\n- " + fn + "\n"
+	}
+	conf, err := notify.LoadConfig(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+// running returns true if the goroutines of the pipeline did not exit.
+func running(p *pipeline) bool {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return false
+	case <-time.After(50 * time.Millisecond):
+		return true
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	const (
+		validTemplate   = `{{ define "valid" }}valid{{ end }}`
+		invalidTemplate = `{{ define "invalid" }}`
+	)
+	type apply struct {
+		receiver string
+		tmpl     string
+		// cancelled applies with a done context.
+		cancelled bool
+		wantErr   bool
+	}
+
+	for _, tc := range []struct {
+		name    string
+		applies []apply
+		// wantReceiver is the receiver of the running pipeline, none if
+		// empty.
+		wantReceiver string
+	}{
+		{
+			name:         "initial apply",
+			applies:      []apply{{receiver: "first"}},
+			wantReceiver: "first",
+		},
+		{
+			name:         "initial apply with templates",
+			applies:      []apply{{receiver: "first", tmpl: validTemplate}},
+			wantReceiver: "first",
+		},
+		{
+			name:    "failed initial apply",
+			applies: []apply{{receiver: "first", tmpl: invalidTemplate, wantErr: true}},
+		},
+		{
+			name: "apply after failed initial apply",
+			applies: []apply{
+				{receiver: "first", tmpl: invalidTemplate, wantErr: true},
+				{receiver: "second"},
+			},
+			wantReceiver: "second",
+		},
+		{
+			name: "re-apply",
+			applies: []apply{
+				{receiver: "first"},
+				{receiver: "second"},
+			},
+			wantReceiver: "second",
+		},
+		{
+			name: "re-apply same config",
+			applies: []apply{
+				{receiver: "first"},
+				{receiver: "first"},
+			},
+			wantReceiver: "first",
+		},
+		{
+			name: "apply after failure keeps running pipeline",
+			applies: []apply{
+				{receiver: "first"},
+				{receiver: "second", tmpl: invalidTemplate, wantErr: true},
+			},
+			wantReceiver: "first",
+		},
+		{
+			name: "apply after failure",
+			applies: []apply{
+				{receiver: "first"},
+				{receiver: "second", tmpl: invalidTemplate, wantErr: true},
+				{receiver: "third"},
+			},
+			wantReceiver: "third",
+		},
+		{
+			name: "cancelled apply keeps running pipeline",
+			applies: []apply{
+				{receiver: "first"},
+				{receiver: "second", cancelled: true, wantErr: true},
+			},
+			wantReceiver: "first",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			am := newTestAlertmanager(t)
+
+			var stopped []*pipeline
+			for i, a := range tc.applies {
+				ctx, cancel := context.WithCancel(context.Background())
+				if a.cancelled {
+					cancel()
+				}
+				prev := am.getPipeline()
+				err := am.ApplyConfig(ctx, testUserID, testConfig(t, am, a.receiver, a.tmpl), nil)
+				cancel()
+				if (err != nil) != a.wantErr {
+					t.Fatalf("apply %d: got error %v, want error %v", i, err, a.wantErr)
+				}
+				if p := am.getPipeline(); p != prev && prev != nil {
+					stopped = append(stopped, prev)
+				}
+			}
+
+			p := am.getPipeline()
+			if tc.wantReceiver == "" {
+				if p != nil {
+					t.Fatalf("got pipeline of receiver %s, want none", p.conf.Route.Receiver)
+				}
+				return
+			}
+			if p == nil {
+				t.Fatalf("got no pipeline, want pipeline of receiver %s", tc.wantReceiver)
+			}
+			if got := p.conf.Route.Receiver; got != tc.wantReceiver {
+				t.Fatalf("got pipeline of receiver %s, want %s", got, tc.wantReceiver)
+			}
+			if !running(p) {
+				t.Fatal("applied pipeline is not running")
+			}
+			for _, p := range stopped {
+				if running(p) {
+					t.Fatalf("replaced pipeline of receiver %s is still running", p.conf.Route.Receiver)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineFlush(t *testing.T) {
+	received := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer srv.Close()
+
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: webhook
+  group_wait: 1h
+receivers:
+- name: webhook
+  webhook_configs:
+  - url: ` + srv.URL + `
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	err = am.alerts.Put(&types.Alert{Alert: model.Alert{
+		Labels:   model.LabelSet{"alertname": "test"},
+		StartsAt: now,
+		EndsAt:   now.Add(time.Hour),
+	}, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The alert is in an aggregation group waiting for group_wait.
+	p := am.getPipeline()
+	all := func(*dispatch.Route) bool { return true }
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		groups, _ := p.dispatcher.Groups(all, func(*types.Alert, time.Time) bool { return true })
+		if len(groups) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("alert was not dispatched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p.flush(ctx, log.NewNopLogger())
+	select {
+	case <-received:
+	default:
+		t.Fatal("the waiting alert group was not notified")
+	}
+
+	// The unchanged group is deduplicated by the notification log.
+	p.flush(ctx, log.NewNopLogger())
+	select {
+	case <-received:
+		t.Fatal("the unchanged alert group was notified again")
+	default:
+	}
+}
+
+func TestTestReceiver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("accepted"))
+	}))
+	defer srv.Close()
+
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: webhook
+receivers:
+- name: webhook
+  webhook_configs:
+  - url: ` + srv.URL + `
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := am.TestReceiver(context.Background(), "unknown"); err != errReceiverNotFound {
+		t.Fatalf("got error %v for an unknown receiver, want %v", err, errReceiverNotFound)
+	}
+	rt, err := am.TestReceiver(context.Background(), "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Integrations) != 1 {
+		t.Fatalf("got %d integrations, want 1", len(rt.Integrations))
+	}
+	it := rt.Integrations[0]
+	if !it.Delivered || len(it.Responses) != 1 {
+		t.Fatalf("got result %+v, want a delivery with its response", it)
+	}
+	if r := it.Responses[0]; r.StatusCode != http.StatusAccepted || r.Body != "accepted" {
+		t.Fatalf("got response %+v, want 202 accepted", r)
+	}
+}
+
+func TestLibraryTemplates(t *testing.T) {
+	am := newTestAlertmanager(t)
+	dir := filepath.Join(am.cfg.DataDir, "library", "test")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for fn, content := range map[string]string{
+		"layout":    `{{ define "layout" }}library{{ end }}`,
+		"overrides": `{{ define "overridden" }}library{{ end }}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	am.cfg.LibraryDir = func() string { return dir }
+
+	// The templates of the user come after the library templates, and
+	// override them.
+	conf := testConfig(t, am, "first", `{{ define "overridden" }}user{{ end }}`)
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := am.getPipeline().tmpl
+	for name, want := range map[string]string{"layout": "library", "overridden": "user"} {
+		got, err := tmpl.ExecuteTextString(`{{ template "`+name+`" . }}`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("template %s got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNotificationEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: webhook
+  group_wait: 1h
+receivers:
+- name: webhook
+  webhook_configs:
+  - url: ` + srv.URL + `
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+	ch := am.events.subscribe()
+	defer am.events.unsubscribe(ch)
+
+	now := time.Now()
+	err = am.alerts.Put(&types.Alert{Alert: model.Alert{
+		Labels:   model.LabelSet{"alertname": "test"},
+		StartsAt: now,
+		EndsAt:   now.Add(time.Hour),
+	}, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := am.getPipeline()
+	all := func(*dispatch.Route) bool { return true }
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		groups, _ := p.dispatcher.Groups(all, func(*types.Alert, time.Time) bool { return true })
+		if len(groups) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("alert was not dispatched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p.flush(ctx, log.NewNopLogger())
+
+	var ev NotificationEvent
+	select {
+	case ev = <-ch:
+	default:
+		t.Fatal("no notification event was published")
+	}
+	if ev.Status != NotificationDelivered || ev.Receiver != "webhook" || ev.Integration != "webhook[0]" || ev.Attempts != 1 || len(ev.Alerts) != 1 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	b, err := json.Marshal(ev.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Receiver string `json:"receiver"`
+		GroupKey string `json:"groupKey"`
+	}
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Receiver != "webhook" || payload.GroupKey != ev.GroupKey {
+		t.Fatalf("got payload %s, want the rendered webhook message", b)
+	}
+}
@@ -0,0 +1,190 @@
+package alertmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// RoutingPolicy constrains the receivers the alerts with the labels of
+// Match are routed to, in the configs of all users. The alerts are routed
+// like the route test API does, with exactly the labels of Match.
+type RoutingPolicy struct {
+	Name  string         `yaml:"name" json:"name"`
+	Match model.LabelSet `yaml:"match" json:"match"`
+	// RequireIntegrations requires one of the receivers of the alerts to
+	// have one of these integrations, e.g. a paging service.
+	RequireIntegrations []string `yaml:"require_integrations,omitempty" json:"requireIntegrations,omitempty"`
+	// AllowedIntegrations restricts the receivers of the alerts to these
+	// integrations, e.g. chat services.
+	AllowedIntegrations []string `yaml:"allowed_integrations,omitempty" json:"allowedIntegrations,omitempty"`
+}
+
+// routingPoliciesDocument is the format of the routing policies file.
+type routingPoliciesDocument struct {
+	RoutingPolicies []*RoutingPolicy `yaml:"routing_policies"`
+}
+
+// loadRoutingPolicies parses and validates routing policies.
+func loadRoutingPolicies(s string) ([]*RoutingPolicy, error) {
+	var doc routingPoliciesDocument
+	if err := yaml.UnmarshalStrict([]byte(s), &doc); err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, name := range notify.IntegrationTypeNames() {
+		known[name] = true
+	}
+	names := map[string]bool{}
+	for _, p := range doc.RoutingPolicies {
+		if p.Name == "" {
+			return nil, errors.New("routing policy without name")
+		}
+		if names[p.Name] {
+			return nil, errors.Errorf("routing policy %q is not unique", p.Name)
+		}
+		names[p.Name] = true
+		if len(p.Match) == 0 {
+			return nil, errors.Errorf("routing policy %q: match must not be empty", p.Name)
+		}
+		if err := p.Match.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "routing policy %q", p.Name)
+		}
+		if len(p.RequireIntegrations) == 0 && len(p.AllowedIntegrations) == 0 {
+			return nil, errors.Errorf("routing policy %q: require_integrations or allowed_integrations must be set", p.Name)
+		}
+		for _, i := range append(append([]string{}, p.RequireIntegrations...), p.AllowedIntegrations...) {
+			if !known[i] {
+				return nil, errors.Errorf("routing policy %q: unknown integration %q", p.Name, i)
+			}
+		}
+	}
+	return doc.RoutingPolicies, nil
+}
+
+// RoutingPolicyViolation is a routing policy a config does not comply with.
+type RoutingPolicyViolation struct {
+	Policy  string `json:"policy"`
+	Message string `json:"message"`
+}
+
+// RoutingPolicyError lists the violations of the routing policies by a
+// config.
+type RoutingPolicyError struct {
+	Violations []RoutingPolicyViolation
+}
+
+func (e *RoutingPolicyError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("routing policy %q: %s", v.Policy, v.Message))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// checkRoutingPolicies returns a *RoutingPolicyError if conf does not
+// comply with the policies.
+func checkRoutingPolicies(policies []*RoutingPolicy, conf *notify.Config) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	receivers := map[string][]string{}
+	for _, rc := range conf.Receivers {
+		receivers[rc.Name] = notify.IntegrationNames(rc)
+	}
+	root := dispatch.NewRoute(conf.Route, nil)
+
+	var violations []RoutingPolicyViolation
+	for _, p := range policies {
+		var routed []string
+		seen := map[string]bool{}
+		for _, r := range root.Match(p.Match) {
+			if !seen[r.RouteOpts.Receiver] {
+				seen[r.RouteOpts.Receiver] = true
+				routed = append(routed, r.RouteOpts.Receiver)
+			}
+		}
+
+		if len(p.RequireIntegrations) > 0 && !anyReceiverHas(routed, receivers, p.RequireIntegrations) {
+			violations = append(violations, RoutingPolicyViolation{
+				Policy:  p.Name,
+				Message: fmt.Sprintf("alerts with %s are routed to %s, one of them must have a %s integration", p.Match, quoteList(routed), strings.Join(p.RequireIntegrations, " or ")),
+			})
+		}
+		if len(p.AllowedIntegrations) > 0 {
+			allowed := map[string]bool{}
+			for _, i := range p.AllowedIntegrations {
+				allowed[i] = true
+			}
+			for _, name := range routed {
+				var denied []string
+				for _, i := range receivers[name] {
+					if !allowed[i] {
+						denied = append(denied, i)
+					}
+				}
+				if len(denied) > 0 {
+					violations = append(violations, RoutingPolicyViolation{
+						Policy:  p.Name,
+						Message: fmt.Sprintf("alerts with %s are routed to receiver %q with %s integrations, only %s are allowed", p.Match, name, strings.Join(denied, ", "), strings.Join(p.AllowedIntegrations, ", ")),
+					})
+				}
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return &RoutingPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func anyReceiverHas(routed []string, receivers map[string][]string, integrations []string) bool {
+	for _, name := range routed {
+		for _, have := range receivers[name] {
+			for _, want := range integrations {
+				if have == want {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// quoteList formats names as a sorted list of quoted strings.
+func quoteList(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, fmt.Sprintf("%q", n))
+	}
+	sort.Strings(quoted)
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// RoutingPolicyChecker checks configs against the routing policies of the
+// operator.
+type RoutingPolicyChecker interface {
+	// CheckRoutingPolicies returns a *RoutingPolicyError if the config
+	// does not comply with the routing policies.
+	CheckRoutingPolicies(cfg string) error
+}
+
+// CheckRoutingPolicies implements RoutingPolicyChecker.
+func (am *MultitenantAlertmanager) CheckRoutingPolicies(cfg string) error {
+	if len(am.cfg.routingPolicies) == 0 {
+		return nil
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(cfg))
+	if err != nil {
+		return err
+	}
+	return checkRoutingPolicies(am.cfg.routingPolicies, conf)
+}
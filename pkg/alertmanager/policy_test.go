@@ -0,0 +1,95 @@
+package alertmanager
+
+import (
+	"strings"
+	"testing"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+func TestCheckRoutingPolicies(t *testing.T) {
+	policies, err := loadRoutingPolicies(`
+routing_policies:
+- name: critical-pages
+  match:
+    severity: critical
+  require_integrations: [pagerduty, opsgenie]
+- name: info-chat
+  match:
+    severity: info
+  allowed_integrations: [slack, msteams]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		routes string
+		want   []string
+	}{
+		{
+			name: "compliant",
+			routes: `
+  routes:
+  - receiver: pager
+    match:
+      severity: critical
+  - receiver: chat
+    match:
+      severity: info`,
+		},
+		{
+			name:   "violations",
+			routes: ``,
+			want: []string{
+				`routing policy "critical-pages": alerts with {severity="critical"} are routed to ["ops"]`,
+				`routing policy "info-chat": alerts with {severity="info"} are routed to receiver "ops" with webhook integrations`,
+			},
+		},
+	} {
+		conf, err := notify.LoadConfig(`
+route:
+  receiver: ops` + tc.routes + `
+receivers:
+- name: ops
+  webhook_configs:
+  - url: http://example.com/
+- name: chat
+  slack_configs:
+  - api_url: https://hooks.slack.com/services/x
+- name: pager
+  pagerduty_configs:
+  - routing_key: secret
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkRoutingPolicies(policies, conf)
+		if len(tc.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		e, ok := err.(*RoutingPolicyError)
+		if !ok || len(e.Violations) != len(tc.want) {
+			t.Fatalf("%s: got %v, want %d violations", tc.name, err, len(tc.want))
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(e.Error(), want) {
+				t.Errorf("%s: error %q does not contain %q", tc.name, e.Error(), want)
+			}
+		}
+	}
+
+	if _, err := loadRoutingPolicies(`
+routing_policies:
+- name: p
+  match:
+    severity: critical
+  require_integrations: [carrier-pigeon]
+`); err == nil {
+		t.Fatal("expected an error for an unknown integration")
+	}
+}
@@ -0,0 +1,42 @@
+package alertmanager
+
+import (
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/provider"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// preprocessedAlerts applies the alert preprocessing of the applied config
+// to the alerts put by the APIs, before they are stored and routed, and
+// records the heartbeats among them.
+type preprocessedAlerts struct {
+	provider.Alerts
+	am *Alertmanager
+}
+
+// Put implements provider.Alerts.
+func (p *preprocessedAlerts) Put(alerts ...*types.Alert) error {
+	alerts = p.am.preprocess(alerts)
+	if pl := p.am.getPipeline(); pl != nil {
+		p.am.heartbeats.observe(pl.conf.Heartbeats, alerts)
+	}
+	return p.Alerts.Put(alerts...)
+}
+
+// preprocess rewrites alerts with the alert preprocessing of the applied
+// config. The alerts left without labels are dropped.
+func (am *Alertmanager) preprocess(alerts []*types.Alert) []*types.Alert {
+	pl := am.getPipeline()
+	if pl == nil || pl.conf.AlertPreprocessing == nil {
+		return alerts
+	}
+	kept := alerts[:0]
+	for _, a := range alerts {
+		if !pl.conf.AlertPreprocessing.Apply(a) {
+			Must(level.Warn(am.logger).Log("msg", "dropping alert without labels after preprocessing", "annotations", a.Annotations))
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
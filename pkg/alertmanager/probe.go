@@ -0,0 +1,218 @@
+package alertmanager
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// probeReceiver is the loopback receiver of the synthetic probe alerts.
+	probeReceiver = "__probe__"
+	// probeLabel marks the synthetic probe alerts, which are routed to the
+	// probe receiver only.
+	probeLabel   model.LabelName = "__probe__"
+	probeIDLabel model.LabelName = "probe_id"
+
+	probeAlertname = "AlertmanagerProbe"
+
+	probeResultSuccess = "success"
+	probeResultTimeout = "timeout"
+)
+
+var (
+	probesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_synthetic_probes_total",
+		Help:      "The total number of synthetic probe alerts injected, by whether they reached the loopback receiver in time.",
+	}, []string{"user", "result"})
+	probeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_synthetic_probe_duration_seconds",
+		Help:      "The time from injecting a synthetic probe alert to its delivery to the loopback receiver.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+	probeLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_synthetic_probe_last_success_timestamp_seconds",
+		Help:      "The time the last synthetic probe alert of a user reached the loopback receiver.",
+	}, []string{"user"})
+)
+
+func init() {
+	prometheus.MustRegister(probesTotal, probeDuration, probeLastSuccess)
+}
+
+// isProbeAlert returns true if the alert is a synthetic probe alert.
+func isProbeAlert(a *types.Alert) bool {
+	return a.Labels[probeLabel] == "true"
+}
+
+// probeRoute returns a copy of the root route with a first child route
+// sending the synthetic probe alerts to the loopback receiver, without
+// waiting to group them. The keys of the other routes do not change.
+func probeRoute(root *config.Route) *config.Route {
+	groupWait, groupInterval := model.Duration(0), model.Duration(time.Second)
+	r := *root
+	r.Routes = append([]*config.Route{{
+		Receiver:      probeReceiver,
+		GroupByStr:    []string{string(probeIDLabel)},
+		GroupBy:       []model.LabelName{probeIDLabel},
+		Match:         map[string]string{string(probeLabel): "true"},
+		GroupWait:     &groupWait,
+		GroupInterval: &groupInterval,
+	}}, root.Routes...)
+	return &r
+}
+
+// probeDeliveries tracks the synthetic probe alerts of an Alertmanager
+// waiting to reach the loopback receiver.
+type probeDeliveries struct {
+	mtx     sync.Mutex
+	pending map[string]chan struct{}
+}
+
+func newProbeDeliveries() *probeDeliveries {
+	return &probeDeliveries{pending: map[string]chan struct{}{}}
+}
+
+func (d *probeDeliveries) add(id string) <-chan struct{} {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	ch := make(chan struct{})
+	d.pending[id] = ch
+	return ch
+}
+
+func (d *probeDeliveries) remove(id string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.pending, id)
+}
+
+// Exec implements notify.Stage. It is the stage of the loopback receiver,
+// marking the firing probe alerts delivered.
+func (d *probeDeliveries) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, a := range alerts {
+		if a.Resolved() {
+			continue
+		}
+		id := string(a.Labels[probeIDLabel])
+		if ch, ok := d.pending[id]; ok {
+			close(ch)
+			delete(d.pending, id)
+		}
+	}
+	return ctx, alerts, nil
+}
+
+// probe injects a synthetic alert and waits until the dispatcher delivers
+// it to the loopback receiver or ctx is done. The alert is resolved either
+// way.
+func (am *Alertmanager) probe(ctx context.Context) error {
+	now := time.Now()
+	id := strconv.FormatInt(now.UnixNano(), 36)
+	a := &types.Alert{
+		Alert: model.Alert{
+			Labels: model.LabelSet{
+				model.AlertNameLabel: probeAlertname,
+				probeLabel:           "true",
+				probeIDLabel:         model.LabelValue(id),
+			},
+			StartsAt: now,
+			EndsAt:   now.Add(time.Minute),
+		},
+		UpdatedAt: now,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		a.EndsAt = deadline
+	}
+
+	delivered := am.probes.add(id)
+	defer am.probes.remove(id)
+	// The alert skips the alert preprocessing and the limits of the user.
+	if err := am.alerts.Put(a); err != nil {
+		return err
+	}
+	defer func() {
+		resolved := *a
+		resolved.EndsAt = time.Now()
+		resolved.UpdatedAt = resolved.EndsAt
+		_ = am.alerts.Put(&resolved)
+	}()
+
+	select {
+	case <-delivered:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runProber probes the Alertmanagers every synthetic probe interval until
+// the MultitenantAlertmanager is stopped.
+func (am *MultitenantAlertmanager) runProber() {
+	t := time.NewTicker(am.cfg.SyntheticProbeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			am.probeAll()
+		case <-am.stop:
+			return
+		}
+	}
+}
+
+// probeAll probes the active Alertmanagers of the probed users
+// concurrently. Parked Alertmanagers are not rebuilt to be probed.
+func (am *MultitenantAlertmanager) probeAll() {
+	users := map[string]bool{}
+	for _, u := range am.cfg.SyntheticProbeUsers {
+		users[u] = true
+	}
+	probed := map[string]*Alertmanager{}
+	am.alertmanagersMtx.Lock()
+	for userID, userAM := range am.alertmanagers {
+		if len(users) == 0 || users[userID] {
+			probed[userID] = userAM
+		}
+	}
+	am.alertmanagersMtx.Unlock()
+
+	var wg sync.WaitGroup
+	for userID, userAM := range probed {
+		wg.Add(1)
+		go func(userID string, userAM *Alertmanager) {
+			defer wg.Done()
+			am.probeUser(userID, userAM)
+		}(userID, userAM)
+	}
+	wg.Wait()
+}
+
+func (am *MultitenantAlertmanager) probeUser(userID string, userAM *Alertmanager) {
+	ctx, cancel := context.WithTimeout(context.Background(), am.cfg.SyntheticProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := userAM.probe(ctx); err != nil {
+		probesTotal.WithLabelValues(userID, probeResultTimeout).Inc()
+		Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: synthetic probe failed", "user", userID, "err", err))
+		return
+	}
+	probeDuration.Observe(time.Since(start).Seconds())
+	probesTotal.WithLabelValues(userID, probeResultSuccess).Inc()
+	probeLastSuccess.WithLabelValues(userID).SetToCurrentTime()
+}
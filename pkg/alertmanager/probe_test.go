@@ -0,0 +1,60 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+func TestProbe(t *testing.T) {
+	var notified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&notified, 1)
+	}))
+	defer srv.Close()
+
+	am := newTestAlertmanager(t)
+	am.cfg.SyntheticProbes = true
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+  group_wait: 0s
+receivers:
+- name: team
+  webhook_configs:
+  - url: ` + srv.URL + `
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := am.probe(ctx); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&notified); n != 0 {
+		t.Fatalf("the probe alert was sent to the receiver of the user %d times", n)
+	}
+	if am.idleSince().IsZero() {
+		t.Fatal("the probe alert keeps the alertmanager from being idle")
+	}
+
+	am.cfg.SyntheticProbes = false
+	if err := am.ApplyConfig(context.Background(), testUserID, testConfig(t, am, "other", ""), nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := am.probe(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v without the loopback receiver, want deadline exceeded", err)
+	}
+}
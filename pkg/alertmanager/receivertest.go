@@ -0,0 +1,143 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/gorilla/mux"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// receiverTestTimeout bounds the delivery of a test notification by all the
+// integrations of a receiver.
+const receiverTestTimeout = 30 * time.Second
+
+var errReceiverNotFound = fmt.Errorf("receiver not found")
+
+// ReceiverTest is the outcome of sending a test notification to each
+// integration of a receiver.
+type ReceiverTest struct {
+	Receiver     string                  `json:"receiver"`
+	Integrations []IntegrationTestResult `json:"integrations"`
+}
+
+// IntegrationTestResult is the outcome of sending a test notification with a
+// single integration. Responses holds the responses of the downstream
+// service, which are not known for the integrations not sending over HTTP or
+// using the upstream notifiers.
+type IntegrationTestResult struct {
+	Name      string            `json:"name"`
+	Delivered bool              `json:"delivered"`
+	Retryable bool              `json:"retryable,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Responses []notify.Response `json:"responses,omitempty"`
+}
+
+// testAlert returns the canned alert sent by receiver tests.
+func testAlert(now time.Time) *types.Alert {
+	return &types.Alert{
+		Alert: model.Alert{
+			Labels: model.LabelSet{
+				model.AlertNameLabel: "TestAlert",
+				"severity":           "none",
+			},
+			Annotations: model.LabelSet{
+				"summary":     "Test notification",
+				"description": "This is a test notification sent to verify the configuration of the receiver.",
+			},
+			StartsAt: now,
+			EndsAt:   now.Add(5 * time.Minute),
+		},
+		UpdatedAt: now,
+	}
+}
+
+// TestReceiver renders the templates of the applied config for a canned
+// alert and sends it once with each integration of the receiver. The
+// notification bypasses the routing tree, the silences and the notification
+// log.
+func (am *Alertmanager) TestReceiver(ctx context.Context, name string) (*ReceiverTest, error) {
+	p := am.getPipeline()
+	if p == nil {
+		return nil, fmt.Errorf("no configuration applied")
+	}
+	var rc *notify.Receiver
+	for _, r := range p.conf.Receivers {
+		if r.Name == name {
+			rc = r
+			break
+		}
+	}
+	if rc == nil {
+		return nil, errReceiverNotFound
+	}
+
+	now := time.Now()
+	alert := testAlert(now)
+	groupLabels := model.LabelSet{model.AlertNameLabel: alert.Labels[model.AlertNameLabel]}
+
+	ctx = notify.WithTenantID(ctx, am.cfg.UserID)
+	ctx = notify.WithFeatures(ctx, am.cfg.Features)
+	ctx = amnotify.WithGroupKey(ctx, fmt.Sprintf("{}/test:%s", groupLabels))
+	ctx = amnotify.WithGroupLabels(ctx, groupLabels)
+	ctx = amnotify.WithReceiverName(ctx, rc.Name)
+	ctx = amnotify.WithNow(ctx, now)
+
+	rt := &ReceiverTest{Receiver: rc.Name, Integrations: []IntegrationTestResult{}}
+	for _, i := range notify.BuildReceiverIntegrations(rc, p.tmpl, am.logger) {
+		var rec notify.ResponseRecorder
+		retry, err := i.Notify(notify.WithResponseRecorder(ctx, &rec), alert)
+		it := IntegrationTestResult{
+			Name:      fmt.Sprintf("%s[%d]", i.Name(), i.Index()),
+			Delivered: err == nil,
+			Responses: rec.Responses(),
+		}
+		if err != nil {
+			it.Retryable = retry
+			it.Error = err.Error()
+		}
+		rt.Integrations = append(rt.Integrations, it)
+	}
+	return rt, nil
+}
+
+// TestReceiver sends a test notification with the receiver of a user named
+// in the path, returning the responses of the downstream services.
+func (am *MultitenantAlertmanager) TestReceiver(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), receiverTestTimeout)
+	defer cancel()
+	rt, err := userAM.TestReceiver(ctx, mux.Vars(req)["name"])
+	if err == errReceiverNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
@@ -0,0 +1,245 @@
+package alertmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"gopkg.in/yaml.v2"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+)
+
+const (
+	// recurringSilenceInterval is how often the recurring silences are
+	// materialized.
+	recurringSilenceInterval = time.Minute
+	// recurringSilenceLookahead is how long before they start the
+	// occurrences of the recurring silences are materialized, as pending
+	// silences.
+	recurringSilenceLookahead = time.Hour
+
+	// recurringSilenceAuthorPrefix prefixes the name of the recurring
+	// silence in the author of its silences.
+	recurringSilenceAuthorPrefix = "recurring-silence:"
+
+	recurringSilencesKey = "recurring_silences"
+)
+
+var errRecurringSilenceNotFound = errors.New("recurring silence not found")
+
+// recurringSilencer materializes the occurrences of the recurring silences
+// of an Alertmanager into regular silences. Only the leader materializes
+// them, the silences are gossiped to the other replicas like any other.
+type recurringSilencer struct {
+	am     *Alertmanager
+	logger log.Logger
+}
+
+func newRecurringSilencer(am *Alertmanager) *recurringSilencer {
+	return &recurringSilencer{am: am, logger: log.With(am.logger, "component", "recurring-silences")}
+}
+
+// run materializes the recurring silences until stopc is closed.
+func (r *recurringSilencer) run(stopc <-chan struct{}) {
+	t := time.NewTicker(recurringSilenceInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.sync(time.Now())
+		case <-stopc:
+			return
+		}
+	}
+}
+
+func (r *recurringSilencer) sync(now time.Time) {
+	if r.am.cfg.IsLeader != nil && !r.am.cfg.IsLeader() {
+		return
+	}
+	p := r.am.getPipeline()
+	if p == nil {
+		return
+	}
+	created, expired, err := syncRecurringSilences(r.am.silences, p.conf.RecurringSilences, now)
+	if err != nil {
+		Must(level.Error(r.logger).Log("msg", "Failed to materialize recurring silences", "err", err))
+	}
+	if created > 0 || expired > 0 {
+		Must(level.Info(r.logger).Log("msg", "Recurring silences materialized", "created", created, "expired", expired))
+	}
+}
+
+// recurringSilenceOccurrence returns the silence of the occurrence of rs
+// starting at start. Its author names rs and its comment the occurrence, so
+// that each occurrence is materialized once, even if its silence is expired
+// early.
+func recurringSilenceOccurrence(rs *notify.RecurringSilence, start time.Time) *silencepb.Silence {
+	comment := rs.Comment
+	if comment == "" {
+		comment = "Recurring silence " + rs.Name
+	}
+	sil := &silencepb.Silence{
+		StartsAt:  start,
+		EndsAt:    start.Add(time.Duration(rs.Duration)),
+		CreatedBy: recurringSilenceAuthorPrefix + rs.Name,
+		Comment:   fmt.Sprintf("%s (occurrence %s for %s)", comment, start.UTC().Format(time.RFC3339), rs.Duration),
+	}
+	for ln, v := range rs.Match {
+		sil.Matchers = append(sil.Matchers, &silencepb.Matcher{Type: silencepb.Matcher_EQUAL, Name: ln, Pattern: v})
+	}
+	for ln, re := range rs.MatchRE {
+		pattern, _ := re.MarshalYAML()
+		sil.Matchers = append(sil.Matchers, &silencepb.Matcher{Type: silencepb.Matcher_REGEXP, Name: ln, Pattern: fmt.Sprint(pattern)})
+	}
+	sort.Slice(sil.Matchers, func(i, j int) bool { return sil.Matchers[i].Name < sil.Matchers[j].Name })
+	return sil
+}
+
+// occurrenceKey identifies the occurrence of a recurring silence a silence
+// was materialized for. It changes with the matchers, the duration and the
+// comment of the recurring silence.
+func occurrenceKey(sil *silencepb.Silence) string {
+	return fmt.Sprintf("%s|%q|%s", sil.CreatedBy, sil.Comment, matchersKey(sil.Matchers))
+}
+
+// syncRecurringSilences creates the silences of the occurrences of the
+// recurring silences which are running or start within the lookahead, and
+// were not materialized yet. The unexpired silences of occurrences which
+// no longer exist, because their recurring silence was changed or removed,
+// are expired.
+func syncRecurringSilences(silences *silence.Silences, recurring []*notify.RecurringSilence, now time.Time) (created, expired int, err error) {
+	wanted := map[string]*silencepb.Silence{}
+	for _, rs := range recurring {
+		for _, start := range rs.Occurrences(now, now.Add(recurringSilenceLookahead)) {
+			sil := recurringSilenceOccurrence(rs, start)
+			wanted[occurrenceKey(sil)] = sil
+		}
+	}
+
+	existing, _, err := silences.Query()
+	if err != nil {
+		return 0, 0, err
+	}
+	materialized := map[string]bool{}
+	for _, sil := range existing {
+		if !strings.HasPrefix(sil.CreatedBy, recurringSilenceAuthorPrefix) {
+			continue
+		}
+		key := occurrenceKey(sil)
+		materialized[key] = true
+		if wanted[key] != nil || !sil.EndsAt.After(now) {
+			continue
+		}
+		if err := silences.Expire(sil.Id); err != nil {
+			return created, expired, err
+		}
+		expired++
+	}
+
+	for key, sil := range wanted {
+		if materialized[key] {
+			continue
+		}
+		if _, err := silences.Set(sil); err != nil {
+			return created, expired, err
+		}
+		created++
+	}
+	return created, expired, nil
+}
+
+// listRecurringSilences returns the recurring silences of the user's
+// config.
+func (a *API) listRecurringSilences(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(cfg.Config))
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error loading config", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	silences := conf.RecurringSilences
+	if silences == nil {
+		silences = []*notify.RecurringSilence{}
+	}
+	writeJSON(w, http.StatusOK, silences)
+}
+
+// setRecurringSilence adds a recurring silence to the user's config, or
+// replaces the recurring silence of the same name. The silences of its
+// changed occurrences are replaced once the config is applied.
+func (a *API) setRecurringSilence(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	// Decoded like the config, see setMaintenanceWindow.
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var rs notify.RecurringSilence
+	if err := yaml.UnmarshalStrict(body, &rs); err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.updateConfigList(w, r, userID, recurringSilencesKey, "recurring silence", func(silences []interface{}) ([]interface{}, error) {
+		data, err := yaml.Marshal(&rs)
+		if err != nil {
+			return nil, err
+		}
+		var item yaml.MapSlice
+		if err := yaml.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		return setConfigListItem(silences, rs.Name, item), nil
+	})
+}
+
+// deleteRecurringSilence removes a recurring silence from the user's
+// config. The silences of its occurrences are expired once the config is
+// applied.
+func (a *API) deleteRecurringSilence(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	a.updateConfigList(w, r, userID, recurringSilencesKey, "recurring silence", func(silences []interface{}) ([]interface{}, error) {
+		return deleteConfigListItem(silences, name, errRecurringSilenceNotFound)
+	})
+}
@@ -0,0 +1,132 @@
+package alertmanager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+func loadRecurringSilences(t *testing.T, yaml string) []*notify.RecurringSilence {
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+recurring_silences:
+` + yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf.RecurringSilences
+}
+
+func unexpiredSilences(t *testing.T, silences *silence.Silences, now time.Time) []*silencepb.Silence {
+	sils, _, err := silences.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []*silencepb.Silence
+	for _, sil := range sils {
+		if sil.EndsAt.After(now) {
+			res = append(res, sil)
+		}
+	}
+	return res
+}
+
+func TestRecurringSilenceOccurrences(t *testing.T) {
+	rs := loadRecurringSilences(t, `
+- name: weekly
+  schedule: 0 2 * * sun
+  duration: 2h
+  match:
+    team: db
+`)[0]
+	// 2026-10-18 is a Sunday.
+	sunday := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		from time.Time
+		want int
+	}{
+		{from: sunday, want: 0},
+		{from: sunday.Add(time.Hour), want: 1},
+		{from: sunday.Add(3 * time.Hour), want: 1},
+		{from: sunday.Add(4 * time.Hour), want: 0},
+	} {
+		got := rs.Occurrences(tc.from, tc.from.Add(time.Hour))
+		if len(got) != tc.want {
+			t.Fatalf("expected %d occurrences from %s, got %v", tc.want, tc.from, got)
+		}
+		if len(got) == 1 && !got[0].Equal(sunday.Add(2*time.Hour)) {
+			t.Fatalf("unexpected occurrence %s", got[0])
+		}
+	}
+}
+
+func TestSyncRecurringSilences(t *testing.T) {
+	silences, err := silence.New(silence.Options{Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recurring := loadRecurringSilences(t, `
+- name: nightly
+  schedule: 0 2 * * *
+  duration: 2h
+  match:
+    team: db
+  match_re:
+    instance: db-.*
+  comment: backups
+`)
+	now := time.Now().UTC().Truncate(24 * time.Hour).Add(26 * time.Hour)
+
+	// The running occurrence is created once.
+	for i := 0; i < 2; i++ {
+		created, expired, err := syncRecurringSilences(silences, recurring, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1 - i; created != want || expired != 0 {
+			t.Fatalf("sync %d: expected %d created and none expired, got %d and %d", i, want, created, expired)
+		}
+	}
+	sils := unexpiredSilences(t, silences, now)
+	if len(sils) != 1 || len(sils[0].Matchers) != 2 || sils[0].CreatedBy != "recurring-silence:nightly" || !strings.HasPrefix(sils[0].Comment, "backups") {
+		t.Fatalf("unexpected silences %v", sils)
+	}
+	if !sils[0].EndsAt.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("expected the silence to end with the occurrence, got %s", sils[0].EndsAt)
+	}
+
+	// An expired occurrence is not created again.
+	if err := silences.Expire(sils[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	if created, _, _ := syncRecurringSilences(silences, recurring, now); created != 0 {
+		t.Fatal("expired occurrence created again")
+	}
+
+	// Changed recurring silences replace the unexpired silences of their
+	// occurrences, removed ones expire them.
+	changed := loadRecurringSilences(t, `
+- name: nightly
+  schedule: 0 3 * * *
+  duration: 2h
+  match:
+    team: db
+`)
+	if created, expired, _ := syncRecurringSilences(silences, changed, now); created != 1 || expired != 0 {
+		t.Fatalf("expected the changed occurrence to be created, got %d created and %d expired", created, expired)
+	}
+	if created, expired, _ := syncRecurringSilences(silences, nil, now); created != 0 || expired != 1 {
+		t.Fatalf("expected the occurrence to be expired, got %d created and %d expired", created, expired)
+	}
+	if sils := unexpiredSilences(t, silences, time.Now()); len(sils) != 0 {
+		t.Fatalf("unexpected unexpired silences %v", sils)
+	}
+}
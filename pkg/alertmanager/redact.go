@@ -0,0 +1,208 @@
+package alertmanager
+
+import (
+	"reflect"
+	"strings"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// redactedSecret replaces the secrets of redacted configs, as in the configs
+// shown by upstream Alertmanager.
+const redactedSecret = "<secret>"
+
+var (
+	secretTypes = map[reflect.Type]bool{
+		reflect.TypeOf(config.Secret("")):    true,
+		reflect.TypeOf(commoncfg.Secret("")): true,
+		reflect.TypeOf(config.SecretURL{}):   true,
+	}
+	// sensitiveFields are the fields which are not typed as secrets, but
+	// commonly hold credentials. All their values are redacted.
+	sensitiveFields = map[reflect.Type]map[string]bool{
+		reflect.TypeOf(notify.WebhookConfig{}): {"url": true, "headers": true},
+	}
+)
+
+// RedactionConfig configures the redaction of the secrets in the configs
+// returned by the config API.
+type RedactionConfig struct {
+	Enabled bool
+	// RevealScope is the scope requests need to get the secrets with
+	// ?reveal=true.
+	RevealScope string
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet.
+func (c *RedactionConfig) AddFlags(f *pflag.FlagSet) {
+	f.BoolVar(&c.Enabled, "alertmanager.configs.redact-secrets", true, "Mask the secrets in the configs returned by the config API, unless they are requested with ?reveal=true.")
+	f.StringVar(&c.RevealScope, "alertmanager.configs.reveal-scope", "configs:reveal", "Scope in the "+ScopesHeaderName+" header required to get the secrets of configs with ?reveal=true.")
+}
+
+func (c *RedactionConfig) Validate() error {
+	if c.Enabled && c.RevealScope == "" {
+		return errors.New("alertmanager.configs.reveal-scope must be non empty")
+	}
+	return nil
+}
+
+// redactConfig masks the secrets in the global section and the receivers of
+// cfg. Secret references are kept, as they hold no secrets.
+func redactConfig(cfg string) (string, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg), &raw); err != nil {
+		return "", err
+	}
+	for i, item := range raw {
+		switch item.Key {
+		case "global":
+			raw[i].Value = redact(item.Value, reflect.TypeOf(config.GlobalConfig{}))
+		case "receivers":
+			receivers, ok := item.Value.([]interface{})
+			if !ok {
+				continue
+			}
+			// The extended integrations replace the upstream ones.
+			for j, r := range receivers {
+				receivers[j] = redact(r, reflect.TypeOf(notify.ReceiverExtension{}), reflect.TypeOf(config.Receiver{}))
+			}
+		}
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// redact masks the secrets in the YAML value v. The fields of v are looked
+// up in the types ts in order.
+func redact(v interface{}, ts ...reflect.Type) interface{} {
+	for i := range ts {
+		for ts[i].Kind() == reflect.Ptr {
+			ts[i] = ts[i].Elem()
+		}
+	}
+	if secretTypes[ts[0]] {
+		return redactValue(v)
+	}
+
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for i, item := range v {
+			key, _ := item.Key.(string)
+			for _, t := range ts {
+				if t.Kind() != reflect.Struct {
+					continue
+				}
+				ft, sensitive, ok := yamlField(t, key)
+				if !ok {
+					continue
+				}
+				if sensitive {
+					v[i].Value = redactAll(item.Value)
+				} else {
+					v[i].Value = redact(item.Value, ft)
+				}
+				break
+			}
+		}
+	case []interface{}:
+		if k := ts[0].Kind(); k == reflect.Slice || k == reflect.Array {
+			for i := range v {
+				v[i] = redact(v[i], ts[0].Elem())
+			}
+		}
+	}
+	return v
+}
+
+// yamlField returns the type of the field of the struct t with the YAML key,
+// and whether the field is sensitive.
+func yamlField(t reflect.Type, key string) (reflect.Type, bool, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() != reflect.Struct {
+				continue
+			}
+			if ft, sensitive, ok := yamlField(ft, key); ok {
+				return ft, sensitive, true
+			}
+			continue
+		}
+		if tag[0] == key {
+			return f.Type, sensitiveFields[t][key], true
+		}
+	}
+	return nil, false, false
+}
+
+// redactAll masks all the strings in the YAML value v.
+func redactAll(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return redactValue(v)
+	case yaml.MapSlice:
+		for i := range v {
+			v[i].Value = redactAll(v[i].Value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactAll(v[i])
+		}
+	}
+	return v
+}
+
+func redactValue(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || s == "" || secrets.IsReference(s) {
+		return v
+	}
+	return redactedSecret
+}
+
+// hasRedactedSecrets returns true if the global section or the receivers of
+// cfg hold redacted secrets, which happens if a config read from the API is
+// stored again.
+func hasRedactedSecrets(cfg string) bool {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg), &raw); err != nil {
+		return false
+	}
+	found := false
+	var find func(v interface{})
+	find = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			found = found || v == redactedSecret
+		case yaml.MapSlice:
+			for _, item := range v {
+				find(item.Value)
+			}
+		case []interface{}:
+			for _, e := range v {
+				find(e)
+			}
+		}
+	}
+	for _, item := range raw {
+		if item.Key == "global" || item.Key == "receivers" {
+			find(item.Value)
+		}
+	}
+	return found
+}
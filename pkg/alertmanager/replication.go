@@ -0,0 +1,699 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/matttproud/golang_protobuf_extensions/pbutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// ReplicationRoleNone disables replication.
+	ReplicationRoleNone = "none"
+	// ReplicationRolePrimary accepts config writes and pushes them to the
+	// standby deployment.
+	ReplicationRolePrimary = "primary"
+	// ReplicationRoleStandby rejects config writes of users and accepts the
+	// configs pushed by the primary deployment.
+	ReplicationRoleStandby = "standby"
+)
+
+var (
+	replicationPushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "replication_pushes_total",
+		Help:      "The total number of pushes to the standby deployment.",
+	}, []string{"kind", "status"})
+	replicationConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "replication_conflicts_total",
+		Help:      "The total number of pushed configs ignored by the standby, which had replicated a later revision.",
+	})
+	replicationLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "replication_last_success_timestamp_seconds",
+		Help:      "The time of the last successful push of configs to the standby deployment.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(replicationPushes, replicationConflicts, replicationLastSuccess)
+}
+
+// ReplicationConfig configures the replication of configs, and optionally
+// silences, from a primary to a standby deployment.
+type ReplicationConfig struct {
+	Role           string
+	StandbyURL     string
+	TokenFile      string
+	Interval       time.Duration
+	ResyncInterval time.Duration
+	Timeout        time.Duration
+	Silences       bool
+
+	token string
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet.
+func (c *ReplicationConfig) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&c.Role, "replication.role", ReplicationRoleNone, "Role of this deployment in config replication. One of: none|primary|standby")
+	f.StringVar(&c.StandbyURL, "replication.standby-url", "", "URL of the standby deployment the primary pushes configs to.")
+	f.StringVar(&c.TokenFile, "replication.token-file", "", "File holding the bearer token shared by the primary and the standby deployment.")
+	f.DurationVar(&c.Interval, "replication.interval", 30*time.Second, "How frequently the primary pushes changed silences to the standby.")
+	f.DurationVar(&c.ResyncInterval, "replication.resync-interval", 10*time.Minute, "How frequently the primary pushes all configs to the standby, in case updates were missed.")
+	f.DurationVar(&c.Timeout, "replication.timeout", 30*time.Second, "Timeout for pushes to the standby.")
+	f.BoolVar(&c.Silences, "replication.silences", false, "Push the silences of active users to the standby too.")
+}
+
+func (c *ReplicationConfig) Validate() error {
+	switch c.Role {
+	case ReplicationRoleNone:
+		return nil
+	case ReplicationRolePrimary:
+		u, err := url.Parse(c.StandbyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("replication.standby-url must be an http(s) URL with the primary role")
+		}
+		if c.Interval <= 0 {
+			return errors.New("replication.interval must be positive")
+		}
+		if c.ResyncInterval <= 0 {
+			return errors.New("replication.resync-interval must be positive")
+		}
+	case ReplicationRoleStandby:
+	default:
+		return errors.Errorf("unknown replication.role %q", c.Role)
+	}
+	if c.TokenFile == "" {
+		return errors.New("replication.token-file must be set with replication enabled")
+	}
+	data, err := ioutil.ReadFile(c.TokenFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read replication.token-file")
+	}
+	c.token = strings.TrimSpace(string(data))
+	if c.token == "" {
+		return errors.New("replication.token-file is empty")
+	}
+	return nil
+}
+
+const (
+	// replicationPageSize is the maximum number of configs pushed to the
+	// standby per request.
+	replicationPageSize = 500
+
+	// Delay before pushing all configs again after a failed push.
+	replicationRetryDelay = 10 * time.Second
+)
+
+// errReplicated aborts the update of a config already replicated at the
+// pushed revision, errReplicationConflict that of a config replicated at a
+// later revision.
+var (
+	errReplicated          = errors.New("config already replicated")
+	errReplicationConflict = errors.New("config replicated at a later revision")
+)
+
+// A ReplicatedConfig is a config changed or deleted on the primary
+// deployment.
+type ReplicatedConfig struct {
+	UserID string `json:"userID"`
+	// Revision is the revision the config was changed or deleted at on the
+	// primary.
+	Revision int64 `json:"revision"`
+	// Config is nil if the config was deleted.
+	Config *AlertmanagerConfig `json:"config,omitempty"`
+}
+
+// ReplicationConflict is a pushed config which was not applied, because the
+// standby has a config of the user replicated at a later revision, pushed
+// before by another replica of the primary.
+type ReplicationConflict struct {
+	UserID         string `json:"userID"`
+	LocalRevision  int64  `json:"localRevision"`
+	RemoteRevision int64  `json:"remoteRevision"`
+}
+
+// ReplicationResult is the outcome of pushing configs to the standby.
+type ReplicationResult struct {
+	Applied   []string              `json:"applied"`
+	Deleted   []string              `json:"deleted"`
+	Unchanged []string              `json:"unchanged"`
+	Conflicts []ReplicationConflict `json:"conflicts"`
+}
+
+func newReplicationResult() ReplicationResult {
+	return ReplicationResult{Applied: []string{}, Deleted: []string{}, Unchanged: []string{}, Conflicts: []ReplicationConflict{}}
+}
+
+// ReplicationPrune lists the users which have a config on the primary
+// deployment.
+type ReplicationPrune struct {
+	UserIDs []string `json:"userIDs"`
+	// Revision is the revision of the primary before the users were listed.
+	// The configs replicated at a later revision are kept, they may have
+	// been created after the listing.
+	Revision int64 `json:"revision"`
+}
+
+// ReplicationAPI implements the sync API the primary pushes to.
+type ReplicationAPI struct {
+	cfg    *ReplicationConfig
+	client AlertmanagerClient
+	am     *MultitenantAlertmanager
+}
+
+// NewReplicationAPI creates a new ReplicationAPI.
+func NewReplicationAPI(cfg *ReplicationConfig, c AlertmanagerClient, am *MultitenantAlertmanager) *ReplicationAPI {
+	return &ReplicationAPI{cfg: cfg, client: c, am: am}
+}
+
+// RegisterRoutes registers the sync API HTTP routes with the provided
+// Router. Nothing is registered unless this is the standby deployment.
+func (a *ReplicationAPI) RegisterRoutes(r *mux.Router) {
+	if a.cfg.Role != ReplicationRoleStandby {
+		return
+	}
+	for _, route := range []struct {
+		name, method, path string
+		handler            http.HandlerFunc
+	}{
+		{"replicate_configs", "POST", "/api/v1/replication/configs", a.replicateConfigs},
+		{"prune_configs", "POST", "/api/v1/replication/configs/prune", a.pruneConfigs},
+		{"replicate_silences", "POST", "/api/v1/replication/silences/{user}", a.replicateSilences},
+	} {
+		r.Handle(route.path, a.authenticate(route.handler)).Methods(route.method).Name(route.name)
+	}
+}
+
+func (a *ReplicationAPI) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + a.cfg.token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			http.Error(w, "invalid replication token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// replicateConfigs stores and deletes the pushed configs, in the order of
+// their revisions on the primary.
+func (a *ReplicationAPI) replicateConfigs(w http.ResponseWriter, r *http.Request) {
+	var cfgs []ReplicatedConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfgs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := newReplicationResult()
+	for _, rc := range cfgs {
+		if rc.UserID == "" || (rc.Config != nil && rc.Config.UserID != rc.UserID) {
+			http.Error(w, "config without matching user id", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if rc.Config == nil {
+			err = a.deleteConfig(r.Context(), rc, &res)
+		} else {
+			err = a.applyConfig(r.Context(), rc, &res)
+		}
+		if err != nil {
+			Must(level.Error(logger2.Logger).Log("msg", "error replicating config", "user", rc.UserID, "err", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(res.Applied) > 0 || len(res.Deleted) > 0 || len(res.Conflicts) > 0 {
+		Must(level.Info(logger2.Logger).Log("msg", "replicated configs", "applied", len(res.Applied), "deleted", len(res.Deleted), "conflicts", len(res.Conflicts)))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// applyConfig stores a pushed config, unless the stored one was replicated
+// at the same or a later revision.
+func (a *ReplicationAPI) applyConfig(ctx context.Context, rc ReplicatedConfig, res *ReplicationResult) error {
+	var (
+		localRev  int64
+		unchanged bool
+	)
+	err := a.client.UpdateConfig(ctx, rc.UserID, func(local *AlertmanagerConfig) error {
+		localRev = local.ReplicatedRevision
+		if local.UserID != "" {
+			switch {
+			case local.ReplicatedRevision == rc.Revision:
+				return errReplicated
+			case local.ReplicatedRevision > rc.Revision:
+				return errReplicationConflict
+			}
+		}
+		// The revision is stored even if the content did not change, so
+		// that older pushes are recognized.
+		unchanged = local.UserID != "" &&
+			configChecksum(local) == configChecksum(rc.Config) &&
+			local.DeactivatedAtInUnix == rc.Config.DeactivatedAtInUnix &&
+			local.DeletedAtInUnix == rc.Config.DeletedAtInUnix
+		*local = *rc.Config
+		local.ReplicatedRevision = rc.Revision
+		return nil
+	})
+	switch {
+	case err == errReplicated || (err == nil && unchanged):
+		res.Unchanged = append(res.Unchanged, rc.UserID)
+	case err == errReplicationConflict:
+		res.Conflicts = append(res.Conflicts, ReplicationConflict{UserID: rc.UserID, LocalRevision: localRev, RemoteRevision: rc.Revision})
+	case err != nil:
+		return err
+	default:
+		res.Applied = append(res.Applied, rc.UserID)
+	}
+	return nil
+}
+
+// deleteConfig deletes the config of a user deleted on the primary, unless
+// it was replicated at a later revision.
+func (a *ReplicationAPI) deleteConfig(ctx context.Context, rc ReplicatedConfig, res *ReplicationResult) error {
+	local, err := a.client.GetConfig(ctx, rc.UserID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case local.UserID == "":
+		res.Unchanged = append(res.Unchanged, rc.UserID)
+	case local.ReplicatedRevision > rc.Revision:
+		res.Conflicts = append(res.Conflicts, ReplicationConflict{UserID: rc.UserID, LocalRevision: local.ReplicatedRevision, RemoteRevision: rc.Revision})
+	default:
+		if err := a.client.DeleteConfig(ctx, rc.UserID); err != nil {
+			return err
+		}
+		res.Deleted = append(res.Deleted, rc.UserID)
+	}
+	return nil
+}
+
+// pruneConfigs deletes the configs of the users which have none on the
+// primary, unless they were replicated after the users were listed. It
+// removes the configs whose deletion was missed.
+func (a *ReplicationAPI) pruneConfigs(w http.ResponseWriter, r *http.Request) {
+	var prune ReplicationPrune
+	if err := json.NewDecoder(r.Body).Decode(&prune); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keep := make(map[string]bool, len(prune.UserIDs))
+	for _, userID := range prune.UserIDs {
+		keep[userID] = true
+	}
+
+	res := newReplicationResult()
+	opts := ListConfigsOptions{Limit: replicationPageSize}
+	for {
+		cfgs, next, err := a.client.ListConfigs(r.Context(), opts)
+		if err != nil {
+			Must(level.Error(logger2.Logger).Log("msg", "error listing configs", "err", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, cfg := range cfgs {
+			if keep[cfg.UserID] || cfg.ReplicatedRevision > prune.Revision {
+				continue
+			}
+			if err := a.client.DeleteConfig(r.Context(), cfg.UserID); err != nil {
+				Must(level.Error(logger2.Logger).Log("msg", "error deleting config", "user", cfg.UserID, "err", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res.Deleted = append(res.Deleted, cfg.UserID)
+		}
+		if next == "" {
+			break
+		}
+		opts.Continue = next
+	}
+	if len(res.Deleted) > 0 {
+		Must(level.Info(logger2.Logger).Log("msg", "pruned replicated configs", "deleted", len(res.Deleted)))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// replicateSilences merges the pushed silences of a user, encoded like the
+// gossiped silence state, into the silences of the user's Alertmanager.
+func (a *ReplicationAPI) replicateSilences(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user"]
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sils, err := decodeSilences(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userAM, err := a.am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The silences are merged one at a time, so that each new silence is
+	// gossiped to the other replicas of the standby. Merged states too large
+	// for gossip are not propagated.
+	for _, sil := range sils {
+		b, err := encodeSilences([]*silencepb.MeshSilence{sil})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := userAM.silences.Merge(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeSilences decodes a silence state.
+func decodeSilences(data []byte) ([]*silencepb.MeshSilence, error) {
+	var sils []*silencepb.MeshSilence
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		var s silencepb.MeshSilence
+		if _, err := pbutil.ReadDelimited(r, &s); err != nil {
+			return nil, errors.Wrap(err, "failed to decode silences")
+		}
+		sils = append(sils, &s)
+	}
+	return sils, nil
+}
+
+// encodeSilences encodes sils like a silence state.
+func encodeSilences(sils []*silencepb.MeshSilence) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, s := range sils {
+		if _, err := pbutil.WriteDelimited(&buf, s); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// A Replicator pushes the configs changed on the primary deployment to the
+// standby as they are seen by its config watch, and all configs page by
+// page when updates may have been missed. Every replica of the primary
+// pushes the configs, the standby orders them by their revisions. The
+// silences are pushed by the leader only.
+type Replicator struct {
+	cfg     *ReplicationConfig
+	client  AlertmanagerClient
+	updates AlertmanagerGetter
+	am      *MultitenantAlertmanager
+	http    *http.Client
+	logger  log.Logger
+
+	// silencesPushed is the update time of the latest silence pushed by
+	// user.
+	silencesPushed map[string]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReplicator creates a new Replicator, which gets the changed configs
+// from w. w must not be used by anything else.
+func NewReplicator(cfg *ReplicationConfig, c AlertmanagerClient, w AlertmanagerWatcher, am *MultitenantAlertmanager) (*Replicator, error) {
+	updates, err := NewAlertmanagerGetterWrapper(c, w)
+	if err != nil {
+		return nil, err
+	}
+	return &Replicator{
+		cfg:            cfg,
+		client:         c,
+		updates:        updates,
+		am:             am,
+		http:           &http.Client{Timeout: cfg.Timeout},
+		logger:         log.With(logger2.Logger, "component", "replicator"),
+		silencesPushed: map[string]time.Time{},
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// Run pushes configs until the Replicator is stopped. All configs are pushed
+// first, then the changed ones.
+func (r *Replicator) Run() {
+	defer close(r.done)
+	resync := time.NewTicker(r.cfg.ResyncInterval)
+	defer resync.Stop()
+	silences := time.NewTicker(r.cfg.Interval)
+	defer silences.Stop()
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	for {
+		var err error
+		select {
+		case <-retry.C:
+			err = r.resyncConfigs()
+		case <-resync.C:
+			err = r.resyncConfigs()
+		case <-r.updates.Updated():
+			err = r.pushUpdates()
+			if err == ErrResyncRequired {
+				err = r.resyncConfigs()
+			}
+		case <-silences.C:
+			if r.cfg.Silences && r.am.IsLeader() {
+				r.pushSilences()
+			}
+		case <-r.stop:
+			return
+		}
+		if err != nil {
+			// The updates were consumed, all configs are pushed again.
+			Must(level.Warn(r.logger).Log("msg", "failed to push configs to standby", "retry_in", replicationRetryDelay, "err", err))
+			retry.Reset(replicationRetryDelay)
+		}
+	}
+}
+
+// Stop stops the Replicator.
+func (r *Replicator) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+// pushUpdates pushes the configs changed or deleted since the last push.
+func (r *Replicator) pushUpdates() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	cfgs, err := r.updates.GetAllUpdatedConfigs(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for len(cfgs) > 0 {
+		n := len(cfgs)
+		if n > replicationPageSize {
+			n = replicationPageSize
+		}
+		if err := r.pushConfigs(cfgs[:n]); err != nil {
+			return err
+		}
+		cfgs = cfgs[n:]
+	}
+	return nil
+}
+
+// resyncConfigs pushes all configs page by page, and then the users having
+// a config so that the standby deletes the configs of the others.
+func (r *Replicator) resyncConfigs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	rev, err := r.client.Revision(ctx)
+	cancel()
+	if err != nil {
+		return errors.Wrap(err, "failed to get revision")
+	}
+
+	prune := ReplicationPrune{UserIDs: []string{}, Revision: rev}
+	opts := ListConfigsOptions{Limit: replicationPageSize}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+		cfgs, next, err := r.client.ListConfigs(ctx, opts)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "failed to list configs")
+		}
+		if len(cfgs) > 0 {
+			if err := r.pushConfigs(cfgs); err != nil {
+				return err
+			}
+		}
+		for _, cfg := range cfgs {
+			prune.UserIDs = append(prune.UserIDs, cfg.UserID)
+		}
+		if next == "" {
+			break
+		}
+		opts.Continue = next
+	}
+
+	body, err := json.Marshal(prune)
+	if err != nil {
+		return err
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	res := newReplicationResult()
+	if err := r.post(ctx, "/api/v1/replication/configs/prune", "application/json", body, &res); err != nil {
+		replicationPushes.WithLabelValues("prune", "failure").Inc()
+		return err
+	}
+	replicationPushes.WithLabelValues("prune", "success").Inc()
+	replicationLastSuccess.SetToCurrentTime()
+	Must(level.Debug(r.logger).Log("msg", "pushed all configs to standby", "configs", len(prune.UserIDs), "pruned", len(res.Deleted)))
+	return nil
+}
+
+// pushConfigs pushes cfgs, of which the deleted ones are those sent by the
+// config watch for removed keys.
+func (r *Replicator) pushConfigs(cfgs []AlertmanagerConfig) error {
+	batch := make([]ReplicatedConfig, 0, len(cfgs))
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		rc := ReplicatedConfig{UserID: cfg.UserID, Revision: cfg.Revision}
+		if cfg.DeletedAtInUnix == 0 || cfg.Config != "" {
+			rc.Config = cfg
+		}
+		batch = append(batch, rc)
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	res := newReplicationResult()
+	if err := r.post(ctx, "/api/v1/replication/configs", "application/json", body, &res); err != nil {
+		replicationPushes.WithLabelValues("configs", "failure").Inc()
+		return err
+	}
+	replicationPushes.WithLabelValues("configs", "success").Inc()
+	replicationLastSuccess.SetToCurrentTime()
+
+	for _, c := range res.Conflicts {
+		replicationConflicts.Inc()
+		Must(level.Debug(r.logger).Log("msg", "standby has a config of a later revision, not replicated", "user", c.UserID, "revision", c.RemoteRevision, "standby_revision", c.LocalRevision))
+	}
+	Must(level.Debug(r.logger).Log("msg", "pushed configs to standby", "applied", len(res.Applied), "deleted", len(res.Deleted), "unchanged", len(res.Unchanged), "conflicts", len(res.Conflicts)))
+	return nil
+}
+
+// pushSilences pushes the silences of the running Alertmanagers updated
+// since they were last pushed.
+func (r *Replicator) pushSilences() {
+	r.am.alertmanagersMtx.Lock()
+	ams := make(map[string]*Alertmanager, len(r.am.alertmanagers))
+	for userID, userAM := range r.am.alertmanagers {
+		ams[userID] = userAM
+	}
+	r.am.alertmanagersMtx.Unlock()
+
+	for userID := range r.silencesPushed {
+		if _, ok := ams[userID]; !ok {
+			delete(r.silencesPushed, userID)
+		}
+	}
+	for userID, userAM := range ams {
+		data, err := userAM.silences.MarshalBinary()
+		if err == nil {
+			data, err = r.updatedSilences(userID, data)
+		}
+		if err != nil {
+			Must(level.Warn(r.logger).Log("msg", "failed to encode silences", "user", userID, "err", err))
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+		err = r.post(ctx, "/api/v1/replication/silences/"+url.PathEscape(userID), "application/octet-stream", data, nil)
+		cancel()
+		if err != nil {
+			replicationPushes.WithLabelValues("silences", "failure").Inc()
+			Must(level.Warn(r.logger).Log("msg", "failed to push silences to standby", "user", userID, "err", err))
+			delete(r.silencesPushed, userID)
+			continue
+		}
+		replicationPushes.WithLabelValues("silences", "success").Inc()
+	}
+}
+
+// updatedSilences returns the silences of the state of a user updated since
+// they were last pushed, nil if there are none, and records them as pushed.
+func (r *Replicator) updatedSilences(userID string, state []byte) ([]byte, error) {
+	sils, err := decodeSilences(state)
+	if err != nil {
+		return nil, err
+	}
+	pushed, latest := r.silencesPushed[userID], r.silencesPushed[userID]
+	var updated []*silencepb.MeshSilence
+	for _, s := range sils {
+		if s.Silence == nil || !s.Silence.UpdatedAt.After(pushed) {
+			continue
+		}
+		updated = append(updated, s)
+		if s.Silence.UpdatedAt.After(latest) {
+			latest = s.Silence.UpdatedAt
+		}
+	}
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	r.silencesPushed[userID] = latest
+	return encodeSilences(updated)
+}
+
+func (r *Replicator) post(ctx context.Context, path, contentType string, body []byte, result interface{}) error {
+	u := strings.TrimRight(r.cfg.StandbyURL, "/") + path
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+r.cfg.token)
+	resp, err := r.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %v: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package alertmanager
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// reportDefaultRange is the period summarized if since is not set, a
+	// week for the weekly noise reviews.
+	reportDefaultRange = 7 * 24 * time.Hour
+	// reportMaxGroups bounds the archived alert groups summarized, the
+	// report is marked truncated if there are more.
+	reportMaxGroups = 10000
+	// The default and the maximum number of alertnames ranked by the
+	// report.
+	reportDefaultTop = 10
+	reportMaxTop     = 100
+)
+
+var (
+	resolvedGroups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "resolved_alert_groups_total",
+		Help:      "The total number of resolved alert groups notified to a receiver.",
+	}, []string{"tenant"})
+	groupFiringDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "appscode",
+		Name:      "alert_group_firing_duration_seconds",
+		Help:      "Time the resolved alert groups notified to a receiver were firing, from the start of the first alert to the end of the last one.",
+		Buckets:   []float64{60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600, 3 * 24 * 3600, 7 * 24 * 3600},
+	}, []string{"tenant"})
+)
+
+func init() {
+	prometheus.MustRegister(resolvedGroups)
+	prometheus.MustRegister(groupFiringDuration)
+}
+
+// observeResolvedGroup records a resolved alert group of a user in the
+// report metrics.
+func observeResolvedGroup(userID string, g *ArchivedGroup) {
+	resolvedGroups.WithLabelValues(userID).Inc()
+	groupFiringDuration.WithLabelValues(userID).Observe(g.ResolvedAt.Sub(g.FiringAt).Seconds())
+}
+
+// ReportSummary summarizes the alerts of a user resolved over a period, to
+// review which alerts are noisy.
+type ReportSummary struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// Truncated is true if the period had more archived alert groups than
+	// were summarized, the oldest are left out.
+	Truncated bool `json:"truncated,omitempty"`
+	// Groups counts the resolved alert groups notified to each receiver,
+	// Alerts the distinct resolved alerts.
+	Groups int `json:"groups"`
+	Alerts int `json:"alerts"`
+	// MeanTimeFiring is the mean time the alerts fired before they
+	// resolved, in seconds. It is the mean time to resolve.
+	MeanTimeFiring float64 `json:"meanTimeFiringSeconds"`
+	// AlertsPerDay counts the alerts by the UTC day they resolved on.
+	AlertsPerDay []DailyAlerts `json:"alertsPerDay"`
+	// TopAlertnames are the alertnames with the most alerts.
+	TopAlertnames []AlertnameStats `json:"topAlertnames"`
+	// Notifications counts the recent notifications of the user, over the
+	// window of the notification stats rather than the period.
+	Notifications *NotificationStats `json:"notifications,omitempty"`
+}
+
+// DailyAlerts counts the alerts resolved on a day.
+type DailyAlerts struct {
+	Date   string `json:"date"`
+	Alerts int    `json:"alerts"`
+}
+
+// AlertnameStats summarizes the resolved alerts of an alertname.
+type AlertnameStats struct {
+	Alertname      string  `json:"alertname"`
+	Alerts         int     `json:"alerts"`
+	MeanTimeFiring float64 `json:"meanTimeFiringSeconds"`
+}
+
+// summarize aggregates the archived alert groups into a report, ranking the
+// top alertnames. An alert notified to several receivers is counted once.
+func summarize(groups []ArchivedGroup, top int) ReportSummary {
+	type alertKey struct {
+		fingerprint string
+		startsAt    int64
+	}
+	type nameStats struct {
+		alerts int
+		firing time.Duration
+	}
+	var (
+		rs      ReportSummary
+		seen    = map[alertKey]bool{}
+		days    = map[string]int{}
+		names   = map[string]*nameStats{}
+		firing  time.Duration
+		ordered []string
+	)
+	rs.Groups = len(groups)
+	for _, g := range groups {
+		for _, a := range g.Alerts {
+			k := alertKey{fingerprint: a.Fingerprint, startsAt: a.StartsAt.UnixNano()}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			rs.Alerts++
+			d := a.EndsAt.Sub(a.StartsAt)
+			firing += d
+			days[a.EndsAt.UTC().Format("2006-01-02")]++
+
+			name := string(a.Labels[model.AlertNameLabel])
+			ns, ok := names[name]
+			if !ok {
+				ns = &nameStats{}
+				names[name] = ns
+				ordered = append(ordered, name)
+			}
+			ns.alerts++
+			ns.firing += d
+		}
+	}
+	if rs.Alerts > 0 {
+		rs.MeanTimeFiring = (firing / time.Duration(rs.Alerts)).Seconds()
+	}
+
+	rs.AlertsPerDay = make([]DailyAlerts, 0, len(days))
+	for day, n := range days {
+		rs.AlertsPerDay = append(rs.AlertsPerDay, DailyAlerts{Date: day, Alerts: n})
+	}
+	sort.Slice(rs.AlertsPerDay, func(i, j int) bool { return rs.AlertsPerDay[i].Date < rs.AlertsPerDay[j].Date })
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if names[ordered[i]].alerts != names[ordered[j]].alerts {
+			return names[ordered[i]].alerts > names[ordered[j]].alerts
+		}
+		return ordered[i] < ordered[j]
+	})
+	if len(ordered) > top {
+		ordered = ordered[:top]
+	}
+	rs.TopAlertnames = make([]AlertnameStats, 0, len(ordered))
+	for _, name := range ordered {
+		ns := names[name]
+		rs.TopAlertnames = append(rs.TopAlertnames, AlertnameStats{
+			Alertname:      name,
+			Alerts:         ns.alerts,
+			MeanTimeFiring: (ns.firing / time.Duration(ns.alerts)).Seconds(),
+		})
+	}
+	return rs
+}
+
+// ReportSummary summarizes the archived alert groups of the user resolved
+// between since and until, which default to the last week, along with the
+// recent notification stats. The top parameter sets how many alertnames
+// are ranked.
+func (am *MultitenantAlertmanager) ReportSummary(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if am.archive == nil {
+		writeError(w, http.StatusNotFound, "the alert history is disabled")
+		return
+	}
+	// The notification stats are kept by the replica sending them.
+	if am.proxyToLeader(w, req) {
+		return
+	}
+
+	now := time.Now()
+	params := req.URL.Query()
+	q := HistoryQuery{Since: now.Add(-reportDefaultRange), Until: now, Limit: reportMaxGroups}
+	if s := params.Get("since"); s != "" {
+		if q.Since, err = parseHistoryTime(s, now); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+			return
+		}
+	}
+	if s := params.Get("until"); s != "" {
+		if q.Until, err = parseHistoryTime(s, now); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+			return
+		}
+	}
+	if !q.Since.Before(q.Until) {
+		writeError(w, http.StatusBadRequest, "since must be before until")
+		return
+	}
+	top := reportDefaultTop
+	if s := params.Get("top"); s != "" {
+		if top, err = strconv.Atoi(s); err != nil || top <= 0 {
+			writeError(w, http.StatusBadRequest, "top must be a positive integer")
+			return
+		}
+		if top > reportMaxTop {
+			top = reportMaxTop
+		}
+	}
+
+	groups, err := am.archive.ListArchivedAlertGroups(req.Context(), userID, q)
+	if err != nil {
+		Must(level.Error(logger2.WithUserID(userID, logger2.Logger)).Log("msg", "error summarizing alert history", "err", err))
+		storageError(w, err)
+		return
+	}
+	rs := summarize(groups, top)
+	rs.Since, rs.Until = q.Since, q.Until
+	rs.Truncated = len(groups) == reportMaxGroups
+
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	am.alertmanagersMtx.Unlock()
+	if ok {
+		stats := userAM.events.stats.snapshot(now)
+		rs.Notifications = &stats
+	}
+	writeJSON(w, http.StatusOK, rs)
+}
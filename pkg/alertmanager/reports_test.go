@@ -0,0 +1,42 @@
+package alertmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC)
+	alert := func(fp, name string, endsAt time.Time, firing time.Duration) ArchivedAlert {
+		return ArchivedAlert{
+			Fingerprint: fp,
+			Labels:      model.LabelSet{model.AlertNameLabel: model.LabelValue(name)},
+			StartsAt:    endsAt.Add(-firing),
+			EndsAt:      endsAt,
+		}
+	}
+	latency := alert("1", "HighLatency", day, time.Hour)
+	groups := []ArchivedGroup{
+		{Receiver: "team", Alerts: []ArchivedAlert{latency, alert("2", "HighLatency", day.Add(24*time.Hour), 3*time.Hour)}},
+		// The same alert notified to another receiver is counted once.
+		{Receiver: "oncall", Alerts: []ArchivedAlert{latency}},
+		{Receiver: "team", Alerts: []ArchivedAlert{alert("3", "DiskFull", day, 2*time.Hour)}},
+	}
+
+	rs := summarize(groups, 1)
+	if rs.Groups != 3 || rs.Alerts != 3 {
+		t.Fatalf("got %d groups and %d alerts, want 3 and 3", rs.Groups, rs.Alerts)
+	}
+	if rs.MeanTimeFiring != (2 * time.Hour).Seconds() {
+		t.Errorf("mean time firing is %vs, want 2h", rs.MeanTimeFiring)
+	}
+	if len(rs.AlertsPerDay) != 2 || rs.AlertsPerDay[0] != (DailyAlerts{Date: "2019-05-06", Alerts: 2}) || rs.AlertsPerDay[1] != (DailyAlerts{Date: "2019-05-07", Alerts: 1}) {
+		t.Errorf("unexpected alerts per day: %+v", rs.AlertsPerDay)
+	}
+	want := AlertnameStats{Alertname: "HighLatency", Alerts: 2, MeanTimeFiring: (2 * time.Hour).Seconds()}
+	if len(rs.TopAlertnames) != 1 || rs.TopAlertnames[0] != want {
+		t.Errorf("unexpected top alertnames: %+v", rs.TopAlertnames)
+	}
+}
@@ -0,0 +1,295 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+var errConfigNotFound = errors.New("config not found")
+
+// RetentionOverrides override the retention of the state of the
+// Alertmanager of a user, as durations like 120h. Unset durations default to
+// the flags.
+type RetentionOverrides struct {
+	Silences        string `json:"silences,omitempty" yaml:"silences,omitempty"`
+	NotificationLog string `json:"notificationLog,omitempty" yaml:"notificationLog,omitempty"`
+	AlertGCInterval string `json:"alertGCInterval,omitempty" yaml:"alertGCInterval,omitempty"`
+}
+
+// Retention is how long the silences and the notification log of an
+// Alertmanager are kept, and how often its resolved alerts are removed.
+type Retention struct {
+	Silences        time.Duration
+	NotificationLog time.Duration
+	AlertGCInterval time.Duration
+}
+
+// RetentionStatus is the retention of a user as set and as applied.
+type RetentionStatus struct {
+	Overrides RetentionOverrides `json:"overrides"`
+	Effective RetentionOverrides `json:"effective"`
+}
+
+// RetentionLimits checks the retention overrides set by users, and resolves
+// them.
+type RetentionLimits interface {
+	// CheckRetention returns an error if o is outside of the bounds users
+	// may set.
+	CheckRetention(o *RetentionOverrides) error
+	// Retention returns the retention applied for o, which may be nil.
+	Retention(o *RetentionOverrides) Retention
+}
+
+func (o *RetentionOverrides) fields() []struct {
+	name, value string
+} {
+	return []struct{ name, value string }{
+		{"silences", o.Silences},
+		{"notificationLog", o.NotificationLog},
+		{"alertGCInterval", o.AlertGCInterval},
+	}
+}
+
+func (o *RetentionOverrides) empty() bool {
+	return o == nil || *o == RetentionOverrides{}
+}
+
+// validate checks that the durations of o are valid and positive.
+func (o *RetentionOverrides) validate() error {
+	for _, f := range o.fields() {
+		if f.value == "" {
+			continue
+		}
+		d, err := model.ParseDuration(f.value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", f.name)
+		}
+		if d <= 0 {
+			return errors.Errorf("%s must be positive", f.name)
+		}
+	}
+	return nil
+}
+
+// duration returns the duration of s, or def if it is not set or invalid.
+func duration(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+func (r Retention) overrides() RetentionOverrides {
+	return RetentionOverrides{
+		Silences:        model.Duration(r.Silences).String(),
+		NotificationLog: model.Duration(r.NotificationLog).String(),
+		AlertGCInterval: model.Duration(r.AlertGCInterval).String(),
+	}
+}
+
+// Retention implements RetentionLimits.
+func (am *MultitenantAlertmanager) Retention(o *RetentionOverrides) Retention {
+	r := Retention{
+		Silences:        am.cfg.Retention,
+		NotificationLog: am.cfg.Retention,
+		AlertGCInterval: am.cfg.AlertGCInterval,
+	}
+	if o != nil {
+		r.Silences = duration(o.Silences, r.Silences)
+		r.NotificationLog = duration(o.NotificationLog, r.NotificationLog)
+		r.AlertGCInterval = duration(o.AlertGCInterval, r.AlertGCInterval)
+	}
+	return r
+}
+
+// CheckRetention implements RetentionLimits.
+func (am *MultitenantAlertmanager) CheckRetention(o *RetentionOverrides) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	r := am.Retention(o)
+	for _, b := range []struct {
+		name     string
+		set      bool
+		d        time.Duration
+		min, max time.Duration
+	}{
+		{"silences", o.Silences != "", r.Silences, am.cfg.MinRetention, am.cfg.MaxRetention},
+		{"notificationLog", o.NotificationLog != "", r.NotificationLog, am.cfg.MinRetention, am.cfg.MaxRetention},
+		{"alertGCInterval", o.AlertGCInterval != "", r.AlertGCInterval, am.cfg.MinAlertGCInterval, am.cfg.MaxAlertGCInterval},
+	} {
+		if !b.set {
+			continue
+		}
+		if b.d < b.min {
+			return errors.Errorf("%s must be at least %s", b.name, model.Duration(b.min))
+		}
+		if b.max > 0 && b.d > b.max {
+			return errors.Errorf("%s must be at most %s", b.name, model.Duration(b.max))
+		}
+	}
+	return nil
+}
+
+// userRetention returns the retention applied for the stored config of a
+// user.
+func (am *MultitenantAlertmanager) userRetention(userID string) Retention {
+	am.cfgMutex.RLock()
+	cfg := am.cfgs[userID]
+	am.cfgMutex.RUnlock()
+	return am.Retention(cfg.Retention)
+}
+
+// rebuildAlertmanager replaces the Alertmanager of a user by one with a new
+// retention. The silences and the notification log are restored from the
+// snapshots written when the previous one is stopped, and its alerts are
+// carried over. Must be called with the lock of the user held.
+func (am *MultitenantAlertmanager) rebuildAlertmanager(ctx context.Context, existing *Alertmanager, cfg *AlertmanagerConfig, amConfig *notify.Config) (*Alertmanager, error) {
+	it := existing.alerts.GetPending()
+	var alerts []*types.Alert
+	for a := range it.Next() {
+		alerts = append(alerts, a)
+	}
+	it.Close()
+
+	am.alertmanagersMtx.Lock()
+	delete(am.alertmanagers, cfg.UserID)
+	am.alertmanagersMtx.Unlock()
+	existing.Stop()
+
+	newAM, err := am.newAlertmanager(ctx, cfg, amConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := newAM.alerts.Put(alerts...); err != nil {
+		Must(level.Warn(logger2.Logger).Log("msg", "MultitenantAlertmanager: failed to carry over alerts", "user", cfg.UserID, "err", err))
+	}
+	am.alertmanagersMtx.Lock()
+	am.alertmanagers[cfg.UserID] = newAM
+	am.alertmanagersMtx.Unlock()
+	return newAM, nil
+}
+
+// storeRetention replaces the retention overrides of the stored config of a
+// user.
+func storeRetention(ctx context.Context, c AlertmanagerClient, userID string, o *RetentionOverrides) error {
+	return c.UpdateConfig(ctx, userID, func(cfg *AlertmanagerConfig) error {
+		if cfg.UserID == "" {
+			return errConfigNotFound
+		}
+		cfg.Retention = nil
+		if !o.empty() {
+			cfg.Retention = o
+		}
+		cfg.UpdatedAtInUnix = time.Now().Unix()
+		return nil
+	})
+}
+
+func decodeRetention(r *http.Request) (*RetentionOverrides, error) {
+	var o RetentionOverrides
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// getRetention returns the retention overrides of the user, and the
+// retention applied.
+func (a *API) getRetention(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger2.WithUserID(userID, logger2.Logger)).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	if cfg.UserID == "" {
+		writeError(w, http.StatusNotFound, errConfigNotFound.Error())
+		return
+	}
+	st := RetentionStatus{Effective: a.retention.Retention(cfg.Retention).overrides()}
+	if cfg.Retention != nil {
+		st.Overrides = *cfg.Retention
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// setRetention replaces the retention overrides of the user, within the
+// bounds set by the operators. They are applied with the config.
+func (a *API) setRetention(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	o, err := decodeRetention(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.retention.CheckRetention(o); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid retention: %v", err))
+		return
+	}
+	err = storeRetention(r.Context(), a.client, userID, o)
+	if err == errConfigNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error storing config", "err", err))
+		storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setTenantRetention replaces the retention overrides of a tenant. Unlike
+// the overrides set by the tenants, they are not checked against the bounds.
+func (a *AdminAPI) setTenantRetention(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	o, err := decodeRetention(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := o.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = storeRetention(r.Context(), a.client, userID, o)
+	if err == errConfigNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error storing tenant retention", "user", userID, "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Must(level.Info(logger2.Logger).Log("msg", "tenant retention updated", "user", userID))
+	w.WriteHeader(http.StatusNoContent)
+}
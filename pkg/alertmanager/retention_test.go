@@ -0,0 +1,45 @@
+package alertmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckRetention(t *testing.T) {
+	am := &MultitenantAlertmanager{cfg: &MultitenantAlertmanagerConfig{
+		Retention:          120 * time.Hour,
+		AlertGCInterval:    30 * time.Minute,
+		MinRetention:       time.Hour,
+		MaxRetention:       720 * time.Hour,
+		MinAlertGCInterval: time.Minute,
+	}}
+
+	for _, tc := range []struct {
+		o     RetentionOverrides
+		valid bool
+	}{
+		{RetentionOverrides{}, true},
+		{RetentionOverrides{Silences: "240h", NotificationLog: "1h"}, true},
+		{RetentionOverrides{AlertGCInterval: "24h"}, true},
+		{RetentionOverrides{Silences: "30m"}, false},
+		{RetentionOverrides{NotificationLog: "721h"}, false},
+		{RetentionOverrides{AlertGCInterval: "30s"}, false},
+		{RetentionOverrides{Silences: "0s"}, false},
+		{RetentionOverrides{Silences: "forever"}, false},
+	} {
+		err := am.CheckRetention(&tc.o)
+		if tc.valid && err != nil {
+			t.Errorf("%+v: unexpected error: %v", tc.o, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%+v: expected an error", tc.o)
+		}
+	}
+
+	// Unset overrides default to the flags.
+	r := am.Retention(&RetentionOverrides{Silences: "240h"})
+	want := Retention{Silences: 240 * time.Hour, NotificationLog: 120 * time.Hour, AlertGCInterval: 30 * time.Minute}
+	if r != want {
+		t.Fatalf("got %+v, want %+v", r, want)
+	}
+}
@@ -0,0 +1,180 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/common/model"
+)
+
+// RouteTestRequest holds the label sets to route. If Config is empty, the
+// stored config of the user is used.
+type RouteTestRequest struct {
+	Config string           `json:"config,omitempty"`
+	Alerts []model.LabelSet `json:"alerts"`
+}
+
+// RouteTestResult lists the routes matched by a label set.
+type RouteTestResult struct {
+	Labels model.LabelSet `json:"labels"`
+	Routes []RouteMatch   `json:"routes"`
+}
+
+// RouteMatch describes a matched route and how alerts are grouped on it.
+type RouteMatch struct {
+	Receiver       string         `json:"receiver"`
+	RouteKey       string         `json:"routeKey"`
+	Matchers       []string       `json:"matchers,omitempty"`
+	Continue       bool           `json:"continue"`
+	GroupBy        []string       `json:"groupBy"`
+	GroupByAll     bool           `json:"groupByAll,omitempty"`
+	GroupLabels    model.LabelSet `json:"groupLabels"`
+	GroupWait      model.Duration `json:"groupWait"`
+	GroupInterval  model.Duration `json:"groupInterval"`
+	RepeatInterval model.Duration `json:"repeatInterval"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. The durations are
+// formatted the same way as in the config.
+func (m RouteMatch) MarshalJSON() ([]byte, error) {
+	type plain RouteMatch
+	return json.Marshal(struct {
+		plain
+		GroupWait      string `json:"groupWait"`
+		GroupInterval  string `json:"groupInterval"`
+		RepeatInterval string `json:"repeatInterval"`
+	}{
+		plain:          plain(m),
+		GroupWait:      m.GroupWait.String(),
+		GroupInterval:  m.GroupInterval.String(),
+		RepeatInterval: m.RepeatInterval.String(),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *RouteMatch) UnmarshalJSON(data []byte) error {
+	type plain RouteMatch
+	v := struct {
+		*plain
+		GroupWait      string `json:"groupWait"`
+		GroupInterval  string `json:"groupInterval"`
+		RepeatInterval string `json:"repeatInterval"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	for _, d := range []struct {
+		s string
+		d *model.Duration
+	}{
+		{v.GroupWait, &m.GroupWait},
+		{v.GroupInterval, &m.GroupInterval},
+		{v.RepeatInterval, &m.RepeatInterval},
+	} {
+		var err error
+		if *d.d, err = model.ParseDuration(d.s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupLabels returns the labels of lset an alert is grouped by on route r.
+func groupLabels(r *dispatch.Route, lset model.LabelSet) model.LabelSet {
+	labels := model.LabelSet{}
+	for ln, lv := range lset {
+		if _, ok := r.RouteOpts.GroupBy[ln]; ok || r.RouteOpts.GroupByAll {
+			labels[ln] = lv
+		}
+	}
+	return labels
+}
+
+// testRoutes matches each label set against the routing tree of conf.
+func testRoutes(conf *notify.Config, alerts []model.LabelSet) []RouteTestResult {
+	root := dispatch.NewRoute(conf.Route, nil)
+
+	results := make([]RouteTestResult, 0, len(alerts))
+	for _, lset := range alerts {
+		res := RouteTestResult{Labels: lset, Routes: []RouteMatch{}}
+		for _, r := range root.Match(lset) {
+			m := RouteMatch{
+				Receiver:       r.RouteOpts.Receiver,
+				RouteKey:       r.Key(),
+				Continue:       r.Continue,
+				GroupBy:        []string{},
+				GroupByAll:     r.RouteOpts.GroupByAll,
+				GroupLabels:    groupLabels(r, lset),
+				GroupWait:      model.Duration(r.RouteOpts.GroupWait),
+				GroupInterval:  model.Duration(r.RouteOpts.GroupInterval),
+				RepeatInterval: model.Duration(r.RouteOpts.RepeatInterval),
+			}
+			for _, matcher := range r.Matchers {
+				m.Matchers = append(m.Matchers, matcher.String())
+			}
+			for ln := range r.RouteOpts.GroupBy {
+				m.GroupBy = append(m.GroupBy, string(ln))
+			}
+			sort.Strings(m.GroupBy)
+			res.Routes = append(res.Routes, m)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// routeTest returns the routes, receivers and grouping each of the given
+// label sets would get with the user's config, or the config of the request.
+func (a *API) routeTest(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	var req RouteTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding json body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Alerts) == 0 {
+		writeError(w, http.StatusBadRequest, "no alerts to route")
+		return
+	}
+	for _, lset := range req.Alerts {
+		if len(lset) == 0 {
+			writeError(w, http.StatusBadRequest, "alert has no labels")
+			return
+		}
+		if err := lset.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.Config == "" {
+		cfg, err := a.client.GetConfig(r.Context(), userID)
+		if err != nil {
+			Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+			storageError(w, err)
+			return
+		}
+		req.Config = cfg.Config
+	}
+	conf, err := notify.LoadConfig(secrets.Mask(req.Config))
+	if err != nil {
+		configError(w, req.Config, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, testRoutes(conf, req.Alerts))
+}
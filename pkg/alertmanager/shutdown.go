@@ -0,0 +1,131 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// drainPollInterval is how often draining checks for in-flight
+// notifications.
+const drainPollInterval = 100 * time.Millisecond
+
+// inflightStage counts the notifications of a receiver being sent.
+type inflightStage struct {
+	amnotify.Stage
+	inflight *int64
+}
+
+func (s *inflightStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	atomic.AddInt64(s.inflight, 1)
+	defer atomic.AddInt64(s.inflight, -1)
+	return s.Stage.Exec(ctx, l, alerts...)
+}
+
+// countInflight makes the routing stage count its in-flight notifications
+// in inflight.
+func countInflight(rs amnotify.RoutingStage, inflight *int64) {
+	for name, s := range rs {
+		rs[name] = &inflightStage{Stage: s, inflight: inflight}
+	}
+}
+
+// inflightNotifications returns the number of notifications of the
+// Alertmanager being sent.
+func (am *Alertmanager) inflightNotifications() int64 {
+	return atomic.LoadInt64(&am.inflight)
+}
+
+// Drain prepares the MultitenantAlertmanager for shutdown: new alerts are
+// rejected, the alert groups still waiting for their group_wait are
+// notified, and it waits until the in-flight notifications are sent or ctx
+// is done. The Alertmanagers keep running until Stop, which snapshots their
+// state.
+func (am *MultitenantAlertmanager) Drain(ctx context.Context) {
+	atomic.StoreInt32(&am.draining, 1)
+	Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: draining, new alerts are rejected"))
+
+	if am.IsLeader() {
+		am.flushPending(ctx)
+	}
+
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+	for {
+		n := am.inflightNotifications()
+		if n == 0 {
+			Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: drained"))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: drain timed out, cancelling notifications", "inflight", n))
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// flushPending notifies the alert groups of all Alertmanagers now, instead of
+// after their group_wait or group_interval, which would be cut short by the
+// shutdown.
+func (am *MultitenantAlertmanager) flushPending(ctx context.Context) {
+	am.alertmanagersMtx.Lock()
+	ams := make([]*Alertmanager, 0, len(am.alertmanagers))
+	for _, userAM := range am.alertmanagers {
+		ams = append(ams, userAM)
+	}
+	am.alertmanagersMtx.Unlock()
+
+	var wg sync.WaitGroup
+	for _, userAM := range ams {
+		wg.Add(1)
+		go func(userAM *Alertmanager) {
+			defer wg.Done()
+			userAM.getPipeline().flush(ctx, userAM.logger)
+		}(userAM)
+	}
+	wg.Wait()
+	Must(level.Info(logger.Logger).Log("msg", "MultitenantAlertmanager: flushed pending alert groups", "users", len(ams)))
+}
+
+// CloseStreams ends the notification streams, which would otherwise keep
+// the API server from shutting down.
+func (am *MultitenantAlertmanager) CloseStreams() {
+	am.streamsStopOnce.Do(func() {
+		close(am.streamsStop)
+	})
+}
+
+// inflightNotifications returns the number of notifications being sent by
+// all Alertmanagers.
+func (am *MultitenantAlertmanager) inflightNotifications() int64 {
+	am.alertmanagersMtx.Lock()
+	defer am.alertmanagersMtx.Unlock()
+	var n int64
+	for _, userAM := range am.alertmanagers {
+		n += userAM.inflightNotifications()
+	}
+	return n
+}
+
+// rejectDraining rejects the alerts posted while draining. It returns true
+// if the request was rejected.
+func (am *MultitenantAlertmanager) rejectDraining(w http.ResponseWriter, req *http.Request) bool {
+	if atomic.LoadInt32(&am.draining) == 0 || req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/alerts") {
+		return false
+	}
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "alertmanager is shutting down", http.StatusServiceUnavailable)
+	return true
+}
@@ -0,0 +1,234 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// maxImportedSilences bounds the silences of an import request.
+const maxImportedSilences = 10000
+
+const (
+	silenceSkippedExpired   = "expired"
+	silenceSkippedDuplicate = "duplicate"
+)
+
+// SilenceExport holds the silences of a user, to be imported into the
+// Alertmanager of the user on another cluster.
+type SilenceExport struct {
+	UserID     string            `json:"userID,omitempty"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Silences   []ExportedSilence `json:"silences"`
+}
+
+// ExportedSilence is a silence with its ID in the exporting Alertmanager.
+type ExportedSilence struct {
+	ID string `json:"id,omitempty"`
+	JobSilence
+}
+
+// SilenceImportResult maps the IDs of the imported silences to their new
+// IDs, and lists the silences which were not imported.
+type SilenceImportResult struct {
+	Imported map[string]string `json:"imported"`
+	Skipped  []SkippedSilence  `json:"skipped,omitempty"`
+}
+
+// SkippedSilence is a silence which was not imported, because it expired or
+// an equal silence exists.
+type SkippedSilence struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func exportSilence(sil *silencepb.Silence) ExportedSilence {
+	s := ExportedSilence{
+		ID: sil.Id,
+		JobSilence: JobSilence{
+			StartsAt:  sil.StartsAt,
+			EndsAt:    sil.EndsAt,
+			CreatedBy: sil.CreatedBy,
+			Comment:   sil.Comment,
+		},
+	}
+	for _, m := range sil.Matchers {
+		s.Matchers = append(s.Matchers, JobSilenceMatcher{
+			Name:    m.Name,
+			Value:   m.Pattern,
+			IsRegex: m.Type == silencepb.Matcher_REGEXP,
+		})
+	}
+	return s
+}
+
+// silenceKey identifies the silences which silence the same alerts until
+// the same time for the same reason, so that importing silences twice does
+// not duplicate them. The start is left out, as imported silences start no
+// earlier than they are imported.
+func silenceKey(sil *silencepb.Silence) string {
+	return fmt.Sprintf("%s|%d|%q|%q", matchersKey(sil.Matchers), sil.EndsAt.UnixNano(), sil.CreatedBy, sil.Comment)
+}
+
+// matchersKey identifies the matchers of a silence regardless of their
+// order.
+func matchersKey(ms []*silencepb.Matcher) string {
+	matchers := make([]string, 0, len(ms))
+	for _, m := range ms {
+		matchers = append(matchers, fmt.Sprintf("%s%d%q", m.Name, m.Type, m.Pattern))
+	}
+	sort.Strings(matchers)
+	return strings.Join(matchers, ",")
+}
+
+// validateSilenceMatchers checks the matchers of a silence as the
+// Alertmanager does when it is set, so that invalid silences are rejected
+// before any silence is imported.
+func validateSilenceMatchers(sil *silencepb.Silence) error {
+	for _, m := range sil.Matchers {
+		if !model.LabelName(m.Name).IsValid() {
+			return fmt.Errorf("invalid label name %q", m.Name)
+		}
+		if m.Type == silencepb.Matcher_REGEXP {
+			if _, err := regexp.Compile("^(?:" + m.Pattern + ")$"); err != nil {
+				return fmt.Errorf("invalid regular expression %q: %v", m.Pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// importSilences creates the unexpired silences of sils, which have been
+// validated, with new IDs. Silences equal to an unexpired silence of the
+// Alertmanager are skipped.
+func importSilences(silences *silence.Silences, sils []ExportedSilence, protos []*silencepb.Silence, now time.Time) (*SilenceImportResult, error) {
+	existing, _, err := silences.Query(silence.QState(types.SilenceStateActive, types.SilenceStatePending))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(existing))
+	for _, sil := range existing {
+		keys[silenceKey(sil)] = true
+	}
+
+	res := &SilenceImportResult{Imported: map[string]string{}}
+	for i, sil := range protos {
+		if !sil.EndsAt.After(now) {
+			res.Skipped = append(res.Skipped, SkippedSilence{ID: sils[i].ID, Reason: silenceSkippedExpired})
+			continue
+		}
+		key := silenceKey(sil)
+		if keys[key] {
+			res.Skipped = append(res.Skipped, SkippedSilence{ID: sils[i].ID, Reason: silenceSkippedDuplicate})
+			continue
+		}
+		id, err := silences.Set(sil)
+		if err != nil {
+			return nil, fmt.Errorf("silence %d: %v", i, err)
+		}
+		keys[key] = true
+		res.Imported[sils[i].ID] = id
+	}
+	return res, nil
+}
+
+// ExportSilences returns the active and pending silences of the user, and
+// the expired ones if ?expired=true.
+func (am *MultitenantAlertmanager) ExportSilences(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	states := []types.SilenceState{types.SilenceStateActive, types.SilenceStatePending}
+	if req.URL.Query().Get("expired") == "true" {
+		states = append(states, types.SilenceStateExpired)
+	}
+	sils, _, err := userAM.silences.Query(silence.QState(states...))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.Slice(sils, func(i, j int) bool { return sils[i].StartsAt.Before(sils[j].StartsAt) })
+
+	export := SilenceExport{UserID: userID, ExportedAt: time.Now().UTC(), Silences: []ExportedSilence{}}
+	for _, sil := range sils {
+		export.Silences = append(export.Silences, exportSilence(sil))
+	}
+	writeJSON(w, http.StatusOK, export)
+}
+
+// ImportSilences creates the silences of an export in the Alertmanager of
+// the user. The silences get new IDs, the expired ones are skipped. An
+// invalid silence rejects the whole import.
+func (am *MultitenantAlertmanager) ImportSilences(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	var export SilenceExport
+	if err := json.NewDecoder(req.Body).Decode(&export); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(export.Silences) > maxImportedSilences {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d silences can be imported at once", maxImportedSilences))
+		return
+	}
+	protos := make([]*silencepb.Silence, 0, len(export.Silences))
+	for i := range export.Silences {
+		sil, err := export.Silences[i].toProto()
+		if err == nil {
+			err = validateSilenceMatchers(sil)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("silence %d: %v", i, err))
+			return
+		}
+		protos = append(protos, sil)
+	}
+
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res, err := importSilences(userAM.silences, export.Silences, protos, time.Now())
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error importing silences", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	Must(level.Info(logger).Log("msg", "silences imported", "from", export.UserID, "imported", len(res.Imported), "skipped", len(res.Skipped)))
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,80 @@
+package alertmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+)
+
+func TestImportSilences(t *testing.T) {
+	silences, err := silence.New(silence.Options{Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	exported := []ExportedSilence{
+		{ID: "a", JobSilence: JobSilence{
+			Matchers: []JobSilenceMatcher{{Name: "alertname", Value: "HighLatency"}},
+			StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), CreatedBy: "ops", Comment: "deploy",
+		}},
+		{ID: "b", JobSilence: JobSilence{
+			Matchers: []JobSilenceMatcher{{Name: "instance", Value: "db-.*", IsRegex: true}},
+			StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour), CreatedBy: "ops", Comment: "over",
+		}},
+	}
+	protos := func() []*silencepb.Silence {
+		var res []*silencepb.Silence
+		for i := range exported {
+			sil, err := exported[i].toProto()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateSilenceMatchers(sil); err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, sil)
+		}
+		return res
+	}
+
+	res, err := importSilences(silences, exported, protos(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := res.Imported["a"]
+	if !ok || id == "a" || len(res.Imported) != 1 {
+		t.Fatalf("expected silence a to be imported with a new ID, got %v", res.Imported)
+	}
+	if len(res.Skipped) != 1 || res.Skipped[0] != (SkippedSilence{ID: "b", Reason: silenceSkippedExpired}) {
+		t.Fatalf("expected expired silence b to be skipped, got %v", res.Skipped)
+	}
+	sil, err := silences.QueryOne(silence.QIDs(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exportSilence(sil); got.EndsAt.Unix() != exported[0].EndsAt.Unix() || got.Matchers[0] != exported[0].Matchers[0] || got.Comment != "deploy" {
+		t.Fatalf("unexpected imported silence %+v", got)
+	}
+
+	// Importing again does not duplicate the silences.
+	res, err = importSilences(silences, exported, protos(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Imported) != 0 || len(res.Skipped) != 2 || res.Skipped[0].Reason != silenceSkippedDuplicate {
+		t.Fatalf("expected silences to be skipped on the second import, got %+v", res)
+	}
+}
+
+func TestValidateSilenceMatchers(t *testing.T) {
+	for _, m := range []*silencepb.Matcher{
+		{Type: silencepb.Matcher_EQUAL, Name: "0name", Pattern: "a"},
+		{Type: silencepb.Matcher_REGEXP, Name: "name", Pattern: "a("},
+	} {
+		if err := validateSilenceMatchers(&silencepb.Silence{Matchers: []*silencepb.Matcher{m}}); err == nil {
+			t.Fatalf("expected an error for matcher %v", m)
+		}
+	}
+}
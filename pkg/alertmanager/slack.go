@@ -0,0 +1,141 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/common/model"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+const (
+	// maxSlackInteractionSize is the size of the callbacks of Slack which
+	// is read.
+	maxSlackInteractionSize = 1 << 20
+	// slackResponseTimeout is how long a response to an interaction may
+	// take.
+	slackResponseTimeout = 10 * time.Second
+)
+
+// SlackInteraction handles the callbacks of Slack for the interactive
+// buttons of the messages of the Slack notifier, which silence or
+// acknowledge the alert group of the message. Slack can not authenticate
+// as a user, so the user is named in the path and the callbacks are
+// verified with the signing secret of the slack_interactions of the config
+// of the user.
+func (am *MultitenantAlertmanager) SlackInteraction(w http.ResponseWriter, req *http.Request) {
+	userID := mux.Vars(req)["user"]
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxSlackInteractionSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	p := userAM.getPipeline()
+	if p == nil || p.conf.SlackInteractions == nil {
+		writeError(w, http.StatusNotFound, "slack interactions are not configured")
+		return
+	}
+	if err := notify.VerifySlackRequest(string(p.conf.SlackInteractions.SigningSecret), req.Header, body, time.Now()); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	interaction, err := notify.ParseSlackInteraction(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, a := range interaction.Actions {
+		text, err := am.slackAction(userID, userAM, interaction.User, a)
+		if err != nil {
+			Must(level.Warn(userAM.logger).Log("msg", "Failed to handle slack action", "action", a.Action, "err", err))
+			text = fmt.Sprintf("Failed to %s the alert group: %v", a.Action, err)
+		}
+		if interaction.ResponseURL == "" {
+			continue
+		}
+		go func(text string) {
+			ctx, cancel := context.WithTimeout(notify.WithTenantID(context.Background(), userID), slackResponseTimeout)
+			defer cancel()
+			if err := notify.RespondSlack(ctx, interaction.ResponseURL, text); err != nil {
+				Must(level.Warn(userAM.logger).Log("msg", "Failed to respond to slack interaction", "err", err))
+			}
+		}(text)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// slackAction applies an action of a Slack user, returning the text of the
+// response shown to the user.
+func (am *MultitenantAlertmanager) slackAction(userID string, userAM *Alertmanager, user string, a notify.SlackAction) (string, error) {
+	switch a.Action {
+	case notify.SlackActionSilence:
+		d := a.Duration
+		if d <= 0 {
+			d = time.Duration(notify.DefaultSlackSilenceDuration)
+		}
+		sil, err := groupSilence(a.GroupLabels, d, "slack:"+user, "Silenced from Slack")
+		if err != nil {
+			return "", err
+		}
+		id, err := am.CreateSilence(userID, sil)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Silenced %s for %s by %s (silence %s).", a.GroupLabels, model.Duration(d), user, id), nil
+	case notify.SlackActionAck:
+		if err := userAM.Acknowledge(a.Receiver, a.GroupKey); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Acknowledged by %s, the alert group is not escalated further.", user), nil
+	}
+	return "", fmt.Errorf("unknown action %q", a.Action)
+}
+
+// groupSilence returns a silence of the alert group with the labels,
+// starting now.
+func groupSilence(lset model.LabelSet, d time.Duration, createdBy, comment string) (*silencepb.Silence, error) {
+	if len(lset) == 0 {
+		return nil, fmt.Errorf("the alert group has no labels to silence")
+	}
+	now := time.Now()
+	sil := &silencepb.Silence{
+		StartsAt:  now,
+		EndsAt:    now.Add(d),
+		CreatedBy: createdBy,
+		Comment:   comment,
+	}
+	names := make([]string, 0, len(lset))
+	for ln := range lset {
+		names = append(names, string(ln))
+	}
+	sort.Strings(names)
+	for _, ln := range names {
+		sil.Matchers = append(sil.Matchers, &silencepb.Matcher{
+			Type:    silencepb.Matcher_EQUAL,
+			Name:    ln,
+			Pattern: string(lset[model.LabelName(ln)]),
+		})
+	}
+	return sil, nil
+}
@@ -0,0 +1,203 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	silencesStateKey = "silences"
+	nflogStateKey    = "nflog"
+
+	stateRequestTimeout = time.Minute
+
+	// Failed restores are retried with a backoff doubling from
+	// stateRestoreMinBackoff up to stateRestoreMaxBackoff.
+	stateRestoreMinBackoff = 10 * time.Second
+	stateRestoreMaxBackoff = 5 * time.Minute
+)
+
+var (
+	statePersistFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_state_persist_failures_total",
+		Help:      "Number of failed uploads of alertmanager state to object storage.",
+	}, []string{"state"})
+	stateRestores = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_state_restores_total",
+		Help:      "Number of alertmanager state snapshots restored from object storage.",
+	}, []string{"state"})
+	stateRestoreFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alertmanager_state_restore_failures_total",
+		Help:      "Number of failed downloads of alertmanager state from object storage.",
+	}, []string{"state"})
+)
+
+func init() {
+	prometheus.MustRegister(statePersistFailures, stateRestores, stateRestoreFailures)
+}
+
+// statePersister periodically uploads the silences and notification log
+// snapshots of a user to object storage, so that they survive the loss of
+// the local data directory.
+//
+// The state which could not be restored when the Alertmanager was created is
+// restored in the background, and merged into the running state. It is not
+// uploaded until then, so that the snapshot in object storage is not
+// overwritten by an empty state.
+type statePersister struct {
+	bucket   objstore.Bucket
+	userID   string
+	silences *silence.Silences
+	nflog    *nflog.Log
+	logger   log.Logger
+
+	// pending are the keys of the state not restored yet.
+	pending map[string]bool
+}
+
+// restoreState downloads the snapshot stored under key into file, unless
+// file already exists on the local disk.
+func restoreState(bucket objstore.Bucket, userID, key, file string) error {
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateRequestTimeout)
+	defer cancel()
+
+	r, err := bucket.Get(ctx, path.Join(userID, key))
+	if err == objstore.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to download %s snapshot", key)
+	}
+	defer r.Close()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s snapshot file", key)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(file)
+		return errors.Wrapf(err, "failed to write %s snapshot file", key)
+	}
+	stateRestores.WithLabelValues(key).Inc()
+	return f.Close()
+}
+
+// Run uploads the state every interval until stopc is closed, and retries
+// the pending restores meanwhile. A final upload is made before returning.
+func (p *statePersister) Run(interval time.Duration, stopc <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	backoff := stateRestoreMinBackoff
+	var retry <-chan time.Time
+	if len(p.pending) > 0 {
+		retry = time.After(backoff)
+	}
+
+	for {
+		select {
+		case <-retry:
+			p.restorePending()
+			retry = nil
+			if len(p.pending) > 0 {
+				if backoff *= 2; backoff > stateRestoreMaxBackoff {
+					backoff = stateRestoreMaxBackoff
+				}
+				retry = time.After(backoff)
+			}
+		case <-t.C:
+			p.persist()
+		case <-stopc:
+			p.persist()
+			return
+		}
+	}
+}
+
+// restorePending downloads the pending state and merges it into the
+// running state.
+func (p *statePersister) restorePending() {
+	for key := range p.pending {
+		if err := p.restore(key); err != nil {
+			stateRestoreFailures.WithLabelValues(key).Inc()
+			Must(level.Warn(p.logger).Log("msg", "failed to restore state", "state", key, "err", err))
+			continue
+		}
+		delete(p.pending, key)
+		Must(level.Info(p.logger).Log("msg", "restored state", "state", key))
+	}
+}
+
+func (p *statePersister) restore(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), stateRequestTimeout)
+	defer cancel()
+
+	r, err := p.bucket.Get(ctx, path.Join(p.userID, key))
+	if err == objstore.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to download %s snapshot", key)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s snapshot", key)
+	}
+
+	merge := p.silences.Merge
+	if key == nflogStateKey {
+		merge = p.nflog.Merge
+	}
+	if err := merge(data); err != nil {
+		return errors.Wrapf(err, "failed to merge %s snapshot", key)
+	}
+	stateRestores.WithLabelValues(key).Inc()
+	return nil
+}
+
+func (p *statePersister) persist() {
+	for key, snapshot := range map[string]func(io.Writer) (int64, error){
+		silencesStateKey: p.silences.Snapshot,
+		nflogStateKey:    p.nflog.Snapshot,
+	} {
+		if p.pending[key] {
+			continue
+		}
+		if err := p.upload(key, snapshot); err != nil {
+			statePersistFailures.WithLabelValues(key).Inc()
+			Must(level.Warn(p.logger).Log("msg", "failed to persist state", "state", key, "err", err))
+		}
+	}
+}
+
+func (p *statePersister) upload(key string, snapshot func(io.Writer) (int64, error)) error {
+	var buf bytes.Buffer
+	if _, err := snapshot(&buf); err != nil {
+		return errors.Wrap(err, "failed to take snapshot")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateRequestTimeout)
+	defer cancel()
+	return p.bucket.Upload(ctx, path.Join(p.userID, key), &buf)
+}
@@ -0,0 +1,205 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+
+	// Notifications are considered degraded if at least this ratio of them
+	// failed within the stats window.
+	degradedErrorRate = 0.5
+)
+
+// ApplyStatus is the outcome of applying the config of a user.
+type ApplyStatus struct {
+	// ConfigUpdatedAtInUnix is the update time of the config the status
+	// refers to.
+	ConfigUpdatedAtInUnix int64 `json:"configUpdatedAtInUnix,omitempty" yaml:"configUpdatedAtInUnix,omitempty"`
+	// LastAppliedAt is the time the config was last applied successfully.
+	LastAppliedAt *time.Time `json:"lastAppliedAt,omitempty" yaml:"lastAppliedAt,omitempty"`
+	// LastError is set if the last attempt to apply the config failed.
+	LastError   string     `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty" yaml:"lastErrorAt,omitempty"`
+}
+
+// recordApply records the outcome of applying the config of a user. The
+// status is stored asynchronously by storeApplyStatus.
+func (am *MultitenantAlertmanager) recordApply(cfg *AlertmanagerConfig, err error) {
+	now := time.Now().UTC()
+
+	am.applyStatusMtx.Lock()
+	st := am.applyStatus[cfg.UserID]
+	st.ConfigUpdatedAtInUnix = cfg.UpdatedAtInUnix
+	if err != nil {
+		st.LastError = err.Error()
+		st.LastErrorAt = &now
+	} else {
+		st.LastAppliedAt = &now
+		st.LastError = ""
+		st.LastErrorAt = nil
+	}
+	am.applyStatus[cfg.UserID] = st
+	am.applyStatusDirty[cfg.UserID] = true
+	am.applyStatusMtx.Unlock()
+
+	ev := ConfigEvent{Time: now, Status: ConfigApplied, UpdatedAtInUnix: cfg.UpdatedAtInUnix}
+	if err != nil {
+		ev.Status, ev.Error = ConfigFailed, err.Error()
+	}
+	am.configEvents.publish(cfg.UserID, ev)
+
+	select {
+	case am.applyStatusCh <- struct{}{}:
+	default:
+	}
+}
+
+// storeApplyStatus stores the changed apply statuses of this replica, so
+// that users learn about configs which were accepted but failed to apply.
+// The statuses of deleted users are removed.
+func (am *MultitenantAlertmanager) storeApplyStatus() {
+	for {
+		select {
+		case <-am.applyStatusCh:
+		case <-am.stop:
+			return
+		}
+
+		am.applyStatusMtx.Lock()
+		dirty := make(map[string]*ApplyStatus, len(am.applyStatusDirty))
+		for userID := range am.applyStatusDirty {
+			if st, ok := am.applyStatus[userID]; ok {
+				dirty[userID] = &st
+			} else {
+				dirty[userID] = nil
+			}
+		}
+		am.applyStatusDirty = map[string]bool{}
+		am.applyStatusMtx.Unlock()
+
+		for userID, st := range dirty {
+			ctx, cancel := context.WithTimeout(context.Background(), am.cfg.ClientTimeout)
+			var err error
+			if st != nil {
+				err = am.configsClient.SetApplyStatus(ctx, userID, am.cfg.ReplicaName, st)
+			} else {
+				err = am.configsClient.DeleteApplyStatus(ctx, userID, am.cfg.ReplicaName)
+			}
+			cancel()
+			if err != nil {
+				Must(level.Warn(logger.Logger).Log("msg", "MultitenantAlertmanager: error storing apply status", "user", userID, "err", err))
+			}
+		}
+	}
+}
+
+// deleteApplyStatus removes the apply status of a user, the stored status
+// is removed by storeApplyStatus.
+func (am *MultitenantAlertmanager) deleteApplyStatus(userID string) {
+	am.applyStatusMtx.Lock()
+	delete(am.applyStatus, userID)
+	am.applyStatusDirty[userID] = true
+	am.applyStatusMtx.Unlock()
+
+	select {
+	case am.applyStatusCh <- struct{}{}:
+	default:
+	}
+}
+
+func (am *MultitenantAlertmanager) getApplyStatus(userID string) (ApplyStatus, bool) {
+	am.applyStatusMtx.RLock()
+	defer am.applyStatusMtx.RUnlock()
+	st, ok := am.applyStatus[userID]
+	return st, ok
+}
+
+// Status is the health of the Alertmanager of a user on this replica.
+type Status struct {
+	UserID string `json:"userID"`
+	// Health is down if there is no Alertmanager for the user, and degraded
+	// if the last config could not be applied or many notifications fail.
+	Health  string `json:"health"`
+	Running bool   `json:"running"`
+	// Parked is true if the Alertmanager was stopped for being idle. It is
+	// rebuilt on first use.
+	Parked bool `json:"parked,omitempty"`
+	// ConfigUpdatedAt is the update time of the running config.
+	ConfigUpdatedAt *time.Time `json:"configUpdatedAt,omitempty"`
+	ApplyStatus
+	Notifications *NotificationStats `json:"notifications,omitempty"`
+	// Canary are the stats of the running canary config, on the leader.
+	Canary *CanaryStats `json:"canary,omitempty"`
+}
+
+// status returns the status of the Alertmanager of a user.
+func (am *MultitenantAlertmanager) status(userID string) *Status {
+	st := &Status{UserID: userID, Health: HealthDown}
+	st.ApplyStatus, _ = am.getApplyStatus(userID)
+
+	am.cfgMutex.RLock()
+	if cfg, ok := am.cfgs[userID]; ok {
+		st.ConfigUpdatedAt = unixTime(cfg.UpdatedAtInUnix)
+	}
+	am.cfgMutex.RUnlock()
+
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	st.Parked = am.parked[userID]
+	am.alertmanagersMtx.Unlock()
+	if st.Parked {
+		if st.LastError == "" {
+			st.Health = HealthHealthy
+		} else {
+			st.Health = HealthDegraded
+		}
+		return st
+	}
+	if !ok {
+		return st
+	}
+	st.Running = true
+
+	stats := userAM.events.stats.snapshot(time.Now())
+	st.Notifications = &stats
+	if c := userAM.getCanary(); c != nil {
+		cs := c.getStats()
+		st.Canary = &cs
+	}
+
+	st.Health = HealthHealthy
+	if st.LastError != "" || stats.Failed > 0 && stats.ErrorRate >= degradedErrorRate {
+		st.Health = HealthDegraded
+	}
+	return st
+}
+
+// Status returns the health of the user's Alertmanager. The response code
+// is 503 if the Alertmanager is down, so that it can be used as a probe.
+func (am *MultitenantAlertmanager) Status(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if am.proxyToLeader(w, req) {
+		return
+	}
+
+	st := am.status(userID)
+	code := http.StatusOK
+	if st.Health == HealthDown {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, st)
+}
@@ -0,0 +1,38 @@
+package alertmanager
+
+import (
+	"net/http"
+	"sort"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+)
+
+// TenantStorm is the ongoing alert storm of a tenant.
+type TenantStorm struct {
+	UserID string `json:"userID"`
+	notify.StormStatus
+}
+
+// listStorms returns the tenants whose notifications are collapsed by flood
+// protection on this replica.
+func (a *AdminAPI) listStorms(w http.ResponseWriter, r *http.Request) {
+	a.am.alertmanagersMtx.Lock()
+	ams := make(map[string]*Alertmanager, len(a.am.alertmanagers))
+	for userID, userAM := range a.am.alertmanagers {
+		ams[userID] = userAM
+	}
+	a.am.alertmanagersMtx.Unlock()
+
+	storms := []TenantStorm{}
+	for userID, userAM := range ams {
+		p := userAM.getPipeline()
+		if p == nil {
+			continue
+		}
+		if st, ok := p.storm.Status(userAM.logger); ok {
+			storms = append(storms, TenantStorm{UserID: userID, StormStatus: st})
+		}
+	}
+	sort.Slice(storms, func(i, j int) bool { return storms[i].UserID < storms[j].UserID })
+	writeJSON(w, http.StatusOK, storms)
+}
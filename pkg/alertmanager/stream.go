@@ -0,0 +1,356 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	StreamEventAlert   = "alert"
+	StreamEventSilence = "silence"
+	StreamEventConfig  = "config"
+
+	ConfigApplied = "applied"
+	ConfigFailed  = "failed"
+
+	// streamPollInterval is the interval at which streams check for alerts
+	// resolved by time and for changed silences.
+	streamPollInterval = 5 * time.Second
+)
+
+// AlertEvent is sent when an alert starts firing or is resolved.
+type AlertEvent struct {
+	Time        time.Time `json:"time"`
+	Fingerprint string    `json:"fingerprint"`
+	NotificationEventAlert
+}
+
+// SilenceEvent is sent when a silence is created or updated, and when its
+// state changes.
+type SilenceEvent struct {
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+	JobSilence
+	State string `json:"state"`
+}
+
+// ConfigEvent is sent when a replica applied the config of the user, or
+// failed to.
+type ConfigEvent struct {
+	Time            time.Time `json:"time"`
+	Status          string    `json:"status"`
+	UpdatedAtInUnix int64     `json:"updatedAtInUnix,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// configEvents fans out the config events of each user to its subscribers.
+type configEvents struct {
+	mtx  sync.RWMutex
+	subs map[string]map[chan ConfigEvent]struct{}
+}
+
+func newConfigEvents() *configEvents {
+	return &configEvents{subs: map[string]map[chan ConfigEvent]struct{}{}}
+}
+
+func (e *configEvents) subscribe(userID string) chan ConfigEvent {
+	ch := make(chan ConfigEvent, eventBufferSize)
+	e.mtx.Lock()
+	if e.subs[userID] == nil {
+		e.subs[userID] = map[chan ConfigEvent]struct{}{}
+	}
+	e.subs[userID][ch] = struct{}{}
+	e.mtx.Unlock()
+	return ch
+}
+
+func (e *configEvents) unsubscribe(userID string, ch chan ConfigEvent) {
+	e.mtx.Lock()
+	delete(e.subs[userID], ch)
+	if len(e.subs[userID]) == 0 {
+		delete(e.subs, userID)
+	}
+	e.mtx.Unlock()
+}
+
+func (e *configEvents) publish(userID string, ev ConfigEvent) {
+	if e == nil {
+		return
+	}
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	for ch := range e.subs[userID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// jobSilenceFromProto returns the silence in the representation of the
+// APIs.
+func jobSilenceFromProto(sil *silencepb.Silence) JobSilence {
+	s := JobSilence{
+		Matchers:  []JobSilenceMatcher{},
+		StartsAt:  sil.StartsAt,
+		EndsAt:    sil.EndsAt,
+		CreatedBy: sil.CreatedBy,
+		Comment:   sil.Comment,
+	}
+	for _, m := range sil.Matchers {
+		s.Matchers = append(s.Matchers, JobSilenceMatcher{
+			Name:    m.Name,
+			Value:   m.Pattern,
+			IsRegex: m.Type == silencepb.Matcher_REGEXP,
+		})
+	}
+	return s
+}
+
+// silenceStreamState is what a stream last sent of a silence.
+type silenceStreamState struct {
+	updatedAt time.Time
+	state     types.SilenceState
+}
+
+// alertStream tracks the alerts and silences of a user to send their
+// changes.
+type alertStream struct {
+	// firing are the firing alerts sent, by fingerprint.
+	firing   map[model.Fingerprint]*types.Alert
+	silences map[string]silenceStreamState
+}
+
+func newAlertStream() *alertStream {
+	return &alertStream{
+		firing:   map[model.Fingerprint]*types.Alert{},
+		silences: map[string]silenceStreamState{},
+	}
+}
+
+// alert returns the event of an alert received from the alert provider,
+// if it started firing or was resolved. Alerts sent again by clients
+// are not events.
+func (s *alertStream) alert(a *types.Alert, now time.Time) *AlertEvent {
+	fp := a.Fingerprint()
+	_, firing := s.firing[fp]
+	if a.ResolvedAt(now) {
+		if !firing {
+			return nil
+		}
+		delete(s.firing, fp)
+	} else {
+		s.firing[fp] = a
+		if firing {
+			return nil
+		}
+	}
+	return &AlertEvent{Time: now, Fingerprint: fp.String(), NotificationEventAlert: newNotificationEventAlert(a)}
+}
+
+// resolved returns the events of the firing alerts resolved by time, for
+// which the alert provider sends nothing.
+func (s *alertStream) resolved(now time.Time) []AlertEvent {
+	var evs []AlertEvent
+	for fp, a := range s.firing {
+		if !a.ResolvedAt(now) {
+			continue
+		}
+		delete(s.firing, fp)
+		evs = append(evs, AlertEvent{Time: now, Fingerprint: fp.String(), NotificationEventAlert: newNotificationEventAlert(a)})
+	}
+	return evs
+}
+
+// silenceChanges returns the events of the silences created, updated or
+// changing state since the last call. Silences removed by garbage
+// collection are forgotten.
+func (s *alertStream) silenceChanges(sils []*silencepb.Silence, now time.Time) []SilenceEvent {
+	var evs []SilenceEvent
+	seen := make(map[string]bool, len(sils))
+	for _, sil := range sils {
+		seen[sil.Id] = true
+		st := silenceStreamState{updatedAt: sil.UpdatedAt, state: silenceState(sil, now)}
+		if last, ok := s.silences[sil.Id]; ok && last.updatedAt.Equal(st.updatedAt) && last.state == st.state {
+			continue
+		}
+		s.silences[sil.Id] = st
+		evs = append(evs, SilenceEvent{Time: now, ID: sil.Id, JobSilence: jobSilenceFromProto(sil), State: string(st.state)})
+	}
+	for id := range s.silences {
+		if !seen[id] {
+			delete(s.silences, id)
+		}
+	}
+	return evs
+}
+
+func silenceState(sil *silencepb.Silence, now time.Time) types.SilenceState {
+	switch {
+	case now.Before(sil.StartsAt):
+		return types.SilenceStatePending
+	case now.After(sil.EndsAt):
+		return types.SilenceStateExpired
+	default:
+		return types.SilenceStateActive
+	}
+}
+
+// parseStreamEventTypes returns the event types selected by the comma
+// separated types parameter, all if it is empty.
+func parseStreamEventTypes(param string) (map[string]bool, error) {
+	all := []string{StreamEventAlert, StreamEventSilence, StreamEventConfig}
+	selected := map[string]bool{}
+	if param == "" {
+		for _, t := range all {
+			selected[t] = true
+		}
+		return selected, nil
+	}
+	for _, t := range strings.Split(param, ",") {
+		t = strings.TrimSpace(t)
+		switch t {
+		case StreamEventAlert, StreamEventSilence, StreamEventConfig:
+			selected[t] = true
+		default:
+			return nil, fmt.Errorf("unknown event type %q, expected one of %s", t, strings.Join(all, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// Stream streams the alert, silence and config events of the user as
+// server-sent events. The stream starts with the firing alerts and the
+// silences. Event types can be selected with the comma separated `types`
+// query parameter.
+func (am *MultitenantAlertmanager) Stream(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	selected, err := parseStreamEventTypes(req.URL.Query().Get("types"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The stream ends on shutdown, also when it is proxied to the leader.
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-am.streamsStop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req = req.WithContext(ctx)
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Unselected event sources are left nil, receiving from them blocks.
+	var alerts <-chan *types.Alert
+	if selected[StreamEventAlert] {
+		it := userAM.alerts.Subscribe()
+		defer it.Close()
+		alerts = it.Next()
+	}
+	var configs chan ConfigEvent
+	if selected[StreamEventConfig] {
+		configs = am.configEvents.subscribe(userID)
+		defer am.configEvents.unsubscribe(userID, configs)
+	}
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, v interface{}) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return true
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		return err == nil
+	}
+	s := newAlertStream()
+	sendSilences := func() bool {
+		if !selected[StreamEventSilence] {
+			return true
+		}
+		sils, _, err := userAM.silences.Query()
+		if err != nil {
+			return true
+		}
+		for _, ev := range s.silenceChanges(sils, time.Now()) {
+			if !send(StreamEventSilence, ev) {
+				return false
+			}
+		}
+		return true
+	}
+	if !sendSilences() {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case a, ok := <-alerts:
+			if !ok {
+				return
+			}
+			if ev := s.alert(a, time.Now()); ev != nil {
+				if !send(StreamEventAlert, ev) {
+					return
+				}
+			}
+		case ev := <-configs:
+			if !send(StreamEventConfig, ev) {
+				return
+			}
+		case <-ticker.C:
+			for _, ev := range s.resolved(time.Now()) {
+				if !send(StreamEventAlert, ev) {
+					return
+				}
+			}
+			if !sendSilences() {
+				return
+			}
+		case <-userAM.stop:
+			return
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
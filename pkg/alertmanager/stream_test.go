@@ -0,0 +1,94 @@
+package alertmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestAlertStreamAlerts(t *testing.T) {
+	now := time.Now()
+	alert := func(endsAt time.Time) *types.Alert {
+		return &types.Alert{Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": "HighLatency"},
+			StartsAt: now.Add(-time.Hour),
+			EndsAt:   endsAt,
+		}}
+	}
+	s := newAlertStream()
+
+	if ev := s.alert(alert(now.Add(-time.Minute)), now); ev != nil {
+		t.Fatalf("unexpected event for an alert resolved before it was sent: %+v", ev)
+	}
+	ev := s.alert(alert(now.Add(5*time.Minute)), now)
+	if ev == nil || ev.Status != string(model.AlertFiring) {
+		t.Fatalf("expected a firing event, got %+v", ev)
+	}
+	if ev := s.alert(alert(now.Add(10*time.Minute)), now); ev != nil {
+		t.Fatalf("unexpected event for an alert sent again: %+v", ev)
+	}
+	if evs := s.resolved(now); len(evs) != 0 {
+		t.Fatalf("unexpected resolved events: %+v", evs)
+	}
+	evs := s.resolved(now.Add(11 * time.Minute))
+	if len(evs) != 1 || evs[0].Fingerprint != ev.Fingerprint {
+		t.Fatalf("expected the alert to be resolved by time, got %+v", evs)
+	}
+
+	s.alert(alert(now.Add(5*time.Minute)), now)
+	ev = s.alert(alert(now.Add(-time.Second)), now)
+	if ev == nil || ev.Status != string(model.AlertResolved) {
+		t.Fatalf("expected a resolved event, got %+v", ev)
+	}
+	if len(s.firing) != 0 {
+		t.Fatalf("resolved alerts are still tracked: %v", s.firing)
+	}
+}
+
+func TestAlertStreamSilenceChanges(t *testing.T) {
+	now := time.Now()
+	sil := &silencepb.Silence{
+		Id:        "a",
+		Matchers:  []*silencepb.Matcher{{Type: silencepb.Matcher_REGEXP, Name: "team", Pattern: "db.*"}},
+		StartsAt:  now.Add(-time.Minute),
+		EndsAt:    now.Add(time.Hour),
+		UpdatedAt: now.Add(-time.Minute),
+		CreatedBy: "ops",
+	}
+	s := newAlertStream()
+
+	evs := s.silenceChanges([]*silencepb.Silence{sil}, now)
+	if len(evs) != 1 || evs[0].ID != "a" || evs[0].State != string(types.SilenceStateActive) {
+		t.Fatalf("expected the silence to be sent, got %+v", evs)
+	}
+	if m := evs[0].Matchers; len(m) != 1 || m[0].Name != "team" || m[0].Value != "db.*" || !m[0].IsRegex {
+		t.Fatalf("unexpected matchers %+v", m)
+	}
+	if evs := s.silenceChanges([]*silencepb.Silence{sil}, now); len(evs) != 0 {
+		t.Fatalf("unexpected events for an unchanged silence: %+v", evs)
+	}
+	evs = s.silenceChanges([]*silencepb.Silence{sil}, now.Add(2*time.Hour))
+	if len(evs) != 1 || evs[0].State != string(types.SilenceStateExpired) {
+		t.Fatalf("expected the silence to expire, got %+v", evs)
+	}
+	if evs := s.silenceChanges(nil, now); len(evs) != 0 || len(s.silences) != 0 {
+		t.Fatalf("removed silences are still tracked: %+v", s.silences)
+	}
+}
+
+func TestParseStreamEventTypes(t *testing.T) {
+	all, err := parseStreamEventTypes("")
+	if err != nil || len(all) != 3 {
+		t.Fatalf("expected all event types, got %v, %v", all, err)
+	}
+	selected, err := parseStreamEventTypes("alert, config")
+	if err != nil || !selected[StreamEventAlert] || !selected[StreamEventConfig] || selected[StreamEventSilence] {
+		t.Fatalf("unexpected event types %v, %v", selected, err)
+	}
+	if _, err := parseStreamEventTypes("alert,notification"); err == nil {
+		t.Fatal("expected an error for an unknown event type")
+	}
+}
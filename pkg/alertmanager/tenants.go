@@ -0,0 +1,178 @@
+package alertmanager
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/types"
+)
+
+const (
+	ConfigStatusActive      = "active"
+	ConfigStatusDeactivated = "deactivated"
+	ConfigStatusDeleted     = "deleted"
+	// ConfigStatusMissing is the status of tenants with a running
+	// Alertmanager but no stored config.
+	ConfigStatusMissing = "missing"
+)
+
+// TenantStatus summarizes the config and the Alertmanager of a tenant.
+type TenantStatus struct {
+	UserID       string `json:"userID"`
+	ConfigStatus string `json:"configStatus"`
+	// Labels are the labels of the stored config.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Features are the feature flags enabled for the tenant.
+	Features      []string   `json:"features"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+	// Apply is the outcome of the last config apply on this replica.
+	Apply *ApplyStatus `json:"apply,omitempty"`
+	// Running is true if this replica runs an Alertmanager for the tenant.
+	// The counts below are only set if it does.
+	Running bool `json:"running"`
+	// Parked is true if the Alertmanager was stopped for being idle.
+	Parked        bool               `json:"parked,omitempty"`
+	ActiveAlerts  int                `json:"activeAlerts"`
+	Silences      int                `json:"silences"`
+	Notifications *NotificationStats `json:"notifications,omitempty"`
+}
+
+func unixTime(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t
+}
+
+// tenantStatus returns the status of the tenant of cfg, which has no user ID
+// if the tenant has no stored config.
+func (a *AdminAPI) tenantStatus(userID string, cfg AlertmanagerConfig) (*TenantStatus, error) {
+	st := &TenantStatus{
+		UserID:        userID,
+		ConfigStatus:  ConfigStatusActive,
+		Labels:        cfg.Labels,
+		Features:      a.am.cfg.enabledFeatures(cfg.Features),
+		UpdatedAt:     unixTime(cfg.UpdatedAtInUnix),
+		DeactivatedAt: unixTime(cfg.DeactivatedAtInUnix),
+	}
+	switch {
+	case cfg.UserID == "":
+		st.ConfigStatus = ConfigStatusMissing
+	case cfg.DeletedAtInUnix > 0:
+		st.ConfigStatus = ConfigStatusDeleted
+	case cfg.DeactivatedAtInUnix > 0:
+		st.ConfigStatus = ConfigStatusDeactivated
+	}
+
+	if as, ok := a.am.getApplyStatus(userID); ok {
+		st.Apply = &as
+	}
+
+	a.am.alertmanagersMtx.Lock()
+	userAM, ok := a.am.alertmanagers[userID]
+	st.Parked = a.am.parked[userID]
+	a.am.alertmanagersMtx.Unlock()
+	if !ok {
+		return st, nil
+	}
+	st.Running = true
+
+	it := userAM.alerts.GetPending()
+	for alert := range it.Next() {
+		if !alert.Resolved() {
+			st.ActiveAlerts++
+		}
+	}
+	it.Close()
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	sils, _, err := userAM.silences.Query(silence.QState(types.SilenceStateActive))
+	if err != nil {
+		return nil, err
+	}
+	st.Silences = len(sils)
+
+	stats := userAM.events.stats.snapshot(time.Now())
+	st.Notifications = &stats
+	return st, nil
+}
+
+// listTenants returns the status of all tenants with a stored config or an
+// Alertmanager running on this replica. The tenants can be filtered by
+// their labels with the `selector` query parameter, which leaves out the
+// tenants without a stored config.
+func (a *AdminAPI) listTenants(w http.ResponseWriter, r *http.Request) {
+	selector, err := ParseTenantSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfgs, err := a.client.GetAllConfigs(r.Context())
+	if err != nil {
+		Must(level.Error(logger2.Logger).Log("msg", "error getting configs", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byUser := map[string]AlertmanagerConfig{}
+	for _, cfg := range cfgs {
+		if selector.Matches(cfg.Labels) {
+			byUser[cfg.UserID] = cfg
+		}
+	}
+	if len(selector) == 0 {
+		a.am.alertmanagersMtx.Lock()
+		for userID := range a.am.alertmanagers {
+			if _, ok := byUser[userID]; !ok {
+				byUser[userID] = AlertmanagerConfig{}
+			}
+		}
+		a.am.alertmanagersMtx.Unlock()
+	}
+
+	tenants := make([]*TenantStatus, 0, len(byUser))
+	for userID, cfg := range byUser {
+		st, err := a.tenantStatus(userID, cfg)
+		if err != nil {
+			Must(level.Error(logger2.Logger).Log("msg", "error getting tenant status", "user", userID, "err", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tenants = append(tenants, st)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].UserID < tenants[j].UserID })
+	writeJSON(w, http.StatusOK, tenants)
+}
+
+// getTenantStatus returns the status of a single tenant.
+func (a *AdminAPI) getTenantStatus(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	st, err := a.tenantStatus(userID, cfg)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting tenant status", "err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if st.ConfigStatus == ConfigStatusMissing && !st.Running && !st.Parked {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,253 @@
+package alertmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	logger2 "go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// TimingBounds are the bounds of the notification timings users can set
+// through the timing API. A zero maximum is unbounded.
+type TimingBounds struct {
+	MinGroupWait      time.Duration
+	MaxGroupWait      time.Duration
+	MinGroupInterval  time.Duration
+	MaxGroupInterval  time.Duration
+	MinRepeatInterval time.Duration
+	MaxRepeatInterval time.Duration
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet.
+func (b *TimingBounds) AddFlags(f *pflag.FlagSet) {
+	f.DurationVar(&b.MinGroupWait, "alertmanager.timing.min-group-wait", 0, "Minimum group_wait users can set through the timing API.")
+	f.DurationVar(&b.MaxGroupWait, "alertmanager.timing.max-group-wait", 0, "Maximum group_wait users can set through the timing API. Unbounded if 0.")
+	f.DurationVar(&b.MinGroupInterval, "alertmanager.timing.min-group-interval", 0, "Minimum group_interval users can set through the timing API.")
+	f.DurationVar(&b.MaxGroupInterval, "alertmanager.timing.max-group-interval", 0, "Maximum group_interval users can set through the timing API. Unbounded if 0.")
+	f.DurationVar(&b.MinRepeatInterval, "alertmanager.timing.min-repeat-interval", 0, "Minimum repeat_interval users can set through the timing API.")
+	f.DurationVar(&b.MaxRepeatInterval, "alertmanager.timing.max-repeat-interval", 0, "Maximum repeat_interval users can set through the timing API. Unbounded if 0.")
+}
+
+func (b *TimingBounds) Validate() error {
+	for _, bound := range []struct {
+		name     string
+		min, max time.Duration
+	}{
+		{"group-wait", b.MinGroupWait, b.MaxGroupWait},
+		{"group-interval", b.MinGroupInterval, b.MaxGroupInterval},
+		{"repeat-interval", b.MinRepeatInterval, b.MaxRepeatInterval},
+	} {
+		if bound.min < 0 || bound.max < 0 {
+			return errors.Errorf("alertmanager.timing bounds of %s must not be negative", bound.name)
+		}
+		if bound.max > 0 && bound.min > bound.max {
+			return errors.Errorf("alertmanager.timing.min-%s must not exceed alertmanager.timing.max-%s", bound.name, bound.name)
+		}
+	}
+	return nil
+}
+
+// TimingOverride overrides the notification timings of the routes of a
+// receiver. Unset timings are kept as they are.
+type TimingOverride struct {
+	GroupWait      *model.Duration `yaml:"group_wait,omitempty" json:"group_wait,omitempty"`
+	GroupInterval  *model.Duration `yaml:"group_interval,omitempty" json:"group_interval,omitempty"`
+	RepeatInterval *model.Duration `yaml:"repeat_interval,omitempty" json:"repeat_interval,omitempty"`
+}
+
+// TimingRequest holds the timing overrides by receiver name.
+type TimingRequest struct {
+	Receivers map[string]TimingOverride `yaml:"receivers" json:"receivers"`
+}
+
+func (b *TimingBounds) check(receiver string, o TimingOverride) error {
+	for _, t := range []struct {
+		name     string
+		d        *model.Duration
+		min, max time.Duration
+	}{
+		{"group_wait", o.GroupWait, b.MinGroupWait, b.MaxGroupWait},
+		{"group_interval", o.GroupInterval, b.MinGroupInterval, b.MaxGroupInterval},
+		{"repeat_interval", o.RepeatInterval, b.MinRepeatInterval, b.MaxRepeatInterval},
+	} {
+		if t.d == nil {
+			continue
+		}
+		d := time.Duration(*t.d)
+		if d < t.min {
+			return errors.Errorf("receiver %q: %s must be at least %s", receiver, t.name, model.Duration(t.min))
+		}
+		if t.max > 0 && d > t.max {
+			return errors.Errorf("receiver %q: %s must be at most %s", receiver, t.name, model.Duration(t.max))
+		}
+	}
+	return nil
+}
+
+func (o TimingOverride) fields() yaml.MapSlice {
+	var fields yaml.MapSlice
+	if o.GroupWait != nil {
+		fields = append(fields, yaml.MapItem{Key: "group_wait", Value: o.GroupWait.String()})
+	}
+	if o.GroupInterval != nil {
+		fields = append(fields, yaml.MapItem{Key: "group_interval", Value: o.GroupInterval.String()})
+	}
+	if o.RepeatInterval != nil {
+		fields = append(fields, yaml.MapItem{Key: "repeat_interval", Value: o.RepeatInterval.String()})
+	}
+	return fields
+}
+
+// setTiming merges timing overrides by receiver into the user's config,
+// validates and stores the config. The rest of the config is kept as is.
+func (a *API) setTiming(w http.ResponseWriter, r *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	logger := logger2.WithUserID(userID, logger2.Logger)
+
+	// The overrides are decoded like the config, JSON being a subset of
+	// YAML, so that durations are accepted in the same format.
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var req TimingRequest
+	if err := yaml.UnmarshalStrict(body, &req); err != nil {
+		Must(level.Error(logger).Log("msg", "error decoding body", "err", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Receivers) == 0 {
+		writeError(w, http.StatusBadRequest, "receivers must be non empty")
+		return
+	}
+	for name, o := range req.Receivers {
+		if len(o.fields()) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("receiver %q: no timing to override", name))
+			return
+		}
+		if err := a.timingBounds.check(name, o); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	cfg, err := a.client.GetConfig(r.Context(), userID)
+	if err != nil {
+		Must(level.Error(logger).Log("msg", "error getting config", "err", err))
+		storageError(w, err)
+		return
+	}
+	if cfg.UserID == "" {
+		writeError(w, http.StatusNotFound, "config not found")
+		return
+	}
+
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg.Config), &raw); err != nil {
+		Must(level.Error(logger).Log("msg", "error parsing config", "err", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	matched := map[string]bool{}
+	for i, item := range raw {
+		if item.Key != "route" {
+			continue
+		}
+		if route, ok := item.Value.(yaml.MapSlice); ok {
+			raw[i].Value = overrideRouteTiming(route, "", true, req.Receivers, matched)
+		}
+	}
+	var unmatched []string
+	for name := range req.Receivers {
+		if !matched[name] {
+			unmatched = append(unmatched, name)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("receivers not used by any route: %v", unmatched))
+		return
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := validateAlertmanagerConfig(string(data)); err != nil {
+		Must(level.Error(logger).Log("msg", "invalid timing", "err", err))
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid timing: %v", err))
+		return
+	}
+
+	cfg.Config = string(data)
+	cfg.UpdatedAtInUnix = time.Now().Unix()
+	if err := a.client.SetConfig(r.Context(), &cfg); err != nil {
+		Must(level.Error(logger).Log("msg", "error storing config", "err", err))
+		storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// overrideRouteTiming sets the timing overrides on the routes of the
+// receivers in the routing tree. Routes inheriting their receiver inherit the
+// timing of their parent too, so only the timings they set themselves are
+// overridden.
+func overrideRouteTiming(route yaml.MapSlice, parentReceiver string, root bool, overrides map[string]TimingOverride, matched map[string]bool) yaml.MapSlice {
+	receiver, inherited := parentReceiver, !root
+	for _, f := range route {
+		if f.Key == "receiver" {
+			receiver, inherited = fmt.Sprint(f.Value), false
+		}
+	}
+
+	if o, ok := overrides[receiver]; ok {
+		matched[receiver] = true
+		for _, field := range o.fields() {
+			idx := -1
+			for i, f := range route {
+				if f.Key == field.Key {
+					idx = i
+				}
+			}
+			switch {
+			case idx >= 0:
+				route[idx].Value = field.Value
+			case !inherited:
+				route = append(route, field)
+			}
+		}
+	}
+
+	for i, f := range route {
+		if f.Key != "routes" {
+			continue
+		}
+		children, ok := f.Value.([]interface{})
+		if !ok {
+			continue
+		}
+		for j, c := range children {
+			if child, ok := c.(yaml.MapSlice); ok {
+				children[j] = overrideRouteTiming(child, receiver, false, overrides, matched)
+			}
+		}
+		route[i].Value = children
+	}
+	return route
+}
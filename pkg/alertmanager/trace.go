@@ -0,0 +1,248 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// TraceRequest describes the synthetic alert sent through the pipeline.
+type TraceRequest struct {
+	Labels      model.LabelSet `json:"labels"`
+	Annotations model.LabelSet `json:"annotations,omitempty"`
+	Resolved    bool           `json:"resolved,omitempty"`
+}
+
+// Trace is the step by step result of a dry-run of the notification pipeline.
+type Trace struct {
+	Fingerprint string       `json:"fingerprint"`
+	Routes      []RouteTrace `json:"routes"`
+}
+
+// RouteTrace is the trace of an alert through a single matching route.
+type RouteTrace struct {
+	Receiver    string         `json:"receiver"`
+	RouteKey    string         `json:"routeKey"`
+	GroupKey    string         `json:"groupKey"`
+	GroupLabels model.LabelSet `json:"groupLabels"`
+	Inhibited   bool           `json:"inhibited"`
+	InhibitedBy []string       `json:"inhibitedBy,omitempty"`
+	Silenced    bool           `json:"silenced"`
+	SilencedBy  []string       `json:"silencedBy,omitempty"`
+	// MaintenanceWindow is the active maintenance window suppressing the
+	// notification, if any.
+	MaintenanceWindow string             `json:"maintenanceWindow,omitempty"`
+	Muted             bool               `json:"muted"`
+	Integrations      []IntegrationTrace `json:"integrations,omitempty"`
+}
+
+// IntegrationTrace is the trace of an alert through a single integration of
+// a receiver.
+type IntegrationTrace struct {
+	Name string `json:"name"`
+	// Deduplicated is true if the notification log shows that the alert was
+	// already sent and the repeat interval has not passed yet.
+	Deduplicated bool        `json:"deduplicated"`
+	Payload      interface{} `json:"payload,omitempty"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// Trace runs an alert through the routing tree, the inhibition and silence
+// checks, the notification log and the templates of the matched receivers.
+// Nothing is sent and the alert is not stored.
+func (am *Alertmanager) Trace(ctx context.Context, tr *TraceRequest) (*Trace, error) {
+	p := am.getPipeline()
+	if p == nil {
+		return nil, fmt.Errorf("no configuration applied")
+	}
+	conf, tmpl := p.conf, p.tmpl
+
+	now := time.Now()
+	alert := &types.Alert{
+		Alert: model.Alert{
+			Labels:      tr.Labels,
+			Annotations: tr.Annotations,
+			StartsAt:    now,
+		},
+		UpdatedAt: now,
+	}
+	if tr.Resolved {
+		alert.EndsAt = now
+	}
+	fp := alert.Fingerprint()
+
+	receivers := map[string]*notify.Receiver{}
+	for _, rc := range conf.Receivers {
+		receivers[rc.Name] = rc
+	}
+
+	inhibitedBy := am.inhibitingAlerts(p.inhibitRules, alert.Labels)
+	inhibited := len(inhibitedBy) > 0
+
+	sils, _, err := am.silences.Query(
+		silence.QState(types.SilenceStateActive),
+		silence.QMatches(alert.Labels),
+	)
+	if err != nil {
+		return nil, err
+	}
+	silencedBy := make([]string, 0, len(sils))
+	for _, sil := range sils {
+		silencedBy = append(silencedBy, sil.Id)
+	}
+
+	maintenance := notify.NewMaintenanceStage(conf.MaintenanceWindows)
+
+	t := &Trace{Fingerprint: fp.String()}
+	for _, r := range dispatch.NewRoute(conf.Route, nil).Match(alert.Labels) {
+		groupLabels := groupLabels(r, alert.Labels)
+		rt := RouteTrace{
+			Receiver:    r.RouteOpts.Receiver,
+			RouteKey:    r.Key(),
+			GroupKey:    fmt.Sprintf("%s:%s", r.Key(), groupLabels),
+			GroupLabels: groupLabels,
+			Inhibited:   inhibited,
+			InhibitedBy: inhibitedBy,
+			Silenced:    len(silencedBy) > 0,
+			SilencedBy:  silencedBy,
+		}
+		rt.MaintenanceWindow, _ = maintenance.Suppressing(rt.Receiver, alert.Labels)
+		rt.Muted = rt.Inhibited || rt.Silenced || rt.MaintenanceWindow != ""
+
+		rc, ok := receivers[rt.Receiver]
+		if !ok || rt.Muted {
+			t.Routes = append(t.Routes, rt)
+			continue
+		}
+
+		ictx := notify.WithTenantID(ctx, am.cfg.UserID)
+		ictx = amnotify.WithGroupKey(ictx, rt.GroupKey)
+		ictx = amnotify.WithGroupLabels(ictx, groupLabels)
+		ictx = amnotify.WithReceiverName(ictx, rc.Name)
+		ictx = amnotify.WithRepeatInterval(ictx, r.RouteOpts.RepeatInterval)
+		ictx = amnotify.WithNow(ictx, now)
+
+		for _, i := range notify.BuildReceiverIntegrations(rc, tmpl, am.logger) {
+			it := IntegrationTrace{Name: fmt.Sprintf("%s[%d]", i.Name(), i.Index())}
+
+			recv := &nflogpb.Receiver{
+				GroupName:   rc.Name,
+				Integration: i.Name(),
+				Idx:         uint32(i.Index()),
+			}
+			_, alerts, err := notify.NewDedupStage(i, am.nflog, recv).Exec(ictx, am.logger, alert)
+			if err != nil {
+				it.Error = err.Error()
+				rt.Integrations = append(rt.Integrations, it)
+				continue
+			}
+			if len(alerts) == 0 {
+				it.Deduplicated = true
+				rt.Integrations = append(rt.Integrations, it)
+				continue
+			}
+
+			payload, ok, err := i.Render(ictx, alert)
+			switch {
+			case err != nil:
+				it.Error = err.Error()
+			case ok:
+				it.Payload = payload
+			default:
+				it.Payload = tmpl.Data(rc.Name, groupLabels, alert)
+			}
+			rt.Integrations = append(rt.Integrations, it)
+		}
+		t.Routes = append(t.Routes, rt)
+	}
+	return t, nil
+}
+
+// inhibitingAlerts returns the fingerprints of the firing alerts inhibiting
+// an alert with the label set, by the rules. The rules are checked like the
+// inhibitor does, but the marker of the alert is left alone: alerts matching
+// both sides of a rule do not inhibit alerts matching both sides either.
+func (am *Alertmanager) inhibitingAlerts(rules []*config.InhibitRule, lset model.LabelSet) []string {
+	fp := lset.Fingerprint()
+	it := am.alerts.GetPending()
+	defer it.Close()
+
+	var res []string
+	for a := range it.Next() {
+		if a.Resolved() || a.Fingerprint() == fp {
+			continue
+		}
+		for _, rule := range rules {
+			if !inhibits(rule, a.Labels, lset) {
+				continue
+			}
+			if labelsMatch(rule.SourceMatch, rule.SourceMatchRE, lset) && labelsMatch(rule.TargetMatch, rule.TargetMatchRE, a.Labels) {
+				continue
+			}
+			res = append(res, a.Fingerprint().String())
+			break
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Trace returns a dry-run trace of the notification pipeline of a user for
+// a synthetic alert.
+func (am *MultitenantAlertmanager) Trace(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var tr TraceRequest
+	if err := json.NewDecoder(req.Body).Decode(&tr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tr.Labels) == 0 {
+		http.Error(w, "alert has no labels", http.StatusBadRequest)
+		return
+	}
+	if err := tr.Labels.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := tr.Annotations.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := userAM.Trace(req.Context(), &tr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
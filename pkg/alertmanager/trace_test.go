@@ -0,0 +1,71 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestTraceInhibition(t *testing.T) {
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+inhibit_rules:
+- source_match:
+    severity: critical
+  target_match:
+    severity: warning
+  equal: [cluster]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	alert := func(lset model.LabelSet) *types.Alert {
+		return &types.Alert{Alert: model.Alert{Labels: lset, StartsAt: now, EndsAt: now.Add(time.Hour)}, UpdatedAt: now}
+	}
+	critical := alert(model.LabelSet{"alertname": "Down", "severity": "critical", "cluster": "a"})
+	warning := alert(model.LabelSet{"alertname": "Slow", "severity": "warning", "cluster": "a"})
+	if err := am.alerts.Put(critical, warning); err != nil {
+		t.Fatal(err)
+	}
+	am.marker.SetActive(warning.Fingerprint())
+
+	for _, tc := range []struct {
+		lset      model.LabelSet
+		inhibited bool
+	}{
+		{lset: warning.Labels, inhibited: true},
+		{lset: model.LabelSet{"alertname": "Slow", "severity": "warning", "cluster": "b"}},
+		{lset: critical.Labels},
+	} {
+		tr, err := am.Trace(context.Background(), &TraceRequest{Labels: tc.lset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt := tr.Routes[0]
+		if rt.Inhibited != tc.inhibited {
+			t.Fatalf("%v: expected inhibited %v, got %+v", tc.lset, tc.inhibited, rt)
+		}
+		if tc.inhibited && (len(rt.InhibitedBy) != 1 || rt.InhibitedBy[0] != critical.Fingerprint().String()) {
+			t.Fatalf("expected the critical alert to inhibit, got %v", rt.InhibitedBy)
+		}
+	}
+
+	// Tracing leaves the marker of the stored alert alone.
+	if s := am.marker.Status(warning.Fingerprint()); s.State != types.AlertStateActive || len(s.InhibitedBy) > 0 {
+		t.Fatalf("expected the stored alert to stay active, got %+v", s)
+	}
+}
@@ -0,0 +1,44 @@
+package alertmanager
+
+import (
+	"context"
+
+	"go.searchlight.dev/alertmanager/pkg/tracing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/opentracing/opentracing-go"
+	amnotify "github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// tracedStage traces the notifications of an alert group dispatched to a
+// receiver. The spans of the integrations are its children.
+type tracedStage struct {
+	amnotify.Stage
+	userID   string
+	receiver string
+}
+
+func (s *tracedStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	sp, ctx := opentracing.StartSpanFromContext(ctx, "Dispatch")
+	defer sp.Finish()
+	sp.SetTag("tenant", s.userID)
+	sp.SetTag("receiver", s.receiver)
+	sp.SetTag("alerts", len(alerts))
+	if key, ok := amnotify.GroupKey(ctx); ok {
+		sp.SetTag("group_key", key)
+	}
+	ctx, alerts, err := s.Stage.Exec(ctx, l, alerts...)
+	if err != nil {
+		tracing.SetError(sp, err)
+	}
+	return ctx, alerts, err
+}
+
+// traceStages makes the routing stage trace the notifications of each
+// receiver.
+func traceStages(rs amnotify.RoutingStage, userID string) {
+	for name, s := range rs {
+		rs[name] = &tracedStage{Stage: s, userID: userID, receiver: name}
+	}
+}
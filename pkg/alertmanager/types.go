@@ -1,32 +1,139 @@
 package alertmanager
 
+import (
+	"context"
+	"time"
+)
+
 type AlertmanagerConfig struct {
 	// TODO: Add id for containing multiple config for single user
 
-	UserID              string            `json:"userID" yaml:"userID"`
-	Config              string            `json:"config" yaml:"config"`
-	TemplateFiles       map[string]string `json:"templateFiles,omitempty" yaml:"templateFiles,omitempty"`
-	UpdatedAtInUnix     int64             `json:"updatedAtInUnix,omitempty" yaml:"updatedAtInUnix,omitempty"`
-	DeactivatedAtInUnix int64             `json:"deactivatedAtInUnix,omitempty" yaml:"deactivatedAtInUnix,omitempty"`
-	DeletedAtInUnix     int64             `json:"deletedAtInUnix,omitempty" yaml:"deletedAtInUnix,omitempty"`
+	UserID        string            `json:"userID" yaml:"userID"`
+	Config        string            `json:"config" yaml:"config"`
+	TemplateFiles map[string]string `json:"templateFiles,omitempty" yaml:"templateFiles,omitempty"`
+	// ExternalURL is the URL the user's Alertmanager is reachable at, used
+	// in the links of notifications. Defaults to the path prefix.
+	ExternalURL         string `json:"externalURL,omitempty" yaml:"externalURL,omitempty"`
+	UpdatedAtInUnix     int64  `json:"updatedAtInUnix,omitempty" yaml:"updatedAtInUnix,omitempty"`
+	DeactivatedAtInUnix int64  `json:"deactivatedAtInUnix,omitempty" yaml:"deactivatedAtInUnix,omitempty"`
+	DeletedAtInUnix     int64  `json:"deletedAtInUnix,omitempty" yaml:"deletedAtInUnix,omitempty"`
+	// Labels are metadata of the tenant set by operators, like its plan or
+	// region. They select the tenant for admin operations, limit overrides
+	// and replicas, and are kept when the config is set.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Features override the feature flags enabled for the tenant by
+	// default, see notify.Features. They are set by operators, and kept
+	// when the config is set.
+	Features map[string]bool `json:"features,omitempty" yaml:"features,omitempty"`
+	// Retention overrides the retention of the state of the user's
+	// Alertmanager. It is set through its own endpoints, and kept when the
+	// config is set.
+	Retention *RetentionOverrides `json:"retention,omitempty" yaml:"retention,omitempty"`
+	// Canary is a candidate config run in shadow, promoted or rolled back
+	// automatically. It is set through its own endpoints, and kept when the
+	// config is set.
+	Canary *CanaryConfig `json:"canary,omitempty" yaml:"canary,omitempty"`
+	// ReplicatedRevision is the revision of the config on the primary
+	// deployment, set on standby deployments.
+	ReplicatedRevision int64 `json:"replicatedRevision,omitempty" yaml:"replicatedRevision,omitempty"`
+
+	// Revision is the storage revision the config was last changed or
+	// deleted at. It is set when the config is read, and not stored. Set
+	// with a config, it must be the revision of the stored config.
+	Revision int64 `json:"revision,omitempty" yaml:"-"`
+}
+
+// ListConfigsOptions selects a page of configs.
+type ListConfigsOptions struct {
+	// Limit is the maximum number of configs returned, all are returned if
+	// 0.
+	Limit int64
+	// Continue is the token returned with the previous page.
+	Continue string
+	// UserIDPrefix restricts the configs to the users whose IDs start with
+	// it.
+	UserIDPrefix string
 }
 
 type AlertmanagerGetter interface {
-	GetAllConfigs() ([]AlertmanagerConfig, error)
-	GetAllUpdatedConfigs() ([]AlertmanagerConfig, error)
+	// ListConfigs returns a page of configs, and the token to get the next
+	// page with, which is empty after the last page.
+	ListConfigs(ctx context.Context, opts ListConfigsOptions) ([]AlertmanagerConfig, string, error)
+	// GetAllUpdatedConfigs returns the configs updated since the last call.
+	// It returns ErrResyncRequired if updates may have been missed.
+	GetAllUpdatedConfigs(ctx context.Context) ([]AlertmanagerConfig, error)
+	// Updated is signalled when there are updated configs.
+	Updated() <-chan struct{}
+
+	// SetApplyStatus stores the outcome of applying the config of a user on
+	// a replica.
+	SetApplyStatus(ctx context.Context, userID, replica string, st *ApplyStatus) error
+	// DeleteApplyStatus removes the apply status of a user on a replica.
+	DeleteApplyStatus(ctx context.Context, userID, replica string) error
+
+	// GetGlobalInhibitRules returns the stored inhibition rules applied to
+	// all users, or "" if there are none.
+	GetGlobalInhibitRules(ctx context.Context) (string, error)
+	// ListLibraryTemplates returns the current version of the templates
+	// shared by all users.
+	ListLibraryTemplates(ctx context.Context) ([]LibraryTemplate, error)
+	// Revision returns the current revision of the storage.
+	Revision(ctx context.Context) (int64, error)
 }
 
 type AlertmanagerWatcher interface {
-	Watch(ch chan AlertmanagerConfig)
+	// Watch sends updated configs to ch. It blocks until updates may have
+	// been missed, and then returns ErrResyncRequired.
+	Watch(ch chan AlertmanagerConfig) error
 }
 
 type AlertmanagerClient interface {
-	GetConfig(userID string) (AlertmanagerConfig, error)
-	GetAllConfigs() ([]AlertmanagerConfig, error)
+	GetConfig(ctx context.Context, userID string) (AlertmanagerConfig, error)
+	GetAllConfigs(ctx context.Context) ([]AlertmanagerConfig, error)
+	// ListConfigs returns a page of configs, and the token to get the next
+	// page with, which is empty after the last page. The pages are read at
+	// the revision of the first one.
+	ListConfigs(ctx context.Context, opts ListConfigsOptions) ([]AlertmanagerConfig, string, error)
+
+	SetConfig(ctx context.Context, amCfg *AlertmanagerConfig) error
+	// UpdateConfig stores the config of a user as changed by update. If the
+	// config is changed concurrently, it is read and updated again. Nothing
+	// is stored if update returns an error, which is returned.
+	UpdateConfig(ctx context.Context, userID string, update func(amCfg *AlertmanagerConfig) error) error
+
+	// DeleteConfig removes the config of a user.
+	DeleteConfig(ctx context.Context, userID string) error
 
-	SetConfig(amCfg *AlertmanagerConfig) error
+	DeactivateConfig(ctx context.Context, userID string) error
 
-	DeactivateConfig(userID string) error
+	RestoreConfig(ctx context.Context, userID string) error
+
+	SetApplyStatus(ctx context.Context, userID, replica string, st *ApplyStatus) error
+	DeleteApplyStatus(ctx context.Context, userID, replica string) error
+	// GetApplyStatus returns the apply status of a user by replica.
+	GetApplyStatus(ctx context.Context, userID string) (map[string]ApplyStatus, error)
+
+	GetGlobalInhibitRules(ctx context.Context) (string, error)
+	SetGlobalInhibitRules(ctx context.Context, rules string) error
+
+	// Revision returns the current revision of the storage, which the
+	// revisions of configs changed later are greater than.
+	Revision(ctx context.Context) (int64, error)
+
+	JobStore
+	TemplateLibrary
+}
+
+// StorageUnavailableError is returned by AlertmanagerClient implementations
+// while the storage is degraded, the request may be retried after RetryAfter.
+type StorageUnavailableError struct {
+	RetryAfter time.Duration
+	Err        error
+}
 
-	RestoreConfig(userID string) error
+func (e *StorageUnavailableError) Error() string {
+	if e.Err == nil {
+		return "storage unavailable"
+	}
+	return "storage unavailable: " + e.Err.Error()
 }
@@ -0,0 +1,74 @@
+package alertmanager
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// uiPaths are the paths of the Alertmanager UI and the APIs it calls, below
+// the UI path prefix. Other paths served by a user's Alertmanager, like its
+// metrics and debug endpoints, are not exposed to the UI.
+var uiPaths = []string{
+	"/",
+	"/script.js",
+	"/favicon.ico",
+	"/lib/",
+	"/api/v1/",
+	"/api/v2/",
+}
+
+func isUIPath(p string) bool {
+	for _, prefix := range uiPaths {
+		if p == prefix || prefix != "/" && strings.HasSuffix(prefix, "/") && strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeUI serves the Alertmanager UI of the user the request was
+// authenticated as. The user is taken from the header set by the
+// authenticating proxy in front of the UI, and is passed to the user's
+// Alertmanager the same way as for API requests. Since the UI calls its APIs
+// relative to the page, these calls are served by ServeUI as well.
+func (am *MultitenantAlertmanager) ServeUI(w http.ResponseWriter, req *http.Request) {
+	userID := req.Header.Get(am.cfg.UIUserHeader)
+	if userID == "" {
+		http.Error(w, "no user in request", http.StatusUnauthorized)
+		return
+	}
+
+	uiPrefix := "/" + strings.Trim(am.cfg.UIPathPrefix, "/")
+	p := strings.TrimPrefix(req.URL.Path, uiPrefix)
+	if p == "" {
+		http.Redirect(w, req, uiPrefix+"/", http.StatusFound)
+		return
+	}
+	if clean := path.Clean(p); clean != "/" && strings.HasSuffix(p, "/") {
+		p = clean + "/"
+	} else {
+		p = clean
+	}
+	if !isUIPath(p) {
+		http.NotFound(w, req)
+		return
+	}
+
+	// Rewrite the request to the path the user's Alertmanager is served at.
+	amPath := "/" + strings.Trim(am.cfg.PathPrefix, "/") + p
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Path = amPath
+	u.RawPath = ""
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set(UserIDHeaderName, userID)
+
+	am.ServeHTTP(w, r)
+}
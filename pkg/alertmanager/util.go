@@ -2,6 +2,7 @@ package alertmanager
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -9,6 +10,15 @@ import (
 const (
 	// UserIDHeaderName denotes the UserID the request has been authenticated as
 	UserIDHeaderName = "X-AppsCode-UserID"
+	// ScopesHeaderName denotes the comma separated scopes granted to the
+	// authenticated request
+	ScopesHeaderName = "X-AppsCode-Scopes"
+	// ImpersonateHeaderName denotes the tenant an admin request is made for,
+	// see AdminAPI.Impersonate.
+	ImpersonateHeaderName = "X-Admin-Impersonate-Tenant"
+	// OperatorHeaderName names the operator making an impersonated request
+	// in the audit log.
+	OperatorHeaderName = "X-Admin-Operator"
 )
 
 func ExtractUserIDFromHTTPRequest(r *http.Request) (string, error) {
@@ -19,6 +29,16 @@ func ExtractUserIDFromHTTPRequest(r *http.Request) (string, error) {
 	return uid, nil
 }
 
+// hasScope returns true if the request has been granted the scope.
+func hasScope(r *http.Request, scope string) bool {
+	for _, s := range strings.Split(r.Header.Get(ScopesHeaderName), ",") {
+		if strings.TrimSpace(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
 func Must(err error) {
 	if err != nil {
 		panic(err)
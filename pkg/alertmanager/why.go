@@ -0,0 +1,202 @@
+package alertmanager
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/store"
+	"github.com/prometheus/common/model"
+)
+
+// AlertExplanation tells whether the notifications of an alert are
+// suppressed, and by what.
+type AlertExplanation struct {
+	Fingerprint string         `json:"fingerprint"`
+	Labels      model.LabelSet `json:"labels"`
+	Resolved    bool           `json:"resolved"`
+	// State is the state of the alert in the marker, one of active,
+	// suppressed and unprocessed.
+	State string `json:"state"`
+	// Suppressed is true if the alert is silenced or inhibited, or if a
+	// maintenance window suppresses its notifications to every receiver.
+	Suppressed  bool                  `json:"suppressed"`
+	Silences    []SilenceReason       `json:"silences,omitempty"`
+	Inhibitions []InhibitionReason    `json:"inhibitions,omitempty"`
+	Receivers   []ReceiverSuppression `json:"receivers"`
+}
+
+// SilenceReason is an active silence muting the alert.
+type SilenceReason struct {
+	ID        string    `json:"id"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+	EndsAt    time.Time `json:"endsAt"`
+}
+
+// InhibitionReason is a firing alert inhibiting the alert, with the
+// inhibition rules it matches.
+type InhibitionReason struct {
+	Fingerprint string `json:"fingerprint"`
+	// Labels are those of the inhibiting alert, unless it was removed
+	// meanwhile.
+	Labels model.LabelSet   `json:"labels,omitempty"`
+	Rules  []InhibitionRule `json:"rules,omitempty"`
+}
+
+// InhibitionRule is an inhibition rule of the config of the user, or a
+// global rule applied to all users.
+type InhibitionRule struct {
+	*config.InhibitRule
+	Global bool `json:"global,omitempty"`
+}
+
+// ReceiverSuppression tells whether the notifications of the alert to a
+// receiver it is routed to are suppressed by a maintenance window.
+type ReceiverSuppression struct {
+	Receiver          string `json:"receiver"`
+	GroupKey          string `json:"groupKey"`
+	MaintenanceWindow string `json:"maintenanceWindow,omitempty"`
+}
+
+// Explain tells why the notifications of the alert with the fingerprint
+// are suppressed. The silences and inhibitions are checked anew, which
+// updates the marker of the alert like the pipeline does.
+func (am *Alertmanager) Explain(fp model.Fingerprint) (*AlertExplanation, error) {
+	p := am.getPipeline()
+	if p == nil {
+		return nil, fmt.Errorf("no configuration applied")
+	}
+	alert, err := am.alerts.Get(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	p.inhibitor.Mutes(alert.Labels)
+	p.silencer.Mutes(alert.Labels)
+	status := am.marker.Status(fp)
+
+	e := &AlertExplanation{
+		Fingerprint: fp.String(),
+		Labels:      alert.Labels,
+		Resolved:    alert.ResolvedAt(now),
+		State:       string(status.State),
+		Receivers:   []ReceiverSuppression{},
+	}
+
+	if len(status.SilencedBy) > 0 {
+		sils, _, err := am.silences.Query(silence.QIDs(status.SilencedBy...))
+		if err != nil {
+			return nil, err
+		}
+		for _, sil := range sils {
+			e.Silences = append(e.Silences, SilenceReason{ID: sil.Id, CreatedBy: sil.CreatedBy, Comment: sil.Comment, EndsAt: sil.EndsAt})
+		}
+	}
+
+	for _, s := range status.InhibitedBy {
+		r := InhibitionReason{Fingerprint: s}
+		if sfp, err := model.ParseFingerprint(s); err == nil {
+			if source, err := am.alerts.Get(sfp); err == nil {
+				r.Labels = source.Labels
+				for i, rule := range p.inhibitRules {
+					if inhibits(rule, source.Labels, alert.Labels) {
+						r.Rules = append(r.Rules, InhibitionRule{InhibitRule: rule, Global: i >= len(p.conf.InhibitRules)})
+					}
+				}
+			}
+		}
+		e.Inhibitions = append(e.Inhibitions, r)
+	}
+
+	maintenance := notify.NewMaintenanceStage(p.conf.MaintenanceWindows)
+	maintained := 0
+	for _, r := range dispatch.NewRoute(p.conf.Route, nil).Match(alert.Labels) {
+		rs := ReceiverSuppression{
+			Receiver: r.RouteOpts.Receiver,
+			GroupKey: fmt.Sprintf("%s:%s", r.Key(), groupLabels(r, alert.Labels)),
+		}
+		if w, ok := maintenance.Suppressing(rs.Receiver, alert.Labels); ok {
+			rs.MaintenanceWindow = w
+			maintained++
+		}
+		e.Receivers = append(e.Receivers, rs)
+	}
+
+	e.Suppressed = len(e.Silences) > 0 || len(e.Inhibitions) > 0 || (maintained > 0 && maintained == len(e.Receivers))
+	return e, nil
+}
+
+// inhibits returns true if the rule inhibits the target alert when the
+// source alert fires.
+func inhibits(rule *config.InhibitRule, source, target model.LabelSet) bool {
+	if !labelsMatch(rule.TargetMatch, rule.TargetMatchRE, target) || !labelsMatch(rule.SourceMatch, rule.SourceMatchRE, source) {
+		return false
+	}
+	for _, ln := range rule.Equal {
+		if source[ln] != target[ln] {
+			return false
+		}
+	}
+	return true
+}
+
+func labelsMatch(match map[string]string, matchRE map[string]config.Regexp, lset model.LabelSet) bool {
+	for ln, v := range match {
+		if string(lset[model.LabelName(ln)]) != v {
+			return false
+		}
+	}
+	for ln, re := range matchRE {
+		if !re.MatchString(string(lset[model.LabelName(ln)])) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExplainAlert tells whether the notifications of an alert of the user are
+// suppressed, and by which silences, inhibiting alerts and maintenance
+// windows.
+func (am *MultitenantAlertmanager) ExplainAlert(w http.ResponseWriter, req *http.Request) {
+	userID, err := ExtractUserIDFromHTTPRequest(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	fp, err := model.ParseFingerprint(mux.Vars(req)["fingerprint"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid fingerprint: %v", err))
+		return
+	}
+	if am.proxyToLeader(w, req) {
+		return
+	}
+	userAM, err := am.getAlertmanager(userID)
+	if err == errNoAlertmanager {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	e, err := userAM.Explain(fp)
+	if err == store.ErrNotFound {
+		writeError(w, http.StatusNotFound, "alert not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
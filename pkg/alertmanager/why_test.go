@@ -0,0 +1,107 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/notify"
+
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestExplain(t *testing.T) {
+	am := newTestAlertmanager(t)
+	conf, err := notify.LoadConfig(`
+route:
+  receiver: team
+  routes:
+  - match:
+      team: db
+    receiver: db
+receivers:
+- name: team
+- name: db
+inhibit_rules:
+- source_match:
+    severity: critical
+  target_match:
+    severity: warning
+  equal: [cluster]
+maintenance_windows:
+- name: upgrade
+  start: 2000-01-01T00:00:00Z
+  end: 2100-01-01T00:00:00Z
+  matchers:
+    team: db
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.ApplyConfig(context.Background(), testUserID, conf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	alert := func(lset model.LabelSet) *types.Alert {
+		return &types.Alert{Alert: model.Alert{Labels: lset, StartsAt: now, EndsAt: now.Add(time.Hour)}, UpdatedAt: now}
+	}
+	critical := alert(model.LabelSet{"alertname": "Down", "severity": "critical", "cluster": "a"})
+	warning := alert(model.LabelSet{"alertname": "Slow", "severity": "warning", "cluster": "a"})
+	other := alert(model.LabelSet{"alertname": "Slow", "severity": "warning", "cluster": "b"})
+	db := alert(model.LabelSet{"alertname": "Slow", "team": "db", "cluster": "b"})
+	if err := am.alerts.Put(critical, warning, other, db); err != nil {
+		t.Fatal(err)
+	}
+
+	// The inhibitor learns about the source alerts asynchronously.
+	var e *AlertExplanation
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if e, err = am.Explain(warning.Fingerprint()); err != nil {
+			t.Fatal(err)
+		}
+		if len(e.Inhibitions) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !e.Suppressed || len(e.Inhibitions) != 1 || e.Inhibitions[0].Fingerprint != critical.Fingerprint().String() || len(e.Inhibitions[0].Rules) != 1 {
+		t.Fatalf("expected the warning to be inhibited by the critical alert, got %+v", e)
+	}
+
+	if e, err = am.Explain(other.Fingerprint()); err != nil {
+		t.Fatal(err)
+	}
+	if e.Suppressed || len(e.Receivers) != 1 || e.Receivers[0].Receiver != "team" {
+		t.Fatalf("expected the alert of another cluster not to be suppressed, got %+v", e)
+	}
+
+	id, err := am.silences.Set(&silencepb.Silence{
+		Matchers: []*silencepb.Matcher{{Type: silencepb.Matcher_EQUAL, Name: "cluster", Pattern: "b"}},
+		StartsAt: now, EndsAt: now.Add(time.Hour), CreatedBy: "ops", Comment: "migration",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err = am.Explain(other.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Suppressed || len(e.Silences) != 1 || e.Silences[0].ID != id || e.Silences[0].Comment != "migration" {
+		t.Fatalf("expected the alert to be silenced, got %+v", e)
+	}
+
+	e, err = am.Explain(db.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Receivers) != 1 || e.Receivers[0].MaintenanceWindow != "upgrade" {
+		t.Fatalf("expected the maintenance window to suppress the notifications to db, got %+v", e.Receivers)
+	}
+
+	if _, err := am.Explain(model.Fingerprint(1)); err == nil {
+		t.Fatal("expected an error for an unknown alert")
+	}
+}
@@ -1,11 +1,23 @@
 package alertmanager
 
-import "sync"
+import (
+	"context"
+	"sync"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
 
 const (
 	UpdateChannelBufferSize = 10000
 )
 
+// ErrResyncRequired is returned when config updates may have been missed,
+// and all configs have to be loaded again.
+var ErrResyncRequired = errors.New("config updates may have been missed, resync required")
+
 type AlertmanagerGetterWrapper struct {
 	amClient  AlertmanagerClient
 	amWatcher AlertmanagerWatcher
@@ -14,6 +26,9 @@ type AlertmanagerGetterWrapper struct {
 
 	// TODO: keep prometheus metric for the length?
 	newUpdates []AlertmanagerConfig
+	// resync is set when the watch missed updates.
+	resync  bool
+	updated chan struct{}
 }
 
 func NewAlertmanagerGetterWrapper(c AlertmanagerClient, w AlertmanagerWatcher) (AlertmanagerGetter, error) {
@@ -21,33 +36,81 @@ func NewAlertmanagerGetterWrapper(c AlertmanagerClient, w AlertmanagerWatcher) (
 		amClient:   c,
 		amWatcher:  w,
 		newUpdates: []AlertmanagerConfig{},
+		updated:    make(chan struct{}, 1),
 	}
 	go amGetter.RunUpdatesCollector()
 
 	return amGetter, nil
 }
 
-func (am *AlertmanagerGetterWrapper) GetAllConfigs() ([]AlertmanagerConfig, error) {
-	return am.amClient.GetAllConfigs()
+func (am *AlertmanagerGetterWrapper) ListConfigs(ctx context.Context, opts ListConfigsOptions) ([]AlertmanagerConfig, string, error) {
+	return am.amClient.ListConfigs(ctx, opts)
 }
 
-func (am *AlertmanagerGetterWrapper) GetAllUpdatedConfigs() ([]AlertmanagerConfig, error) {
+func (am *AlertmanagerGetterWrapper) GetAllUpdatedConfigs(ctx context.Context) ([]AlertmanagerConfig, error) {
 	// slice copy
 	var list []AlertmanagerConfig
 	am.mtx.Lock()
 	list = am.newUpdates
 	am.newUpdates = []AlertmanagerConfig{}
+	resync := am.resync
+	am.resync = false
 	am.mtx.Unlock()
+	if resync {
+		return nil, ErrResyncRequired
+	}
 	return list, nil
 }
 
+func (am *AlertmanagerGetterWrapper) Updated() <-chan struct{} {
+	return am.updated
+}
+
+func (am *AlertmanagerGetterWrapper) notifyUpdated() {
+	select {
+	case am.updated <- struct{}{}:
+	default:
+	}
+}
+
+func (am *AlertmanagerGetterWrapper) SetApplyStatus(ctx context.Context, userID, replica string, st *ApplyStatus) error {
+	return am.amClient.SetApplyStatus(ctx, userID, replica, st)
+}
+
+func (am *AlertmanagerGetterWrapper) DeleteApplyStatus(ctx context.Context, userID, replica string) error {
+	return am.amClient.DeleteApplyStatus(ctx, userID, replica)
+}
+
+func (am *AlertmanagerGetterWrapper) GetGlobalInhibitRules(ctx context.Context) (string, error) {
+	return am.amClient.GetGlobalInhibitRules(ctx)
+}
+
+func (am *AlertmanagerGetterWrapper) ListLibraryTemplates(ctx context.Context) ([]LibraryTemplate, error) {
+	return am.amClient.ListLibraryTemplates(ctx)
+}
+
+func (am *AlertmanagerGetterWrapper) Revision(ctx context.Context) (int64, error) {
+	return am.amClient.Revision(ctx)
+}
+
 func (am *AlertmanagerGetterWrapper) RunUpdatesCollector() {
 	ch := make(chan AlertmanagerConfig, UpdateChannelBufferSize)
-	go am.amWatcher.Watch(ch)
+	go func() {
+		for {
+			err := am.amWatcher.Watch(ch)
+			Must(level.Warn(logger.Logger).Log("msg", "config watch missed updates, resyncing", "err", err))
+
+			am.mtx.Lock()
+			am.resync = true
+			am.mtx.Unlock()
+			am.notifyUpdated()
+		}
+	}()
 
 	for rg := range ch {
 		am.mtx.Lock()
 		am.newUpdates = append(am.newUpdates, rg)
 		am.mtx.Unlock()
+		am.notifyUpdated()
 	}
 }
@@ -0,0 +1,108 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/cluster"
+)
+
+const (
+	// PeerWaitPosition makes the replicas wait for the notifications of the
+	// peers before them in the order of their names.
+	PeerWaitPosition = "position"
+	// PeerWaitZone orders the replicas by zone, so that the replicas in the
+	// zone of a failed one take over first, after the shorter
+	// cluster.zone-peer-timeout.
+	PeerWaitZone = "zone"
+)
+
+// peerZonesKey is the key of the gossiped zones of the peers.
+const peerZonesKey = "zones"
+
+// peerZones gossips the zones of the peers, which are not part of the
+// memberlist node metadata. The zones are exchanged with the full state, as
+// they rarely change.
+type peerZones struct {
+	peer *cluster.Peer
+
+	mtx sync.RWMutex
+	// zones holds the zone of every peer seen by name.
+	zones map[string]string
+}
+
+// newPeerZones gossips zone as the zone of peer through states.
+func newPeerZones(peer *cluster.Peer, states *peerStates, zone string) *peerZones {
+	z := &peerZones{
+		peer:  peer,
+		zones: map[string]string{peer.Name(): zone},
+	}
+	states.add(peerZonesKey, z)
+	return z
+}
+
+// MarshalBinary implements the cluster.State interface.
+func (z *peerZones) MarshalBinary() ([]byte, error) {
+	z.mtx.RLock()
+	defer z.mtx.RUnlock()
+	return json.Marshal(z.zones)
+}
+
+// Merge implements the cluster.State interface. The zone of this peer is
+// only set locally.
+func (z *peerZones) Merge(b []byte) error {
+	var zones map[string]string
+	if err := json.Unmarshal(b, &zones); err != nil {
+		return err
+	}
+	self := z.peer.Name()
+	z.mtx.Lock()
+	defer z.mtx.Unlock()
+	for name, zone := range zones {
+		if name != self {
+			z.zones[name] = zone
+		}
+	}
+	return nil
+}
+
+// wait returns the wait of the peer, with the peers sorted by zone and then
+// by name. The peers of a zone wait zoneTimeout for each peer before them in
+// the zone, and peerTimeout for each zone before theirs.
+func (z *peerZones) wait(zoneTimeout, peerTimeout time.Duration) func() time.Duration {
+	return func() time.Duration {
+		self := z.peer.Name()
+		var names []string
+		for _, n := range z.peer.Peers() {
+			names = append(names, n.Name)
+		}
+
+		z.mtx.RLock()
+		zones := make(map[string]string, len(names))
+		for _, name := range names {
+			zones[name] = z.zones[name]
+		}
+		z.mtx.RUnlock()
+		zoneRank, position := zoneOrder(self, zones)
+		return time.Duration(zoneRank)*peerTimeout + time.Duration(position)*zoneTimeout
+	}
+}
+
+// zoneOrder returns the rank of the zone of self among the zones of the
+// peers, and the position of self among the peers of its zone. Peers with an
+// unknown zone are in the zone "".
+func zoneOrder(self string, zones map[string]string) (zoneRank, position int) {
+	own := zones[self]
+	seen := map[string]bool{}
+	for name, zone := range zones {
+		if zone < own && !seen[zone] {
+			seen[zone] = true
+			zoneRank++
+		}
+		if zone == own && name < self {
+			position++
+		}
+	}
+	return zoneRank, position
+}
@@ -0,0 +1,32 @@
+package alertmanager
+
+import "testing"
+
+func TestZoneOrder(t *testing.T) {
+	zones := map[string]string{
+		"a1": "zone-a",
+		"a2": "zone-a",
+		"b1": "zone-b",
+		"b2": "zone-b",
+		"c1": "zone-c",
+		"x1": "",
+	}
+	for _, tc := range []struct {
+		self         string
+		wantZoneRank int
+		wantPosition int
+	}{
+		// Peers of an unknown zone come first.
+		{self: "x1", wantZoneRank: 0, wantPosition: 0},
+		{self: "a1", wantZoneRank: 1, wantPosition: 0},
+		{self: "a2", wantZoneRank: 1, wantPosition: 1},
+		{self: "b1", wantZoneRank: 2, wantPosition: 0},
+		{self: "b2", wantZoneRank: 2, wantPosition: 1},
+		{self: "c1", wantZoneRank: 3, wantPosition: 0},
+	} {
+		zoneRank, position := zoneOrder(tc.self, zones)
+		if zoneRank != tc.wantZoneRank || position != tc.wantPosition {
+			t.Errorf("%s: got zone rank %d and position %d, want %d and %d", tc.self, zoneRank, position, tc.wantZoneRank, tc.wantPosition)
+		}
+	}
+}
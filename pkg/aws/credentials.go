@@ -0,0 +1,320 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ec2MetadataURL     = "http://169.254.169.254/latest"
+	ecsCredentialsHost = "http://169.254.170.2"
+
+	// Credentials are refreshed this long before they expire.
+	expiryWindow = 5 * time.Minute
+	// fetchTimeout bounds fetching credentials, which is shared by the
+	// callers waiting for them and so not canceled with any of them.
+	fetchTimeout = 30 * time.Second
+)
+
+// Credentials are the AWS credentials used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expiration is zero for credentials which do not expire.
+	Expiration time.Time
+}
+
+func (c Credentials) expired() bool {
+	return !c.Expiration.IsZero() && time.Now().Add(expiryWindow).After(c.Expiration)
+}
+
+// CredentialsProvider returns credentials used to sign requests.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials always returns the same credentials.
+type StaticCredentials Credentials
+
+func (s StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// NewCredentialsProvider returns a provider for the given static keys. If no
+// keys are given, the credentials are looked up the same way as the AWS SDK
+// does: environment variables, web identity token (IRSA), ECS task role and
+// EC2 instance role. These are the credentials of the process, the callers
+// must check they may be used. If roleARN is set, the resolved credentials
+// are used to assume that role.
+func NewCredentialsProvider(region, accessKey, secretKey, roleARN string) CredentialsProvider {
+	var p CredentialsProvider
+	if accessKey != "" {
+		p = StaticCredentials{AccessKeyID: accessKey, SecretAccessKey: secretKey}
+	} else {
+		p = &cachedCredentials{fetch: defaultChain}
+	}
+	if roleARN != "" {
+		base := p
+		p = &cachedCredentials{fetch: func(ctx context.Context) (Credentials, error) {
+			return assumeRole(ctx, region, roleARN, base)
+		}}
+	}
+	return p
+}
+
+// cachedCredentials caches the fetched credentials until they expire.
+// Concurrent callers missing credentials wait for a single fetch.
+type cachedCredentials struct {
+	mtx   sync.Mutex
+	creds Credentials
+	valid bool
+	call  *credentialsCall
+	fetch func(ctx context.Context) (Credentials, error)
+}
+
+// credentialsCall is a fetch of credentials in flight.
+type credentialsCall struct {
+	done  chan struct{}
+	creds Credentials
+	err   error
+}
+
+func (c *cachedCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	c.mtx.Lock()
+	if c.valid && !c.creds.expired() {
+		creds := c.creds
+		c.mtx.Unlock()
+		return creds, nil
+	}
+	call := c.call
+	if call == nil {
+		call = &credentialsCall{done: make(chan struct{})}
+		c.call = call
+		go c.run(call)
+	}
+	c.mtx.Unlock()
+
+	select {
+	case <-call.done:
+		return call.creds, call.err
+	case <-ctx.Done():
+		return Credentials{}, ctx.Err()
+	}
+}
+
+// run fetches the credentials of call, without holding the lock.
+func (c *cachedCredentials) run(call *credentialsCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	call.creds, call.err = c.fetch(ctx)
+
+	c.mtx.Lock()
+	if call.err == nil {
+		c.creds, c.valid = call.creds, true
+	}
+	c.call = nil
+	c.mtx.Unlock()
+	close(call.done)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func defaultChain(ctx context.Context) (Credentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	if file := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); file != "" {
+		return webIdentityCredentials(ctx, file, os.Getenv("AWS_ROLE_ARN"))
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return containerCredentials(ctx, ecsCredentialsHost+uri)
+	}
+	return instanceCredentials(ctx)
+}
+
+type credentialsJSON struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (c credentialsJSON) credentials() Credentials {
+	return Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.Token,
+		Expiration:      c.Expiration,
+	}
+}
+
+func containerCredentials(ctx context.Context, u string) (Credentials, error) {
+	var creds credentialsJSON
+	if err := getJSON(ctx, u, nil, &creds); err != nil {
+		return Credentials{}, errors.Wrap(err, "failed to get container credentials")
+	}
+	return creds.credentials(), nil
+}
+
+func instanceCredentials(ctx context.Context) (Credentials, error) {
+	// IMDSv2 token. Fall back to IMDSv1 if it can not be obtained.
+	header := http.Header{}
+	req, err := http.NewRequest(http.MethodPut, ec2MetadataURL+"/api/token", nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	if resp, err := httpClient.Do(req.WithContext(ctx)); err == nil {
+		token, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			header.Set("X-aws-ec2-metadata-token", string(token))
+		}
+	}
+
+	role, err := getString(ctx, ec2MetadataURL+"/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "no credentials found")
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+
+	var creds credentialsJSON
+	if err := getJSON(ctx, ec2MetadataURL+"/meta-data/iam/security-credentials/"+role, header, &creds); err != nil {
+		return Credentials{}, errors.Wrap(err, "failed to get instance credentials")
+	}
+	return creds.credentials(), nil
+}
+
+type stsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+func webIdentityCredentials(ctx context.Context, tokenFile, roleARN string) (Credentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "failed to read web identity token")
+	}
+	params := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {"alertmanager"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	return callSTS(ctx, "", params, nil)
+}
+
+func assumeRole(ctx context.Context, region, roleARN string, base CredentialsProvider) (Credentials, error) {
+	params := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {roleARN},
+		"RoleSessionName": {"alertmanager"},
+	}
+	return callSTS(ctx, region, params, base)
+}
+
+// callSTS calls the STS API. The request is only signed if base is not nil.
+func callSTS(ctx context.Context, region string, params url.Values, base CredentialsProvider) (Credentials, error) {
+	endpoint := "https://sts.amazonaws.com/"
+	if region == "" {
+		region = "us-east-1"
+	} else {
+		endpoint = "https://sts." + region + ".amazonaws.com/"
+	}
+
+	body := []byte(params.Encode())
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if base != nil {
+		creds, err := base.Credentials(ctx)
+		if err != nil {
+			return Credentials{}, err
+		}
+		Signer{Region: region, Service: "sts"}.Sign(req, body, creds, time.Now())
+	}
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return Credentials{}, errors.Wrapf(err, "%s failed", params.Get("Action"))
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, errors.Errorf("%s failed with status code %d: %s", params.Get("Action"), resp.StatusCode, data)
+	}
+
+	// The result element is named after the action.
+	var out struct {
+		AssumeRole  stsCredentials `xml:"AssumeRoleResult>Credentials"`
+		WebIdentity stsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(data, &out); err != nil {
+		return Credentials{}, errors.Wrap(err, "failed to decode STS response")
+	}
+	c := out.AssumeRole
+	if c.AccessKeyID == "" {
+		c = out.WebIdentity
+	}
+	return Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration,
+	}, nil
+}
+
+func getString(ctx context.Context, u string, header http.Header) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status code %d from %s", resp.StatusCode, u)
+	}
+	return string(data), nil
+}
+
+func getJSON(ctx context.Context, u string, header http.Header, v interface{}) error {
+	s, err := getString(ctx, u, header)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(s), v)
+}
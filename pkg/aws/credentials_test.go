@@ -0,0 +1,41 @@
+package aws
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedCredentials(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	c := &cachedCredentials{fetch: func(ctx context.Context) (Credentials, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return Credentials{AccessKeyID: "id", Expiration: time.Now().Add(time.Hour)}, nil
+	}}
+
+	// A caller giving up does not block the others behind the fetch.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Credentials(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want the caller to time out", err)
+	}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel2()
+	if _, err := c.Credentials(ctx2); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want the caller to time out", err)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		creds, err := c.Credentials(context.Background())
+		if err != nil || creds.AccessKeyID != "id" {
+			t.Fatalf("got %+v, %v", creds, err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("credentials fetched %d times, want once", n)
+	}
+}
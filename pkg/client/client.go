@@ -0,0 +1,538 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// UserIDHeaderName is the header holding the user requests are made for.
+	UserIDHeaderName = "X-AppsCode-UserID"
+	// DefaultPathPrefix is the default path prefix of the Alertmanagers of
+	// the users.
+	DefaultPathPrefix = "/api/prom/alertmanager"
+)
+
+// Error is the error response of the API. Details locate the validation
+// errors of configs and templates.
+type Error struct {
+	StatusCode int           `json:"-"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Details    []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail is a validation error of a config or template file.
+type ErrorDetail struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Message)
+	for _, d := range e.Details {
+		loc := d.File
+		if d.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", loc, d.Line)
+		}
+		if d.Field != "" {
+			loc = strings.TrimPrefix(loc+" "+d.Field, " ")
+		}
+		if loc != "" {
+			msg += fmt.Sprintf("\n  %s: %s", loc, d.Message)
+		} else {
+			msg += "\n  " + d.Message
+		}
+	}
+	return msg
+}
+
+// Client makes requests to the API on behalf of a single user.
+type Client struct {
+	url        string
+	userID     string
+	token      string
+	pathPrefix string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken sets the bearer token sent to an authenticating proxy.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithPathPrefix sets the path prefix of the Alertmanagers of the users.
+func WithPathPrefix(prefix string) Option {
+	return func(c *Client) { c.pathPrefix = "/" + strings.Trim(prefix, "/") }
+}
+
+// WithHTTPClient sets the HTTP client requests are made with.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// New creates a client of the API served at serverURL for the user.
+func New(serverURL, userID string, opts ...Option) (*Client, error) {
+	if _, err := url.Parse(serverURL); err != nil {
+		return nil, errors.Wrap(err, "invalid server url")
+	}
+	if userID == "" {
+		return nil, errors.New("user id must be non empty")
+	}
+	c := &Client{
+		url:        strings.TrimSuffix(serverURL, "/"),
+		userID:     userID,
+		pathPrefix: DefaultPathPrefix,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// GetConfig returns the config of the user with its apply status. Secrets are
+// redacted unless reveal is set.
+func (c *Client) GetConfig(ctx context.Context, reveal bool) (*ConfigWithStatus, error) {
+	path := "/api/v1/config"
+	if reveal {
+		path += "?reveal=true"
+	}
+	var cfg ConfigWithStatus
+	if err := c.do(ctx, http.MethodGet, path, nil, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SetConfig replaces the config of the user. It returns the lint warnings
+// of the stored config.
+func (c *Client) SetConfig(ctx context.Context, cfg *Config) ([]LintWarning, error) {
+	var res LintResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/config", cfg, &res); err != nil {
+		return nil, err
+	}
+	return res.Warnings, nil
+}
+
+// PutConfig replaces the config of the user if the stored config has the
+// ETag ifMatch, or unconditionally if ifMatch is empty. It returns the lint
+// warnings and the ETag of the stored config. Putting the stored config
+// again changes nothing. A changed stored config fails with an *Error with
+// StatusCode 412.
+func (c *Client) PutConfig(ctx context.Context, cfg *Config, ifMatch string) ([]LintWarning, string, error) {
+	header := http.Header{}
+	if ifMatch != "" {
+		header.Set("If-Match", ifMatch)
+	}
+	var res LintResult
+	h, err := c.doHeader(ctx, http.MethodPut, "/api/v1/config", header, cfg, &res)
+	if err != nil {
+		return nil, "", err
+	}
+	return res.Warnings, h.Get("ETag"), nil
+}
+
+// LintConfig returns the lint warnings of the stored config of the user.
+func (c *Client) LintConfig(ctx context.Context) ([]LintWarning, error) {
+	var res LintResult
+	if err := c.do(ctx, http.MethodGet, "/api/v1/config/lint", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Warnings, nil
+}
+
+// DiffConfig returns the difference between the stored config of the user
+// and cfg, which is not stored.
+func (c *Client) DiffConfig(ctx context.Context, cfg *Config) (*ConfigDiff, error) {
+	var d ConfigDiff
+	if err := c.do(ctx, http.MethodPost, "/api/v1/config/diff", cfg, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ExportGrafana returns the receivers and routes of the config of the user
+// as a Grafana alerting provisioning file of the organization orgID.
+func (c *Client) ExportGrafana(ctx context.Context, orgID int, reveal bool) ([]byte, error) {
+	q := url.Values{"format": {"grafana"}, "orgId": {strconv.Itoa(orgID)}}
+	if reveal {
+		q.Set("reveal", "true")
+	}
+	var data []byte
+	if err := c.do(ctx, http.MethodGet, "/api/v1/config/export?"+q.Encode(), nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DeactivateConfig deactivates the config of the user.
+func (c *Client) DeactivateConfig(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/config/deactivate", nil, nil)
+}
+
+// RestoreConfig restores the deactivated config of the user.
+func (c *Client) RestoreConfig(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/config/restore", nil, nil)
+}
+
+// GetConfigStatus returns whether the stored config was applied.
+func (c *Client) GetConfigStatus(ctx context.Context) (*ConfigStatus, error) {
+	var st ConfigStatus
+	if err := c.do(ctx, http.MethodGet, "/api/v1/config/status", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// RouteTest returns the routes the label sets of req are matched by.
+func (c *Client) RouteTest(ctx context.Context, req *RouteTestRequest) ([]RouteTestResult, error) {
+	var results []RouteTestResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/config/route-test", req, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SetTiming overrides the notification timings of the routes of receivers.
+func (c *Client) SetTiming(ctx context.Context, req *TimingRequest) error {
+	return c.do(ctx, http.MethodPatch, "/api/v1/config/timing", req, nil)
+}
+
+// GetRetention returns the retention overrides of the user, and the
+// retention applied.
+func (c *Client) GetRetention(ctx context.Context) (*RetentionStatus, error) {
+	var st RetentionStatus
+	if err := c.do(ctx, http.MethodGet, "/api/v1/config/retention", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// SetRetention replaces the retention overrides of the user.
+func (c *Client) SetRetention(ctx context.Context, o *RetentionOverrides) error {
+	return c.do(ctx, http.MethodPut, "/api/v1/config/retention", o, nil)
+}
+
+// GetCanary returns the canary config of the user, running or finished.
+func (c *Client) GetCanary(ctx context.Context) (*CanaryConfig, error) {
+	var canary CanaryConfig
+	if err := c.do(ctx, http.MethodGet, "/api/v1/config/canary", nil, &canary); err != nil {
+		return nil, err
+	}
+	return &canary, nil
+}
+
+// SetCanary starts a canary of cfg, replacing the canary of the user. The
+// config of the user is replaced with cfg if the canary succeeds.
+func (c *Client) SetCanary(ctx context.Context, cfg *Config, opts CanaryOptions) error {
+	params := url.Values{}
+	if opts.Duration > 0 {
+		params.Set("duration", model.Duration(opts.Duration).String())
+	}
+	if opts.MaxErrors > 0 {
+		params.Set("maxErrors", strconv.Itoa(opts.MaxErrors))
+	}
+	if opts.Receiver != "" {
+		params.Set("receiver", opts.Receiver)
+	}
+	path := "/api/v1/config/canary"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	return c.do(ctx, http.MethodPut, path, cfg, nil)
+}
+
+// DeleteCanary stops the running canary of the user without promoting it.
+func (c *Client) DeleteCanary(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/config/canary", nil, nil)
+}
+
+// ListMaintenanceWindows returns the maintenance windows of the user.
+func (c *Client) ListMaintenanceWindows(ctx context.Context) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	if err := c.do(ctx, http.MethodGet, "/api/v1/maintenance-windows", nil, &windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// SetMaintenanceWindow adds a maintenance window, or replaces the window of
+// the same name.
+func (c *Client) SetMaintenanceWindow(ctx context.Context, w *MaintenanceWindow) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/maintenance-windows", w, nil)
+}
+
+// DeleteMaintenanceWindow removes a maintenance window.
+func (c *Client) DeleteMaintenanceWindow(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/maintenance-windows/"+url.PathEscape(name), nil, nil)
+}
+
+// ListRecurringSilences returns the recurring silences of the user.
+func (c *Client) ListRecurringSilences(ctx context.Context) ([]RecurringSilence, error) {
+	var silences []RecurringSilence
+	if err := c.do(ctx, http.MethodGet, "/api/v1/recurring-silences", nil, &silences); err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+// SetRecurringSilence adds a recurring silence, or replaces the recurring
+// silence of the same name.
+func (c *Client) SetRecurringSilence(ctx context.Context, s *RecurringSilence) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/recurring-silences", s, nil)
+}
+
+// DeleteRecurringSilence removes a recurring silence, expiring the silences
+// of its occurrences.
+func (c *Client) DeleteRecurringSilence(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/recurring-silences/"+url.PathEscape(name), nil, nil)
+}
+
+// TestReceiver sends a test notification with each integration of the
+// receiver.
+func (c *Client) TestReceiver(ctx context.Context, name string) (*ReceiverTest, error) {
+	var rt ReceiverTest
+	if err := c.do(ctx, http.MethodPost, "/api/v1/receivers/"+url.PathEscape(name)+"/test", nil, &rt); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// AcknowledgeAlertGroup stops the escalation of an alert group of a
+// receiver until the group resolves.
+func (c *Client) AcknowledgeAlertGroup(ctx context.Context, receiver, groupKey string) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/escalations/ack", &AcknowledgeRequest{Receiver: receiver, GroupKey: groupKey}, nil)
+}
+
+// GetStatus returns the health of the Alertmanager of the user. The status
+// of a down Alertmanager is returned with an error.
+func (c *Client) GetStatus(ctx context.Context) (*Status, error) {
+	var st Status
+	err := c.do(ctx, http.MethodGet, "/api/v1/status", nil, &st)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusServiceUnavailable {
+		return &st, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// ExplainAlert tells whether the notifications of the alert with the
+// fingerprint are suppressed, and by what.
+func (c *Client) ExplainAlert(ctx context.Context, fingerprint string) (*AlertExplanation, error) {
+	var e AlertExplanation
+	if err := c.do(ctx, http.MethodGet, "/api/v1/alerts/"+url.PathEscape(fingerprint)+"/why", nil, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// LookupNotifications returns the aggregation groups of the alert with the
+// fingerprint, or with the label set if the fingerprint is empty, and their
+// last notifications.
+func (c *Client) LookupNotifications(ctx context.Context, fingerprint string, lset model.LabelSet) (*NotificationLookup, error) {
+	params := url.Values{}
+	if fingerprint != "" {
+		params.Set("fingerprint", fingerprint)
+	}
+	for ln, v := range lset {
+		params.Add("label", fmt.Sprintf("%s=%q", ln, v))
+	}
+	var l NotificationLookup
+	if err := c.do(ctx, http.MethodGet, "/api/v1/alerts/notifications?"+params.Encode(), nil, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// AlertHistory returns the archived alert groups resolved between since and
+// until, with the alerts matching all the matchers, like
+// alertname="HighLatency". Zero times and limit use the server defaults.
+func (c *Client) AlertHistory(ctx context.Context, since, until time.Time, limit int, matchers ...string) ([]ArchivedGroup, error) {
+	params := url.Values{}
+	if !since.IsZero() {
+		params.Set("since", since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		params.Set("until", until.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	if len(matchers) > 0 {
+		params["matcher"] = matchers
+	}
+	path := "/api/v1/alerts/history"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var groups []ArchivedGroup
+	if err := c.do(ctx, http.MethodGet, path, nil, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// ReportSummary summarizes the alerts resolved between since and until,
+// ranking the top alertnames. Zero times and top use the server defaults.
+func (c *Client) ReportSummary(ctx context.Context, since, until time.Time, top int) (*ReportSummary, error) {
+	params := url.Values{}
+	if !since.IsZero() {
+		params.Set("since", since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		params.Set("until", until.Format(time.RFC3339))
+	}
+	if top > 0 {
+		params.Set("top", strconv.Itoa(top))
+	}
+	path := "/api/v1/reports/summary"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var rs ReportSummary
+	if err := c.do(ctx, http.MethodGet, path, nil, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// ListSilences returns the silences matching all the filters, like
+// name=value.
+func (c *Client) ListSilences(ctx context.Context, filters ...string) ([]Silence, error) {
+	path := c.pathPrefix + "/api/v2/silences"
+	if len(filters) > 0 {
+		path += "?" + url.Values{"filter": filters}.Encode()
+	}
+	var sils []Silence
+	if err := c.do(ctx, http.MethodGet, path, nil, &sils); err != nil {
+		return nil, err
+	}
+	return sils, nil
+}
+
+// CreateSilence creates a silence, or updates the silence with its ID, and
+// returns its ID.
+func (c *Client) CreateSilence(ctx context.Context, sil *Silence) (string, error) {
+	var resp struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.pathPrefix+"/api/v2/silences", sil, &resp); err != nil {
+		return "", err
+	}
+	return resp.SilenceID, nil
+}
+
+// ExpireSilence expires a silence.
+func (c *Client) ExpireSilence(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.pathPrefix+"/api/v2/silence/"+url.PathEscape(id), nil, nil)
+}
+
+// ExportSilences returns the active and pending silences of the user, and
+// the expired ones if expired is set.
+func (c *Client) ExportSilences(ctx context.Context, expired bool) (*SilenceExport, error) {
+	path := "/api/v1/silences/export"
+	if expired {
+		path += "?expired=true"
+	}
+	var export SilenceExport
+	if err := c.do(ctx, http.MethodGet, path, nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ImportSilences creates the silences of an export with new IDs. Expired
+// silences and silences equal to an unexpired silence are skipped.
+func (c *Client) ImportSilences(ctx context.Context, export *SilenceExport) (*SilenceImportResult, error) {
+	var res SilenceImportResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/silences/import", export, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// do sends a request with a JSON body, if in is not nil, and decodes the
+// JSON response into out, if out is not nil. Error responses are returned as
+// *Error, with their body decoded into out if it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	_, err := c.doHeader(ctx, method, path, nil, in, out)
+	return err
+}
+
+// doHeader is do sending the request headers header, and returning the
+// response headers.
+func (c *Client) doHeader(ctx context.Context, method, path string, header http.Header, in, out interface{}) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(UserIDHeaderName, c.userID)
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to server")
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		e := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		if out != nil {
+			_ = json.Unmarshal(data, out)
+		}
+		return resp.Header, e
+	}
+	if out == nil || len(data) == 0 {
+		return resp.Header, nil
+	}
+	// Responses which are not JSON are returned raw.
+	if raw, ok := out.(*[]byte); ok {
+		*raw = data
+		return resp.Header, nil
+	}
+	return resp.Header, errors.Wrap(json.Unmarshal(data, out), "failed to decode response")
+}
@@ -0,0 +1,441 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// The models follow the schemas of the OpenAPI specification served at
+// /api/v1/openapi.json. Durations are formatted like 5m, as in configs.
+
+// Config is the Alertmanager config of a user with its template files.
+type Config struct {
+	UserID              string            `json:"userID,omitempty"`
+	Config              string            `json:"config"`
+	TemplateFiles       map[string]string `json:"templateFiles,omitempty"`
+	ExternalURL         string            `json:"externalURL,omitempty"`
+	UpdatedAtInUnix     int64             `json:"updatedAtInUnix,omitempty"`
+	DeactivatedAtInUnix int64             `json:"deactivatedAtInUnix,omitempty"`
+	// Revision is the revision of the stored config. If it is set,
+	// SetConfig fails with an *Error with StatusCode 409 when the stored
+	// config has another revision.
+	Revision int64 `json:"revision,omitempty"`
+	// Labels are set by operators, they are ignored by SetConfig.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Features override the feature flags enabled by default, they are set
+	// by operators and ignored by SetConfig.
+	Features map[string]bool `json:"features,omitempty"`
+	// Retention is set with SetRetention, it is ignored by SetConfig.
+	Retention *RetentionOverrides `json:"retention,omitempty"`
+	// Canary is set with SetCanary, it is ignored by SetConfig.
+	Canary *CanaryConfig `json:"canary,omitempty"`
+}
+
+// CanaryConfig is a candidate config run in shadow next to the applied
+// config, promoted if it renders its notifications with at most MaxErrors
+// errors for Duration, and rolled back otherwise.
+type CanaryConfig struct {
+	Config        string            `json:"config,omitempty"`
+	TemplateFiles map[string]string `json:"templateFiles,omitempty"`
+	Duration      string            `json:"duration"`
+	MaxErrors     int               `json:"maxErrors"`
+	// Receiver is the receiver whose notifications are sent during the
+	// canary.
+	Receiver         string `json:"receiver,omitempty"`
+	Status           string `json:"status"`
+	StartedAtInUnix  int64  `json:"startedAtInUnix"`
+	FinishedAtInUnix int64  `json:"finishedAtInUnix,omitempty"`
+	CanaryStats
+}
+
+// CanaryOptions are the thresholds of a canary config. Zero values use the
+// server defaults.
+type CanaryOptions struct {
+	Duration  time.Duration
+	MaxErrors int
+	Receiver  string
+}
+
+// CanaryStats counts the notifications rendered by a canary config.
+type CanaryStats struct {
+	Rendered  int    `json:"rendered"`
+	Errors    int    `json:"errors"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// RetentionOverrides override the retention of the state of the
+// Alertmanager, as durations like 120h. Unset durations default to those of
+// the replicas.
+type RetentionOverrides struct {
+	Silences        string `json:"silences,omitempty"`
+	NotificationLog string `json:"notificationLog,omitempty"`
+	AlertGCInterval string `json:"alertGCInterval,omitempty"`
+}
+
+// RetentionStatus is the retention as set and as applied.
+type RetentionStatus struct {
+	Overrides RetentionOverrides `json:"overrides"`
+	Effective RetentionOverrides `json:"effective"`
+}
+
+// ConfigWithStatus is a config with the outcome of applying it by replica.
+type ConfigWithStatus struct {
+	Config
+	ApplyStatus map[string]ApplyStatus `json:"applyStatus,omitempty"`
+}
+
+// ApplyStatus is the outcome of applying a config on a replica.
+type ApplyStatus struct {
+	ConfigUpdatedAtInUnix int64      `json:"configUpdatedAtInUnix,omitempty"`
+	LastAppliedAt         *time.Time `json:"lastAppliedAt,omitempty"`
+	LastError             string     `json:"lastError,omitempty"`
+	LastErrorAt           *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// ConfigStatus tells whether the stored config was applied by the replicas.
+type ConfigStatus struct {
+	UpdatedAtInUnix int64                  `json:"updatedAtInUnix,omitempty"`
+	Applied         bool                   `json:"applied"`
+	Replicas        map[string]ApplyStatus `json:"replicas"`
+}
+
+// LintWarning is a best practice the config does not follow.
+type LintWarning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// LintResult lists the lint warnings of the config.
+type LintResult struct {
+	Warnings []LintWarning `json:"warnings"`
+}
+
+// ConfigDiff is the difference between the stored config and a proposed
+// one.
+type ConfigDiff struct {
+	Routes              []RouteDiff    `json:"routes"`
+	Receivers           []ReceiverDiff `json:"receivers"`
+	Global              []FieldChange  `json:"global"`
+	InhibitRulesChanged bool           `json:"inhibitRulesChanged"`
+	Templates           []TemplateDiff `json:"templates"`
+}
+
+// RouteDiff is a route added, removed or changed.
+type RouteDiff struct {
+	RouteKey string        `json:"routeKey"`
+	Receiver string        `json:"receiver"`
+	Change   string        `json:"change"`
+	Fields   []FieldChange `json:"fields,omitempty"`
+}
+
+// ReceiverDiff is a receiver added, removed or changed.
+type ReceiverDiff struct {
+	Name           string        `json:"name"`
+	Change         string        `json:"change"`
+	Fields         []FieldChange `json:"fields,omitempty"`
+	SecretsChanged bool          `json:"secretsChanged,omitempty"`
+}
+
+// FieldChange is a changed field. The values of secrets are not returned.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// TemplateDiff is a template file added, removed or changed.
+type TemplateDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// RouteTestRequest holds the label sets to route. If Config is empty, the
+// stored config is used.
+type RouteTestRequest struct {
+	Config string           `json:"config,omitempty"`
+	Alerts []model.LabelSet `json:"alerts"`
+}
+
+// RouteTestResult lists the routes matched by a label set.
+type RouteTestResult struct {
+	Labels model.LabelSet `json:"labels"`
+	Routes []RouteMatch   `json:"routes"`
+}
+
+// RouteMatch describes a matched route and how alerts are grouped on it.
+type RouteMatch struct {
+	Receiver       string         `json:"receiver"`
+	RouteKey       string         `json:"routeKey"`
+	Matchers       []string       `json:"matchers,omitempty"`
+	Continue       bool           `json:"continue"`
+	GroupBy        []string       `json:"groupBy"`
+	GroupByAll     bool           `json:"groupByAll,omitempty"`
+	GroupLabels    model.LabelSet `json:"groupLabels"`
+	GroupWait      string         `json:"groupWait"`
+	GroupInterval  string         `json:"groupInterval"`
+	RepeatInterval string         `json:"repeatInterval"`
+}
+
+// TimingRequest holds the timing overrides by receiver name.
+type TimingRequest struct {
+	Receivers map[string]TimingOverride `json:"receivers"`
+}
+
+// TimingOverride overrides the timings of the routes of a receiver. Empty
+// timings are kept.
+type TimingOverride struct {
+	GroupWait      string `json:"group_wait,omitempty"`
+	GroupInterval  string `json:"group_interval,omitempty"`
+	RepeatInterval string `json:"repeat_interval,omitempty"`
+}
+
+// MaintenanceWindow mutes notifications during a recurring or one-off
+// period.
+type MaintenanceWindow struct {
+	Name      string         `json:"name"`
+	Schedule  string         `json:"schedule,omitempty"`
+	RRule     string         `json:"rrule,omitempty"`
+	Duration  string         `json:"duration,omitempty"`
+	TimeZone  string         `json:"time_zone,omitempty"`
+	Start     *time.Time     `json:"start,omitempty"`
+	End       *time.Time     `json:"end,omitempty"`
+	Matchers  model.LabelSet `json:"matchers,omitempty"`
+	Receivers []string       `json:"receivers,omitempty"`
+}
+
+// RecurringSilence silences the matching alerts during the occurrences of
+// a cron schedule or a recurrence rule. The occurrences are created as
+// silences authored by recurring-silence:<name>.
+type RecurringSilence struct {
+	Name     string            `json:"name"`
+	Schedule string            `json:"schedule,omitempty"`
+	RRule    string            `json:"rrule,omitempty"`
+	Duration string            `json:"duration"`
+	TimeZone string            `json:"time_zone,omitempty"`
+	Match    map[string]string `json:"match,omitempty"`
+	MatchRE  map[string]string `json:"match_re,omitempty"`
+	Comment  string            `json:"comment,omitempty"`
+}
+
+// AcknowledgeRequest acknowledges an alert group of a receiver with
+// escalations.
+type AcknowledgeRequest struct {
+	Receiver string `json:"receiver"`
+	GroupKey string `json:"groupKey"`
+}
+
+// ReceiverTest is the outcome of a test notification sent with each
+// integration of a receiver.
+type ReceiverTest struct {
+	Receiver     string                  `json:"receiver"`
+	Integrations []IntegrationTestResult `json:"integrations"`
+}
+
+// IntegrationTestResult is the outcome of a test notification sent with an
+// integration, with the responses of the downstream service if known.
+type IntegrationTestResult struct {
+	Name      string             `json:"name"`
+	Delivered bool               `json:"delivered"`
+	Retryable bool               `json:"retryable,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Responses []ReceiverResponse `json:"responses,omitempty"`
+}
+
+// ReceiverResponse is a response of the downstream service of an
+// integration, with the beginning of its body.
+type ReceiverResponse struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+	Body       string `json:"body,omitempty"`
+}
+
+// Status is the health of the Alertmanager of a user on a replica.
+type Status struct {
+	UserID          string     `json:"userID"`
+	Health          string     `json:"health"`
+	Running         bool       `json:"running"`
+	Parked          bool       `json:"parked,omitempty"`
+	ConfigUpdatedAt *time.Time `json:"configUpdatedAt,omitempty"`
+	ApplyStatus
+	Notifications *NotificationStats `json:"notifications,omitempty"`
+	Canary        *CanaryStats       `json:"canary,omitempty"`
+}
+
+// NotificationStats counts the recent notifications of a user.
+type NotificationStats struct {
+	Window     string  `json:"window"`
+	Delivered  int     `json:"delivered"`
+	Failed     int     `json:"failed"`
+	Suppressed int     `json:"suppressed"`
+	ErrorRate  float64 `json:"errorRate"`
+}
+
+// ArchivedGroup is a resolved alert group of the alert history.
+type ArchivedGroup struct {
+	GroupKey    string          `json:"groupKey"`
+	Receiver    string          `json:"receiver"`
+	GroupLabels model.LabelSet  `json:"groupLabels"`
+	Alerts      []ArchivedAlert `json:"alerts"`
+	FiringAt    time.Time       `json:"firingAt"`
+	ResolvedAt  time.Time       `json:"resolvedAt"`
+}
+
+// ArchivedAlert is a resolved alert of an archived group.
+type ArchivedAlert struct {
+	Fingerprint  string         `json:"fingerprint"`
+	Labels       model.LabelSet `json:"labels"`
+	Annotations  model.LabelSet `json:"annotations,omitempty"`
+	StartsAt     time.Time      `json:"startsAt"`
+	EndsAt       time.Time      `json:"endsAt"`
+	GeneratorURL string         `json:"generatorURL,omitempty"`
+}
+
+// ReportSummary summarizes the alerts resolved over a period.
+type ReportSummary struct {
+	Since          time.Time          `json:"since"`
+	Until          time.Time          `json:"until"`
+	Truncated      bool               `json:"truncated,omitempty"`
+	Groups         int                `json:"groups"`
+	Alerts         int                `json:"alerts"`
+	MeanTimeFiring float64            `json:"meanTimeFiringSeconds"`
+	AlertsPerDay   []DailyAlerts      `json:"alertsPerDay"`
+	TopAlertnames  []AlertnameStats   `json:"topAlertnames"`
+	Notifications  *NotificationStats `json:"notifications,omitempty"`
+}
+
+// DailyAlerts counts the alerts resolved on a UTC day.
+type DailyAlerts struct {
+	Date   string `json:"date"`
+	Alerts int    `json:"alerts"`
+}
+
+// AlertExplanation tells whether the notifications of an alert are
+// suppressed, and by what.
+type AlertExplanation struct {
+	Fingerprint string                `json:"fingerprint"`
+	Labels      model.LabelSet        `json:"labels"`
+	Resolved    bool                  `json:"resolved"`
+	State       string                `json:"state"`
+	Suppressed  bool                  `json:"suppressed"`
+	Silences    []SilenceReason       `json:"silences,omitempty"`
+	Inhibitions []InhibitionReason    `json:"inhibitions,omitempty"`
+	Receivers   []ReceiverSuppression `json:"receivers"`
+}
+
+// SilenceReason is an active silence muting an alert.
+type SilenceReason struct {
+	ID        string    `json:"id"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+	EndsAt    time.Time `json:"endsAt"`
+}
+
+// InhibitionReason is a firing alert inhibiting an alert, with the
+// inhibition rules it matches, as in configs.
+type InhibitionReason struct {
+	Fingerprint string                   `json:"fingerprint"`
+	Labels      model.LabelSet           `json:"labels,omitempty"`
+	Rules       []map[string]interface{} `json:"rules,omitempty"`
+}
+
+// ReceiverSuppression names the maintenance window suppressing the
+// notifications of an alert to a receiver, if any.
+type ReceiverSuppression struct {
+	Receiver          string `json:"receiver"`
+	GroupKey          string `json:"groupKey"`
+	MaintenanceWindow string `json:"maintenanceWindow,omitempty"`
+}
+
+// NotificationLookup is the aggregation groups of an alert, with their last
+// notifications.
+type NotificationLookup struct {
+	Fingerprint string               `json:"fingerprint"`
+	Labels      model.LabelSet       `json:"labels"`
+	Groups      []GroupNotifications `json:"groups"`
+}
+
+// GroupNotifications is an aggregation group of an alert and its last
+// notification by each integration of its receiver.
+type GroupNotifications struct {
+	Receiver     string                    `json:"receiver"`
+	RouteKey     string                    `json:"routeKey"`
+	GroupKey     string                    `json:"groupKey"`
+	GroupLabels  model.LabelSet            `json:"groupLabels"`
+	Integrations []IntegrationNotification `json:"integrations"`
+}
+
+// IntegrationNotification is the last notification of a group by an
+// integration, if any.
+type IntegrationNotification struct {
+	Name           string     `json:"name"`
+	LastNotifiedAt *time.Time `json:"lastNotifiedAt,omitempty"`
+	FiringAlerts   int        `json:"firingAlerts"`
+	ResolvedAlerts int        `json:"resolvedAlerts"`
+	AlertFiring    bool       `json:"alertFiring"`
+	AlertResolved  bool       `json:"alertResolved"`
+}
+
+// AlertnameStats summarizes the resolved alerts of an alertname.
+type AlertnameStats struct {
+	Alertname      string  `json:"alertname"`
+	Alerts         int     `json:"alerts"`
+	MeanTimeFiring float64 `json:"meanTimeFiringSeconds"`
+}
+
+// Silence is a silence of the Alertmanager v2 API.
+type Silence struct {
+	ID        string         `json:"id,omitempty"`
+	Matchers  []Matcher      `json:"matchers"`
+	StartsAt  time.Time      `json:"startsAt"`
+	EndsAt    time.Time      `json:"endsAt"`
+	CreatedBy string         `json:"createdBy"`
+	Comment   string         `json:"comment"`
+	Status    *SilenceStatus `json:"status,omitempty"`
+}
+
+// SilenceStatus is the state of a silence, one of active, pending and
+// expired.
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+// SilenceExport holds the silences of a user, as exported by
+// ExportSilences and imported by ImportSilences.
+type SilenceExport struct {
+	UserID     string    `json:"userID,omitempty"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Silences   []Silence `json:"silences"`
+}
+
+// SilenceImportResult maps the exported IDs of the imported silences to
+// their new IDs, and lists the silences which were not imported.
+type SilenceImportResult struct {
+	Imported map[string]string `json:"imported"`
+	Skipped  []SkippedSilence  `json:"skipped,omitempty"`
+}
+
+// SkippedSilence is a silence which was not imported, because it expired
+// or an equal silence exists.
+type SkippedSilence struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Matcher matches the alerts with a label value.
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+}
+
+func (m Matcher) String() string {
+	op := "="
+	if m.IsRegex {
+		op = "=~"
+	}
+	return fmt.Sprintf("%s%s%q", m.Name, op, m.Value)
+}
@@ -0,0 +1,167 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"go.searchlight.dev/alertmanager/pkg/alertmanager"
+	"go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/storage/etcd"
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewCmdBackup() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "backup",
+		Short:             "Back up and restore the configs and state of all users",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdBackupCreate())
+	cmd.AddCommand(newCmdBackupRestore())
+	return cmd
+}
+
+// backupStorage configures the storage backends backups are taken from and
+// restored to.
+type backupStorage struct {
+	etcdCfg  *etcd.Config
+	stateCfg *objstore.Config
+	state    bool
+}
+
+func newBackupStorage() *backupStorage {
+	return &backupStorage{
+		etcdCfg:  etcd.NewConfig(),
+		stateCfg: objstore.NewConfig(),
+	}
+}
+
+func (s *backupStorage) AddFlags(fs *pflag.FlagSet) {
+	s.etcdCfg.AddFlags(fs)
+	s.stateCfg.AddFlags(fs)
+	fs.BoolVar(&s.state, "state", false, "Include the silences and notification logs of the users, kept in the object storage configured by the --state.* flags.")
+}
+
+// open returns the config client and the state bucket, which is nil unless
+// the state is included.
+func (s *backupStorage) open() (*etcd.Client, objstore.Bucket, error) {
+	if err := s.etcdCfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := s.stateCfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if s.state && !s.stateCfg.Enabled() {
+		return nil, nil, errors.New("--state.backend must be set to include the state")
+	}
+
+	if err := logger.InitLogger(); err != nil {
+		return nil, nil, err
+	}
+	client, err := etcd.NewClient(s.etcdCfg, log.With(logger.Logger, "domain", "etcd"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.state {
+		return client, nil, nil
+	}
+	bucket, err := objstore.NewBucket(s.stateCfg)
+	if err != nil {
+		client.Close()
+		return nil, nil, errors.Wrap(err, "failed to create state bucket")
+	}
+	return client, bucket, nil
+}
+
+func newCmdBackupCreate() *cobra.Command {
+	storage := newBackupStorage()
+	var out string
+
+	cmd := &cobra.Command{
+		Use:               "create",
+		Short:             "Write the configs, template files and optionally the state of all users to an archive",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if out == "" {
+				return errors.New("--out must be non empty")
+			}
+			client, bucket, err := storage.open()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			f, err := os.Create(out)
+			if err != nil {
+				return err
+			}
+			m, err := alertmanager.CreateBackup(context.Background(), client, bucket, f)
+			if err != nil {
+				_ = f.Close()
+				_ = os.Remove(out)
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "backed up %d users to %s\n", len(m.Users), out)
+			return nil
+		},
+	}
+
+	storage.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&out, "out", "", "File the gzipped tar archive is written to.")
+	return cmd
+}
+
+func newCmdBackupRestore() *cobra.Command {
+	storage := newBackupStorage()
+	var (
+		in        string
+		overwrite bool
+	)
+
+	cmd := &cobra.Command{
+		Use:               "restore",
+		Short:             "Restore the configs, template files and optionally the state of the users in an archive",
+		Long:              "Restore the configs, template files and optionally the state of the users in an archive. State snapshots are only picked up by replicas without local state for the user, so they should be restored before the deployment is started.",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r io.Reader = os.Stdin
+			if in != "-" {
+				f, err := os.Open(in)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			client, bucket, err := storage.open()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			res, err := alertmanager.RestoreBackup(context.Background(), client, bucket, r, overwrite)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(res)
+		},
+	}
+
+	storage.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&in, "in", "-", "Archive to restore, - reads it from stdin.")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace the stored configs of users in the archive. Users with a stored config are skipped otherwise.")
+	return cmd
+}
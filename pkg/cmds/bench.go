@@ -0,0 +1,120 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/alertmanager"
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdBench() *cobra.Command {
+	o := alertmanager.BenchOptions{
+		Tenants:         10,
+		AlertsPerSecond: 100,
+		Duration:        time.Minute,
+		Groups:          10,
+		GroupInterval:   time.Second,
+		DrainTimeout:    30 * time.Second,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Load test the notification pipeline with synthetic tenants",
+		Long: `Load test the notification pipeline with synthetic tenants.
+An Alertmanager is created for each tenant, with a webhook receiver sending
+the notifications to an in-process sink. Alerts are injected directly into
+the providers of the tenants, then the notifications of the injected alerts
+are waited for. The dispatch latency, from the injection of an alert to its
+first notification, the notification throughput, the memory usage and the
+stages which did not keep up are reported. Interrupting the load test stops
+the injection and reports the alerts injected so far.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := logger.InitLogger(); err != nil {
+				return err
+			}
+			o.Logger = logger.Logger
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigc := make(chan os.Signal, 1)
+			signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigc)
+			go func() {
+				select {
+				case <-sigc:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			r, err := alertmanager.Bench(ctx, o)
+			if r == nil {
+				return err
+			}
+			if perr := printBenchReport(os.Stdout, r); perr != nil {
+				return perr
+			}
+			if err == context.Canceled {
+				return nil
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().IntVar(&o.Tenants, "tenants", o.Tenants, "Number of synthetic tenants.")
+	cmd.Flags().IntVar(&o.AlertsPerSecond, "alerts-per-sec", o.AlertsPerSecond, "Alerts injected per second, spread evenly over the tenants.")
+	cmd.Flags().DurationVar(&o.Duration, "duration", o.Duration, "How long alerts are injected.")
+	cmd.Flags().IntVar(&o.Groups, "groups", o.Groups, "Number of aggregation groups of each tenant.")
+	cmd.Flags().DurationVar(&o.GroupInterval, "group-interval", o.GroupInterval, "Group interval of the route of the tenants, at least 1s.")
+	cmd.Flags().DurationVar(&o.SinkLatency, "sink-latency", o.SinkLatency, "Delay of the responses of the sink receiver, simulating a slow receiver.")
+	cmd.Flags().DurationVar(&o.DrainTimeout, "drain-timeout", o.DrainTimeout, "How long the notifications of the injected alerts are waited for once the injection stops.")
+	return cmd
+}
+
+func printBenchReport(out io.Writer, r *alertmanager.BenchReport) error {
+	latencies := func(l alertmanager.LatencySummary) string {
+		return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s", roundLatency(l.P50), roundLatency(l.P90), roundLatency(l.P99), roundLatency(l.Max))
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Tenants:\t%d\n", r.Tenants)
+	fmt.Fprintf(w, "Duration:\t%s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Alerts injected:\t%d (%.1f/s of %.0f/s targeted)\n", r.AlertsInjected, r.InjectionRate, r.TargetRate)
+	fmt.Fprintf(w, "Put latency:\t%s\n", latencies(r.PutLatency))
+	fmt.Fprintf(w, "Alerts delivered:\t%d\n", r.AlertsDelivered)
+	fmt.Fprintf(w, "Dispatch latency:\t%s\n", latencies(r.DispatchLatency))
+	fmt.Fprintf(w, "Notifications:\t%d (%.1f/s)\n", r.Notifications, r.NotificationsPerSecond)
+	fmt.Fprintf(w, "Max in flight:\t%d\n", r.MaxInflight)
+	fmt.Fprintf(w, "Max heap:\t%.1f MiB\n", float64(r.MaxHeapAlloc)/(1<<20))
+	fmt.Fprintf(w, "Memory obtained:\t%.1f MiB\n", float64(r.Sys)/(1<<20))
+	fmt.Fprintf(w, "Max goroutines:\t%d\n", r.MaxGoroutines)
+	if len(r.Backpressure) == 0 {
+		fmt.Fprintf(w, "Backpressure:\tnone\n")
+	}
+	for _, b := range r.Backpressure {
+		fmt.Fprintf(w, "Backpressure:\t%s\n", b)
+	}
+	return w.Flush()
+}
+
+// roundLatency rounds the latency to the millisecond, or to the microsecond
+// below 10ms.
+func roundLatency(d time.Duration) time.Duration {
+	if d < 10*time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
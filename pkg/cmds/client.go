@@ -0,0 +1,45 @@
+package cmds
+
+import (
+	"net/http"
+	"time"
+
+	amclient "go.searchlight.dev/alertmanager/pkg/client"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// apiClient holds the flags of the commands talking to the multitenant API
+// on behalf of a single user.
+type apiClient struct {
+	serverURL  string
+	userID     string
+	token      string
+	pathPrefix string
+	timeout    time.Duration
+}
+
+func (c *apiClient) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.serverURL, "url", "http://localhost:8443", "URL of the alertmanager API server.")
+	fs.StringVar(&c.userID, "user", "", "User ID of the tenant.")
+	fs.StringVar(&c.token, "token", "", "Bearer token sent to the API server, if it is behind an authenticating proxy.")
+	fs.StringVar(&c.pathPrefix, "path-prefix", amclient.DefaultPathPrefix, "Path prefix of the Alertmanager endpoints of the API server.")
+	fs.DurationVar(&c.timeout, "timeout", 30*time.Second, "Timeout of requests to the API server.")
+}
+
+func (c *apiClient) Validate() error {
+	if c.userID == "" {
+		return errors.New("--user must be non empty")
+	}
+	return nil
+}
+
+// client returns a client of the API configured by the flags.
+func (c *apiClient) client() (*amclient.Client, error) {
+	return amclient.New(c.serverURL, c.userID,
+		amclient.WithToken(c.token),
+		amclient.WithPathPrefix(c.pathPrefix),
+		amclient.WithHTTPClient(&http.Client{Timeout: c.timeout}),
+	)
+}
@@ -0,0 +1,537 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	amclient "go.searchlight.dev/alertmanager/pkg/client"
+	"go.searchlight.dev/alertmanager/pkg/notify"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdConfig() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "config",
+		Short:             "Manage the Alertmanager config of a user",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdConfigGet())
+	cmd.AddCommand(newCmdConfigSet())
+	cmd.AddCommand(newCmdConfigValidate())
+	cmd.AddCommand(newCmdConfigRouteTest())
+	cmd.AddCommand(newCmdConfigLint())
+	cmd.AddCommand(newCmdConfigDiff())
+	cmd.AddCommand(newCmdConfigExport())
+	cmd.AddCommand(newCmdConfigCanary())
+	return cmd
+}
+
+func newCmdConfigGet() *cobra.Command {
+	client := &apiClient{}
+	var output string
+
+	cmd := &cobra.Command{
+		Use:               "get",
+		Short:             "Print the Alertmanager config of a user",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			cfg, err := c.GetConfig(context.Background(), false)
+			if err != nil {
+				return err
+			}
+			switch output {
+			case "yaml":
+				fmt.Fprint(os.Stdout, cfg.Config.Config)
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(cfg.Config)
+			default:
+				return errors.Errorf("unknown output format %q", output)
+			}
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&output, "output", "o", "yaml", "Output format, yaml prints the config only, json includes the templates. One of: yaml|json")
+	return cmd
+}
+
+func newCmdConfigSet() *cobra.Command {
+	client := &apiClient{}
+	var (
+		templates   []string
+		externalURL string
+		revision    int64
+	)
+
+	cmd := &cobra.Command{
+		Use:               "set <config-file>",
+		Short:             "Replace the Alertmanager config of a user",
+		DisableAutoGenTag: true,
+		Args:              cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			cfg, err := readAlertmanagerConfig(args[0], templates)
+			if err != nil {
+				return err
+			}
+			cfg.ExternalURL = externalURL
+			cfg.Revision = revision
+			warnings, err := c.SetConfig(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stdout, "config updated")
+			printLintWarnings(os.Stderr, warnings)
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&templates, "template", nil, "Template files stored with the config.")
+	cmd.Flags().StringVar(&externalURL, "external-url", "", "URL the Alertmanager of the user is reachable at, used in the links of notifications.")
+	cmd.Flags().Int64Var(&revision, "revision", 0, "Revision of the stored config, as returned by config get -o json. The config is not replaced if it was changed since.")
+	return cmd
+}
+
+func newCmdConfigValidate() *cobra.Command {
+	var templates []string
+
+	cmd := &cobra.Command{
+		Use:               "validate <config-file>",
+		Short:             "Check an Alertmanager config and its templates locally",
+		DisableAutoGenTag: true,
+		Args:              cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := readAlertmanagerConfig(args[0], templates)
+			if err != nil {
+				return err
+			}
+			if _, err := notify.LoadConfig(secrets.Mask(cfg.Config)); err != nil {
+				return errors.Wrap(err, "invalid Alertmanager config")
+			}
+			for fn, content := range cfg.TemplateFiles {
+				if _, err := template.New(fn).Parse(content); err != nil {
+					return errors.Wrapf(err, "invalid template %s", fn)
+				}
+			}
+			fmt.Fprintln(os.Stdout, "config is valid")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&templates, "template", nil, "Template files to check with the config.")
+	return cmd
+}
+
+func newCmdConfigLint() *cobra.Command {
+	client := &apiClient{}
+
+	cmd := &cobra.Command{
+		Use:               "lint",
+		Short:             "Show the best practices the Alertmanager config of a user does not follow",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			warnings, err := c.LintConfig(context.Background())
+			if err != nil {
+				return err
+			}
+			if len(warnings) == 0 {
+				fmt.Fprintln(os.Stdout, "no warnings")
+				return nil
+			}
+			printLintWarnings(os.Stdout, warnings)
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func newCmdConfigDiff() *cobra.Command {
+	client := &apiClient{}
+	var templates []string
+
+	cmd := &cobra.Command{
+		Use:               "diff <config-file>",
+		Short:             "Show the changes a config makes to the stored Alertmanager config of a user",
+		DisableAutoGenTag: true,
+		Args:              cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			cfg, err := readAlertmanagerConfig(args[0], templates)
+			if err != nil {
+				return err
+			}
+			d, err := c.DiffConfig(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+			printConfigDiff(os.Stdout, d)
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&templates, "template", nil, "Template files stored with the config.")
+	return cmd
+}
+
+func newCmdConfigExport() *cobra.Command {
+	client := &apiClient{}
+	var (
+		format string
+		orgID  int
+		reveal bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the receivers and routes of the Alertmanager config of a user to another format",
+		Long: `Export the receivers and routes of the Alertmanager config of a user to another
+format. The grafana format is a Grafana alerting provisioning file, with a
+contact point by receiver and the notification policies of the routes. What
+can not be exported is listed in comments at the top of the file.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "grafana" {
+				return errors.Errorf("unknown export format %q", format)
+			}
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			data, err := c.ExportGrafana(context.Background(), orgID, reveal)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&format, "format", "grafana", "Export format. One of: grafana")
+	cmd.Flags().IntVar(&orgID, "org-id", 1, "Grafana organization of the contact points and notification policies.")
+	cmd.Flags().BoolVar(&reveal, "reveal", false, "Export the secrets, which are redacted otherwise.")
+	return cmd
+}
+
+func newCmdConfigRouteTest() *cobra.Command {
+	client := &apiClient{}
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "route-test <labels>...",
+		Short: "Show the routes, receivers and grouping of alerts",
+		Long: `Show the routes, receivers and grouping of alerts with the given labels.
+Each argument is a comma separated list of labels of an alert, like
+"alertname=HighLatency,severity=critical". The stored config of the user is
+used, unless --config-file is set.`,
+		DisableAutoGenTag: true,
+		Args:              cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			req := &amclient.RouteTestRequest{}
+			if configFile != "" {
+				data, err := ioutil.ReadFile(configFile)
+				if err != nil {
+					return err
+				}
+				req.Config = string(data)
+			}
+			for _, arg := range args {
+				lset, err := parseLabelSet(arg)
+				if err != nil {
+					return err
+				}
+				req.Alerts = append(req.Alerts, lset)
+			}
+
+			results, err := c.RouteTest(context.Background(), req)
+			if err != nil {
+				return err
+			}
+			return printRouteTestResults(os.Stdout, results)
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&configFile, "config-file", "", "Config to test instead of the stored config of the user.")
+	return cmd
+}
+
+// readAlertmanagerConfig reads a config file and the given template files,
+// which are stored by their base name.
+func newCmdConfigCanary() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "canary",
+		Short:             "Try an Alertmanager config in shadow before applying it",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdConfigCanaryStart())
+	cmd.AddCommand(newCmdConfigCanaryStatus())
+	cmd.AddCommand(newCmdConfigCanaryStop())
+	return cmd
+}
+
+func newCmdConfigCanaryStart() *cobra.Command {
+	client := &apiClient{}
+	var (
+		templates []string
+		opts      amclient.CanaryOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:               "start <config-file>",
+		Short:             "Run a config in shadow and apply it if its notifications render",
+		DisableAutoGenTag: true,
+		Args:              cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			cfg, err := readAlertmanagerConfig(args[0], templates)
+			if err != nil {
+				return err
+			}
+			if err := c.SetCanary(context.Background(), cfg, opts); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stdout, "canary started")
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&templates, "template", nil, "Template files stored with the config.")
+	cmd.Flags().DurationVar(&opts.Duration, "duration", 0, "Duration of the canary, 10m if unset.")
+	cmd.Flags().IntVar(&opts.MaxErrors, "max-errors", 0, "Notifications failing to render before the canary is rolled back.")
+	cmd.Flags().StringVar(&opts.Receiver, "receiver", "", "Receiver whose notifications are sent during the canary.")
+	return cmd
+}
+
+func newCmdConfigCanaryStatus() *cobra.Command {
+	client := &apiClient{}
+
+	cmd := &cobra.Command{
+		Use:               "status",
+		Short:             "Print the progress or the outcome of the canary of a user",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			canary, err := c.GetCanary(context.Background())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Status:\t%s\n", canary.Status)
+			fmt.Fprintf(w, "Started:\t%s\n", time.Unix(canary.StartedAtInUnix, 0).Format(time.RFC3339))
+			if canary.FinishedAtInUnix > 0 {
+				fmt.Fprintf(w, "Finished:\t%s\n", time.Unix(canary.FinishedAtInUnix, 0).Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "Duration:\t%s\n", canary.Duration)
+			fmt.Fprintf(w, "Rendered:\t%d\n", canary.Rendered)
+			fmt.Fprintf(w, "Errors:\t%d/%d\n", canary.Errors, canary.MaxErrors)
+			if canary.LastError != "" {
+				fmt.Fprintf(w, "Last error:\t%s\n", canary.LastError)
+			}
+			return w.Flush()
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func newCmdConfigCanaryStop() *cobra.Command {
+	client := &apiClient{}
+
+	cmd := &cobra.Command{
+		Use:               "stop",
+		Short:             "Stop the canary of a user without applying its config",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			if err := c.DeleteCanary(context.Background()); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stdout, "canary stopped")
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func readAlertmanagerConfig(configFile string, templates []string) (*amclient.Config, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &amclient.Config{Config: string(data)}
+	if len(templates) > 0 {
+		cfg.TemplateFiles = map[string]string{}
+	}
+	for _, fn := range templates {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TemplateFiles[filepath.Base(fn)] = string(data)
+	}
+	return cfg, nil
+}
+
+// parseLabelSet parses a comma separated list of name=value pairs.
+func parseLabelSet(s string) (model.LabelSet, error) {
+	lset := model.LabelSet{}
+	for _, l := range strings.Split(s, ",") {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid label %q, expected name=value", l)
+		}
+		name := model.LabelName(strings.TrimSpace(kv[0]))
+		if !name.IsValid() {
+			return nil, errors.Errorf("invalid label name %q", name)
+		}
+		lset[name] = model.LabelValue(strings.Trim(strings.TrimSpace(kv[1]), `"`))
+	}
+	return lset, nil
+}
+
+func printLintWarnings(out io.Writer, warnings []amclient.LintWarning) {
+	for _, w := range warnings {
+		if w.Field != "" {
+			fmt.Fprintf(out, "warning: %s: %s (%s)\n", w.Field, w.Message, w.Code)
+		} else {
+			fmt.Fprintf(out, "warning: %s (%s)\n", w.Message, w.Code)
+		}
+	}
+}
+
+// diffMarks prefix the changes printed by printConfigDiff.
+var diffMarks = map[string]string{"added": "+", "removed": "-", "changed": "~"}
+
+func printConfigDiff(out io.Writer, d *amclient.ConfigDiff) {
+	if len(d.Routes)+len(d.Receivers)+len(d.Global)+len(d.Templates) == 0 && !d.InhibitRulesChanged {
+		fmt.Fprintln(out, "no changes")
+		return
+	}
+	for _, r := range d.Routes {
+		fmt.Fprintf(out, "%s route %s (receiver %q)\n", diffMarks[r.Change], r.RouteKey, r.Receiver)
+		printFieldChanges(out, r.Fields)
+	}
+	for _, r := range d.Receivers {
+		fmt.Fprintf(out, "%s receiver %q\n", diffMarks[r.Change], r.Name)
+		printFieldChanges(out, r.Fields)
+	}
+	if len(d.Global) > 0 {
+		fmt.Fprintln(out, "~ global")
+		printFieldChanges(out, d.Global)
+	}
+	if d.InhibitRulesChanged {
+		fmt.Fprintln(out, "~ inhibit_rules")
+	}
+	for _, t := range d.Templates {
+		fmt.Fprintf(out, "%s template %s\n", diffMarks[t.Change], t.Name)
+	}
+}
+
+func printFieldChanges(out io.Writer, fields []amclient.FieldChange) {
+	for _, f := range fields {
+		if f.Secret {
+			fmt.Fprintf(out, "    %s: <secret changed>\n", f.Field)
+		} else {
+			fmt.Fprintf(out, "    %s: %q -> %q\n", f.Field, f.Old, f.New)
+		}
+	}
+}
+
+func printRouteTestResults(out io.Writer, results []amclient.RouteTestResult) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LABELS\tRECEIVER\tROUTE\tGROUP BY\tGROUP WAIT\tGROUP INTERVAL\tREPEAT INTERVAL")
+	for _, res := range results {
+		if len(res.Routes) == 0 {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t-\n", res.Labels)
+		}
+		for _, r := range res.Routes {
+			groupBy := r.GroupBy
+			if r.GroupByAll {
+				groupBy = []string{"..."}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t[%s]\t%s\t%s\t%s\n",
+				res.Labels, r.Receiver, r.RouteKey, strings.Join(groupBy, ","),
+				r.GroupWait, r.GroupInterval, r.RepeatInterval)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,219 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.searchlight.dev/alertmanager/pkg/alertmanager"
+	"go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/storage/etcd"
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewCmdMigrate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "migrate",
+		Short:             "Migrate the configs of users from and to other Alertmanager deployments",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdMigrateFromUpstream())
+	cmd.AddCommand(newCmdMigrateFromCortex())
+	cmd.AddCommand(newCmdMigrateToCortex())
+	return cmd
+}
+
+func newCmdMigrateFromUpstream() *cobra.Command {
+	etcdCfg := etcd.NewConfig()
+	stateCfg := objstore.NewConfig()
+	in := &alertmanager.UpstreamImport{}
+
+	cmd := &cobra.Command{
+		Use:   "from-upstream",
+		Short: "Import the config, templates and silences of a single-tenant Alertmanager as a user",
+		Long: `Import the config, templates and silences of a single-tenant Alertmanager as a user.
+The template files matched by the templates of the config are stored with it.
+The silences snapshot is written to the data directory, and uploaded to the
+object storage configured by the --state.* flags if set. It is only loaded by
+an Alertmanager of the user created later, so the import should be run before
+the config of the user is applied, on the replica the user is assigned to or
+with object storage.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if in.ConfigFile == "" {
+				return errors.New("--config must be non empty")
+			}
+			if in.UserID == "" {
+				return errors.New("--tenant must be non empty")
+			}
+			if err := etcdCfg.Validate(); err != nil {
+				return err
+			}
+			if err := stateCfg.Validate(); err != nil {
+				return err
+			}
+
+			if err := logger.InitLogger(); err != nil {
+				return err
+			}
+			client, err := etcd.NewClient(etcdCfg, log.With(logger.Logger, "domain", "etcd"))
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			var bucket objstore.Bucket
+			if in.SilencesFile != "" && stateCfg.Enabled() {
+				bucket, err = objstore.NewBucket(stateCfg)
+				if err != nil {
+					return errors.Wrap(err, "failed to create state bucket")
+				}
+			}
+
+			res, err := alertmanager.ImportUpstream(context.Background(), client, bucket, in)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(res)
+		},
+	}
+
+	etcdCfg.AddFlags(cmd.Flags())
+	stateCfg.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&in.ConfigFile, "config", "", "Config file of the Alertmanager, like alertmanager.yml.")
+	cmd.Flags().StringVar(&in.SilencesFile, "silences", "", "Silences snapshot of the Alertmanager, the silences file in its --storage.path. Optional.")
+	cmd.Flags().StringVar(&in.UserID, "tenant", "", "User the Alertmanager is imported as.")
+	cmd.Flags().StringVar(&in.DataDir, "data-dir", "data/", "Data directory of the replica the user is assigned to, its --alertmanager.storage.path.")
+	cmd.Flags().BoolVar(&in.Overwrite, "overwrite", false, "Replace the stored config and the silences of the user.")
+	return cmd
+}
+
+// cortexFlags configure the Cortex or Mimir tenant configs are migrated
+// from or to, and the user they are migrated as.
+type cortexFlags struct {
+	etcdCfg      *etcd.Config
+	address      string
+	userID       string
+	tenantID     string
+	username     string
+	passwordFile string
+}
+
+func newCortexFlags() *cortexFlags {
+	return &cortexFlags{etcdCfg: etcd.NewConfig()}
+}
+
+func (f *cortexFlags) AddFlags(fs *pflag.FlagSet) {
+	f.etcdCfg.AddFlags(fs)
+	fs.StringVar(&f.address, "address", "", "Address of Cortex or Mimir, serving the Alertmanager config API under /api/v1/alerts.")
+	fs.StringVar(&f.userID, "tenant", "", "User the config is migrated as.")
+	fs.StringVar(&f.tenantID, "cortex.tenant", "", "Tenant of Cortex sent in the X-Scope-OrgID header, --tenant if empty.")
+	fs.StringVar(&f.username, "cortex.username", "", "Username of the basic authentication to Cortex.")
+	fs.StringVar(&f.passwordFile, "cortex.password-file", "", "File holding the password of the basic authentication to Cortex.")
+}
+
+// open returns the config client and the Cortex client.
+func (f *cortexFlags) open() (*etcd.Client, *alertmanager.CortexClient, error) {
+	if f.address == "" {
+		return nil, nil, errors.New("--address must be non empty")
+	}
+	if f.userID == "" {
+		return nil, nil, errors.New("--tenant must be non empty")
+	}
+	u, err := url.Parse(f.address)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid --address")
+	}
+	cortex := &alertmanager.CortexClient{Address: u, TenantID: f.tenantID, Username: f.username}
+	if cortex.TenantID == "" {
+		cortex.TenantID = f.userID
+	}
+	if f.passwordFile != "" {
+		data, err := ioutil.ReadFile(f.passwordFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		cortex.Password = strings.TrimSpace(string(data))
+	}
+	if err := f.etcdCfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := logger.InitLogger(); err != nil {
+		return nil, nil, err
+	}
+	client, err := etcd.NewClient(f.etcdCfg, log.With(logger.Logger, "domain", "etcd"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, cortex, nil
+}
+
+func newCmdMigrateFromCortex() *cobra.Command {
+	flags := newCortexFlags()
+	var overwrite bool
+
+	cmd := &cobra.Command{
+		Use:               "from-cortex",
+		Short:             "Import the Alertmanager config and templates of a Cortex or Mimir tenant as a user",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, cortex, err := flags.open()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			cfg, err := alertmanager.ImportCortex(context.Background(), client, cortex, flags.userID, overwrite)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "imported the config of Cortex tenant %s with %d template files as user %s\n", cortex.TenantID, len(cfg.TemplateFiles), flags.userID)
+			return nil
+		},
+	}
+
+	flags.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace the stored config of the user.")
+	return cmd
+}
+
+func newCmdMigrateToCortex() *cobra.Command {
+	flags := newCortexFlags()
+
+	cmd := &cobra.Command{
+		Use:   "to-cortex",
+		Short: "Export the Alertmanager config and templates of a user to a Cortex or Mimir tenant",
+		Long: `Export the Alertmanager config and templates of a user to a Cortex or Mimir tenant.
+The config of the tenant is replaced. Configs using integrations or fields
+which Cortex does not support, or references to secrets, are not exported.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, cortex, err := flags.open()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			cc, err := alertmanager.ExportCortex(context.Background(), client, cortex, flags.userID)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "exported the config of user %s with %d template files to Cortex tenant %s\n", flags.userID, len(cc.TemplateFiles), cortex.TenantID)
+			return nil
+		},
+	}
+
+	flags.AddFlags(cmd.Flags())
+	return cmd
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 
 	"go.searchlight.dev/alertmanager/pkg/alertmanager"
+	"go.searchlight.dev/alertmanager/pkg/logger"
 
 	"github.com/spf13/cobra"
 )
@@ -16,9 +17,16 @@ func NewRootCmd() *cobra.Command {
 	}
 
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	logger.AddFlags(rootCmd.PersistentFlags())
 	// ref: https://github.com/kubernetes/kubernetes/issues/17162#issuecomment-225596212
 	alertmanager.Must(flag.CommandLine.Parse([]string{}))
 	rootCmd.AddCommand(NewCmdRun())
+	rootCmd.AddCommand(NewCmdTail())
+	rootCmd.AddCommand(NewCmdConfig())
+	rootCmd.AddCommand(NewCmdSilence())
+	rootCmd.AddCommand(NewCmdBackup())
+	rootCmd.AddCommand(NewCmdMigrate())
+	rootCmd.AddCommand(NewCmdBench())
 
 	return rootCmd
 }
@@ -1,12 +1,19 @@
 package cmds
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"go.searchlight.dev/alertmanager/pkg/alertmanager"
 	"go.searchlight.dev/alertmanager/pkg/logger"
+	"go.searchlight.dev/alertmanager/pkg/secrets"
 	"go.searchlight.dev/alertmanager/pkg/storage/etcd"
+	"go.searchlight.dev/alertmanager/pkg/storage/objstore"
+	"go.searchlight.dev/alertmanager/pkg/tracing"
 
 	"github.com/go-kit/kit/log"
 	"github.com/gorilla/mux"
@@ -17,13 +24,23 @@ import (
 func NewCmdRun() *cobra.Command {
 	multiAMCfg := &alertmanager.MultitenantAlertmanagerConfig{}
 	etcdCfg := etcd.NewConfig()
+	stateCfg := objstore.NewConfig()
+	timingBounds := &alertmanager.TimingBounds{}
+	replCfg := &alertmanager.ReplicationConfig{}
+	secretsCfg := secrets.NewConfig()
+	redactionCfg := &alertmanager.RedactionConfig{}
+	tracingCfg := tracing.NewConfig()
+	accessLogCfg := &alertmanager.AccessLogConfig{}
+	var requireRevision bool
 
 	cmd := &cobra.Command{
 		Use:               "run",
 		Short:             "Launch alertmanager",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			logger.InitLogger()
+			if err := logger.InitLogger(); err != nil {
+				return err
+			}
 			alertmanager.Must(logger.Logger.Log("msg", "Starting alertmanager"))
 
 			if err := multiAMCfg.Validate(); err != nil {
@@ -32,6 +49,37 @@ func NewCmdRun() *cobra.Command {
 			if err := etcdCfg.Validate(); err != nil {
 				return err
 			}
+			if err := stateCfg.Validate(); err != nil {
+				return err
+			}
+			if err := timingBounds.Validate(); err != nil {
+				return err
+			}
+			if err := replCfg.Validate(); err != nil {
+				return err
+			}
+			if err := secretsCfg.Validate(); err != nil {
+				return err
+			}
+			if err := redactionCfg.Validate(); err != nil {
+				return err
+			}
+			if err := tracingCfg.Validate(); err != nil {
+				return err
+			}
+			if err := accessLogCfg.Validate(); err != nil {
+				return err
+			}
+
+			tracer, err := tracing.Init(tracingCfg)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := tracer.Close(); err != nil {
+					alertmanager.Must(logger.Logger.Log("msg", "Failed to flush traces", "err", err))
+				}
+			}()
 
 			etcdClient, err := etcd.NewClient(etcdCfg, log.With(logger.Logger, "domain", "etcd"))
 			if err != nil {
@@ -43,26 +91,130 @@ func NewCmdRun() *cobra.Command {
 				return errors.Wrap(err, "failed to create alertmanager getter")
 			}
 
-			multiAM, err := alertmanager.NewMultitenantAlertmanager(multiAMCfg, amGetter)
+			var stateBucket objstore.Bucket
+			if stateCfg.Enabled() {
+				stateBucket, err = objstore.NewBucket(stateCfg)
+				if err != nil {
+					return errors.Wrap(err, "failed to create state bucket")
+				}
+			}
+
+			secretResolvers, err := secrets.NewResolvers(secretsCfg)
+			if err != nil {
+				return err
+			}
+
+			var elector alertmanager.LeaderElector
+			if multiAMCfg.LeaderElection {
+				elector = etcd.NewElection(etcdClient, multiAMCfg.LeaderLeaseTTL)
+			}
+
+			var archive alertmanager.AlertArchive
+			if multiAMCfg.HistoryEnabled {
+				archive = etcdClient
+			}
+
+			multiAM, err := alertmanager.NewMultitenantAlertmanager(multiAMCfg, amGetter, stateBucket, secretResolvers, elector, archive)
 			if err != nil {
 				return err
 			}
 			go multiAM.Run()
 			defer multiAM.Stop()
 
-			amAPI := alertmanager.NewAPI(etcdClient)
+			// The canaries of standby deployments are finished on the
+			// primary deployment.
+			if replCfg.Role != alertmanager.ReplicationRoleStandby {
+				canaries := alertmanager.NewCanaryController(etcdClient, multiAM)
+				go canaries.Run()
+				defer canaries.Stop()
+			}
+
+			if replCfg.Role == alertmanager.ReplicationRolePrimary {
+				replicator, err := alertmanager.NewReplicator(replCfg, etcdClient, etcdClient.NewWatcher(), multiAM)
+				if err != nil {
+					return errors.Wrap(err, "failed to create replicator")
+				}
+				go replicator.Run()
+				defer replicator.Stop()
+			}
+
+			amAPI := alertmanager.NewAPI(etcdClient, timingBounds, redactionCfg, multiAM, multiAM, multiAM, replCfg.Role == alertmanager.ReplicationRoleStandby, requireRevision)
+			adminAPI := alertmanager.NewAdminAPI(etcdClient, multiAM)
+			go adminAPI.RunJobs()
+			replAPI := alertmanager.NewReplicationAPI(replCfg, etcdClient, multiAM)
 
 			r := mux.NewRouter()
+			r.HandleFunc("/-/healthy", multiAM.Healthy).Methods("GET", "HEAD")
+			r.HandleFunc("/-/ready", multiAM.Ready).Methods("GET", "HEAD")
 			amAPI.RegisterRoutes(r)
+			adminAPI.RegisterRoutes(r)
+			replAPI.RegisterRoutes(r)
 			r.HandleFunc("/api/v1/cluster/status", multiAM.ClusterStatus)
+			r.HandleFunc("/api/v2/cluster/status", multiAM.ClusterStatusV2).Methods("GET")
+			r.HandleFunc("/api/v1/notifications/stream", multiAM.NotificationStream)
+			r.HandleFunc("/api/v1/stream", multiAM.Stream).Methods("GET")
+			r.HandleFunc("/api/v1/tools/trace", multiAM.Trace).Methods("POST")
+			r.HandleFunc("/api/v1/receivers/{name}/test", multiAM.TestReceiver).Methods("POST")
+			r.HandleFunc("/api/v1/status", multiAM.Status).Methods("GET")
+			r.HandleFunc("/api/v1/alerts/history", multiAM.AlertHistory).Methods("GET")
+			r.HandleFunc("/api/v1/alerts/notifications", multiAM.LookupNotifications).Methods("GET")
+			r.HandleFunc("/api/v1/alerts/{fingerprint}/why", multiAM.ExplainAlert).Methods("GET")
+			r.HandleFunc("/api/v1/reports/summary", multiAM.ReportSummary).Methods("GET")
+			r.HandleFunc("/api/v1/escalations/ack", multiAM.AcknowledgeAlertGroup).Methods("POST")
+			r.HandleFunc("/api/v1/silences/export", multiAM.ExportSilences).Methods("GET")
+			r.HandleFunc("/api/v1/silences/import", multiAM.ImportSilences).Methods("POST")
+			r.HandleFunc("/api/v1/slack/interactions/{user}", multiAM.SlackInteraction).Methods("POST")
+			r.HandleFunc("/api/v1/integrations/pagerduty/webhook", multiAM.PagerdutyWebhook).Methods("POST")
+
+			if multiAMCfg.UIPathPrefix != "" {
+				r.PathPrefix("/" + strings.Trim(multiAMCfg.UIPathPrefix, "/")).HandlerFunc(multiAM.ServeUI)
+			}
 
 			path := "/" + strings.Trim(multiAMCfg.PathPrefix, "/")
 
 			r.PathPrefix(path).HandlerFunc(multiAM.ServeHTTP)
 
 			// TODO: change the server listen address
-			if err := http.ListenAndServe("0.0.0.0:"+multiAMCfg.APIPort, r); err != nil {
+			srv := &http.Server{Addr: "0.0.0.0:" + multiAMCfg.APIPort, Handler: tracing.Middleware(r, alertmanager.LogRequests(accessLogCfg, r, adminAPI.Impersonate(r)))}
+			srv.RegisterOnShutdown(multiAM.CloseStreams)
+			srvErr := make(chan error, 1)
+			go func() {
+				srvErr <- srv.ListenAndServe()
+			}()
+
+			// SIGHUP forces a resync of all configs.
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
+			go func() {
+				for range hup {
+					alertmanager.Must(logger.Logger.Log("msg", "Received SIGHUP, resyncing all configs"))
+					if err := multiAM.Resync(context.Background()); err != nil {
+						alertmanager.Must(logger.Logger.Log("msg", "Failed to resync configs", "err", err))
+					}
+				}
+			}()
+
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			select {
+			case err := <-srvErr:
 				return err
+			case sig := <-sigs:
+				alertmanager.Must(logger.Logger.Log("msg", "Received signal, shutting down", "signal", sig))
+			}
+
+			// Alerts are rejected while the pending alert groups are flushed
+			// and the in-flight notifications are sent. The deferred Stop
+			// then snapshots the state.
+			drainCtx, drainCancel := context.WithTimeout(context.Background(), multiAMCfg.DrainTimeout)
+			multiAM.Drain(drainCtx)
+			drainCancel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), multiAMCfg.ServerShutdownTimeout)
+			defer cancel()
+			if err := srv.Shutdown(ctx); err != nil {
+				alertmanager.Must(logger.Logger.Log("msg", "Failed to shut down API server", "err", err))
 			}
 			return nil
 		},
@@ -70,5 +222,13 @@ func NewCmdRun() *cobra.Command {
 
 	multiAMCfg.AddFlags(cmd.Flags())
 	etcdCfg.AddFlags(cmd.Flags())
+	stateCfg.AddFlags(cmd.Flags())
+	timingBounds.AddFlags(cmd.Flags())
+	replCfg.AddFlags(cmd.Flags())
+	secretsCfg.AddFlags(cmd.Flags())
+	redactionCfg.AddFlags(cmd.Flags())
+	tracingCfg.AddFlags(cmd.Flags())
+	accessLogCfg.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&requireRevision, "alertmanager.configs.require-revision", false, "Reject replacing a stored config without the revision it was read at, so that concurrent changes are not overwritten.")
 	return cmd
 }
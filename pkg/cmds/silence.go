@@ -0,0 +1,315 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	amclient "go.searchlight.dev/alertmanager/pkg/client"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdSilence() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "silence",
+		Short:             "Manage the silences of a user",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdSilenceAdd())
+	cmd.AddCommand(newCmdSilenceList())
+	cmd.AddCommand(newCmdSilenceExpire())
+	cmd.AddCommand(newCmdSilenceExport())
+	cmd.AddCommand(newCmdSilenceImport())
+	return cmd
+}
+
+func newCmdSilenceAdd() *cobra.Command {
+	client := &apiClient{}
+	var (
+		author   string
+		comment  string
+		duration time.Duration
+		start    string
+		end      string
+	)
+	if u, err := user.Current(); err == nil {
+		author = u.Username
+	}
+
+	cmd := &cobra.Command{
+		Use:   "add <matcher>...",
+		Short: "Add a silence",
+		Long: `Add a silence for the alerts matching all of the given matchers, like
+alertname=HighLatency or instance=~"db-.*".`,
+		DisableAutoGenTag: true,
+		Args:              cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			if comment == "" {
+				return errors.New("--comment must be non empty")
+			}
+			if author == "" {
+				return errors.New("--author must be non empty")
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+
+			sil := &amclient.Silence{CreatedBy: author, Comment: comment, StartsAt: time.Now()}
+			for _, arg := range args {
+				m, err := parseSilenceMatcher(arg)
+				if err != nil {
+					return err
+				}
+				sil.Matchers = append(sil.Matchers, m)
+			}
+			if start != "" {
+				t, err := time.Parse(time.RFC3339, start)
+				if err != nil {
+					return errors.Wrap(err, "invalid --start")
+				}
+				sil.StartsAt = t
+			}
+			sil.EndsAt = sil.StartsAt.Add(duration)
+			if end != "" {
+				t, err := time.Parse(time.RFC3339, end)
+				if err != nil {
+					return errors.Wrap(err, "invalid --end")
+				}
+				sil.EndsAt = t
+			}
+			if !sil.EndsAt.After(sil.StartsAt) {
+				return errors.New("silence must end after it starts")
+			}
+
+			id, err := c.CreateSilence(context.Background(), sil)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stdout, id)
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&author, "author", author, "Author of the silence.")
+	cmd.Flags().StringVar(&comment, "comment", "", "Reason of the silence.")
+	cmd.Flags().DurationVar(&duration, "duration", time.Hour, "Duration of the silence, unless --end is set.")
+	cmd.Flags().StringVar(&start, "start", "", "Start of the silence in RFC3339 format, defaults to now.")
+	cmd.Flags().StringVar(&end, "end", "", "End of the silence in RFC3339 format.")
+	return cmd
+}
+
+func newCmdSilenceList() *cobra.Command {
+	client := &apiClient{}
+	var expired bool
+
+	cmd := &cobra.Command{
+		Use:   "list [<matcher>...]",
+		Short: "List silences",
+		Long: `List the active and pending silences. If matchers are given, only the
+silences matching alerts with these labels are listed.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			for _, arg := range args {
+				if _, err := parseSilenceMatcher(arg); err != nil {
+					return err
+				}
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			sils, err := c.ListSilences(context.Background(), args...)
+			if err != nil {
+				return err
+			}
+			var shown []amclient.Silence
+			for _, sil := range sils {
+				if expired || sil.Status == nil || sil.Status.State != "expired" {
+					shown = append(shown, sil)
+				}
+			}
+			return printSilences(os.Stdout, shown)
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&expired, "expired", false, "Also list expired silences.")
+	return cmd
+}
+
+func newCmdSilenceExpire() *cobra.Command {
+	client := &apiClient{}
+
+	cmd := &cobra.Command{
+		Use:               "expire <silence-id>...",
+		Short:             "Expire silences",
+		DisableAutoGenTag: true,
+		Args:              cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				if err := c.ExpireSilence(context.Background(), id); err != nil {
+					return errors.Wrapf(err, "failed to expire silence %s", id)
+				}
+			}
+			return nil
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func newCmdSilenceExport() *cobra.Command {
+	client := &apiClient{}
+	var expired bool
+
+	cmd := &cobra.Command{
+		Use:               "export",
+		Short:             "Print the silences of a user as JSON, to import them with silence import",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			export, err := c.ExportSilences(context.Background(), expired)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(export)
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&expired, "expired", false, "Also export expired silences.")
+	return cmd
+}
+
+func newCmdSilenceImport() *cobra.Command {
+	client := &apiClient{}
+
+	cmd := &cobra.Command{
+		Use:   "import <export-file>",
+		Short: "Import the silences exported with silence export",
+		Long: `Import the silences exported with silence export, read from stdin if the file
+is -. The silences get new IDs, printed next to their exported IDs. Expired
+silences and silences equal to an existing silence are skipped.`,
+		DisableAutoGenTag: true,
+		Args:              cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+			var (
+				data []byte
+				err  error
+			)
+			if args[0] == "-" {
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(args[0])
+			}
+			if err != nil {
+				return err
+			}
+			var export amclient.SilenceExport
+			if err := json.Unmarshal(data, &export); err != nil {
+				return errors.Wrapf(err, "failed to parse %s", args[0])
+			}
+			c, err := client.client()
+			if err != nil {
+				return err
+			}
+			res, err := c.ImportSilences(context.Background(), &export)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "EXPORTED ID\tID\tSKIPPED")
+			for _, sil := range export.Silences {
+				if id, ok := res.Imported[sil.ID]; ok {
+					fmt.Fprintf(w, "%s\t%s\t\n", sil.ID, id)
+				}
+			}
+			for _, s := range res.Skipped {
+				fmt.Fprintf(w, "%s\t\t%s\n", s.ID, s.Reason)
+			}
+			return w.Flush()
+		},
+	}
+
+	client.AddFlags(cmd.Flags())
+	return cmd
+}
+
+var silenceMatcherRE = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|=)\s*(.*?)\s*$`)
+
+// parseSilenceMatcher parses a matcher like name=value or name=~"regex".
+// Negative matchers are not supported by silences.
+func parseSilenceMatcher(s string) (amclient.Matcher, error) {
+	ms := silenceMatcherRE.FindStringSubmatch(s)
+	if ms == nil {
+		return amclient.Matcher{}, errors.Errorf("invalid matcher %q, expected name=value or name=~regex", s)
+	}
+	m := amclient.Matcher{Name: ms[1], Value: ms[3], IsRegex: ms[2] == "=~"}
+	if len(m.Value) >= 2 && strings.HasPrefix(m.Value, `"`) && strings.HasSuffix(m.Value, `"`) {
+		m.Value = m.Value[1 : len(m.Value)-1]
+	}
+	if m.IsRegex {
+		if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+			return amclient.Matcher{}, errors.Wrapf(err, "invalid matcher %q", s)
+		}
+	} else if !model.LabelValue(m.Value).IsValid() {
+		return amclient.Matcher{}, errors.Errorf("invalid label value in matcher %q", s)
+	}
+	return m, nil
+}
+
+func printSilences(out io.Writer, sils []amclient.Silence) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMATCHERS\tSTATE\tENDS AT\tCREATED BY\tCOMMENT")
+	for _, sil := range sils {
+		var matchers []string
+		for _, m := range sil.Matchers {
+			matchers = append(matchers, m.String())
+		}
+		state := ""
+		if sil.Status != nil {
+			state = sil.Status.State
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			sil.ID, strings.Join(matchers, " "), state, sil.EndsAt.Format(time.RFC3339), sil.CreatedBy, sil.Comment)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,106 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"go.searchlight.dev/alertmanager/pkg/alertmanager"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdTail() *cobra.Command {
+	var (
+		serverURL string
+		userID    string
+		receiver  string
+		payload   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:               "tail",
+		Short:             "Stream notifications of a user as they are delivered",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if userID == "" {
+				return errors.New("--user must be non empty")
+			}
+			u, err := url.Parse(strings.TrimSuffix(serverURL, "/") + "/api/v1/notifications/stream")
+			if err != nil {
+				return errors.Wrap(err, "invalid server url")
+			}
+			if receiver != "" {
+				u.RawQuery = url.Values{"receiver": []string{receiver}}.Encode()
+			}
+			return tailNotifications(u.String(), userID, payload, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "url", "http://localhost:8443", "URL of the alertmanager API server.")
+	cmd.Flags().StringVar(&userID, "user", "", "User ID whose notifications will be streamed.")
+	cmd.Flags().StringVar(&receiver, "receiver", "", "Only show notifications of this receiver.")
+	cmd.Flags().BoolVar(&payload, "payload", false, "Show the payloads rendered by the integrations.")
+	return cmd
+}
+
+func tailNotifications(u, userID string, payload bool, out io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(alertmanager.UserIDHeaderName, userID)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to server")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		return errors.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(msg))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var ev alertmanager.NotificationEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+			return errors.Wrap(err, "failed to decode event")
+		}
+		printNotificationEvent(out, ev, payload)
+	}
+	return scanner.Err()
+}
+
+func printNotificationEvent(out io.Writer, ev alertmanager.NotificationEvent, payload bool) {
+	fmt.Fprintf(out, "%s %s/%s %s group=%s\n", ev.Time.Format("2006-01-02T15:04:05Z07:00"), ev.Receiver, ev.Integration, strings.ToUpper(ev.Status), ev.GroupKey)
+	if ev.Error != "" {
+		fmt.Fprintf(out, "    error: %s\n", ev.Error)
+	}
+	for _, a := range ev.Alerts {
+		var labels []string
+		for k, v := range a.Labels {
+			labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(out, "    [%s] {%s}\n", a.Status, strings.Join(labels, ", "))
+	}
+	if payload && ev.Payload != nil {
+		if b, err := json.MarshalIndent(ev.Payload, "    ", "  "); err == nil {
+			fmt.Fprintf(out, "    payload: %s\n", b)
+		}
+	}
+}
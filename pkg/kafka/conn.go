@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxResponseSize bounds the responses read from the brokers. The metadata
+// of a topic and the results of a produce request are far below it.
+const maxResponseSize = 4 << 20
+
+// conn is a connection to a single broker.
+type conn struct {
+	net.Conn
+	clientID string
+	timeout  time.Duration
+	corrID   int32
+}
+
+// dial connects to the broker at addr and authenticates if SASL is
+// configured.
+func dial(ctx context.Context, cfg *Config, addr string) (*conn, error) {
+	dial := cfg.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	dctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	nc, err := dial(dctx, "tcp", addr)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLS != nil {
+		tc := cfg.TLS.Clone()
+		if tc.ServerName == "" {
+			tc.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(nc, tc)
+		if err := setDeadline(ctx, tlsConn, cfg.Timeout); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			nc.Close()
+			return nil, errors.Wrapf(err, "TLS handshake with %s", addr)
+		}
+		nc = tlsConn
+	}
+
+	c := &conn{Conn: nc, clientID: cfg.ClientID, timeout: cfg.Timeout}
+	if cfg.SASL != nil {
+		if err := c.authenticate(ctx, cfg.SASL); err != nil {
+			c.Close()
+			return nil, errors.Wrapf(err, "SASL authentication with %s", addr)
+		}
+	}
+	return c, nil
+}
+
+func setDeadline(ctx context.Context, c net.Conn, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return c.SetDeadline(deadline)
+}
+
+// roundTrip sends a request and returns the body of its response. If
+// noResponse is set, the broker is not expected to answer.
+func (c *conn) roundTrip(ctx context.Context, apiKey, version int16, body []byte, noResponse bool) ([]byte, error) {
+	if err := setDeadline(ctx, c.Conn, c.timeout); err != nil {
+		return nil, err
+	}
+
+	c.corrID++
+	var req encoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.corrID)
+	req.string(c.clientID)
+	req.b = append(req.b, body...)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+
+	if _, err := c.Write(req.b); err != nil {
+		return nil, err
+	}
+	if noResponse {
+		return nil, nil
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxResponseSize {
+		return nil, errors.Errorf("kafka: response of %d bytes exceeds the maximum of %d", n, maxResponseSize)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 {
+		return nil, errors.New("kafka: short response")
+	}
+	if corrID := int32(binary.BigEndian.Uint32(resp)); corrID != c.corrID {
+		return nil, errors.Errorf("kafka: unexpected correlation id %d, expected %d", corrID, c.corrID)
+	}
+	return resp[4:], nil
+}
@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTripMaxResponseSize(t *testing.T) {
+	client, broker := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer broker.Close()
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], maxResponseSize+1)
+		go ioutil.ReadAll(broker)
+		broker.Write(size[:])
+	}()
+
+	c := &conn{Conn: client, timeout: time.Second}
+	if _, err := c.roundTrip(context.Background(), apiMetadata, 1, nil, false); err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Fatalf("got %v, want the response rejected", err)
+	}
+}
+
+func TestProducerConnReuse(t *testing.T) {
+	var dials int
+	p := NewProducer(Config{
+		Brokers: []string{"broker:9092"},
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials++
+			c, _ := net.Pipe()
+			return c, nil
+		},
+	})
+	ctx := context.Background()
+
+	c, err := p.getConn(ctx, "broker:9092")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.putConn("broker:9092", c)
+	if c2, _ := p.getConn(ctx, "broker:9092"); c2 != c || dials != 1 {
+		t.Fatalf("idle connection not reused, %d dials", dials)
+	}
+	// A connection in use is not shared.
+	if c3, _ := p.getConn(ctx, "broker:9092"); c3 == c || dials != 2 {
+		t.Fatalf("connection in use shared, %d dials", dials)
+	}
+
+	p.putConn("broker:9092", c)
+	p.Close()
+	if _, err := c.Write([]byte{0}); err == nil {
+		t.Fatal("idle connection not closed with the producer")
+	}
+	if len(p.idle) != 0 {
+		t.Fatalf("%d idle connections kept after close", len(p.idle))
+	}
+}
@@ -0,0 +1,288 @@
+// Package kafka implements a minimal Kafka producer. It supports the
+// requests needed to produce records to a topic (metadata and produce) with
+// TLS and SASL (PLAIN, SCRAM-SHA-256, SCRAM-SHA-512) and requires Kafka 1.0
+// or later.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Acks required from the brokers before a produce request succeeds.
+const (
+	AcksNone   int16 = 0
+	AcksLeader int16 = 1
+	AcksAll    int16 = -1
+)
+
+// Config configures a Producer.
+type Config struct {
+	Brokers  []string
+	ClientID string
+	TLS      *tls.Config
+	SASL     *SASLConfig
+	Acks     int16
+	// Timeout bounds dialing and every request to a broker.
+	Timeout time.Duration
+	// Dial connects to the brokers. It defaults to net.Dialer's DialContext.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// idleConnTimeout is how long a connection to a broker is kept for reuse,
+// below the 10m connections.max.idle.ms the brokers default to.
+const idleConnTimeout = 5 * time.Minute
+
+// Producer produces records to Kafka topics. It keeps a connection to each
+// broker for reuse by the next calls to Produce, closed once idle for
+// idleConnTimeout, so that a Producer dropped without being closed does
+// not leak connections for long.
+type Producer struct {
+	cfg Config
+
+	mtx    sync.Mutex
+	idle   map[string]*idleConn
+	closed bool
+}
+
+type idleConn struct {
+	c     *conn
+	timer *time.Timer
+}
+
+// NewProducer returns a new Producer.
+func NewProducer(cfg Config) *Producer {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Producer{cfg: cfg, idle: map[string]*idleConn{}}
+}
+
+// Close closes the idle connections of the producer. Connections in use by
+// a call to Produce are closed when it returns.
+func (p *Producer) Close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.closed = true
+	for addr, ic := range p.idle {
+		ic.timer.Stop()
+		ic.c.Close()
+		delete(p.idle, addr)
+	}
+	return nil
+}
+
+// getConn returns the idle connection to the broker at addr, or connects
+// to it.
+func (p *Producer) getConn(ctx context.Context, addr string) (*conn, error) {
+	p.mtx.Lock()
+	ic, ok := p.idle[addr]
+	if ok {
+		ic.timer.Stop()
+		delete(p.idle, addr)
+	}
+	p.mtx.Unlock()
+	if ok {
+		return ic.c, nil
+	}
+	return dial(ctx, &p.cfg, addr)
+}
+
+// putConn keeps the connection to the broker at addr for reuse, after a
+// successful request. The connections which failed are closed instead, as
+// their state is unknown.
+func (p *Producer) putConn(addr string, c *conn) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.closed {
+		c.Close()
+		return
+	}
+	if old, ok := p.idle[addr]; ok {
+		old.timer.Stop()
+		old.c.Close()
+	}
+	ic := &idleConn{c: c}
+	ic.timer = time.AfterFunc(idleConnTimeout, func() {
+		p.mtx.Lock()
+		defer p.mtx.Unlock()
+		if p.idle[addr] == ic {
+			delete(p.idle, addr)
+			ic.c.Close()
+		}
+	})
+	p.idle[addr] = ic
+}
+
+type partitionMeta struct {
+	id     int32
+	leader int32
+}
+
+// metadata returns the addresses of the brokers and the partitions of topic.
+func (p *Producer) metadata(ctx context.Context, c *conn, topic string) (map[int32]string, []partitionMeta, error) {
+	var e encoder
+	e.int32(1)
+	e.string(topic)
+	resp, err := c.roundTrip(ctx, apiMetadata, 1, e.b, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := decoder{b: resp}
+	brokers := map[int32]string{}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller id
+
+	var parts []partitionMeta
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := Error(d.int16())
+		name := d.string()
+		d.int8() // is internal
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			d.int16() // partition error, the leader is checked instead
+			pm := partitionMeta{id: d.int32(), leader: d.int32()}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32() // replicas
+			}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32() // isr
+			}
+			parts = append(parts, pm)
+		}
+		if d.err == nil && name == topic && code != 0 {
+			return nil, nil, code
+		}
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	if len(parts) == 0 {
+		return nil, nil, Error(3)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].id < parts[j].id })
+	return brokers, parts, nil
+}
+
+// bootstrap connects to the first reachable broker of the configuration,
+// and returns its address and the connection.
+func (p *Producer) bootstrap(ctx context.Context) (string, *conn, error) {
+	var lastErr error
+	for _, i := range rand.Perm(len(p.cfg.Brokers)) {
+		addr := p.cfg.Brokers[i]
+		c, err := p.getConn(ctx, addr)
+		if err == nil {
+			return addr, c, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no brokers configured")
+	}
+	return "", nil, lastErr
+}
+
+// Produce sends msgs to topic. Messages with a key are assigned to a
+// partition the same way as the Java client does; the others are sent to a
+// random partition.
+func (p *Producer) Produce(ctx context.Context, topic string, msgs ...Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	baddr, bc, err := p.bootstrap(ctx)
+	if err != nil {
+		return err
+	}
+	brokers, parts, err := p.metadata(ctx, bc, topic)
+	if err != nil {
+		bc.Close()
+		return errors.Wrapf(err, "metadata of topic %q", topic)
+	}
+	p.putConn(baddr, bc)
+
+	// Group the messages by partition and the partitions by leader.
+	byLeader := map[int32]map[int32][]Message{}
+	for _, m := range msgs {
+		var pm partitionMeta
+		if m.Key != nil {
+			pm = parts[int(murmur2(m.Key)&0x7fffffff)%len(parts)]
+		} else {
+			pm = parts[rand.Intn(len(parts))]
+		}
+		if pm.leader < 0 {
+			return errors.Wrapf(Error(5), "partition %d of topic %q", pm.id, topic)
+		}
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		if byLeader[pm.leader] == nil {
+			byLeader[pm.leader] = map[int32][]Message{}
+		}
+		byLeader[pm.leader][pm.id] = append(byLeader[pm.leader][pm.id], m)
+	}
+
+	for leader, partitions := range byLeader {
+		addr, ok := brokers[leader]
+		if !ok {
+			return errors.Wrapf(Error(8), "leader %d of topic %q", leader, topic)
+		}
+		c, err := p.getConn(ctx, addr)
+		if err != nil {
+			return err
+		}
+		if err := p.produce(ctx, c, topic, partitions); err != nil {
+			c.Close()
+			return err
+		}
+		p.putConn(addr, c)
+	}
+	return nil
+}
+
+func (p *Producer) produce(ctx context.Context, c *conn, topic string, partitions map[int32][]Message) error {
+	var e encoder
+	e.nullString() // transactional id
+	e.int16(p.cfg.Acks)
+	e.int32(int32(p.cfg.Timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(partitions)))
+	for id, msgs := range partitions {
+		e.int32(id)
+		e.bytes(encodeRecordBatch(msgs))
+	}
+
+	resp, err := c.roundTrip(ctx, apiProduce, 3, e.b, p.cfg.Acks == AcksNone)
+	if err != nil || p.cfg.Acks == AcksNone {
+		return err
+	}
+
+	d := decoder{b: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		d.string() // topic
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			id := d.int32()
+			code := Error(d.int16())
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && code != 0 {
+				return errors.Wrapf(code, "partition %d of topic %q", id, topic)
+			}
+		}
+	}
+	return d.err
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// Record batches of a fetch response captured from a broker, from the
+// fixtures of github.com/segmentio/kafka-go (fixtures/v2-v2.hex). The
+// partition leader epoch, which is set by the broker and not covered by the
+// CRC, is replaced by the -1 sent by producers, and the base offset of the
+// second batch, assigned by the broker too, by 0.
+const (
+	brokerBatch1 = "0000000000000000" + "0000008a" + "ffffffff" + "02" + "3978fc3b" +
+		"0000" + "00000001" + "0000017c4f173eb9" + "0000017c4f173ed2" +
+		"ffffffffffffffff" + "ffff" + "ffffffff" + "00000002" +
+		"580000000a616c706861427b22636f756e74223a302c2266696c6c6572223a2261616161616161616161227d00" +
+		"560032020862657461427b22636f756e74223a302c2266696c6c6572223a2262626262626262626262227d00"
+	brokerBatch2 = "0000000000000000" + "0000008c" + "ffffffff" + "02" + "fa7514ab" +
+		"0000" + "00000001" + "0000017c4f175fa0" + "0000017c4f17631f" +
+		"ffffffffffffffff" + "ffff" + "ffffffff" + "00000002" +
+		"580000000a67616d6d61427b22636f756e74223a302c2266696c6c6572223a2263636363636363636363227d00" +
+		"5a00fe0d020a64656c7461427b22636f756e74223a302c2266696c6c6572223a2264646464646464646464227d00"
+)
+
+func TestEncodeRecordBatch(t *testing.T) {
+	ms := func(v int64) time.Time {
+		return time.Unix(0, v*int64(time.Millisecond))
+	}
+	for _, tc := range []struct {
+		name string
+		msgs []Message
+		want string
+	}{
+		{
+			name: "broker batch 1",
+			msgs: []Message{
+				{Key: []byte("alpha"), Value: []byte(`{"count":0,"filler":"aaaaaaaaaa"}`), Time: ms(0x17c4f173eb9)},
+				{Key: []byte("beta"), Value: []byte(`{"count":0,"filler":"bbbbbbbbbb"}`), Time: ms(0x17c4f173ed2)},
+			},
+			want: brokerBatch1,
+		},
+		{
+			name: "broker batch 2",
+			msgs: []Message{
+				{Key: []byte("gamma"), Value: []byte(`{"count":0,"filler":"cccccccccc"}`), Time: ms(0x17c4f175fa0)},
+				{Key: []byte("delta"), Value: []byte(`{"count":0,"filler":"dddddddddd"}`), Time: ms(0x17c4f17631f)},
+			},
+			want: brokerBatch2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want, err := hex.DecodeString(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := encodeRecordBatch(tc.msgs); !bytes.Equal(got, want) {
+				t.Fatalf("got\n%x\nwant\n%x", got, want)
+			}
+		})
+	}
+}
+
+func TestCRC32C(t *testing.T) {
+	// The check value of CRC-32C (Castagnoli).
+	if got := crc32.Checksum([]byte("123456789"), crc32c); got != 0xe3069283 {
+		t.Fatalf("got %#x, want 0xe3069283", got)
+	}
+}
+
+func TestMurmur2(t *testing.T) {
+	// The hashes of the Java client, as listed by librdkafka
+	// (src/rdmurmur2.c).
+	for _, tc := range []struct {
+		key  []byte
+		want uint32
+	}{
+		{[]byte("kafka"), 0xd067cf64},
+		{[]byte("giberish123456789"), 0x8f552b0c},
+		{[]byte("1234"), 0x9fc97b14},
+		{[]byte("234"), 0xe7c009ca},
+		{[]byte("34"), 0x873930da},
+		{[]byte("4"), 0x5a4b5ca1},
+		{[]byte("PreAmbleWillBeRemoved,ThePrePartThatIs"), 0x78424f1c},
+		{[]byte("reAmbleWillBeRemoved,ThePrePartThatIs"), 0x4a62b377},
+		{[]byte("eAmbleWillBeRemoved,ThePrePartThatIs"), 0xe0e4e09e},
+		{[]byte("AmbleWillBeRemoved,ThePrePartThatIs"), 0x62b8b43f},
+		{[]byte(""), 0x106e08d9},
+		{nil, 0x106e08d9},
+	} {
+		if got := uint32(murmur2(tc.key)); got != tc.want {
+			t.Errorf("murmur2(%q) = %#x, want %#x", tc.key, got, tc.want)
+		}
+	}
+}
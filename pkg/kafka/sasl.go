@@ -0,0 +1,203 @@
+package kafka
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Supported SASL mechanisms.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// SASLConfig configures the SASL authentication to the brokers.
+type SASLConfig struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+func (c *conn) authenticate(ctx context.Context, cfg *SASLConfig) error {
+	var e encoder
+	e.string(cfg.Mechanism)
+	resp, err := c.roundTrip(ctx, apiSaslHandshake, 1, e.b, false)
+	if err != nil {
+		return err
+	}
+	d := decoder{b: resp}
+	if code := Error(d.int16()); code != 0 {
+		return code
+	}
+
+	switch cfg.Mechanism {
+	case SASLPlain:
+		_, err = c.saslAuthenticate(ctx, []byte("\x00"+cfg.Username+"\x00"+cfg.Password))
+		return err
+	case SASLScramSHA256:
+		return c.scram(ctx, sha256.New, cfg.Username, cfg.Password)
+	case SASLScramSHA512:
+		return c.scram(ctx, sha512.New, cfg.Username, cfg.Password)
+	}
+	return errors.Errorf("unsupported SASL mechanism %q", cfg.Mechanism)
+}
+
+func (c *conn) saslAuthenticate(ctx context.Context, token []byte) ([]byte, error) {
+	var e encoder
+	e.bytes(token)
+	resp, err := c.roundTrip(ctx, apiSaslAuthenticate, 0, e.b, false)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{b: resp}
+	code := Error(d.int16())
+	msg := d.string()
+	token = d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if code != 0 {
+		if msg != "" {
+			return nil, errors.Wrap(code, msg)
+		}
+		return nil, code
+	}
+	return token, nil
+}
+
+// scram runs the SCRAM exchange as described in RFC 5802.
+func (c *conn) scram(ctx context.Context, h func() hash.Hash, username, password string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sc := newScramClient(h, username, password, base64.RawStdEncoding.EncodeToString(nonce))
+
+	serverFirst, err := c.saslAuthenticate(ctx, []byte(sc.first()))
+	if err != nil {
+		return err
+	}
+	clientFinal, err := sc.final(string(serverFirst))
+	if err != nil {
+		return err
+	}
+	serverFinal, err := c.saslAuthenticate(ctx, []byte(clientFinal))
+	if err != nil {
+		return err
+	}
+	return sc.verify(string(serverFinal))
+}
+
+// scramClient computes the client messages of a SCRAM exchange.
+type scramClient struct {
+	h               func() hash.Hash
+	password        string
+	nonce           string
+	clientFirstBare string
+	saltedPassword  []byte
+	authMessage     string
+}
+
+func newScramClient(h func() hash.Hash, username, password, nonce string) *scramClient {
+	user := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+	return &scramClient{
+		h:               h,
+		password:        password,
+		nonce:           nonce,
+		clientFirstBare: "n=" + user + ",r=" + nonce,
+	}
+}
+
+// first returns the client-first-message.
+func (s *scramClient) first() string {
+	return "n,," + s.clientFirstBare
+}
+
+// final returns the client-final-message answering serverFirst.
+func (s *scramClient) final(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	if !strings.HasPrefix(attrs["r"], s.nonce) {
+		return "", errors.New("invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", errors.Wrap(err, "invalid SCRAM salt")
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return "", errors.New("invalid SCRAM iteration count")
+	}
+
+	clientFinalBare := "c=biws,r=" + attrs["r"]
+	s.authMessage = s.clientFirstBare + "," + serverFirst + "," + clientFinalBare
+
+	s.saltedPassword = pbkdf2(s.h, []byte(s.password), salt, iterations)
+	clientKey := hmacSum(s.h, s.saltedPassword, []byte("Client Key"))
+	storedKey := s.h()
+	storedKey.Write(clientKey)
+	clientSignature := hmacSum(s.h, storedKey.Sum(nil), []byte(s.authMessage))
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	return clientFinalBare + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verify checks the server signature of serverFinal.
+func (s *scramClient) verify(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return errors.Errorf("SCRAM server error: %s", e)
+	}
+	serverKey := hmacSum(s.h, s.saltedPassword, []byte("Server Key"))
+	serverSignature := base64.StdEncoding.EncodeToString(hmacSum(s.h, serverKey, []byte(s.authMessage)))
+	if !hmac.Equal([]byte(attrs["v"]), []byte(serverSignature)) {
+		return errors.New("invalid SCRAM server signature")
+	}
+	return nil
+}
+
+func scramAttributes(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if len(kv) > 2 && kv[1] == '=' {
+			attrs[kv[:1]] = kv[2:]
+		}
+	}
+	return attrs
+}
+
+func hmacSum(h func() hash.Hash, key, data []byte) []byte {
+	mac := hmac.New(h, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// pbkdf2 derives a key as described in RFC 8018. SCRAM only uses the first
+// block.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	out := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+	return out
+}
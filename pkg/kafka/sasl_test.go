@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+func TestScramClient(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		h           func() hash.Hash
+		nonce       string
+		serverFirst string
+		clientFinal string
+		serverFinal string
+	}{
+		{
+			// RFC 7677, section 3.
+			name:        "SCRAM-SHA-256",
+			h:           sha256.New,
+			nonce:       "rOprNGfwEbeRWgbNEkqO",
+			serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+		{
+			// RFC 5802, section 5.
+			name:        "SCRAM-SHA-1",
+			h:           sha1.New,
+			nonce:       "fyko+d2lbbFgONRv9qkxdawL",
+			serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := newScramClient(tc.h, "user", "pencil", tc.nonce)
+			if got, want := sc.first(), "n,,n=user,r="+tc.nonce; got != want {
+				t.Fatalf("got client first %q, want %q", got, want)
+			}
+			clientFinal, err := sc.final(tc.serverFirst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clientFinal != tc.clientFinal {
+				t.Fatalf("got client final %q, want %q", clientFinal, tc.clientFinal)
+			}
+			if err := sc.verify(tc.serverFinal); err != nil {
+				t.Fatal(err)
+			}
+			if err := sc.verify("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G5="); err == nil {
+				t.Fatal("invalid server signature accepted")
+			}
+		})
+	}
+}
+
+func TestScramClientInvalidNonce(t *testing.T) {
+	sc := newScramClient(sha256.New, "user", "pencil", "rOprNGfwEbeRWgbNEkqO")
+	if _, err := sc.final("r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"); err == nil {
+		t.Fatal("server nonce not starting with the client nonce accepted")
+	}
+}
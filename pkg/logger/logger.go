@@ -2,20 +2,109 @@ package logger
 
 import (
 	"os"
+	"sync/atomic"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 )
 
+// Log formats.
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// levels are the log levels, from the most verbose.
+var levels = []string{"debug", "info", "warn", "error"}
+
 var (
 	Logger = log.NewNopLogger()
+
+	logLevel  = "info"
+	logFormat = FormatLogfmt
+
+	// minLevel is the index in levels of the least severe level logged. It
+	// can be changed at runtime.
+	minLevel int32
 )
 
-func InitLogger() {
-	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-	logger = level.NewFilter(logger, level.AllowAll())
+// AddFlags adds the flags of the log level and format to the given FlagSet.
+func AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&logLevel, "log.level", logLevel, "Only log messages with the given severity or above. One of: debug, info, warn, error.")
+	f.StringVar(&logFormat, "log.format", logFormat, "Output format of log messages. One of: logfmt, json.")
+}
+
+func parseLevel(l string) (int32, error) {
+	for i, name := range levels {
+		if l == name {
+			return int32(i), nil
+		}
+	}
+	return 0, errors.Errorf("invalid log level %q, must be one of debug, info, warn, error", l)
+}
+
+// InitLogger sets Logger up with the level and the format of the flags.
+func InitLogger() error {
+	lvl, err := parseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	var logger log.Logger
+	switch logFormat {
+	case FormatLogfmt:
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	case FormatJSON:
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	default:
+		return errors.Errorf("invalid log format %q, must be one of logfmt, json", logFormat)
+	}
+	atomic.StoreInt32(&minLevel, lvl)
+	logger = levelFilter{next: logger}
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
 	Logger = log.With(logger, "caller", log.Caller(3))
+	return nil
+}
+
+// Level returns the least severe level logged.
+func Level() string {
+	return levels[atomic.LoadInt32(&minLevel)]
+}
+
+// SetLevel changes the least severe level logged.
+func SetLevel(l string) error {
+	lvl, err := parseLevel(l)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&minLevel, lvl)
+	return nil
+}
+
+// levelFilter drops the messages below the current level. Unlike
+// level.NewFilter, the level can be changed after the loggers derived from
+// it are created. Messages without a level are logged.
+type levelFilter struct {
+	next log.Logger
+}
+
+func (l levelFilter) Log(keyvals ...interface{}) error {
+	min := atomic.LoadInt32(&minLevel)
+	for i := 1; i < len(keyvals); i += 2 {
+		if keyvals[i-1] != level.Key() {
+			continue
+		}
+		v, ok := keyvals[i].(level.Value)
+		if !ok {
+			break
+		}
+		if lvl, err := parseLevel(v.String()); err == nil && lvl < min {
+			return nil
+		}
+		break
+	}
+	return l.next.Log(keyvals...)
 }
 
 func WithUserID(userID string, l log.Logger) log.Logger {
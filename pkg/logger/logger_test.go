@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestSetLevel(t *testing.T) {
+	defer func() { _ = SetLevel("info") }()
+
+	var buf bytes.Buffer
+	// Loggers derived before the level changes follow it.
+	l := log.With(levelFilter{next: log.NewLogfmtLogger(&buf)}, "component", "test")
+	if err := SetLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	_ = level.Info(l).Log("msg", "dropped")
+	_ = level.Warn(l).Log("msg", "kept")
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	_ = level.Debug(l).Log("msg", "debug")
+	_ = l.Log("msg", "no level")
+
+	got := buf.String()
+	for _, want := range []string{"msg=kept", "msg=debug", `msg="no level"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "dropped") {
+		t.Errorf("info message logged at warn level: %q", got)
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if Level() != "debug" {
+		t.Errorf("got level %s, want debug", Level())
+	}
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/aws"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// SNS's subject must be less than 100 characters.
+const snsMaxSubjectLen = 99
+
+var (
+	awsPolicyMtx      sync.RWMutex
+	awsAllowAmbient   bool
+	awsAllowedRoleARN = map[string]bool{}
+)
+
+// SetAWSCredentialsPolicy sets which credentials of the Alertmanager the
+// SNS and SQS integrations without keys may use. The credentials of the
+// environment (IRSA, ECS task role, EC2 instance role) are used as is if
+// allowAmbient is set, and to assume the roles of roleARNs. Integrations
+// without keys are rejected until it is called.
+func SetAWSCredentialsPolicy(allowAmbient bool, roleARNs []string) {
+	allowed := make(map[string]bool, len(roleARNs))
+	for _, arn := range roleARNs {
+		allowed[arn] = true
+	}
+	awsPolicyMtx.Lock()
+	defer awsPolicyMtx.Unlock()
+	awsAllowAmbient = allowAmbient
+	awsAllowedRoleARN = allowed
+}
+
+// checkAWSCredentials checks that an integration sending its requests to
+// endpoint may use the credentials of its configuration. The credentials
+// of the Alertmanager are only sent to AWS.
+func checkAWSCredentials(conf *AWSConfig, endpoint *url.URL) error {
+	if conf.AccessKey != "" {
+		return nil
+	}
+	awsPolicyMtx.RLock()
+	defer awsPolicyMtx.RUnlock()
+	switch {
+	case conf.RoleARN != "" && !awsAllowedRoleARN[conf.RoleARN]:
+		return errors.Errorf("role_arn %q is not allowed without access_key", conf.RoleARN)
+	case conf.RoleARN == "" && !awsAllowAmbient:
+		return errors.New("access_key and secret_key are required")
+	}
+	if endpoint != nil {
+		if host := strings.ToLower(endpoint.Hostname()); host != "amazonaws.com" && !strings.HasSuffix(host, ".amazonaws.com") {
+			return errors.Errorf("endpoint %q is not allowed without access_key", endpoint.Host)
+		}
+	}
+	return nil
+}
+
+// validateAWS checks that the SNS and SQS integrations may use their
+// credentials, see checkAWSCredentials.
+func validateAWS(cfg *Config) error {
+	for _, rc := range cfg.Receivers {
+		for _, c := range rc.SNSConfigs {
+			if err := checkAWSCredentials(&c.AWSConfig, urlOf(c.Endpoint)); err != nil {
+				return errors.Wrapf(err, "receiver %q: sns config", rc.Name)
+			}
+		}
+		for _, c := range rc.SQSConfigs {
+			if err := checkAWSCredentials(&c.AWSConfig, urlOf(c.QueueURL)); err != nil {
+				return errors.Wrapf(err, "receiver %q: sqs config", rc.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func urlOf(u *config.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	return u.URL
+}
+
+// SNS implements a Notifier publishing webhook messages to an AWS SNS topic.
+type SNS struct {
+	conf   *SNSConfig
+	tmpl   *template.Template
+	logger log.Logger
+	creds  aws.CredentialsProvider
+}
+
+// NewSNS returns a new SNS notifier.
+func NewSNS(c *SNSConfig, t *template.Template, l log.Logger) *SNS {
+	return &SNS{
+		conf:   c,
+		tmpl:   t,
+		logger: l,
+		creds:  aws.NewCredentialsProvider(c.Region, c.AccessKey, string(c.SecretKey), c.RoleARN),
+	}
+}
+
+// Render implements the Renderer interface.
+func (n *SNS) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	return n.params(ctx, as...)
+}
+
+func (n *SNS) params(ctx context.Context, as ...*types.Alert) (url.Values, error) {
+	msg, data, err := webhookMessage(ctx, n.tmpl, n.logger, as...)
+	if err != nil {
+		return nil, err
+	}
+	subject := tmplText(n.tmpl, data, &err)(n.conf.Subject)
+	if err != nil {
+		return nil, err
+	}
+	subject, _ = truncate(strings.Replace(subject, "\n", " ", -1), snsMaxSubjectLen)
+
+	params := url.Values{
+		"Action":   {"Publish"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {n.conf.TopicARN},
+		"Message":  {string(msg)},
+	}
+	if subject != "" {
+		params.Set("Subject", subject)
+	}
+	return params, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *SNS) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	params, err := n.params(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	return awsCall(ctx, &n.conf.AWSConfig, n.conf.HTTPConfig, n.creds, "sns", "", params)
+}
+
+// SQS implements a Notifier sending webhook messages to an AWS SQS queue.
+type SQS struct {
+	conf   *SQSConfig
+	tmpl   *template.Template
+	logger log.Logger
+	creds  aws.CredentialsProvider
+}
+
+// NewSQS returns a new SQS notifier.
+func NewSQS(c *SQSConfig, t *template.Template, l log.Logger) *SQS {
+	return &SQS{
+		conf:   c,
+		tmpl:   t,
+		logger: l,
+		creds:  aws.NewCredentialsProvider(c.Region, c.AccessKey, string(c.SecretKey), c.RoleARN),
+	}
+}
+
+// Render implements the Renderer interface.
+func (n *SQS) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	return n.params(ctx, as...)
+}
+
+func (n *SQS) params(ctx context.Context, as ...*types.Alert) (url.Values, error) {
+	msg, _, err := webhookMessage(ctx, n.tmpl, n.logger, as...)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"Action":      {"SendMessage"},
+		"Version":     {"2012-11-05"},
+		"MessageBody": {string(msg)},
+	}, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *SQS) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	params, err := n.params(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	return awsCall(ctx, &n.conf.AWSConfig, n.conf.HTTPConfig, n.creds, "sqs", n.conf.QueueURL.String(), params)
+}
+
+// awsCall sends a signed query API request to the given AWS service. The
+// request is sent to endpoint if set, otherwise to the configured or the
+// regional endpoint of the service.
+func awsCall(ctx context.Context, conf *AWSConfig, httpConf *commoncfg.HTTPClientConfig, creds aws.CredentialsProvider, service, endpoint string, params url.Values) (bool, error) {
+	if endpoint == "" {
+		if conf.Endpoint != nil {
+			endpoint = conf.Endpoint.String()
+		} else {
+			endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/", service, conf.Region)
+		}
+	}
+
+	// The credentials policy may have changed since the config was loaded.
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false, err
+	}
+	if err := checkAWSCredentials(conf, u); err != nil {
+		return false, err
+	}
+
+	c, err := newHTTPClient(ctx, *httpConf)
+	if err != nil {
+		return false, err
+	}
+	credentials, err := creds.Credentials(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	body := []byte(params.Encode())
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("User-Agent", userAgentHeader)
+	aws.Signer{Region: conf.Region, Service: service}.Sign(req, body, credentials, time.Now())
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckAWSCredentials(t *testing.T) {
+	SetAWSCredentialsPolicy(false, []string{"arn:aws:iam::1:role/alerts"})
+	defer SetAWSCredentialsPolicy(false, nil)
+
+	regional, _ := url.Parse("https://sqs.us-east-1.amazonaws.com/1/alerts")
+	custom, _ := url.Parse("https://sqs.example.com/1/alerts")
+	for _, tc := range []struct {
+		name     string
+		conf     AWSConfig
+		endpoint *url.URL
+		err      string
+	}{
+		{name: "keys", conf: AWSConfig{AccessKey: "id", SecretKey: "secret", RoleARN: "arn:aws:iam::2:role/any"}, endpoint: custom},
+		{name: "ambient", conf: AWSConfig{}, err: "access_key and secret_key are required"},
+		{name: "allowed role", conf: AWSConfig{RoleARN: "arn:aws:iam::1:role/alerts"}, endpoint: regional},
+		{name: "other role", conf: AWSConfig{RoleARN: "arn:aws:iam::2:role/admin"}, err: "is not allowed"},
+		{name: "custom endpoint", conf: AWSConfig{RoleARN: "arn:aws:iam::1:role/alerts"}, endpoint: custom, err: "endpoint"},
+	} {
+		err := checkAWSCredentials(&tc.conf, tc.endpoint)
+		if (err == nil) != (tc.err == "") || (err != nil && !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.err)
+		}
+	}
+
+	SetAWSCredentialsPolicy(true, nil)
+	if err := checkAWSCredentials(&AWSConfig{}, regional); err != nil {
+		t.Fatalf("ambient credentials not allowed: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+const (
+	// clientIdleTTL is how long a cached client is kept without being used.
+	clientIdleTTL = 15 * time.Minute
+	// clientMaxAge is how long a cached client is reused, after which it is
+	// built again to read rotated TLS certificates and bearer tokens.
+	clientMaxAge = time.Hour
+	// clientSweepInterval is how frequently the idle clients are evicted.
+	clientSweepInterval = time.Minute
+)
+
+var (
+	httpClientLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "notifier_http_client_lookups_total",
+		Help:      "The total number of lookups of the cached HTTP clients of the notifiers, by whether the client was cached.",
+	}, []string{"result"})
+	httpClientsCached = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "notifier_http_clients_cached",
+		Help:      "The number of HTTP clients of the notifiers cached for reuse.",
+	})
+	httpConnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "notifier_http_connections_total",
+		Help:      "The total number of connections dialed by the HTTP clients of the notifiers. Compared to the notifications, it shows how many connections are reused.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(httpClientLookups)
+	prometheus.MustRegister(httpClientsCached)
+	prometheus.MustRegister(httpConnections)
+}
+
+var clients = &clientCache{entries: map[string]*cachedClient{}}
+
+// clientCache holds the HTTP clients of the notifiers by the hash of their
+// configuration, so that the connections are kept alive across
+// notifications and shared by the integrations configured alike.
+type clientCache struct {
+	mtx       sync.Mutex
+	entries   map[string]*cachedClient
+	lastSweep time.Time
+}
+
+type cachedClient struct {
+	client   *http.Client
+	created  time.Time
+	lastUsed time.Time
+}
+
+// get returns the cached client for cfg and s, building it if needed.
+func (c *clientCache) get(cfg commoncfg.HTTPClientConfig, s HTTPClientSettings, now time.Time) (*http.Client, error) {
+	key := clientCacheKey(cfg, s)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sweep(now)
+	if e, ok := c.entries[key]; ok && now.Sub(e.created) < clientMaxAge {
+		e.lastUsed = now
+		httpClientLookups.WithLabelValues("hit").Inc()
+		return e.client, nil
+	}
+	httpClientLookups.WithLabelValues("miss").Inc()
+	client, err := buildHTTPClient(cfg, s)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := c.entries[key]; ok {
+		e.client.CloseIdleConnections()
+	}
+	c.entries[key] = &cachedClient{client: client, created: now, lastUsed: now}
+	httpClientsCached.Set(float64(len(c.entries)))
+	return client, nil
+}
+
+// sweep evicts the clients not used for clientIdleTTL and closes their
+// connections. Must be called with the lock held.
+func (c *clientCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < clientSweepInterval {
+		return
+	}
+	c.lastSweep = now
+	for key, e := range c.entries {
+		if now.Sub(e.lastUsed) >= clientIdleTTL || now.Sub(e.created) >= clientMaxAge {
+			e.client.CloseIdleConnections()
+			delete(c.entries, key)
+		}
+	}
+	httpClientsCached.Set(float64(len(c.entries)))
+}
+
+// clientCacheKey hashes everything a client is built from. The secrets are
+// hashed as is, so that clients are never shared between credentials. The
+// URLs are hashed as strings, as the encoding of url.URL drops passwords.
+func clientCacheKey(cfg commoncfg.HTTPClientConfig, s HTTPClientSettings) string {
+	k := struct {
+		BearerToken     string
+		BearerTokenFile string
+		BasicAuth       *commoncfg.BasicAuth
+		ProxyURL        string
+		TLSConfig       commoncfg.TLSConfig
+		Settings        HTTPClientSettings
+		SettingsProxy   string
+	}{
+		BearerToken:     string(cfg.BearerToken),
+		BearerTokenFile: cfg.BearerTokenFile,
+		BasicAuth:       cfg.BasicAuth,
+		TLSConfig:       cfg.TLSConfig,
+		Settings:        s,
+	}
+	if cfg.ProxyURL.URL != nil {
+		k.ProxyURL = cfg.ProxyURL.String()
+	}
+	if u := s.proxyURL(); u != nil {
+		k.SettingsProxy = u.String()
+	}
+	k.Settings.ProxyURL = nil
+	b, _ := json.Marshal(k)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// newHTTPClient returns the HTTP client for cfg, configured by the HTTP
+// client settings of the receiver notified with ctx, see buildHTTPClient.
+// The clients are cached, so that connections are reused.
+func newHTTPClient(ctx context.Context, cfg commoncfg.HTTPClientConfig) (*http.Client, error) {
+	return clients.get(cfg, httpClientSettings(ctx), time.Now())
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// countDials counts the connections dialed by dial.
+func countDials(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err == nil {
+			httpConnections.Inc()
+		}
+		return conn, err
+	}
+}
@@ -0,0 +1,1531 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/kafka"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the alertmanager configuration extended with the receiver
+// integrations which are not supported by upstream alertmanager.
+type Config struct {
+	*config.Config
+
+	// Receivers shadows the upstream receivers, adding the extended
+	// integrations to each of them.
+	Receivers []*Receiver
+
+	ConfigExtension
+}
+
+// ConfigExtension holds the top level fields that can not be parsed by the
+// upstream configuration.
+type ConfigExtension struct {
+	MaintenanceWindows []*MaintenanceWindow `yaml:"maintenance_windows,omitempty" json:"maintenance_windows,omitempty"`
+	FloodProtection    *FloodProtection     `yaml:"flood_protection,omitempty" json:"flood_protection,omitempty"`
+	AlertPreprocessing *AlertPreprocessing  `yaml:"alert_preprocessing,omitempty" json:"alert_preprocessing,omitempty"`
+	EnrichmentWebhook  *EnrichmentWebhook   `yaml:"enrichment_webhook,omitempty" json:"enrichment_webhook,omitempty"`
+	SlackInteractions  *SlackInteractions   `yaml:"slack_interactions,omitempty" json:"slack_interactions,omitempty"`
+	PagerdutyWebhook   *PagerdutyWebhook    `yaml:"pagerduty_webhook,omitempty" json:"pagerduty_webhook,omitempty"`
+	Heartbeats         []*Heartbeat         `yaml:"heartbeats,omitempty" json:"heartbeats,omitempty"`
+	RecurringSilences  []*RecurringSilence  `yaml:"recurring_silences,omitempty" json:"recurring_silences,omitempty"`
+}
+
+// configExtensionKeys are the top level fields which are parsed into
+// ConfigExtension.
+var configExtensionKeys = map[string]bool{
+	"maintenance_windows": true,
+	"flood_protection":    true,
+	"alert_preprocessing": true,
+	"enrichment_webhook":  true,
+	"slack_interactions":  true,
+	"pagerduty_webhook":   true,
+	"heartbeats":          true,
+	"recurring_silences":  true,
+}
+
+// Receiver is an upstream receiver with the extended integrations.
+type Receiver struct {
+	*config.Receiver
+
+	ReceiverExtension
+}
+
+// ReceiverExtension holds the integrations that can not be parsed by the
+// upstream configuration.
+type ReceiverExtension struct {
+	// WebhookConfigs, SlackConfigs, EmailConfigs and PagerdutyConfigs
+	// replace the upstream integrations.
+	WebhookConfigs    []*WebhookConfig    `yaml:"webhook_configs,omitempty" json:"webhook_configs,omitempty"`
+	SlackConfigs      []*SlackConfig      `yaml:"slack_configs,omitempty" json:"slack_configs,omitempty"`
+	EmailConfigs      []*EmailConfig      `yaml:"email_configs,omitempty" json:"email_configs,omitempty"`
+	PagerdutyConfigs  []*PagerdutyConfig  `yaml:"pagerduty_configs,omitempty" json:"pagerduty_configs,omitempty"`
+	MSTeamsConfigs    []*MSTeamsConfig    `yaml:"msteams_configs,omitempty" json:"msteams_configs,omitempty"`
+	WebexConfigs      []*WebexConfig      `yaml:"webex_configs,omitempty" json:"webex_configs,omitempty"`
+	GoogleChatConfigs []*GoogleChatConfig `yaml:"googlechat_configs,omitempty" json:"googlechat_configs,omitempty"`
+	DiscordConfigs    []*DiscordConfig    `yaml:"discord_configs,omitempty" json:"discord_configs,omitempty"`
+	MattermostConfigs []*MattermostConfig `yaml:"mattermost_configs,omitempty" json:"mattermost_configs,omitempty"`
+	ServiceNowConfigs []*ServiceNowConfig `yaml:"servicenow_configs,omitempty" json:"servicenow_configs,omitempty"`
+	TwilioConfigs     []*TwilioConfig     `yaml:"twilio_configs,omitempty" json:"twilio_configs,omitempty"`
+	SNSConfigs        []*SNSConfig        `yaml:"sns_configs,omitempty" json:"sns_configs,omitempty"`
+	SQSConfigs        []*SQSConfig        `yaml:"sqs_configs,omitempty" json:"sqs_configs,omitempty"`
+	KafkaConfigs      []*KafkaConfig      `yaml:"kafka_configs,omitempty" json:"kafka_configs,omitempty"`
+	ExecConfigs       []*ExecConfig       `yaml:"exec_configs,omitempty" json:"exec_configs,omitempty"`
+
+	RetryPolicy *RetryPolicy        `yaml:"retry_policy,omitempty" json:"retry_policy,omitempty"`
+	HTTPClient  *HTTPClientSettings `yaml:"http_client,omitempty" json:"http_client,omitempty"`
+	// Escalations route the notifications of alert groups firing and
+	// unacknowledged for long to other receivers, see EscalationStage.
+	Escalations []*EscalationStep `yaml:"escalations,omitempty" json:"escalations,omitempty"`
+
+	// Registered holds the configs of the integrations added with
+	// RegisterIntegration, by receiver field.
+	Registered map[string][]NotifierConfig `yaml:"-" json:"-"`
+}
+
+// extensionKeys are the receiver fields which are parsed into ReceiverExtension.
+var extensionKeys = map[string]bool{
+	"webhook_configs":    true,
+	"slack_configs":      true,
+	"email_configs":      true,
+	"pagerduty_configs":  true,
+	"msteams_configs":    true,
+	"webex_configs":      true,
+	"googlechat_configs": true,
+	"discord_configs":    true,
+	"mattermost_configs": true,
+	"servicenow_configs": true,
+	"twilio_configs":     true,
+	"sns_configs":        true,
+	"sqs_configs":        true,
+	"kafka_configs":      true,
+	"exec_configs":       true,
+	"retry_policy":       true,
+	"http_client":        true,
+	"escalations":        true,
+}
+
+// LoadConfig parses the YAML input s into a Config. The extended integrations
+// are removed from the receivers before the rest of the configuration is
+// handed to the upstream parser.
+func LoadConfig(s string) (*Config, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, err
+	}
+
+	var upstreamRaw, extensionRaw yaml.MapSlice
+	for _, item := range raw {
+		if key, ok := item.Key.(string); ok && configExtensionKeys[key] {
+			extensionRaw = append(extensionRaw, item)
+		} else {
+			upstreamRaw = append(upstreamRaw, item)
+		}
+	}
+	raw = upstreamRaw
+
+	exts := map[string]*ReceiverExtension{}
+	for i, item := range raw {
+		if item.Key != "receivers" {
+			continue
+		}
+		receivers, ok := item.Value.([]interface{})
+		if !ok {
+			continue
+		}
+		for j, r := range receivers {
+			rcv, ok := r.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+			var name string
+			var upstream, extension yaml.MapSlice
+			for _, f := range rcv {
+				if f.Key == "name" {
+					name = fmt.Sprint(f.Value)
+				}
+				if key, ok := f.Key.(string); ok && (extensionKeys[key] || registeredIntegration(key) != nil) {
+					extension = append(extension, f)
+				} else {
+					upstream = append(upstream, f)
+				}
+			}
+			if len(extension) > 0 {
+				ext, err := loadReceiverExtension(extension)
+				if err != nil {
+					return nil, errors.Wrapf(err, "receiver %q", name)
+				}
+				exts[name] = ext
+			}
+			receivers[j] = upstream
+		}
+		raw[i].Value = receivers
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	amCfg, err := config.Load(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Config: amCfg}
+	for _, rc := range amCfg.Receivers {
+		rcv := &Receiver{Receiver: rc}
+		if ext, ok := exts[rc.Name]; ok {
+			rcv.ReceiverExtension = *ext
+		}
+		cfg.Receivers = append(cfg.Receivers, rcv)
+	}
+	if len(extensionRaw) > 0 {
+		data, err := yaml.Marshal(extensionRaw)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg.ConfigExtension); err != nil {
+			return nil, err
+		}
+		if err := cfg.ConfigExtension.validate(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateEscalations(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateSlackInteractions(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateExec(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateAWS(cfg); err != nil {
+		return nil, err
+	}
+	if err := setGlobalDefaults(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *ConfigExtension) validate(cfg *Config) error {
+	receivers := map[string]bool{}
+	for _, rc := range cfg.Receivers {
+		receivers[rc.Name] = true
+	}
+	windows := map[string]bool{}
+	for _, w := range c.MaintenanceWindows {
+		if windows[w.Name] {
+			return errors.Errorf("maintenance window %q is not unique", w.Name)
+		}
+		windows[w.Name] = true
+		for _, r := range w.Receivers {
+			if !receivers[r] {
+				return errors.Errorf("maintenance window %q: undefined receiver %q", w.Name, r)
+			}
+		}
+	}
+	heartbeats := map[string]bool{}
+	for _, h := range c.Heartbeats {
+		if heartbeats[h.Name] {
+			return errors.Errorf("heartbeat %q is not unique", h.Name)
+		}
+		heartbeats[h.Name] = true
+		if !receivers[h.Receiver] {
+			return errors.Errorf("heartbeat %q: undefined receiver %q", h.Name, h.Receiver)
+		}
+	}
+	silences := map[string]bool{}
+	for _, s := range c.RecurringSilences {
+		if silences[s.Name] {
+			return errors.Errorf("recurring silence %q is not unique", s.Name)
+		}
+		silences[s.Name] = true
+	}
+	return nil
+}
+
+func loadReceiverExtension(fields yaml.MapSlice) (*ReceiverExtension, error) {
+	var builtin, registered yaml.MapSlice
+	for _, f := range fields {
+		if key, _ := f.Key.(string); extensionKeys[key] {
+			builtin = append(builtin, f)
+		} else {
+			registered = append(registered, f)
+		}
+	}
+	data, err := yaml.Marshal(builtin)
+	if err != nil {
+		return nil, err
+	}
+	ext := &ReceiverExtension{}
+	if err := yaml.UnmarshalStrict(data, ext); err != nil {
+		return nil, err
+	}
+	if len(registered) > 0 {
+		if ext.Registered, err = loadRegisteredConfigs(registered); err != nil {
+			return nil, err
+		}
+	}
+	return ext, nil
+}
+
+// setGlobalDefaults fills the extended integrations with the values of the
+// global configuration, as upstream does for its own integrations.
+func setGlobalDefaults(cfg *Config) error {
+	if c := cfg.EnrichmentWebhook; c != nil && c.HTTPConfig == nil {
+		c.HTTPConfig = cfg.Global.HTTPConfig
+	}
+	for _, h := range cfg.Heartbeats {
+		if err := h.setGlobalDefaults(cfg.Global); err != nil {
+			return err
+		}
+	}
+	for _, rcv := range cfg.Receivers {
+		for _, t := range getIntegrationTypes() {
+			if t.SetGlobalDefaults == nil {
+				continue
+			}
+			for _, c := range t.Configs(rcv) {
+				if err := t.SetGlobalDefaults(c, cfg.Global); err != nil {
+					return errors.Wrapf(err, "receiver %q", rcv.Name)
+				}
+			}
+		}
+		for _, c := range rcv.ReceiverExtension.WebhookConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.ReceiverExtension.SlackConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+			if c.APIURL == nil && c.BotToken == "" {
+				if cfg.Global.SlackAPIURL == nil {
+					return errors.Errorf("no global Slack API URL set in receiver %q", rcv.Name)
+				}
+				c.APIURL = cfg.Global.SlackAPIURL
+			}
+		}
+		for _, c := range rcv.ReceiverExtension.EmailConfigs {
+			if err := c.setGlobalDefaults(cfg.Global); err != nil {
+				return errors.Wrapf(err, "receiver %q", rcv.Name)
+			}
+		}
+		for _, c := range rcv.ReceiverExtension.PagerdutyConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+			if c.URL == nil {
+				if cfg.Global.PagerdutyURL == nil {
+					return errors.Errorf("no global PagerDuty URL set in receiver %q", rcv.Name)
+				}
+				c.URL = cfg.Global.PagerdutyURL
+			}
+		}
+		for _, c := range rcv.MSTeamsConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.WebexConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.GoogleChatConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.DiscordConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.MattermostConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.ServiceNowConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.TwilioConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.SNSConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+		for _, c := range rcv.SQSConfigs {
+			if c.HTTPConfig == nil {
+				c.HTTPConfig = cfg.Global.HTTPConfig
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	// DefaultWebhookConfig defines default values for Webhook configurations.
+	DefaultWebhookConfig = WebhookConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		PayloadFormat: WebhookPayloadV4,
+	}
+
+	// DefaultWebhookSigningConfig defines default values for the signing of
+	// webhook requests.
+	DefaultWebhookSigningConfig = WebhookSigningConfig{
+		SignatureHeader: "X-Alertmanager-Signature",
+		TimestampHeader: "X-Alertmanager-Timestamp",
+	}
+
+	// DefaultSlackConfig defines default values for Slack configurations.
+	// They match the upstream defaults.
+	DefaultSlackConfig = SlackConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: false,
+		},
+		Color:      config.DefaultSlackConfig.Color,
+		Username:   config.DefaultSlackConfig.Username,
+		Title:      config.DefaultSlackConfig.Title,
+		TitleLink:  config.DefaultSlackConfig.TitleLink,
+		IconEmoji:  config.DefaultSlackConfig.IconEmoji,
+		IconURL:    config.DefaultSlackConfig.IconURL,
+		Pretext:    config.DefaultSlackConfig.Pretext,
+		Text:       config.DefaultSlackConfig.Text,
+		Fallback:   config.DefaultSlackConfig.Fallback,
+		CallbackID: config.DefaultSlackConfig.CallbackID,
+		Footer:     config.DefaultSlackConfig.Footer,
+	}
+
+	// DefaultEmailConfig defines default values for Email configurations.
+	// They match the upstream defaults.
+	DefaultEmailConfig = EmailConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: false,
+		},
+		HTML: config.DefaultEmailConfig.HTML,
+		Text: config.DefaultEmailConfig.Text,
+	}
+
+	// DefaultPagerdutyConfig defines default values for PagerDuty
+	// configurations. They match the upstream defaults.
+	DefaultPagerdutyConfig = PagerdutyConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Description: config.DefaultPagerdutyConfig.Description,
+		Client:      config.DefaultPagerdutyConfig.Client,
+		ClientURL:   config.DefaultPagerdutyConfig.ClientURL,
+	}
+
+	// DefaultMSTeamsConfig defines default values for Microsoft Teams configurations.
+	DefaultMSTeamsConfig = MSTeamsConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Title: `{{ template "msteams.default.title" . }}`,
+		Text:  `{{ template "msteams.default.text" . }}`,
+	}
+
+	// DefaultWebexConfig defines default values for Webex configurations.
+	DefaultWebexConfig = WebexConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Message: `{{ template "webex.default.message" . }}`,
+	}
+
+	// DefaultGoogleChatConfig defines default values for Google Chat configurations.
+	DefaultGoogleChatConfig = GoogleChatConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Title: `{{ template "googlechat.default.title" . }}`,
+		Text:  `{{ template "googlechat.default.text" . }}`,
+	}
+
+	// DefaultDiscordConfig defines default values for Discord configurations.
+	DefaultDiscordConfig = DiscordConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Title:   `{{ template "discord.default.title" . }}`,
+		Message: `{{ template "discord.default.message" . }}`,
+		Color:   `{{ template "discord.default.color" . }}`,
+	}
+
+	// DefaultMattermostConfig defines default values for Mattermost configurations.
+	DefaultMattermostConfig = MattermostConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Title:     `{{ template "mattermost.default.title" . }}`,
+		TitleLink: `{{ template "mattermost.default.titlelink" . }}`,
+		Text:      `{{ template "mattermost.default.text" . }}`,
+		Fallback:  `{{ template "mattermost.default.title" . }}`,
+		Color:     `{{ template "mattermost.default.color" . }}`,
+	}
+
+	// DefaultServiceNowConfig defines default values for ServiceNow configurations.
+	DefaultServiceNowConfig = ServiceNowConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Table: "incident",
+	}
+
+	// DefaultServiceNowFields defines the default fields of ServiceNow
+	// records.
+	DefaultServiceNowFields = map[string]string{
+		"short_description": `{{ template "servicenow.default.short_description" . }}`,
+		"description":       `{{ template "servicenow.default.description" . }}`,
+	}
+
+	// DefaultServiceNowResolveFields defines the default fields set on
+	// ServiceNow incidents when they are resolved.
+	DefaultServiceNowResolveFields = map[string]string{
+		"state":       "6",
+		"close_code":  "Resolved by caller",
+		"close_notes": `{{ template "servicenow.default.close_notes" . }}`,
+	}
+
+	// DefaultTwilioConfig defines default values for Twilio configurations.
+	DefaultTwilioConfig = TwilioConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: false,
+		},
+		Mode:    TwilioModeSMS,
+		Message: `{{ template "twilio.default.message" . }}`,
+	}
+
+	// DefaultSNSConfig defines default values for SNS configurations.
+	DefaultSNSConfig = SNSConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Subject: `{{ template "sns.default.subject" . }}`,
+	}
+
+	// DefaultSQSConfig defines default values for SQS configurations.
+	DefaultSQSConfig = SQSConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+	}
+
+	// DefaultKafkaConfig defines default values for Kafka configurations.
+	DefaultKafkaConfig = KafkaConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Acks:    KafkaAcksAll,
+		Timeout: model.Duration(10 * time.Second),
+	}
+
+	// DefaultExecConfig defines default values for exec configurations.
+	DefaultExecConfig = ExecConfig{
+		NotifierConfig: config.NotifierConfig{
+			VSendResolved: true,
+		},
+		Timeout: model.Duration(30 * time.Second),
+	}
+
+	// DefaultRetryPolicy defines default values for retry policies. They
+	// match the retries of upstream alertmanager.
+	DefaultRetryPolicy = RetryPolicy{
+		MinBackoff: model.Duration(backoff.DefaultInitialInterval),
+		MaxBackoff: model.Duration(backoff.DefaultMaxInterval),
+		Jitter:     backoff.DefaultRandomizationFactor,
+	}
+
+	e164RE = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+	serviceNowNameRE = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+const (
+	// WebhookPayloadV4 sends the alert group as the upstream version 4
+	// webhook message.
+	WebhookPayloadV4 = "v4"
+	// WebhookPayloadPerAlert sends a request per alert of the group.
+	WebhookPayloadPerAlert = "per_alert"
+	// WebhookPayloadCloudEvents sends the version 4 webhook message in a
+	// structured CloudEvents 1.0 envelope.
+	WebhookPayloadCloudEvents = "cloudevents"
+)
+
+// WebhookConfig configures notifications via a generic webhook. It extends
+// the upstream configuration with request signing.
+type WebhookConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	// URL to send POST request to.
+	URL     *config.URL           `yaml:"url" json:"url"`
+	Signing *WebhookSigningConfig `yaml:"signing,omitempty" json:"signing,omitempty"`
+	// PayloadFormat is the format of the request body, one of v4, per_alert
+	// and cloudevents.
+	PayloadFormat string `yaml:"payload_format,omitempty" json:"payload_format,omitempty"`
+
+	// Headers are added to every request. The values, the bearer token and
+	// the basic auth credentials are templated per alert group.
+	Headers     map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	BearerToken config.Secret     `yaml:"bearer_token,omitempty" json:"bearer_token,omitempty"`
+	BasicAuth   *WebhookBasicAuth `yaml:"basic_auth,omitempty" json:"basic_auth,omitempty"`
+}
+
+// WebhookBasicAuth configures the templated basic auth credentials of
+// webhook requests.
+type WebhookBasicAuth struct {
+	Username string        `yaml:"username" json:"username"`
+	Password config.Secret `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *WebhookConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultWebhookConfig
+	type plain WebhookConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.URL == nil {
+		return errors.New("missing URL in webhook config")
+	}
+	if c.URL.Scheme != "https" && c.URL.Scheme != "http" {
+		return errors.New("scheme required for webhook url")
+	}
+	switch c.PayloadFormat {
+	case WebhookPayloadV4, WebhookPayloadPerAlert, WebhookPayloadCloudEvents:
+	default:
+		return errors.Errorf("invalid payload_format %q in webhook config, must be one of %s, %s, %s",
+			c.PayloadFormat, WebhookPayloadV4, WebhookPayloadPerAlert, WebhookPayloadCloudEvents)
+	}
+	if c.BearerToken != "" && c.BasicAuth != nil {
+		return errors.New("at most one of bearer_token & basic_auth must be configured in webhook config")
+	}
+	if c.BasicAuth != nil && c.BasicAuth.Username == "" {
+		return errors.New("missing basic_auth username in webhook config")
+	}
+	if c.HTTPConfig != nil && (c.BearerToken != "" || c.BasicAuth != nil) &&
+		(c.HTTPConfig.BearerToken != "" || c.HTTPConfig.BearerTokenFile != "" || c.HTTPConfig.BasicAuth != nil) {
+		return errors.New("bearer_token or basic_auth can not be set in both webhook config and its http_config")
+	}
+	for name := range c.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Type", "Content-Length", "Host":
+			return errors.Errorf("header %q can not be overridden in webhook config", name)
+		case "Authorization":
+			if c.BearerToken != "" || c.BasicAuth != nil {
+				return errors.New("authorization header can not be set together with bearer_token or basic_auth in webhook config")
+			}
+		}
+		if c.Signing != nil && (http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(c.Signing.SignatureHeader) ||
+			http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(c.Signing.TimestampHeader)) {
+			return errors.Errorf("header %q is used by the signing config in webhook config", name)
+		}
+	}
+	return nil
+}
+
+// WebhookSigningConfig configures the HMAC-SHA256 signature of webhook
+// requests. The signature covers the timestamp header value, a dot and the
+// request body, and is sent hex encoded as "sha256=<signature>".
+type WebhookSigningConfig struct {
+	Secret          config.Secret `yaml:"secret" json:"secret"`
+	SignatureHeader string        `yaml:"signature_header,omitempty" json:"signature_header,omitempty"`
+	TimestampHeader string        `yaml:"timestamp_header,omitempty" json:"timestamp_header,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *WebhookSigningConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultWebhookSigningConfig
+	type plain WebhookSigningConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Secret == "" {
+		return errors.New("missing secret in webhook signing config")
+	}
+	if c.SignatureHeader == "" || c.TimestampHeader == "" {
+		return errors.New("signature_header and timestamp_header must not be empty in webhook signing config")
+	}
+	if c.SignatureHeader == c.TimestampHeader {
+		return errors.New("signature_header and timestamp_header must differ in webhook signing config")
+	}
+	return nil
+}
+
+const (
+	SlackBlockHeader  = "header"
+	SlackBlockSection = "section"
+	SlackBlockContext = "context"
+	SlackBlockDivider = "divider"
+	SlackBlockActions = "actions"
+)
+
+// SlackConfig configures notifications via Slack. It extends the upstream
+// configuration with the chat.postMessage API, Block Kit layouts and threads.
+type SlackConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	// APIURL is the incoming webhook URL, or the URL of chat.postMessage if
+	// the bot token is set.
+	APIURL *config.SecretURL `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+	// BotToken authenticates messages sent with chat.postMessage instead of
+	// an incoming webhook.
+	BotToken config.Secret `yaml:"bot_token,omitempty" json:"bot_token,omitempty"`
+	// Thread posts the notifications of an alert group in the thread of its
+	// first firing notification. It requires the bot token.
+	Thread bool `yaml:"thread,omitempty" json:"thread,omitempty"`
+
+	// Slack channel override, (like #other-channel or @username).
+	Channel  string `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Color    string `yaml:"color,omitempty" json:"color,omitempty"`
+
+	Title       string                `yaml:"title,omitempty" json:"title,omitempty"`
+	TitleLink   string                `yaml:"title_link,omitempty" json:"title_link,omitempty"`
+	Pretext     string                `yaml:"pretext,omitempty" json:"pretext,omitempty"`
+	Text        string                `yaml:"text,omitempty" json:"text,omitempty"`
+	Fields      []*config.SlackField  `yaml:"fields,omitempty" json:"fields,omitempty"`
+	ShortFields bool                  `yaml:"short_fields,omitempty" json:"short_fields,omitempty"`
+	Footer      string                `yaml:"footer,omitempty" json:"footer,omitempty"`
+	Fallback    string                `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+	CallbackID  string                `yaml:"callback_id,omitempty" json:"callback_id,omitempty"`
+	IconEmoji   string                `yaml:"icon_emoji,omitempty" json:"icon_emoji,omitempty"`
+	IconURL     string                `yaml:"icon_url,omitempty" json:"icon_url,omitempty"`
+	ImageURL    string                `yaml:"image_url,omitempty" json:"image_url,omitempty"`
+	ThumbURL    string                `yaml:"thumb_url,omitempty" json:"thumb_url,omitempty"`
+	LinkNames   bool                  `yaml:"link_names,omitempty" json:"link_names,omitempty"`
+	Actions     []*config.SlackAction `yaml:"actions,omitempty" json:"actions,omitempty"`
+
+	// Blocks is the Block Kit layout of messages, which replaces the
+	// attachment. The fallback is used as the text of notifications.
+	Blocks []*SlackBlock `yaml:"blocks,omitempty" json:"blocks,omitempty"`
+}
+
+// SlackBlock is a Block Kit layout block. Its texts and buttons are templated.
+type SlackBlock struct {
+	Type string `yaml:"type" json:"type"`
+	// Text of header, section and context blocks.
+	Text string `yaml:"text,omitempty" json:"text,omitempty"`
+	// Fields of section blocks.
+	Fields []string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	// Buttons of actions blocks.
+	Buttons []*SlackButton `yaml:"buttons,omitempty" json:"buttons,omitempty"`
+}
+
+// Actions of interactive Slack buttons.
+const (
+	SlackActionSilence = "silence"
+	SlackActionAck     = "ack"
+)
+
+// DefaultSlackSilenceDuration is how long the silence button silences an
+// alert group by default.
+const DefaultSlackSilenceDuration = model.Duration(time.Hour)
+
+// SlackButton is a button of an actions block. It is a link button if the
+// URL is set, or an interactive button handled by the slack interactions
+// endpoint if the action is set.
+type SlackButton struct {
+	Text  string `yaml:"text" json:"text"`
+	URL   string `yaml:"url,omitempty" json:"url,omitempty"`
+	Style string `yaml:"style,omitempty" json:"style,omitempty"`
+	// Action silences the alert group for Duration, or acknowledges it to
+	// stop its escalation.
+	Action   string         `yaml:"action,omitempty" json:"action,omitempty"`
+	Duration model.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+}
+
+// SlackInteractions configures the handling of the callbacks of the
+// interactive buttons of Slack messages. The signing secret of the Slack
+// app verifies the callbacks.
+type SlackInteractions struct {
+	SigningSecret config.Secret `yaml:"signing_secret" json:"signing_secret"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SlackInteractions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain SlackInteractions
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.SigningSecret == "" {
+		return errors.New("slack_interactions: missing signing_secret")
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SlackConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSlackConfig
+	type plain SlackConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.APIURL != nil && c.APIURL.Scheme != "https" && c.APIURL.Scheme != "http" {
+		return errors.New("scheme required for slack api_url")
+	}
+	if c.BotToken != "" && c.Channel == "" {
+		return errors.New("missing channel in slack config with bot_token")
+	}
+	if c.Thread && c.BotToken == "" {
+		return errors.New("thread requires bot_token in slack config")
+	}
+	for _, b := range c.Blocks {
+		if err := b.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *SlackBlock) validate() error {
+	switch b.Type {
+	case SlackBlockHeader, SlackBlockContext:
+		if b.Text == "" {
+			return errors.Errorf("missing text in slack %s block", b.Type)
+		}
+	case SlackBlockSection:
+		if b.Text == "" && len(b.Fields) == 0 {
+			return errors.New("missing text or fields in slack section block")
+		}
+	case SlackBlockDivider:
+	case SlackBlockActions:
+		if len(b.Buttons) == 0 {
+			return errors.New("missing buttons in slack actions block")
+		}
+		for _, btn := range b.Buttons {
+			if btn.Text == "" || (btn.URL == "") == (btn.Action == "") {
+				return errors.New("slack button must have a text and either a url or an action")
+			}
+			switch btn.Action {
+			case "", SlackActionAck:
+			case SlackActionSilence:
+				if btn.Duration < 0 {
+					return errors.New("slack button duration must not be negative")
+				}
+				if btn.Duration == 0 {
+					btn.Duration = DefaultSlackSilenceDuration
+				}
+			default:
+				return errors.Errorf("invalid slack button action %q, must be %s or %s", btn.Action, SlackActionSilence, SlackActionAck)
+			}
+			if btn.Style != "" && btn.Style != "primary" && btn.Style != "danger" {
+				return errors.Errorf("invalid slack button style %q, must be primary or danger", btn.Style)
+			}
+		}
+	default:
+		return errors.Errorf("unsupported slack block type %q", b.Type)
+	}
+	return nil
+}
+
+// EmailConfig configures notifications via email. It extends the upstream
+// configuration with the attachment of the alerts. The SMTP settings not set
+// default to the global ones of the config.
+type EmailConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	// Email address to notify.
+	To           string              `yaml:"to,omitempty" json:"to,omitempty"`
+	From         string              `yaml:"from,omitempty" json:"from,omitempty"`
+	Hello        string              `yaml:"hello,omitempty" json:"hello,omitempty"`
+	Smarthost    string              `yaml:"smarthost,omitempty" json:"smarthost,omitempty"`
+	AuthUsername string              `yaml:"auth_username,omitempty" json:"auth_username,omitempty"`
+	AuthPassword config.Secret       `yaml:"auth_password,omitempty" json:"auth_password,omitempty"`
+	AuthSecret   config.Secret       `yaml:"auth_secret,omitempty" json:"auth_secret,omitempty"`
+	AuthIdentity string              `yaml:"auth_identity,omitempty" json:"auth_identity,omitempty"`
+	Headers      map[string]string   `yaml:"headers,omitempty" json:"headers,omitempty"`
+	HTML         string              `yaml:"html,omitempty" json:"html,omitempty"`
+	Text         string              `yaml:"text,omitempty" json:"text,omitempty"`
+	RequireTLS   *bool               `yaml:"require_tls,omitempty" json:"require_tls,omitempty"`
+	TLSConfig    commoncfg.TLSConfig `yaml:"tls_config,omitempty" json:"tls_config,omitempty"`
+
+	// AttachAlerts attaches the alert group as the JSON webhook message.
+	AttachAlerts bool `yaml:"attach_alerts,omitempty" json:"attach_alerts,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *EmailConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultEmailConfig
+	type plain EmailConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.To == "" {
+		return errors.New("missing to address in email config")
+	}
+	if c.HTML == "" && c.Text == "" {
+		return errors.New("missing html and text in email config")
+	}
+	// Header names are case-insensitive, check for collisions.
+	headers := map[string]string{}
+	for h, v := range c.Headers {
+		normalized := strings.Title(h)
+		if _, ok := headers[normalized]; ok {
+			return errors.Errorf("duplicate header %q in email config", normalized)
+		}
+		headers[normalized] = v
+	}
+	c.Headers = headers
+	return nil
+}
+
+// setGlobalDefaults sets the SMTP settings not set to the global ones, and
+// checks the resulting settings.
+func (c *EmailConfig) setGlobalDefaults(g *config.GlobalConfig) error {
+	if c.Smarthost == "" {
+		if g.SMTPSmarthost == "" {
+			return errors.New("no global SMTP smarthost set")
+		}
+		c.Smarthost = g.SMTPSmarthost
+	}
+	if c.From == "" {
+		if g.SMTPFrom == "" {
+			return errors.New("no global SMTP from set")
+		}
+		c.From = g.SMTPFrom
+	}
+	if c.Hello == "" {
+		c.Hello = g.SMTPHello
+	}
+	if c.AuthUsername == "" {
+		c.AuthUsername = g.SMTPAuthUsername
+	}
+	if c.AuthPassword == "" {
+		c.AuthPassword = g.SMTPAuthPassword
+	}
+	if c.AuthSecret == "" {
+		c.AuthSecret = g.SMTPAuthSecret
+	}
+	if c.AuthIdentity == "" {
+		c.AuthIdentity = g.SMTPAuthIdentity
+	}
+	if c.RequireTLS == nil {
+		requireTLS := g.SMTPRequireTLS
+		c.RequireTLS = &requireTLS
+	}
+
+	host, port, err := net.SplitHostPort(c.Smarthost)
+	if err != nil || host == "" || port == "" {
+		return errors.Errorf("invalid smarthost %q in email config, must be host:port", c.Smarthost)
+	}
+	if c.AuthUsername == "" && (c.AuthPassword != "" || c.AuthSecret != "") {
+		return errors.New("missing auth_username for auth_password or auth_secret in email config")
+	}
+	return nil
+}
+
+const (
+	// PagerdutyChangeEventsResolved sends a change event in addition to
+	// the resolve event when an alert group is resolved.
+	PagerdutyChangeEventsResolved = "resolved"
+	// PagerdutyChangeEventsAll sends all notifications as change events,
+	// for informational alerts which must not open incidents.
+	PagerdutyChangeEventsAll = "all"
+)
+
+// pagerdutyMaxDedupKeyLen is the maximum length of a dedup key accepted by
+// the PagerDuty Events API.
+const pagerdutyMaxDedupKeyLen = 255
+
+// PagerdutyConfig configures notifications via PagerDuty. It extends the
+// upstream configuration with a templated dedup key and change events.
+type PagerdutyConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	ServiceKey  config.Secret           `yaml:"service_key,omitempty" json:"service_key,omitempty"`
+	RoutingKey  config.Secret           `yaml:"routing_key,omitempty" json:"routing_key,omitempty"`
+	URL         *config.URL             `yaml:"url,omitempty" json:"url,omitempty"`
+	Client      string                  `yaml:"client,omitempty" json:"client,omitempty"`
+	ClientURL   string                  `yaml:"client_url,omitempty" json:"client_url,omitempty"`
+	Description string                  `yaml:"description,omitempty" json:"description,omitempty"`
+	Details     map[string]string       `yaml:"details,omitempty" json:"details,omitempty"`
+	Images      []config.PagerdutyImage `yaml:"images,omitempty" json:"images,omitempty"`
+	Links       []config.PagerdutyLink  `yaml:"links,omitempty" json:"links,omitempty"`
+	Severity    string                  `yaml:"severity,omitempty" json:"severity,omitempty"`
+	Class       string                  `yaml:"class,omitempty" json:"class,omitempty"`
+	Component   string                  `yaml:"component,omitempty" json:"component,omitempty"`
+	Group       string                  `yaml:"group,omitempty" json:"group,omitempty"`
+
+	// DedupKey is the template of the dedup key (incident key of the v1
+	// API) of the events. It defaults to the hash of the group key. It must
+	// render the same key for the firing and the resolved notifications of
+	// a group, so it should only use the group and common labels.
+	DedupKey string `yaml:"dedup_key,omitempty" json:"dedup_key,omitempty"`
+	// ChangeEvents is resolved or all to send change events, which require
+	// the routing key.
+	ChangeEvents string `yaml:"change_events,omitempty" json:"change_events,omitempty"`
+	// ChangeURL is the URL change events are sent to, by default the one
+	// of the PagerDuty Events API.
+	ChangeURL *config.URL `yaml:"change_url,omitempty" json:"change_url,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *PagerdutyConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultPagerdutyConfig
+	type plain PagerdutyConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.RoutingKey == "" && c.ServiceKey == "" {
+		return errors.New("missing service or routing key in PagerDuty config")
+	}
+	switch c.ChangeEvents {
+	case "":
+	case PagerdutyChangeEventsResolved, PagerdutyChangeEventsAll:
+		if c.RoutingKey == "" {
+			return errors.New("change_events requires routing_key in PagerDuty config")
+		}
+	default:
+		return errors.Errorf("invalid change_events %q in PagerDuty config, must be %s or %s", c.ChangeEvents, PagerdutyChangeEventsResolved, PagerdutyChangeEventsAll)
+	}
+	if c.Details == nil {
+		c.Details = make(map[string]string)
+	}
+	for k, v := range config.DefaultPagerdutyDetails {
+		if _, ok := c.Details[k]; !ok {
+			c.Details[k] = v
+		}
+	}
+	return nil
+}
+
+// MSTeamsConfig configures notifications via Microsoft Teams incoming webhooks.
+type MSTeamsConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	WebhookURL *config.SecretURL `yaml:"webhook_url" json:"webhook_url"`
+	Title      string            `yaml:"title,omitempty" json:"title,omitempty"`
+	Text       string            `yaml:"text,omitempty" json:"text,omitempty"`
+	Facts      []MSTeamsFact     `yaml:"facts,omitempty" json:"facts,omitempty"`
+}
+
+// MSTeamsFact is a templated name/value pair rendered in the card's fact set.
+type MSTeamsFact struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *MSTeamsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultMSTeamsConfig
+	type plain MSTeamsConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.WebhookURL == nil {
+		return errors.New("missing webhook_url in msteams config")
+	}
+	if c.WebhookURL.Scheme != "https" && c.WebhookURL.Scheme != "http" {
+		return errors.New("scheme required for msteams webhook_url")
+	}
+	for _, f := range c.Facts {
+		if f.Name == "" || f.Value == "" {
+			return errors.New("missing name or value in msteams fact")
+		}
+	}
+	return nil
+}
+
+// WebexConfig configures notifications via Cisco Webex bots.
+type WebexConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	// APIURL is the URL of the messages API, by default the one of Webex.
+	APIURL   *config.URL   `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+	BotToken config.Secret `yaml:"bot_token" json:"bot_token"`
+	RoomID   string        `yaml:"room_id" json:"room_id"`
+	// Message is the templated markdown of the message.
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *WebexConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultWebexConfig
+	type plain WebexConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.BotToken == "" {
+		return errors.New("missing bot_token in webex config")
+	}
+	if c.RoomID == "" {
+		return errors.New("missing room_id in webex config")
+	}
+	if c.APIURL != nil && c.APIURL.Scheme != "https" && c.APIURL.Scheme != "http" {
+		return errors.New("scheme required for webex api_url")
+	}
+	return nil
+}
+
+// GoogleChatConfig configures notifications via Google Chat space webhooks.
+type GoogleChatConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	WebhookURL *config.SecretURL `yaml:"webhook_url" json:"webhook_url"`
+	Title      string            `yaml:"title,omitempty" json:"title,omitempty"`
+	// Text is the body of the card, which supports the basic HTML
+	// formatting of Google Chat.
+	Text string `yaml:"text,omitempty" json:"text,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *GoogleChatConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultGoogleChatConfig
+	type plain GoogleChatConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.WebhookURL == nil {
+		return errors.New("missing webhook_url in googlechat config")
+	}
+	if c.WebhookURL.Scheme != "https" && c.WebhookURL.Scheme != "http" {
+		return errors.New("scheme required for googlechat webhook_url")
+	}
+	return nil
+}
+
+// DiscordConfig configures notifications via Discord webhooks, posting the
+// alerts as an embed.
+type DiscordConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	WebhookURL *config.SecretURL `yaml:"webhook_url" json:"webhook_url"`
+	Username   string            `yaml:"username,omitempty" json:"username,omitempty"`
+	AvatarURL  string            `yaml:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+	Title      string            `yaml:"title,omitempty" json:"title,omitempty"`
+	Message    string            `yaml:"message,omitempty" json:"message,omitempty"`
+	// Color is the template of the embed color, as a hex RGB value like
+	// #E01E5A. By default it depends on the severity of the alerts.
+	Color string `yaml:"color,omitempty" json:"color,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *DiscordConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultDiscordConfig
+	type plain DiscordConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.WebhookURL == nil {
+		return errors.New("missing webhook_url in discord config")
+	}
+	if c.WebhookURL.Scheme != "https" && c.WebhookURL.Scheme != "http" {
+		return errors.New("scheme required for discord webhook_url")
+	}
+	return nil
+}
+
+// MattermostConfig configures notifications via Mattermost incoming
+// webhooks, posting the alerts as a markdown attachment.
+type MattermostConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	WebhookURL *config.SecretURL `yaml:"webhook_url" json:"webhook_url"`
+	// Channel overrides the channel of the webhook, if it is not locked.
+	Channel   string `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Username  string `yaml:"username,omitempty" json:"username,omitempty"`
+	IconURL   string `yaml:"icon_url,omitempty" json:"icon_url,omitempty"`
+	IconEmoji string `yaml:"icon_emoji,omitempty" json:"icon_emoji,omitempty"`
+
+	Title     string `yaml:"title,omitempty" json:"title,omitempty"`
+	TitleLink string `yaml:"title_link,omitempty" json:"title_link,omitempty"`
+	Text      string `yaml:"text,omitempty" json:"text,omitempty"`
+	Fallback  string `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+	Color     string `yaml:"color,omitempty" json:"color,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *MattermostConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultMattermostConfig
+	type plain MattermostConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.WebhookURL == nil {
+		return errors.New("missing webhook_url in mattermost config")
+	}
+	if c.WebhookURL.Scheme != "https" && c.WebhookURL.Scheme != "http" {
+		return errors.New("scheme required for mattermost webhook_url")
+	}
+	return nil
+}
+
+// ServiceNowConfig configures incidents in ServiceNow, created and updated
+// with the Table API. The records of an alert group are found by their
+// correlation_id, the hash of the group key.
+type ServiceNowConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	// InstanceURL is the URL of the ServiceNow instance, like
+	// https://example.service-now.com.
+	InstanceURL *config.URL `yaml:"instance_url" json:"instance_url"`
+	Table       string      `yaml:"table,omitempty" json:"table,omitempty"`
+
+	// Username and Password authenticate with basic auth, or with the
+	// password grant if OAuth is set.
+	Username string                 `yaml:"username" json:"username"`
+	Password config.Secret          `yaml:"password" json:"password"`
+	OAuth    *ServiceNowOAuthConfig `yaml:"oauth,omitempty" json:"oauth,omitempty"`
+
+	// Fields are the templates of the fields of the records, set when
+	// they are created and updated. They default to DefaultServiceNowFields.
+	Fields map[string]string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	// ResolveFields are the templates of the fields set when the alert
+	// group is resolved. They default to DefaultServiceNowResolveFields.
+	ResolveFields map[string]string `yaml:"resolve_fields,omitempty" json:"resolve_fields,omitempty"`
+}
+
+// ServiceNowOAuthConfig is the OAuth application the tokens of ServiceNow
+// are requested for.
+type ServiceNowOAuthConfig struct {
+	ClientID     string        `yaml:"client_id" json:"client_id"`
+	ClientSecret config.Secret `yaml:"client_secret" json:"client_secret"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *ServiceNowConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultServiceNowConfig
+	type plain ServiceNowConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.InstanceURL == nil {
+		return errors.New("missing instance_url in servicenow config")
+	}
+	if c.InstanceURL.Scheme != "https" && c.InstanceURL.Scheme != "http" {
+		return errors.New("scheme required for servicenow instance_url")
+	}
+	if !serviceNowNameRE.MatchString(c.Table) {
+		return errors.Errorf("invalid table %q in servicenow config", c.Table)
+	}
+	if c.Username == "" || c.Password == "" {
+		return errors.New("missing username or password in servicenow config")
+	}
+	if c.OAuth != nil && (c.OAuth.ClientID == "" || c.OAuth.ClientSecret == "") {
+		return errors.New("missing client_id or client_secret in servicenow oauth config")
+	}
+
+	if c.Fields == nil {
+		c.Fields = make(map[string]string)
+	}
+	for k, v := range DefaultServiceNowFields {
+		if _, ok := c.Fields[k]; !ok {
+			c.Fields[k] = v
+		}
+	}
+	if c.ResolveFields == nil {
+		c.ResolveFields = make(map[string]string)
+		for k, v := range DefaultServiceNowResolveFields {
+			c.ResolveFields[k] = v
+		}
+	}
+	for _, fields := range []map[string]string{c.Fields, c.ResolveFields} {
+		for k := range fields {
+			if !serviceNowNameRE.MatchString(k) {
+				return errors.Errorf("invalid field %q in servicenow config", k)
+			}
+			if k == "correlation_id" {
+				return errors.New("correlation_id can not be set in servicenow config")
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	TwilioModeSMS   = "sms"
+	TwilioModeVoice = "voice"
+)
+
+// TwilioConfig configures notifications via Twilio text messages or voice
+// calls. A message is sent to every recipient for every alert.
+type TwilioConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	APIURL     *config.URL   `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+	AccountSID string        `yaml:"account_sid" json:"account_sid"`
+	AuthToken  config.Secret `yaml:"auth_token" json:"auth_token"`
+	From       string        `yaml:"from" json:"from"`
+	To         []string      `yaml:"to" json:"to"`
+	Mode       string        `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Message    string        `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *TwilioConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultTwilioConfig
+	type plain TwilioConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.AccountSID == "" || c.AuthToken == "" {
+		return errors.New("missing account_sid or auth_token in twilio config")
+	}
+	if c.Mode != TwilioModeSMS && c.Mode != TwilioModeVoice {
+		return errors.Errorf("invalid mode %q in twilio config, must be one of %s, %s", c.Mode, TwilioModeSMS, TwilioModeVoice)
+	}
+	if !e164RE.MatchString(c.From) {
+		return errors.Errorf("from number %q in twilio config is not in E.164 format", c.From)
+	}
+	if len(c.To) == 0 {
+		return errors.New("missing to numbers in twilio config")
+	}
+	for _, to := range c.To {
+		if !e164RE.MatchString(to) {
+			return errors.Errorf("to number %q in twilio config is not in E.164 format", to)
+		}
+	}
+	return nil
+}
+
+// AWSConfig configures the authentication to AWS. If no keys are given, the
+// credentials of the environment (IRSA, ECS task role, EC2 instance role)
+// are used, as far as the operator allows, see SetAWSCredentialsPolicy.
+type AWSConfig struct {
+	Region    string        `yaml:"region,omitempty" json:"region,omitempty"`
+	Endpoint  *config.URL   `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	AccessKey string        `yaml:"access_key,omitempty" json:"access_key,omitempty"`
+	SecretKey config.Secret `yaml:"secret_key,omitempty" json:"secret_key,omitempty"`
+	RoleARN   string        `yaml:"role_arn,omitempty" json:"role_arn,omitempty"`
+}
+
+func (c *AWSConfig) validate() error {
+	if (c.AccessKey == "") != (c.SecretKey == "") {
+		return errors.New("access_key and secret_key must be set together")
+	}
+	if c.Region == "" && c.Endpoint == nil {
+		return errors.New("missing region")
+	}
+	return nil
+}
+
+// SNSConfig configures notifications published to an AWS SNS topic. The
+// message is the JSON encoded webhook message.
+type SNSConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+	AWSConfig             `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	TopicARN string `yaml:"topic_arn" json:"topic_arn"`
+	Subject  string `yaml:"subject,omitempty" json:"subject,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SNSConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSNSConfig
+	type plain SNSConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(c.TopicARN, "arn:") {
+		return errors.New("missing or invalid topic_arn in sns config")
+	}
+	// arn:aws:sns:<region>:<account>:<topic>
+	if parts := strings.Split(c.TopicARN, ":"); c.Region == "" && len(parts) == 6 {
+		c.Region = parts[3]
+	}
+	return errors.Wrap(c.AWSConfig.validate(), "sns config")
+}
+
+// SQSConfig configures notifications sent to an AWS SQS queue. The message
+// is the JSON encoded webhook message.
+type SQSConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+	AWSConfig             `yaml:",inline" json:",inline"`
+
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	QueueURL *config.URL `yaml:"queue_url" json:"queue_url"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SQSConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSQSConfig
+	type plain SQSConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.QueueURL == nil {
+		return errors.New("missing queue_url in sqs config")
+	}
+	// https://sqs.<region>.amazonaws.com/<account>/<queue>
+	if parts := strings.Split(c.QueueURL.Host, "."); c.Region == "" && len(parts) == 4 && parts[0] == "sqs" {
+		c.Region = parts[1]
+	}
+	return errors.Wrap(c.AWSConfig.validate(), "sqs config")
+}
+
+const (
+	KafkaAcksAll    = "all"
+	KafkaAcksLeader = "leader"
+	KafkaAcksNone   = "none"
+)
+
+// KafkaConfig configures notifications produced to a Kafka topic. The
+// record value is the JSON encoded webhook message and the record key is
+// the tenant ID, unless a key template is given.
+type KafkaConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	Brokers   []string             `yaml:"brokers" json:"brokers"`
+	Topic     string               `yaml:"topic" json:"topic"`
+	Key       string               `yaml:"key,omitempty" json:"key,omitempty"`
+	Acks      string               `yaml:"acks,omitempty" json:"acks,omitempty"`
+	Timeout   model.Duration       `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	TLSConfig *commoncfg.TLSConfig `yaml:"tls_config,omitempty" json:"tls_config,omitempty"`
+	SASL      *KafkaSASLConfig     `yaml:"sasl,omitempty" json:"sasl,omitempty"`
+}
+
+// KafkaSASLConfig configures the SASL authentication to the Kafka brokers.
+type KafkaSASLConfig struct {
+	Mechanism string        `yaml:"mechanism" json:"mechanism"`
+	Username  string        `yaml:"username" json:"username"`
+	Password  config.Secret `yaml:"password" json:"password"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *KafkaConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultKafkaConfig
+	type plain KafkaConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if len(c.Brokers) == 0 {
+		return errors.New("missing brokers in kafka config")
+	}
+	if c.Topic == "" {
+		return errors.New("missing topic in kafka config")
+	}
+	if c.Acks != KafkaAcksAll && c.Acks != KafkaAcksLeader && c.Acks != KafkaAcksNone {
+		return errors.Errorf("invalid acks %q in kafka config, must be one of %s, %s, %s", c.Acks, KafkaAcksAll, KafkaAcksLeader, KafkaAcksNone)
+	}
+	if c.SASL != nil {
+		switch c.SASL.Mechanism {
+		case kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512:
+		default:
+			return errors.Errorf("invalid sasl mechanism %q in kafka config, must be one of %s, %s, %s", c.SASL.Mechanism, kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512)
+		}
+		if c.SASL.Username == "" || c.SASL.Password == "" {
+			return errors.New("missing sasl username or password in kafka config")
+		}
+	}
+	return nil
+}
+
+// ExecConfig configures notifications running a command on the host of
+// the Alertmanager, with the JSON encoded webhook message on its standard
+// input and an empty environment. Only the commands allowed by the
+// operator can be run, see SetExecAllowedCommands.
+type ExecConfig struct {
+	config.NotifierConfig `yaml:",inline" json:",inline"`
+
+	// Command is the absolute path of the executable, which is run without
+	// a shell.
+	Command string         `yaml:"command" json:"command"`
+	Args    []string       `yaml:"args,omitempty" json:"args,omitempty"`
+	Timeout model.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *ExecConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultExecConfig
+	type plain ExecConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Command == "" {
+		return errors.New("missing command in exec config")
+	}
+	if !filepath.IsAbs(c.Command) {
+		return errors.Errorf("command %q in exec config must be an absolute path", c.Command)
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout in exec config must be positive")
+	}
+	return nil
+}
+
+// RetryPolicy configures how the integrations of a receiver retry failed
+// notifications. The delay between attempts grows exponentially from
+// min_backoff to max_backoff and is randomized by the jitter factor.
+type RetryPolicy struct {
+	// MaxAttempts is unlimited if zero.
+	MaxAttempts int            `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	MinBackoff  model.Duration `yaml:"min_backoff,omitempty" json:"min_backoff,omitempty"`
+	MaxBackoff  model.Duration `yaml:"max_backoff,omitempty" json:"max_backoff,omitempty"`
+	Jitter      float64        `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	// Timeout bounds all attempts of a notification. The notification
+	// timeout derived from the group interval applies if it is shorter.
+	Timeout model.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *RetryPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRetryPolicy
+	type plain RetryPolicy
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.MaxAttempts < 0 {
+		return errors.New("max_attempts must not be negative in retry policy")
+	}
+	if c.MinBackoff <= 0 || c.MaxBackoff < c.MinBackoff {
+		return errors.New("min_backoff must be positive and not greater than max_backoff in retry policy")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1 in retry policy")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative in retry policy")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Discord embed limits.
+const (
+	discordMaxTitleLen       = 256
+	discordMaxDescriptionLen = 4096
+)
+
+// Discord implements a Notifier for Discord webhooks.
+type Discord struct {
+	conf   *DiscordConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewDiscord returns a new Discord notifier.
+func NewDiscord(c *DiscordConfig, t *template.Template, l log.Logger) *Discord {
+	return &Discord{conf: c, tmpl: t, logger: l}
+}
+
+type discordMessage struct {
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color"`
+}
+
+// Render implements the Renderer interface.
+func (n *Discord) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	title, _ := truncate(tmplText(n.conf.Title), discordMaxTitleLen)
+	description, _ := truncate(tmplText(n.conf.Message), discordMaxDescriptionLen)
+	msg := &discordMessage{
+		Username:  tmplText(n.conf.Username),
+		AvatarURL: tmplText(n.conf.AvatarURL),
+	}
+	color := tmplText(n.conf.Color)
+	if err != nil {
+		return nil, err
+	}
+
+	embed := discordEmbed{
+		Title:       title,
+		Description: description,
+	}
+	if embed.Color, err = parseColor(color); err != nil {
+		return nil, err
+	}
+	if n.tmpl.ExternalURL != nil {
+		embed.URL = n.tmpl.ExternalURL.String()
+	}
+	msg.Embeds = []discordEmbed{embed}
+	return msg, nil
+}
+
+// parseColor parses a hex RGB color like #E01E5A.
+func parseColor(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	c, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 24)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %q, must be a hex RGB value", s)
+	}
+	return int(c), nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Discord) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.Render(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", n.conf.WebhookURL.String(), &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	// Discord rate limits webhooks with 429.
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
@@ -0,0 +1,272 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/tracing"
+
+	"github.com/pkg/errors"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+var (
+	// blockedNets are never reachable by notifications unless explicitly
+	// allowed: link-local addresses and the cloud metadata services.
+	blockedNets = mustParseCIDRs(
+		"169.254.0.0/16",
+		"fe80::/10",
+		"fd00:ec2::254/128",
+		"100.100.100.200/32",
+	)
+
+	// privateNets are blocked if the egress policy denies private addresses.
+	privateNets = mustParseCIDRs(
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+	)
+
+	egressMtx sync.RWMutex
+	egress    = &EgressPolicy{}
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// ParseCIDRs parses a list of CIDRs.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// EgressPolicy restricts the destinations notifications are sent to, so
+// that tenant controlled URLs can not reach internal networks.
+//
+// Link-local and cloud metadata addresses are always blocked, unless they
+// are part of AllowedCIDRs. If AllowedCIDRs or AllowedHosts are set, only
+// matching destinations are allowed.
+type EgressPolicy struct {
+	AllowedCIDRs []*net.IPNet
+	// AllowedHosts are host names, "*.example.com" allows all subdomains.
+	AllowedHosts []string
+	// DenyPrivate blocks loopback and private network addresses.
+	DenyPrivate bool
+}
+
+// SetEgressPolicy sets the policy applied to all notifications.
+func SetEgressPolicy(p *EgressPolicy) {
+	egressMtx.Lock()
+	defer egressMtx.Unlock()
+	egress = p
+}
+
+func egressPolicy() *EgressPolicy {
+	egressMtx.RLock()
+	defer egressMtx.RUnlock()
+	return egress
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *EgressPolicy) restricted() bool {
+	return len(p.AllowedCIDRs) > 0 || len(p.AllowedHosts) > 0
+}
+
+func (p *EgressPolicy) allowedHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range p.AllowedHosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP checks an address which is connected to. Only the blocked
+// networks are checked, as the host name is not known anymore.
+func (p *EgressPolicy) checkIP(ip net.IP) error {
+	if containsIP(p.AllowedCIDRs, ip) {
+		return nil
+	}
+	if containsIP(blockedNets, ip) || p.DenyPrivate && containsIP(privateNets, ip) {
+		return errors.Errorf("destination %s is blocked by the egress policy", ip)
+	}
+	return nil
+}
+
+// checkHost checks a destination host and all the addresses it resolves to.
+func (p *EgressPolicy) checkHost(ctx context.Context, host string) error {
+	if host == "" {
+		return errors.New("missing destination host")
+	}
+	allowedHost := p.allowedHost(host)
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	for _, ip := range ips {
+		if p.restricted() && !allowedHost && !containsIP(p.AllowedCIDRs, ip) {
+			return errors.Errorf("destination %s is not allowed by the egress policy", host)
+		}
+		if err := p.checkIP(ip); err != nil {
+			return errors.Errorf("destination %s is blocked by the egress policy", host)
+		}
+	}
+	return nil
+}
+
+// checkURL checks the host of u, which may be a URL or a host:port pair.
+func (p *EgressPolicy) checkURL(ctx context.Context, u string) error {
+	if u == "" {
+		return nil
+	}
+	host := u
+	if pu, err := url.Parse(u); err == nil && pu.Host != "" {
+		host = pu.Hostname()
+	} else if h, _, err := net.SplitHostPort(u); err == nil {
+		host = h
+	}
+	return p.checkHost(ctx, host)
+}
+
+// dialControl rejects connections to blocked addresses. It runs after name
+// resolution, which protects against DNS rebinding.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("invalid address %s", address)
+	}
+	return egressPolicy().checkIP(ip)
+}
+
+// DialContext connects to addr if the egress policy allows it.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := egressPolicy().checkURL(ctx, addr); err != nil {
+		return nil, err
+	}
+	d := &net.Dialer{Timeout: 30 * time.Second, Control: dialControl}
+	return d.DialContext(ctx, network, addr)
+}
+
+// egressRoundTripper checks the destination of each request, including
+// redirects, against the egress policy and the policy of the receiver
+// narrowing it, if any. The connections are checked by the dialer, which
+// only sees the proxy if one is used. The trace of the notification is
+// propagated to the destination. A slot of the egress concurrency limits
+// is held until the response body is closed.
+type egressRoundTripper struct {
+	rt     http.RoundTripper
+	narrow *EgressPolicy
+}
+
+func (rt *egressRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := egressPolicy().checkHost(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	if rt.narrow != nil {
+		if err := rt.narrow.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	release, err := currentEgressLimiter().acquire(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rt.rt.RoundTrip(tracing.InjectRequest(req))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	recordResponse(req, resp)
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// buildHTTPClient returns an HTTP client configured like the upstream
+// notifiers' clients, which enforces the egress policy, narrowed by the
+// settings s if they set it. The transport is configured by s. The proxy of the configuration takes
+// precedence over the one of the settings to reach the destinations.
+func buildHTTPClient(cfg commoncfg.HTTPClientConfig, s HTTPClientSettings) (*http.Client, error) {
+	tlsConfig, err := commoncfg.NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	narrow, err := s.egressPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tlsVersions[s.TLSMinVersion]; ok {
+		tlsConfig.MinVersion = v
+	}
+	proxyURL := cfg.ProxyURL.URL
+	if proxyURL == nil {
+		proxyURL = s.proxyURL()
+	}
+	d := &net.Dialer{Timeout: time.Duration(s.DialTimeout), Control: dialControl}
+	var rt http.RoundTripper = &http.Transport{
+		Proxy:                 http.ProxyURL(proxyURL),
+		DialContext:           countDials(d.DialContext),
+		TLSClientConfig:       tlsConfig,
+		DisableCompression:    true,
+		MaxIdleConns:          s.MaxIdleConns,
+		MaxIdleConnsPerHost:   s.MaxIdleConnsPerHost,
+		IdleConnTimeout:       time.Duration(s.IdleConnTimeout),
+		TLSHandshakeTimeout:   time.Duration(s.TLSHandshakeTimeout),
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if len(cfg.BearerToken) > 0 {
+		rt = commoncfg.NewBearerAuthRoundTripper(cfg.BearerToken, rt)
+	} else if len(cfg.BearerTokenFile) > 0 {
+		rt = commoncfg.NewBearerAuthFileRoundTripper(cfg.BearerTokenFile, rt)
+	}
+	if cfg.BasicAuth != nil {
+		rt = commoncfg.NewBasicAuthRoundTripper(cfg.BasicAuth.Username, cfg.BasicAuth.Password, cfg.BasicAuth.PasswordFile, rt)
+	}
+	return &http.Client{Transport: &egressRoundTripper{rt: rt, narrow: narrow}, Timeout: time.Duration(s.Timeout)}, nil
+}
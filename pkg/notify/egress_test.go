@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+func TestEgressUpstreamNotifier(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("redirect") != "" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	tmpl, err := template.FromGlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.ExternalURL, _ = url.Parse("http://localhost/")
+	ctx := notify.WithGroupKey(context.Background(), "group")
+	ctx = notify.WithReceiverName(ctx, "team")
+	ctx = notify.WithGroupLabels(ctx, model.LabelSet{})
+	alert := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}}}
+	opsGenie := func(rawURL string) *OpsGenie {
+		u, _ := url.Parse(rawURL)
+		return NewOpsGenie(&config.OpsGenieConfig{
+			HTTPConfig: &commoncfg.HTTPClientConfig{},
+			APIURL:     &config.URL{URL: u},
+			APIKey:     "key",
+		}, tmpl, log.NewNopLogger())
+	}
+
+	if _, err := opsGenie(srv.URL+"/").Notify(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opsGenie(srv.URL+"/?redirect=1").Notify(ctx, alert); err == nil || !strings.Contains(err.Error(), "blocked by the egress policy") {
+		t.Fatalf("got %v, want the redirect to the metadata service blocked", err)
+	}
+
+	// The http_client of the receiver narrows the egress policy.
+	narrowed := withHTTPClientSettings(ctx, &HTTPClientSettings{EgressAllowedHosts: []string{"*.example.com"}})
+	before := requests
+	if _, err := opsGenie(srv.URL+"/").Notify(narrowed, alert); err == nil || !strings.Contains(err.Error(), "not allowed by the egress policy") {
+		t.Fatalf("got %v, want the destination not allowed for the receiver", err)
+	}
+	if requests != before {
+		t.Fatal("request sent to a destination not allowed for the receiver")
+	}
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	egressInflight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "notifier_egress_inflight_requests",
+		Help:      "The number of outbound requests of the notifiers in flight.",
+	})
+	egressQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "notifier_egress_queued_requests",
+		Help:      "The number of outbound requests of the notifiers waiting for the egress concurrency limits.",
+	})
+	egressQueueTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "notifier_egress_queue_timeouts_total",
+		Help:      "The total number of outbound requests of the notifiers which timed out waiting for the egress concurrency limits.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(egressInflight)
+	prometheus.MustRegister(egressQueued)
+	prometheus.MustRegister(egressQueueTimeouts)
+}
+
+var (
+	egressLimiterMtx sync.RWMutex
+	egressLimiter    = newConcurrencyLimiter(0, 0)
+)
+
+// SetEgressLimits caps the outbound requests of the notifiers in flight,
+// in total and per destination host. Excess requests wait until their
+// notification times out. A limit of 0 is unbounded.
+func SetEgressLimits(max, maxPerHost int) {
+	egressLimiterMtx.Lock()
+	defer egressLimiterMtx.Unlock()
+	egressLimiter = newConcurrencyLimiter(max, maxPerHost)
+}
+
+func currentEgressLimiter() *concurrencyLimiter {
+	egressLimiterMtx.RLock()
+	defer egressLimiterMtx.RUnlock()
+	return egressLimiter
+}
+
+// concurrencyLimiter hands out slots for outbound requests, bounded in
+// total and per host. The slots of a host are dropped when unused, so that
+// the tenant controlled hosts do not accumulate.
+type concurrencyLimiter struct {
+	global     chan struct{}
+	maxPerHost int
+
+	mtx   sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+func newConcurrencyLimiter(max, maxPerHost int) *concurrencyLimiter {
+	l := &concurrencyLimiter{maxPerHost: maxPerHost, hosts: map[string]*hostSlots{}}
+	if max > 0 {
+		l.global = make(chan struct{}, max)
+	}
+	return l
+}
+
+func (l *concurrencyLimiter) ref(host string) *hostSlots {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostSlots{slots: make(chan struct{}, l.maxPerHost)}
+		l.hosts[host] = h
+	}
+	h.refs++
+	return h
+}
+
+func (l *concurrencyLimiter) unref(host string, h *hostSlots) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if h.refs--; h.refs == 0 {
+		delete(l.hosts, host)
+	}
+}
+
+// acquire waits for a slot for a request to host, and returns the function
+// releasing it. An error is returned if ctx is done first.
+func (l *concurrencyLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	host = strings.ToLower(host)
+	var h *hostSlots
+	if l.maxPerHost > 0 {
+		h = l.ref(host)
+	}
+	release := func() {
+		if l.global != nil {
+			<-l.global
+		}
+		if h != nil {
+			<-h.slots
+			l.unref(host, h)
+		}
+		egressInflight.Dec()
+	}
+
+	if err := l.wait(ctx, h, host); err != nil {
+		if h != nil {
+			l.unref(host, h)
+		}
+		return nil, err
+	}
+	egressInflight.Inc()
+	return release, nil
+}
+
+func (l *concurrencyLimiter) wait(ctx context.Context, h *hostSlots, host string) error {
+	if h != nil {
+		if err := takeSlot(ctx, h.slots); err != nil {
+			return errors.Wrapf(err, "waiting for an outbound request slot to %s", host)
+		}
+	}
+	if l.global != nil {
+		if err := takeSlot(ctx, l.global); err != nil {
+			if h != nil {
+				<-h.slots
+			}
+			return errors.Wrap(err, "waiting for an outbound request slot")
+		}
+	}
+	return nil
+}
+
+// takeSlot takes one of the slots, queueing until ctx is done if all are
+// taken.
+func takeSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	egressQueued.Inc()
+	defer egressQueued.Dec()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		egressQueueTimeouts.Inc()
+		return ctx.Err()
+	}
+}
+
+// releaseOnClose releases the slot of a request once its response body is
+// closed, as the connection is in use until then.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
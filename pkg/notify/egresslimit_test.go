@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := newConcurrencyLimiter(3, 2)
+	ctx := context.Background()
+	acquire := func(host string) func() {
+		release, err := l.acquire(ctx, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return release
+	}
+	timesOut := func(host string) bool {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		release, err := l.acquire(ctx, host)
+		if err == nil {
+			release()
+		}
+		return err != nil
+	}
+
+	a1, a2 := acquire("a.example.com"), acquire("A.example.com")
+	if !timesOut("a.example.com") {
+		t.Fatal("third request to a host not limited")
+	}
+	b1 := acquire("b.example.com")
+	if !timesOut("c.example.com") {
+		t.Fatal("fourth request not limited")
+	}
+	a1()
+	if timesOut("c.example.com") {
+		t.Fatal("released slot not reused")
+	}
+	a2()
+	b1()
+	if len(l.hosts) != 0 {
+		t.Errorf("unused hosts kept: %v", l.hosts)
+	}
+}
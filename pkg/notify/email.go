@@ -0,0 +1,355 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// emailAttachmentName is the file name of the attached alert group.
+const emailAttachmentName = "alerts.json"
+
+// Email implements a Notifier for email notifications. It sends the same
+// messages as the upstream notifier, optionally with the alert group
+// attached, and connects to the smarthost through the egress policy.
+type Email struct {
+	conf   *EmailConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewEmail returns a new Email notifier.
+func NewEmail(c *EmailConfig, t *template.Template, l log.Logger) *Email {
+	if c.Headers == nil {
+		c.Headers = map[string]string{}
+	}
+	if _, ok := c.Headers["Subject"]; !ok {
+		c.Headers["Subject"] = config.DefaultEmailSubject
+	}
+	if _, ok := c.Headers["To"]; !ok {
+		c.Headers["To"] = c.To
+	}
+	if _, ok := c.Headers["From"]; !ok {
+		c.Headers["From"] = c.From
+	}
+	return &Email{conf: c, tmpl: t, logger: l}
+}
+
+// auth resolves a string of authentication mechanisms.
+func (n *Email) auth(mechs string) (smtp.Auth, error) {
+	username := n.conf.AuthUsername
+
+	// If no username is set, keep going without authentication.
+	if n.conf.AuthUsername == "" {
+		_ = level.Debug(n.logger).Log("msg", "smtp_auth_username is not configured. Attempting to send email without authenticating")
+		return nil, nil
+	}
+
+	err := &types.MultiError{}
+	for _, mech := range strings.Split(mechs, " ") {
+		switch mech {
+		case "CRAM-MD5":
+			secret := string(n.conf.AuthSecret)
+			if secret == "" {
+				err.Add(errors.New("missing secret for CRAM-MD5 auth mechanism"))
+				continue
+			}
+			return smtp.CRAMMD5Auth(username, secret), nil
+		case "PLAIN":
+			password := string(n.conf.AuthPassword)
+			if password == "" {
+				err.Add(errors.New("missing password for PLAIN auth mechanism"))
+				continue
+			}
+			host, _, err := net.SplitHostPort(n.conf.Smarthost)
+			if err != nil {
+				return nil, errors.Errorf("invalid address: %s", err)
+			}
+			return smtp.PlainAuth(n.conf.AuthIdentity, username, password, host), nil
+		case "LOGIN":
+			password := string(n.conf.AuthPassword)
+			if password == "" {
+				err.Add(errors.New("missing password for LOGIN auth mechanism"))
+				continue
+			}
+			return notify.LoginAuth(username, password), nil
+		}
+	}
+	if err.Len() == 0 {
+		err.Add(errors.New("unknown auth mechanism: " + mechs))
+	}
+	return nil, err
+}
+
+// dial connects to the smarthost, with TLS on port 465.
+func (n *Email) dial(ctx context.Context, host, port string) (*smtp.Client, error) {
+	conn, err := DialContext(ctx, "tcp", n.conf.Smarthost)
+	if err != nil {
+		return nil, err
+	}
+	if port == "465" {
+		tlsConfig, err := commoncfg.NewTLSConfig(&n.conf.TLSConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Email) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	// We need to know the hostname for both auth and TLS.
+	host, port, err := net.SplitHostPort(n.conf.Smarthost)
+	if err != nil {
+		return false, errors.Errorf("invalid address: %s", err)
+	}
+
+	c, err := n.dial(ctx, host, port)
+	if err != nil {
+		return true, err
+	}
+	defer func() {
+		if err := c.Quit(); err != nil {
+			_ = level.Error(n.logger).Log("msg", "failed to close SMTP connection", "err", err)
+		}
+	}()
+
+	if n.conf.Hello != "" {
+		if err := c.Hello(n.conf.Hello); err != nil {
+			return true, err
+		}
+	}
+
+	// The global defaults guarantee RequireTLS is not nil.
+	if *n.conf.RequireTLS && port != "465" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return true, errors.Errorf("require_tls: true (default), but %q does not advertise the STARTTLS extension", n.conf.Smarthost)
+		}
+		tlsConf, err := commoncfg.NewTLSConfig(&n.conf.TLSConfig)
+		if err != nil {
+			return false, err
+		}
+		if tlsConf.ServerName == "" {
+			tlsConf.ServerName = host
+		}
+		if err := c.StartTLS(tlsConf); err != nil {
+			return true, errors.Errorf("starttls failed: %s", err)
+		}
+	}
+
+	if ok, mech := c.Extension("AUTH"); ok {
+		auth, err := n.auth(mech)
+		if err != nil {
+			return true, err
+		}
+		if auth != nil {
+			if err := c.Auth(auth); err != nil {
+				return true, errors.Errorf("%T failed: %s", auth, err)
+			}
+		}
+	}
+
+	var (
+		tmplErr error
+		data    = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmpl    = tmplText(n.tmpl, data, &tmplErr)
+		from    = tmpl(n.conf.From)
+		to      = tmpl(n.conf.To)
+	)
+	if tmplErr != nil {
+		return false, errors.Errorf("failed to template 'from' or 'to': %v", tmplErr)
+	}
+
+	addrs, err := mail.ParseAddressList(from)
+	if err != nil {
+		return false, errors.Errorf("parsing from addresses: %s", err)
+	}
+	if len(addrs) != 1 {
+		return false, errors.New("must be exactly one from address")
+	}
+	if err := c.Mail(addrs[0].Address); err != nil {
+		return true, errors.Errorf("sending mail from: %s", err)
+	}
+	addrs, err = mail.ParseAddressList(to)
+	if err != nil {
+		return false, errors.Errorf("parsing to addresses: %s", err)
+	}
+	for _, addr := range addrs {
+		if err := c.Rcpt(addr.Address); err != nil {
+			return true, errors.Errorf("sending rcpt to: %s", err)
+		}
+	}
+
+	msg, err := n.message(ctx, data, as...)
+	if err != nil {
+		return false, err
+	}
+
+	// Send the email body.
+	wc, err := c.Data()
+	if err != nil {
+		return true, err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		wc.Close()
+		return true, errors.Errorf("failed to write message: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// message returns the headers and the body of the email. The body holds the
+// text and HTML alternatives, and is mixed with the attachment of the alert
+// group if configured.
+func (n *Email) message(ctx context.Context, data *template.Data, as ...*types.Alert) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for header, t := range n.conf.Headers {
+		value, err := n.tmpl.ExecuteTextString(t, data)
+		if err != nil {
+			return nil, errors.Errorf("executing %q header template: %s", header, err)
+		}
+		fmt.Fprintf(buf, "%s: %s\r\n", header, mime.QEncoding.Encode("utf-8", value))
+	}
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+
+	alternative := &bytes.Buffer{}
+	alternativeWriter := multipart.NewWriter(alternative)
+	if err := n.writeAlternatives(alternativeWriter, data); err != nil {
+		return nil, err
+	}
+	if err := alternativeWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	if !n.conf.AttachAlerts {
+		fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", alternativeWriter.Boundary())
+		buf.Write(alternative.Bytes())
+		return buf.Bytes(), nil
+	}
+
+	attachment, _, err := webhookMessage(ctx, n.tmpl, n.logger, as...)
+	if err != nil {
+		return nil, err
+	}
+
+	mixedWriter := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixedWriter.Boundary())
+	w, err := mixedWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternativeWriter.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(alternative.Bytes()); err != nil {
+		return nil, err
+	}
+	w, err = mixedWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("application/json", map[string]string{"name": emailAttachmentName})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": emailAttachmentName})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64Lines(w, attachment); err != nil {
+		return nil, err
+	}
+	if err := mixedWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeAlternatives writes the text and HTML parts. The HTML part is the
+// preferred alternative, placed last per section 5.1.4 of RFC 2046.
+func (n *Email) writeAlternatives(mw *multipart.Writer, data *template.Data) error {
+	if len(n.conf.Text) > 0 {
+		body, err := n.tmpl.ExecuteTextString(n.conf.Text, data)
+		if err != nil {
+			return errors.Errorf("executing email text template: %s", err)
+		}
+		if err := writeQuotedPrintablePart(mw, "text/plain; charset=UTF-8", body); err != nil {
+			return errors.Wrap(err, "creating part for text template")
+		}
+	}
+	if len(n.conf.HTML) > 0 {
+		body, err := n.tmpl.ExecuteHTMLString(n.conf.HTML, data)
+		if err != nil {
+			return errors.Errorf("executing email html template: %s", err)
+		}
+		if err := writeQuotedPrintablePart(mw, "text/html; charset=UTF-8", body); err != nil {
+			return errors.Wrap(err, "creating part for html template")
+		}
+	}
+	return nil
+}
+
+func writeQuotedPrintablePart(mw *multipart.Writer, contentType, body string) error {
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Transfer-Encoding": {"quoted-printable"},
+		"Content-Type":              {contentType},
+	})
+	if err != nil {
+		return err
+	}
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// writeBase64Lines writes data base64 encoded in lines of 76 characters, as
+// required by RFC 2045.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	const lineLen = 76
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 0 {
+		n := lineLen
+		if len(enc) < n {
+			n = len(enc)
+		}
+		if _, err := io.WriteString(w, enc[:n]+"\r\n"); err != nil {
+			return err
+		}
+		enc = enc[n:]
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+// maxEnrichmentResponse is the size of the responses of enrichment webhooks
+// which is read.
+const maxEnrichmentResponse = 1 << 20
+
+var numEnrichmentRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "enrichment_webhook_requests_total",
+	Help:      "The total number of requests to the enrichment webhooks, by tenant and result. Notifications are sent without enrichment on failure.",
+}, []string{"tenant", "result"})
+
+func init() {
+	prometheus.MustRegister(numEnrichmentRequests)
+}
+
+// DefaultEnrichmentWebhook defines default values for enrichment webhooks.
+var DefaultEnrichmentWebhook = EnrichmentWebhook{
+	Timeout: model.Duration(5 * time.Second),
+}
+
+// EnrichmentWebhook is called with every alert group before it is notified,
+// and returns annotations which are added to the alerts, for example the
+// owner of a service from a CMDB or its recent deploys. The annotations the
+// alerts already have are kept. If the webhook fails or times out, the
+// notifications are sent without enrichment.
+type EnrichmentWebhook struct {
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	URL     *config.URL    `yaml:"url" json:"url"`
+	Timeout model.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *EnrichmentWebhook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultEnrichmentWebhook
+	type plain EnrichmentWebhook
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.URL == nil {
+		return errors.New("enrichment_webhook: missing url")
+	}
+	if c.URL.Scheme != "https" && c.URL.Scheme != "http" {
+		return errors.New("enrichment_webhook: scheme required for url")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("enrichment_webhook: timeout must be positive")
+	}
+	return nil
+}
+
+// EnrichmentRequest is the body of the requests to enrichment webhooks.
+type EnrichmentRequest struct {
+	Receiver    string            `json:"receiver"`
+	GroupKey    string            `json:"groupKey"`
+	GroupLabels model.LabelSet    `json:"groupLabels"`
+	Alerts      []EnrichmentAlert `json:"alerts"`
+}
+
+// EnrichmentAlert is an alert of an EnrichmentRequest.
+type EnrichmentAlert struct {
+	Fingerprint string         `json:"fingerprint"`
+	Status      string         `json:"status"`
+	Labels      model.LabelSet `json:"labels"`
+	Annotations model.LabelSet `json:"annotations"`
+	StartsAt    time.Time      `json:"startsAt"`
+	EndsAt      time.Time      `json:"endsAt"`
+}
+
+// EnrichmentResponse is the body of the responses of enrichment webhooks.
+// Annotations are added to all alerts of the group, Alerts holds the
+// annotations of single alerts by fingerprint, which take precedence.
+type EnrichmentResponse struct {
+	Annotations model.LabelSet            `json:"annotations,omitempty"`
+	Alerts      map[string]model.LabelSet `json:"alerts,omitempty"`
+}
+
+// EnrichmentStage adds the annotations returned by the enrichment webhook
+// to the alerts notified.
+type EnrichmentStage struct {
+	conf *EnrichmentWebhook
+}
+
+// NewEnrichmentStage returns a new EnrichmentStage. Enrichment is disabled
+// if conf is nil.
+func NewEnrichmentStage(conf *EnrichmentWebhook) *EnrichmentStage {
+	return &EnrichmentStage{conf: conf}
+}
+
+// Exec implements the Stage interface.
+func (s *EnrichmentStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	if s.conf == nil || len(alerts) == 0 {
+		return ctx, alerts, nil
+	}
+	tenant, _ := TenantID(ctx)
+	resp, err := s.call(ctx, l, alerts)
+	if err != nil {
+		numEnrichmentRequests.WithLabelValues(tenant, "failure").Inc()
+		_ = level.Warn(l).Log("msg", "Enrichment webhook failed, notifying without enrichment", "err", err)
+		return ctx, alerts, nil
+	}
+	numEnrichmentRequests.WithLabelValues(tenant, "success").Inc()
+	return ctx, resp.apply(alerts), nil
+}
+
+func (s *EnrichmentStage) call(ctx context.Context, l log.Logger, alerts []*types.Alert) (*EnrichmentResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.conf.Timeout))
+	defer cancel()
+
+	groupKey, _ := notify.GroupKey(ctx)
+	body := EnrichmentRequest{
+		Receiver:    receiverName(ctx, l),
+		GroupKey:    groupKey,
+		GroupLabels: groupLabels(ctx, l),
+		Alerts:      make([]EnrichmentAlert, 0, len(alerts)),
+	}
+	for _, a := range alerts {
+		body.Alerts = append(body.Alerts, EnrichmentAlert{
+			Fingerprint: a.Fingerprint().String(),
+			Status:      string(a.Status()),
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			StartsAt:    a.StartsAt,
+			EndsAt:      a.EndsAt,
+		})
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.conf.URL.String(), &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *s.conf.HTTPConfig)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, redactURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.Errorf("unexpected status code %v: %s", resp.StatusCode, readErrorBody(resp.Body))
+	}
+	var er EnrichmentResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxEnrichmentResponse)).Decode(&er); err != nil {
+		return nil, errors.Wrap(err, "invalid response")
+	}
+	return &er, nil
+}
+
+// apply returns copies of the alerts with the annotations added, as the
+// alerts are shared with the aggregation group and the other receivers.
+func (r *EnrichmentResponse) apply(alerts []*types.Alert) []*types.Alert {
+	res := make([]*types.Alert, 0, len(alerts))
+	for _, a := range alerts {
+		add := r.Alerts[a.Fingerprint().String()]
+		if len(add) == 0 && len(r.Annotations) == 0 {
+			res = append(res, a)
+			continue
+		}
+		enriched := *a
+		enriched.Annotations = a.Annotations.Clone()
+		enriched.Annotations = mergeLabels(enriched.Annotations, add)
+		enriched.Annotations = mergeLabels(enriched.Annotations, r.Annotations)
+		res = append(res, &enriched)
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+func TestEnrichmentStage(t *testing.T) {
+	a1 := &types.Alert{Alert: model.Alert{
+		Labels:      model.LabelSet{"alertname": "a", "service": "db"},
+		Annotations: model.LabelSet{"summary": "down"},
+	}}
+	a2 := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "b"}}}
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		want    []model.LabelSet
+	}{
+		{
+			name: "enriched",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var req EnrichmentRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Receiver != "team" || len(req.Alerts) != 2 {
+					t.Errorf("unexpected request: %+v, %v", req, err)
+				}
+				_ = json.NewEncoder(w).Encode(EnrichmentResponse{
+					Annotations: model.LabelSet{"owner": "dba", "summary": "from cmdb"},
+					Alerts:      map[string]model.LabelSet{a2.Fingerprint().String(): {"owner": "web"}},
+				})
+			},
+			want: []model.LabelSet{
+				{"summary": "down", "owner": "dba"},
+				{"owner": "web", "summary": "from cmdb"},
+			},
+		},
+		{
+			name: "failed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			},
+			want: []model.LabelSet{{"summary": "down"}, nil},
+		},
+		{
+			name: "timed out",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+			},
+			want: []model.LabelSet{{"summary": "down"}, nil},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL)
+			s := NewEnrichmentStage(&EnrichmentWebhook{
+				HTTPConfig: &commoncfg.HTTPClientConfig{},
+				URL:        &config.URL{URL: u},
+				Timeout:    model.Duration(50 * time.Millisecond),
+			})
+
+			ctx := notify.WithReceiverName(context.Background(), "team")
+			ctx = notify.WithGroupLabels(ctx, model.LabelSet{})
+			_, got, err := s.Exec(ctx, log.NewNopLogger(), a1, a2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, a := range got {
+				if !a.Annotations.Equal(tc.want[i]) {
+					t.Errorf("alert %d: got annotations %v, want %v", i, a.Annotations, tc.want[i])
+				}
+			}
+			if len(a1.Annotations) != 1 || a2.Annotations != nil {
+				t.Error("annotations of the original alerts modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// escalationAckIntegration is the integration of the notification log
+// entries recording the acknowledgements of alert groups. They are
+// replicated and persisted with the other entries.
+const escalationAckIntegration = "escalation-ack"
+
+var numEscalatedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "escalated_notifications_total",
+	Help:      "The total number of notifications sent to an escalation receiver instead of the receiver of the route.",
+}, []string{"tenant", "receiver"})
+
+func init() {
+	prometheus.MustRegister(numEscalatedNotifications)
+}
+
+// EscalationStep routes the notifications of the alert groups of a
+// receiver, which are firing and unacknowledged for After, to another
+// receiver.
+type EscalationStep struct {
+	After    model.Duration `yaml:"after" json:"after"`
+	Receiver string         `yaml:"receiver" json:"receiver"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *EscalationStep) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain EscalationStep
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.After <= 0 {
+		return errors.New("escalation: after must be positive")
+	}
+	if s.Receiver == "" {
+		return errors.New("escalation: missing receiver")
+	}
+	return nil
+}
+
+// validateEscalations checks the escalation steps of the receivers, which
+// must be ordered by After and refer to other receivers without escalations
+// of their own.
+func validateEscalations(cfg *Config) error {
+	receivers := map[string]*Receiver{}
+	for _, rc := range cfg.Receivers {
+		receivers[rc.Name] = rc
+	}
+	for _, rc := range cfg.Receivers {
+		var last model.Duration
+		for _, s := range rc.Escalations {
+			if s.After <= last {
+				return errors.Errorf("receiver %q: escalations must be ordered by after", rc.Name)
+			}
+			last = s.After
+			target, ok := receivers[s.Receiver]
+			if !ok {
+				return errors.Errorf("receiver %q: undefined escalation receiver %q", rc.Name, s.Receiver)
+			}
+			if target == rc || len(target.Escalations) > 0 {
+				return errors.Errorf("receiver %q: escalation receiver %q must not escalate itself", rc.Name, s.Receiver)
+			}
+		}
+	}
+	return nil
+}
+
+type escalatedFromKey struct{}
+
+// routeReceiverName returns the receiver of the route of the notification,
+// which differs from the receiver of the context for escalated
+// notifications.
+func routeReceiverName(ctx context.Context, l log.Logger) string {
+	if r, ok := ctx.Value(escalatedFromKey{}).(string); ok {
+		return r
+	}
+	return receiverName(ctx, l)
+}
+
+// escalationAckReceiver returns the notification log receiver of the
+// acknowledgements of the alert groups of a receiver.
+func escalationAckReceiver(receiver string) *nflogpb.Receiver {
+	return &nflogpb.Receiver{GroupName: receiver, Integration: escalationAckIntegration}
+}
+
+// AcknowledgeAlertGroup stops the escalation of an alert group of a
+// receiver until the group resolves. Alerts firing again afterwards are
+// escalated anew.
+func AcknowledgeAlertGroup(l notify.NotificationLog, receiver, groupKey string) error {
+	return l.Log(escalationAckReceiver(receiver), groupKey, nil, nil)
+}
+
+// acknowledgedAt returns the time an alert group was last acknowledged.
+func acknowledgedAt(l notify.NotificationLog, receiver, groupKey string) (time.Time, bool, error) {
+	entries, err := l.Query(nflog.QReceiver(escalationAckReceiver(receiver)), nflog.QGroupKey(groupKey))
+	if err == nflog.ErrNotFound || err == nil && len(entries) == 0 {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return entries[0].Timestamp, true, nil
+}
+
+type escalationLevel struct {
+	step  *EscalationStep
+	stage notify.Stage
+}
+
+// EscalationStage sends the notifications of the alert groups firing and
+// unacknowledged for longer than an escalation step to the stage of the
+// receiver of the step, instead of passing them on to the stage of the
+// receiver of the route. A group fires since the earliest start of its
+// alerts, so that the escalation does not depend on the replica.
+type EscalationStage struct {
+	levels []escalationLevel
+	nflog  notify.NotificationLog
+	now    func() time.Time
+}
+
+// NewEscalationStage returns a new EscalationStage, sending the escalated
+// notifications to the stages of the receivers by name.
+func NewEscalationStage(steps []*EscalationStep, stages map[string]notify.Stage, l notify.NotificationLog) *EscalationStage {
+	s := &EscalationStage{nflog: l, now: utcNow}
+	for _, step := range steps {
+		s.levels = append(s.levels, escalationLevel{step: step, stage: stages[step.Receiver]})
+	}
+	return s
+}
+
+// Exec implements the Stage interface.
+func (s *EscalationStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	if len(s.levels) == 0 || len(alerts) == 0 || !FeatureEnabled(ctx, FeatureEscalations) {
+		return ctx, alerts, nil
+	}
+	lvl, err := s.level(ctx, l, alerts)
+	if err != nil {
+		_ = level.Warn(l).Log("msg", "Failed to look up the acknowledgement of the alert group, not escalating", "err", err)
+		return ctx, alerts, nil
+	}
+	if lvl == nil {
+		return ctx, alerts, nil
+	}
+
+	tenant, _ := TenantID(ctx)
+	numEscalatedNotifications.WithLabelValues(tenant, lvl.step.Receiver).Inc()
+	_ = level.Debug(l).Log("msg", "Escalating notification", "receiver", lvl.step.Receiver)
+	ctx = context.WithValue(ctx, escalatedFromKey{}, receiverName(ctx, l))
+	ctx, _, err = lvl.stage.Exec(notify.WithReceiverName(ctx, lvl.step.Receiver), l, alerts...)
+	return ctx, nil, err
+}
+
+// level returns the escalation level reached by the alert group, nil if it
+// is not escalated.
+func (s *EscalationStage) level(ctx context.Context, l log.Logger, alerts []*types.Alert) (*escalationLevel, error) {
+	since := alerts[0].StartsAt
+	for _, a := range alerts[1:] {
+		if a.StartsAt.Before(since) {
+			since = a.StartsAt
+		}
+	}
+	elapsed := s.now().Sub(since)
+	if elapsed < time.Duration(s.levels[0].step.After) {
+		return nil, nil
+	}
+
+	groupKey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return nil, errors.New("group key missing")
+	}
+	ackedAt, acked, err := acknowledgedAt(s.nflog, receiverName(ctx, l), groupKey)
+	if err != nil {
+		return nil, err
+	}
+	if acked && !ackedAt.Before(since) {
+		return nil, nil
+	}
+
+	var lvl *escalationLevel
+	for i := range s.levels {
+		if elapsed >= time.Duration(s.levels[i].step.After) {
+			lvl = &s.levels[i]
+		}
+	}
+	return lvl, nil
+}
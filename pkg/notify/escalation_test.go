@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+type recordingStage struct {
+	receiver string
+	alerts   int
+}
+
+func (s *recordingStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	s.receiver, _ = notify.ReceiverName(ctx)
+	s.alerts = len(alerts)
+	return ctx, nil, nil
+}
+
+func TestEscalationStage(t *testing.T) {
+	l, err := nflog.New(nflog.WithRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oncall, manager := &recordingStage{}, &recordingStage{}
+	s := NewEscalationStage([]*EscalationStep{
+		{After: model.Duration(30 * time.Minute), Receiver: "oncall"},
+		{After: model.Duration(time.Hour), Receiver: "manager"},
+	}, map[string]notify.Stage{"oncall": oncall, "manager": manager}, l)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := notify.WithReceiverName(notify.WithGroupKey(context.Background(), "{}:{alertname=\"a\"}"), "team")
+	alert := func(firing time.Duration) *types.Alert {
+		return &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}, StartsAt: now.Add(-firing)}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		alerts []*types.Alert
+		want   string
+	}{
+		{name: "not escalated", alerts: []*types.Alert{alert(10 * time.Minute)}},
+		{name: "first step", alerts: []*types.Alert{alert(10 * time.Minute), alert(40 * time.Minute)}, want: "oncall"},
+		{name: "last step", alerts: []*types.Alert{alert(2 * time.Hour)}, want: "manager"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			*oncall, *manager = recordingStage{}, recordingStage{}
+			_, res, err := s.Exec(ctx, log.NewNopLogger(), tc.alerts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := oncall.receiver + manager.receiver
+			if got != tc.want {
+				t.Fatalf("escalated to %q, want %q", got, tc.want)
+			}
+			if tc.want == "" && len(res) != len(tc.alerts) || tc.want != "" && res != nil {
+				t.Fatalf("unexpected alerts passed on: %v", res)
+			}
+		})
+	}
+
+	// Groups of tenants without the feature are not escalated.
+	*manager = recordingStage{}
+	disabled := WithFeatures(ctx, func(f string) bool { return f != FeatureEscalations })
+	if _, res, _ := s.Exec(disabled, log.NewNopLogger(), alert(2*time.Hour)); len(res) != 1 || manager.receiver != "" {
+		t.Fatalf("group escalated without the escalations feature")
+	}
+
+	// Acknowledged groups are not escalated until they fire anew.
+	if err := AcknowledgeAlertGroup(l, "team", "{}:{alertname=\"a\"}"); err != nil {
+		t.Fatal(err)
+	}
+	*manager = recordingStage{}
+	if _, res, _ := s.Exec(ctx, log.NewNopLogger(), alert(2*time.Hour)); len(res) != 1 || manager.receiver != "" {
+		t.Fatalf("acknowledged group escalated")
+	}
+	now = now.Add(3 * time.Hour)
+	if _, _, _ = s.Exec(ctx, log.NewNopLogger(), alert(2*time.Hour)); manager.receiver != "manager" {
+		t.Fatalf("group firing again after the acknowledgement not escalated")
+	}
+}
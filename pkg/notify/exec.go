@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// maxExecOutput is the size of the output of a command which is kept.
+const maxExecOutput = 4096
+
+// execExtraArgs ends the allowed commands which the exec integrations may
+// append their own arguments to.
+const execExtraArgs = "*"
+
+var (
+	execAllowedMtx sync.RWMutex
+	execAllowed    = map[string]execCommand{}
+	execMaxTimeout time.Duration
+)
+
+// execCommand is a command the exec integrations may run, with the
+// arguments set by the operator.
+type execCommand struct {
+	args []string
+	// extraArgs allows the integrations to append their own arguments.
+	extraArgs bool
+}
+
+// SetExecAllowedCommands sets the commands the exec integrations may run,
+// each the absolute path of the command followed by the space separated
+// arguments it is run with. The integrations may only append arguments to
+// the commands whose last argument is "*". No command can be run until it
+// is called.
+func SetExecAllowedCommands(commands []string) {
+	allowed := make(map[string]execCommand, len(commands))
+	for _, c := range commands {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		cmd := execCommand{args: fields[1:]}
+		if n := len(cmd.args); n > 0 && cmd.args[n-1] == execExtraArgs {
+			cmd.args, cmd.extraArgs = cmd.args[:n-1], true
+		}
+		allowed[filepath.Clean(fields[0])] = cmd
+	}
+	execAllowedMtx.Lock()
+	defer execAllowedMtx.Unlock()
+	execAllowed = allowed
+}
+
+// SetExecMaxTimeout caps the timeout of the exec integrations, uncapped if
+// not positive.
+func SetExecMaxTimeout(d time.Duration) {
+	execAllowedMtx.Lock()
+	defer execAllowedMtx.Unlock()
+	execMaxTimeout = d
+}
+
+// execArgs returns the arguments an exec integration runs the command
+// with, the arguments set by the operator followed by args.
+func execArgs(command string, args []string) ([]string, error) {
+	execAllowedMtx.RLock()
+	defer execAllowedMtx.RUnlock()
+	cmd, ok := execAllowed[filepath.Clean(command)]
+	if !ok {
+		return nil, errors.Errorf("exec command %q is not allowed", command)
+	}
+	if len(args) > 0 && !cmd.extraArgs {
+		return nil, errors.Errorf("exec command %q does not allow arguments", command)
+	}
+	return append(append([]string{}, cmd.args...), args...), nil
+}
+
+// execTimeout returns timeout capped by the operator.
+func execTimeout(timeout time.Duration) time.Duration {
+	execAllowedMtx.RLock()
+	defer execAllowedMtx.RUnlock()
+	if execMaxTimeout > 0 && timeout > execMaxTimeout {
+		return execMaxTimeout
+	}
+	return timeout
+}
+
+// validateExec checks that the commands and the arguments of the exec
+// integrations are allowed, and that their timeouts are within the cap.
+func validateExec(cfg *Config) error {
+	for _, rc := range cfg.Receivers {
+		for _, c := range rc.ExecConfigs {
+			if _, err := execArgs(c.Command, c.Args); err != nil {
+				return errors.Wrapf(err, "receiver %q", rc.Name)
+			}
+			if d := execTimeout(time.Duration(c.Timeout)); d < time.Duration(c.Timeout) {
+				return errors.Errorf("receiver %q: exec timeout %s exceeds the maximum of %s", rc.Name, c.Timeout, d)
+			}
+		}
+	}
+	return nil
+}
+
+// Exec implements a Notifier running a command with the webhook message on
+// its standard input. Failed commands are retried.
+type Exec struct {
+	conf   *ExecConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewExec returns a new Exec notifier.
+func NewExec(c *ExecConfig, t *template.Template, l log.Logger) *Exec {
+	return &Exec{conf: c, tmpl: t, logger: l}
+}
+
+// Notify implements the Notifier interface.
+func (n *Exec) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	// The allowed commands may have changed since the config was loaded.
+	args, err := execArgs(n.conf.Command, n.conf.Args)
+	if err != nil {
+		return false, err
+	}
+	msg, _, err := webhookMessage(ctx, n.tmpl, n.logger, as...)
+	if err != nil {
+		return false, err
+	}
+
+	timeout := execTimeout(time.Duration(n.conf.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	output := &limitedBuffer{limit: maxExecOutput}
+	cmd := exec.CommandContext(ctx, n.conf.Command, args...)
+	cmd.Stdin = bytes.NewReader(msg)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Env = []string{}
+	err = cmd.Run()
+	recordExec(ctx, n.conf.Command, cmd, output.String())
+	if ctx.Err() == context.DeadlineExceeded {
+		return true, errors.Errorf("exec command %q timed out after %s", n.conf.Command, timeout)
+	}
+	if err != nil {
+		return true, errors.Wrapf(err, "exec command %q failed: %s", n.conf.Command, output.String())
+	}
+	_ = level.Debug(n.logger).Log("msg", "exec command succeeded", "command", n.conf.Command, "output", output.String())
+	return false, nil
+}
+
+// recordExec records the exit code and the output of a command run with
+// ctx as a response, see ResponseRecorder.
+func recordExec(ctx context.Context, command string, cmd *exec.Cmd, output string) {
+	r, ok := ctx.Value(responseRecorderKey{}).(*ResponseRecorder)
+	if !ok {
+		return
+	}
+	code := -1
+	if cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.responses = append(r.responses, Response{URL: "exec://" + command, StatusCode: code, Body: output})
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and discards
+// the rest.
+type limitedBuffer struct {
+	limit int
+	buf   bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.buf.Len(); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		b.buf.Write(p[:n])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "message.json")
+	script := filepath.Join(dir, "notify.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n/bin/cat > \"$1\"\necho \"$2\"\nexit \"$3\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(args ...string) (*Config, error) {
+		return LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+  exec_configs:
+  - command: ` + script + `
+    args: ['` + strings.Join(args, `', '`) + `']
+    timeout: 5s
+`)
+	}
+	if _, err := load("output", "0"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("got %v, want the command to not be allowed", err)
+	}
+	SetExecAllowedCommands([]string{script + " " + out})
+	defer SetExecAllowedCommands(nil)
+	if _, err := load("output", "0"); err == nil || !strings.Contains(err.Error(), "does not allow arguments") {
+		t.Fatalf("got %v, want the arguments to not be allowed", err)
+	}
+	// The output file is set by the operator, the receiver only appends
+	// the other arguments.
+	SetExecAllowedCommands([]string{script + " " + out + " *"})
+	SetExecMaxTimeout(time.Second)
+	defer SetExecMaxTimeout(0)
+	if _, err := load("output", "0"); err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Fatalf("got %v, want the timeout to exceed the maximum", err)
+	}
+	SetExecMaxTimeout(10 * time.Second)
+
+	tmpl, err := template.FromGlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.ExternalURL, _ = url.Parse("http://localhost/")
+	ctx := notify.WithGroupKey(notify.WithReceiverName(context.Background(), "team"), "{}:{}")
+	ctx = notify.WithGroupLabels(ctx, model.LabelSet{})
+	alert := &types.Alert{Alert: model.Alert{
+		Labels:   model.LabelSet{"alertname": "Test"},
+		StartsAt: time.Now(),
+	}}
+
+	for _, tc := range []struct {
+		exit  string
+		retry bool
+	}{
+		{exit: "0"},
+		{exit: "1", retry: true},
+	} {
+		cfg, err := load("output", tc.exit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r ResponseRecorder
+		n := NewExec(cfg.Receivers[0].ExecConfigs[0], tmpl, log.NewNopLogger())
+		retry, err := n.Notify(WithResponseRecorder(ctx, &r), alert)
+		if retry != tc.retry || (err != nil) != tc.retry {
+			t.Fatalf("exit %s: got retry %v and error %v", tc.exit, retry, err)
+		}
+		if rs := r.Responses(); len(rs) != 1 || rs[0].Body != "output\n" || rs[0].StatusCode != map[string]int{"0": 0, "1": 1}[tc.exit] {
+			t.Fatalf("exit %s: unexpected responses %+v", tc.exit, rs)
+		}
+
+		var msg notify.WebhookMessage
+		b, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &msg); err != nil || msg.Receiver != "team" || len(msg.Alerts) != 1 {
+			t.Fatalf("unexpected message %s: %v", b, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Feature flags gate notifier behaviors per tenant, so that risky changes
+// are rolled out to a subset of tenants first. The configs using a gated
+// behavior are accepted for every tenant, the notifiers of the tenants
+// without the feature behave as before it.
+const (
+	// FeatureSlackBlockKit sends the Block Kit layout of Slack configs
+	// with blocks, instead of an attachment.
+	FeatureSlackBlockKit = "slack_block_kit"
+	// FeatureWebhookSigning signs the webhook requests of webhook configs
+	// with signing.
+	FeatureWebhookSigning = "webhook_signing"
+	// FeatureEscalations routes the notifications of unacknowledged alert
+	// groups to the escalation receivers.
+	FeatureEscalations = "escalations"
+)
+
+// Features lists the known feature flags.
+var Features = []string{FeatureSlackBlockKit, FeatureWebhookSigning, FeatureEscalations}
+
+// IsFeature returns true if name is a known feature flag.
+func IsFeature(name string) bool {
+	for _, f := range Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+type featuresKey struct{}
+
+// WithFeatures populates a context with the function telling whether a
+// feature is enabled for the tenant. A nil function enables all features.
+func WithFeatures(ctx context.Context, enabled func(feature string) bool) context.Context {
+	if enabled == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, featuresKey{}, enabled)
+}
+
+// FeatureEnabled returns true if the feature is enabled according to the
+// context. All features are enabled in contexts without feature flags.
+func FeatureEnabled(ctx context.Context, feature string) bool {
+	enabled, ok := ctx.Value(featuresKey{}).(func(string) bool)
+	return !ok || enabled(feature)
+}
+
+// FeaturesStage adds the feature flags of the tenant to the context of the
+// notifications. They are looked up on every notification, so that changed
+// flags apply without rebuilding the pipeline.
+type FeaturesStage func(feature string) bool
+
+// Exec implements the Stage interface.
+func (s FeaturesStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	return WithFeatures(ctx, s), alerts, nil
+}
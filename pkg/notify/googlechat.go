@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// GoogleChat implements a Notifier for Google Chat space webhooks, posting
+// the alerts as a card.
+type GoogleChat struct {
+	conf   *GoogleChatConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewGoogleChat returns a new GoogleChat notifier.
+func NewGoogleChat(c *GoogleChatConfig, t *template.Template, l log.Logger) *GoogleChat {
+	return &GoogleChat{conf: c, tmpl: t, logger: l}
+}
+
+type googleChatMessage struct {
+	CardsV2 []googleChatCardWithID `json:"cardsV2"`
+}
+
+type googleChatCardWithID struct {
+	CardID string         `json:"cardId"`
+	Card   googleChatCard `json:"card"`
+}
+
+type googleChatCard struct {
+	Header   googleChatHeader    `json:"header"`
+	Sections []googleChatSection `json:"sections"`
+}
+
+type googleChatHeader struct {
+	Title string `json:"title"`
+}
+
+type googleChatSection struct {
+	Widgets []googleChatWidget `json:"widgets"`
+}
+
+type googleChatWidget struct {
+	TextParagraph *googleChatTextParagraph `json:"textParagraph,omitempty"`
+}
+
+type googleChatTextParagraph struct {
+	Text string `json:"text"`
+}
+
+// Render implements the Renderer interface.
+func (n *GoogleChat) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	card := googleChatCard{
+		Header: googleChatHeader{Title: tmplText(n.conf.Title)},
+		Sections: []googleChatSection{{
+			Widgets: []googleChatWidget{{
+				TextParagraph: &googleChatTextParagraph{Text: tmplText(n.conf.Text)},
+			}},
+		}},
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &googleChatMessage{
+		CardsV2: []googleChatCardWithID{{CardID: "alerts", Card: card}},
+	}, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *GoogleChat) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.Render(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", n.conf.WebhookURL.String(), &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+// DefaultHeartbeat defines default values for heartbeats.
+var DefaultHeartbeat = Heartbeat{
+	Interval: model.Duration(5 * time.Minute),
+}
+
+// Heartbeat expects an always firing alert, like the Watchdog alert of the
+// Prometheus mixins, to be received at least every Interval. If it stops
+// arriving, the pipeline from Prometheus to the Alertmanager is broken, and
+// the receiver is notified of a HeartbeatMissing alert until it arrives
+// again. The OpsGenie heartbeat is pinged whenever the alert is received,
+// so that OpsGenie notices when the Alertmanager itself is down.
+type Heartbeat struct {
+	Name     string                   `yaml:"name" json:"name"`
+	Match    map[string]string        `yaml:"match,omitempty" json:"match,omitempty"`
+	MatchRE  map[string]config.Regexp `yaml:"match_re,omitempty" json:"match_re,omitempty"`
+	Interval model.Duration           `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Receiver string                   `yaml:"receiver" json:"receiver"`
+
+	OpsGenie *OpsGenieHeartbeat `yaml:"opsgenie,omitempty" json:"opsgenie,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (h *Heartbeat) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*h = DefaultHeartbeat
+	type plain Heartbeat
+	if err := unmarshal((*plain)(h)); err != nil {
+		return err
+	}
+	if h.Name == "" {
+		return errors.New("heartbeat: missing name")
+	}
+	if len(h.Match) == 0 && len(h.MatchRE) == 0 {
+		return errors.Errorf("heartbeat %q: match or match_re must be set", h.Name)
+	}
+	if h.Interval <= 0 {
+		return errors.Errorf("heartbeat %q: interval must be positive", h.Name)
+	}
+	if h.Receiver == "" {
+		return errors.Errorf("heartbeat %q: missing receiver", h.Name)
+	}
+	return nil
+}
+
+// Matches returns true if the alert with the labels is the heartbeat.
+func (h *Heartbeat) Matches(lset model.LabelSet) bool {
+	return matchLabels(h.Match, h.MatchRE, lset)
+}
+
+// OpsGenieHeartbeat is a heartbeat of the OpsGenie heartbeat API. The API
+// URL and key default to the global OpsGenie settings, the name to the name
+// of the heartbeat.
+type OpsGenieHeartbeat struct {
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	APIURL *config.URL   `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+	APIKey config.Secret `yaml:"api_key,omitempty" json:"api_key,omitempty"`
+	Name   string        `yaml:"name,omitempty" json:"name,omitempty"`
+}
+
+// setGlobalDefaults sets the settings of the heartbeats not set to the
+// global ones of the config.
+func (h *Heartbeat) setGlobalDefaults(g *config.GlobalConfig) error {
+	c := h.OpsGenie
+	if c == nil {
+		return nil
+	}
+	if c.HTTPConfig == nil {
+		c.HTTPConfig = g.HTTPConfig
+	}
+	if c.APIURL == nil {
+		if g.OpsGenieAPIURL == nil {
+			return errors.Errorf("heartbeat %q: no global OpsGenie URL set", h.Name)
+		}
+		c.APIURL = g.OpsGenieAPIURL
+	}
+	if c.APIKey == "" {
+		if g.OpsGenieAPIKey == "" {
+			return errors.Errorf("heartbeat %q: no global OpsGenie API key set", h.Name)
+		}
+		c.APIKey = g.OpsGenieAPIKey
+	}
+	if c.Name == "" {
+		c.Name = h.Name
+	}
+	return nil
+}
+
+// PingOpsGenieHeartbeat pings the OpsGenie heartbeat.
+//
+// https://docs.opsgenie.com/docs/heartbeat-api#ping-heartbeat-request
+func PingOpsGenieHeartbeat(ctx context.Context, c *OpsGenieHeartbeat) error {
+	u := c.APIURL.Copy()
+	u.Path = path.Join(u.Path, "v2/heartbeats", c.Name, "ping")
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "GenieKey "+string(c.APIKey))
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	hc, err := newHTTPClient(ctx, *c.HTTPConfig)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status code %v: %s", resp.StatusCode, readErrorBody(resp.Body))
+	}
+	return nil
+}
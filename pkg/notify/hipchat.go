@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Hipchat implements a Notifier for Hipchat, like the upstream notifier but
+// sending with newHTTPClient, which enforces the egress policy.
+type Hipchat struct {
+	conf   *config.HipchatConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewHipchat returns a new Hipchat notifier.
+func NewHipchat(c *config.HipchatConfig, t *template.Template, l log.Logger) *Hipchat {
+	return &Hipchat{conf: c, tmpl: t, logger: l}
+}
+
+type hipchatMessage struct {
+	From          string `json:"from"`
+	Notify        bool   `json:"notify"`
+	Message       string `json:"message"`
+	MessageFormat string `json:"message_format"`
+	Color         string `json:"color"`
+}
+
+// Render implements the Renderer interface.
+func (n *Hipchat) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	msg, _, err := n.message(ctx, as...)
+	return msg, err
+}
+
+// message returns the notification of the room and the room ID.
+func (n *Hipchat) message(ctx context.Context, as ...*types.Alert) (*hipchatMessage, string, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+		tmplHTML = tmplHTML(n.tmpl, data, &err)
+		msg      string
+	)
+	if n.conf.MessageFormat == "html" {
+		msg = tmplHTML(n.conf.Message)
+	} else {
+		msg = tmplText(n.conf.Message)
+	}
+	m := &hipchatMessage{
+		From:          tmplText(n.conf.From),
+		Notify:        n.conf.Notify,
+		Message:       msg,
+		MessageFormat: n.conf.MessageFormat,
+		Color:         tmplText(n.conf.Color),
+	}
+	roomID := tmplText(n.conf.RoomID)
+	if err != nil {
+		return nil, "", err
+	}
+	return m, roomID, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Hipchat) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, roomID, err := n.message(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	apiURL := n.conf.APIURL.Copy()
+	apiURL.Path += fmt.Sprintf("v2/room/%s/notification", roomID)
+	q := apiURL.Query()
+	q.Set("auth_token", string(n.conf.AuthToken))
+	apiURL.RawQuery = q.Encode()
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("POST", apiURL.String(), &buf)
+	if err != nil {
+		return true, redactURL(err)
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	// https://developer.atlassian.com/hipchat/guide/hipchat-rest-api/api-response-codes
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
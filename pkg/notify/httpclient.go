@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+)
+
+// tlsVersions are the TLS versions HTTPClientSettings.TLSMinVersion accepts.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+var (
+	httpClientMtx      sync.RWMutex
+	httpClientDefaults = DefaultHTTPClientSettings
+)
+
+// DefaultHTTPClientSettings are used until SetHTTPClientDefaults is called.
+var DefaultHTTPClientSettings = HTTPClientSettings{
+	DialTimeout:         model.Duration(30 * time.Second),
+	TLSHandshakeTimeout: model.Duration(10 * time.Second),
+	IdleConnTimeout:     model.Duration(5 * time.Minute),
+}
+
+// HTTPClientSettings configure the HTTP clients of the notifiers. The
+// defaults of all notifiers are set by SetHTTPClientDefaults, the
+// http_client of a receiver overrides the fields it sets for its
+// integrations. The proxy of the http_config of an integration takes
+// precedence over ProxyURL.
+type HTTPClientSettings struct {
+	// Timeout bounds a request including reading the response. The
+	// notification timeout applies if it is 0 or longer.
+	Timeout             model.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	DialTimeout         model.Duration `yaml:"dial_timeout,omitempty" json:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout model.Duration `yaml:"tls_handshake_timeout,omitempty" json:"tls_handshake_timeout,omitempty"`
+	IdleConnTimeout     model.Duration `yaml:"idle_conn_timeout,omitempty" json:"idle_conn_timeout,omitempty"`
+	MaxIdleConns        int            `yaml:"max_idle_conns,omitempty" json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int            `yaml:"max_idle_conns_per_host,omitempty" json:"max_idle_conns_per_host,omitempty"`
+	// TLSMinVersion is one of TLS10, TLS11, TLS12 and TLS13.
+	TLSMinVersion string      `yaml:"tls_min_version,omitempty" json:"tls_min_version,omitempty"`
+	ProxyURL      *config.URL `yaml:"proxy_url,omitempty" json:"proxy_url,omitempty"`
+	// EgressAllowedHosts and EgressAllowedCIDRs narrow the egress policy
+	// for the integrations of a receiver, like the AllowedHosts and
+	// AllowedCIDRs of EgressPolicy. The destinations must be allowed by
+	// both, so they never allow what the egress policy blocks.
+	EgressAllowedHosts []string `yaml:"egress_allowed_hosts,omitempty" json:"egress_allowed_hosts,omitempty"`
+	EgressAllowedCIDRs []string `yaml:"egress_allowed_cidrs,omitempty" json:"egress_allowed_cidrs,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *HTTPClientSettings) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HTTPClientSettings
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	return s.Validate()
+}
+
+// Validate checks the settings.
+func (s *HTTPClientSettings) Validate() error {
+	if s.Timeout < 0 || s.DialTimeout < 0 || s.TLSHandshakeTimeout < 0 || s.IdleConnTimeout < 0 {
+		return errors.New("http_client timeouts must not be negative")
+	}
+	if s.MaxIdleConns < 0 || s.MaxIdleConnsPerHost < 0 {
+		return errors.New("http_client max_idle_conns and max_idle_conns_per_host must not be negative")
+	}
+	if _, ok := tlsVersions[s.TLSMinVersion]; s.TLSMinVersion != "" && !ok {
+		return errors.Errorf("invalid http_client tls_min_version %q, must be one of TLS10, TLS11, TLS12, TLS13", s.TLSMinVersion)
+	}
+	if _, err := ParseCIDRs(s.EgressAllowedCIDRs); err != nil {
+		return errors.Wrap(err, "invalid http_client egress_allowed_cidrs")
+	}
+	return nil
+}
+
+// merge returns s with the fields set in o overridden.
+func (s HTTPClientSettings) merge(o *HTTPClientSettings) HTTPClientSettings {
+	if o == nil {
+		return s
+	}
+	if o.Timeout > 0 {
+		s.Timeout = o.Timeout
+	}
+	if o.DialTimeout > 0 {
+		s.DialTimeout = o.DialTimeout
+	}
+	if o.TLSHandshakeTimeout > 0 {
+		s.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+	}
+	if o.IdleConnTimeout > 0 {
+		s.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.MaxIdleConns > 0 {
+		s.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		s.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.TLSMinVersion != "" {
+		s.TLSMinVersion = o.TLSMinVersion
+	}
+	if o.ProxyURL != nil && o.ProxyURL.URL != nil {
+		s.ProxyURL = o.ProxyURL
+	}
+	if len(o.EgressAllowedHosts) > 0 {
+		s.EgressAllowedHosts = o.EgressAllowedHosts
+	}
+	if len(o.EgressAllowedCIDRs) > 0 {
+		s.EgressAllowedCIDRs = o.EgressAllowedCIDRs
+	}
+	return s
+}
+
+// egressPolicy returns the policy narrowing the egress policy, nil if the
+// settings do not narrow it.
+func (s HTTPClientSettings) egressPolicy() (*EgressPolicy, error) {
+	if len(s.EgressAllowedHosts) == 0 && len(s.EgressAllowedCIDRs) == 0 {
+		return nil, nil
+	}
+	cidrs, err := ParseCIDRs(s.EgressAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	return &EgressPolicy{AllowedHosts: s.EgressAllowedHosts, AllowedCIDRs: cidrs}, nil
+}
+
+func (s HTTPClientSettings) proxyURL() *url.URL {
+	if s.ProxyURL == nil {
+		return nil
+	}
+	return s.ProxyURL.URL
+}
+
+// SetHTTPClientDefaults sets the settings of the HTTP clients of all
+// notifiers, which receivers can override.
+func SetHTTPClientDefaults(s HTTPClientSettings) {
+	httpClientMtx.Lock()
+	defer httpClientMtx.Unlock()
+	httpClientDefaults = s
+}
+
+type httpClientSettingsKey struct{}
+
+// withHTTPClientSettings returns a context carrying the http_client of a
+// receiver, which newHTTPClient applies.
+func withHTTPClientSettings(ctx context.Context, s *HTTPClientSettings) context.Context {
+	return context.WithValue(ctx, httpClientSettingsKey{}, s)
+}
+
+// httpClientSettings returns the defaults overridden by the http_client of
+// the receiver notified with ctx.
+func httpClientSettings(ctx context.Context) HTTPClientSettings {
+	httpClientMtx.RLock()
+	s := httpClientDefaults
+	httpClientMtx.RUnlock()
+	o, _ := ctx.Value(httpClientSettingsKey{}).(*HTTPClientSettings)
+	return s.merge(o)
+}
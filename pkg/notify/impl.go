@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/tracing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+)
+
+// A Renderer returns the payload a notifier sends for the given alerts,
+// without sending it.
+type Renderer interface {
+	Render(context.Context, ...*types.Alert) (interface{}, error)
+}
+
+// An Integration wraps a notifier and its config to be uniquely identified by
+// name and index from its origin in the configuration.
+type Integration struct {
+	notifier notify.Notifier
+	conf     NotifierConfig
+	name     string
+	idx      int
+	// httpClient overrides the HTTP client defaults for the notifier.
+	httpClient *HTTPClientSettings
+}
+
+// Render returns the payload the integration would send for the alerts.
+// ok is false if the notifier is not able to render its payload.
+func (i *Integration) Render(ctx context.Context, alerts ...*types.Alert) (payload interface{}, ok bool, err error) {
+	r, ok := i.notifier.(Renderer)
+	if !ok {
+		return nil, false, nil
+	}
+	payload, err = r.Render(ctx, alerts...)
+	return payload, true, err
+}
+
+// Notify implements the Notifier interface. Each attempt is counted and
+// traced by tenant and integration, the span is propagated to the requests
+// of the notifiers using newHTTPClient, and the attempt is reported to the
+// NotificationObserver of the context.
+func (i *Integration) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	tenant, _ := TenantID(ctx)
+	sp, ctx := opentracing.StartSpanFromContext(ctx, "Notify "+i.name)
+	defer sp.Finish()
+	sp.SetTag("integration", fmt.Sprintf("%s[%d]", i.name, i.idx))
+	sp.SetTag("alerts", len(alerts))
+	sp.SetTag("tenant", tenant)
+	if receiver, ok := notify.ReceiverName(ctx); ok {
+		sp.SetTag("receiver", receiver)
+	}
+
+	if i.httpClient != nil {
+		ctx = withHTTPClientSettings(ctx, i.httpClient)
+	}
+	start := time.Now()
+	retry, err := i.notifier.Notify(ctx, alerts...)
+	notificationLatencySeconds.WithLabelValues(tenant, i.name).Observe(time.Since(start).Seconds())
+	numNotifications.WithLabelValues(tenant, i.name).Inc()
+	if err != nil {
+		numFailedNotifications.WithLabelValues(tenant, i.name).Inc()
+		sp.SetTag("retryable", retry)
+		tracing.SetError(sp, err)
+	}
+	if o, ok := notificationObserver(ctx); ok {
+		o.Notified(ctx, NotificationAttempt{
+			Integration: *i,
+			Alerts:      alerts,
+			Attempt:     attemptNumber(ctx),
+			Err:         err,
+			Retry:       retry,
+		})
+	}
+	return retry, err
+}
+
+// Name returns the name of the integration.
+func (i *Integration) Name() string {
+	return i.name
+}
+
+// Index returns the position of the integration among the integrations of
+// the same name in the receiver.
+func (i *Integration) Index() int {
+	return i.idx
+}
+
+// BuildReceiverIntegrations builds a list of integration notifiers off of a
+// receivers config, with the integration types in their registration order.
+func BuildReceiverIntegrations(nc *Receiver, tmpl *template.Template, logger log.Logger) []Integration {
+	var integrations []Integration
+	for _, t := range getIntegrationTypes() {
+		for i, c := range t.Configs(nc) {
+			integrations = append(integrations, Integration{
+				notifier: t.New(c, tmpl, logger),
+				conf:     c,
+				name:     t.Name,
+				idx:      i,
+
+				httpClient: nc.ReceiverExtension.HTTPClient,
+			})
+		}
+	}
+	return integrations
+}
+
+const contentTypeJSON = "application/json"
+
+var userAgentHeader = fmt.Sprintf("Alertmanager/%s", version.Version)
+
+func receiverName(ctx context.Context, l log.Logger) string {
+	recv, ok := notify.ReceiverName(ctx)
+	if !ok {
+		_ = level.Error(l).Log("msg", "Missing receiver")
+	}
+	return recv
+}
+
+func groupLabels(ctx context.Context, l log.Logger) model.LabelSet {
+	groupLabels, ok := notify.GroupLabels(ctx)
+	if !ok {
+		_ = level.Error(l).Log("msg", "Missing group labels")
+	}
+	return groupLabels
+}
+
+// tmplText is using monadic error handling in order to make string templating
+// less verbose. Use with care as the final error checking is easily missed.
+func tmplText(tmpl *template.Template, data *template.Data, err *error) func(string) string {
+	return func(name string) (s string) {
+		if *err != nil {
+			return
+		}
+		s, *err = tmpl.ExecuteTextString(name, data)
+		return s
+	}
+}
+
+// tmplHTML is tmplText for HTML templates.
+func tmplHTML(tmpl *template.Template, data *template.Data, err *error) func(string) string {
+	return func(name string) (s string) {
+		if *err != nil {
+			return
+		}
+		s, *err = tmpl.ExecuteHTMLString(name, data)
+		return s
+	}
+}
+
+// hashKey returns the sha256 of a group key, as integrations may limit the
+// length of their deduplication keys.
+func hashKey(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// redactURL removes the URL part from an error of *url.Error type.
+func redactURL(err error) error {
+	e, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	e.URL = "<redacted>"
+	return e
+}
+
+// retryHTTP treats 5xx and 429 (too many requests) response codes as
+// recoverable failures.
+func retryHTTP(statusCode int, body io.Reader) (bool, error) {
+	if statusCode/100 == 2 {
+		return false, nil
+	}
+	msg := readErrorBody(body)
+	return statusCode/100 == 5 || statusCode == http.StatusTooManyRequests, fmt.Errorf("unexpected status code %v: %s", statusCode, msg)
+}
+
+func readErrorBody(body io.Reader) string {
+	if body == nil {
+		return ""
+	}
+	b := make([]byte, 512)
+	n, _ := io.ReadFull(body, b)
+	return string(b[:n])
+}
@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/kafka"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// Kafka implements a Notifier producing webhook messages to a Kafka topic.
+type Kafka struct {
+	conf   *KafkaConfig
+	tmpl   *template.Template
+	logger log.Logger
+
+	// producer is reused by the notifications to keep the connections to
+	// the brokers, and built again after clientMaxAge to read rotated TLS
+	// certificates.
+	mtx             sync.Mutex
+	producer        *kafka.Producer
+	producerCreated time.Time
+}
+
+// NewKafka returns a new Kafka notifier.
+func NewKafka(c *KafkaConfig, t *template.Template, l log.Logger) *Kafka {
+	return &Kafka{conf: c, tmpl: t, logger: l}
+}
+
+type kafkaMessage struct {
+	Topic string          `json:"topic"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Render implements the Renderer interface.
+func (n *Kafka) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	return n.message(ctx, as...)
+}
+
+func (n *Kafka) message(ctx context.Context, as ...*types.Alert) (*kafkaMessage, error) {
+	msg, data, err := webhookMessage(ctx, n.tmpl, n.logger, as...)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := TenantID(ctx)
+	if n.conf.Key != "" {
+		key = tmplText(n.tmpl, data, &err)(n.conf.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &kafkaMessage{Topic: n.conf.Topic, Key: key, Value: msg}, nil
+}
+
+// getProducer returns the producer of the notifier, building it if needed.
+func (n *Kafka) getProducer(now time.Time) (*kafka.Producer, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.producer != nil && now.Sub(n.producerCreated) < clientMaxAge {
+		return n.producer, nil
+	}
+	p, err := n.newProducer()
+	if err != nil {
+		return nil, err
+	}
+	if n.producer != nil {
+		n.producer.Close()
+	}
+	n.producer, n.producerCreated = p, now
+	return p, nil
+}
+
+func (n *Kafka) newProducer() (*kafka.Producer, error) {
+	cfg := kafka.Config{
+		Brokers:  n.conf.Brokers,
+		ClientID: "alertmanager",
+		Timeout:  time.Duration(n.conf.Timeout),
+		Dial:     DialContext,
+	}
+	switch n.conf.Acks {
+	case KafkaAcksAll:
+		cfg.Acks = kafka.AcksAll
+	case KafkaAcksLeader:
+		cfg.Acks = kafka.AcksLeader
+	case KafkaAcksNone:
+		cfg.Acks = kafka.AcksNone
+	}
+	if n.conf.TLSConfig != nil {
+		tc, err := commoncfg.NewTLSConfig(n.conf.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tc
+	}
+	if n.conf.SASL != nil {
+		cfg.SASL = &kafka.SASLConfig{
+			Mechanism: n.conf.SASL.Mechanism,
+			Username:  n.conf.SASL.Username,
+			Password:  string(n.conf.SASL.Password),
+		}
+	}
+	return kafka.NewProducer(cfg), nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Kafka) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.message(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	p, err := n.getProducer(time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	m := kafka.Message{Value: msg.Value}
+	if msg.Key != "" {
+		m.Key = []byte(msg.Key)
+	}
+	if err := p.Produce(ctx, msg.Topic, m); err != nil {
+		return retryKafka(err), err
+	}
+	return false, nil
+}
+
+// retryKafka retries errors the brokers report as temporary as well as
+// connection errors.
+func retryKafka(err error) bool {
+	if kerr, ok := errors.Cause(err).(kafka.Error); ok {
+		return kerr.Temporary()
+	}
+	return true
+}
@@ -0,0 +1,413 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+var numSuppressedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "notifications_suppressed_total",
+	Help:      "The total number of alerts whose notifications were suppressed by a maintenance window.",
+}, []string{"window"})
+
+func init() {
+	prometheus.MustRegister(numSuppressedNotifications)
+}
+
+// MaintenanceWindow is a named, recurring or one-off time window during
+// which the notifications of matching alerts are suppressed.
+//
+// A recurring window starts at the times of its cron schedule or its
+// recurrence rule and lasts for its duration. A one-off window lasts from
+// start to end.
+type MaintenanceWindow struct {
+	Name string `yaml:"name" json:"name"`
+
+	Schedule string         `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	RRule    string         `yaml:"rrule,omitempty" json:"rrule,omitempty"`
+	Duration model.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+	TimeZone string         `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+
+	Start *time.Time `yaml:"start,omitempty" json:"start,omitempty"`
+	End   *time.Time `yaml:"end,omitempty" json:"end,omitempty"`
+
+	// Matchers restrict the window to alerts with these label values.
+	Matchers model.LabelSet `yaml:"matchers,omitempty" json:"matchers,omitempty"`
+	// Receivers restrict the window to the notifications of these receivers.
+	Receivers []string `yaml:"receivers,omitempty" json:"receivers,omitempty"`
+
+	cron *cronSchedule
+	loc  *time.Location
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (w *MaintenanceWindow) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain MaintenanceWindow
+	if err := unmarshal((*plain)(w)); err != nil {
+		return err
+	}
+	return w.init()
+}
+
+// MarshalJSON implements the json.Marshaler interface. The duration is
+// formatted the same way as in the YAML configuration.
+func (w MaintenanceWindow) MarshalJSON() ([]byte, error) {
+	type plain MaintenanceWindow
+	v := struct {
+		plain
+		Duration string `json:"duration,omitempty"`
+	}{plain: plain(w)}
+	if w.Duration > 0 {
+		v.Duration = w.Duration.String()
+	}
+	return json.Marshal(v)
+}
+
+func (w *MaintenanceWindow) init() error {
+	if w.Name == "" {
+		return errors.New("missing name in maintenance window")
+	}
+	recurring := w.Schedule != "" || w.RRule != ""
+	switch {
+	case w.Schedule != "" && w.RRule != "":
+		return errors.Errorf("maintenance window %q: at most one of schedule & rrule must be configured", w.Name)
+	case recurring && (w.Start != nil || w.End != nil):
+		return errors.Errorf("maintenance window %q: start and end can not be combined with a schedule", w.Name)
+	case recurring && w.Duration <= 0:
+		return errors.Errorf("maintenance window %q: missing duration", w.Name)
+	case !recurring && (w.Start == nil || w.End == nil):
+		return errors.Errorf("maintenance window %q: missing schedule, rrule or start and end", w.Name)
+	case !recurring && !w.End.After(*w.Start):
+		return errors.Errorf("maintenance window %q: end must be after start", w.Name)
+	}
+	if err := w.Matchers.Validate(); err != nil {
+		return errors.Wrapf(err, "maintenance window %q", w.Name)
+	}
+
+	w.loc = time.UTC
+	if w.TimeZone != "" {
+		loc, err := time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return errors.Wrapf(err, "maintenance window %q", w.Name)
+		}
+		w.loc = loc
+	}
+
+	var err error
+	switch {
+	case w.Schedule != "":
+		w.cron, err = parseCron(w.Schedule)
+	case w.RRule != "":
+		w.cron, err = parseRRule(w.RRule)
+	}
+	return errors.Wrapf(err, "maintenance window %q", w.Name)
+}
+
+// Active returns true if t is within the window.
+func (w *MaintenanceWindow) Active(t time.Time) bool {
+	if w.cron == nil {
+		return !t.Before(*w.Start) && t.Before(*w.End)
+	}
+	t = t.In(w.loc)
+	_, ok := w.cron.prev(t, t.Add(-time.Duration(w.Duration)))
+	return ok
+}
+
+// Matches returns true if the window applies to the notifications of an
+// alert with the given labels sent to the receiver.
+func (w *MaintenanceWindow) Matches(receiver string, lset model.LabelSet) bool {
+	for ln, lv := range w.Matchers {
+		if lset[ln] != lv {
+			return false
+		}
+	}
+	if len(w.Receivers) == 0 {
+		return true
+	}
+	for _, r := range w.Receivers {
+		if r == receiver {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceStage removes the alerts in active maintenance windows.
+type MaintenanceStage struct {
+	windows []*MaintenanceWindow
+	now     func() time.Time
+}
+
+// NewMaintenanceStage returns a new MaintenanceStage.
+func NewMaintenanceStage(windows []*MaintenanceWindow) *MaintenanceStage {
+	return &MaintenanceStage{windows: windows, now: time.Now}
+}
+
+// Exec implements the Stage interface.
+func (s *MaintenanceStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	if len(s.windows) == 0 {
+		return ctx, alerts, nil
+	}
+	receiver := receiverName(ctx, l)
+	active := s.active()
+	if len(active) == 0 {
+		return ctx, alerts, nil
+	}
+
+	var (
+		filtered   []*types.Alert
+		suppressed = map[*MaintenanceWindow][]*types.Alert{}
+	)
+	for _, a := range alerts {
+		w := s.window(active, receiver, a.Labels)
+		if w == nil {
+			filtered = append(filtered, a)
+			continue
+		}
+		suppressed[w] = append(suppressed[w], a)
+		numSuppressedNotifications.WithLabelValues(w.Name).Inc()
+		_ = level.Debug(l).Log("msg", "Notification suppressed by maintenance window", "window", w.Name, "alert", a.Name(), "receiver", receiver)
+	}
+	if o, ok := notificationObserver(ctx); ok {
+		for w, as := range suppressed {
+			o.Suppressed(ctx, w.Name, as)
+		}
+	}
+	return ctx, filtered, nil
+}
+
+// Suppressing returns the name of the maintenance window suppressing the
+// notification of an alert to the receiver, or false if it is not
+// suppressed.
+func (s *MaintenanceStage) Suppressing(receiver string, lset model.LabelSet) (string, bool) {
+	if w := s.window(s.active(), receiver, lset); w != nil {
+		return w.Name, true
+	}
+	return "", false
+}
+
+func (s *MaintenanceStage) active() []*MaintenanceWindow {
+	var active []*MaintenanceWindow
+	now := s.now()
+	for _, w := range s.windows {
+		if w.Active(now) {
+			active = append(active, w)
+		}
+	}
+	return active
+}
+
+func (s *MaintenanceStage) window(windows []*MaintenanceWindow, receiver string, lset model.LabelSet) *MaintenanceWindow {
+	for _, w := range windows {
+		if w.Matches(receiver, lset) {
+			return w
+		}
+	}
+	return nil
+}
+
+// cronSchedule is a parsed standard 5 field cron expression.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// If both the day of month and the day of week are restricted, either
+	// of them has to match.
+	domStar, dowStar bool
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+func parseCron(s string) (*cronSchedule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid schedule %q: expected 5 fields", s)
+	}
+	var (
+		c   cronSchedule
+		err error
+	)
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, errors.Wrapf(err, "invalid minute in schedule %q", s)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, errors.Wrapf(err, "invalid hour in schedule %q", s)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, errors.Wrapf(err, "invalid day of month in schedule %q", s)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, errors.Wrapf(err, "invalid month in schedule %q", s)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, errors.Wrapf(err, "invalid day of week in schedule %q", s)
+	}
+	// Sunday is both 0 and 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	return &c, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps
+// into a bit set.
+func parseCronField(s string, min, max int, names map[string]int) (uint64, error) {
+	value := func(v string) (int, error) {
+		if n, ok := names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, err
+		}
+		if n < min || n > max {
+			return 0, errors.Errorf("%d out of range [%d, %d]", n, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, errors.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			i := strings.Index(part, "-")
+			var err error
+			if lo, err = value(part[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = value(part[i+1:]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, errors.Errorf("invalid range %q", part)
+			}
+		default:
+			v, err := value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	if c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// prev returns the latest time of the schedule at or before t and not
+// before limit.
+func (c *cronSchedule) prev(t, limit time.Time) (time.Time, bool) {
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	for !t.Before(limit) {
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) != 0 {
+			return t, true
+		}
+		t = t.Add(-time.Minute)
+	}
+	return time.Time{}, false
+}
+
+// parseRRule converts the subset of RFC 5545 recurrence rules which can be
+// expressed as a cron schedule: FREQ of DAILY, WEEKLY or MONTHLY with
+// BYDAY, BYMONTHDAY, BYMONTH, BYHOUR and BYMINUTE. The window starts at
+// minute and hour zero unless BYHOUR and BYMINUTE are given.
+func parseRRule(s string) (*cronSchedule, error) {
+	parts := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid rrule part %q", p)
+		}
+		parts[strings.ToUpper(kv[0])] = kv[1]
+	}
+
+	fields := map[string]string{
+		"BYMINUTE":   "0",
+		"BYHOUR":     "0",
+		"BYMONTHDAY": "*",
+		"BYMONTH":    "*",
+		"BYDAY":      "*",
+	}
+	for k, v := range parts {
+		switch k {
+		case "FREQ":
+		case "BYMINUTE", "BYHOUR", "BYMONTHDAY", "BYMONTH":
+			fields[k] = v
+		case "BYDAY":
+			var days []string
+			for _, d := range strings.Split(v, ",") {
+				n, ok := map[string]int{"SU": 0, "MO": 1, "TU": 2, "WE": 3, "TH": 4, "FR": 5, "SA": 6}[strings.ToUpper(d)]
+				if !ok {
+					return nil, errors.Errorf("unsupported rrule BYDAY value %q", d)
+				}
+				days = append(days, strconv.Itoa(n))
+			}
+			fields[k] = strings.Join(days, ",")
+		default:
+			return nil, errors.Errorf("unsupported rrule part %q", k)
+		}
+	}
+	switch parts["FREQ"] {
+	case "DAILY":
+	case "WEEKLY":
+		if fields["BYDAY"] == "*" {
+			return nil, errors.New("weekly rrule requires BYDAY")
+		}
+	case "MONTHLY":
+		if fields["BYMONTHDAY"] == "*" {
+			return nil, errors.New("monthly rrule requires BYMONTHDAY")
+		}
+	default:
+		return nil, errors.Errorf("unsupported rrule FREQ %q", parts["FREQ"])
+	}
+	return parseCron(fmt.Sprintf("%s %s %s %s %s", fields["BYMINUTE"], fields["BYHOUR"], fields["BYMONTHDAY"], fields["BYMONTH"], fields["BYDAY"]))
+}
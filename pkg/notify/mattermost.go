@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Mattermost implements a Notifier for Mattermost incoming webhooks.
+type Mattermost struct {
+	conf   *MattermostConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewMattermost returns a new Mattermost notifier.
+func NewMattermost(c *MattermostConfig, t *template.Template, l log.Logger) *Mattermost {
+	return &Mattermost{conf: c, tmpl: t, logger: l}
+}
+
+type mattermostMessage struct {
+	Channel     string                 `json:"channel,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	IconURL     string                 `json:"icon_url,omitempty"`
+	IconEmoji   string                 `json:"icon_emoji,omitempty"`
+	Attachments []mattermostAttachment `json:"attachments"`
+}
+
+// mattermostAttachment is a message attachment. Its text is markdown.
+type mattermostAttachment struct {
+	Fallback  string `json:"fallback,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Title     string `json:"title,omitempty"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
+
+// Render implements the Renderer interface.
+func (n *Mattermost) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	msg := &mattermostMessage{
+		Channel:   tmplText(n.conf.Channel),
+		Username:  tmplText(n.conf.Username),
+		IconURL:   tmplText(n.conf.IconURL),
+		IconEmoji: tmplText(n.conf.IconEmoji),
+		Attachments: []mattermostAttachment{{
+			Fallback:  tmplText(n.conf.Fallback),
+			Color:     tmplText(n.conf.Color),
+			Title:     tmplText(n.conf.Title),
+			TitleLink: tmplText(n.conf.TitleLink),
+			Text:      tmplText(n.conf.Text),
+		}},
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Mattermost) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.Render(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", n.conf.WebhookURL.String(), &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// MSTeams implements a Notifier for Microsoft Teams incoming webhooks using
+// Adaptive Cards.
+type MSTeams struct {
+	conf   *MSTeamsConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewMSTeams returns a new MSTeams notifier.
+func NewMSTeams(c *MSTeamsConfig, t *template.Template, l log.Logger) *MSTeams {
+	return &MSTeams{conf: c, tmpl: t, logger: l}
+}
+
+type msTeamsMessage struct {
+	Type        string              `json:"type"`
+	Attachments []msTeamsAttachment `json:"attachments"`
+}
+
+type msTeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string                `json:"$schema"`
+	Type    string                `json:"type"`
+	Version string                `json:"version"`
+	Body    []adaptiveCardElement `json:"body"`
+	MSTeams map[string]string     `json:"msteams,omitempty"`
+}
+
+type adaptiveCardElement struct {
+	Type   string             `json:"type"`
+	Text   string             `json:"text,omitempty"`
+	Weight string             `json:"weight,omitempty"`
+	Size   string             `json:"size,omitempty"`
+	Color  string             `json:"color,omitempty"`
+	Wrap   bool               `json:"wrap,omitempty"`
+	Facts  []adaptiveCardFact `json:"facts,omitempty"`
+}
+
+type adaptiveCardFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// Render implements the Renderer interface.
+func (n *MSTeams) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	color := "Attention"
+	if types.Alerts(as...).Status() == model.AlertResolved {
+		color = "Good"
+	}
+
+	body := []adaptiveCardElement{
+		{
+			Type:   "TextBlock",
+			Text:   tmplText(n.conf.Title),
+			Weight: "Bolder",
+			Size:   "Medium",
+			Color:  color,
+			Wrap:   true,
+		},
+		{
+			Type: "TextBlock",
+			Text: tmplText(n.conf.Text),
+			Wrap: true,
+		},
+	}
+	if len(n.conf.Facts) > 0 {
+		facts := make([]adaptiveCardFact, 0, len(n.conf.Facts))
+		for _, f := range n.conf.Facts {
+			facts = append(facts, adaptiveCardFact{
+				Title: tmplText(f.Name),
+				Value: tmplText(f.Value),
+			})
+		}
+		body = append(body, adaptiveCardElement{Type: "FactSet", Facts: facts})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &msTeamsMessage{
+		Type: "message",
+		Attachments: []msTeamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: adaptiveCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.2",
+				Body:    body,
+				MSTeams: map[string]string{"width": "Full"},
+			},
+		}},
+	}, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *MSTeams) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.Render(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", n.conf.WebhookURL.String(), &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
@@ -0,0 +1,437 @@
+// Package notify is a fork of the pipeline building part of
+// github.com/prometheus/alertmanager/notify. Upstream does not allow to add
+// integrations, so the receiver integrations and the stages depending on
+// them are built here, while the generic stages are reused from upstream.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cespare/xxhash"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/cluster"
+	"github.com/prometheus/alertmanager/inhibit"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	numNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "notifications_total",
+		Help:      "The total number of attempted notifications.",
+	}, []string{"tenant", "integration"})
+
+	numFailedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "notifications_failed_total",
+		Help:      "The total number of failed notifications.",
+	}, []string{"tenant", "integration"})
+
+	notificationLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "appscode",
+		Name:      "notification_latency_seconds",
+		Help:      "The latency of notifications in seconds.",
+		Buckets:   []float64{1, 5, 10, 15, 20},
+	}, []string{"tenant", "integration"})
+
+	numExhaustedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "notifications_retries_exhausted_total",
+		Help:      "The total number of notifications which failed after exhausting their retries.",
+	}, []string{"tenant", "integration"})
+)
+
+func init() {
+	prometheus.MustRegister(numNotifications)
+	prometheus.MustRegister(numFailedNotifications)
+	prometheus.MustRegister(notificationLatencySeconds)
+	prometheus.MustRegister(numExhaustedNotifications)
+}
+
+type tenantIDKey struct{}
+
+// WithTenantID populates a context with the ID of the tenant owning the
+// pipeline.
+func WithTenantID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantIDKey{}, id)
+}
+
+// TenantID extracts the tenant ID from the context. Iff none exists, the
+// second argument is false.
+func TenantID(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(tenantIDKey{}).(string)
+	return v, ok
+}
+
+// TenantStage adds the tenant ID to the context of the notifications.
+type TenantStage string
+
+// Exec implements the Stage interface.
+func (s TenantStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	return WithTenantID(ctx, string(s)), alerts, nil
+}
+
+// BuildPipeline builds a map of receivers to Stages. features tells
+// whether a feature flag is enabled for the tenant, all are if nil.
+func BuildPipeline(
+	tenantID string,
+	features func(feature string) bool,
+	confs []*Receiver,
+	windows []*MaintenanceWindow,
+	storm *StormStage,
+	enrichment *EnrichmentWebhook,
+	tmpl *template.Template,
+	wait func() time.Duration,
+	inhibitor *inhibit.Inhibitor,
+	silencer *silence.Silencer,
+	notificationLog notify.NotificationLog,
+	peer *cluster.Peer,
+	logger log.Logger,
+) notify.RoutingStage {
+	rs := notify.RoutingStage{}
+
+	ms := notify.NewGossipSettleStage(peer)
+	is := notify.NewMuteStage(inhibitor)
+	ss := notify.NewMuteStage(silencer)
+	mw := NewMaintenanceStage(windows)
+	es := NewEnrichmentStage(enrichment)
+
+	// The integrations of the receivers are shared with the escalations
+	// to them.
+	integrations := map[string]notify.Stage{}
+	for _, rc := range confs {
+		integrations[rc.Name] = createStage(rc, tmpl, wait, notificationLog, logger)
+	}
+	for _, rc := range confs {
+		esc := NewEscalationStage(rc.Escalations, integrations, notificationLog)
+		rs[rc.Name] = notify.MultiStage{TenantStage(tenantID), FeaturesStage(features), ms, is, ss, mw, storm, es, esc, integrations[rc.Name]}
+	}
+	return rs
+}
+
+// createStage creates a pipeline of stages for a receiver.
+func createStage(rc *Receiver, tmpl *template.Template, wait func() time.Duration, notificationLog notify.NotificationLog, logger log.Logger) notify.Stage {
+	var fs notify.FanoutStage
+	for _, i := range BuildReceiverIntegrations(rc, tmpl, logger) {
+		recv := &nflogpb.Receiver{
+			GroupName:   rc.Name,
+			Integration: i.name,
+			Idx:         uint32(i.idx),
+		}
+		var s notify.MultiStage
+		s = append(s, notify.NewWaitStage(wait))
+		s = append(s, NewDedupStage(i, notificationLog, recv))
+		s = append(s, NewRetryStage(i, rc.Name, rc.RetryPolicy))
+		s = append(s, notify.NewSetNotifiesStage(notificationLog, recv))
+
+		fs = append(fs, s)
+	}
+	return fs
+}
+
+// DedupStage filters alerts.
+// Filtering happens based on a notification log.
+type DedupStage struct {
+	nflog notify.NotificationLog
+	recv  *nflogpb.Receiver
+	conf  NotifierConfig
+
+	now  func() time.Time
+	hash func(*types.Alert) uint64
+}
+
+// NewDedupStage wraps a DedupStage that runs against the given notification log.
+func NewDedupStage(i Integration, l notify.NotificationLog, recv *nflogpb.Receiver) *DedupStage {
+	return &DedupStage{
+		nflog: l,
+		recv:  recv,
+		conf:  i.conf,
+		now:   utcNow,
+		hash:  hashAlert,
+	}
+}
+
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+var hashBuffers = sync.Pool{}
+
+func getHashBuffer() []byte {
+	b := hashBuffers.Get()
+	if b == nil {
+		return make([]byte, 0, 1024)
+	}
+	return b.([]byte)
+}
+
+func putHashBuffer(b []byte) {
+	b = b[:0]
+	//lint:ignore SA6002 relax staticcheck verification.
+	hashBuffers.Put(b)
+}
+
+// HashAlert returns the hash identifying the alert in the firing and
+// resolved alerts of the notification log entries.
+func HashAlert(a *types.Alert) uint64 {
+	return hashAlert(a)
+}
+
+func hashAlert(a *types.Alert) uint64 {
+	const sep = '\xff'
+
+	b := getHashBuffer()
+	defer putHashBuffer(b)
+
+	names := make(model.LabelNames, 0, len(a.Labels))
+
+	for ln := range a.Labels {
+		names = append(names, ln)
+	}
+	sort.Sort(names)
+
+	for _, ln := range names {
+		b = append(b, string(ln)...)
+		b = append(b, sep)
+		b = append(b, string(a.Labels[ln])...)
+		b = append(b, sep)
+	}
+
+	return xxhash.Sum64(b)
+}
+
+func (n *DedupStage) needsUpdate(entry *nflogpb.Entry, firing, resolved map[uint64]struct{}, repeat time.Duration) bool {
+	// If we haven't notified about the alert group before, notify right away
+	// unless we only have resolved alerts.
+	if entry == nil {
+		return len(firing) > 0
+	}
+
+	if !entry.IsFiringSubset(firing) {
+		return true
+	}
+
+	// Notify about all alerts being resolved.
+	// This is done irrespective of the send_resolved flag to make sure that
+	// the firing alerts are cleared from the notification log.
+	if len(firing) == 0 {
+		// If the current alert group and last notification contain no firing
+		// alert, it means that some alerts have been fired and resolved during the
+		// last interval. In this case, there is no need to notify the receiver
+		// since it doesn't know about them.
+		return len(entry.FiringAlerts) > 0
+	}
+
+	if n.conf.SendResolved() && !entry.IsResolvedSubset(resolved) {
+		return true
+	}
+
+	// Nothing changed, only notify if the repeat interval has passed.
+	return entry.Timestamp.Before(n.now().Add(-repeat))
+}
+
+// Exec implements the Stage interface.
+func (n *DedupStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	gkey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return ctx, nil, fmt.Errorf("group key missing")
+	}
+
+	repeatInterval, ok := notify.RepeatInterval(ctx)
+	if !ok {
+		return ctx, nil, fmt.Errorf("repeat interval missing")
+	}
+
+	firingSet := map[uint64]struct{}{}
+	resolvedSet := map[uint64]struct{}{}
+	firing := []uint64{}
+	resolved := []uint64{}
+
+	var hash uint64
+	for _, a := range alerts {
+		hash = n.hash(a)
+		if a.Resolved() {
+			resolved = append(resolved, hash)
+			resolvedSet[hash] = struct{}{}
+		} else {
+			firing = append(firing, hash)
+			firingSet[hash] = struct{}{}
+		}
+	}
+
+	ctx = notify.WithFiringAlerts(ctx, firing)
+	ctx = notify.WithResolvedAlerts(ctx, resolved)
+
+	entries, err := n.nflog.Query(nflog.QGroupKey(gkey), nflog.QReceiver(n.recv))
+
+	if err != nil && err != nflog.ErrNotFound {
+		return ctx, nil, err
+	}
+	var entry *nflogpb.Entry
+	switch len(entries) {
+	case 0:
+	case 1:
+		entry = entries[0]
+	case 2:
+		return ctx, nil, fmt.Errorf("unexpected entry result size %d", len(entries))
+	}
+	if n.needsUpdate(entry, firingSet, resolvedSet, repeatInterval) {
+		return ctx, alerts, nil
+	}
+	return ctx, nil, nil
+}
+
+// RetriesExhaustedError is returned by the RetryStage if a notification
+// still failed after the attempts or the time allowed by its retry policy.
+type RetriesExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("retries exhausted after %d attempts: %s", e.Attempts, e.Err)
+}
+
+// RetryStage notifies via passed integration with exponential backoff until it
+// succeeds. It aborts if the context is canceled or timed out, or if the
+// attempts of its retry policy are exhausted.
+type RetryStage struct {
+	integration Integration
+	groupName   string
+	policy      RetryPolicy
+}
+
+// NewRetryStage returns a new instance of a RetryStage. The default policy
+// is used if policy is nil.
+func NewRetryStage(i Integration, groupName string, policy *RetryPolicy) *RetryStage {
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	return &RetryStage{
+		integration: i,
+		groupName:   groupName,
+		policy:      *policy,
+	}
+}
+
+func (r RetryStage) exhausted(ctx context.Context, alerts []*types.Alert, attempts int, err error) (context.Context, []*types.Alert, error) {
+	tenant, _ := TenantID(ctx)
+	numExhaustedNotifications.WithLabelValues(tenant, r.integration.name).Inc()
+	if o, ok := notificationObserver(ctx); ok {
+		o.Notified(ctx, NotificationAttempt{
+			Integration: r.integration,
+			Alerts:      alerts,
+			Attempt:     attempts,
+			Err:         err,
+			Retry:       true,
+			Exhausted:   true,
+		})
+	}
+	return ctx, nil, &RetriesExhaustedError{Attempts: attempts, Err: err}
+}
+
+// Integration returns the integration notified by the stage.
+func (r RetryStage) Integration() Integration {
+	return r.integration
+}
+
+// Exec implements the Stage interface.
+func (r RetryStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	var sent []*types.Alert
+
+	// If we shouldn't send notifications for resolved alerts, but there are only
+	// resolved alerts, report them all as successfully notified (we still want the
+	// notification log to log them for the next run of DedupStage).
+	if !r.integration.conf.SendResolved() {
+		firing, ok := notify.FiringAlerts(ctx)
+		if !ok {
+			return ctx, nil, fmt.Errorf("firing alerts missing")
+		}
+		if len(firing) == 0 {
+			return ctx, alerts, nil
+		}
+		for _, a := range alerts {
+			if a.Status() != model.AlertResolved {
+				sent = append(sent, a)
+			}
+		}
+	} else {
+		sent = alerts
+	}
+
+	// The notifications use their own context, so that the retry timeout
+	// does not cancel the context handed to the following stages.
+	nctx := ctx
+	if r.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		nctx, cancel = context.WithTimeout(ctx, time.Duration(r.policy.Timeout))
+		defer cancel()
+	}
+
+	var (
+		i    = 0
+		b    = backoff.NewExponentialBackOff()
+		iErr error
+	)
+	b.InitialInterval = time.Duration(r.policy.MinBackoff)
+	b.MaxInterval = time.Duration(r.policy.MaxBackoff)
+	b.RandomizationFactor = r.policy.Jitter
+	// The context bounds the retries.
+	b.MaxElapsedTime = 0
+	tick := backoff.NewTicker(b)
+	defer tick.Stop()
+
+	for {
+		i++
+		// Always check the context first to not notify again.
+		select {
+		case <-nctx.Done():
+			if iErr != nil {
+				return r.exhausted(ctx, sent, i-1, iErr)
+			}
+
+			return ctx, nil, nctx.Err()
+		default:
+		}
+
+		select {
+		case <-tick.C:
+			retry, err := r.integration.Notify(withAttempt(nctx, i), sent...)
+			if err != nil {
+				_ = level.Debug(l).Log("msg", "Notify attempt failed", "attempt", i, "integration", r.integration.name, "receiver", r.groupName, "err", err)
+				if !retry {
+					return ctx, alerts, fmt.Errorf("cancelling notify retry for %q due to unrecoverable error: %s", r.integration.name, err)
+				}
+
+				if r.policy.MaxAttempts > 0 && i >= r.policy.MaxAttempts {
+					return r.exhausted(ctx, sent, i, err)
+				}
+
+				// Save this error to be able to return the last seen error by an
+				// integration upon context timeout.
+				iErr = err
+			} else {
+				return ctx, alerts, nil
+			}
+		case <-nctx.Done():
+			if iErr != nil {
+				return r.exhausted(ctx, sent, i-1, iErr)
+			}
+
+			return ctx, nil, nctx.Err()
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/prometheus/alertmanager/types"
+)
+
+// A NotificationAttempt is an attempt of an integration to notify alerts,
+// or the last attempt of a notification whose retries were exhausted.
+type NotificationAttempt struct {
+	Integration Integration
+	Alerts      []*types.Alert
+	// Attempt is the number of the attempt in its retry stage, 0 if the
+	// integration is not notified by a retry stage.
+	Attempt int
+	Err     error
+	Retry   bool
+	// Exhausted is set once the retry stage gives up on the notification.
+	Exhausted bool
+}
+
+// A NotificationObserver is told about the notifications of a pipeline
+// executed with a context it was added to. The observers are called
+// synchronously by the stages and must not block.
+type NotificationObserver interface {
+	// Notified is called after every attempt of an integration, and once
+	// more when the retries of a notification are exhausted.
+	Notified(ctx context.Context, n NotificationAttempt)
+	// Suppressed is called with the alerts of a receiver removed by a
+	// maintenance window.
+	Suppressed(ctx context.Context, window string, alerts []*types.Alert)
+}
+
+type notificationObserverKey struct{}
+
+// WithNotificationObserver returns a context reporting the notifications
+// to o.
+func WithNotificationObserver(ctx context.Context, o NotificationObserver) context.Context {
+	return context.WithValue(ctx, notificationObserverKey{}, o)
+}
+
+func notificationObserver(ctx context.Context) (NotificationObserver, bool) {
+	o, ok := ctx.Value(notificationObserverKey{}).(NotificationObserver)
+	return o, ok
+}
+
+type attemptKey struct{}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+func attemptNumber(ctx context.Context) int {
+	n, _ := ctx.Value(attemptKey{}).(int)
+	return n
+}
@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// opsGenieMaxMessageLen is the length OpsGenie truncates messages to.
+const opsGenieMaxMessageLen = 130
+
+// OpsGenie implements a Notifier for OpsGenie, like the upstream notifier
+// but sending with newHTTPClient, which enforces the egress policy.
+type OpsGenie struct {
+	conf   *config.OpsGenieConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewOpsGenie returns a new OpsGenie notifier.
+func NewOpsGenie(c *config.OpsGenieConfig, t *template.Template, l log.Logger) *OpsGenie {
+	return &OpsGenie{conf: c, tmpl: t, logger: l}
+}
+
+type opsGenieCreateMessage struct {
+	Alias       string              `json:"alias"`
+	Message     string              `json:"message"`
+	Description string              `json:"description,omitempty"`
+	Details     map[string]string   `json:"details"`
+	Source      string              `json:"source"`
+	Teams       []map[string]string `json:"teams,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Note        string              `json:"note,omitempty"`
+	Priority    string              `json:"priority,omitempty"`
+}
+
+type opsGenieCloseMessage struct {
+	Source string `json:"source"`
+}
+
+// Render implements the Renderer interface.
+func (n *OpsGenie) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	msg, _, _, err := n.message(ctx, as...)
+	return msg, err
+}
+
+// message returns the message creating the alert of the group, or closing
+// it once resolved, with its URL and the API key.
+func (n *OpsGenie) message(ctx context.Context, as ...*types.Alert) (interface{}, *url.URL, string, error) {
+	key, ok := notify.GroupKey(ctx)
+	if !ok {
+		return nil, nil, "", errors.New("group key missing")
+	}
+	var err error
+	var (
+		data   = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmpl   = tmplText(n.tmpl, data, &err)
+		apiURL = n.conf.APIURL.Copy()
+		alias  = hashKey(key)
+		msg    interface{}
+	)
+
+	details := make(map[string]string, len(n.conf.Details))
+	for k, v := range n.conf.Details {
+		details[k] = tmpl(v)
+	}
+
+	switch types.Alerts(as...).Status() {
+	case model.AlertResolved:
+		apiURL.Path += fmt.Sprintf("v2/alerts/%s/close", alias)
+		q := apiURL.Query()
+		q.Set("identifierType", "alias")
+		apiURL.RawQuery = q.Encode()
+		msg = &opsGenieCloseMessage{Source: tmpl(n.conf.Source)}
+	default:
+		message, truncated := truncate(tmpl(n.conf.Message), opsGenieMaxMessageLen)
+		if truncated {
+			_ = level.Debug(n.logger).Log("msg", "truncated message due to OpsGenie message limit", "truncated_message", message, "incident", key)
+		}
+		apiURL.Path += "v2/alerts"
+		var teams []map[string]string
+		for _, t := range safeSplit(tmpl(n.conf.Teams), ",") {
+			teams = append(teams, map[string]string{"name": t})
+		}
+		msg = &opsGenieCreateMessage{
+			Alias:       alias,
+			Message:     message,
+			Description: tmpl(n.conf.Description),
+			Details:     details,
+			Source:      tmpl(n.conf.Source),
+			Teams:       teams,
+			Tags:        safeSplit(tmpl(n.conf.Tags), ","),
+			Note:        tmpl(n.conf.Note),
+			Priority:    tmpl(n.conf.Priority),
+		}
+	}
+	apiKey := tmpl(string(n.conf.APIKey))
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "templating error")
+	}
+	return msg, apiURL.URL, apiKey, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *OpsGenie) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, apiURL, apiKey, err := n.message(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("POST", apiURL.String(), &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+	req.Header.Set("Authorization", "GenieKey "+apiKey)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	// https://docs.opsgenie.com/docs/response#section-response-codes
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
+
+// safeSplit splits s around sep, without the empty strings.
+func safeSplit(s string, sep string) []string {
+	var parts []string
+	for _, p := range strings.Split(strings.TrimSpace(s), sep) {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,338 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// pagerdutyV1URL is the URL of the v1 Events API, used with service keys.
+	pagerdutyV1URL = "https://events.pagerduty.com/generic/2010-04-15/create_event.json"
+	// pagerdutyChangeURL is the URL of change events, used unless the
+	// change_url is set.
+	pagerdutyChangeURL = "https://events.pagerduty.com/v2/change/enqueue"
+
+	// pagerdutyMaxSummaryLen is the maximum length of event summaries.
+	pagerdutyMaxSummaryLen = 1024
+)
+
+const (
+	pagerdutyEventTrigger = "trigger"
+	pagerdutyEventResolve = "resolve"
+)
+
+// PagerDuty implements a Notifier for PagerDuty notifications. It sends the
+// same events as the upstream notifier, with the templated dedup key, and
+// change events if configured.
+type PagerDuty struct {
+	conf   *PagerdutyConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewPagerDuty returns a new PagerDuty notifier.
+func NewPagerDuty(c *PagerdutyConfig, t *template.Template, l log.Logger) *PagerDuty {
+	return &PagerDuty{conf: c, tmpl: t, logger: l}
+}
+
+type pagerdutyMessage struct {
+	RoutingKey  string            `json:"routing_key,omitempty"`
+	ServiceKey  string            `json:"service_key,omitempty"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	IncidentKey string            `json:"incident_key,omitempty"`
+	EventType   string            `json:"event_type,omitempty"`
+	Description string            `json:"description,omitempty"`
+	EventAction string            `json:"event_action,omitempty"`
+	Payload     *pagerdutyPayload `json:"payload,omitempty"`
+	Client      string            `json:"client,omitempty"`
+	ClientURL   string            `json:"client_url,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Images      []pagerdutyImage  `json:"images,omitempty"`
+	Links       []pagerdutyLink   `json:"links,omitempty"`
+}
+
+type pagerdutyLink struct {
+	HRef string `json:"href"`
+	Text string `json:"text"`
+}
+
+type pagerdutyImage struct {
+	Src  string `json:"src"`
+	Alt  string `json:"alt"`
+	Text string `json:"text"`
+}
+
+type pagerdutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerdutyEvent is a message and the URL of the API it is sent to.
+type pagerdutyEvent struct {
+	url string
+	msg *pagerdutyMessage
+	// v1 is true for the v1 Events API, which is rate limited with 403.
+	v1 bool
+}
+
+// Render implements the Renderer interface.
+func (n *PagerDuty) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	events, err := n.events(ctx, as...)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 1 {
+		return events[0].msg, nil
+	}
+	msgs := make([]*pagerdutyMessage, 0, len(events))
+	for _, e := range events {
+		msgs = append(msgs, e.msg)
+	}
+	return msgs, nil
+}
+
+// Notify implements the Notifier interface.
+//
+// https://v2.developer.pagerduty.com/docs/events-api-v2
+func (n *PagerDuty) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	events, err := n.events(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// All events are sent again on retries. PagerDuty deduplicates alert
+	// events, but not change events.
+	for _, e := range events {
+		if retry, err := n.send(ctx, c, e); err != nil {
+			return retry, err
+		}
+		pagerdutyIncidents.record(ctx, n.logger, e)
+	}
+	return false, nil
+}
+
+// events returns the events to send for the alerts: an alert event, a change
+// event, or both for resolved groups with change_events set to resolved.
+func (n *PagerDuty) events(ctx context.Context, as ...*types.Alert) ([]pagerdutyEvent, error) {
+	groupKey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return nil, fmt.Errorf("group key missing")
+	}
+
+	var (
+		err      error
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+		resolved = types.Alerts(as...).Status() == model.AlertResolved
+	)
+
+	details := make(map[string]string, len(n.conf.Details))
+	for k, v := range n.conf.Details {
+		details[k] = tmplText(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to template PagerDuty details: %v", err)
+	}
+
+	var events []pagerdutyEvent
+	if n.conf.ChangeEvents != PagerdutyChangeEventsAll {
+		key, err := n.dedupKey(groupKey, tmplText)
+		if err != nil {
+			return nil, err
+		}
+		eventType := pagerdutyEventTrigger
+		if resolved {
+			eventType = pagerdutyEventResolve
+		}
+		_ = level.Debug(n.logger).Log("msg", "Notifying PagerDuty", "incident", groupKey, "eventType", eventType)
+
+		if n.conf.ServiceKey != "" {
+			events = append(events, n.eventV1(eventType, key, details, tmplText))
+		} else {
+			events = append(events, n.eventV2(eventType, key, details, tmplText))
+		}
+	}
+	if n.conf.ChangeEvents == PagerdutyChangeEventsAll || n.conf.ChangeEvents == PagerdutyChangeEventsResolved && resolved {
+		_ = level.Debug(n.logger).Log("msg", "Sending PagerDuty change event", "incident", groupKey)
+		events = append(events, n.changeEvent(details, tmplText))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to template PagerDuty message: %v", err)
+	}
+	return events, nil
+}
+
+// dedupKey returns the templated dedup key, or the hash of the group key if
+// no template is set.
+func (n *PagerDuty) dedupKey(groupKey string, tmplText func(string) string) (string, error) {
+	if n.conf.DedupKey == "" {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(groupKey))), nil
+	}
+	key := strings.TrimSpace(tmplText(n.conf.DedupKey))
+	if key == "" {
+		return "", fmt.Errorf("dedup_key template rendered an empty key")
+	}
+	if len(key) > pagerdutyMaxDedupKeyLen {
+		return "", fmt.Errorf("dedup_key is longer than %d characters", pagerdutyMaxDedupKeyLen)
+	}
+	return key, nil
+}
+
+func (n *PagerDuty) eventV1(eventType, key string, details map[string]string, tmplText func(string) string) pagerdutyEvent {
+	msg := &pagerdutyMessage{
+		ServiceKey:  tmplText(string(n.conf.ServiceKey)),
+		EventType:   eventType,
+		IncidentKey: key,
+		Description: tmplText(n.conf.Description),
+		Details:     details,
+	}
+	if eventType == pagerdutyEventTrigger {
+		msg.Client = tmplText(n.conf.Client)
+		msg.ClientURL = tmplText(n.conf.ClientURL)
+	}
+	return pagerdutyEvent{url: pagerdutyV1URL, msg: msg, v1: true}
+}
+
+func (n *PagerDuty) eventV2(eventType, key string, details map[string]string, tmplText func(string) string) pagerdutyEvent {
+	severity := n.conf.Severity
+	if severity == "" {
+		severity = "error"
+	}
+	summary, _ := truncate(tmplText(n.conf.Description), pagerdutyMaxSummaryLen)
+
+	msg := &pagerdutyMessage{
+		Client:      tmplText(n.conf.Client),
+		ClientURL:   tmplText(n.conf.ClientURL),
+		RoutingKey:  tmplText(string(n.conf.RoutingKey)),
+		EventAction: eventType,
+		DedupKey:    key,
+		Images:      n.images(tmplText),
+		Links:       n.links(tmplText),
+		Payload: &pagerdutyPayload{
+			Summary:       summary,
+			Source:        tmplText(n.conf.Client),
+			Severity:      tmplText(severity),
+			CustomDetails: details,
+			Class:         tmplText(n.conf.Class),
+			Component:     tmplText(n.conf.Component),
+			Group:         tmplText(n.conf.Group),
+		},
+	}
+	return pagerdutyEvent{url: n.conf.URL.String(), msg: msg}
+}
+
+// changeEvent returns a change event, which is recorded on the service
+// without opening an incident.
+//
+// https://developer.pagerduty.com/docs/events-api-v2/send-change-events/
+func (n *PagerDuty) changeEvent(details map[string]string, tmplText func(string) string) pagerdutyEvent {
+	summary, _ := truncate(tmplText(n.conf.Description), pagerdutyMaxSummaryLen)
+	msg := &pagerdutyMessage{
+		RoutingKey: tmplText(string(n.conf.RoutingKey)),
+		Links:      n.links(tmplText),
+		Payload: &pagerdutyPayload{
+			Summary:       summary,
+			Source:        tmplText(n.conf.Client),
+			CustomDetails: details,
+		},
+	}
+	u := pagerdutyChangeURL
+	if n.conf.ChangeURL != nil {
+		u = n.conf.ChangeURL.String()
+	}
+	return pagerdutyEvent{url: u, msg: msg}
+}
+
+func (n *PagerDuty) images(tmplText func(string) string) []pagerdutyImage {
+	images := make([]pagerdutyImage, 0, len(n.conf.Images))
+	for _, item := range n.conf.Images {
+		images = append(images, pagerdutyImage{
+			Src:  tmplText(item.Src),
+			Alt:  tmplText(item.Alt),
+			Text: tmplText(item.Text),
+		})
+	}
+	return images
+}
+
+func (n *PagerDuty) links(tmplText func(string) string) []pagerdutyLink {
+	links := make([]pagerdutyLink, 0, len(n.conf.Links))
+	for _, item := range n.conf.Links {
+		links = append(links, pagerdutyLink{
+			HRef: tmplText(item.HRef),
+			Text: tmplText(item.Text),
+		})
+	}
+	return links
+}
+
+func (n *PagerDuty) send(ctx context.Context, c *http.Client, e pagerdutyEvent) (bool, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(e.msg); err != nil {
+		return false, fmt.Errorf("failed to encode PagerDuty message: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", e.url, &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, fmt.Errorf("failed to post message to PagerDuty: %v", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	// Retrying can solve the issue on rate limiting and 5xx response codes.
+	// The v1 API rate limits with 403, the v2 API with 429.
+	// https://v2.developer.pagerduty.com/docs/events-api-v2#api-response-codes--retry-logic
+	statusCode := resp.StatusCode
+	if statusCode/100 == 2 {
+		return false, nil
+	}
+	rateLimited := statusCode == http.StatusTooManyRequests
+	if e.v1 {
+		rateLimited = statusCode == http.StatusForbidden
+	}
+	return rateLimited || statusCode/100 == 5, pagerdutyErr(statusCode, resp.Body)
+}
+
+func pagerdutyErr(status int, body io.Reader) error {
+	type pagerdutyResponse struct {
+		Status  string   `json:"status"`
+		Message string   `json:"message"`
+		Errors  []string `json:"errors"`
+	}
+	if status == http.StatusBadRequest && body != nil {
+		var r pagerdutyResponse
+		if err := json.NewDecoder(body).Decode(&r); err == nil {
+			return fmt.Errorf("%s: %s", r.Message, strings.Join(r.Errors, ","))
+		}
+	}
+	return fmt.Errorf("unexpected status code: %v", status)
+}
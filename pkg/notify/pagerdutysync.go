@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// pagerdutyIncidentTTL is how long the alert group of a dedup key is
+	// remembered after its last trigger event.
+	pagerdutyIncidentTTL = 7 * 24 * time.Hour
+	// pagerdutySignatureHeader holds the signatures of PagerDuty webhooks.
+	pagerdutySignatureHeader = "X-PagerDuty-Signature"
+)
+
+// Event types of PagerDuty webhooks which are reflected on alert groups.
+const (
+	PagerdutyIncidentAcknowledged = "incident.acknowledged"
+	PagerdutyIncidentResolved     = "incident.resolved"
+)
+
+// DefaultPagerdutyWebhook defines default values for PagerDuty webhooks.
+var DefaultPagerdutyWebhook = PagerdutyWebhook{
+	ResolveSilence: model.Duration(time.Hour),
+}
+
+// PagerdutyWebhook configures the handling of the webhooks of PagerDuty
+// incidents, which are reflected on the alert groups they were triggered
+// by. Acknowledged incidents acknowledge the alert group, which stops its
+// escalation. Resolved incidents silence the alert group for
+// ResolveSilence, so that its repeat notifications do not trigger a new
+// incident.
+type PagerdutyWebhook struct {
+	// SigningSecret is the secret of the webhook subscription, which signs
+	// the webhooks.
+	SigningSecret  config.Secret  `yaml:"signing_secret" json:"signing_secret"`
+	ResolveSilence model.Duration `yaml:"resolve_silence,omitempty" json:"resolve_silence,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *PagerdutyWebhook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultPagerdutyWebhook
+	type plain PagerdutyWebhook
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.SigningSecret == "" {
+		return errors.New("pagerduty_webhook: missing signing_secret")
+	}
+	if c.ResolveSilence <= 0 {
+		return errors.New("pagerduty_webhook: resolve_silence must be positive")
+	}
+	return nil
+}
+
+// PagerdutyIncident is the alert group which triggered a PagerDuty
+// incident.
+type PagerdutyIncident struct {
+	// Receiver is the receiver of the route of the alert group.
+	Receiver    string
+	GroupKey    string
+	GroupLabels model.LabelSet
+
+	expires time.Time
+}
+
+// pagerdutyIncidentStore maps the dedup keys of the trigger events sent by
+// the tenants to their alert groups. It is kept across config reloads,
+// which rebuild the notifiers. Only the leader sends notifications, and the
+// webhooks are handled by the leader.
+type pagerdutyIncidentStore struct {
+	mtx       sync.Mutex
+	incidents map[string]PagerdutyIncident
+}
+
+var pagerdutyIncidents = &pagerdutyIncidentStore{incidents: map[string]PagerdutyIncident{}}
+
+// pagerdutyIncidentKey returns the key of an incident of a tenant, as dedup
+// keys are not unique across tenants.
+func pagerdutyIncidentKey(tenant, dedupKey string) string {
+	return tenant + "\x00" + dedupKey
+}
+
+// LookupPagerdutyIncident returns the alert group of the tenant which
+// triggered the incident of the dedup key.
+func LookupPagerdutyIncident(tenant, dedupKey string) (PagerdutyIncident, bool) {
+	return pagerdutyIncidents.get(pagerdutyIncidentKey(tenant, dedupKey))
+}
+
+// record remembers the alert group of the trigger events sent, and forgets
+// it once resolved.
+func (s *pagerdutyIncidentStore) record(ctx context.Context, l log.Logger, e pagerdutyEvent) {
+	key := e.msg.DedupKey
+	action := e.msg.EventAction
+	if e.v1 {
+		key, action = e.msg.IncidentKey, e.msg.EventType
+	}
+	if key == "" {
+		return
+	}
+	tenant, _ := TenantID(ctx)
+	key = pagerdutyIncidentKey(tenant, key)
+	if action == pagerdutyEventResolve {
+		s.delete(key)
+		return
+	}
+	groupKey, _ := notify.GroupKey(ctx)
+	s.set(key, PagerdutyIncident{
+		Receiver:    routeReceiverName(ctx, l),
+		GroupKey:    groupKey,
+		GroupLabels: groupLabels(ctx, l),
+	})
+}
+
+func (s *pagerdutyIncidentStore) get(key string) (PagerdutyIncident, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	inc, ok := s.incidents[key]
+	if ok && time.Now().After(inc.expires) {
+		delete(s.incidents, key)
+		return PagerdutyIncident{}, false
+	}
+	return inc, ok
+}
+
+func (s *pagerdutyIncidentStore) set(key string, inc PagerdutyIncident) {
+	now := time.Now()
+	inc.expires = now.Add(pagerdutyIncidentTTL)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for k, i := range s.incidents {
+		if now.After(i.expires) {
+			delete(s.incidents, k)
+		}
+	}
+	s.incidents[key] = inc
+}
+
+func (s *pagerdutyIncidentStore) delete(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.incidents, key)
+}
+
+// VerifyPagerdutyWebhook checks the signatures of a PagerDuty webhook, made
+// with the secret of the webhook subscription over the body. One of the
+// signatures must match, as there are several while the secret is rotated.
+//
+// https://developer.pagerduty.com/docs/webhooks/webhook-signatures/
+func VerifyPagerdutyWebhook(secret string, h http.Header, body []byte) error {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	want := []byte("v1=" + hex.EncodeToString(mac.Sum(nil)))
+	for _, sig := range strings.Split(h.Get(pagerdutySignatureHeader), ",") {
+		if hmac.Equal(want, []byte(strings.TrimSpace(sig))) {
+			return nil
+		}
+	}
+	return errors.New("invalid pagerduty webhook signature")
+}
+
+// PagerdutyWebhookEvent is an event of a PagerDuty webhook on an incident.
+type PagerdutyWebhookEvent struct {
+	// Type is the type of event, like incident.acknowledged.
+	Type string
+	// IncidentKey is the dedup key of the incident.
+	IncidentKey string
+	// Agent describes who caused the event.
+	Agent string
+}
+
+type pagerdutyWebhookPayload struct {
+	Event struct {
+		EventType    string `json:"event_type"`
+		ResourceType string `json:"resource_type"`
+		Agent        *struct {
+			Summary string `json:"summary"`
+		} `json:"agent"`
+		Data struct {
+			IncidentKey string `json:"incident_key"`
+		} `json:"data"`
+	} `json:"event"`
+}
+
+// ParsePagerdutyWebhook parses the body of a v3 PagerDuty webhook.
+func ParsePagerdutyWebhook(body []byte) (*PagerdutyWebhookEvent, error) {
+	var p pagerdutyWebhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, errors.Wrap(err, "invalid pagerduty webhook")
+	}
+	e := &PagerdutyWebhookEvent{Type: p.Event.EventType, Agent: "pagerduty"}
+	if p.Event.ResourceType == "incident" {
+		e.IncidentKey = p.Event.Data.IncidentKey
+	}
+	if p.Event.Agent != nil && p.Event.Agent.Summary != "" {
+		e.Agent = p.Event.Agent.Summary
+	}
+	return e, nil
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/common/model"
+)
+
+func TestPagerdutyIncidents(t *testing.T) {
+	ctx := WithTenantID(context.Background(), "tenant")
+	ctx = notify.WithGroupKey(ctx, "{}:{alertname=\"a\"}")
+	ctx = notify.WithGroupLabels(ctx, model.LabelSet{"alertname": "a"})
+	ctx = notify.WithReceiverName(ctx, "team")
+
+	trigger := pagerdutyEvent{msg: &pagerdutyMessage{DedupKey: "key", EventAction: pagerdutyEventTrigger}}
+	pagerdutyIncidents.record(ctx, log.NewNopLogger(), trigger)
+	inc, ok := LookupPagerdutyIncident("tenant", "key")
+	if !ok || inc.Receiver != "team" || inc.GroupKey != "{}:{alertname=\"a\"}" || inc.GroupLabels["alertname"] != "a" {
+		t.Fatalf("unexpected incident: %+v, %v", inc, ok)
+	}
+	if _, ok := LookupPagerdutyIncident("other", "key"); ok {
+		t.Fatal("incident of another tenant returned")
+	}
+
+	resolve := pagerdutyEvent{msg: &pagerdutyMessage{IncidentKey: "key", EventType: pagerdutyEventResolve}, v1: true}
+	pagerdutyIncidents.record(ctx, log.NewNopLogger(), resolve)
+	if _, ok := LookupPagerdutyIncident("tenant", "key"); ok {
+		t.Fatal("resolved incident returned")
+	}
+}
+
+func TestVerifyPagerdutyWebhook(t *testing.T) {
+	body := []byte(`{"event":{"event_type":"incident.acknowledged","resource_type":"incident","agent":{"summary":"Alice"},"data":{"incident_key":"key"}}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	h := http.Header{}
+	h.Set(pagerdutySignatureHeader, "v1=00, v1="+hex.EncodeToString(mac.Sum(nil)))
+
+	if err := VerifyPagerdutyWebhook("secret", h, body); err != nil {
+		t.Fatalf("valid webhook rejected: %v", err)
+	}
+	if err := VerifyPagerdutyWebhook("other", h, body); err == nil {
+		t.Fatal("webhook with invalid signature accepted")
+	}
+
+	e, err := ParsePagerdutyWebhook(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != PagerdutyIncidentAcknowledged || e.IncidentKey != "key" || e.Agent != "Alice" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Actions of a relabel config.
+const (
+	RelabelReplace   = "replace"
+	RelabelLabelDrop = "labeldrop"
+)
+
+// DefaultRelabelConfig defines default values for relabel configs.
+var DefaultRelabelConfig = RelabelConfig{
+	Separator:   ";",
+	Regex:       mustNewRegexp("(.*)"),
+	Replacement: "$1",
+	Action:      RelabelReplace,
+}
+
+func mustNewRegexp(s string) config.Regexp {
+	var re config.Regexp
+	if err := yaml.Unmarshal([]byte(s), &re); err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// AlertPreprocessing rewrites the labels of the alerts of a user before
+// they are stored and routed, so that alerts from heterogeneous sources can
+// be normalized without changing the alerting rules. The relabel configs
+// are applied first, then the enrichments.
+type AlertPreprocessing struct {
+	RelabelConfigs []*RelabelConfig `yaml:"relabel_configs,omitempty" json:"relabel_configs,omitempty"`
+	Enrichments    []*Enrichment    `yaml:"enrichments,omitempty" json:"enrichments,omitempty"`
+}
+
+// RelabelConfig rewrites the labels of alerts like the relabel configs of
+// Prometheus. With the replace action, the values of the source labels are
+// joined by the separator and matched against the anchored regex. If they
+// match, the target label is set to the replacement, with the capture
+// groups expanded, or removed if the replacement expands to an empty
+// string. With the labeldrop action, the labels whose names match the regex
+// are removed.
+type RelabelConfig struct {
+	SourceLabels model.LabelNames `yaml:"source_labels,flow,omitempty" json:"source_labels,omitempty"`
+	Separator    string           `yaml:"separator,omitempty" json:"separator,omitempty"`
+	Regex        config.Regexp    `yaml:"regex,omitempty" json:"regex,omitempty"`
+	TargetLabel  string           `yaml:"target_label,omitempty" json:"target_label,omitempty"`
+	Replacement  string           `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	Action       string           `yaml:"action,omitempty" json:"action,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	switch c.Action {
+	case RelabelReplace:
+		if !model.LabelName(c.TargetLabel).IsValid() {
+			return errors.Errorf("relabel config: invalid target_label %q", c.TargetLabel)
+		}
+	case RelabelLabelDrop:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" {
+			return errors.New("relabel config: source_labels and target_label are not allowed with the labeldrop action")
+		}
+	default:
+		return errors.Errorf("relabel config: unknown action %q, must be one of %s, %s", c.Action, RelabelReplace, RelabelLabelDrop)
+	}
+	return nil
+}
+
+// Enrichment adds static labels and annotations to the alerts matching
+// all of Match and MatchRE. The labels and annotations an alert already has
+// are kept.
+type Enrichment struct {
+	Match       map[string]string        `yaml:"match,omitempty" json:"match,omitempty"`
+	MatchRE     map[string]config.Regexp `yaml:"match_re,omitempty" json:"match_re,omitempty"`
+	Labels      model.LabelSet           `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations model.LabelSet           `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (e *Enrichment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Enrichment
+	if err := unmarshal((*plain)(e)); err != nil {
+		return err
+	}
+	if len(e.Labels) == 0 && len(e.Annotations) == 0 {
+		return errors.New("enrichment: labels or annotations must be set")
+	}
+	if err := e.Labels.Validate(); err != nil {
+		return errors.Wrap(err, "enrichment")
+	}
+	return nil
+}
+
+func (e *Enrichment) matches(lset model.LabelSet) bool {
+	return matchLabels(e.Match, e.MatchRE, lset)
+}
+
+// matchLabels returns true if lset matches all of match and matchRE.
+func matchLabels(match map[string]string, matchRE map[string]config.Regexp, lset model.LabelSet) bool {
+	for ln, v := range match {
+		if string(lset[model.LabelName(ln)]) != v {
+			return false
+		}
+	}
+	for ln, re := range matchRE {
+		if !re.MatchString(string(lset[model.LabelName(ln)])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply rewrites the labels and annotations of a in place. It returns
+// false if a has no labels left, which can not be stored.
+func (p *AlertPreprocessing) Apply(a *types.Alert) bool {
+	if p == nil {
+		return true
+	}
+	for _, c := range p.RelabelConfigs {
+		a.Labels = c.apply(a.Labels)
+	}
+	for _, e := range p.Enrichments {
+		if !e.matches(a.Labels) {
+			continue
+		}
+		a.Labels = mergeLabels(a.Labels, e.Labels)
+		a.Annotations = mergeLabels(a.Annotations, e.Annotations)
+	}
+	return len(a.Labels) > 0
+}
+
+// mergeLabels returns lset with the labels of add it does not have.
+func mergeLabels(lset, add model.LabelSet) model.LabelSet {
+	if len(add) == 0 {
+		return lset
+	}
+	if lset == nil {
+		lset = model.LabelSet{}
+	}
+	for ln, lv := range add {
+		if _, ok := lset[ln]; !ok {
+			lset[ln] = lv
+		}
+	}
+	return lset
+}
+
+func (c *RelabelConfig) apply(lset model.LabelSet) model.LabelSet {
+	switch c.Action {
+	case RelabelLabelDrop:
+		for ln := range lset {
+			if c.Regex.MatchString(string(ln)) {
+				delete(lset, ln)
+			}
+		}
+	case RelabelReplace:
+		values := make([]string, 0, len(c.SourceLabels))
+		for _, ln := range c.SourceLabels {
+			values = append(values, string(lset[ln]))
+		}
+		val := strings.Join(values, c.Separator)
+		indexes := c.Regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		res := c.Regex.ExpandString([]byte{}, c.Replacement, val, indexes)
+		if lset == nil {
+			lset = model.LabelSet{}
+		}
+		if len(res) == 0 {
+			delete(lset, model.LabelName(c.TargetLabel))
+		} else {
+			lset[model.LabelName(c.TargetLabel)] = model.LabelValue(res)
+		}
+	}
+	return lset
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+func TestAlertPreprocessing(t *testing.T) {
+	conf, err := LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+alert_preprocessing:
+  relabel_configs:
+  - source_labels: [instance]
+    regex: '(.*):\d+'
+    target_label: host
+  - source_labels: [env]
+    regex: prd
+    target_label: env
+    replacement: production
+  - regex: 'prometheus_.*'
+    action: labeldrop
+  enrichments:
+  - match_re:
+      service: db|cache
+    labels:
+      team: storage
+    annotations:
+      runbook_url: https://runbooks/storage
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		labels      model.LabelSet
+		want        model.LabelSet
+		annotations model.LabelSet
+	}{
+		{
+			name:   "rewritten",
+			labels: model.LabelSet{"instance": "db-1:9100", "env": "prd", "prometheus_replica": "a"},
+			want:   model.LabelSet{"instance": "db-1:9100", "host": "db-1", "env": "production"},
+		},
+		{
+			name:        "enriched",
+			labels:      model.LabelSet{"service": "db", "env": "dev"},
+			want:        model.LabelSet{"service": "db", "env": "dev", "team": "storage"},
+			annotations: model.LabelSet{"runbook_url": "https://runbooks/storage"},
+		},
+		{
+			name:        "own labels kept",
+			labels:      model.LabelSet{"service": "cache", "team": "web"},
+			want:        model.LabelSet{"service": "cache", "team": "web"},
+			annotations: model.LabelSet{"runbook_url": "https://runbooks/storage"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &types.Alert{Alert: model.Alert{Labels: tc.labels}}
+			if !conf.AlertPreprocessing.Apply(a) {
+				t.Fatal("alert dropped")
+			}
+			if !a.Labels.Equal(tc.want) {
+				t.Errorf("got labels %v, want %v", a.Labels, tc.want)
+			}
+			if len(tc.annotations) > 0 && !a.Annotations.Equal(tc.annotations) {
+				t.Errorf("got annotations %v, want %v", a.Annotations, tc.annotations)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+alert_preprocessing:
+  relabel_configs:
+  - action: labelmap
+`); err == nil {
+		t.Error("unknown relabel action accepted")
+	}
+}
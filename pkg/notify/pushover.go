@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+const (
+	pushoverAPIURL = "https://api.pushover.net/1/messages.json"
+
+	// The lengths Pushover truncates the fields of messages to.
+	pushoverMaxTitleLen   = 250
+	pushoverMaxMessageLen = 1024
+	pushoverMaxURLLen     = 512
+)
+
+// Pushover implements a Notifier for Pushover, like the upstream notifier
+// but sending with newHTTPClient, which enforces the egress policy.
+type Pushover struct {
+	conf   *config.PushoverConfig
+	tmpl   *template.Template
+	logger log.Logger
+	apiURL string
+}
+
+// NewPushover returns a new Pushover notifier.
+func NewPushover(c *config.PushoverConfig, t *template.Template, l log.Logger) *Pushover {
+	return &Pushover{conf: c, tmpl: t, logger: l, apiURL: pushoverAPIURL}
+}
+
+// Render implements the Renderer interface. The token and the user key
+// are left out of the parameters.
+func (n *Pushover) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	params, err := n.params(ctx, as...)
+	if err != nil {
+		return nil, err
+	}
+	params.Del("token")
+	params.Del("user")
+	return params, nil
+}
+
+func (n *Pushover) params(ctx context.Context, as ...*types.Alert) (url.Values, error) {
+	key, ok := notify.GroupKey(ctx)
+	if !ok {
+		return nil, errors.New("group key missing")
+	}
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmpl     = tmplText(n.tmpl, data, &err)
+		tmplHTML = tmplHTML(n.tmpl, data, &err)
+		params   = url.Values{}
+		message  string
+	)
+	params.Add("token", tmpl(string(n.conf.Token)))
+	params.Add("user", tmpl(string(n.conf.UserKey)))
+
+	title, truncated := truncate(tmpl(n.conf.Title), pushoverMaxTitleLen)
+	if truncated {
+		_ = level.Debug(n.logger).Log("msg", "Truncated title due to Pushover title limit", "truncated_title", title, "incident", key)
+	}
+	params.Add("title", title)
+
+	if n.conf.HTML {
+		params.Add("html", "1")
+		message = tmplHTML(n.conf.Message)
+	} else {
+		message = tmpl(n.conf.Message)
+	}
+	message, truncated = truncate(message, pushoverMaxMessageLen)
+	if truncated {
+		_ = level.Debug(n.logger).Log("msg", "Truncated message due to Pushover message limit", "truncated_message", message, "incident", key)
+	}
+	message = strings.TrimSpace(message)
+	if message == "" {
+		// Pushover rejects empty messages.
+		message = "(no details)"
+	}
+	params.Add("message", message)
+
+	supplementaryURL, truncated := truncate(tmpl(n.conf.URL), pushoverMaxURLLen)
+	if truncated {
+		_ = level.Debug(n.logger).Log("msg", "Truncated URL due to Pushover url limit", "truncated_url", supplementaryURL, "incident", key)
+	}
+	params.Add("url", supplementaryURL)
+	params.Add("url_title", tmpl(n.conf.URLTitle))
+	params.Add("priority", tmpl(n.conf.Priority))
+	params.Add("retry", strconv.FormatInt(int64(time.Duration(n.conf.Retry).Seconds()), 10))
+	params.Add("expire", strconv.FormatInt(int64(time.Duration(n.conf.Expire).Seconds()), 10))
+	params.Add("sound", tmpl(n.conf.Sound))
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Pushover) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	params, err := n.params(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	u, err := url.Parse(n.apiURL)
+	if err != nil {
+		return false, err
+	}
+	u.RawQuery = params.Encode()
+
+	// The URL holds the token, it is never logged.
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return true, redactURL(err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	// https://pushover.net/api#response only documents 2xx and 4xx, so
+	// only 5xx are assumed to be recoverable.
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode/100 == 5, errors.Errorf("unexpected status code %v: %s", resp.StatusCode, readErrorBody(resp.Body))
+	}
+	return false, nil
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+)
+
+// RecurringSilence silences the matching alerts during the occurrences of
+// a cron schedule or a recurrence rule, like a weekly maintenance every
+// Sunday from 02:00 to 04:00. Unlike a maintenance window, whose
+// notifications are suppressed in the pipeline, its occurrences become
+// regular silences shortly before they start, so that they show up and can
+// be expired like any other silence.
+type RecurringSilence struct {
+	Name string `yaml:"name" json:"name"`
+
+	Schedule string         `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	RRule    string         `yaml:"rrule,omitempty" json:"rrule,omitempty"`
+	Duration model.Duration `yaml:"duration" json:"duration"`
+	TimeZone string         `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+
+	Match   map[string]string        `yaml:"match,omitempty" json:"match,omitempty"`
+	MatchRE map[string]config.Regexp `yaml:"match_re,omitempty" json:"match_re,omitempty"`
+	Comment string                   `yaml:"comment,omitempty" json:"comment,omitempty"`
+
+	cron *cronSchedule
+	loc  *time.Location
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *RecurringSilence) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RecurringSilence
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	return s.init()
+}
+
+// MarshalJSON implements the json.Marshaler interface. The duration is
+// formatted the same way as in the YAML configuration.
+func (s RecurringSilence) MarshalJSON() ([]byte, error) {
+	type plain RecurringSilence
+	return json.Marshal(struct {
+		plain
+		Duration string `json:"duration"`
+	}{plain: plain(s), Duration: s.Duration.String()})
+}
+
+func (s *RecurringSilence) init() error {
+	switch {
+	case s.Name == "":
+		return errors.New("missing name in recurring silence")
+	case s.Schedule != "" && s.RRule != "":
+		return errors.Errorf("recurring silence %q: at most one of schedule & rrule must be configured", s.Name)
+	case s.Schedule == "" && s.RRule == "":
+		return errors.Errorf("recurring silence %q: missing schedule or rrule", s.Name)
+	case s.Duration <= 0:
+		return errors.Errorf("recurring silence %q: missing duration", s.Name)
+	case len(s.Match) == 0 && len(s.MatchRE) == 0:
+		return errors.Errorf("recurring silence %q: match or match_re must be set", s.Name)
+	}
+	for ln := range s.Match {
+		if !model.LabelName(ln).IsValid() {
+			return errors.Errorf("recurring silence %q: invalid label name %q", s.Name, ln)
+		}
+	}
+	for ln := range s.MatchRE {
+		if !model.LabelName(ln).IsValid() {
+			return errors.Errorf("recurring silence %q: invalid label name %q", s.Name, ln)
+		}
+	}
+
+	s.loc = time.UTC
+	if s.TimeZone != "" {
+		loc, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return errors.Wrapf(err, "recurring silence %q", s.Name)
+		}
+		s.loc = loc
+	}
+
+	var err error
+	if s.Schedule != "" {
+		s.cron, err = parseCron(s.Schedule)
+	} else {
+		s.cron, err = parseRRule(s.RRule)
+	}
+	return errors.Wrapf(err, "recurring silence %q", s.Name)
+}
+
+// Occurrences returns the starts of the occurrences which end after from
+// and start no later than to, earliest first.
+func (s *RecurringSilence) Occurrences(from, to time.Time) []time.Time {
+	d := time.Duration(s.Duration)
+	limit := from.Add(-d)
+	var starts []time.Time
+	for t := to.In(s.loc); ; {
+		start, ok := s.cron.prev(t, limit)
+		if !ok || !start.Add(d).After(from) {
+			break
+		}
+		starts = append([]time.Time{start}, starts...)
+		t = start.Add(-time.Minute)
+	}
+	return starts
+}
@@ -0,0 +1,418 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	commoncfg "github.com/prometheus/common/config"
+	"gopkg.in/yaml.v2"
+)
+
+// NotifierConfig is the config of a notifier of an integration.
+type NotifierConfig interface {
+	SendResolved() bool
+}
+
+// An IntegrationType builds the notifiers of one kind of integration, like
+// webhook or slack, from the configs of a receiver. The built-in types are
+// configured with the fields of ReceiverExtension and the upstream
+// receiver. Other types are added with RegisterIntegration.
+type IntegrationType struct {
+	// Name of the integration, used in metrics and traces. Receivers
+	// configure registered types with the "<name>_configs" field.
+	Name string
+	// NewConfig returns a config holding the defaults, which each entry of
+	// the "<name>_configs" field is unmarshalled into. The config can check
+	// itself by implementing yaml.Unmarshaler. Only used by registered
+	// types.
+	NewConfig func() NotifierConfig
+	// SetGlobalDefaults fills a config with the values of the global
+	// configuration. Optional.
+	SetGlobalDefaults func(NotifierConfig, *config.GlobalConfig) error
+	// Configs returns the configs of the integration in a receiver.
+	// Defaults to the configs of the "<name>_configs" field of registered
+	// types.
+	Configs func(*Receiver) []NotifierConfig
+	// New builds the notifier of a config.
+	New func(NotifierConfig, *template.Template, log.Logger) notify.Notifier
+}
+
+func (t *IntegrationType) key() string {
+	return t.Name + "_configs"
+}
+
+// integrationTypes are the integrations, in the order their notifiers are
+// built.
+var (
+	integrationTypesMtx sync.RWMutex
+	integrationTypes    = builtinIntegrations()
+)
+
+// RegisterIntegration adds an integration type, so that forks can add
+// receivers without patching this package. It is meant to be called from
+// the init function of the package implementing the integration, and
+// panics if the type is incomplete or its name is taken.
+func RegisterIntegration(t *IntegrationType) {
+	if t.Name == "" || t.NewConfig == nil || t.New == nil {
+		panic("notify: integration type requires a name, NewConfig and New")
+	}
+	integrationTypesMtx.Lock()
+	defer integrationTypesMtx.Unlock()
+	if receiverKeyTaken(t.key()) {
+		panic(fmt.Sprintf("notify: integration %q is already registered", t.Name))
+	}
+	for _, it := range integrationTypes {
+		if it.Name == t.Name {
+			panic(fmt.Sprintf("notify: integration %q is already registered", t.Name))
+		}
+	}
+	if t.Configs == nil {
+		key := t.key()
+		t.Configs = func(rc *Receiver) []NotifierConfig { return rc.ReceiverExtension.Registered[key] }
+	}
+	integrationTypes = append(integrationTypes, t)
+}
+
+// receiverKeyTaken returns true if a receiver field of the built-in
+// integrations is named key.
+func receiverKeyTaken(key string) bool {
+	if extensionKeys[key] {
+		return true
+	}
+	rt := reflect.TypeOf(config.Receiver{})
+	for i := 0; i < rt.NumField(); i++ {
+		if strings.Split(rt.Field(i).Tag.Get("yaml"), ",")[0] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredIntegration returns the registered integration type configured
+// with the receiver field key, or nil.
+func registeredIntegration(key string) *IntegrationType {
+	integrationTypesMtx.RLock()
+	defer integrationTypesMtx.RUnlock()
+	for _, t := range integrationTypes {
+		if t.NewConfig != nil && t.key() == key {
+			return t
+		}
+	}
+	return nil
+}
+
+func getIntegrationTypes() []*IntegrationType {
+	integrationTypesMtx.RLock()
+	defer integrationTypesMtx.RUnlock()
+	return integrationTypes
+}
+
+// IntegrationTypeNames returns the names of the integration types.
+func IntegrationTypeNames() []string {
+	types := getIntegrationTypes()
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// IntegrationNames returns the names of the integration types configured in
+// a receiver.
+func IntegrationNames(rc *Receiver) []string {
+	var names []string
+	for _, t := range getIntegrationTypes() {
+		if len(t.Configs(rc)) > 0 {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// loadRegisteredConfigs unmarshals the configs of the registered
+// integrations of a receiver.
+func loadRegisteredConfigs(fields yaml.MapSlice) (map[string][]NotifierConfig, error) {
+	configs := map[string][]NotifierConfig{}
+	for _, f := range fields {
+		key, _ := f.Key.(string)
+		t := registeredIntegration(key)
+		items, ok := f.Value.([]interface{})
+		if !ok && f.Value != nil {
+			return nil, errors.Errorf("%s must be a list", key)
+		}
+		for _, item := range items {
+			data, err := yaml.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			c := t.NewConfig()
+			if err := yaml.UnmarshalStrict(data, c); err != nil {
+				return nil, errors.Wrap(err, key)
+			}
+			configs[key] = append(configs[key], c)
+		}
+	}
+	return configs, nil
+}
+
+// HTTPClient returns the HTTP client for cfg of the notifier notified with
+// ctx. It applies the egress policy and the HTTP client settings of the
+// receiver, and is meant for the notifiers of registered integrations.
+func HTTPClient(ctx context.Context, cfg commoncfg.HTTPClientConfig) (*http.Client, error) {
+	return newHTTPClient(ctx, cfg)
+}
+
+// builtinIntegrations returns the built-in integration types.
+func builtinIntegrations() []*IntegrationType {
+	return []*IntegrationType{
+		{
+			Name: "webhook",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.ReceiverExtension.WebhookConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewWebhook(c.(*WebhookConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "email",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.ReceiverExtension.EmailConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewEmail(c.(*EmailConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "pagerduty",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.ReceiverExtension.PagerdutyConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewPagerDuty(c.(*PagerdutyConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "opsgenie",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.OpsGenieConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewOpsGenie(c.(*config.OpsGenieConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "wechat",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.WechatConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewWechat(c.(*config.WechatConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "slack",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.ReceiverExtension.SlackConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewSlack(c.(*SlackConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "hipchat",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.HipchatConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewHipchat(c.(*config.HipchatConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "victorops",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.VictorOpsConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewVictorOps(c.(*config.VictorOpsConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "pushover",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.PushoverConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewPushover(c.(*config.PushoverConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "msteams",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.MSTeamsConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewMSTeams(c.(*MSTeamsConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "webex",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.WebexConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewWebex(c.(*WebexConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "googlechat",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.GoogleChatConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewGoogleChat(c.(*GoogleChatConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "discord",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.DiscordConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewDiscord(c.(*DiscordConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "mattermost",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.MattermostConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewMattermost(c.(*MattermostConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "servicenow",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.ServiceNowConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewServiceNow(c.(*ServiceNowConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "twilio",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.TwilioConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewTwilio(c.(*TwilioConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "sns",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.SNSConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewSNS(c.(*SNSConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "sqs",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.SQSConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewSQS(c.(*SQSConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "kafka",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.KafkaConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewKafka(c.(*KafkaConfig), tmpl, l)
+			},
+		},
+		{
+			Name: "exec",
+			Configs: func(rc *Receiver) (cs []NotifierConfig) {
+				for _, c := range rc.ExecConfigs {
+					cs = append(cs, c)
+				}
+				return cs
+			},
+			New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+				return NewExec(c.(*ExecConfig), tmpl, l)
+			},
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+type pagerConfig struct {
+	config.NotifierConfig `yaml:",inline"`
+
+	Channel string `yaml:"channel"`
+	Sender  string `yaml:"sender,omitempty"`
+}
+
+type pager struct {
+	conf *pagerConfig
+}
+
+func (p *pager) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	return false, nil
+}
+
+func TestRegisterIntegration(t *testing.T) {
+	RegisterIntegration(&IntegrationType{
+		Name:      "pager",
+		NewConfig: func() NotifierConfig { return &pagerConfig{} },
+		SetGlobalDefaults: func(c NotifierConfig, g *config.GlobalConfig) error {
+			if pc := c.(*pagerConfig); pc.Sender == "" {
+				pc.Sender = g.SMTPFrom
+			}
+			return nil
+		},
+		New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+			return &pager{conf: c.(*pagerConfig)}
+		},
+	})
+
+	cfg, err := LoadConfig(`
+global:
+  smtp_from: alertmanager@example.com
+route:
+  receiver: team
+receivers:
+- name: team
+  pager_configs:
+  - channel: ops
+    send_resolved: true
+  webhook_configs:
+  - url: http://example.com/
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integrations := BuildReceiverIntegrations(cfg.Receivers[0], nil, log.NewNopLogger())
+	if len(integrations) != 2 || integrations[0].Name() != "webhook" || integrations[1].Name() != "pager" {
+		t.Fatalf("unexpected integrations: %+v", integrations)
+	}
+	p := integrations[1].notifier.(*pager)
+	if p.conf.Channel != "ops" || p.conf.Sender != "alertmanager@example.com" || !integrations[1].conf.SendResolved() {
+		t.Fatalf("unexpected pager config: %+v", p.conf)
+	}
+
+	if _, err := LoadConfig(`
+route:
+  receiver: team
+receivers:
+- name: team
+  pager_configs:
+  - channel: ops
+    unknown: true
+`); err == nil {
+		t.Fatal("expected an error for an unknown field of a registered integration")
+	}
+
+	for _, name := range []string{"pager", "slack", "opsgenie"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %s again did not panic", name)
+				}
+			}()
+			RegisterIntegration(&IntegrationType{
+				Name:      name,
+				NewConfig: func() NotifierConfig { return &pagerConfig{} },
+				New: func(c NotifierConfig, tmpl *template.Template, l log.Logger) notify.Notifier {
+					return &pager{}
+				},
+			})
+		}()
+	}
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxRecordedBody is the size of the response bodies kept by a
+// ResponseRecorder.
+const maxRecordedBody = 4096
+
+// A Response is the response of a downstream service to a request sent by
+// a notifier.
+type Response struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+	Body       string `json:"body,omitempty"`
+}
+
+// A ResponseRecorder records the responses to the requests sent by the
+// notifiers using a context it was added to. Only the notifiers using
+// newHTTPClient are recorded.
+type ResponseRecorder struct {
+	mtx       sync.Mutex
+	responses []Response
+}
+
+type responseRecorderKey struct{}
+
+// WithResponseRecorder returns a context recording the responses into r.
+func WithResponseRecorder(ctx context.Context, r *ResponseRecorder) context.Context {
+	return context.WithValue(ctx, responseRecorderKey{}, r)
+}
+
+// Responses returns the recorded responses in the order they were received.
+func (r *ResponseRecorder) Responses() []Response {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]Response(nil), r.responses...)
+}
+
+// record adds the response, keeping the beginning of its body which is
+// still read by the notifier.
+func (r *ResponseRecorder) record(req *http.Request, resp *http.Response) {
+	u := *req.URL
+	u.User, u.RawQuery = nil, ""
+	rr := Response{URL: u.String(), StatusCode: resp.StatusCode}
+	if resp.Body != nil {
+		b := make([]byte, maxRecordedBody)
+		n, _ := io.ReadFull(resp.Body, b)
+		rr.Body = string(b[:n])
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b[:n]), resp.Body), resp.Body}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.responses = append(r.responses, rr)
+}
+
+func recordResponse(req *http.Request, resp *http.Response) {
+	if r, ok := req.Context().Value(responseRecorderKey{}).(*ResponseRecorder); ok {
+		r.record(req, resp)
+	}
+}
@@ -0,0 +1,255 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// serviceNowTokenExpiryMargin is how long before their expiry OAuth tokens
+// are renewed.
+const serviceNowTokenExpiryMargin = time.Minute
+
+// ServiceNow implements a Notifier creating and updating ServiceNow
+// incidents through the Table API.
+type ServiceNow struct {
+	conf   *ServiceNowConfig
+	tmpl   *template.Template
+	logger log.Logger
+
+	tokenMtx    sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewServiceNow returns a new ServiceNow notifier.
+func NewServiceNow(c *ServiceNowConfig, t *template.Template, l log.Logger) *ServiceNow {
+	return &ServiceNow{conf: c, tmpl: t, logger: l}
+}
+
+// serviceNowRecord is a record of the alert group, with its fields resolved
+// or not.
+type serviceNowRecord struct {
+	CorrelationID string            `json:"correlation_id"`
+	Resolved      bool              `json:"resolved"`
+	Fields        map[string]string `json:"fields"`
+}
+
+type serviceNowTableResponse struct {
+	Result []struct {
+		SysID string `json:"sys_id"`
+	} `json:"result"`
+}
+
+type serviceNowTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Render implements the Renderer interface.
+func (n *ServiceNow) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	return n.record(ctx, as...)
+}
+
+func (n *ServiceNow) record(ctx context.Context, as ...*types.Alert) (*serviceNowRecord, error) {
+	groupKey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return nil, fmt.Errorf("group key missing")
+	}
+
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+		rec      = &serviceNowRecord{
+			CorrelationID: fmt.Sprintf("%x", sha256.Sum256([]byte(groupKey))),
+			Resolved:      types.Alerts(as...).Status() == model.AlertResolved,
+			Fields:        make(map[string]string, len(n.conf.Fields)+len(n.conf.ResolveFields)),
+		}
+	)
+	for k, v := range n.conf.Fields {
+		rec.Fields[k] = tmplText(v)
+	}
+	if rec.Resolved {
+		for k, v := range n.conf.ResolveFields {
+			rec.Fields[k] = tmplText(v)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to template ServiceNow fields: %v", err)
+	}
+	return rec, nil
+}
+
+// Notify implements the Notifier interface. The active record of the alert
+// group is updated, or created if there is none and the group is firing.
+func (n *ServiceNow) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	rec, err := n.record(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	sysID, retry, err := n.find(ctx, c, rec.CorrelationID)
+	if err != nil {
+		return retry, err
+	}
+
+	fields := rec.Fields
+	tableURL := n.tableURL()
+	switch {
+	case sysID != "":
+		_ = level.Debug(n.logger).Log("msg", "Updating ServiceNow record", "correlation_id", rec.CorrelationID, "sys_id", sysID)
+		return n.do(ctx, c, "PATCH", tableURL+"/"+url.PathEscape(sysID), fields, nil)
+	case rec.Resolved:
+		_ = level.Debug(n.logger).Log("msg", "No active ServiceNow record to resolve", "correlation_id", rec.CorrelationID)
+		return false, nil
+	default:
+		_ = level.Debug(n.logger).Log("msg", "Creating ServiceNow record", "correlation_id", rec.CorrelationID)
+		fields["correlation_id"] = rec.CorrelationID
+		fields["correlation_display"] = "Alertmanager"
+		return n.do(ctx, c, "POST", tableURL, fields, nil)
+	}
+}
+
+func (n *ServiceNow) tableURL() string {
+	return strings.TrimRight(n.conf.InstanceURL.String(), "/") + "/api/now/table/" + n.conf.Table
+}
+
+// find returns the sys_id of the active record with the correlation ID, if
+// there is one.
+func (n *ServiceNow) find(ctx context.Context, c *http.Client, correlationID string) (string, bool, error) {
+	q := url.Values{
+		"sysparm_query":  {"correlation_id=" + correlationID + "^active=true"},
+		"sysparm_fields": {"sys_id"},
+		"sysparm_limit":  {"1"},
+	}
+	var resp serviceNowTableResponse
+	if retry, err := n.do(ctx, c, "GET", n.tableURL()+"?"+q.Encode(), nil, &resp); err != nil {
+		return "", retry, err
+	}
+	if len(resp.Result) == 0 {
+		return "", false, nil
+	}
+	return resp.Result[0].SysID, false, nil
+}
+
+// do sends an authenticated request to the Table API, and decodes the
+// response into result if it is not nil.
+func (n *ServiceNow) do(ctx context.Context, c *http.Client, method, u string, body interface{}, result interface{}) (bool, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return false, err
+		}
+	}
+	req, err := http.NewRequest(method, u, &buf)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+	if body != nil {
+		req.Header.Set("Content-Type", contentTypeJSON)
+	}
+	if n.conf.OAuth != nil {
+		token, err := n.accessToken(ctx, c)
+		if err != nil {
+			return true, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.SetBasicAuth(n.conf.Username, string(n.conf.Password))
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized && n.conf.OAuth != nil {
+		// The token may have been revoked, request a new one on retry.
+		n.resetToken()
+		return true, fmt.Errorf("unauthorized by ServiceNow: %s", readErrorBody(resp.Body))
+	}
+	if retry, err := retryHTTP(resp.StatusCode, resp.Body); err != nil {
+		return retry, err
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return true, fmt.Errorf("failed to decode ServiceNow response: %v", err)
+		}
+	}
+	return false, nil
+}
+
+// accessToken returns the cached OAuth token, or requests a new one with
+// the password grant.
+func (n *ServiceNow) accessToken(ctx context.Context, c *http.Client) (string, error) {
+	n.tokenMtx.Lock()
+	defer n.tokenMtx.Unlock()
+
+	if n.token != "" && time.Now().Before(n.tokenExpiry) {
+		return n.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {n.conf.OAuth.ClientID},
+		"client_secret": {string(n.conf.OAuth.ClientSecret)},
+		"username":      {n.conf.Username},
+		"password":      {string(n.conf.Password)},
+	}
+	u := strings.TrimRight(n.conf.InstanceURL.String(), "/") + "/oauth_token.do"
+	req, err := http.NewRequest("POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("failed to request ServiceNow token: unexpected status code %v", resp.StatusCode)
+	}
+	var tr serviceNowTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("failed to decode ServiceNow token: %v", err)
+	}
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("no access token in ServiceNow token response")
+	}
+	n.token = tr.AccessToken
+	n.tokenExpiry = time.Now().Add(time.Duration(tr.ExpiresIn)*time.Second - serviceNowTokenExpiryMargin)
+	return n.token, nil
+}
+
+func (n *ServiceNow) resetToken() {
+	n.tokenMtx.Lock()
+	n.token = ""
+	n.tokenMtx.Unlock()
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/inhibit"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// RenderReport is called with the outcome of rendering the notification
+// of an integration, err is nil if it was rendered.
+type RenderReport func(receiver, integration string, err error)
+
+// RenderStage renders the notifications of the integrations of a receiver
+// without sending them. Integrations which do not implement Renderer are
+// reported as rendered.
+type RenderStage struct {
+	receiver     string
+	integrations []Integration
+	report       RenderReport
+}
+
+// NewRenderStage returns a RenderStage reporting to report.
+func NewRenderStage(receiver string, integrations []Integration, report RenderReport) *RenderStage {
+	return &RenderStage{receiver: receiver, integrations: integrations, report: report}
+}
+
+// Exec implements the Stage interface. The alerts are passed on.
+func (s *RenderStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	for _, i := range s.integrations {
+		name := fmt.Sprintf("%s[%d]", i.name, i.idx)
+		_, _, err := i.Render(ctx, alerts...)
+		if err != nil {
+			_ = level.Warn(l).Log("msg", "Failed to render notification", "receiver", s.receiver, "integration", name, "err", err)
+		} else {
+			_ = level.Debug(l).Log("msg", "Rendered notification", "receiver", s.receiver, "integration", name, "alerts", len(alerts))
+		}
+		s.report(s.receiver, name, err)
+	}
+	return ctx, alerts, nil
+}
+
+// BuildShadowPipeline builds a map of receivers to Stages for a config run
+// in shadow next to the applied one. The notifications are rendered but not
+// sent, except those of canaryReceiver, if set, which are also sent and
+// logged to notificationLog.
+func BuildShadowPipeline(
+	tenantID string,
+	features func(feature string) bool,
+	confs []*Receiver,
+	windows []*MaintenanceWindow,
+	canaryReceiver string,
+	tmpl *template.Template,
+	wait func() time.Duration,
+	inhibitor *inhibit.Inhibitor,
+	silencer *silence.Silencer,
+	notificationLog notify.NotificationLog,
+	report RenderReport,
+	logger log.Logger,
+) notify.RoutingStage {
+	rs := notify.RoutingStage{}
+
+	is := notify.NewMuteStage(inhibitor)
+	ss := notify.NewMuteStage(silencer)
+	mw := NewMaintenanceStage(windows)
+
+	for _, rc := range confs {
+		s := notify.MultiStage{TenantStage(tenantID), FeaturesStage(features), is, ss, mw,
+			NewRenderStage(rc.Name, BuildReceiverIntegrations(rc, tmpl, logger), report)}
+		if rc.Name == canaryReceiver {
+			s = append(s, createStage(rc, tmpl, wait, notificationLog, logger))
+		}
+		rs[rc.Name] = s
+	}
+	return rs
+}
@@ -0,0 +1,412 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// slackPostMessageURL is the URL of chat.postMessage, used with bot tokens
+// unless the api_url is set.
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// Block Kit text limits.
+const (
+	slackMaxHeaderLen = 150
+	slackMaxTextLen   = 3000
+	slackMaxButtonLen = 75
+)
+
+// slackThreadTTL is how long the thread of an alert group is remembered
+// after its last firing notification.
+const slackThreadTTL = 7 * 24 * time.Hour
+
+// Slack implements a Notifier for Slack incoming webhooks and the
+// chat.postMessage API.
+type Slack struct {
+	conf   *SlackConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewSlack returns a new Slack notifier.
+func NewSlack(c *SlackConfig, t *template.Template, l log.Logger) *Slack {
+	return &Slack{conf: c, tmpl: t, logger: l}
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	IconEmoji   string            `json:"icon_emoji,omitempty"`
+	IconURL     string            `json:"icon_url,omitempty"`
+	LinkNames   bool              `json:"link_names,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	Blocks      []slackBlock      `json:"blocks,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
+}
+
+// slackAttachment is the attachment sent by the upstream integration.
+type slackAttachment struct {
+	Title      string               `json:"title,omitempty"`
+	TitleLink  string               `json:"title_link,omitempty"`
+	Pretext    string               `json:"pretext,omitempty"`
+	Text       string               `json:"text"`
+	Fallback   string               `json:"fallback"`
+	CallbackID string               `json:"callback_id"`
+	Fields     []config.SlackField  `json:"fields,omitempty"`
+	Actions    []config.SlackAction `json:"actions,omitempty"`
+	ImageURL   string               `json:"image_url,omitempty"`
+	ThumbURL   string               `json:"thumb_url,omitempty"`
+	Footer     string               `json:"footer"`
+
+	Color    string   `json:"color,omitempty"`
+	MrkdwnIn []string `json:"mrkdwn_in,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string        `json:"type"`
+	Text     *slackText    `json:"text,omitempty"`
+	Fields   []slackText   `json:"fields,omitempty"`
+	Elements []interface{} `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackButton struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	URL      string    `json:"url,omitempty"`
+	ActionID string    `json:"action_id,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Style    string    `json:"style,omitempty"`
+}
+
+// slackAPIResponse is the response of the Slack Web API.
+type slackAPIResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	TS      string `json:"ts,omitempty"`
+}
+
+// Render implements the Renderer interface.
+func (n *Slack) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	return n.message(ctx, as...)
+}
+
+func (n *Slack) message(ctx context.Context, as ...*types.Alert) (*slackMessage, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	msg := &slackMessage{
+		Channel:   tmplText(n.conf.Channel),
+		Username:  tmplText(n.conf.Username),
+		IconEmoji: tmplText(n.conf.IconEmoji),
+		IconURL:   tmplText(n.conf.IconURL),
+		LinkNames: n.conf.LinkNames,
+	}
+	if len(n.conf.Blocks) > 0 && FeatureEnabled(ctx, FeatureSlackBlockKit) {
+		msg.Text = tmplText(n.conf.Fallback)
+		msg.Blocks = n.blocks(ctx, tmplText)
+	} else {
+		msg.Attachments = []slackAttachment{n.attachment(tmplText)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// attachment returns the attachment of the upstream integration.
+func (n *Slack) attachment(tmplText func(string) string) slackAttachment {
+	attachment := slackAttachment{
+		Title:      tmplText(n.conf.Title),
+		TitleLink:  tmplText(n.conf.TitleLink),
+		Pretext:    tmplText(n.conf.Pretext),
+		Text:       tmplText(n.conf.Text),
+		Fallback:   tmplText(n.conf.Fallback),
+		CallbackID: tmplText(n.conf.CallbackID),
+		ImageURL:   tmplText(n.conf.ImageURL),
+		ThumbURL:   tmplText(n.conf.ThumbURL),
+		Footer:     tmplText(n.conf.Footer),
+		Color:      tmplText(n.conf.Color),
+		MrkdwnIn:   []string{"fallback", "pretext", "text"},
+	}
+	for _, field := range n.conf.Fields {
+		// Check if short was defined for the field otherwise fallback to the global setting
+		short := n.conf.ShortFields
+		if field.Short != nil {
+			short = *field.Short
+		}
+		attachment.Fields = append(attachment.Fields, config.SlackField{
+			Title: tmplText(field.Title),
+			Value: tmplText(field.Value),
+			Short: &short,
+		})
+	}
+	for _, action := range n.conf.Actions {
+		slackAction := config.SlackAction{
+			Type:  tmplText(action.Type),
+			Text:  tmplText(action.Text),
+			URL:   tmplText(action.URL),
+			Style: tmplText(action.Style),
+			Name:  tmplText(action.Name),
+			Value: tmplText(action.Value),
+		}
+		if action.ConfirmField != nil {
+			slackAction.ConfirmField = &config.SlackConfirmationField{
+				Title:       tmplText(action.ConfirmField.Title),
+				Text:        tmplText(action.ConfirmField.Text),
+				OkText:      tmplText(action.ConfirmField.OkText),
+				DismissText: tmplText(action.ConfirmField.DismissText),
+			}
+		}
+		attachment.Actions = append(attachment.Actions, slackAction)
+	}
+	return attachment
+}
+
+// blocks returns the Block Kit layout. Texts are truncated to the limits of
+// Slack, which rejects the whole message otherwise.
+func (n *Slack) blocks(ctx context.Context, tmplText func(string) string) []slackBlock {
+	text := func(typ, s string, max int) slackText {
+		s, _ = truncate(tmplText(s), max)
+		return slackText{Type: typ, Text: s}
+	}
+
+	blocks := make([]slackBlock, 0, len(n.conf.Blocks))
+	for _, b := range n.conf.Blocks {
+		block := slackBlock{Type: b.Type}
+		switch b.Type {
+		case SlackBlockHeader:
+			t := text("plain_text", b.Text, slackMaxHeaderLen)
+			block.Text = &t
+		case SlackBlockSection:
+			if b.Text != "" {
+				t := text("mrkdwn", b.Text, slackMaxTextLen)
+				block.Text = &t
+			}
+			for _, f := range b.Fields {
+				block.Fields = append(block.Fields, text("mrkdwn", f, slackMaxTextLen))
+			}
+		case SlackBlockContext:
+			block.Elements = []interface{}{text("mrkdwn", b.Text, slackMaxTextLen)}
+		case SlackBlockActions:
+			for _, btn := range b.Buttons {
+				button := slackButton{
+					Type:  "button",
+					Text:  text("plain_text", btn.Text, slackMaxButtonLen),
+					Style: btn.Style,
+				}
+				if btn.Action == "" {
+					button.URL = tmplText(btn.URL)
+				} else {
+					value, ok := n.actionValue(ctx, btn)
+					if !ok {
+						continue
+					}
+					button.ActionID = btn.Action
+					button.Value = value
+				}
+				block.Elements = append(block.Elements, button)
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// actionValue returns the value of an interactive button, identifying the
+// alert group. Buttons whose value exceeds the limit of Slack are left out.
+func (n *Slack) actionValue(ctx context.Context, btn *SlackButton) (string, bool) {
+	groupKey, _ := notify.GroupKey(ctx)
+	v := slackActionValue{
+		Receiver: routeReceiverName(ctx, n.logger),
+		GroupKey: groupKey,
+	}
+	if btn.Action == SlackActionSilence {
+		v.GroupLabels = groupLabels(ctx, n.logger)
+		v.Duration = btn.Duration
+	}
+	b, err := json.Marshal(v)
+	if err != nil || len(b) > slackMaxActionValueLen {
+		_ = level.Warn(n.logger).Log("msg", "Leaving out slack button, its alert group is too large", "action", btn.Action)
+		return "", false
+	}
+	return string(b), true
+}
+
+// Notify implements the Notifier interface.
+func (n *Slack) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.message(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var threadKey string
+	resolved := types.Alerts(as...).Status() == model.AlertResolved
+	if n.conf.Thread {
+		groupKey, ok := notify.GroupKey(ctx)
+		if !ok {
+			_ = level.Error(n.logger).Log("msg", "group key missing")
+		}
+		threadKey = slackThreadKey(string(n.conf.BotToken), msg.Channel, groupKey)
+		if th, ok := slackThreads.get(threadKey); ok {
+			msg.Channel = th.channel
+			msg.ThreadTS = th.ts
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+
+	u := slackPostMessageURL
+	if n.conf.APIURL != nil {
+		u = n.conf.APIURL.String()
+	}
+	req, err := http.NewRequest("POST", u, &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", userAgentHeader)
+	if n.conf.BotToken != "" {
+		req.Header.Set("Authorization", "Bearer "+string(n.conf.BotToken))
+	}
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	// Incoming webhooks respond with plain text errors.
+	if n.conf.BotToken == "" || resp.StatusCode/100 != 2 {
+		return retryHTTP(resp.StatusCode, resp.Body)
+	}
+
+	var apiResp slackAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return true, fmt.Errorf("failed to decode slack response: %v", err)
+	}
+	if !apiResp.OK {
+		return slackRetryable(apiResp.Error), fmt.Errorf("slack error: %s", apiResp.Error)
+	}
+
+	if n.conf.Thread {
+		switch {
+		case resolved:
+			slackThreads.delete(threadKey)
+		case msg.ThreadTS == "":
+			slackThreads.set(threadKey, slackThread{channel: apiResp.Channel, ts: apiResp.TS})
+		default:
+			slackThreads.touch(threadKey)
+		}
+	}
+	return false, nil
+}
+
+// slackRetryable returns true if the Slack API error is temporary.
+func slackRetryable(code string) bool {
+	switch code {
+	case "ratelimited", "rate_limited", "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+		return true
+	}
+	return false
+}
+
+// slackThreadKey returns the key of the thread of an alert group. The bot
+// token is part of the key, as group keys are not unique across users.
+func slackThreadKey(token, channel, groupKey string) string {
+	h := sha256.New()
+	h.Write([]byte(token))
+	h.Write([]byte{0})
+	h.Write([]byte(channel))
+	h.Write([]byte{0})
+	h.Write([]byte(groupKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// slackThread is the first firing message of an alert group.
+type slackThread struct {
+	channel string
+	ts      string
+	expires time.Time
+}
+
+// slackThreadStore remembers the threads of alert groups. It is kept across
+// config reloads, which rebuild the notifiers.
+type slackThreadStore struct {
+	mtx     sync.Mutex
+	threads map[string]slackThread
+}
+
+var slackThreads = &slackThreadStore{threads: map[string]slackThread{}}
+
+func (s *slackThreadStore) get(key string) (slackThread, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	th, ok := s.threads[key]
+	if ok && time.Now().After(th.expires) {
+		delete(s.threads, key)
+		return slackThread{}, false
+	}
+	return th, ok
+}
+
+func (s *slackThreadStore) set(key string, th slackThread) {
+	now := time.Now()
+	th.expires = now.Add(slackThreadTTL)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for k, t := range s.threads {
+		if now.After(t.expires) {
+			delete(s.threads, k)
+		}
+	}
+	s.threads[key] = th
+}
+
+func (s *slackThreadStore) touch(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if th, ok := s.threads[key]; ok {
+		th.expires = time.Now().Add(slackThreadTTL)
+		s.threads[key] = th
+	}
+}
+
+func (s *slackThreadStore) delete(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.threads, key)
+}
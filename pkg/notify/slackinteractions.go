@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// slackMaxActionValueLen is the limit of Slack for the values of
+	// interactive buttons.
+	slackMaxActionValueLen = 2000
+	// slackMaxRequestAge is how old the timestamp of a signed Slack request
+	// may be, which prevents replays.
+	slackMaxRequestAge = 5 * time.Minute
+	// slackResponseHost is the host of the response URLs of interactions.
+	slackResponseHost = "hooks.slack.com"
+)
+
+// Headers of signed Slack requests.
+const (
+	slackSignatureHeader = "X-Slack-Signature"
+	slackTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// validateSlackInteractions checks that the interactive Slack buttons can be
+// handled.
+func validateSlackInteractions(cfg *Config) error {
+	if cfg.SlackInteractions != nil {
+		return nil
+	}
+	for _, rc := range cfg.Receivers {
+		for _, sc := range rc.ReceiverExtension.SlackConfigs {
+			for _, b := range sc.Blocks {
+				for _, btn := range b.Buttons {
+					if btn.Action != "" {
+						return errors.Errorf("receiver %q: slack button action %q requires slack_interactions", rc.Name, btn.Action)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// slackActionValue is the value of an interactive button, which identifies
+// the alert group it acts on. The keys are short, as the length of values
+// is limited.
+type slackActionValue struct {
+	Receiver    string         `json:"r"`
+	GroupKey    string         `json:"g"`
+	GroupLabels model.LabelSet `json:"l,omitempty"`
+	Duration    model.Duration `json:"d,omitempty"`
+}
+
+// SlackAction is an action requested with an interactive button.
+type SlackAction struct {
+	// Action is SlackActionSilence or SlackActionAck.
+	Action string
+	// Receiver is the receiver of the route of the alert group.
+	Receiver    string
+	GroupKey    string
+	GroupLabels model.LabelSet
+	// Duration of silences.
+	Duration time.Duration
+}
+
+// SlackInteraction is the callback of Slack for the interactive buttons
+// clicked by a user.
+type SlackInteraction struct {
+	// User is the name of the Slack user.
+	User        string
+	ResponseURL string
+	Actions     []SlackAction
+}
+
+type slackInteractionPayload struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// VerifySlackRequest checks the signature of a request of Slack, made with
+// the signing secret of the Slack app over the timestamp and the body.
+func VerifySlackRequest(secret string, h http.Header, body []byte, now time.Time) error {
+	ts := h.Get(slackTimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("invalid slack request timestamp")
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > slackMaxRequestAge || d < -slackMaxRequestAge {
+		return errors.New("slack request timestamp too far from now")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(h.Get(slackSignatureHeader))) {
+		return errors.New("invalid slack request signature")
+	}
+	return nil
+}
+
+// ParseSlackInteraction parses the form encoded body of a callback of Slack.
+// Only the block actions of the interactive buttons of the Slack notifier
+// are returned, other actions are ignored.
+func ParseSlackInteraction(body []byte) (*SlackInteraction, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid slack interaction")
+	}
+	var p slackInteractionPayload
+	if err := json.Unmarshal([]byte(form.Get("payload")), &p); err != nil {
+		return nil, errors.Wrap(err, "invalid slack interaction payload")
+	}
+	i := &SlackInteraction{User: p.User.Username, ResponseURL: p.ResponseURL}
+	if i.User == "" {
+		i.User = p.User.ID
+	}
+	if p.Type != "block_actions" {
+		return i, nil
+	}
+	for _, a := range p.Actions {
+		if a.ActionID != SlackActionSilence && a.ActionID != SlackActionAck {
+			continue
+		}
+		var v slackActionValue
+		if err := json.Unmarshal([]byte(a.Value), &v); err != nil {
+			return nil, errors.Wrapf(err, "invalid value of slack action %s", a.ActionID)
+		}
+		i.Actions = append(i.Actions, SlackAction{
+			Action:      a.ActionID,
+			Receiver:    v.Receiver,
+			GroupKey:    v.GroupKey,
+			GroupLabels: v.GroupLabels,
+			Duration:    time.Duration(v.Duration),
+		})
+	}
+	return i, nil
+}
+
+// RespondSlack posts a message only visible to the user who clicked a
+// button to the response URL of the interaction.
+func RespondSlack(ctx context.Context, responseURL, text string) error {
+	u, err := url.Parse(responseURL)
+	if err != nil {
+		return err
+	}
+	// The response URL is only trusted if it points to Slack.
+	if u.Scheme != "https" || !strings.EqualFold(u.Hostname(), slackResponseHost) {
+		return errors.Errorf("unexpected slack response url host %q", u.Hostname())
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, commoncfg.HTTPClientConfig{})
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status code %v: %s", resp.StatusCode, readErrorBody(resp.Body))
+	}
+	return nil
+}
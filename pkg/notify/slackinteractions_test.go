@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestVerifySlackRequest(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte("payload=%7B%7D")
+	sign := func(secret string, ts time.Time) http.Header {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + strconv.FormatInt(ts.Unix(), 10) + ":"))
+		mac.Write(body)
+		h := http.Header{}
+		h.Set(slackTimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+		h.Set(slackSignatureHeader, "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return h
+	}
+
+	if err := VerifySlackRequest("secret", sign("secret", now), body, now); err != nil {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+	if err := VerifySlackRequest("secret", sign("other", now), body, now); err == nil {
+		t.Fatal("request with invalid signature accepted")
+	}
+	if err := VerifySlackRequest("secret", sign("secret", now.Add(-10*time.Minute)), body, now); err == nil {
+		t.Fatal("replayed request accepted")
+	}
+	if err := VerifySlackRequest("secret", http.Header{}, body, now); err == nil {
+		t.Fatal("unsigned request accepted")
+	}
+}
+
+func TestParseSlackInteraction(t *testing.T) {
+	value, err := json.Marshal(slackActionValue{
+		Receiver:    "team",
+		GroupKey:    "{}:{alertname=\"a\"}",
+		GroupLabels: model.LabelSet{"alertname": "a"},
+		Duration:    model.Duration(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U1", "username": "alice"},
+		"response_url": "https://hooks.slack.com/actions/1",
+		"actions": []map[string]string{
+			{"action_id": SlackActionSilence, "value": string(value)},
+			{"action_id": "other", "value": "x"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := ParseSlackInteraction([]byte(url.Values{"payload": {string(payload)}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.User != "alice" || i.ResponseURL != "https://hooks.slack.com/actions/1" || len(i.Actions) != 1 {
+		t.Fatalf("unexpected interaction: %+v", i)
+	}
+	a := i.Actions[0]
+	if a.Action != SlackActionSilence || a.Receiver != "team" || a.GroupLabels["alertname"] != "a" || a.Duration != time.Hour {
+		t.Fatalf("unexpected action: %+v", a)
+	}
+}
@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// StormAlertName is the alert name of the summary notifications sent
+// instead of the notifications of an alert storm.
+const StormAlertName = "AlertStorm"
+
+var (
+	numAlertStorms = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alert_storms_total",
+		Help:      "The total number of alert storms detected by flood protection.",
+	})
+	numStormSuppressedNotifications = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alert_storm_suppressed_notifications_total",
+		Help:      "The total number of notifications collapsed into alert storm summaries.",
+	})
+	numStormSummaries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "alert_storm_summaries_total",
+		Help:      "The total number of alert storm summary notifications.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(numAlertStorms, numStormSuppressedNotifications, numStormSummaries)
+}
+
+// DefaultFloodProtection defines default values for flood protection.
+var DefaultFloodProtection = FloodProtection{
+	Window:          model.Duration(time.Minute),
+	SummaryInterval: model.Duration(5 * time.Minute),
+}
+
+// FloodProtection detects alert storms, during which the notifications of a
+// user are collapsed into summary notifications.
+//
+// A storm starts once more distinct alerts than MaxAlertsPerSecond on
+// average were notified within the window, and ends when the rate drops
+// below it again. During a storm, every receiver gets one summary
+// notification per summary interval, counting the alerts of the storm.
+type FloodProtection struct {
+	MaxAlertsPerSecond float64        `yaml:"max_alerts_per_second" json:"max_alerts_per_second"`
+	Window             model.Duration `yaml:"window,omitempty" json:"window,omitempty"`
+	SummaryInterval    model.Duration `yaml:"summary_interval,omitempty" json:"summary_interval,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *FloodProtection) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultFloodProtection
+	type plain FloodProtection
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.MaxAlertsPerSecond <= 0 {
+		return errors.New("flood_protection: max_alerts_per_second must be positive")
+	}
+	if c.Window <= 0 {
+		return errors.New("flood_protection: window must be positive")
+	}
+	if c.SummaryInterval <= 0 {
+		return errors.New("flood_protection: summary_interval must be positive")
+	}
+	return nil
+}
+
+// StormStatus describes the alert storm of a user.
+type StormStatus struct {
+	Since time.Time `json:"since"`
+	// Rate is the average number of distinct alerts per second within the
+	// window.
+	Rate float64 `json:"rate"`
+	// Alerts is the number of distinct alerts seen since the storm started.
+	Alerts int `json:"alerts"`
+	// Suppressed is the number of notifications collapsed into summaries.
+	Suppressed int `json:"suppressed"`
+}
+
+// StormStage collapses the notifications of alert storms into summary
+// notifications. It is shared by the receivers of a user, so that the rate
+// of alerts is measured across all of them.
+type StormStage struct {
+	conf *FloodProtection
+	now  func() time.Time
+
+	mtx sync.Mutex
+	// seen holds the time the alerts within the window were first seen.
+	seen map[model.Fingerprint]time.Time
+	// storm is nil unless a storm is ongoing.
+	storm *storm
+}
+
+type storm struct {
+	since       time.Time
+	alerts      map[model.Fingerprint]struct{}
+	suppressed  int
+	lastSummary map[string]time.Time
+}
+
+// NewStormStage returns a new StormStage. Flood protection is disabled if
+// conf is nil.
+func NewStormStage(conf *FloodProtection) *StormStage {
+	return &StormStage{
+		conf: conf,
+		now:  time.Now,
+		seen: map[model.Fingerprint]time.Time{},
+	}
+}
+
+// Exec implements the Stage interface.
+func (s *StormStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	if s.conf == nil {
+		return ctx, alerts, nil
+	}
+	receiver := receiverName(ctx, l)
+	now := s.now()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, a := range alerts {
+		if a.Resolved() {
+			continue
+		}
+		fp := a.Fingerprint()
+		if _, ok := s.seen[fp]; !ok {
+			s.seen[fp] = now
+		}
+		if s.storm != nil {
+			s.storm.alerts[fp] = struct{}{}
+		}
+	}
+	s.update(l, now)
+	if s.storm == nil {
+		return ctx, alerts, nil
+	}
+
+	if last, ok := s.storm.lastSummary[receiver]; ok && now.Sub(last) < time.Duration(s.conf.SummaryInterval) {
+		s.storm.suppressed += len(alerts)
+		numStormSuppressedNotifications.Add(float64(len(alerts)))
+		_ = level.Debug(l).Log("msg", "Notification collapsed into alert storm summary", "receiver", receiver, "alerts", len(alerts))
+		return ctx, nil, nil
+	}
+	s.storm.lastSummary[receiver] = now
+	numStormSummaries.Inc()
+	return ctx, []*types.Alert{s.summary(now)}, nil
+}
+
+// update forgets the alerts which left the window, and starts or ends the
+// storm depending on the rate of the remaining ones.
+func (s *StormStage) update(l log.Logger, now time.Time) {
+	window := time.Duration(s.conf.Window)
+	for fp, t := range s.seen {
+		if now.Sub(t) >= window {
+			delete(s.seen, fp)
+		}
+	}
+	rate := s.rate()
+	switch {
+	case s.storm == nil && rate > s.conf.MaxAlertsPerSecond:
+		s.storm = &storm{
+			since:       now,
+			alerts:      make(map[model.Fingerprint]struct{}, len(s.seen)),
+			lastSummary: map[string]time.Time{},
+		}
+		for fp := range s.seen {
+			s.storm.alerts[fp] = struct{}{}
+		}
+		numAlertStorms.Inc()
+		_ = level.Warn(l).Log("msg", "Alert storm started, collapsing notifications", "rate", rate)
+	case s.storm != nil && rate <= s.conf.MaxAlertsPerSecond:
+		_ = level.Info(l).Log("msg", "Alert storm ended", "duration", now.Sub(s.storm.since), "alerts", len(s.storm.alerts), "suppressed", s.storm.suppressed)
+		s.storm = nil
+	}
+}
+
+func (s *StormStage) rate() float64 {
+	return float64(len(s.seen)) / time.Duration(s.conf.Window).Seconds()
+}
+
+// summary returns the alert notified instead of the alerts of the storm.
+func (s *StormStage) summary(now time.Time) *types.Alert {
+	return &types.Alert{
+		Alert: model.Alert{
+			Labels: model.LabelSet{
+				model.AlertNameLabel: StormAlertName,
+			},
+			Annotations: model.LabelSet{
+				"summary": model.LabelValue(fmt.Sprintf("Alert storm: %d alerts since %s", len(s.storm.alerts), s.storm.since.UTC().Format(time.RFC3339))),
+				"description": model.LabelValue(fmt.Sprintf("More than %g alerts per second were received. Notifications are collapsed into this summary until the storm ends, %d were suppressed so far.",
+					s.conf.MaxAlertsPerSecond, s.storm.suppressed)),
+				"alert_count": model.LabelValue(fmt.Sprint(len(s.storm.alerts))),
+			},
+			StartsAt: s.storm.since,
+		},
+		UpdatedAt: now,
+	}
+}
+
+// Status returns the status of the ongoing alert storm, or false if there is
+// none.
+func (s *StormStage) Status(l log.Logger) (StormStatus, bool) {
+	if s.conf == nil {
+		return StormStatus{}, false
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.update(l, s.now())
+	if s.storm == nil {
+		return StormStatus{}, false
+	}
+	return StormStatus{
+		Since:      s.storm.since,
+		Rate:       s.rate(),
+		Alerts:     len(s.storm.alerts),
+		Suppressed: s.storm.suppressed,
+	}, true
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultTemplates defines the default templates of the extended
+// integrations. They complement the upstream default templates.
+const DefaultTemplates = `
+{{ define "msteams.default.title" }}{{ template "__subject" . }}{{ end }}
+{{ define "msteams.default.text" }}{{ range .Alerts }}**{{ .Labels.alertname }}**{{ with .Annotations.summary }} - {{ . }}{{ end }}{{ with .Annotations.description }}
+
+{{ . }}{{ end }}
+
+{{ end }}{{ end }}
+
+{{ define "webex.default.message" }}**{{ template "__subject" . }}**
+{{ range .Alerts }}
+- **{{ .Labels.alertname }}**{{ with .Annotations.summary }}: {{ . }}{{ end }}{{ end }}
+{{ end }}
+
+{{ define "googlechat.default.title" }}{{ template "__subject" . }}{{ end }}
+{{ define "googlechat.default.text" }}{{ range .Alerts }}<b>{{ .Labels.alertname }}</b>{{ with .Annotations.summary }} - {{ . }}{{ end }}<br>{{ end }}{{ end }}
+
+{{ define "__severity_color" }}{{ if eq .Status "resolved" }}#2EB886{{ else if eq .CommonLabels.severity "warning" }}#ECB22E{{ else if eq .CommonLabels.severity "info" }}#36C5F0{{ else }}#E01E5A{{ end }}{{ end }}
+
+{{ define "discord.default.title" }}{{ template "__subject" . }}{{ end }}
+{{ define "discord.default.message" }}{{ range .Alerts }}**{{ .Labels.alertname }}**{{ with .Annotations.summary }} - {{ . }}{{ end }}{{ with .Annotations.description }}
+{{ . }}{{ end }}
+{{ end }}{{ end }}
+{{ define "discord.default.color" }}{{ template "__severity_color" . }}{{ end }}
+
+{{ define "mattermost.default.title" }}{{ template "__subject" . }}{{ end }}
+{{ define "mattermost.default.titlelink" }}{{ template "__alertmanagerURL" . }}{{ end }}
+{{ define "mattermost.default.text" }}{{ range .Alerts }}**{{ .Labels.alertname }}**{{ with .Annotations.summary }} - {{ . }}{{ end }}{{ with .Annotations.description }}
+{{ . }}{{ end }}
+{{ end }}{{ end }}
+{{ define "mattermost.default.color" }}{{ template "__severity_color" . }}{{ end }}
+
+{{ define "servicenow.default.short_description" }}{{ template "__subject" . }}{{ end }}
+{{ define "servicenow.default.description" }}{{ template "__text_alert_list" .Alerts }}
+{{ template "__alertmanagerURL" . }}{{ end }}
+{{ define "servicenow.default.close_notes" }}All alerts of the group are resolved.{{ end }}
+
+{{ define "sns.default.subject" }}{{ template "__subject" . }}{{ end }}
+
+{{ define "email.alerts_table.html" }}<table style="border-collapse:collapse;font-family:sans-serif;font-size:14px">
+<tr><th align="left">Status</th><th align="left">Alert</th><th align="left">Summary</th><th align="left">Labels</th><th align="left">Started</th></tr>
+{{ range .Alerts }}<tr>
+<td style="padding:4px 8px;color:{{ if eq .Status "firing" }}#d0021b{{ else }}#417505{{ end }}">{{ .Status }}</td>
+<td style="padding:4px 8px">{{ if .GeneratorURL }}<a href="{{ .GeneratorURL }}">{{ .Labels.alertname }}</a>{{ else }}{{ .Labels.alertname }}{{ end }}</td>
+<td style="padding:4px 8px">{{ .Annotations.summary }}</td>
+<td style="padding:4px 8px">{{ range .Labels.SortedPairs }}{{ if ne .Name "alertname" }}{{ .Name }}={{ .Value }}<br>{{ end }}{{ end }}</td>
+<td style="padding:4px 8px">{{ .StartsAt.Format "2006-01-02 15:04:05 MST" }}</td>
+</tr>
+{{ end }}</table>{{ end }}
+
+{{ define "email.alerts_table.text" }}{{ range .Alerts }}[{{ .Status | toUpper }}] {{ .Labels.alertname }}{{ with .Annotations.summary }}: {{ . }}{{ end }}
+  Labels: {{ range .Labels.SortedPairs }}{{ .Name }}={{ .Value }} {{ end }}
+  Started: {{ .StartsAt.Format "2006-01-02 15:04:05 MST" }}
+{{ end }}{{ end }}
+
+{{ define "twilio.default.message" }}[{{ .Status | toUpper }}] {{ range .Alerts }}{{ .Labels.alertname }}{{ with .Annotations.summary }}: {{ . }}{{ end }}{{ end }}{{ end }}
+`
+
+// WriteDefaultTemplates writes DefaultTemplates to file, so that it can be
+// loaded along with the user templates.
+func WriteDefaultTemplates(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(DefaultTemplates), 0644)
+}
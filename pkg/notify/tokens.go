@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// tokenFetchTimeout bounds a token request, which is shared by the
+	// notifications waiting for it and so not canceled with any of them.
+	tokenFetchTimeout = 30 * time.Second
+	// tokenSweepInterval is how frequently the expired tokens are evicted.
+	tokenSweepInterval = time.Minute
+)
+
+var tokenLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "notifier_token_lookups_total",
+	Help:      "The total number of lookups of the cached access tokens of the notifiers, by integration and whether the token was cached.",
+}, []string{"integration", "result"})
+
+func init() {
+	prometheus.MustRegister(tokenLookups)
+}
+
+// tokenCache holds the access tokens of an integration, shared by all
+// tenants. The tokens are keyed by the hash of the credentials they were
+// issued for, so that tenants only share a token if they use the same
+// credentials. Concurrent notifications missing a token wait for a single
+// request of the token.
+type tokenCache struct {
+	integration string
+
+	mtx       sync.Mutex
+	tokens    map[string]cachedToken
+	calls     map[string]*tokenCall
+	lastSweep time.Time
+}
+
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// tokenCall is a request of a token in flight.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	retry bool
+	err   error
+}
+
+// fetchTokenFunc requests a token with ctx, and returns how long it is valid
+// for and whether to retry on failure.
+type fetchTokenFunc func(ctx context.Context) (token string, ttl time.Duration, retry bool, err error)
+
+func newTokenCache(integration string) *tokenCache {
+	return &tokenCache{
+		integration: integration,
+		tokens:      map[string]cachedToken{},
+		calls:       map[string]*tokenCall{},
+	}
+}
+
+// tokenKey hashes the credentials a token is issued for.
+func tokenKey(credentials ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(credentials, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// fetch returns the token for key, requesting it with fetchToken if none is
+// cached. Only one request per key is in flight, concurrent callers wait
+// for it until ctx is done. The request is not canceled with ctx, as other
+// callers may wait for it, but times out after tokenFetchTimeout. The key
+// must then cover everything fetchToken depends on, like its HTTP client.
+// The returned bool tells whether to retry on failure.
+func (c *tokenCache) fetch(ctx context.Context, key string, fetchToken fetchTokenFunc) (string, bool, error) {
+	c.mtx.Lock()
+	if token, ok := c.lookup(key, time.Now()); ok {
+		c.mtx.Unlock()
+		return token, false, nil
+	}
+	if call, ok := c.calls[key]; ok {
+		c.mtx.Unlock()
+		select {
+		case <-call.done:
+			return call.token, call.retry, call.err
+		case <-ctx.Done():
+			return "", true, ctx.Err()
+		}
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mtx.Unlock()
+
+	go func() {
+		fctx, cancel := context.WithTimeout(context.Background(), tokenFetchTimeout)
+		defer cancel()
+		var ttl time.Duration
+		call.token, ttl, call.retry, call.err = fetchToken(fctx)
+
+		c.mtx.Lock()
+		if call.err == nil {
+			c.tokens[key] = cachedToken{token: call.token, expiresAt: time.Now().Add(ttl)}
+		}
+		delete(c.calls, key)
+		c.mtx.Unlock()
+		close(call.done)
+	}()
+
+	select {
+	case <-call.done:
+		return call.token, call.retry, call.err
+	case <-ctx.Done():
+		return "", true, ctx.Err()
+	}
+}
+
+// get returns the token for key if it is not expired at now.
+func (c *tokenCache) get(key string, now time.Time) (string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.lookup(key, now)
+}
+
+// lookup is get with the lock held.
+func (c *tokenCache) lookup(key string, now time.Time) (string, bool) {
+	c.sweep(now)
+	t, ok := c.tokens[key]
+	if ok && now.Before(t.expiresAt) {
+		tokenLookups.WithLabelValues(c.integration, "hit").Inc()
+		return t.token, true
+	}
+	if ok {
+		delete(c.tokens, key)
+	}
+	tokenLookups.WithLabelValues(c.integration, "miss").Inc()
+	return "", false
+}
+
+// sweep evicts the tokens expired at now, which are otherwise only evicted
+// when looked up again. Must be called with the lock held.
+func (c *tokenCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < tokenSweepInterval {
+		return
+	}
+	c.lastSweep = now
+	for key, t := range c.tokens {
+		if !now.Before(t.expiresAt) {
+			delete(c.tokens, key)
+		}
+	}
+}
+
+// invalidate drops the token for key if it is still token, which was
+// rejected by the service. A token cached since by another notification is
+// kept.
+func (c *tokenCache) invalidate(key, token string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if t, ok := c.tokens[key]; ok && t.token == token {
+		delete(c.tokens, key)
+	}
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	c := newTokenCache("test")
+	ctx := context.Background()
+	tenantA, tenantB := tokenKey("corp", "secret"), tokenKey("corp", "other secret")
+	var fetches int32
+	fetchToken := func(token string, ttl time.Duration) fetchTokenFunc {
+		return func(context.Context) (string, time.Duration, bool, error) {
+			atomic.AddInt32(&fetches, 1)
+			time.Sleep(10 * time.Millisecond)
+			return token, ttl, false, nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tok, _, err := c.fetch(ctx, tenantA, fetchToken("t1", time.Hour)); err != nil || tok != "t1" {
+				t.Errorf("got %q, %v, want t1", tok, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Fatalf("token requested %d times by concurrent notifications, want once", fetches)
+	}
+	if tok, _, _ := c.fetch(ctx, tokenKey("corp", "secret"), fetchToken("t2", time.Hour)); tok != "t1" {
+		t.Fatalf("got %q, want the cached token", tok)
+	}
+	if tok, _, _ := c.fetch(ctx, tenantB, fetchToken("t3", time.Hour)); tok != "t3" {
+		t.Fatalf("token shared between credentials, got %q", tok)
+	}
+
+	c.invalidate(tenantA, "t0")
+	if _, ok := c.get(tenantA, time.Now()); !ok {
+		t.Fatal("newer token invalidated")
+	}
+	c.invalidate(tenantA, "t1")
+	if _, ok := c.get(tenantA, time.Now()); ok {
+		t.Fatal("rejected token kept")
+	}
+	if _, ok := c.get(tenantB, time.Now().Add(time.Hour)); ok {
+		t.Fatal("expired token returned")
+	}
+}
+
+func TestWechatTokenLifetime(t *testing.T) {
+	for _, tc := range []struct {
+		expiresIn int
+		want      time.Duration
+	}{
+		{expiresIn: 7200, want: 2*time.Hour - wechatTokenMargin},
+		{expiresIn: 0, want: wechatTokenTTL - wechatTokenMargin},
+		{expiresIn: 60, want: 30 * time.Second},
+	} {
+		if got := wechatTokenLifetime(tc.expiresIn); got != tc.want {
+			t.Errorf("expires_in %d: got %v, want %v", tc.expiresIn, got, tc.want)
+		}
+	}
+}
+
+func TestTokenCacheDetachedFetch(t *testing.T) {
+	c := newTokenCache("test")
+	key := tokenKey("corp", "secret")
+	release := make(chan struct{})
+	fetchToken := func(ctx context.Context) (string, time.Duration, bool, error) {
+		select {
+		case <-release:
+			return "t1", time.Hour, false, nil
+		case <-ctx.Done():
+			return "", time.Hour, true, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, retry, err := c.fetch(ctx, key, fetchToken); err != context.Canceled || !retry {
+		t.Fatalf("got %v, %v, want the caller canceled and retried", retry, err)
+	}
+	// The request of the canceled caller is still in flight or cached.
+	close(release)
+	tok, _, err := c.fetch(context.Background(), key, func(context.Context) (string, time.Duration, bool, error) {
+		return "t2", time.Hour, false, nil
+	})
+	if err != nil || tok != "t1" {
+		t.Fatalf("got %q, %v, want the token requested for the canceled caller", tok, err)
+	}
+
+	c.mtx.Lock()
+	c.tokens["stale"] = cachedToken{token: "t0", expiresAt: time.Now().Add(-time.Second)}
+	c.lastSweep = time.Time{}
+	c.mtx.Unlock()
+	c.get(key, time.Now())
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, ok := c.tokens["stale"]; ok {
+		t.Fatal("expired token never looked up again not evicted")
+	}
+}
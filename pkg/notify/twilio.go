@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+const (
+	defaultTwilioAPIURL = "https://api.twilio.com/"
+
+	// Twilio concatenates long text messages up to this many characters.
+	twilioMaxMessageLen = 1600
+
+	// twilioSentTTL is how long the messages sent by a failed notification
+	// are remembered for its retries.
+	twilioSentTTL = time.Hour
+)
+
+// Twilio implements a Notifier for Twilio text messages and voice calls.
+type Twilio struct {
+	conf   *TwilioConfig
+	tmpl   *template.Template
+	logger log.Logger
+
+	// sent holds when the messages of the notifications which failed for
+	// some recipients were sent to the others, so that the retries only
+	// send them to the recipients which failed.
+	mtx  sync.Mutex
+	sent map[string]time.Time
+}
+
+// NewTwilio returns a new Twilio notifier.
+func NewTwilio(c *TwilioConfig, t *template.Template, l log.Logger) *Twilio {
+	return &Twilio{conf: c, tmpl: t, logger: l, sent: map[string]time.Time{}}
+}
+
+type twilioMessage struct {
+	To      string `json:"to"`
+	Mode    string `json:"mode"`
+	Message string `json:"message"`
+}
+
+// Render implements the Renderer interface.
+func (n *Twilio) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	return n.messages(ctx, as...)
+}
+
+func (n *Twilio) messages(ctx context.Context, as ...*types.Alert) ([]twilioMessage, error) {
+	var (
+		recv   = receiverName(ctx, n.logger)
+		labels = groupLabels(ctx, n.logger)
+		msgs   []twilioMessage
+	)
+	for _, a := range as {
+		var err error
+		data := n.tmpl.Data(recv, labels, a)
+		msg := tmplText(n.tmpl, data, &err)(n.conf.Message)
+		if err != nil {
+			return nil, err
+		}
+		msg, _ = truncate(msg, twilioMaxMessageLen)
+
+		for _, to := range n.conf.To {
+			msgs = append(msgs, twilioMessage{To: to, Mode: n.conf.Mode, Message: msg})
+		}
+	}
+	return msgs, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Twilio) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msgs, err := n.messages(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	groupKey, _ := notify.GroupKey(ctx)
+	keys := make([]string, len(msgs))
+	for i, msg := range msgs {
+		keys[i] = twilioSentKey(groupKey, i, msg)
+	}
+	for i, msg := range msgs {
+		if n.wasSent(keys[i], time.Now()) {
+			continue
+		}
+		retry, err := n.send(ctx, c, msg.To, msg.Message)
+		if err != nil {
+			if !retry {
+				n.forget(keys)
+			}
+			return retry, err
+		}
+		n.markSent(keys[i], time.Now())
+	}
+	n.forget(keys)
+	return false, nil
+}
+
+// twilioSentKey identifies the ith message of a notification of the group.
+func twilioSentKey(groupKey string, i int, msg twilioMessage) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{groupKey, strconv.Itoa(i), msg.To, msg.Message}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// wasSent tells whether the message was sent by a failed notification
+// being retried. It evicts the messages sent more than twilioSentTTL ago,
+// whose retries were given up.
+func (n *Twilio) wasSent(key string, now time.Time) bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for k, t := range n.sent {
+		if now.Sub(t) >= twilioSentTTL {
+			delete(n.sent, k)
+		}
+	}
+	_, ok := n.sent[key]
+	return ok
+}
+
+func (n *Twilio) markSent(key string, now time.Time) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.sent[key] = now
+}
+
+// forget drops the messages of a notification which is not retried.
+func (n *Twilio) forget(keys []string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for _, k := range keys {
+		delete(n.sent, k)
+	}
+}
+
+func (n *Twilio) send(ctx context.Context, c *http.Client, to, msg string) (bool, error) {
+	params := url.Values{
+		"To":   {to},
+		"From": {n.conf.From},
+	}
+	resource := "Messages.json"
+	if n.conf.Mode == TwilioModeVoice {
+		resource = "Calls.json"
+		params.Set("Twiml", twiml(msg))
+	} else {
+		params.Set("Body", msg)
+	}
+
+	apiURL := defaultTwilioAPIURL
+	if n.conf.APIURL != nil {
+		apiURL = n.conf.APIURL.String()
+	}
+	u := fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s", strings.TrimSuffix(apiURL, "/"), url.PathEscape(n.conf.AccountSID), resource)
+
+	req, err := http.NewRequest("POST", u, strings.NewReader(params.Encode()))
+	if err != nil {
+		return true, err
+	}
+	req.SetBasicAuth(n.conf.AccountSID, string(n.conf.AuthToken))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
+
+// twiml returns the instructions to read msg out loud during a voice call.
+func twiml(msg string) string {
+	var b strings.Builder
+	b.WriteString("<Response><Say>")
+	_ = xml.EscapeText(&b, []byte(msg))
+	b.WriteString("</Say></Response>")
+	return b.String()
+}
+
+func truncate(s string, n int) (string, bool) {
+	r := []rune(s)
+	if len(r) <= n {
+		return s, false
+	}
+	if n <= 3 {
+		return string(r[:n]), true
+	}
+	return string(r[:n-3]) + "...", true
+}
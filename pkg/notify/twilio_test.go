@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+func TestTwilioPartialFailure(t *testing.T) {
+	var (
+		mtx  sync.Mutex
+		sent = map[string]int{}
+		fail = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		to := r.FormValue("To")
+		if to == "+2" && fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		sent[to]++
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	tmpl, err := template.FromGlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.ExternalURL, _ = url.Parse("http://localhost/")
+	n := NewTwilio(&TwilioConfig{
+		HTTPConfig: &commoncfg.HTTPClientConfig{},
+		APIURL:     &config.URL{URL: u},
+		AccountSID: "sid",
+		AuthToken:  "token",
+		To:         []string{"+1", "+2"},
+		Mode:       TwilioModeSMS,
+		Message:    "down",
+	}, tmpl, log.NewNopLogger())
+
+	ctx := notify.WithGroupKey(context.Background(), "group")
+	ctx = notify.WithReceiverName(ctx, "team")
+	ctx = notify.WithGroupLabels(ctx, model.LabelSet{})
+	alert := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}}}
+
+	if retry, err := n.Notify(ctx, alert); err == nil || !retry {
+		t.Fatalf("got %v, %v, want a retried failure", retry, err)
+	}
+	mtx.Lock()
+	fail = false
+	mtx.Unlock()
+	if _, err := n.Notify(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+	if sent["+1"] != 1 || sent["+2"] != 1 {
+		t.Fatalf("retry sent %v, want each recipient notified once", sent)
+	}
+
+	// The next notification is sent to all recipients again.
+	if _, err := n.Notify(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+	if sent["+1"] != 2 || sent["+2"] != 2 {
+		t.Fatalf("sent %v, want each recipient notified twice", sent)
+	}
+}
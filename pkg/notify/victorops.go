@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	victorOpsEventTrigger = "CRITICAL"
+	victorOpsEventResolve = "RECOVERY"
+
+	// victorOpsMaxStateMessageLen is the length VictorOps truncates state
+	// messages to.
+	victorOpsMaxStateMessageLen = 20480
+)
+
+// victorOpsAllowedEvents are the message types of firing alerts.
+var victorOpsAllowedEvents = map[string]bool{
+	"INFO":     true,
+	"WARNING":  true,
+	"CRITICAL": true,
+}
+
+// VictorOps implements a Notifier for VictorOps, like the upstream notifier
+// but sending with newHTTPClient, which enforces the egress policy.
+type VictorOps struct {
+	conf   *config.VictorOpsConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewVictorOps returns a new VictorOps notifier.
+func NewVictorOps(c *config.VictorOpsConfig, t *template.Template, l log.Logger) *VictorOps {
+	return &VictorOps{conf: c, tmpl: t, logger: l}
+}
+
+// Render implements the Renderer interface.
+func (n *VictorOps) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	msg, _, err := n.message(ctx, as...)
+	return msg, err
+}
+
+// message returns the event of the group and its routing key.
+func (n *VictorOps) message(ctx context.Context, as ...*types.Alert) (map[string]string, string, error) {
+	key, ok := notify.GroupKey(ctx)
+	if !ok {
+		return nil, "", errors.New("group key missing")
+	}
+	var err error
+	var (
+		alerts       = types.Alerts(as...)
+		data         = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmpl         = tmplText(n.tmpl, data, &err)
+		messageType  = tmpl(n.conf.MessageType)
+		stateMessage = tmpl(n.conf.StateMessage)
+	)
+	if alerts.Status() == model.AlertFiring && !victorOpsAllowedEvents[messageType] {
+		messageType = victorOpsEventTrigger
+	}
+	if alerts.Status() == model.AlertResolved {
+		messageType = victorOpsEventResolve
+	}
+	stateMessage, truncated := truncate(stateMessage, victorOpsMaxStateMessageLen)
+	if truncated {
+		_ = level.Debug(n.logger).Log("msg", "truncated stateMessage due to VictorOps stateMessage limit", "truncated_state_message", stateMessage, "incident", key)
+	}
+
+	msg := map[string]string{
+		"message_type":        messageType,
+		"entity_id":           hashKey(key),
+		"entity_display_name": tmpl(n.conf.EntityDisplayName),
+		"state_message":       stateMessage,
+		"monitoring_tool":     tmpl(n.conf.MonitoringTool),
+	}
+	for k, v := range n.conf.CustomFields {
+		msg[k] = tmpl(v)
+	}
+	routingKey := tmpl(n.conf.RoutingKey)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "templating error")
+	}
+	return msg, routingKey, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *VictorOps) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, routingKey, err := n.message(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	apiURL := n.conf.APIURL.Copy()
+	apiURL.Path += fmt.Sprintf("%s/%s", n.conf.APIKey, routingKey)
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("POST", apiURL.String(), &buf)
+	if err != nil {
+		return true, redactURL(err)
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	// VictorOps does not document its response codes, only 5xx are
+	// assumed to be recoverable.
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode/100 == 5, errors.Errorf("unexpected status code %v: %s", resp.StatusCode, readErrorBody(resp.Body))
+	}
+	return false, nil
+}
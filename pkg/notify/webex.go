@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// webexMessagesURL is the URL of the Webex messages API, used unless the
+// api_url is set.
+const webexMessagesURL = "https://webexapis.com/v1/messages"
+
+// webexMaxMessageLen is the maximum length of Webex messages.
+const webexMaxMessageLen = 7439
+
+// Webex implements a Notifier for Cisco Webex, posting markdown messages to
+// a room as a bot.
+type Webex struct {
+	conf   *WebexConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewWebex returns a new Webex notifier.
+func NewWebex(c *WebexConfig, t *template.Template, l log.Logger) *Webex {
+	return &Webex{conf: c, tmpl: t, logger: l}
+}
+
+type webexMessage struct {
+	RoomID   string `json:"roomId"`
+	Markdown string `json:"markdown"`
+}
+
+// Render implements the Renderer interface.
+func (n *Webex) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	msg := &webexMessage{
+		RoomID:   tmplText(n.conf.RoomID),
+		Markdown: tmplText(n.conf.Message),
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg.Markdown, _ = truncate(msg.Markdown, webexMaxMessageLen)
+	return msg, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Webex) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.Render(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+
+	u := webexMessagesURL
+	if n.conf.APIURL != nil {
+		u = n.conf.APIURL.String()
+	}
+	req, err := http.NewRequest("POST", u, &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+	req.Header.Set("Authorization", "Bearer "+string(n.conf.BotToken))
+
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
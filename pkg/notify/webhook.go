@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Webhook implements a Notifier for generic webhooks.
+type Webhook struct {
+	conf   *WebhookConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewWebhook returns a new Webhook.
+func NewWebhook(c *WebhookConfig, t *template.Template, l log.Logger) *Webhook {
+	return &Webhook{conf: c, tmpl: t, logger: l}
+}
+
+// Render implements the Renderer interface.
+func (w *Webhook) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	payloads, _, err := w.payloads(ctx, as...)
+	if err != nil {
+		return nil, err
+	}
+	if len(payloads) == 1 {
+		return json.RawMessage(payloads[0].body), nil
+	}
+	bodies := make([]json.RawMessage, 0, len(payloads))
+	for _, p := range payloads {
+		bodies = append(bodies, p.body)
+	}
+	return bodies, nil
+}
+
+// Notify implements the Notifier interface.
+func (w *Webhook) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	payloads, data, err := w.payloads(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := newHTTPClient(ctx, *w.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// All requests are sent again on retries, receivers of requests per
+	// alert have to handle duplicates.
+	for _, p := range payloads {
+		if retry, err := w.send(ctx, c, p, data); err != nil {
+			return retry, err
+		}
+	}
+	return false, nil
+}
+
+func (w *Webhook) send(ctx context.Context, c *http.Client, p webhookPayload, data *template.Data) (bool, error) {
+	req, err := http.NewRequest("POST", w.conf.URL.String(), bytes.NewReader(p.body))
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", p.contentType)
+	req.Header.Set("User-Agent", userAgentHeader)
+	if err := w.setHeaders(req, data); err != nil {
+		return false, err
+	}
+	if s := w.conf.Signing; s != nil && FeatureEnabled(ctx, FeatureWebhookSigning) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(s.TimestampHeader, ts)
+		req.Header.Set(s.SignatureHeader, signWebhook(string(s.Secret), ts, p.body))
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	return retryHTTP(resp.StatusCode, resp.Body)
+}
+
+// webhookPayload is the body of a webhook request.
+type webhookPayload struct {
+	contentType string
+	body        []byte
+}
+
+// webhookAlertMessage is the message of a single alert sent with the
+// per_alert payload format.
+type webhookAlertMessage struct {
+	Version     string `json:"version"`
+	GroupKey    string `json:"groupKey"`
+	Receiver    string `json:"receiver"`
+	ExternalURL string `json:"externalURL"`
+	Fingerprint string `json:"fingerprint"`
+	template.Alert
+}
+
+// cloudEvent is a CloudEvents 1.0 event in the structured JSON format.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+const (
+	contentTypeCloudEvents = "application/cloudevents+json; charset=utf-8"
+	cloudEventTypePrefix   = "dev.searchlight.alertmanager.alerts."
+)
+
+// payloads returns the request bodies of the alerts in the payload format of
+// the webhook.
+func (w *Webhook) payloads(ctx context.Context, as ...*types.Alert) ([]webhookPayload, *template.Data, error) {
+	msg, data, err := webhookMessage(ctx, w.tmpl, w.logger, as...)
+	if err != nil {
+		return nil, nil, err
+	}
+	groupKey, _ := notify.GroupKey(ctx)
+
+	switch w.conf.PayloadFormat {
+	case WebhookPayloadPerAlert:
+		payloads := make([]webhookPayload, 0, len(as))
+		for i, a := range data.Alerts {
+			body, err := json.Marshal(&webhookAlertMessage{
+				Version:     "4",
+				GroupKey:    groupKey,
+				Receiver:    data.Receiver,
+				ExternalURL: data.ExternalURL,
+				Fingerprint: as[i].Fingerprint().String(),
+				Alert:       a,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			payloads = append(payloads, webhookPayload{contentType: contentTypeJSON, body: body})
+		}
+		return payloads, data, nil
+
+	case WebhookPayloadCloudEvents:
+		now := time.Now().UTC()
+		source := data.ExternalURL
+		if source == "" {
+			source = "alertmanager"
+		}
+		// The ID is unique per attempt, as the event is sent at a new time.
+		h := sha256.New()
+		h.Write([]byte(now.Format(time.RFC3339Nano)))
+		h.Write(msg)
+		body, err := json.Marshal(&cloudEvent{
+			SpecVersion:     "1.0",
+			ID:              hex.EncodeToString(h.Sum(nil))[:32],
+			Source:          source,
+			Type:            cloudEventTypePrefix + data.Status,
+			Subject:         groupKey,
+			Time:            now,
+			DataContentType: contentTypeJSON,
+			Data:            msg,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return []webhookPayload{{contentType: contentTypeCloudEvents, body: body}}, data, nil
+	}
+	return []webhookPayload{{contentType: contentTypeJSON, body: msg}}, data, nil
+}
+
+// setHeaders sets the templated custom and authorization headers.
+func (w *Webhook) setHeaders(req *http.Request, data *template.Data) error {
+	var err error
+	tmpl := tmplText(w.tmpl, data, &err)
+	for name, value := range w.conf.Headers {
+		req.Header.Set(name, tmpl(value))
+	}
+	if w.conf.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+tmpl(string(w.conf.BearerToken)))
+	}
+	if ba := w.conf.BasicAuth; ba != nil {
+		req.SetBasicAuth(tmpl(ba.Username), tmpl(string(ba.Password)))
+	}
+	return err
+}
+
+// signWebhook returns the signature of a webhook request, which receivers
+// verify by computing the HMAC-SHA256 of "<timestamp>.<body>" with the
+// shared secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookMessage returns the JSON encoded webhook message of the alerts, as
+// it would be sent by the upstream webhook integration.
+func webhookMessage(ctx context.Context, tmpl *template.Template, l log.Logger, as ...*types.Alert) ([]byte, *template.Data, error) {
+	data := tmpl.Data(receiverName(ctx, l), groupLabels(ctx, l), as...)
+
+	groupKey, ok := notify.GroupKey(ctx)
+	if !ok {
+		_ = level.Error(l).Log("msg", "group key missing")
+	}
+
+	msg, err := json.Marshal(&notify.WebhookMessage{
+		Version:  "4",
+		Data:     data,
+		GroupKey: groupKey,
+	})
+	return msg, data, err
+}
@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+)
+
+const (
+	// wechatTokenTTL is how long the access tokens of Wechat are cached if
+	// the API does not tell when they expire.
+	wechatTokenTTL = 2 * time.Hour
+	// wechatTokenMargin is how long before their expiry the access tokens
+	// are requested again, so that they do not expire in flight.
+	wechatTokenMargin = 5 * time.Minute
+	// wechatTokenExpired and wechatTokenInvalid are the error codes of
+	// Wechat for rejected access tokens.
+	wechatTokenExpired = 42001
+	wechatTokenInvalid = 40014
+)
+
+// wechatTokens are the access tokens of Wechat, shared by all tenants.
+var wechatTokens = newTokenCache("wechat")
+
+// Wechat implements a Notifier for Wechat, like the upstream notifier but
+// with the access tokens shared by the notifiers of all tenants using the
+// same credentials. A token is requested once for concurrent notifications,
+// and cached until shortly before the expiry reported by the API.
+type Wechat struct {
+	conf   *config.WechatConfig
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// NewWechat returns a new Wechat notifier.
+func NewWechat(c *config.WechatConfig, t *template.Template, l log.Logger) *Wechat {
+	return &Wechat{conf: c, tmpl: t, logger: l}
+}
+
+type wechatToken struct {
+	wechatResponse
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is the lifetime of the token in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+type wechatMessage struct {
+	Text    wechatMessageContent `json:"text,omitempty"`
+	ToUser  string               `json:"touser,omitempty"`
+	ToParty string               `json:"toparty,omitempty"`
+	Totag   string               `json:"totag,omitempty"`
+	AgentID string               `json:"agentid,omitempty"`
+	Safe    string               `json:"safe,omitempty"`
+	Type    string               `json:"msgtype,omitempty"`
+}
+
+type wechatMessageContent struct {
+	Content string `json:"content"`
+}
+
+type wechatResponse struct {
+	Code  int    `json:"errcode"`
+	Error string `json:"errmsg"`
+}
+
+// Render implements the Renderer interface.
+func (n *Wechat) Render(ctx context.Context, as ...*types.Alert) (interface{}, error) {
+	var err error
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+	)
+
+	msg := &wechatMessage{
+		Text: wechatMessageContent{
+			Content: tmplText(n.conf.Message),
+		},
+		ToUser:  tmplText(n.conf.ToUser),
+		ToParty: tmplText(n.conf.ToParty),
+		Totag:   tmplText(n.conf.ToTag),
+		AgentID: tmplText(n.conf.AgentID),
+		Type:    "text",
+		Safe:    "0",
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Notify implements the Notifier interface.
+func (n *Wechat) Notify(ctx context.Context, as ...*types.Alert) (bool, error) {
+	msg, err := n.Render(ctx, as...)
+	if err != nil {
+		return false, err
+	}
+	c, err := newHTTPClient(ctx, *n.conf.HTTPConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// The credentials are templates for compatibility with the upstream
+	// notifier.
+	var (
+		data     = n.tmpl.Data(receiverName(ctx, n.logger), groupLabels(ctx, n.logger), as...)
+		tmplText = tmplText(n.tmpl, data, &err)
+		corpID   = tmplText(n.conf.CorpID)
+		secret   = tmplText(string(n.conf.APISecret))
+	)
+	if err != nil {
+		return false, err
+	}
+	// The token is requested with the client of the first notification
+	// missing it, so only notifications using the same client share it.
+	key := tokenKey(clientCacheKey(*n.conf.HTTPConfig, httpClientSettings(ctx)), n.conf.APIURL.String(), corpID, secret)
+	token, retry, err := wechatTokens.fetch(ctx, key, func(ctx context.Context) (string, time.Duration, bool, error) {
+		return n.fetchToken(ctx, c, corpID, secret)
+	})
+	if err != nil {
+		return retry, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return false, err
+	}
+	u := n.conf.APIURL.Copy()
+	u.Path += "message/send"
+	q := u.Query()
+	q.Set("access_token", token)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), &buf)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+	_ = level.Debug(n.logger).Log("msg", "response: "+string(body))
+	if resp.StatusCode != http.StatusOK {
+		return true, errors.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+
+	var wResp wechatResponse
+	if err := json.Unmarshal(body, &wResp); err != nil {
+		return true, err
+	}
+	// https://work.weixin.qq.com/api/doc#10649
+	switch wResp.Code {
+	case 0:
+		return false, nil
+	case wechatTokenExpired, wechatTokenInvalid:
+		wechatTokens.invalidate(key, token)
+		return true, errors.New(wResp.Error)
+	default:
+		return false, errors.New(wResp.Error)
+	}
+}
+
+// fetchToken requests an access token for the credentials, and returns how
+// long it is valid for and whether to retry on failure.
+func (n *Wechat) fetchToken(ctx context.Context, c *http.Client, corpID, secret string) (string, time.Duration, bool, error) {
+	params := url.Values{}
+	params.Add("corpsecret", secret)
+	params.Add("corpid", corpID)
+	u := n.conf.APIURL.Copy()
+	u.Path += "gettoken"
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", 0, true, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgentHeader)
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", 0, true, redactURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, true, errors.Errorf("unexpected status code %v requesting an access token", resp.StatusCode)
+	}
+
+	var t wechatToken
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", 0, false, err
+	}
+	if t.Code != 0 || t.AccessToken == "" {
+		return "", 0, false, errors.Errorf("invalid api_secret for corp_id %s: %s", corpID, t.Error)
+	}
+	return t.AccessToken, wechatTokenLifetime(t.ExpiresIn), false, nil
+}
+
+// wechatTokenLifetime returns how long to cache a token expiring in the
+// given seconds.
+func wechatTokenLifetime(expiresIn int) time.Duration {
+	ttl := time.Duration(expiresIn) * time.Second
+	if ttl <= 0 {
+		ttl = wechatTokenTTL
+	}
+	if ttl > 2*wechatTokenMargin {
+		return ttl - wechatTokenMargin
+	}
+	return ttl / 2
+}
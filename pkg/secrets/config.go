@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// Config configures the secret stores references are resolved from. No
+// references can be resolved if none is configured.
+type Config struct {
+	VaultAddress   string
+	VaultTokenFile string
+	Kubernetes     bool
+	// UserScoped restricts the references of users to their own secrets.
+	UserScoped bool
+}
+
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet
+func (c *Config) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&c.VaultAddress, "secrets.vault.address", "", "Address of the Vault server vault: references are resolved from. Disabled if empty.")
+	f.StringVar(&c.VaultTokenFile, "secrets.vault.token-file", "", "File holding the Vault token, read on every request.")
+	f.BoolVar(&c.Kubernetes, "secrets.kubernetes.enabled", false, "Resolve k8s-secret: references with the service account of the pod.")
+	f.BoolVar(&c.UserScoped, "secrets.user-scoped", true, "Only resolve the Vault secrets below <mount>/<user> and the Kubernetes secrets in the namespace <user>.")
+}
+
+func (c *Config) Validate() error {
+	if c.VaultAddress != "" && c.VaultTokenFile == "" {
+		return errors.New("--secrets.vault.token-file must be non empty")
+	}
+	return nil
+}
+
+// NewResolvers returns the resolvers of the configured secret stores.
+func NewResolvers(c *Config) (Resolvers, error) {
+	rs := Resolvers{}
+	if c.VaultAddress != "" {
+		rs[SchemeVault] = NewVault(c.VaultAddress, c.VaultTokenFile, c.UserScoped)
+	}
+	if c.Kubernetes {
+		k, err := NewKubernetes(c.UserScoped)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create kubernetes secret resolver")
+		}
+		rs[SchemeKubernetes] = k
+	}
+	return rs, nil
+}
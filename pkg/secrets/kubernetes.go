@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Files of the service account mounted into pods.
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// KubernetesClient makes requests to the Kubernetes API, using the service
+// account of the pod it runs in.
+type KubernetesClient struct {
+	host   string
+	client *http.Client
+}
+
+// NewKubernetesClient creates a KubernetesClient. It must run in a pod.
+func NewKubernetesClient() (*KubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes pod")
+	}
+	ca, err := ioutil.ReadFile(serviceAccountCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service account CA file")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates found in service account CA file")
+	}
+	return &KubernetesClient{
+		host: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// Get gets the object at path, e.g. /api/v1/namespaces/default/secrets/foo,
+// and decodes it into v.
+func (c *KubernetesClient) Get(ctx context.Context, path string, v interface{}) error {
+	// The token is read on every request, as it is rotated by the kubelet.
+	token, err := ioutil.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read service account token")
+	}
+	req, err := http.NewRequest(http.MethodGet, c.host+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "failed to decode response")
+	}
+	return nil
+}
+
+// Kubernetes resolves references to keys of Kubernetes secrets, using the
+// service account of the pod it runs in.
+type Kubernetes struct {
+	// userScoped requires the secrets to be in the namespace named after
+	// the user ID.
+	userScoped bool
+	client     *KubernetesClient
+}
+
+// NewKubernetes creates a Kubernetes resolver. It must run in a pod.
+func NewKubernetes(userScoped bool) (*Kubernetes, error) {
+	client, err := NewKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	return &Kubernetes{userScoped: userScoped, client: client}, nil
+}
+
+// Resolve resolves a reference of the form <namespace>/<name>/<key>.
+func (k *Kubernetes) Resolve(ctx context.Context, userID, ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", errors.New("reference must be <namespace>/<name>/<key>")
+	}
+	ns, name, key := parts[0], parts[1], parts[2]
+	if ns == "." || ns == ".." || name == "." || name == ".." {
+		return "", errors.New("reference must not have dot segments")
+	}
+	if k.userScoped && ns != userID {
+		return "", errors.Errorf("namespace must be %s", userID)
+	}
+
+	// The values are base64 encoded, which []byte is decoded from.
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", url.PathEscape(ns), url.PathEscape(name))
+	if err := k.client.Get(ctx, path, &secret); err != nil {
+		return "", errors.Wrap(err, "failed to get secret")
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", errors.Errorf("secret has no key %s", key)
+	}
+	return string(value), nil
+}
@@ -0,0 +1,143 @@
+package secrets
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Schemes of the secret references, which are written as <scheme>:<ref> in
+// place of a secret in the global section or the receivers of a config.
+const (
+	// SchemeVault references a field of a Vault KV v2 secret as
+	// <mount>/<path>#<field>, e.g. vault:kv/team1#slack_url.
+	SchemeVault = "vault"
+	// SchemeKubernetes references a key of a Kubernetes secret as
+	// <namespace>/<name>/<key>, e.g. k8s-secret:team1/slack/url.
+	SchemeKubernetes = "k8s-secret"
+)
+
+var schemes = map[string]bool{
+	SchemeVault:      true,
+	SchemeKubernetes: true,
+}
+
+// placeholder replaces references when configs are only validated. It is a
+// valid URL, so that it is accepted by secret URL fields too.
+const placeholder = "https://secret.invalid/"
+
+// A Resolver resolves references to the secrets kept in an external store.
+type Resolver interface {
+	// Resolve returns the secret ref points to. ref is the reference
+	// without its scheme, userID the user whose config holds it.
+	Resolve(ctx context.Context, userID, ref string) (string, error)
+}
+
+// Resolvers resolve references by their scheme.
+type Resolvers map[string]Resolver
+
+// parseReference returns the scheme and the reference of s, if s is a
+// reference.
+func parseReference(s string) (string, string, bool) {
+	i := strings.Index(s, ":")
+	if i < 0 || !schemes[s[:i]] {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// IsReference returns true if s is a reference to a secret.
+func IsReference(s string) bool {
+	_, _, ok := parseReference(s)
+	return ok
+}
+
+// Resolve replaces the references in the global section and the receivers of
+// the config cfg of a user by the secrets they point to. cfg is returned as is
+// if it holds no references.
+func (rs Resolvers) Resolve(ctx context.Context, userID, cfg string) (string, error) {
+	return replaceReferences(cfg, func(scheme, ref string) (string, error) {
+		r, ok := rs[scheme]
+		if !ok {
+			return "", errors.Errorf("secret store %s is not configured", scheme)
+		}
+		secret, err := r.Resolve(ctx, userID, ref)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve %s:%s", scheme, ref)
+		}
+		return secret, nil
+	})
+}
+
+// Mask replaces the references in cfg by a placeholder, so that it can be
+// validated without resolving them. cfg is returned as is if it can not be
+// parsed.
+func Mask(cfg string) string {
+	masked, err := replaceReferences(cfg, func(_, _ string) (string, error) {
+		return placeholder, nil
+	})
+	if err != nil {
+		return cfg
+	}
+	return masked
+}
+
+func replaceReferences(cfg string, f func(scheme, ref string) (string, error)) (string, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cfg), &raw); err != nil {
+		return "", err
+	}
+	found := false
+	for i, item := range raw {
+		if item.Key != "global" && item.Key != "receivers" {
+			continue
+		}
+		v, err := replace(item.Value, func(s string) (string, error) {
+			scheme, ref, ok := parseReference(s)
+			if !ok {
+				return s, nil
+			}
+			found = true
+			return f(scheme, ref)
+		})
+		if err != nil {
+			return "", err
+		}
+		raw[i].Value = v
+	}
+	if !found {
+		return cfg, nil
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// replace replaces the strings in the YAML value v by f.
+func replace(v interface{}, f func(string) (string, error)) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return f(v)
+	case yaml.MapSlice:
+		for i := range v {
+			r, err := replace(v[i].Value, f)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = r
+		}
+	case []interface{}:
+		for i := range v {
+			r, err := replace(v[i], f)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = r
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Vault resolves references to fields of Vault KV v2 secrets.
+type Vault struct {
+	address   string
+	tokenFile string
+	// userScoped requires the path of the secrets to start with the user ID.
+	userScoped bool
+	client     *http.Client
+}
+
+func NewVault(address, tokenFile string, userScoped bool) *Vault {
+	return &Vault{
+		address:    strings.TrimRight(address, "/"),
+		tokenFile:  tokenFile,
+		userScoped: userScoped,
+		client:     &http.Client{},
+	}
+}
+
+// Resolve resolves a reference of the form <mount>/<path>#<field>.
+func (v *Vault) Resolve(ctx context.Context, userID, ref string) (string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i < 0 {
+		return "", errors.New("missing field")
+	}
+	secretPath, field := ref[:i], ref[i+1:]
+	parts := strings.SplitN(secretPath, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", errors.New("path must be <mount>/<path>")
+	}
+	mount, p := parts[0], parts[1]
+	// Every segment is checked and escaped, so that the user scope can not
+	// be left through dot segments.
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", errors.New("path must not have empty or dot segments")
+		}
+		segments[i] = url.PathEscape(seg)
+	}
+	if mount == "." || mount == ".." {
+		return "", errors.New("path must not have empty or dot segments")
+	}
+	if v.userScoped && segments[0] != url.PathEscape(userID) {
+		return "", errors.Errorf("path must be below %s/%s", mount, userID)
+	}
+
+	// The token is read on every request, so that it can be rotated.
+	token, err := ioutil.ReadFile(v.tokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read vault token")
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s/data/%s", v.address, url.PathEscape(mount), strings.Join(segments, "/")), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	resp, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", errors.Wrap(err, "failed to decode secret")
+	}
+	value, ok := secret.Data.Data[field].(string)
+	if !ok {
+		return "", errors.Errorf("secret has no field %s", field)
+	}
+	return value, nil
+}
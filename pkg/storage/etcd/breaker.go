@@ -0,0 +1,135 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	am "go.searchlight.dev/alertmanager/pkg/alertmanager"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	breakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "appscode",
+		Name:      "etcd_breaker_open",
+		Help:      "Whether requests to etcd are rejected because it is degraded.",
+	})
+	breakerRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "appscode",
+		Name:      "etcd_breaker_rejected_requests_total",
+		Help:      "The total number of requests to etcd rejected while the breaker was open.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(breakerOpen, breakerRejected)
+}
+
+// breaker rejects requests for a while after consecutive requests failed,
+// so that callers fail fast instead of piling up on a degraded etcd. Once
+// the open duration passed, a single request is let through to probe etcd.
+type breaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mtx       sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, openDuration time.Duration) *breaker {
+	return &breaker{threshold: threshold, openDuration: openDuration}
+}
+
+// allow returns true if a request may be made, and the time until it may be
+// retried otherwise.
+func (b *breaker) allow() (time.Duration, bool) {
+	if b.threshold <= 0 {
+		return 0, true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.failures < b.threshold {
+		return 0, true
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return wait, false
+	}
+	if b.probing {
+		return b.openDuration, false
+	}
+	b.probing = true
+	return 0, true
+}
+
+// record records the outcome of a request.
+func (b *breaker) record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		breakerOpen.Set(0)
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.openDuration)
+		breakerOpen.Set(1)
+	}
+}
+
+// do runs a request to etcd bounded by the request timeout, unless the
+// breaker is open. Failures caused by etcd being unavailable are returned as
+// am.StorageUnavailableError.
+func (c *Client) do(ctx context.Context, f func(ctx context.Context) error) error {
+	if wait, ok := c.breaker.allow(); !ok {
+		breakerRejected.Inc()
+		return &am.StorageUnavailableError{RetryAfter: wait}
+	}
+
+	reqCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	err := f(reqCtx)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which tells nothing about etcd.
+		return err
+	}
+	unavailable := isUnavailable(err)
+	c.breaker.record(unavailable)
+	if unavailable {
+		return &am.StorageUnavailableError{RetryAfter: c.breaker.openDuration, Err: err}
+	}
+	return err
+}
+
+// isUnavailable returns true if err is caused by etcd being unreachable or
+// too slow to answer.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	// The client converts gRPC errors to etcd errors, which keep the code.
+	code := status.Code(err)
+	if e, ok := err.(interface{ Code() codes.Code }); ok {
+		code = e.Code()
+	}
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
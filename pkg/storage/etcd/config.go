@@ -1,12 +1,49 @@
 package etcd
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 )
 
 type Config struct {
-	Endpoints []string
+	Endpoints      []string
+	DialTimeout    time.Duration
+	RequestTimeout time.Duration
+
+	DialKeepAliveTime    time.Duration
+	DialKeepAliveTimeout time.Duration
+
+	// TLS is used if any of the files is set. The client certificate is
+	// optional, the system roots are trusted without a CA file.
+	CertFile           string
+	KeyFile            string
+	CAFile             string
+	InsecureSkipVerify bool
+
+	Username     string
+	PasswordFile string
+
+	// Requests are rejected for BreakerOpenDuration after BreakerFailures
+	// consecutive requests failed because Etcd was unavailable.
+	BreakerFailures     int
+	BreakerOpenDuration time.Duration
+
+	// Prefix namespaces all keys, so that several deployments can share an
+	// etcd cluster.
+	Prefix string
+
+	// ApplyStatusTTL is the time the apply statuses stored by a replica are
+	// kept once it stopped.
+	ApplyStatusTTL time.Duration
+
+	// HistoryRetention is the time the archived alert groups are kept.
+	HistoryRetention time.Duration
 }
 
 func NewConfig() *Config {
@@ -16,11 +53,98 @@ func NewConfig() *Config {
 // AddFlags adds the flags required to config this to the given FlagSet
 func (c *Config) AddFlags(f *pflag.FlagSet) {
 	f.StringArrayVar(&c.Endpoints, "etcd.endpoints", []string{}, "Endpoints of Etcd cluster.")
+	f.DurationVar(&c.DialTimeout, "etcd.dial-timeout", 10*time.Second, "Timeout for establishing a connection to Etcd.")
+	f.DurationVar(&c.RequestTimeout, "etcd.request-timeout", 10*time.Second, "Timeout for a single request to Etcd. The deadline of the caller's context is honoured if it is shorter.")
+	f.DurationVar(&c.DialKeepAliveTime, "etcd.dial-keepalive-time", 30*time.Second, "Time after which the client pings Etcd to check that the connection is alive. Disabled if 0.")
+	f.DurationVar(&c.DialKeepAliveTimeout, "etcd.dial-keepalive-timeout", 10*time.Second, "Time the client waits for a response to the keepalive ping before closing the connection.")
+	f.StringVar(&c.CertFile, "etcd.cert-file", "", "Client certificate file for TLS connections to Etcd.")
+	f.StringVar(&c.KeyFile, "etcd.key-file", "", "Client key file for TLS connections to Etcd.")
+	f.StringVar(&c.CAFile, "etcd.ca-file", "", "CA file verifying the certificate of Etcd. The system roots are used if empty.")
+	f.BoolVar(&c.InsecureSkipVerify, "etcd.insecure-skip-verify", false, "Skip verifying the certificate of Etcd.")
+	f.StringVar(&c.Username, "etcd.username", "", "Username for Etcd authentication.")
+	f.StringVar(&c.PasswordFile, "etcd.password-file", "", "File holding the password for Etcd authentication.")
+	f.IntVar(&c.BreakerFailures, "etcd.breaker-failures", 5, "Consecutive failed requests after which requests to Etcd are rejected for --etcd.breaker-open-duration. Disabled if 0.")
+	f.DurationVar(&c.BreakerOpenDuration, "etcd.breaker-open-duration", 30*time.Second, "Time requests to Etcd are rejected for once the breaker opened, before a request is let through to probe it.")
+	f.StringVar(&c.Prefix, "etcd.prefix", "", "Prefix of all keys, separating deployments which share an Etcd cluster.")
+	f.DurationVar(&c.ApplyStatusTTL, "etcd.apply-status-ttl", time.Minute, "Time the config apply statuses stored by a replica are kept once it stopped or lost its connection to Etcd.")
+	f.DurationVar(&c.HistoryRetention, "etcd.history-retention", 30*24*time.Hour, "Time the resolved alert groups archived for the alert history are kept.")
 }
 
 func (c *Config) Validate() error {
 	if len(c.Endpoints) == 0 {
 		return errors.New("--etcd.endpoints must be non empty")
 	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("--etcd.cert-file and --etcd.key-file must be set together")
+	}
+	if (c.Username == "") != (c.PasswordFile == "") {
+		return errors.New("--etcd.username and --etcd.password-file must be set together")
+	}
+	if c.DialKeepAliveTime < 0 || c.DialKeepAliveTimeout < 0 {
+		return errors.New("--etcd.dial-keepalive-time and --etcd.dial-keepalive-timeout must not be negative")
+	}
+	if c.BreakerFailures < 0 {
+		return errors.New("--etcd.breaker-failures must not be negative")
+	}
+	if c.BreakerFailures > 0 && c.BreakerOpenDuration <= 0 {
+		return errors.New("--etcd.breaker-open-duration must be positive")
+	}
+	if c.ApplyStatusTTL < time.Second {
+		return errors.New("--etcd.apply-status-ttl must be at least 1s")
+	}
+	if c.HistoryRetention < time.Minute {
+		return errors.New("--etcd.history-retention must be at least 1m")
+	}
 	return nil
 }
+
+// keyPrefix returns the prefix of all keys, which ends with a slash unless
+// it is empty.
+func (c *Config) keyPrefix() string {
+	p := strings.Trim(c.Prefix, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// tlsConfig returns the TLS configuration of the client, or nil if TLS is
+// not used.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.CertFile == "" && c.CAFile == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load etcd client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read etcd CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in etcd CA file")
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// password returns the password of the Etcd user, or "" if authentication
+// is not used.
+func (c *Config) password() (string, error) {
+	if c.PasswordFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(c.PasswordFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read etcd password file")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
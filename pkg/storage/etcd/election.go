@@ -0,0 +1,172 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/clientv3"
+)
+
+// The key holding the advertised value of the leader, attached to its lease.
+const leaderKey = "alertmanager/leader"
+
+// Election elects a single leader among the replicas sharing an etcd
+// cluster. The leader holds leaderKey attached to a lease it keeps alive, so
+// that the key is removed once the leader stops or is partitioned for the
+// lease TTL.
+type Election struct {
+	c   *Client
+	ttl time.Duration
+
+	mtx    sync.Mutex
+	lease  clientv3.LeaseID
+	cancel context.CancelFunc
+}
+
+// NewElection creates an Election whose leader holds a lease of ttl.
+func NewElection(c *Client, ttl time.Duration) *Election {
+	return &Election{c: c, ttl: ttl}
+}
+
+// Campaign blocks until this replica is the leader advertising value, or ctx
+// is done. The returned channel is closed once the leadership is lost.
+func (e *Election) Campaign(ctx context.Context, value string) (<-chan struct{}, error) {
+	// The lease of a lost leadership is given up first.
+	e.mtx.Lock()
+	prevLease, prevCancel := e.lease, e.cancel
+	e.lease, e.cancel = 0, nil
+	e.mtx.Unlock()
+	if prevCancel != nil {
+		prevCancel()
+		e.revoke(prevLease)
+	}
+
+	ttl := int64(e.ttl / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	var lease *clientv3.LeaseGrantResponse
+	err := e.c.do(ctx, func(ctx context.Context) (err error) {
+		lease, err = e.c.cl.Grant(ctx, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to grant leader lease")
+	}
+
+	kaCtx, cancel := context.WithCancel(context.Background())
+	keepAlive, err := e.c.cl.KeepAlive(kaCtx, lease.ID)
+	if err != nil {
+		cancel()
+		e.revoke(lease.ID)
+		return nil, errors.Wrap(err, "failed to keep leader lease alive")
+	}
+	lost := make(chan struct{})
+	go func() {
+		for range keepAlive {
+		}
+		close(lost)
+	}()
+
+	key := e.c.prefix + leaderKey
+	for {
+		var resp *clientv3.TxnResponse
+		err := e.c.do(ctx, func(ctx context.Context) (err error) {
+			resp, err = e.c.kv.Txn(ctx).
+				If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+				Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+				Commit()
+			return err
+		})
+		if err != nil {
+			cancel()
+			e.revoke(lease.ID)
+			return nil, errors.Wrap(err, "failed to campaign for leadership")
+		}
+		if resp.Succeeded {
+			break
+		}
+		if err := e.waitDeleted(ctx, key, resp.Header.Revision, lost); err != nil {
+			cancel()
+			e.revoke(lease.ID)
+			return nil, err
+		}
+	}
+
+	e.mtx.Lock()
+	e.lease = lease.ID
+	e.cancel = cancel
+	e.mtx.Unlock()
+	return lost, nil
+}
+
+// waitDeleted waits until key is deleted after rev.
+func (e *Election) waitDeleted(ctx context.Context, key string, rev int64, lost <-chan struct{}) error {
+	wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	watcher := e.c.cl.Watch(wctx, key, clientv3.WithRev(rev+1))
+	for {
+		select {
+		case resp, ok := <-watcher:
+			if !ok {
+				return errors.New("leader watch closed")
+			}
+			if err := resp.Err(); err != nil {
+				return errors.Wrap(err, "failed to watch leader")
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == clientv3.EventTypeDelete {
+					return nil
+				}
+			}
+		case <-lost:
+			return errors.New("leader lease expired while campaigning")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Resign gives up the leadership, if this replica holds it.
+func (e *Election) Resign(ctx context.Context) error {
+	e.mtx.Lock()
+	lease, cancel := e.lease, e.cancel
+	e.lease, e.cancel = 0, nil
+	e.mtx.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	// Revoking the lease deletes the leader key.
+	return e.c.do(ctx, func(ctx context.Context) error {
+		_, err := e.c.cl.Revoke(ctx, lease)
+		return err
+	})
+}
+
+// Leader returns the value advertised by the leader, or "" if there is none.
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	var resp *clientv3.GetResponse
+	err := e.c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = e.c.kv.Get(ctx, e.c.prefix+leaderKey)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// revoke revokes a lease which is no longer used, it expires anyway if this
+// fails.
+func (e *Election) revoke(lease clientv3.LeaseID) {
+	_ = e.c.do(context.Background(), func(ctx context.Context) error {
+		_, err := e.c.cl.Revoke(ctx, lease)
+		return err
+	})
+}
@@ -2,8 +2,11 @@ package etcd
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	am "go.searchlight.dev/alertmanager/pkg/alertmanager"
@@ -11,6 +14,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.etcd.io/etcd/clientv3"
 	"gopkg.in/yaml.v2"
 )
@@ -18,50 +22,257 @@ import (
 const (
 	alertmanagerCfgPrefix = "alertmanager/configs/"
 	keyFmt                = "alertmanager/configs/user/%s"
+	// The apply status is kept outside of the configs prefix, so that it is
+	// not seen by the config watch.
+	statusPrefixFmt = "alertmanager/status/user/%s/"
+	// The global inhibition rules are kept outside of the configs prefix
+	// too, they are loaded on resync.
+	globalInhibitRulesKey = "alertmanager/global/inhibit_rules"
 
-	DialTimeout = 10 * time.Second
+	// Page size GetAllConfigs reads the configs with.
+	allConfigsPageSize = 500
+
+	// Delay before restarting a watch which stopped.
+	watchRestartDelay = time.Second
+)
+
+// Reasons config watches are restarted for.
+const (
+	watchRestartClosed    = "closed"
+	watchRestartError     = "error"
+	watchRestartCompacted = "compacted"
 )
 
+var watchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "appscode",
+	Name:      "etcd_watch_restarts_total",
+	Help:      "The total number of restarts of the config watch.",
+}, []string{"reason"})
+
+func init() {
+	prometheus.MustRegister(watchRestarts)
+}
+
 type Client struct {
-	cl     *clientv3.Client
-	kv     clientv3.KV
-	ctx    context.Context
+	// watcher is the config watch of Watch.
+	watcher *Watcher
+
+	cl             *clientv3.Client
+	kv             clientv3.KV
+	requestTimeout time.Duration
+	breaker        *breaker
+	// prefix namespaces all keys, it is empty or ends with a slash.
+	prefix string
 	logger log.Logger
+
+	// The apply statuses of this replica are attached to statusLease, so
+	// that they are removed statusTTL after the replica stopped. statuses
+	// holds them by key, to store them again when the lease was lost.
+	statusTTL       time.Duration
+	statusMtx       sync.Mutex
+	statusLease     clientv3.LeaseID
+	statusLeaseLost chan struct{}
+	statusCancel    context.CancelFunc
+	statuses        map[string]string
+
+	// The archived alert groups are attached to historyLease until
+	// historyLeaseRenew, see historyLease.
+	historyRetention  time.Duration
+	historyMtx        sync.Mutex
+	historyLease      clientv3.LeaseID
+	historyLeaseRenew time.Time
 }
 
 func NewClient(c *Config, l log.Logger) (*Client, error) {
+	tlsCfg, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	password, err := c.password()
+	if err != nil {
+		return nil, err
+	}
 	cl, err := clientv3.New(clientv3.Config{
-		Endpoints:   c.Endpoints,
-		DialTimeout: DialTimeout,
+		Endpoints:            c.Endpoints,
+		DialTimeout:          c.DialTimeout,
+		DialKeepAliveTime:    c.DialKeepAliveTime,
+		DialKeepAliveTimeout: c.DialKeepAliveTimeout,
+		TLS:                  tlsCfg,
+		Username:             c.Username,
+		Password:             password,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create etcd client")
 	}
 
-	// TODO: should we use context with timer, if we use, then consider the time to get all configs
-	return &Client{
-		cl:     cl,
-		kv:     clientv3.NewKV(cl),
-		ctx:    context.Background(),
-		logger: l,
-	}, nil
+	client := &Client{
+		cl:             cl,
+		kv:             tracedKV{clientv3.NewKV(cl)},
+		requestTimeout: c.RequestTimeout,
+		breaker:        newBreaker(c.BreakerFailures, c.BreakerOpenDuration),
+		prefix:         c.keyPrefix(),
+		logger:         l,
+		statusTTL:      c.ApplyStatusTTL,
+		statuses:       map[string]string{},
+
+		historyRetention: c.HistoryRetention,
+	}
+	client.watcher = client.NewWatcher()
+	return client, nil
+}
+
+// withTimeout bounds a single request by the configured request timeout.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.requestTimeout)
 }
 
-func (c *Client) GetConfig(userID string) (am.AlertmanagerConfig, error) {
-	return c.get(getKey(userID))
+func (c *Client) GetConfig(ctx context.Context, userID string) (am.AlertmanagerConfig, error) {
+	return c.get(ctx, c.getKey(userID))
 }
 
-func (c *Client) GetAllConfigs() ([]am.AlertmanagerConfig, error) {
-	return c.getWithPrefix(alertmanagerCfgPrefix)
+// GetAllConfigs returns all configs, read in pages of allConfigsPageSize.
+func (c *Client) GetAllConfigs(ctx context.Context) ([]am.AlertmanagerConfig, error) {
+	var amCfgList []am.AlertmanagerConfig
+	opts := am.ListConfigsOptions{Limit: allConfigsPageSize}
+	for {
+		cfgs, next, err := c.ListConfigs(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		amCfgList = append(amCfgList, cfgs...)
+		if next == "" {
+			return amCfgList, nil
+		}
+		opts.Continue = next
+	}
+}
+
+// ListConfigs returns a page of configs. The continue token holds the
+// revision of the first page and the last key returned, so that all pages
+// are read at the same revision. It expires when the revision is compacted.
+func (c *Client) ListConfigs(ctx context.Context, opts am.ListConfigsOptions) ([]am.AlertmanagerConfig, string, error) {
+	start := c.getKey(opts.UserIDPrefix)
+	end := clientv3.GetPrefixRangeEnd(start)
+	var rev int64
+	if opts.Continue != "" {
+		var lastKey string
+		var err error
+		rev, lastKey, err = decodeContinue(opts.Continue)
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(lastKey, start) {
+			return nil, "", errors.New("continue token does not match the user id prefix")
+		}
+		// Start right after the last key returned.
+		start = lastKey + "\x00"
+	}
+
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, start, clientv3.WithRange(end), clientv3.WithLimit(opts.Limit), clientv3.WithRev(rev))
+		return err
+	})
+	if err != nil {
+		if opts.Continue != "" {
+			return nil, "", errors.Wrap(err, "failed to list configs, the continue token may have expired")
+		}
+		return nil, "", err
+	}
+
+	amCfgList := make([]am.AlertmanagerConfig, 0, len(resp.Kvs))
+	for _, rg := range resp.Kvs {
+		amCfg := am.AlertmanagerConfig{}
+		if err := yaml.Unmarshal(rg.Value, &amCfg); err != nil {
+			return nil, "", errors.Wrap(err, "failed to decode response")
+		}
+		amCfg.Revision = rg.ModRevision
+		amCfgList = append(amCfgList, amCfg)
+	}
+	if !resp.More || len(resp.Kvs) == 0 {
+		return amCfgList, "", nil
+	}
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+	return amCfgList, encodeContinue(rev, string(resp.Kvs[len(resp.Kvs)-1].Key)), nil
 }
 
-func (c *Client) SetConfig(amCfg *am.AlertmanagerConfig) error {
+func (c *Client) SetConfig(ctx context.Context, amCfg *am.AlertmanagerConfig) error {
 	// TODO: Add validation
-	return c.put(amCfg)
+	return c.put(ctx, amCfg)
 }
 
-func (c *Client) DeactivateConfig(userID string) error {
-	amCfg, err := c.GetConfig(userID)
+// UpdateConfig stores the config of a user as changed by update, if its mod
+// revision did not change since it was read. Otherwise it is read and
+// updated again.
+func (c *Client) UpdateConfig(ctx context.Context, userID string, update func(amCfg *am.AlertmanagerConfig) error) error {
+	key := c.getKey(userID)
+	for {
+		var resp *clientv3.GetResponse
+		err := c.do(ctx, func(ctx context.Context) (err error) {
+			resp, err = c.kv.Get(ctx, key)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get config")
+		}
+		amCfg := am.AlertmanagerConfig{}
+		// The mod revision of a missing key is 0.
+		var rev int64
+		if len(resp.Kvs) > 0 {
+			if err := yaml.Unmarshal(resp.Kvs[0].Value, &amCfg); err != nil {
+				return errors.Wrap(err, "failed to decode response")
+			}
+			rev = resp.Kvs[0].ModRevision
+		}
+		amCfg.Revision = rev
+
+		if err := update(&amCfg); err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(&amCfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal alertmanager config")
+		}
+
+		var txn *clientv3.TxnResponse
+		err = c.do(ctx, func(ctx context.Context) (err error) {
+			txn, err = c.kv.Txn(ctx).
+				If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+				Then(clientv3.OpPut(key, string(data))).
+				Commit()
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to store alertmanager config")
+		}
+		if txn.Succeeded {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteConfig removes the config of a user.
+func (c *Client) DeleteConfig(ctx context.Context, userID string) error {
+	err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.kv.Delete(ctx, c.getKey(userID))
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete alertmanager config")
+	}
+	return nil
+}
+
+func (c *Client) DeactivateConfig(ctx context.Context, userID string) error {
+	amCfg, err := c.GetConfig(ctx, userID)
 	if err != nil {
 		return errors.Wrap(err, "failed to get config")
 	}
@@ -69,15 +280,15 @@ func (c *Client) DeactivateConfig(userID string) error {
 	amCfg.DeactivatedAtInUnix = time.Now().Unix()
 	amCfg.UpdatedAtInUnix = time.Now().Unix()
 
-	err = c.put(&amCfg)
+	err = c.put(ctx, &amCfg)
 	if err != nil {
 		return errors.Wrap(err, "failed to store config")
 	}
 	return nil
 }
 
-func (c *Client) RestoreConfig(userID string) error {
-	amCfg, err := c.GetConfig(userID)
+func (c *Client) RestoreConfig(ctx context.Context, userID string) error {
+	amCfg, err := c.GetConfig(ctx, userID)
 	if err != nil {
 		return errors.Wrap(err, "failed to get config")
 	}
@@ -85,91 +296,315 @@ func (c *Client) RestoreConfig(userID string) error {
 	amCfg.DeactivatedAtInUnix = 0
 	amCfg.UpdatedAtInUnix = time.Now().Unix()
 
-	err = c.put(&amCfg)
+	err = c.put(ctx, &amCfg)
 	if err != nil {
 		return errors.Wrap(err, "failed to store config")
 	}
 	return nil
 }
 
-func (c *Client) get(key string) (am.AlertmanagerConfig, error) {
-	rg := am.AlertmanagerConfig{}
+// SetApplyStatus stores the apply status of a user on replica, attached to
+// the lease of this replica.
+func (c *Client) SetApplyStatus(ctx context.Context, userID, replica string, st *am.ApplyStatus) error {
+	data, err := yaml.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal apply status")
+	}
+	key := c.getStatusPrefix(userID) + replica
 
-	resp, err := c.kv.Get(c.ctx, key)
+	c.statusMtx.Lock()
+	defer c.statusMtx.Unlock()
+	lease, err := c.applyStatusLease(ctx)
 	if err != nil {
-		return rg, err
+		return errors.Wrap(err, "failed to store apply status")
 	}
-	if len(resp.Kvs) == 0 {
-		return rg, nil
+	err = c.do(ctx, func(ctx context.Context) error {
+		_, err := c.kv.Put(ctx, key, string(data), clientv3.WithLease(lease))
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to store apply status")
 	}
+	c.statuses[key] = string(data)
+	return nil
+}
 
-	if err := yaml.Unmarshal(resp.Kvs[0].Value, &rg); err != nil {
-		return rg, errors.Wrap(err, "failed to decode response")
+// DeleteApplyStatus removes the apply status of a user on replica.
+func (c *Client) DeleteApplyStatus(ctx context.Context, userID, replica string) error {
+	key := c.getStatusPrefix(userID) + replica
+
+	c.statusMtx.Lock()
+	defer c.statusMtx.Unlock()
+	err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.kv.Delete(ctx, key)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete apply status")
 	}
-	return rg, nil
+	delete(c.statuses, key)
+	return nil
+}
+
+// applyStatusLease returns the lease of the apply statuses of this replica.
+// If the lease was lost, and with it the stored statuses, a new lease is
+// granted and the statuses are stored again. Must be called with statusMtx
+// held.
+func (c *Client) applyStatusLease(ctx context.Context) (clientv3.LeaseID, error) {
+	if c.statusLeaseLost != nil {
+		select {
+		case <-c.statusLeaseLost:
+			am.Must(level.Warn(c.logger).Log("msg", "apply status lease lost, storing apply statuses again", "statuses", len(c.statuses)))
+			c.statusCancel()
+			c.statusLeaseLost = nil
+		default:
+			return c.statusLease, nil
+		}
+	}
+
+	ttl := int64(c.statusTTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	var lease *clientv3.LeaseGrantResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		lease, err = c.cl.Grant(ctx, ttl)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to grant apply status lease")
+	}
+	// The lease is kept alive until the client is closed.
+	kaCtx, cancel := context.WithCancel(context.Background())
+	keepAlive, err := c.cl.KeepAlive(kaCtx, lease.ID)
+	if err != nil {
+		cancel()
+		return 0, errors.Wrap(err, "failed to keep apply status lease alive")
+	}
+	lost := make(chan struct{})
+	go func() {
+		for range keepAlive {
+		}
+		close(lost)
+	}()
+
+	for key, data := range c.statuses {
+		err := c.do(ctx, func(ctx context.Context) error {
+			_, err := c.kv.Put(ctx, key, data, clientv3.WithLease(lease.ID))
+			return err
+		})
+		if err != nil {
+			// The lease expires, and is granted again on the next call.
+			cancel()
+			return 0, errors.Wrap(err, "failed to store apply statuses again")
+		}
+	}
+	c.statusLease, c.statusLeaseLost, c.statusCancel = lease.ID, lost, cancel
+	return lease.ID, nil
 }
 
-func (c *Client) getWithPrefix(prefix string) ([]am.AlertmanagerConfig, error) {
-	resp, err := c.kv.Get(c.ctx, prefix, clientv3.WithPrefix())
+func (c *Client) GetApplyStatus(ctx context.Context, userID string) (map[string]am.ApplyStatus, error) {
+	prefix := c.getStatusPrefix(userID)
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, prefix, clientv3.WithPrefix())
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var amCfgList []am.AlertmanagerConfig
-	for _, rg := range resp.Kvs {
-		amCfg := am.AlertmanagerConfig{}
-		if err := yaml.Unmarshal(rg.Value, &amCfg); err != nil {
-			return nil, errors.Wrap(err, "failed to decode response")
+	statuses := map[string]am.ApplyStatus{}
+	for _, kv := range resp.Kvs {
+		st := am.ApplyStatus{}
+		if err := yaml.Unmarshal(kv.Value, &st); err != nil {
+			return nil, errors.Wrap(err, "failed to decode apply status")
 		}
-		amCfgList = append(amCfgList, amCfg)
+		statuses[strings.TrimPrefix(string(kv.Key), prefix)] = st
+	}
+	return statuses, nil
+}
+
+func (c *Client) GetGlobalInhibitRules(ctx context.Context) (string, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, c.prefix+globalInhibitRulesKey)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (c *Client) SetGlobalInhibitRules(ctx context.Context, rules string) error {
+	err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.kv.Put(ctx, c.prefix+globalInhibitRulesKey, rules)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to store global inhibit rules")
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, key string) (am.AlertmanagerConfig, error) {
+	rg := am.AlertmanagerConfig{}
+
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return rg, err
 	}
-	return amCfgList, nil
+	if len(resp.Kvs) == 0 {
+		return rg, nil
+	}
+
+	if err := yaml.Unmarshal(resp.Kvs[0].Value, &rg); err != nil {
+		return rg, errors.Wrap(err, "failed to decode response")
+	}
+	rg.Revision = resp.Kvs[0].ModRevision
+	return rg, nil
 }
 
-func (c *Client) put(amCfg *am.AlertmanagerConfig) error {
+func (c *Client) put(ctx context.Context, amCfg *am.AlertmanagerConfig) error {
 	data, err := yaml.Marshal(amCfg)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal alertmanager config")
 	}
 
-	_, err = c.kv.Put(c.ctx, getKey(amCfg.UserID), string(data))
+	err = c.do(ctx, func(ctx context.Context) error {
+		_, err := c.kv.Put(ctx, c.getKey(amCfg.UserID), string(data))
+		return err
+	})
 	if err != nil {
 		return errors.Wrap(err, "failed to store alertmanager config")
 	}
 	return nil
 }
 
-// Watches the keys
-// it's blocking
-func (c *Client) Watch(ch chan am.AlertmanagerConfig) {
-	watcher := c.cl.Watch(c.ctx, alertmanagerCfgPrefix, clientv3.WithPrefix())
+// Watch sends the changed configs to ch. It blocks, re-establishing the
+// watch from the last seen revision when it fails, and returns
+// am.ErrResyncRequired if updates were compacted before they were seen.
+// Watch is not safe for concurrent use, other watches are created with
+// NewWatcher.
+func (c *Client) Watch(ch chan am.AlertmanagerConfig) error {
+	return c.watcher.Watch(ch)
+}
+
+// A Watcher watches the configs, continuing from the revision its last watch
+// stopped at.
+type Watcher struct {
+	c *Client
+	// rev is the revision the config watch continues from.
+	rev int64
+}
+
+// NewWatcher creates a config watch independent of the one of Watch.
+func (c *Client) NewWatcher() *Watcher {
+	return &Watcher{c: c}
+}
+
+// Watch sends the changed configs to ch, like Client.Watch.
+func (w *Watcher) Watch(ch chan am.AlertmanagerConfig) error {
+	c := w.c
+	if w.rev == 0 {
+		// Start from the current revision, so that updates made while the
+		// first watch is established are not missed.
+		for {
+			rev, err := c.Revision(context.Background())
+			if err == nil {
+				w.rev = rev + 1
+				break
+			}
+			am.Must(level.Warn(c.logger).Log("msg", "failed to get current revision", "err", err))
+			time.Sleep(watchRestartDelay)
+		}
+	}
+
+	for {
+		reason, err := w.watch(ch)
+		watchRestarts.WithLabelValues(reason).Inc()
+		if err == am.ErrResyncRequired {
+			return err
+		}
+		am.Must(level.Warn(c.logger).Log("msg", "config watch stopped, restarting", "reason", reason, "revision", w.rev, "err", err))
+		time.Sleep(watchRestartDelay)
+	}
+}
+
+// watch watches the configs from the last seen revision until the watch
+// stops, and returns the reason it stopped for.
+func (w *Watcher) watch(ch chan am.AlertmanagerConfig) (string, error) {
+	c := w.c
+	// Requiring a leader fails the watch if the member is partitioned,
+	// instead of silently waiting for updates.
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+	defer cancel()
+	watcher := c.cl.Watch(ctx, c.prefix+alertmanagerCfgPrefix, clientv3.WithPrefix(), clientv3.WithRev(w.rev))
 	for resp := range watcher {
+		if resp.CompactRevision > 0 {
+			// The updates since the last seen revision are gone, watch from
+			// the oldest revision left and load all configs.
+			am.Must(level.Warn(c.logger).Log("msg", "config watch revision compacted", "revision", w.rev, "compact_revision", resp.CompactRevision))
+			w.rev = resp.CompactRevision
+			return watchRestartCompacted, am.ErrResyncRequired
+		}
+		if err := resp.Err(); err != nil {
+			return watchRestartError, err
+		}
 		for _, ev := range resp.Events {
-
 			if ev.Type == clientv3.EventTypeDelete {
-				userID := getUserIDFromKey(string(ev.Kv.Key))
+				userID := getUserIDFromKey(strings.TrimPrefix(string(ev.Kv.Key), c.prefix))
 				ch <- am.AlertmanagerConfig{
 					UserID:          userID,
 					DeletedAtInUnix: time.Now().Unix(),
+					Revision:        ev.Kv.ModRevision,
 				}
 			} else {
 				amCfg := am.AlertmanagerConfig{}
 				if err := yaml.Unmarshal(ev.Kv.Value, &amCfg); err != nil {
 					am.Must(level.Warn(c.logger).Log("msg", "failed unmarshal response", "err", err))
 				} else {
+					amCfg.Revision = ev.Kv.ModRevision
 					ch <- amCfg
 				}
 			}
+			w.rev = ev.Kv.ModRevision + 1
 		}
 	}
+	return watchRestartClosed, nil
+}
+
+// Revision returns the current revision of the store.
+func (c *Client) Revision(ctx context.Context) (int64, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, c.prefix+alertmanagerCfgPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
 }
 
 func (c *Client) Close() {
 	am.Must(c.cl.Close())
 }
 
-func getKey(usedID string) string {
-	return fmt.Sprintf(keyFmt, usedID)
+func (c *Client) getKey(usedID string) string {
+	return c.prefix + fmt.Sprintf(keyFmt, usedID)
+}
+
+func (c *Client) getStatusPrefix(userID string) string {
+	return c.prefix + fmt.Sprintf(statusPrefixFmt, userID)
 }
 
 func getUserIDFromKey(key string) (userID string) {
@@ -179,3 +614,23 @@ func getUserIDFromKey(key string) (userID string) {
 	}
 	return userID
 }
+
+func encodeContinue(rev int64, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(rev, 10) + "/" + key))
+}
+
+func decodeContinue(token string) (int64, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, "", errors.New("invalid continue token")
+	}
+	parts := strings.SplitN(string(data), "/", 2)
+	if len(parts) != 2 {
+		return 0, "", errors.New("invalid continue token")
+	}
+	rev, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, "", errors.New("invalid continue token")
+	}
+	return rev, parts[1], nil
+}
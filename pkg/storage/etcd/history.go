@@ -0,0 +1,128 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	am "go.searchlight.dev/alertmanager/pkg/alertmanager"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/clientv3"
+)
+
+const (
+	// The archived alert groups of a user are kept under historyPrefixFmt,
+	// keyed by their resolution time so that they are listed in order.
+	historyPrefixFmt = "alertmanager/history/user/%s/"
+
+	// Page size ListArchivedAlertGroups reads the groups with.
+	historyPageSize = 200
+
+	// historyLeaseReuse is how long a history lease is attached to the
+	// archived groups before a new one is granted, the groups are kept up
+	// to that much longer than the retention.
+	historyLeaseReuse = time.Hour
+)
+
+// ArchiveAlertGroup stores a resolved alert group of a user, which is
+// removed once older than the history retention.
+func (c *Client) ArchiveAlertGroup(ctx context.Context, userID string, g *am.ArchivedGroup) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal alert group")
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(g.GroupKey))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(g.Receiver))
+	key := fmt.Sprintf("%s%020d-%016x", c.getHistoryPrefix(userID), g.ResolvedAt.UnixNano(), h.Sum64())
+
+	lease, err := c.historyLeaseID(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to archive alert group")
+	}
+	err = c.do(ctx, func(ctx context.Context) error {
+		_, err := c.kv.Put(ctx, key, string(data), clientv3.WithLease(lease))
+		return err
+	})
+	return errors.Wrap(err, "failed to archive alert group")
+}
+
+// historyLeaseID returns the lease the archived groups are attached to. A
+// lease of the retention plus historyLeaseReuse is shared by the groups
+// archived within historyLeaseReuse, so that a lease is not granted for
+// every group.
+func (c *Client) historyLeaseID(ctx context.Context) (clientv3.LeaseID, error) {
+	c.historyMtx.Lock()
+	defer c.historyMtx.Unlock()
+	now := time.Now()
+	if c.historyLease != 0 && now.Before(c.historyLeaseRenew) {
+		return c.historyLease, nil
+	}
+
+	reuse := historyLeaseReuse
+	if c.historyRetention < reuse {
+		reuse = c.historyRetention
+	}
+	ttl := int64((c.historyRetention + reuse) / time.Second)
+	var lease *clientv3.LeaseGrantResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		lease, err = c.cl.Grant(ctx, ttl)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to grant history lease")
+	}
+	c.historyLease, c.historyLeaseRenew = lease.ID, now.Add(reuse)
+	return lease.ID, nil
+}
+
+// ListArchivedAlertGroups returns the archived alert groups of a user
+// resolved between q.Since and q.Until and selected by the matchers of q,
+// the last resolved first.
+func (c *Client) ListArchivedAlertGroups(ctx context.Context, userID string, q am.HistoryQuery) ([]am.ArchivedGroup, error) {
+	prefix := c.getHistoryPrefix(userID)
+	start := fmt.Sprintf("%s%020d", prefix, q.Since.UnixNano())
+	end := fmt.Sprintf("%s%020d", prefix, q.Until.UnixNano()+1)
+
+	var groups []am.ArchivedGroup
+	for q.Limit <= 0 || len(groups) < q.Limit {
+		var resp *clientv3.GetResponse
+		err := c.do(ctx, func(ctx context.Context) (err error) {
+			resp, err = c.kv.Get(ctx, start,
+				clientv3.WithRange(end),
+				clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend),
+				clientv3.WithLimit(historyPageSize))
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list archived alert groups")
+		}
+		for _, kv := range resp.Kvs {
+			var g am.ArchivedGroup
+			if err := json.Unmarshal(kv.Value, &g); err != nil {
+				return nil, errors.Wrapf(err, "failed to unmarshal archived alert group %s", kv.Key)
+			}
+			if g, ok := q.Filter(g); ok {
+				groups = append(groups, g)
+				if q.Limit > 0 && len(groups) == q.Limit {
+					break
+				}
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			break
+		}
+		// The range end is exclusive, the next page ends before the last
+		// key read.
+		end = string(resp.Kvs[len(resp.Kvs)-1].Key)
+	}
+	return groups, nil
+}
+
+func (c *Client) getHistoryPrefix(userID string) string {
+	return c.prefix + fmt.Sprintf(historyPrefixFmt, userID)
+}
@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	am "go.searchlight.dev/alertmanager/pkg/alertmanager"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/clientv3"
+)
+
+const (
+	// Jobs and their cancellation requests are kept outside of the configs
+	// prefix, so that they are not seen by the config watch.
+	jobPrefix       = "alertmanager/jobs/"
+	jobCancelPrefix = "alertmanager/job-cancels/"
+)
+
+// SetJob stores a job. It is removed after ttl, unless ttl is 0.
+func (c *Client) SetJob(ctx context.Context, job *am.Job, ttl time.Duration) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job")
+	}
+	if err := c.putWithTTL(ctx, c.prefix+jobPrefix+job.ID, string(data), ttl); err != nil {
+		return errors.Wrap(err, "failed to store job")
+	}
+	return nil
+}
+
+// GetJob returns a job, or nil if it does not exist.
+func (c *Client) GetJob(ctx context.Context, id string) (*am.Job, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, c.prefix+jobPrefix+id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	job := &am.Job{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, job); err != nil {
+		return nil, errors.Wrap(err, "failed to decode job")
+	}
+	return job, nil
+}
+
+func (c *Client) ListJobs(ctx context.Context) ([]am.Job, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, c.prefix+jobPrefix, clientv3.WithPrefix())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]am.Job, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		job := am.Job{}
+		if err := json.Unmarshal(kv.Value, &job); err != nil {
+			return nil, errors.Wrap(err, "failed to decode job")
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// CancelJob requests the cancellation of a job. The request is removed
+// after ttl.
+func (c *Client) CancelJob(ctx context.Context, id string, ttl time.Duration) error {
+	if err := c.putWithTTL(ctx, c.prefix+jobCancelPrefix+id, "", ttl); err != nil {
+		return errors.Wrap(err, "failed to store job cancellation")
+	}
+	return nil
+}
+
+func (c *Client) JobCancelled(ctx context.Context, id string) (bool, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, c.prefix+jobCancelPrefix+id, clientv3.WithCountOnly())
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+// putWithTTL puts key attached to a lease of ttl, or without lease if ttl is
+// 0.
+func (c *Client) putWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.do(ctx, func(ctx context.Context) error {
+		var opts []clientv3.OpOption
+		if ttl > 0 {
+			seconds := int64(ttl / time.Second)
+			if seconds < 1 {
+				seconds = 1
+			}
+			lease, err := c.cl.Grant(ctx, seconds)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, clientv3.WithLease(lease.ID))
+		}
+		_, err := c.kv.Put(ctx, key, value, opts...)
+		return err
+	})
+}
@@ -0,0 +1,163 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	am "go.searchlight.dev/alertmanager/pkg/alertmanager"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/clientv3"
+)
+
+const (
+	// The library templates and their versions are kept outside of the
+	// configs prefix, they are loaded on resync.
+	libraryTemplatePrefix        = "alertmanager/library/templates/"
+	libraryTemplateVersionPrefix = "alertmanager/library/versions/"
+)
+
+func (c *Client) libraryTemplateKey(name string) string {
+	return c.prefix + libraryTemplatePrefix + name
+}
+
+func (c *Client) libraryVersionsPrefix(name string) string {
+	return c.prefix + libraryTemplateVersionPrefix + name + "/"
+}
+
+// libraryVersionKey is zero padded, so that the versions are listed in
+// order.
+func (c *Client) libraryVersionKey(name string, version int64) string {
+	return c.libraryVersionsPrefix(name) + fmt.Sprintf("%020d", version)
+}
+
+func (c *Client) ListLibraryTemplates(ctx context.Context) ([]am.LibraryTemplate, error) {
+	return c.listLibraryTemplates(ctx, c.prefix+libraryTemplatePrefix)
+}
+
+func (c *Client) ListLibraryTemplateVersions(ctx context.Context, name string) ([]am.LibraryTemplate, error) {
+	return c.listLibraryTemplates(ctx, c.libraryVersionsPrefix(name))
+}
+
+func (c *Client) listLibraryTemplates(ctx context.Context, prefix string) ([]am.LibraryTemplate, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, prefix, clientv3.WithPrefix())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]am.LibraryTemplate, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		t := am.LibraryTemplate{}
+		if err := json.Unmarshal(kv.Value, &t); err != nil {
+			return nil, errors.Wrap(err, "failed to decode library template")
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// GetLibraryTemplate returns a version of a library template, the current
+// one if version is 0, or nil if it does not exist.
+func (c *Client) GetLibraryTemplate(ctx context.Context, name string, version int64) (*am.LibraryTemplate, error) {
+	key := c.libraryTemplateKey(name)
+	if version > 0 {
+		key = c.libraryVersionKey(name, version)
+	}
+	t, _, err := c.getLibraryTemplate(ctx, key)
+	return t, err
+}
+
+// getLibraryTemplate returns the library template at key, or nil, and its
+// mod revision.
+func (c *Client) getLibraryTemplate(ctx context.Context, key string) (*am.LibraryTemplate, int64, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	// The mod revision of a missing key is 0.
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	t := &am.LibraryTemplate{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, t); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to decode library template")
+	}
+	return t, resp.Kvs[0].ModRevision, nil
+}
+
+// SetLibraryTemplate stores the next version of a library template, if the
+// current version did not change since it was read. Otherwise it is read
+// and stored again. The oldest version is removed once more than
+// am.LibraryTemplateVersionsKept versions are kept.
+func (c *Client) SetLibraryTemplate(ctx context.Context, name, content string) (*am.LibraryTemplate, error) {
+	key := c.libraryTemplateKey(name)
+	for {
+		cur, rev, err := c.getLibraryTemplate(ctx, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get library template")
+		}
+		t := &am.LibraryTemplate{
+			Name:            name,
+			Content:         content,
+			Version:         1,
+			UpdatedAtInUnix: time.Now().Unix(),
+		}
+		if cur != nil {
+			t.Version = cur.Version + 1
+		}
+		data, err := json.Marshal(t)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal library template")
+		}
+
+		ops := []clientv3.Op{
+			clientv3.OpPut(key, string(data)),
+			clientv3.OpPut(c.libraryVersionKey(name, t.Version), string(data)),
+		}
+		if old := t.Version - am.LibraryTemplateVersionsKept; old > 0 {
+			ops = append(ops, clientv3.OpDelete(c.libraryVersionKey(name, old)))
+		}
+		var txn *clientv3.TxnResponse
+		err = c.do(ctx, func(ctx context.Context) (err error) {
+			txn, err = c.kv.Txn(ctx).
+				If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+				Then(ops...).
+				Commit()
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to store library template")
+		}
+		if txn.Succeeded {
+			return t, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DeleteLibraryTemplate removes a library template with all its versions.
+func (c *Client) DeleteLibraryTemplate(ctx context.Context, name string) (bool, error) {
+	var txn *clientv3.TxnResponse
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		txn, err = c.kv.Txn(ctx).Then(
+			clientv3.OpDelete(c.libraryTemplateKey(name)),
+			clientv3.OpDelete(c.libraryVersionsPrefix(name), clientv3.WithPrefix()),
+		).Commit()
+		return err
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to delete library template")
+	}
+	return txn.Responses[0].GetResponseDeleteRange().Deleted > 0, nil
+}
@@ -0,0 +1,98 @@
+package etcd
+
+import (
+	"context"
+
+	"go.searchlight.dev/alertmanager/pkg/tracing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.etcd.io/etcd/clientv3"
+)
+
+// tracedKV traces the requests to etcd as children of the spans of their
+// contexts.
+type tracedKV struct {
+	clientv3.KV
+}
+
+func startSpan(ctx context.Context, op, key string) (opentracing.Span, context.Context) {
+	sp, ctx := opentracing.StartSpanFromContext(ctx, "etcd "+op)
+	ext.DBType.Set(sp, "etcd")
+	ext.SpanKindRPCClient.Set(sp)
+	if key != "" {
+		sp.SetTag("key", key)
+	}
+	return sp, ctx
+}
+
+func finishSpan(sp opentracing.Span, err error) {
+	if err != nil {
+		tracing.SetError(sp, err)
+	}
+	sp.Finish()
+}
+
+func (kv tracedKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	sp, ctx := startSpan(ctx, "Put", key)
+	resp, err := kv.KV.Put(ctx, key, val, opts...)
+	finishSpan(sp, err)
+	return resp, err
+}
+
+func (kv tracedKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	sp, ctx := startSpan(ctx, "Get", key)
+	resp, err := kv.KV.Get(ctx, key, opts...)
+	finishSpan(sp, err)
+	return resp, err
+}
+
+func (kv tracedKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	sp, ctx := startSpan(ctx, "Delete", key)
+	resp, err := kv.KV.Delete(ctx, key, opts...)
+	finishSpan(sp, err)
+	return resp, err
+}
+
+func (kv tracedKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	sp, ctx := startSpan(ctx, "Do", string(op.KeyBytes()))
+	resp, err := kv.KV.Do(ctx, op)
+	finishSpan(sp, err)
+	return resp, err
+}
+
+func (kv tracedKV) Txn(ctx context.Context) clientv3.Txn {
+	sp, ctx := startSpan(ctx, "Txn", "")
+	return &tracedTxn{Txn: kv.KV.Txn(ctx), sp: sp}
+}
+
+// tracedTxn finishes the span of a transaction once it is committed. The
+// span starts when the transaction is created, which is right before.
+type tracedTxn struct {
+	clientv3.Txn
+	sp opentracing.Span
+}
+
+func (t *tracedTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.Txn = t.Txn.If(cs...)
+	return t
+}
+
+func (t *tracedTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.Txn = t.Txn.Then(ops...)
+	return t
+}
+
+func (t *tracedTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.Txn = t.Txn.Else(ops...)
+	return t
+}
+
+func (t *tracedTxn) Commit() (*clientv3.TxnResponse, error) {
+	resp, err := t.Txn.Commit()
+	if err == nil {
+		t.sp.SetTag("succeeded", resp.Succeeded)
+	}
+	finishSpan(t.sp, err)
+	return resp, err
+}
@@ -0,0 +1,51 @@
+package objstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by Bucket.Get when the object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Bucket is a minimal object storage client.
+type Bucket interface {
+	// Upload stores the content of r under key, overwriting any existing object.
+	Upload(ctx context.Context, key string, r io.Reader) error
+	// Get returns the content stored under key. It returns ErrNotFound if
+	// the object does not exist.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// NewBucket creates a Bucket for the configured backend.
+func NewBucket(c *Config) (Bucket, error) {
+	secretKey, err := c.secretKey()
+	if err != nil {
+		return nil, err
+	}
+	cfg := *c
+	cfg.SecretKey = secretKey
+	c = &cfg
+
+	switch c.Backend {
+	case BackendS3:
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3." + c.Region + ".amazonaws.com"
+		}
+		return newS3Bucket(c, endpoint)
+	case BackendGCS:
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = defaultGCSEndpoint
+		}
+		// GCS interoperability mode accepts "auto" as region
+		if c.Region == "" {
+			c.Region = "auto"
+		}
+		return newS3Bucket(c, endpoint)
+	}
+	return nil, errors.Errorf("unknown object storage backend %q", c.Backend)
+}
@@ -0,0 +1,100 @@
+package objstore
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	BackendS3  = "s3"
+	BackendGCS = "gcs"
+
+	defaultGCSEndpoint = "https://storage.googleapis.com"
+
+	// SecretKeyEnv is the environment variable holding the secret key, if
+	// no secret key file is given.
+	SecretKeyEnv = "STATE_SECRET_KEY"
+)
+
+// Config configures the object storage used to persist alertmanager state.
+// Both S3 and GCS (through its S3 interoperability API using HMAC keys) are
+// supported. An empty backend disables object storage.
+type Config struct {
+	Backend   string
+	Bucket    string
+	Endpoint  string
+	Region    string
+	AccessKey string
+	// SecretKeyFile is the file holding the secret key. The secret key is
+	// read from SecretKeyEnv otherwise.
+	SecretKeyFile string
+	// Deprecated: SecretKey is set by the deprecated state.secret-key flag,
+	// which exposes the secret in the process list.
+	SecretKey string
+	Prefix    string
+}
+
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet
+func (c *Config) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&c.Backend, "state.backend", "", "Object storage backend used to persist silences and notification logs. One of: s3, gcs. Empty disables persistence.")
+	f.StringVar(&c.Bucket, "state.bucket", "", "Bucket name used to persist alertmanager state.")
+	f.StringVar(&c.Endpoint, "state.endpoint", "", "Object storage endpoint. Defaults to the backend's public endpoint.")
+	f.StringVar(&c.Region, "state.region", "us-east-1", "Object storage region.")
+	f.StringVar(&c.AccessKey, "state.access-key", "", "Access key (or GCS HMAC key id) for object storage.")
+	f.StringVar(&c.SecretKeyFile, "state.secret-key-file", "", "File holding the secret key (or GCS HMAC secret) for object storage. The secret key is read from the "+SecretKeyEnv+" env otherwise.")
+	f.StringVar(&c.SecretKey, "state.secret-key", "", "Secret key (or GCS HMAC secret) for object storage.")
+	_ = f.MarkDeprecated("state.secret-key", "use state.secret-key-file or the "+SecretKeyEnv+" env instead")
+	f.StringVar(&c.Prefix, "state.prefix", "alertmanager", "Key prefix under which state snapshots are stored.")
+}
+
+// Enabled reports whether object storage is configured.
+func (c *Config) Enabled() bool {
+	return c.Backend != ""
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.Backend != BackendS3 && c.Backend != BackendGCS {
+		return errors.Errorf("--state.backend must be one of %s, %s", BackendS3, BackendGCS)
+	}
+	if c.Bucket == "" {
+		return errors.New("--state.bucket must be non empty")
+	}
+	if c.AccessKey == "" {
+		return errors.New("--state.access-key must be non empty")
+	}
+	secretKey, err := c.secretKey()
+	if err != nil {
+		return err
+	}
+	if secretKey == "" {
+		return errors.Errorf("--state.secret-key-file or %s env must be set", SecretKeyEnv)
+	}
+	return nil
+}
+
+// secretKey returns the secret key read from SecretKeyFile, SecretKeyEnv or
+// the deprecated flag, in this order.
+func (c *Config) secretKey() (string, error) {
+	if c.SecretKeyFile != "" {
+		data, err := ioutil.ReadFile(c.SecretKeyFile)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read --state.secret-key-file")
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if key := os.Getenv(SecretKeyEnv); key != "" {
+		return key, nil
+	}
+	return c.SecretKey, nil
+}
@@ -0,0 +1,98 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"go.searchlight.dev/alertmanager/pkg/aws"
+
+	"github.com/pkg/errors"
+)
+
+// s3Bucket talks to an S3 compatible API using path style requests signed
+// with AWS signature version 4.
+type s3Bucket struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	signer   aws.Signer
+	creds    aws.Credentials
+	client   *http.Client
+}
+
+func newS3Bucket(c *Config, endpoint string) (*s3Bucket, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid object storage endpoint")
+	}
+	return &s3Bucket{
+		endpoint: u,
+		bucket:   c.Bucket,
+		prefix:   strings.Trim(c.Prefix, "/"),
+		signer:   aws.Signer{Region: c.Region, Service: "s3", ContentSHA256: true},
+		creds:    aws.Credentials{AccessKeyID: c.AccessKey, SecretAccessKey: c.SecretKey},
+		client:   &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (b *s3Bucket) Upload(ctx context.Context, key string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read object content")
+	}
+	resp, err := b.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return responseErr(resp)
+	}
+	return nil
+}
+
+func (b *s3Bucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, responseErr(resp)
+	}
+	return resp.Body, nil
+}
+
+func (b *s3Bucket) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = "/" + path.Join(b.bucket, b.prefix, key)
+	u.RawPath = aws.EscapePath(u.Path)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	b.signer.Sign(req, body, b.creds, time.Now())
+
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s failed", method, key)
+	}
+	return resp, nil
+}
+
+func responseErr(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+const traceparentHeader = "traceparent"
+
+// traceContextPropagator propagates the spans over HTTP in the traceparent
+// header of the W3C Trace Context, which OpenTelemetry uses by default.
+type traceContextPropagator struct{}
+
+// Inject implements jaeger.Injector.
+func (traceContextPropagator) Inject(sc jaeger.SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	w.Set(traceparentHeader, formatTraceparent(sc))
+	return nil
+}
+
+// Extract implements jaeger.Extractor.
+func (traceContextPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var value string
+	err := r.ForeachKey(func(k, v string) error {
+		if strings.ToLower(k) == traceparentHeader {
+			value = v
+		}
+		return nil
+	})
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	if value == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	return parseTraceparent(value)
+}
+
+func formatTraceparent(sc jaeger.SpanContext) string {
+	flags := 0
+	if sc.IsSampled() {
+		flags = 1
+	}
+	id := sc.TraceID()
+	return fmt.Sprintf("00-%016x%016x-%016x-%02x", id.High, id.Low, uint64(sc.SpanID()), flags)
+}
+
+// parseTraceparent parses a traceparent header of version 00, or of a later
+// version which starts with the same fields.
+func parseTraceparent(s string) (jaeger.SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		parts[0] == "00" && len(parts) != 4 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	high, err1 := strconv.ParseUint(parts[1][:16], 16, 64)
+	low, err2 := strconv.ParseUint(parts[1][16:], 16, 64)
+	spanID, err3 := strconv.ParseUint(parts[2], 16, 64)
+	flags, err4 := strconv.ParseUint(parts[3], 16, 8)
+	for _, err := range []error{err1, err2, err3, err4} {
+		if err != nil {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	traceID := jaeger.TraceID{High: high, Low: low}
+	if !traceID.IsValid() || spanID == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	return jaeger.NewSpanContext(traceID, jaeger.SpanID(spanID), 0, flags&1 == 1, nil), nil
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+func TestTraceparent(t *testing.T) {
+	sc := jaeger.NewSpanContext(jaeger.TraceID{High: 0x4bf92f3577b34da6, Low: 0xa3ce929d0e0e4736}, 0x00f067aa0ba902b7, 0, true, nil)
+	h := http.Header{}
+	p := traceContextPropagator{}
+	if err := p.Inject(sc, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatal(err)
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := h.Get("traceparent"); got != want {
+		t.Fatalf("got traceparent %q, want %q", got, want)
+	}
+
+	got, err := p.Extract(opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsSampled() {
+		t.Fatalf("got span context %s, want %s", got, sc)
+	}
+
+	for _, v := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		h := http.Header{}
+		if v != "" {
+			h.Set("traceparent", v)
+		}
+		if _, err := p.Extract(opentracing.HTTPHeadersCarrier(h)); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"go.searchlight.dev/alertmanager/pkg/logger"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+// Config configures the export of the spans. Tracing is disabled unless an
+// agent address is set.
+type Config struct {
+	AgentAddress string
+	ServiceName  string
+	SampleRatio  float64
+}
+
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// AddFlags adds the flags required to config this to the given FlagSet
+func (c *Config) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&c.AgentAddress, "tracing.agent-address", "", "host:port of the agent the spans are exported to over UDP in the Jaeger format, like a Jaeger agent or the jaeger receiver of an OpenTelemetry Collector. Disabled if empty.")
+	f.StringVar(&c.ServiceName, "tracing.service-name", "alertmanager", "Service name of the spans.")
+	f.Float64Var(&c.SampleRatio, "tracing.sample-ratio", 1, "Ratio of the traces started by this service which are sampled. The sampling decision of incoming requests is kept.")
+}
+
+func (c *Config) Validate() error {
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.New("--tracing.sample-ratio must be between 0 and 1")
+	}
+	if c.AgentAddress != "" && c.ServiceName == "" {
+		return errors.New("--tracing.service-name must be non empty")
+	}
+	return nil
+}
+
+// jaegerLogger logs the errors of the tracer.
+type jaegerLogger struct{}
+
+func (jaegerLogger) Error(msg string) {
+	_ = level.Error(logger.Logger).Log("msg", "tracing: "+msg)
+}
+
+func (jaegerLogger) Infof(msg string, args ...interface{}) {
+	_ = level.Debug(logger.Logger).Log("msg", "tracing: "+fmt.Sprintf(msg, args...))
+}
+
+// Init sets the global tracer. The returned closer flushes the buffered
+// spans. Without an agent address, the no-op tracer is kept.
+func Init(c *Config) (io.Closer, error) {
+	if c.AgentAddress == "" {
+		return ioutil.NopCloser(nil), nil
+	}
+	transport, err := jaeger.NewUDPTransport(c.AgentAddress, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tracing transport")
+	}
+	sampler, err := jaeger.NewProbabilisticSampler(c.SampleRatio)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tracing sampler")
+	}
+	w3c := traceContextPropagator{}
+	tracer, closer := jaeger.NewTracer(
+		c.ServiceName,
+		sampler,
+		jaeger.NewRemoteReporter(transport, jaeger.ReporterOptions.Logger(jaegerLogger{})),
+		jaeger.TracerOptions.Logger(jaegerLogger{}),
+		jaeger.TracerOptions.Gen128Bit(true),
+		jaeger.TracerOptions.Injector(opentracing.HTTPHeaders, w3c),
+		jaeger.TracerOptions.Extractor(opentracing.HTTPHeaders, w3c),
+	)
+	opentracing.SetGlobalTracer(tracer)
+	return closer, nil
+}
+
+// SetError marks the span as failed with err.
+func SetError(sp opentracing.Span, err error) {
+	ext.Error.Set(sp, true)
+	sp.LogFields(otlog.Error(err))
+}
+
+// InjectRequest returns req with the span of its context propagated in its
+// headers. req is not modified, as required from round trippers.
+func InjectRequest(req *http.Request) *http.Request {
+	sp := opentracing.SpanFromContext(req.Context())
+	if sp == nil {
+		return req
+	}
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	Inject(req.Context(), r.Header)
+	return r
+}
+
+// Inject propagates the span of ctx in h, if there is one.
+func Inject(ctx context.Context, h http.Header) {
+	sp := opentracing.SpanFromContext(ctx)
+	if sp == nil {
+		return
+	}
+	_ = sp.Tracer().Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+}
+
+// statusRecorder records the status code of a response. It keeps the
+// response flushable, which the event streams need.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Middleware starts a span for each request, continuing the trace of the
+// caller. The spans are named after the matching route of r.
+func Middleware(r *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		op := "HTTP " + req.Method
+		var m mux.RouteMatch
+		if r.Match(req, &m) && m.Route != nil {
+			if tmpl, err := m.Route.GetPathTemplate(); err == nil {
+				op += " " + tmpl
+			}
+		}
+		tracer := opentracing.GlobalTracer()
+		parent, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+		sp := tracer.StartSpan(op, ext.RPCServerOption(parent))
+		defer sp.Finish()
+		ext.HTTPMethod.Set(sp, req.Method)
+		ext.HTTPUrl.Set(sp, req.URL.Path)
+		ext.Component.Set(sp, "net/http")
+
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, req.WithContext(opentracing.ContextWithSpan(req.Context(), sp)))
+		ext.HTTPStatusCode.Set(sp, uint16(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			ext.Error.Set(sp, true)
+		}
+	})
+}